@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// resourceAccessKey chave do contexto com as regras por caminho da cadeia
+type resourceAccessKey struct{}
+
+// resourceAccess regras por caminho da cadeia ativa. Os middlewares as
+// aplicam a r.URL.Path; as rotas que mapeiam a URL para outro arquivo (/dav,
+// API de arquivos, /=/<sha256>) as reaplicam ao caminho real com checkResource
+type resourceAccess struct {
+	proxyAuth     *ProxyAuth
+	timeWindows   *TimeWindows
+	signedCookies *SignedCookies
+}
+
+// ResourceAccessMiddleware disponibiliza as regras da cadeia às rotas
+func ResourceAccessMiddleware(access *resourceAccess) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), resourceAccessKey{}, access)))
+		})
+	}
+}
+
+// checkResource aplica a urlPath (caminho de URL do arquivo, não da rota) a
+// ACL do proxy de autenticação, as janelas de horário e os cookies
+// assinados, como serveFile os recebe pela cadeia. Retorna 0 ou o status
+// com que a cadeia recusaria o acesso direto
+func checkResource(r *http.Request, urlPath string) int {
+	access, ok := r.Context().Value(resourceAccessKey{}).(*resourceAccess)
+	if !ok {
+		return 0
+	}
+	urlPath = cleanResourcePath(urlPath)
+	if access.proxyAuth != nil {
+		if status := access.proxyAuth.check(r, urlPath); status != 0 {
+			return status
+		}
+	}
+	if access.timeWindows != nil {
+		if status := access.timeWindows.Check(urlPath); status != 0 {
+			return status
+		}
+	}
+	if sc := access.signedCookies; sc != nil && sc.protects(urlPath) && !sc.Allowed(r, urlPath) {
+		sc.denied.Add(1)
+		return http.StatusForbidden
+	}
+	return 0
+}
+
+// resourceDenied responde a recusa de checkResource
+func resourceDenied(w http.ResponseWriter, status int) {
+	// A recusa pode depender do horário ou do cookie: não pode ficar em cache
+	w.Header().Set("Cache-Control", "no-store")
+	if status == http.StatusUnauthorized {
+		http.Error(w, proxyAuthError(status), status)
+		return
+	}
+	http.Error(w, http.StatusText(status), status)
+}
+
+// protectedResource informa se alguma regra da cadeia cobre urlPath: a
+// resposta depende de quem pede (ou de quando) e não pode ir para caches
+// compartilhados
+func protectedResource(r *http.Request, urlPath string) bool {
+	access, ok := r.Context().Value(resourceAccessKey{}).(*resourceAccess)
+	if !ok {
+		return false
+	}
+	urlPath = cleanResourcePath(urlPath)
+	return (access.proxyAuth != nil && access.proxyAuth.covers(urlPath)) ||
+		(access.timeWindows != nil && access.timeWindows.covers(urlPath)) ||
+		(access.signedCookies != nil && access.signedCookies.protects(urlPath))
+}
+
+// cleanResourcePath normaliza urlPath mantendo a barra final dos
+// diretórios, como a cadeia os recebe em r.URL.Path
+func cleanResourcePath(urlPath string) string {
+	cleaned := path.Clean("/" + urlPath)
+	if strings.HasSuffix(urlPath, "/") && cleaned != "/" {
+		cleaned += "/"
+	}
+	return cleaned
+}
+
+// fileAccess aplica a path, arquivo que uma rota expõe sob outra URL (índices
+// de pacotes, registros), a visibilidade da listagem e as regras por caminho,
+// pelo caminho relativo à raiz; arquivos fora da raiz não têm caminho de URL
+// e ficam de fora. Retorna 0, 404 (oculto) ou a recusa de checkResource, e
+// se alguma regra cobre o arquivo
+func (s *Server) fileAccess(r *http.Request, root, path string) (status int, protected bool) {
+	if !isWithin(root, path) {
+		return 0, false
+	}
+	rel, err := filepath.Rel(root, path)
+	if err != nil || rel == "." {
+		return 0, false
+	}
+	rel = filepath.ToSlash(rel)
+	if !s.visiblePath(root, rel) {
+		return http.StatusNotFound, false
+	}
+	urlPath := "/" + rel
+	return checkResource(r, urlPath), protectedResource(r, urlPath)
+}
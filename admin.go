@@ -0,0 +1,138 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// adminRoute retorna o prefixo das rotas administrativas
+func (s *Server) adminRoute() string {
+	route := strings.TrimSuffix(s.config.Admin.Route, "/")
+	if route == "" {
+		route = "/_admin"
+	}
+	return route
+}
+
+// setupAdmin registra a API administrativa
+func (s *Server) setupAdmin() {
+	s.adminMux = http.NewServeMux()
+
+	s.handleAdmin("GET /root", s.handleAdminGetRoot)
+	s.handleAdmin("POST /root", s.handleAdminSwapRoot)
+	s.handleAdmin("POST /cache/purge", s.handleAdminPurge)
+	s.handleAdmin("GET /metrics", s.handleAdminMetrics)
+	s.handleAdmin("GET /log/level", s.handleAdminGetLogLevel)
+	s.handleAdmin("POST /log/level", s.handleAdminSetLogLevel)
+
+	handler := Chain(s.adminMux,
+		LoggingMiddleware(s.logger),
+		RecoveryMiddleware(s.panics, s.logger),
+		SecurityHeadersMiddleware(),
+		AdminAuthMiddleware(s.config.Admin),
+	)
+	s.mux.Handle(s.adminRoute()+"/", handler)
+	s.logger.Info("Admin API enabled at: %s", s.adminRoute())
+}
+
+// handleAdmin registra um endpoint na API administrativa (se habilitada).
+// O padrão segue o formato do http.ServeMux ("METHOD /path"), relativo ao prefixo.
+func (s *Server) handleAdmin(pattern string, handler http.HandlerFunc) {
+	if s.adminMux == nil {
+		return
+	}
+	method, path, found := strings.Cut(pattern, " ")
+	if !found {
+		method, path = "", pattern
+	}
+	s.adminMux.HandleFunc(strings.TrimSpace(method+" "+s.adminRoute()+path), handler)
+}
+
+// handleAdminGetLogLevel retorna o nível de log atual
+func (s *Server) handleAdminGetLogLevel(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"level": s.logger.Level()})
+}
+
+// handleAdminSetLogLevel altera o nível de log ({"level": "debug"})
+func (s *Server) handleAdminSetLogLevel(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Level string `json:"level"`
+	}
+	if err := decodeJSON(r, &req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+	previous := s.logger.Level()
+	if err := s.logger.SetLevel(req.Level); err != nil {
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+	s.logger.Warn("Log level changed from %s to %s via admin API", previous, req.Level)
+	writeJSON(w, http.StatusOK, map[string]string{"level": req.Level, "previous": previous})
+}
+
+// AdminAuthMiddleware exige o bearer token (e IP permitido) da API administrativa
+func AdminAuthMiddleware(config *AdminConfig) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if len(config.AllowedIPs) > 0 {
+				ip, _, _ := net.SplitHostPort(r.RemoteAddr)
+				allowed := false
+				for _, allowedIP := range config.AllowedIPs {
+					if ip == allowedIP {
+						allowed = true
+						break
+					}
+				}
+				if !allowed {
+					http.Error(w, "403 Forbidden", http.StatusForbidden)
+					return
+				}
+			}
+
+			// Bearer token ou, para navegadores (painel), Basic com o token como senha
+			token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok {
+				_, token, ok = r.BasicAuth()
+			}
+			if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(config.Token)) != 1 {
+				w.Header().Add("WWW-Authenticate", `Bearer realm="admin"`)
+				w.Header().Add("WWW-Authenticate", `Basic realm="admin"`)
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// writeJSON escreve uma resposta JSON
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(v)
+}
+
+// writeJSONError escreve um erro no formato {"error": "..."}
+func writeJSONError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+// decodeJSON decodifica o corpo da requisição (limitado a 1MB)
+func decodeJSON(r *http.Request, v interface{}) error {
+	decoder := json.NewDecoder(http.MaxBytesReader(nil, r.Body, 1<<20))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		return fmt.Errorf("invalid request body: %w", err)
+	}
+	return nil
+}
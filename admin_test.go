@@ -0,0 +1,211 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newAdminTestServer creates a server with the admin API enabled
+func newAdminTestServer(t *testing.T, root string) *Server {
+	t.Helper()
+
+	config := DefaultConfig()
+	config.Server.RootDir = root
+	config.Performance.EnableCompression = false
+	config.Admin = &AdminConfig{Enabled: true, Token: "s3cret"}
+
+	logger, _ := NewLogger(&LoggingConfig{Enabled: false})
+	server := NewServer(config, logger)
+	server.setupHandlers()
+	return server
+}
+
+// adminRequest performs an authenticated request against the admin API
+func adminRequest(server *Server, method, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer s3cret")
+	w := httptest.NewRecorder()
+	server.mux.ServeHTTP(w, req)
+	return w
+}
+
+// writeTestFile writes a file, creating parent directories
+func writeTestFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+}
+
+func TestAdminAuthMiddleware(t *testing.T) {
+	server := newAdminTestServer(t, t.TempDir())
+
+	tests := []struct {
+		name           string
+		auth           string
+		expectedStatus int
+	}{
+		{"NoToken", "", http.StatusUnauthorized},
+		{"WrongToken", "Bearer wrong", http.StatusUnauthorized},
+		{"BasicScheme", "Basic czNjcmV0", http.StatusUnauthorized},
+		{"ValidToken", "Bearer s3cret", http.StatusOK},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/_admin/root", nil)
+			if test.auth != "" {
+				req.Header.Set("Authorization", test.auth)
+			}
+			w := httptest.NewRecorder()
+			server.mux.ServeHTTP(w, req)
+
+			if w.Code != test.expectedStatus {
+				t.Errorf("Expected status %d, got %d", test.expectedStatus, w.Code)
+			}
+		})
+	}
+}
+
+func TestAdminAllowedIPs(t *testing.T) {
+	config := &AdminConfig{Enabled: true, Token: "s3cret", AllowedIPs: []string{"10.0.0.1"}}
+	handler := AdminAuthMiddleware(config)(testHandler())
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "192.168.1.1:1234"
+	req.Header.Set("Authorization", "Bearer s3cret")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 for IP outside allowed_ips, got %d", w.Code)
+	}
+}
+
+func TestSwapRoot(t *testing.T) {
+	blue := t.TempDir()
+	green := t.TempDir()
+	writeTestFile(t, filepath.Join(blue, "app.txt"), "blue")
+	writeTestFile(t, filepath.Join(green, "app.txt"), "green")
+
+	server := newAdminTestServer(t, blue)
+
+	get := func() string {
+		w := httptest.NewRecorder()
+		server.mux.ServeHTTP(w, httptest.NewRequest("GET", "/app.txt", nil))
+		body, _ := io.ReadAll(w.Result().Body)
+		return string(body)
+	}
+
+	if body := get(); body != "blue" {
+		t.Fatalf("Expected blue before swap, got %q", body)
+	}
+
+	w := adminRequest(server, "POST", "/_admin/root", `{"root_dir": "`+green+`"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200 from swap, got %d: %s", w.Code, w.Body.String())
+	}
+
+	if body := get(); body != "green" {
+		t.Errorf("Expected green after swap, got %q", body)
+	}
+
+	// Invalid target keeps the current root
+	w = adminRequest(server, "POST", "/_admin/root", `{"root_dir": "/does/not/exist"}`)
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected 422 for missing directory, got %d", w.Code)
+	}
+	if body := get(); body != "green" {
+		t.Errorf("Expected green after failed swap, got %q", body)
+	}
+}
+
+func TestSwapRootSymlink(t *testing.T) {
+	base := t.TempDir()
+	v1 := filepath.Join(base, "v1")
+	v2 := filepath.Join(base, "v2")
+	writeTestFile(t, filepath.Join(v1, "app.txt"), "v1")
+	writeTestFile(t, filepath.Join(v2, "app.txt"), "v2")
+
+	current := filepath.Join(base, "current")
+	if err := os.Symlink(v1, current); err != nil {
+		t.Skipf("Symlinks not supported: %v", err)
+	}
+
+	server := newAdminTestServer(t, current)
+
+	// Repointing the symlink does not affect the served root until a swap
+	os.Remove(current)
+	os.Symlink(v2, current)
+	if dir := server.RootDir(); !strings.HasSuffix(dir, "v1") {
+		t.Errorf("Expected root to stay on v1 before swap, got %s", dir)
+	}
+
+	w := adminRequest(server, "POST", "/_admin/root", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200 from swap, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var result map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &result)
+	if dir, _ := result["root_dir"].(string); !strings.HasSuffix(dir, "v2") {
+		t.Errorf("Expected root to resolve to v2 after swap, got %v", result["root_dir"])
+	}
+}
+
+func TestRootSnapshotDrain(t *testing.T) {
+	server := newAdminTestServer(t, t.TempDir())
+
+	snap := server.acquireRoot()
+	if _, _, err := server.SwapRoot(t.TempDir()); err != nil {
+		t.Fatalf("Swap failed: %v", err)
+	}
+
+	select {
+	case <-snap.drained:
+		t.Fatalf("Snapshot drained while a request still holds it")
+	default:
+	}
+
+	snap.release()
+
+	select {
+	case <-snap.drained:
+	default:
+		t.Errorf("Expected snapshot to be drained after release")
+	}
+}
+
+func TestAdminLogLevel(t *testing.T) {
+	server := newAdminTestServer(t, t.TempDir())
+
+	w := adminRequest(server, "POST", "/_admin/log/level", `{"level": "debug"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if server.logger.Level() != "debug" {
+		t.Errorf("Expected logger level debug, got %q", server.logger.Level())
+	}
+
+	w = adminRequest(server, "GET", "/_admin/log/level", "")
+	if !strings.Contains(w.Body.String(), `"level": "debug"`) {
+		t.Errorf("Expected current level in response, got %s", w.Body.String())
+	}
+
+	w = adminRequest(server, "POST", "/_admin/log/level", `{"level": "verbose"}`)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for invalid level, got %d", w.Code)
+	}
+	if server.logger.Level() != "debug" {
+		t.Errorf("Expected level to stay debug after invalid request, got %q", server.logger.Level())
+	}
+}
@@ -0,0 +1,403 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// archiveEntry arquivo ou diretório incluído no zip gerado
+type archiveEntry struct {
+	path    string // caminho no disco
+	name    string // nome dentro do zip
+	dir     bool
+	size    int64
+	modTime time.Time
+}
+
+// Archiver gera zips de diretórios e mantém as cópias montadas para Range
+type Archiver struct {
+	config  *ArchiveConfig
+	logger  *Logger
+	mu      sync.Mutex   // limpeza das cópias
+	flights *flightGroup // montagens simultâneas do mesmo zip
+}
+
+// NewArchiver cria o gerador de arquivos
+func NewArchiver(config *ArchiveConfig, logger *Logger) *Archiver {
+	return &Archiver{config: config, logger: logger, flights: newFlightGroup("archive")}
+}
+
+// spoolDir retorna o diretório das cópias montadas
+func (a *Archiver) spoolDir() string {
+	if a.config.SpoolDir == "" {
+		return os.TempDir()
+	}
+	return a.config.SpoolDir
+}
+
+// spoolTTL retorna por quanto tempo uma cópia sem uso é mantida
+func (a *Archiver) spoolTTL() time.Duration {
+	if a.config.SpoolTTL <= 0 {
+		return time.Hour
+	}
+	return time.Duration(a.config.SpoolTTL) * time.Second
+}
+
+// archiveEntries lista, em ordem lexical, o conteúdo visível de dir
+// (mesmas regras da listagem; links simbólicos não são seguidos). As regras
+// por caminho valem para cada entrada: o que checkResource recusa fica de
+// fora com a subárvore inteira. protected informa se alguma regra cobre o
+// conteúdo, ou seja, se o arquivo gerado depende de quem o pede
+func (s *Server) archiveEntries(r *http.Request, root, dir string) (entries []archiveEntry, protected bool, err error) {
+	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == dir {
+			return nil
+		}
+		if !s.listable(root, filepath.Dir(path), d.Name()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.IsDir() && !d.Type().IsRegular() {
+			return nil
+		}
+		urlPath := archiveURLPath(root, path, d.IsDir())
+		if protectedResource(r, urlPath) {
+			protected = true
+			if checkResource(r, urlPath) != 0 {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(dir, path)
+		e := archiveEntry{path: path, name: filepath.ToSlash(rel), dir: d.IsDir(), modTime: info.ModTime()}
+		if !e.dir {
+			e.size = info.Size()
+		}
+		entries = append(entries, e)
+		return nil
+	})
+	return entries, protected, err
+}
+
+// archiveURLPath caminho de URL de path (diretórios com barra final)
+func archiveURLPath(root, path string, dir bool) string {
+	rel, _ := filepath.Rel(root, path)
+	urlPath := "/" + strings.TrimPrefix(filepath.ToSlash(rel), ".")
+	if dir && !strings.HasSuffix(urlPath, "/") {
+		urlPath += "/"
+	}
+	return urlPath
+}
+
+// archiveAccess aplica ao próprio diretório as regras por caminho; false se
+// a recusa já foi enviada
+func (s *Server) archiveAccess(w http.ResponseWriter, r *http.Request, root, dir string) bool {
+	if status := checkResource(r, archiveURLPath(root, dir, true)); status != 0 {
+		resourceDenied(w, status)
+		return false
+	}
+	return true
+}
+
+// archiveValidators calcula o ETag (forte: o zip é determinístico para os
+// mesmos nomes, tamanhos e datas) e o Last-Modified do arquivo gerado
+func archiveValidators(entries []archiveEntry) (string, time.Time) {
+	h := sha256.New()
+	var modTime time.Time
+	for _, e := range entries {
+		fmt.Fprintf(h, "%s\x00%t\x00%d\x00%d\n", e.name, e.dir, e.size, e.modTime.Unix())
+		if e.modTime.After(modTime) {
+			modTime = e.modTime
+		}
+	}
+	return `"zip-` + hex.EncodeToString(h.Sum(nil))[:32] + `"`, modTime
+}
+
+// writeZip grava o zip sem compressão e com as datas dos arquivos, de modo
+// que o mesmo conteúdo produza sempre os mesmos bytes
+func writeZip(w io.Writer, entries []archiveEntry) error {
+	zw := zip.NewWriter(w)
+	for _, e := range entries {
+		header := &zip.FileHeader{
+			Name:     e.name,
+			Method:   zip.Store,
+			Modified: e.modTime.UTC().Truncate(time.Second),
+		}
+		if e.dir {
+			header.Name += "/"
+			header.SetMode(fs.ModeDir | 0755)
+		} else {
+			header.SetMode(0644)
+		}
+		fw, err := zw.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+		if e.dir {
+			continue
+		}
+
+		f, err := os.Open(e.path)
+		if err != nil {
+			return err
+		}
+		// Exatamente o tamanho listado: um arquivo alterado no meio da
+		// geração interrompe o zip em vez de produzir bytes diferentes
+		_, err = io.CopyN(fw, f, e.size)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", e.name, err)
+		}
+	}
+	return zw.Close()
+}
+
+// writeTarGz grava o tar.gz com as mesmas entradas, datas e permissões do
+// zip; como ele, o mesmo conteúdo produz sempre os mesmos bytes
+func writeTarGz(w io.Writer, entries []archiveEntry) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	for _, e := range entries {
+		header := &tar.Header{
+			Name:    e.name,
+			Mode:    0644,
+			Size:    e.size,
+			ModTime: e.modTime.UTC().Truncate(time.Second),
+			Format:  tar.FormatPAX,
+		}
+		if e.dir {
+			header.Typeflag = tar.TypeDir
+			header.Name += "/"
+			header.Mode = 0755
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if e.dir {
+			continue
+		}
+
+		f, err := os.Open(e.path)
+		if err != nil {
+			return err
+		}
+		_, err = io.CopyN(tw, f, e.size)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", e.name, err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// Spool retorna a cópia montada em disco do zip identificado por etag,
+// gerando-a se necessário; cópias sem uso há mais de spool_ttl são removidas.
+// Pedidos simultâneos do mesmo zip esperam uma única geração. Se w não for
+// nil e esta chamada gerar o zip, ele é enviado a w enquanto é gravado
+// (streamed); sem espaço para a cópia, é enviado só a w
+func (a *Archiver) Spool(ctx context.Context, etag string, entries []archiveEntry, w io.Writer) (name string, streamed bool, err error) {
+	name = filepath.Join(a.spoolDir(), "qserv-archive-"+strings.Trim(etag, `"`)+".zip")
+
+	now := time.Now()
+	if _, err := os.Stat(name); err == nil {
+		os.Chtimes(name, now, now)
+		return name, false, nil
+	}
+
+	_, err, joined := a.flights.Do(ctx, name, func() (interface{}, error) {
+		a.mu.Lock()
+		a.sweep(now)
+		a.mu.Unlock()
+
+		streamed = w != nil
+		tmp, err := a.createTemp()
+		if err != nil {
+			if w != nil {
+				a.logger.Warn("Archive spool unavailable, streaming only: %v", err)
+				return nil, writeZip(w, entries)
+			}
+			return nil, err
+		}
+		defer os.Remove(tmp.Name())
+
+		var dst io.Writer = tmp
+		if w != nil {
+			// O cliente pode desconectar; a cópia continua para quem espera
+			dst = &teeWriter{primary: tmp, secondary: w}
+		}
+		if err := writeZip(dst, entries); err != nil {
+			tmp.Close()
+			return nil, err
+		}
+		if err := tmp.Close(); err != nil {
+			return nil, err
+		}
+		return nil, os.Rename(tmp.Name(), name)
+	})
+	if joined {
+		streamed = false
+	}
+	return name, streamed, err
+}
+
+// createTemp cria o arquivo temporário de uma cópia em montagem
+func (a *Archiver) createTemp() (*os.File, error) {
+	if err := os.MkdirAll(a.spoolDir(), 0755); err != nil {
+		return nil, err
+	}
+	return os.CreateTemp(a.spoolDir(), ".qserv-archive-*")
+}
+
+// sweep remove cópias montadas sem uso
+func (a *Archiver) sweep(now time.Time) {
+	matches, _ := filepath.Glob(filepath.Join(a.spoolDir(), "qserv-archive-*.zip"))
+	for _, path := range matches {
+		if info, err := os.Stat(path); err == nil && now.Sub(info.ModTime()) > a.spoolTTL() {
+			os.Remove(path)
+		}
+	}
+}
+
+// serveDirectoryArchive serve o diretório como zip a partir da cópia montada
+// em disco. Quem dispara a montagem recebe o zip enquanto ele é gravado;
+// pedidos simultâneos esperam por ela em vez de gerar o mesmo zip de novo,
+// e retomadas (Range) são servidas da cópia
+func (s *Server) serveDirectoryArchive(w http.ResponseWriter, r *http.Request, path string) {
+	root := s.requestRoot(r)
+	if !s.archiveAccess(w, r, root, path) {
+		return
+	}
+	entries, protected, err := s.archiveEntries(r, root, path)
+	if err != nil {
+		s.logger.Error("Error reading directory %s: %v", path, err)
+		s.serveError(w, r, http.StatusInternalServerError)
+		return
+	}
+	if protected {
+		// O conteúdo depende de quem pede
+		w.Header().Set("Cache-Control", "private")
+	}
+	etag, modTime := archiveValidators(entries)
+
+	name := filepath.Base(path)
+	if path == root || name == "." || name == string(filepath.Separator) {
+		name = "download"
+	}
+	name += ".zip"
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+	w.Header().Set("ETag", etag)
+
+	var spool string
+	if r.Header.Get("Range") == "" {
+		w.Header().Set("Accept-Ranges", "bytes")
+		if modTime.IsZero() {
+			modTime = time.Now()
+		}
+		w.Header().Set("Last-Modified", modTime.UTC().Format(http.TimeFormat))
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		if r.Method == http.MethodHead {
+			return
+		}
+		var streamed bool
+		spool, streamed, err = s.archives.Spool(r.Context(), etag, entries, w)
+		if streamed {
+			if err != nil {
+				// Os headers já foram enviados: o cliente recebe um zip truncado
+				s.logger.Error("Error archiving %s: %v", path, err)
+			}
+			return
+		}
+	} else {
+		spool, _, err = s.archives.Spool(r.Context(), etag, entries, nil)
+	}
+	if err != nil {
+		s.logger.Error("Error spooling archive of %s: %v", path, err)
+		s.serveError(w, r, http.StatusInternalServerError)
+		return
+	}
+	f, err := os.Open(spool)
+	if err != nil {
+		s.serveError(w, r, http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+	http.ServeContent(w, r, name, modTime, f)
+}
+
+// serveDirectoryTarGz serve o diretório como tar.gz gerado durante o envio,
+// sem cópia em disco (e por isso sem Range): a compressão já reduz o que
+// seria retomado, e quem precisa retomar usa o zip
+func (s *Server) serveDirectoryTarGz(w http.ResponseWriter, r *http.Request, path string) {
+	root := s.requestRoot(r)
+	if !s.archiveAccess(w, r, root, path) {
+		return
+	}
+	entries, protected, err := s.archiveEntries(r, root, path)
+	if err != nil {
+		s.logger.Error("Error reading directory %s: %v", path, err)
+		s.serveError(w, r, http.StatusInternalServerError)
+		return
+	}
+	if protected {
+		w.Header().Set("Cache-Control", "private")
+	}
+	etag, modTime := archiveValidators(entries)
+	etag = `"tgz-` + strings.TrimPrefix(etag, `"zip-`)
+
+	name := filepath.Base(path)
+	if path == root || name == "." || name == string(filepath.Separator) {
+		name = "download"
+	}
+	skipCompression(w)
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name + ".tar.gz"}))
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Accept-Ranges", "none")
+	if modTime.IsZero() {
+		modTime = time.Now()
+	}
+	w.Header().Set("Last-Modified", modTime.UTC().Format(http.TimeFormat))
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	if r.Method == http.MethodHead {
+		return
+	}
+	if err := writeTarGz(w, entries); err != nil {
+		// Os headers já foram enviados: o cliente recebe um arquivo truncado
+		s.logger.Error("Error archiving %s: %v", path, err)
+	}
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDirectoryArchive(t *testing.T) {
+	root := t.TempDir()
+	os.MkdirAll(filepath.Join(root, "docs", "sub"), 0755)
+	os.WriteFile(filepath.Join(root, "docs", "b.txt"), []byte("bravo"), 0644)
+	os.WriteFile(filepath.Join(root, "docs", "a.txt"), []byte("alpha"), 0644)
+	os.WriteFile(filepath.Join(root, "docs", "sub", "c.txt"), bytes.Repeat([]byte("c"), 4096), 0644)
+	os.WriteFile(filepath.Join(root, "docs", ".secret"), []byte("hidden"), 0644)
+	spool := t.TempDir()
+
+	server := newListingTestServer(t, root, func(c *Config) {
+		c.Security.BlockHiddenFiles = true
+		c.Performance.EnableCompression = true
+		c.Features.Archives = &ArchiveConfig{Enabled: true, SpoolDir: spool}
+	})
+
+	get := func(header map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/docs/?download=zip", nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		server.mux.ServeHTTP(w, req)
+		return w
+	}
+
+	w := get(nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", w.Code)
+	}
+	if ce := w.Header().Get("Content-Encoding"); ce != "" {
+		t.Errorf("Expected archive without Content-Encoding, got %q", ce)
+	}
+	if cd := w.Header().Get("Content-Disposition"); cd != `attachment; filename=docs.zip` {
+		t.Errorf("Unexpected Content-Disposition: %q", cd)
+	}
+	full := w.Body.Bytes()
+	etag := w.Header().Get("ETag")
+
+	zr, err := zip.NewReader(bytes.NewReader(full), int64(len(full)))
+	if err != nil {
+		t.Fatalf("Invalid zip: %v", err)
+	}
+	var names []string
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+	}
+	want := []string{"a.txt", "b.txt", "sub/", "sub/c.txt"}
+	if len(names) != len(want) {
+		t.Fatalf("Expected %v, got %v", want, names)
+	}
+	for i := range want {
+		if names[i] != want[i] {
+			t.Errorf("Expected %v, got %v", want, names)
+			break
+		}
+	}
+
+	// Deterministic: the same content produces the same bytes and ETag
+	again := get(nil)
+	if !bytes.Equal(again.Body.Bytes(), full) || again.Header().Get("ETag") != etag {
+		t.Errorf("Expected identical archive on second download")
+	}
+
+	// Resume from the spooled copy
+	w = get(map[string]string{"Range": "bytes=100-", "If-Range": etag})
+	if w.Code != http.StatusPartialContent {
+		t.Fatalf("Expected 206, got %d", w.Code)
+	}
+	if !bytes.Equal(w.Body.Bytes(), full[100:]) {
+		t.Errorf("Expected range body to match the full archive from offset 100")
+	}
+	if matches, _ := filepath.Glob(filepath.Join(spool, "qserv-archive-*.zip")); len(matches) != 1 {
+		t.Errorf("Expected one spooled archive, got %v", matches)
+	}
+
+	// A changed directory invalidates If-Range: the full archive is sent
+	later := time.Now().Add(time.Hour)
+	os.Chtimes(filepath.Join(root, "docs", "a.txt"), later, later)
+	w = get(map[string]string{"Range": "bytes=100-", "If-Range": etag})
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected 200 for stale If-Range, got %d", w.Code)
+	}
+}
+
+func TestDirectoryArchiveAppliesPathRules(t *testing.T) {
+	root := t.TempDir()
+	os.MkdirAll(filepath.Join(root, "site", "private", "deep"), 0755)
+	os.WriteFile(filepath.Join(root, "site", "index.html"), []byte("home"), 0644)
+	os.WriteFile(filepath.Join(root, "site", "private", "secret.txt"), []byte("secret"), 0644)
+	os.WriteFile(filepath.Join(root, "site", "private", "deep", "more.txt"), []byte("more"), 0644)
+	server := newListingTestServer(t, root, func(c *Config) {
+		c.Features.Archives = &ArchiveConfig{Enabled: true, SpoolDir: t.TempDir()}
+		c.Security.ProxyAuth = &ProxyAuthConfig{
+			Enabled:        true,
+			TrustedProxies: []string{"192.0.2.1"},
+			ACL:            []ProxyACLRule{{Path: "/site/private/**", Groups: []string{"admins"}}},
+		}
+	})
+	get := func(target string, groups string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", target, nil)
+		if groups != "" {
+			req.Header.Set("Remote-User", "alice")
+			req.Header.Set("Remote-Groups", groups)
+		}
+		w := httptest.NewRecorder()
+		server.mux.ServeHTTP(w, req)
+		return w
+	}
+	names := func(w *httptest.ResponseRecorder) string {
+		body := w.Body.Bytes()
+		zr, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+		if err != nil {
+			t.Fatalf("Invalid zip: %v", err)
+		}
+		var names []string
+		for _, f := range zr.File {
+			names = append(names, f.Name)
+		}
+		return strings.Join(names, ",")
+	}
+
+	// The protected subtree is left out for anonymous clients
+	w := get("/site/?download=zip", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", w.Code)
+	}
+	if got := names(w); got != "index.html" {
+		t.Errorf("Expected only index.html, got %s", got)
+	}
+	if cc := w.Header().Get("Cache-Control"); cc != "private" {
+		t.Errorf("Expected Cache-Control private, got %q", cc)
+	}
+
+	// Allowed users get the whole tree
+	if got := names(get("/site/?download=zip", "admins")); got != "index.html,private/,private/deep/,private/deep/more.txt,private/secret.txt" {
+		t.Errorf("Expected the protected files for admins, got %s", got)
+	}
+
+	// Archiving the protected directory itself is refused
+	if w := get("/site/private/?download=zip", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 for the protected directory, got %d", w.Code)
+	}
+}
+
+func TestDirectoryTarGz(t *testing.T) {
+	root := t.TempDir()
+	os.MkdirAll(filepath.Join(root, "docs", "sub"), 0755)
+	os.WriteFile(filepath.Join(root, "docs", "a.txt"), []byte("alpha"), 0644)
+	os.WriteFile(filepath.Join(root, "docs", "sub", "c.txt"), bytes.Repeat([]byte("c"), 4096), 0644)
+	os.WriteFile(filepath.Join(root, "docs", ".secret"), []byte("hidden"), 0644)
+	spool := t.TempDir()
+
+	server := newListingTestServer(t, root, func(c *Config) {
+		c.Security.BlockHiddenFiles = true
+		c.Performance.EnableCompression = true
+		c.Features.Archives = &ArchiveConfig{Enabled: true, SpoolDir: spool}
+	})
+
+	get := func(header map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/docs/?download=tar.gz", nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		server.mux.ServeHTTP(w, req)
+		return w
+	}
+
+	w := get(nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", w.Code)
+	}
+	if ce := w.Header().Get("Content-Encoding"); ce != "" {
+		t.Errorf("Expected archive without Content-Encoding, got %q", ce)
+	}
+	if cd := w.Header().Get("Content-Disposition"); cd != `attachment; filename=docs.tar.gz` {
+		t.Errorf("Unexpected Content-Disposition: %q", cd)
+	}
+
+	gz, err := gzip.NewReader(bytes.NewReader(w.Body.Bytes()))
+	if err != nil {
+		t.Fatalf("Invalid gzip: %v", err)
+	}
+	tr := tar.NewReader(gz)
+	var names []string
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Invalid tar: %v", err)
+		}
+		names = append(names, header.Name)
+		if header.Name == "sub/c.txt" {
+			if data, _ := io.ReadAll(tr); len(data) != 4096 {
+				t.Errorf("Expected 4096 bytes for sub/c.txt, got %d", len(data))
+			}
+		}
+	}
+	if got := strings.Join(names, ","); got != "a.txt,sub/,sub/c.txt" {
+		t.Errorf("Expected a.txt,sub/,sub/c.txt, got %s", got)
+	}
+
+	// Deterministic, so the ETag revalidates; nothing is spooled
+	etag := w.Header().Get("ETag")
+	if again := get(nil); !bytes.Equal(again.Body.Bytes(), w.Body.Bytes()) {
+		t.Error("Expected identical archive on second download")
+	}
+	if w := get(map[string]string{"If-None-Match": etag}); w.Code != http.StatusNotModified {
+		t.Errorf("Expected 304, got %d", w.Code)
+	}
+	if matches, _ := filepath.Glob(filepath.Join(spool, "qserv-archive-*")); len(matches) != 0 {
+		t.Errorf("Expected no spooled copy, got %v", matches)
+	}
+
+	// The listing links to both formats
+	w = httptest.NewRecorder()
+	server.mux.ServeHTTP(w, httptest.NewRequest("GET", "/docs/", nil))
+	if body := w.Body.String(); !strings.Contains(body, `href="?download=zip"`) || !strings.Contains(body, `href="?download=tar.gz"`) {
+		t.Error("Expected download links in the listing")
+	}
+}
+
+func TestDirectoryTarGzAppliesPathRules(t *testing.T) {
+	root := t.TempDir()
+	os.MkdirAll(filepath.Join(root, "site", "private"), 0755)
+	os.WriteFile(filepath.Join(root, "site", "index.html"), []byte("home"), 0644)
+	os.WriteFile(filepath.Join(root, "site", "private", "secret.txt"), []byte("secret"), 0644)
+	server := newListingTestServer(t, root, func(c *Config) {
+		c.Features.Archives = &ArchiveConfig{Enabled: true, SpoolDir: t.TempDir()}
+		c.Security.SignedCookies = &SignedCookiesConfig{Enabled: true, Secret: "s3cret", Paths: []string{"/site/private/**"}}
+	})
+
+	w := httptest.NewRecorder()
+	server.mux.ServeHTTP(w, httptest.NewRequest("GET", "/site/?download=tar.gz", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", w.Code)
+	}
+	if cc := w.Header().Get("Cache-Control"); cc != "private" {
+		t.Errorf("Expected Cache-Control private, got %q", cc)
+	}
+	gz, err := gzip.NewReader(bytes.NewReader(w.Body.Bytes()))
+	if err != nil {
+		t.Fatalf("Invalid gzip: %v", err)
+	}
+	tr := tar.NewReader(gz)
+	var names []string
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Invalid tar: %v", err)
+		}
+		names = append(names, header.Name)
+	}
+	// Files behind signed cookies stay out without a valid cookie
+	if got := strings.Join(names, ","); got != "index.html" {
+		t.Errorf("Expected only index.html, got %s", got)
+	}
+
+	w = httptest.NewRecorder()
+	server.mux.ServeHTTP(w, httptest.NewRequest("GET", "/site/private/?download=tar.gz", nil))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 for the protected directory, got %d", w.Code)
+	}
+}
@@ -0,0 +1,322 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// BenchResult resultado de um benchmark
+type BenchResult struct {
+	Target      string          `json:"target"`
+	Concurrency int             `json:"concurrency"`
+	Requests    int64           `json:"requests"`
+	Errors      int64           `json:"errors"`
+	Duration    time.Duration   `json:"duration_ns"`
+	Bytes       int64           `json:"bytes"`
+	RPS         float64         `json:"requests_per_second"`
+	Throughput  float64         `json:"bytes_per_second"`
+	Latency     BenchLatency    `json:"latency"`
+	Paths       []BenchPathStat `json:"paths"`
+}
+
+// BenchLatency percentis de latência
+type BenchLatency struct {
+	P50 time.Duration `json:"p50_ns"`
+	P90 time.Duration `json:"p90_ns"`
+	P99 time.Duration `json:"p99_ns"`
+	Max time.Duration `json:"max_ns"`
+}
+
+// BenchPathStat resultado de um caminho
+type BenchPathStat struct {
+	Path     string        `json:"path"`
+	Requests int64         `json:"requests"`
+	Errors   int64         `json:"errors"`
+	P50      time.Duration `json:"p50_ns"`
+	P99      time.Duration `json:"p99_ns"`
+}
+
+// benchSample latência de uma requisição
+type benchSample struct {
+	path    int
+	latency time.Duration
+	failed  bool
+}
+
+// runBench executa o subcomando "qserv bench" e retorna o código de saída
+func runBench(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("bench", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	target := fs.String("url", "", "Base URL of a running instance (default: in-process server)")
+	paths := fs.String("paths", "/", "Comma-separated paths requested against -url")
+	sizes := fs.String("sizes", "1KB,100KB,1MB", "Comma-separated file sizes served by the in-process server")
+	configFile := fs.String("config", "", "Configuration file for the in-process server")
+	concurrency := fs.Int("c", 10, "Number of concurrent workers")
+	requests := fs.Int("n", 1000, "Total number of requests (ignored with -duration)")
+	duration := fs.Duration("duration", 0, "Run for a fixed duration instead of -n requests")
+	asJSON := fs.Bool("json", false, "Print the result as JSON")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *concurrency <= 0 {
+		*concurrency = 1
+	}
+
+	var urls []string
+	if *target != "" {
+		base := strings.TrimSuffix(*target, "/")
+		for _, p := range strings.Split(*paths, ",") {
+			if p = strings.TrimSpace(p); p != "" {
+				urls = append(urls, base+"/"+strings.TrimPrefix(p, "/"))
+			}
+		}
+	} else {
+		base, files, cleanup, err := startBenchServer(*configFile, *sizes)
+		if err != nil {
+			fmt.Fprintf(stderr, "Error starting benchmark server: %v\n", err)
+			return 1
+		}
+		defer cleanup()
+		*target = base + " (in-process)"
+		for _, name := range files {
+			urls = append(urls, base+"/"+name)
+		}
+	}
+	if len(urls) == 0 {
+		fmt.Fprintln(stderr, "No paths to request")
+		return 2
+	}
+
+	result := bench(urls, *concurrency, int64(*requests), *duration)
+	result.Target = *target
+
+	if *asJSON {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(result)
+	} else {
+		printBenchResult(stdout, result)
+	}
+	if result.Errors > 0 {
+		return 1
+	}
+	return 0
+}
+
+// startBenchServer sobe o handler do qserv em loopback servindo arquivos
+// gerados com os tamanhos pedidos
+func startBenchServer(configFile, sizes string) (string, []string, func(), error) {
+	config, err := loadConfiguration(configFile)
+	if err != nil {
+		return "", nil, nil, err
+	}
+
+	dir, err := os.MkdirTemp("", "qserv-bench-")
+	if err != nil {
+		return "", nil, nil, err
+	}
+
+	var files []string
+	for _, s := range strings.Split(sizes, ",") {
+		size, err := parseBenchSize(strings.TrimSpace(s))
+		if err != nil {
+			os.RemoveAll(dir)
+			return "", nil, nil, err
+		}
+		name := fmt.Sprintf("bench-%d.bin", size)
+		data := make([]byte, size)
+		for i := range data {
+			data[i] = byte('a' + i%26)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+			os.RemoveAll(dir)
+			return "", nil, nil, err
+		}
+		files = append(files, name)
+	}
+
+	config.Server.RootDir = dir
+	config.Logging.Enabled = false
+	logger, err := NewLogger(&config.Logging)
+	if err != nil {
+		os.RemoveAll(dir)
+		return "", nil, nil, err
+	}
+	server := NewServer(config, logger)
+	server.setupHandlers()
+	ts := httptest.NewServer(server.mux)
+
+	return ts.URL, files, func() {
+		ts.Close()
+		os.RemoveAll(dir)
+	}, nil
+}
+
+// parseBenchSize interpreta tamanhos como 512, 100KB ou 1MB
+func parseBenchSize(s string) (int64, error) {
+	upper := strings.ToUpper(s)
+	mult := int64(1)
+	for _, unit := range []struct {
+		suffix string
+		mult   int64
+	}{{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"B", 1}} {
+		if strings.HasSuffix(upper, unit.suffix) {
+			upper, mult = strings.TrimSuffix(upper, unit.suffix), unit.mult
+			break
+		}
+	}
+	n, err := strconv.ParseInt(strings.TrimSpace(upper), 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size: %q", s)
+	}
+	return n * mult, nil
+}
+
+// bench distribui as requisições entre os workers (alternando os caminhos)
+// até atingir n requisições ou a duração
+func bench(urls []string, concurrency int, n int64, duration time.Duration) *BenchResult {
+	client := &http.Client{Transport: &http.Transport{
+		MaxIdleConnsPerHost: concurrency,
+		DisableCompression:  true,
+	}}
+	defer client.CloseIdleConnections()
+
+	var (
+		next    atomic.Int64
+		bytes   atomic.Int64
+		mu      sync.Mutex
+		samples []benchSample
+		wg      sync.WaitGroup
+	)
+	deadline := time.Time{}
+	if duration > 0 {
+		deadline = time.Now().Add(duration)
+	}
+
+	start := time.Now()
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var local []benchSample
+			for {
+				seq := next.Add(1) - 1
+				if deadline.IsZero() && seq >= n || !deadline.IsZero() && time.Now().After(deadline) {
+					break
+				}
+				idx := int(seq % int64(len(urls)))
+
+				t := time.Now()
+				resp, err := client.Get(urls[idx])
+				failed := err != nil
+				if err == nil {
+					written, _ := io.Copy(io.Discard, resp.Body)
+					resp.Body.Close()
+					bytes.Add(written)
+					failed = resp.StatusCode >= 400
+				}
+				local = append(local, benchSample{path: idx, latency: time.Since(t), failed: failed})
+			}
+			mu.Lock()
+			samples = append(samples, local...)
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	result := &BenchResult{
+		Concurrency: concurrency,
+		Requests:    int64(len(samples)),
+		Duration:    elapsed,
+		Bytes:       bytes.Load(),
+	}
+	if elapsed > 0 {
+		result.RPS = float64(result.Requests) / elapsed.Seconds()
+		result.Throughput = float64(result.Bytes) / elapsed.Seconds()
+	}
+
+	all := make([]time.Duration, 0, len(samples))
+	perPath := make([][]time.Duration, len(urls))
+	pathErrors := make([]int64, len(urls))
+	for _, s := range samples {
+		all = append(all, s.latency)
+		perPath[s.path] = append(perPath[s.path], s.latency)
+		if s.failed {
+			result.Errors++
+			pathErrors[s.path]++
+		}
+	}
+	sortDurations(all)
+	result.Latency = BenchLatency{
+		P50: percentile(all, 50),
+		P90: percentile(all, 90),
+		P99: percentile(all, 99),
+	}
+	if len(all) > 0 {
+		result.Latency.Max = all[len(all)-1]
+	}
+
+	for i, latencies := range perPath {
+		sortDurations(latencies)
+		path := urls[i]
+		if idx := strings.Index(path, "://"); idx >= 0 {
+			if slash := strings.Index(path[idx+3:], "/"); slash >= 0 {
+				path = path[idx+3+slash:]
+			}
+		}
+		result.Paths = append(result.Paths, BenchPathStat{
+			Path:     path,
+			Requests: int64(len(latencies)),
+			Errors:   pathErrors[i],
+			P50:      percentile(latencies, 50),
+			P99:      percentile(latencies, 99),
+		})
+	}
+	return result
+}
+
+func sortDurations(d []time.Duration) {
+	sort.Slice(d, func(i, j int) bool { return d[i] < d[j] })
+}
+
+// percentile retorna o percentil p (0-100) de latências ordenadas
+func percentile(sorted []time.Duration, p int) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	idx := (len(sorted)*p + 99) / 100
+	if idx > 0 {
+		idx--
+	}
+	return sorted[idx]
+}
+
+// printBenchResult imprime o resultado em texto
+func printBenchResult(w io.Writer, r *BenchResult) {
+	fmt.Fprintf(w, "Target:       %s\n", r.Target)
+	fmt.Fprintf(w, "Concurrency:  %d\n", r.Concurrency)
+	fmt.Fprintf(w, "Requests:     %d (%d errors) in %s\n", r.Requests, r.Errors, r.Duration.Round(time.Millisecond))
+	fmt.Fprintf(w, "Requests/sec: %.1f\n", r.RPS)
+	fmt.Fprintf(w, "Transfer/sec: %s\n", formatSize(int64(r.Throughput)))
+	fmt.Fprintf(w, "Latency:      p50 %s  p90 %s  p99 %s  max %s\n",
+		r.Latency.P50.Round(time.Microsecond), r.Latency.P90.Round(time.Microsecond),
+		r.Latency.P99.Round(time.Microsecond), r.Latency.Max.Round(time.Microsecond))
+	fmt.Fprintln(w)
+	for _, p := range r.Paths {
+		fmt.Fprintf(w, "  %-32s %8d req  %4d err  p50 %-10s p99 %s\n", p.Path, p.Requests, p.Errors,
+			p.P50.Round(time.Microsecond), p.P99.Round(time.Microsecond))
+	}
+}
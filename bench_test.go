@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestRunBenchInProcess(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	code := runBench([]string{"-n", "40", "-c", "4", "-sizes", "1KB,10KB", "-json"}, &stdout, &stderr)
+	if code != 0 {
+		t.Fatalf("Expected exit code 0, got %d (stderr: %s)", code, stderr.String())
+	}
+
+	var result BenchResult
+	if err := json.Unmarshal(stdout.Bytes(), &result); err != nil {
+		t.Fatalf("Invalid JSON: %v", err)
+	}
+	if result.Requests != 40 || result.Errors != 0 {
+		t.Errorf("Expected 40 requests without errors, got %d (%d errors)", result.Requests, result.Errors)
+	}
+	if len(result.Paths) != 2 || result.Paths[0].Requests != 20 {
+		t.Errorf("Expected requests split across 2 paths, got %+v", result.Paths)
+	}
+	if result.Bytes != 20*1024+20*10*1024 {
+		t.Errorf("Expected %d bytes, got %d", 20*1024+20*10*1024, result.Bytes)
+	}
+}
+
+func TestParseBenchSize(t *testing.T) {
+	tests := map[string]int64{"512": 512, "100KB": 100 << 10, "1mb": 1 << 20, "2GB": 2 << 30}
+	for input, want := range tests {
+		if got, err := parseBenchSize(input); err != nil || got != want {
+			t.Errorf("parseBenchSize(%q) = %d, %v; expected %d", input, got, err, want)
+		}
+	}
+	if _, err := parseBenchSize("lots"); err == nil {
+		t.Errorf("Expected error for invalid size")
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	var d []time.Duration
+	for i := 1; i <= 100; i++ {
+		d = append(d, time.Duration(i)*time.Millisecond)
+	}
+	if p := percentile(d, 50); p != 50*time.Millisecond {
+		t.Errorf("Expected p50 of 50ms, got %v", p)
+	}
+	if p := percentile(d, 99); p != 99*time.Millisecond {
+		t.Errorf("Expected p99 of 99ms, got %v", p)
+	}
+	if p := percentile(nil, 99); p != 0 {
+		t.Errorf("Expected 0 for empty samples, got %v", p)
+	}
+}
@@ -0,0 +1,429 @@
+package main
+
+import (
+	"errors"
+	"io"
+)
+
+// Encoder brotli (RFC 7932) para Content-Encoding: um meta-block por bloco
+// do lzMatcher, com um único código de prefixo para literais, comandos e
+// distâncias (sem block splitting nem context modeling)
+const (
+	brotliWindowBits = 18
+	brotliMaxCodeLen = 15
+)
+
+// Valores base e bits extras dos códigos de inserção e de cópia
+var (
+	brotliInsertBase = []int{0, 1, 2, 3, 4, 5, 6, 8, 10, 14, 18, 26, 34, 50, 66, 98, 130, 194, 322, 578, 1090, 2114, 6210, 22594}
+	brotliInsertBits = []uint8{0, 0, 0, 0, 0, 0, 1, 1, 2, 2, 3, 3, 4, 4, 5, 5, 6, 7, 8, 9, 10, 12, 14, 24}
+	brotliCopyBase   = []int{2, 3, 4, 5, 6, 7, 8, 9, 10, 12, 14, 18, 22, 30, 38, 54, 70, 102, 134, 198, 326, 582, 1094, 2118}
+	brotliCopyBits   = []uint8{0, 0, 0, 0, 0, 0, 0, 0, 1, 1, 2, 2, 3, 3, 4, 4, 5, 5, 6, 7, 8, 9, 10, 24}
+)
+
+// Ordem dos comprimentos do código de comprimentos e o código fixo usado
+// para gravá-los (valor, bits)
+var (
+	brotliCodeLengthOrder = []int{1, 2, 3, 4, 0, 5, 17, 6, 16, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+	brotliCodeLengthCode  = [][2]uint8{{0, 2}, {7, 4}, {3, 3}, {2, 2}, {1, 2}, {15, 4}}
+)
+
+// brotliLengthCode código de um comprimento de inserção ou cópia
+func brotliLengthCode(base []int, n int) int {
+	code := 0
+	for code+1 < len(base) && base[code+1] <= n {
+		code++
+	}
+	return code
+}
+
+// brotliCommand um comando de inserção e cópia já codificado
+type brotliCommand struct {
+	symbol            int
+	insert, copy      int
+	insCode, copyCode int
+	distCode          int
+	distExtra         uint64
+	distBits          uint
+	hasCopy           bool
+	literalsStart     int
+}
+
+// brotliCode código de prefixo canônico; os códigos ficam com os bits
+// invertidos para o bitWriter
+type brotliCode struct {
+	lengths []uint8
+	codes   []uint16
+	used    []int
+}
+
+func newBrotliCode(freq []int, maxBits int) *brotliCode {
+	c := &brotliCode{lengths: huffmanLengths(freq, maxBits), codes: make([]uint16, len(freq))}
+	for s, l := range c.lengths {
+		if l > 0 {
+			c.used = append(c.used, s)
+		}
+	}
+	if len(c.used) == 1 {
+		// Um único símbolo não ocupa bits
+		c.lengths[c.used[0]] = 0
+		return c
+	}
+	var count [16]int
+	for _, l := range c.lengths {
+		count[l]++
+	}
+	count[0] = 0
+	var next [17]int
+	for l := 1; l <= 16; l++ {
+		next[l] = (next[l-1] + count[l-1]) << 1
+	}
+	for s, l := range c.lengths {
+		if l > 0 {
+			code := next[l]
+			next[l]++
+			rev := 0
+			for i := 0; i < int(l); i++ {
+				rev = rev<<1 | code>>i&1
+			}
+			c.codes[s] = uint16(rev)
+		}
+	}
+	return c
+}
+
+func (c *brotliCode) write(bw *bitWriter, s int) {
+	bw.write(uint64(c.codes[s]), uint(c.lengths[s]))
+}
+
+// brotliWriter comprime um stream brotli
+type brotliWriter struct {
+	w      io.Writer
+	m      *lzMatcher
+	bw     bitWriter
+	header bool // WBITS já gravado
+	closed bool
+	err    error
+	seqs   []lzSequence
+	cmds   []brotliCommand
+}
+
+// newBrotliWriter cria o encoder; o nível (0 a 11) define o esforço na busca
+// de repetições
+func newBrotliWriter(level int) *brotliWriter {
+	return &brotliWriter{m: newLZMatcher(lzDepth(level))}
+}
+
+// Reset prepara o encoder para um novo stream em w
+func (b *brotliWriter) Reset(w io.Writer) {
+	b.w = w
+	b.m.reset()
+	b.bw = bitWriter{out: b.bw.out[:0]}
+	b.header, b.closed, b.err = false, false, nil
+}
+
+func (b *brotliWriter) Write(p []byte) (int, error) {
+	if b.err != nil {
+		return 0, b.err
+	}
+	if b.closed {
+		return 0, errors.New("brotli: write after close")
+	}
+	n := 0
+	for n < len(p) {
+		n += b.m.fill(p[n:])
+		if b.m.pending() == lzBlock {
+			b.metaBlock()
+			if err := b.send(); err != nil {
+				return n, err
+			}
+		}
+	}
+	return n, nil
+}
+
+// Flush envia o que está pendente e alinha o stream em um byte com um
+// meta-block de metadados vazio, para o cliente poder descomprimir até aqui
+func (b *brotliWriter) Flush() error {
+	if b.err != nil || b.closed {
+		return b.err
+	}
+	if b.m.pending() == 0 && b.header && b.bw.nbits == 0 {
+		return nil
+	}
+	b.metaBlock()
+	b.bw.write(0, 1) // ISLAST
+	b.bw.write(3, 2) // MNIBBLES = 0: metadados
+	b.bw.write(0, 1) // reservado
+	b.bw.write(0, 2) // MSKIPBYTES
+	b.bw.align()
+	return b.send()
+}
+
+// Close grava o meta-block final (vazio)
+func (b *brotliWriter) Close() error {
+	if b.err != nil || b.closed {
+		return b.err
+	}
+	b.closed = true
+	b.metaBlock()
+	b.bw.write(1, 1) // ISLAST
+	b.bw.write(1, 1) // ISLASTEMPTY
+	b.bw.align()
+	return b.send()
+}
+
+// send repassa os bytes completos; os bits restantes ficam para o próximo
+// meta-block
+func (b *brotliWriter) send() error {
+	_, b.err = b.w.Write(b.bw.out)
+	b.bw.out = b.bw.out[:0]
+	return b.err
+}
+
+// metaBlock grava o cabeçalho do stream, se ainda não foi, e os bytes
+// pendentes como um meta-block
+func (b *brotliWriter) metaBlock() {
+	if !b.header {
+		b.bw.write(1, 1)
+		b.bw.write(brotliWindowBits-17, 3)
+		b.header = true
+	}
+	if b.m.pending() == 0 {
+		return
+	}
+	seqs, trailing, data := b.m.compress(b.seqs[:0])
+	b.seqs = seqs
+
+	var litFreq [256]int
+	var cmdFreq [704]int
+	var distFreq [64]int
+	cmds, pos := b.cmds[:0], 0
+	add := func(insert, copy, distance int) {
+		c := brotliCommand{insert: insert, copy: copy, hasCopy: distance > 0, literalsStart: pos}
+		c.insCode = brotliLengthCode(brotliInsertBase, insert)
+		c.copyCode = brotliLengthCode(brotliCopyBase, copy)
+		// Células da tabela de inserção e cópia com distância explícita
+		cell := 0
+		switch ins, cp := c.insCode>>3, c.copyCode>>3; {
+		case ins == 0 && cp == 0:
+			cell = 128
+		case ins == 0 && cp == 1:
+			cell = 192
+		case ins == 1 && cp == 0:
+			cell = 256
+		case ins == 1 && cp == 1:
+			cell = 320
+		case ins == 0 && cp == 2:
+			cell = 384
+		case ins == 2 && cp == 0:
+			cell = 448
+		case ins == 1 && cp == 2:
+			cell = 512
+		case ins == 2 && cp == 1:
+			cell = 576
+		default:
+			cell = 640
+		}
+		c.symbol = cell + (c.insCode&7)<<3 | c.copyCode&7
+		cmdFreq[c.symbol]++
+		for _, lit := range data[pos : pos+insert] {
+			litFreq[lit]++
+		}
+		if c.hasCopy {
+			x := uint32(distance + 3)
+			nbits := highBit(x) - 1
+			hcode := int(x>>nbits) & 1
+			c.distCode = 16 + 2*(nbits-1) + hcode
+			c.distExtra, c.distBits = uint64(x-uint32(2+hcode)<<nbits), uint(nbits)
+			distFreq[c.distCode]++
+		}
+		pos += insert + copy
+		cmds = append(cmds, c)
+	}
+	for _, s := range seqs {
+		add(s.literals, s.length, s.distance)
+	}
+	if trailing > 0 {
+		// A cópia do último comando é ignorada: o meta-block termina antes
+		add(trailing, 2, 0)
+	}
+	b.cmds = cmds
+
+	// Tenta o meta-block comprimido; se não ficar menor, grava sem compressão
+	saved := b.bw
+	start := len(b.bw.out)
+	bw := &b.bw
+	b.metaBlockHeader(len(data), false)
+	bw.write(0, 1) // NBLTYPESL = 1
+	bw.write(0, 1) // NBLTYPESI = 1
+	bw.write(0, 1) // NBLTYPESD = 1
+	bw.write(0, 2) // NPOSTFIX
+	bw.write(0, 4) // NDIRECT
+	bw.write(0, 2) // modo de contexto dos literais
+	bw.write(0, 1) // NTREESL = 1
+	bw.write(0, 1) // NTREESD = 1
+	lits := newBrotliCode(litFreq[:], brotliMaxCodeLen)
+	commands := newBrotliCode(cmdFreq[:], brotliMaxCodeLen)
+	dists := newBrotliCode(distFreq[:], brotliMaxCodeLen)
+	writeBrotliCode(bw, lits, 8)
+	writeBrotliCode(bw, commands, 10)
+	writeBrotliCode(bw, dists, 6)
+	for _, c := range cmds {
+		commands.write(bw, c.symbol)
+		bw.write(uint64(c.insert-brotliInsertBase[c.insCode]), uint(brotliInsertBits[c.insCode]))
+		bw.write(uint64(c.copy-brotliCopyBase[c.copyCode]), uint(brotliCopyBits[c.copyCode]))
+		for _, lit := range data[c.literalsStart : c.literalsStart+c.insert] {
+			lits.write(bw, int(lit))
+		}
+		if c.hasCopy {
+			dists.write(bw, c.distCode)
+			bw.write(c.distExtra, c.distBits)
+		}
+	}
+	if len(b.bw.out)-start <= len(data) {
+		return
+	}
+	b.bw = saved
+	b.bw.out = b.bw.out[:start]
+	b.metaBlockHeader(len(data), true)
+	b.bw.align()
+	b.bw.out = append(b.bw.out, data...)
+}
+
+// metaBlockHeader grava ISLAST (0), MNIBBLES, MLEN-1 e ISUNCOMPRESSED
+func (b *brotliWriter) metaBlockHeader(size int, uncompressed bool) {
+	nibbles := 4
+	for nibbles < 6 && size-1 >= 1<<(4*nibbles) {
+		nibbles++
+	}
+	b.bw.write(0, 1)
+	b.bw.write(uint64(nibbles-4), 2)
+	b.bw.write(uint64(size-1), uint(4*nibbles))
+	if uncompressed {
+		b.bw.write(1, 1)
+	} else {
+		b.bw.write(0, 1)
+	}
+}
+
+// writeBrotliCode descreve um código de prefixo: o formato simples para até
+// quatro símbolos, senão os comprimentos comprimidos por outro código
+func writeBrotliCode(bw *bitWriter, c *brotliCode, alphabetBits uint) {
+	if len(c.used) <= 4 {
+		symbols := c.used
+		if len(symbols) == 0 {
+			symbols = []int{0}
+		}
+		// Os de comprimento menor primeiro, como o decoder espera
+		ordered := append([]int(nil), symbols...)
+		for i := 1; i < len(ordered); i++ {
+			for j := i; j > 0 && c.lengths[ordered[j]] < c.lengths[ordered[j-1]]; j-- {
+				ordered[j], ordered[j-1] = ordered[j-1], ordered[j]
+			}
+		}
+		bw.write(1, 2) // HSKIP = 1: código simples
+		bw.write(uint64(len(ordered)-1), 2)
+		for _, s := range ordered {
+			bw.write(uint64(s), alphabetBits)
+		}
+		if len(ordered) == 4 {
+			if c.lengths[ordered[0]] == 1 {
+				bw.write(1, 1)
+			} else {
+				bw.write(0, 1)
+			}
+		}
+		return
+	}
+
+	// Comprimentos até o último símbolo usado, com 16 repetindo o último
+	// comprimento não nulo e 17 repetindo zeros; nunca dois 16 ou dois 17
+	// seguidos, que o decoder combinaria
+	type token struct {
+		symbol int
+		extra  int
+	}
+	var tokens []token
+	last := c.used[len(c.used)-1]
+	for i := 0; i <= last; {
+		l := int(c.lengths[i])
+		run := 1
+		for i+run <= last && int(c.lengths[i+run]) == l {
+			run++
+		}
+		i += run
+		if l == 0 {
+			for run > 0 {
+				if run < 3 {
+					tokens = append(tokens, token{symbol: 0})
+					run--
+					continue
+				}
+				n := min(run, 10)
+				tokens = append(tokens, token{17, n - 3})
+				run -= n
+				if run > 0 {
+					tokens = append(tokens, token{symbol: 0})
+					run--
+				}
+			}
+			continue
+		}
+		tokens = append(tokens, token{symbol: l})
+		run--
+		for run > 0 {
+			if run < 3 {
+				tokens = append(tokens, token{symbol: l})
+				run--
+				continue
+			}
+			n := min(run, 6)
+			tokens = append(tokens, token{16, n - 3})
+			run -= n
+			if run > 0 {
+				tokens = append(tokens, token{symbol: l})
+				run--
+			}
+		}
+	}
+
+	freq := make([]int, 18)
+	for _, t := range tokens {
+		freq[t.symbol]++
+	}
+	distinct := 0
+	for _, f := range freq {
+		if f > 0 {
+			distinct++
+		}
+	}
+	if distinct == 1 {
+		// Um código completo precisa de dois símbolos
+		if freq[0] == 0 {
+			freq[0] = 1
+		} else {
+			freq[1] = 1
+		}
+	}
+	lengths := newBrotliCode(freq, 5)
+
+	bw.write(0, 2) // HSKIP = 0
+	end := len(brotliCodeLengthOrder)
+	for end > 0 && lengths.lengths[brotliCodeLengthOrder[end-1]] == 0 {
+		end--
+	}
+	for _, s := range brotliCodeLengthOrder[:end] {
+		fixed := brotliCodeLengthCode[lengths.lengths[s]]
+		bw.write(uint64(fixed[0]), uint(fixed[1]))
+	}
+	for _, t := range tokens {
+		lengths.write(bw, t.symbol)
+		switch t.symbol {
+		case 16:
+			bw.write(uint64(t.extra), 2)
+		case 17:
+			bw.write(uint64(t.extra), 3)
+		}
+	}
+}
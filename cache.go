@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// Purger cache cujas entradas podem ser invalidadas pela API administrativa.
+// As chaves são caminhos de URL (ex: /assets/app.js).
+type Purger interface {
+	// Name identifica o cache no relatório de remoção
+	Name() string
+	// Purge remove as entradas cuja chave satisfaz match e retorna as chaves removidas
+	Purge(match func(key string) bool) []string
+}
+
+// PurgeRequest critério de remoção (exatamente um campo deve ser informado)
+type PurgeRequest struct {
+	Path   string `json:"path,omitempty"`
+	Prefix string `json:"prefix,omitempty"`
+	Glob   string `json:"glob,omitempty"`
+	All    bool   `json:"all,omitempty"`
+}
+
+// PurgeResult entradas removidas por cache
+type PurgeResult struct {
+	Evicted map[string][]string `json:"evicted"`
+	Count   int                 `json:"count"`
+}
+
+// matcher converte o critério em função de comparação
+func (p PurgeRequest) matcher() (func(key string) bool, error) {
+	set := 0
+	for _, v := range []bool{p.Path != "", p.Prefix != "", p.Glob != "", p.All} {
+		if v {
+			set++
+		}
+	}
+	if set != 1 {
+		return nil, fmt.Errorf("exactly one of path, prefix, glob or all must be specified")
+	}
+
+	switch {
+	case p.Path != "":
+		return func(key string) bool { return key == p.Path }, nil
+	case p.Prefix != "":
+		return func(key string) bool { return strings.HasPrefix(key, p.Prefix) }, nil
+	case p.Glob != "":
+		re := compileGlob(p.Glob)
+		return re.MatchString, nil
+	default:
+		return func(string) bool { return true }, nil
+	}
+}
+
+// registerCache registra um cache para invalidação pela API administrativa
+func (s *Server) registerCache(cache Purger) {
+	s.cachesMu.Lock()
+	defer s.cachesMu.Unlock()
+	s.caches = append(s.caches, cache)
+}
+
+// PurgeCaches remove de todos os caches registrados as entradas que casam com o critério
+func (s *Server) PurgeCaches(req PurgeRequest) (*PurgeResult, error) {
+	match, err := req.matcher()
+	if err != nil {
+		return nil, err
+	}
+
+	s.cachesMu.Lock()
+	caches := append([]Purger(nil), s.caches...)
+	s.cachesMu.Unlock()
+
+	result := &PurgeResult{Evicted: make(map[string][]string)}
+	for _, cache := range caches {
+		keys := cache.Purge(match)
+		sort.Strings(keys)
+		if keys == nil {
+			keys = []string{}
+		}
+		result.Evicted[cache.Name()] = keys
+		result.Count += len(keys)
+	}
+
+	return result, nil
+}
+
+// handleAdminPurge remove entradas de cache ({"path"|"prefix"|"glob"|"all"})
+func (s *Server) handleAdminPurge(w http.ResponseWriter, r *http.Request) {
+	var req PurgeRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	result, err := s.PurgeCaches(req)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	s.logger.Info("Cache purge (%+v): %d entries evicted", req, result.Count)
+	writeJSON(w, http.StatusOK, result)
+}
+
+// cacheStatuses valores de X-Cache e membros de Cache-Status (RFC 9211) por
+// resultado do cache
+var cacheStatuses = map[string][2]string{
+	"hit":            {"HIT", "hit"},
+	"stale":          {"STALE", "hit; detail=stale-while-revalidate"},
+	"coalesced":      {"HIT", "hit; detail=coalesced"},
+	"stale-if-error": {"STALE", "hit; detail=stale-if-error"},
+	"revalidated":    {"REVALIDATED", "fwd=stale; fwd-status=304; stored"},
+	"miss":           {"MISS", "fwd=uri-miss; stored"},
+	"uncacheable":    {"MISS", "fwd=uri-miss"},
+	"bypass":         {"BYPASS", "fwd=bypass"},
+}
+
+// setCacheStatus informa a decisão do cache em X-Cache e Cache-Status; o
+// membro do qserv vai ao fim da lista recebida do upstream, como pede a RFC
+func setCacheStatus(w http.ResponseWriter, r *http.Request, status string) {
+	values := cacheStatuses[status]
+	h := w.Header()
+	h.Set("X-Cache", values[0])
+	member := "qserv; " + values[1]
+	if upstream := strings.Join(h.Values("Cache-Status"), ", "); upstream != "" {
+		member = upstream + ", " + member
+	}
+	h.Set("Cache-Status", member)
+	debugNote(r, "cache", status)
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeCache is an in-memory Purger used to exercise the purge API
+type fakeCache struct {
+	mu   sync.Mutex
+	keys map[string]bool
+}
+
+func newFakeCache(keys ...string) *fakeCache {
+	c := &fakeCache{keys: make(map[string]bool)}
+	for _, key := range keys {
+		c.keys[key] = true
+	}
+	return c
+}
+
+func (c *fakeCache) Name() string { return "fake" }
+
+func (c *fakeCache) Purge(match func(key string) bool) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var evicted []string
+	for key := range c.keys {
+		if match(key) {
+			delete(c.keys, key)
+			evicted = append(evicted, key)
+		}
+	}
+	return evicted
+}
+
+func TestMatchGlob(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		path     string
+		expected bool
+	}{
+		{"/assets/*.js", "/assets/app.js", true},
+		{"/assets/*.js", "/assets/vendor/lib.js", false},
+		{"/assets/**.js", "/assets/vendor/lib.js", true},
+		{"/assets/**", "/assets/a/b/c.css", true},
+		{"/img/?.png", "/img/a.png", true},
+		{"/img/?.png", "/img/ab.png", false},
+		{"/file.(1).txt", "/file.(1).txt", true},
+	}
+
+	for _, test := range tests {
+		if result := matchGlob(test.pattern, test.path); result != test.expected {
+			t.Errorf("matchGlob(%q, %q) = %v, expected %v", test.pattern, test.path, result, test.expected)
+		}
+	}
+}
+
+func TestPurgeCaches(t *testing.T) {
+	tests := []struct {
+		name     string
+		request  PurgeRequest
+		expected []string
+	}{
+		{"Path", PurgeRequest{Path: "/index.html"}, []string{"/index.html"}},
+		{"Prefix", PurgeRequest{Prefix: "/assets/"}, []string{"/assets/app.css", "/assets/app.js", "/assets/vendor/lib.js"}},
+		{"Glob", PurgeRequest{Glob: "/assets/*.js"}, []string{"/assets/app.js"}},
+		{"All", PurgeRequest{All: true}, []string{"/assets/app.css", "/assets/app.js", "/assets/vendor/lib.js", "/index.html"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			logger, _ := NewLogger(&LoggingConfig{Enabled: false})
+			server := NewServer(DefaultConfig(), logger)
+			server.registerCache(newFakeCache("/index.html", "/assets/app.js", "/assets/app.css", "/assets/vendor/lib.js"))
+
+			result, err := server.PurgeCaches(test.request)
+			if err != nil {
+				t.Fatalf("Purge failed: %v", err)
+			}
+			if got := strings.Join(result.Evicted["fake"], ","); got != strings.Join(test.expected, ",") {
+				t.Errorf("Expected evicted %v, got %v", test.expected, result.Evicted["fake"])
+			}
+			if result.Count != len(test.expected) {
+				t.Errorf("Expected count %d, got %d", len(test.expected), result.Count)
+			}
+		})
+	}
+}
+
+func TestAdminPurgeEndpoint(t *testing.T) {
+	server := newAdminTestServer(t, t.TempDir())
+	server.registerCache(newFakeCache("/a.js", "/b.js"))
+
+	w := adminRequest(server, "POST", "/_admin/cache/purge", `{"path": "/a.js", "prefix": "/"}`)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for ambiguous criteria, got %d", w.Code)
+	}
+
+	w = adminRequest(server, "POST", "/_admin/cache/purge", `{"glob": "/*.js"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var result PurgeResult
+	json.Unmarshal(w.Body.Bytes(), &result)
+	if result.Count != 2 {
+		t.Errorf("Expected 2 evicted entries, got %d", result.Count)
+	}
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// CertMonitor acompanha a validade do certificado carregado (HTTPS e FTPS):
+// métrica, status na API administrativa, avisos no log ao cruzar cada
+// limite de warn_days e, opcionalmente, um webhook
+type CertMonitor struct {
+	config   *CertMonitorConfig
+	certFile string
+	logger   *Logger
+	client   *http.Client
+
+	mu      sync.Mutex
+	loaded  *x509.Certificate // lido na inicialização, junto com o servidor TLS
+	onDisk  *x509.Certificate // última leitura do arquivo
+	err     error
+	checked time.Time
+	alerted map[int]bool // limites já avisados para o certificado carregado
+}
+
+// CertStatus estado do certificado na API administrativa
+type CertStatus struct {
+	File          string    `json:"file"`
+	Subject       string    `json:"subject,omitempty"`
+	DNSNames      []string  `json:"dns_names,omitempty"`
+	NotAfter      time.Time `json:"not_after,omitempty"`
+	DaysLeft      float64   `json:"days_left"`
+	Expired       bool      `json:"expired"`
+	RenewedOnDisk bool      `json:"renewed_on_disk"` // o arquivo tem outro certificado; precisa reiniciar
+	CheckedAt     time.Time `json:"checked_at,omitempty"`
+	Error         string    `json:"error,omitempty"`
+}
+
+// certEvent corpo do webhook de expiração
+type certEvent struct {
+	Event     string    `json:"event"` // certificate.expiring ou certificate.expired
+	Host      string    `json:"host"`
+	File      string    `json:"file"`
+	Subject   string    `json:"subject"`
+	NotAfter  time.Time `json:"not_after"`
+	DaysLeft  float64   `json:"days_left"`
+	Threshold int       `json:"threshold,omitempty"`
+}
+
+// NewCertMonitor lê o certificado configurado (config pode ser nil)
+func NewCertMonitor(config *CertMonitorConfig, certFile string, logger *Logger) (*CertMonitor, error) {
+	if config == nil {
+		config = &CertMonitorConfig{}
+	}
+	for _, days := range config.WarnDays {
+		if days <= 0 {
+			return nil, errors.New("cert_monitor: warn_days must be positive")
+		}
+	}
+	if config.Interval < 0 {
+		return nil, errors.New("cert_monitor: interval must not be negative")
+	}
+	cert, err := loadCertificate(certFile)
+	if err != nil {
+		return nil, err
+	}
+	return &CertMonitor{
+		config:   config,
+		certFile: certFile,
+		logger:   logger,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		loaded:   cert,
+		onDisk:   cert,
+		alerted:  make(map[int]bool),
+	}, nil
+}
+
+// loadCertificate lê o primeiro certificado (o da folha) do arquivo PEM
+func loadCertificate(certFile string) (*x509.Certificate, error) {
+	data, err := os.ReadFile(certFile)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, fmt.Errorf("%s: no PEM certificate", certFile)
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+// certDaysLeft dias até notAfter, com uma casa decimal
+func certDaysLeft(notAfter time.Time) float64 {
+	return math.Floor(time.Until(notAfter).Hours()/24*10) / 10
+}
+
+// warnDays retorna os limites de aviso, do maior para o menor
+func (c *CertMonitor) warnDays() []int {
+	days := c.config.WarnDays
+	if len(days) == 0 {
+		days = []int{30, 14, 7, 1}
+	}
+	sorted := append([]int{}, days...)
+	sort.Sort(sort.Reverse(sort.IntSlice(sorted)))
+	return sorted
+}
+
+// interval retorna o intervalo entre verificações
+func (c *CertMonitor) interval() time.Duration {
+	if c.config.Interval <= 0 {
+		return time.Hour
+	}
+	return time.Duration(c.config.Interval) * time.Second
+}
+
+// Check relê o arquivo e avisa (log e webhook) quando o certificado
+// carregado cruza um limite; cada limite é avisado uma vez
+func (c *CertMonitor) Check() (string, error) {
+	onDisk, err := loadCertificate(c.certFile)
+	c.mu.Lock()
+	c.checked = time.Now()
+	c.err = err
+	if err == nil {
+		c.onDisk = onDisk
+	}
+	loaded := c.loaded
+	c.mu.Unlock()
+	if err != nil {
+		return "", err
+	}
+
+	if !onDisk.NotAfter.Equal(loaded.NotAfter) {
+		c.logger.Warn("Certificate %s was renewed on disk (expires %s); restart to load it",
+			c.certFile, onDisk.NotAfter.UTC().Format(time.RFC3339))
+	}
+
+	days := certDaysLeft(loaded.NotAfter)
+	if days <= 0 {
+		if c.alert(0) {
+			c.logger.Error("Certificate %s expired at %s", c.certFile, loaded.NotAfter.UTC().Format(time.RFC3339))
+			c.notify("certificate.expired", loaded, days, 0)
+		}
+		return "expired", nil
+	}
+
+	// Só o menor limite cruzado gera aviso (ex: reinício já dentro de 7 dias)
+	crossed := 0
+	for _, threshold := range c.warnDays() {
+		if days <= float64(threshold) {
+			crossed = threshold
+		}
+	}
+	if crossed > 0 && c.alert(crossed) {
+		c.logger.Warn("Certificate %s expires in %.1f days (%s)", c.certFile, days, loaded.NotAfter.UTC().Format(time.RFC3339))
+		c.notify("certificate.expiring", loaded, days, crossed)
+	}
+	return fmt.Sprintf("expires in %.1f days", days), nil
+}
+
+// alert marca o limite (e os maiores) como avisado; false se já estava
+func (c *CertMonitor) alert(threshold int) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.alerted[threshold] {
+		return false
+	}
+	for _, days := range c.warnDays() {
+		if days >= threshold {
+			c.alerted[days] = true
+		}
+	}
+	c.alerted[threshold] = true
+	return true
+}
+
+// notify envia o webhook, se configurado; o corpo é assinado com
+// HMAC-SHA256 quando há secret
+func (c *CertMonitor) notify(event string, cert *x509.Certificate, days float64, threshold int) {
+	if c.config.Webhook == "" {
+		return
+	}
+	host, _ := os.Hostname()
+	body, err := json.Marshal(certEvent{
+		Event:     event,
+		Host:      host,
+		File:      c.certFile,
+		Subject:   cert.Subject.String(),
+		NotAfter:  cert.NotAfter.UTC(),
+		DaysLeft:  days,
+		Threshold: threshold,
+	})
+	if err != nil {
+		return
+	}
+	req, err := http.NewRequest(http.MethodPost, c.config.Webhook, bytes.NewReader(body))
+	if err != nil {
+		c.logger.Error("Certificate webhook: %v", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "qserv")
+	req.Header.Set("X-Qserv-Event", event)
+	if c.config.Secret != "" {
+		mac := hmac.New(sha256.New, []byte(c.config.Secret))
+		mac.Write(body)
+		req.Header.Set("X-Qserv-Signature-256", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		c.logger.Error("Certificate webhook: %v", err)
+		return
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		c.logger.Error("Certificate webhook: unexpected status %s", resp.Status)
+	}
+}
+
+// Status retorna o estado do certificado carregado
+func (c *CertMonitor) Status() CertStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	days := certDaysLeft(c.loaded.NotAfter)
+	status := CertStatus{
+		File:          c.certFile,
+		Subject:       c.loaded.Subject.String(),
+		DNSNames:      c.loaded.DNSNames,
+		NotAfter:      c.loaded.NotAfter.UTC(),
+		DaysLeft:      days,
+		Expired:       days <= 0,
+		RenewedOnDisk: !c.onDisk.NotAfter.Equal(c.loaded.NotAfter),
+		CheckedAt:     c.checked,
+	}
+	if c.err != nil {
+		status.Error = c.err.Error()
+	}
+	return status
+}
+
+// WriteMetrics exporta a validade do certificado carregado
+func (c *CertMonitor) WriteMetrics(w io.Writer) {
+	c.mu.Lock()
+	notAfter := c.loaded.NotAfter
+	c.mu.Unlock()
+	labels := map[string]string{"file": c.certFile}
+	writeMetric(w, "qserv_certificate_expiry_timestamp_seconds", "Expiry of the loaded TLS certificate (Unix time).", "gauge",
+		[]metricSample{{labels: labels, value: float64(notAfter.Unix())}})
+	writeMetric(w, "qserv_certificate_days_left", "Days until the loaded TLS certificate expires.", "gauge",
+		[]metricSample{{labels: labels, value: certDaysLeft(notAfter)}})
+}
+
+// handleAdminCertificate responde o estado do certificado
+func (s *Server) handleAdminCertificate(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.certMonitor.Status())
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// certWebhook collects the events posted to it
+type certWebhook struct {
+	mu     sync.Mutex
+	events []certEvent
+	sigs   []string
+}
+
+func (h *certWebhook) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var event certEvent
+	json.NewDecoder(r.Body).Decode(&event)
+	h.mu.Lock()
+	h.events = append(h.events, event)
+	h.sigs = append(h.sigs, r.Header.Get("X-Qserv-Signature-256"))
+	h.mu.Unlock()
+}
+
+func TestCertMonitorThresholds(t *testing.T) {
+	hook := &certWebhook{}
+	server := httptest.NewServer(hook)
+	defer server.Close()
+
+	logger, _ := NewLogger(&LoggingConfig{Enabled: false})
+	certFile, _ := writeTestCert(t, t.TempDir(), time.Now().Add(10*24*time.Hour))
+	monitor, err := NewCertMonitor(&CertMonitorConfig{WarnDays: []int{7, 30, 14}, Webhook: server.URL, Secret: "s"}, certFile, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 10 days left: only the 14-day threshold fires, and only once
+	for i := 0; i < 2; i++ {
+		if _, err := monitor.Check(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(hook.events) != 1 {
+		t.Fatalf("Expected one webhook, got %d", len(hook.events))
+	}
+	if event := hook.events[0]; event.Event != "certificate.expiring" || event.Threshold != 14 || event.Subject != "CN=qserv.test" {
+		t.Errorf("Expected expiring event at 14 days, got %+v", event)
+	}
+	if !strings.HasPrefix(hook.sigs[0], "sha256=") {
+		t.Errorf("Expected signed webhook, got %q", hook.sigs[0])
+	}
+}
+
+func TestCertMonitorExpired(t *testing.T) {
+	hook := &certWebhook{}
+	server := httptest.NewServer(hook)
+	defer server.Close()
+
+	logger, _ := NewLogger(&LoggingConfig{Enabled: false})
+	certFile, _ := writeTestCert(t, t.TempDir(), time.Now().Add(-time.Hour))
+	monitor, err := NewCertMonitor(&CertMonitorConfig{Webhook: server.URL}, certFile, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if message, _ := monitor.Check(); message != "expired" {
+		t.Errorf("Expected expired, got %q", message)
+	}
+	monitor.Check()
+	if len(hook.events) != 1 || hook.events[0].Event != "certificate.expired" {
+		t.Errorf("Expected a single expired event, got %+v", hook.events)
+	}
+	if status := monitor.Status(); !status.Expired {
+		t.Errorf("Expected expired status, got %+v", status)
+	}
+}
+
+func TestCertMonitorStatus(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeTestCert(t, dir, time.Now().Add(60*24*time.Hour))
+	server := newListingTestServer(t, t.TempDir(), func(c *Config) {
+		c.Security.EnableHTTPS = true
+		c.Security.CertFile, c.Security.KeyFile = certFile, keyFile
+	})
+	if server.certMonitor == nil {
+		t.Fatal("Expected certificate monitor with HTTPS enabled")
+	}
+
+	// Renewing the file is reported but the loaded certificate is kept
+	writeTestCert(t, dir, time.Now().Add(90*24*time.Hour))
+	server.certMonitor.Check()
+	status := server.certMonitor.Status()
+	if !status.RenewedOnDisk || status.DaysLeft < 59 || status.DaysLeft > 60 || status.Subject != "CN=qserv.test" {
+		t.Errorf("Expected loaded certificate with renewal pending, got %+v", status)
+	}
+
+	var b strings.Builder
+	server.certMonitor.WriteMetrics(&b)
+	if !strings.Contains(b.String(), "qserv_certificate_days_left{") || !strings.Contains(b.String(), "qserv_certificate_expiry_timestamp_seconds{") {
+		t.Errorf("Expected certificate metrics, got %s", b.String())
+	}
+
+	if _, err := NewCertMonitor(&CertMonitorConfig{WarnDays: []int{0}}, certFile, nil); err == nil {
+		t.Errorf("Expected non-positive warn_days to be rejected")
+	}
+}
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"html/template"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const challengeCookie = "qserv_challenge"
+
+// challengeProviders endpoints de verificação, script e campo do formulário de cada provedor
+var challengeProviders = map[string]struct {
+	verifyURL string
+	script    string
+	widget    string
+	field     string
+}{
+	"turnstile": {
+		verifyURL: "https://challenges.cloudflare.com/turnstile/v0/siteverify",
+		script:    "https://challenges.cloudflare.com/turnstile/v0/api.js",
+		widget:    "cf-turnstile",
+		field:     "cf-turnstile-response",
+	},
+	"hcaptcha": {
+		verifyURL: "https://api.hcaptcha.com/siteverify",
+		script:    "https://js.hcaptcha.com/1/api.js",
+		widget:    "h-captcha",
+		field:     "h-captcha-response",
+	},
+}
+
+// challengePassedKey marca no contexto clientes isentos por um cookie válido
+type challengePassedKey struct{}
+
+// Challenge apresenta um captcha a clientes suspeitos e emite um cookie
+// assinado que os isenta do rate limiting por um período
+type Challenge struct {
+	config    *ChallengeConfig
+	logger    *Logger
+	key       []byte
+	verifyURL string
+	client    *http.Client
+	now       func() time.Time
+	theme     *Theme
+	language  string // idioma fixo da página ("" = Accept-Language)
+}
+
+// NewChallenge cria o desafio
+func NewChallenge(config *ChallengeConfig, logger *Logger) *Challenge {
+	key := []byte(config.CookieSecret)
+	if len(key) == 0 {
+		// Sem chave configurada os cookies valem apenas até o próximo restart
+		key = make([]byte, 32)
+		rand.Read(key)
+	}
+	theme, _ := NewTheme(nil)
+	return &Challenge{
+		config:    config,
+		logger:    logger,
+		key:       key,
+		verifyURL: challengeProviders[config.Provider].verifyURL,
+		client:    &http.Client{Timeout: 10 * time.Second},
+		now:       time.Now,
+		theme:     theme,
+	}
+}
+
+// route retorna a rota de verificação
+func (c *Challenge) route() string {
+	if c.config.Route == "" {
+		return "/_challenge"
+	}
+	return c.config.Route
+}
+
+// ttl retorna a duração da isenção
+func (c *Challenge) ttl() time.Duration {
+	if c.config.CookieTTL <= 0 {
+		return time.Hour
+	}
+	return time.Duration(c.config.CookieTTL) * time.Second
+}
+
+// sign assina a expiração do cookie junto com o User-Agent do cliente,
+// para que o cookie não sirva a outro agente
+func (c *Challenge) sign(expires int64, userAgent string) string {
+	mac := hmac.New(sha256.New, c.key)
+	mac.Write([]byte(strconv.FormatInt(expires, 10) + "|" + userAgent))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Passed informa se a requisição traz um cookie de isenção válido
+func (c *Challenge) Passed(r *http.Request) bool {
+	cookie, err := r.Cookie(challengeCookie)
+	if err != nil {
+		return false
+	}
+	expiresStr, sig, ok := strings.Cut(cookie.Value, ".")
+	if !ok {
+		return false
+	}
+	expires, err := strconv.ParseInt(expiresStr, 10, 64)
+	if err != nil || c.now().Unix() >= expires {
+		return false
+	}
+	return hmac.Equal([]byte(sig), []byte(c.sign(expires, r.UserAgent())))
+}
+
+// Suspicious aplica as heurísticas de bot ao User-Agent
+func (c *Challenge) Suspicious(r *http.Request) bool {
+	ua := r.UserAgent()
+	if ua == "" {
+		return c.config.EmptyUserAgent
+	}
+	ua = strings.ToLower(ua)
+	for _, pattern := range c.config.UserAgents {
+		if pattern != "" && strings.Contains(ua, strings.ToLower(pattern)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Serve responde com a página do desafio
+func (c *Challenge) Serve(w http.ResponseWriter, r *http.Request, status int) {
+	provider := challengeProviders[c.config.Provider]
+	data := struct {
+		Action, Return, SiteKey, Script, Widget string
+		Theme                                   *Theme
+		Msg                                     *Messages
+	}{
+		Theme:   c.theme,
+		Msg:     messagesFor(r, c.language),
+		Action:  c.route(),
+		Return:  r.URL.RequestURI(),
+		SiteKey: c.config.SiteKey,
+		Script:  provider.script,
+		Widget:  provider.widget,
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	if c.language == "" {
+		w.Header().Add("Vary", "Accept-Language")
+	}
+	w.WriteHeader(status)
+	if r.Method == http.MethodHead {
+		return
+	}
+	if err := challengeTemplate.Execute(w, data); err != nil {
+		c.logger.Error("Error rendering challenge: %v", err)
+	}
+}
+
+// Handler retorna o handler que valida a resposta do captcha e emite o cookie
+func (c *Challenge) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", "POST")
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		r.Body = http.MaxBytesReader(w, r.Body, 64<<10)
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
+		ip, _, _ := net.SplitHostPort(r.RemoteAddr)
+		token := r.PostForm.Get(challengeProviders[c.config.Provider].field)
+		if token == "" || !c.verify(r.Context(), token, ip) {
+			c.logger.Warn("Challenge failed for %s", ip)
+			c.Serve(w, r, http.StatusForbidden)
+			return
+		}
+
+		expires := c.now().Add(c.ttl()).Unix()
+		http.SetCookie(w, &http.Cookie{
+			Name:     challengeCookie,
+			Value:    strconv.FormatInt(expires, 10) + "." + c.sign(expires, r.UserAgent()),
+			Path:     "/",
+			MaxAge:   int(c.ttl() / time.Second),
+			HttpOnly: true,
+			Secure:   r.TLS != nil,
+			SameSite: http.SameSiteLaxMode,
+		})
+
+		// Só redireciona para caminhos locais (evita open redirect)
+		target := r.PostForm.Get("return")
+		if !strings.HasPrefix(target, "/") || strings.HasPrefix(target, "//") || strings.HasPrefix(target, "/\\") {
+			target = "/"
+		}
+		http.Redirect(w, r, target, http.StatusSeeOther)
+	})
+}
+
+// verify consulta a API siteverify do provedor
+func (c *Challenge) verify(ctx context.Context, token, ip string) bool {
+	form := url.Values{"secret": {c.config.Secret}, "response": {token}}
+	if ip != "" {
+		form.Set("remoteip", ip)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.verifyURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return false
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		c.logger.Error("Challenge verification error: %v", err)
+		return false
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Success bool `json:"success"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		c.logger.Error("Invalid challenge verification response: %v", err)
+		return false
+	}
+	return result.Success
+}
+
+// challengePassed informa se o ChallengeMiddleware isentou a requisição
+func challengePassed(r *http.Request) bool {
+	passed, _ := r.Context().Value(challengePassedKey{}).(bool)
+	return passed
+}
+
+// ChallengeMiddleware isenta clientes com cookie válido e desafia os que
+// casam com as heurísticas de bot
+func ChallengeMiddleware(challenge *Challenge) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if challenge.Passed(r) {
+				next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), challengePassedKey{}, true)))
+				return
+			}
+			if challenge.Suspicious(r) {
+				challenge.Serve(w, r, http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// challengeTemplate página intersticial do desafio
+var challengeTemplate = template.Must(template.New("challenge").Parse(`<!DOCTYPE html>
+<html lang="{{.Msg.Lang}}">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <title>{{.Msg.T "Checking your browser"}}{{with .Theme.Title}} · {{.}}{{end}}</title>
+    <script src="{{.Script}}" async defer></script>
+    <style>
+        {{.Theme.CSS}}
+        body {
+            font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, Oxygen, Ubuntu, Cantarell, sans-serif;
+            display: flex;
+            align-items: center;
+            justify-content: center;
+            min-height: 100vh;
+            flex-direction: column;
+            margin: 0;
+            background: var(--qs-bg);
+            color: var(--qs-text);
+        }
+        .card { background: var(--qs-surface); padding: 2rem; border-radius: 8px; box-shadow: var(--qs-shadow); text-align: center; }
+        .logo { max-height: 48px; margin-bottom: 1rem; }
+        h1 { font-size: 1.25rem; color: var(--qs-text); margin-bottom: 1rem; }
+        button { margin-top: 1rem; padding: 0.5rem 1.5rem; }
+        footer { margin-top: 1.5rem; color: var(--qs-muted); font-size: 0.875rem; }
+    </style>
+</head>
+<body>
+    <form class="card" method="POST" action="{{.Action}}">
+        {{with .Theme.Logo}}<img class="logo" src="{{.}}" alt="">{{end}}
+        <h1>{{.Msg.T "Please confirm you are not a robot"}}</h1>
+        <input type="hidden" name="return" value="{{.Return}}">
+        <div class="{{.Widget}}" data-sitekey="{{.SiteKey}}"></div>
+        <button type="submit">{{.Msg.T "Continue"}}</button>
+    </form>
+    {{with .Theme.Footer}}<footer>{{.}}</footer>{{end}}
+</body>
+</html>`))
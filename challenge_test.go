@@ -0,0 +1,129 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestChallengeFlow(t *testing.T) {
+	verifier := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.PostForm.Get("secret") != "s3cret" {
+			t.Errorf("Expected secret to be sent, got %q", r.PostForm.Get("secret"))
+		}
+		if r.PostForm.Get("response") == "good" {
+			w.Write([]byte(`{"success": true}`))
+			return
+		}
+		w.Write([]byte(`{"success": false, "error-codes": ["invalid-input-response"]}`))
+	}))
+	defer verifier.Close()
+
+	root := t.TempDir()
+	os.WriteFile(filepath.Join(root, "file.txt"), []byte("hello"), 0644)
+
+	config := DefaultConfig()
+	config.Server.RootDir = root
+	config.Performance.EnableCompression = false
+	config.Security.RateLimit = &RateLimitConfig{Enabled: true, RequestsPerIP: 1}
+	config.Security.Challenge = &ChallengeConfig{
+		Enabled:     true,
+		Provider:    "turnstile",
+		SiteKey:     "site",
+		Secret:      "s3cret",
+		OnRateLimit: true,
+		UserAgents:  []string{"BadBot"},
+	}
+
+	logger, _ := NewLogger(&LoggingConfig{Enabled: false})
+	server := NewServer(config, logger)
+	server.challenge.verifyURL = verifier.URL
+	server.setupHandlers()
+
+	get := func(ua string, cookie *http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/file.txt", nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		req.Header.Set("User-Agent", ua)
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		w := httptest.NewRecorder()
+		server.mux.ServeHTTP(w, req)
+		return w
+	}
+
+	// Bot heuristics challenge immediately
+	if w := get("Mozilla BadBot/1.0", nil); w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), `data-sitekey="site"`) {
+		t.Errorf("Expected challenge page for bot user agent, got %d", w.Code)
+	}
+
+	// Exceeding the rate limit shows the challenge instead of a plain 429
+	get("Mozilla/5.0", nil)
+	w := get("Mozilla/5.0", nil)
+	if w.Code != http.StatusTooManyRequests || !strings.Contains(w.Body.String(), "cf-turnstile") {
+		t.Errorf("Expected challenge page on rate limit, got %d", w.Code)
+	}
+
+	verify := func(token, ua string) *httptest.ResponseRecorder {
+		form := url.Values{"cf-turnstile-response": {token}, "return": {"/file.txt"}}
+		req := httptest.NewRequest("POST", "/_challenge", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("User-Agent", ua)
+		req.RemoteAddr = "10.0.0.1:1234"
+		w := httptest.NewRecorder()
+		server.mux.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := verify("bad", "Mozilla/5.0"); w.Code != http.StatusForbidden || len(w.Result().Cookies()) != 0 {
+		t.Errorf("Expected failed verification without cookie, got %d", w.Code)
+	}
+
+	w = verify("good", "Mozilla/5.0")
+	if w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/file.txt" {
+		t.Fatalf("Expected redirect back to /file.txt, got %d %q", w.Code, w.Header().Get("Location"))
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != challengeCookie {
+		t.Fatalf("Expected exemption cookie, got %v", cookies)
+	}
+
+	// The cookie exempts the client from the rate limit
+	for i := 0; i < 3; i++ {
+		if w := get("Mozilla/5.0", cookies[0]); w.Code != http.StatusOK {
+			t.Errorf("Expected exempt client to be served, got %d", w.Code)
+		}
+	}
+
+	// The cookie is bound to the user agent it was issued for
+	if w := get("Other/1.0", cookies[0]); w.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected cookie to be rejected for another user agent, got %d", w.Code)
+	}
+}
+
+func TestChallengeRedirectIsLocal(t *testing.T) {
+	verifier := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"success": true}`))
+	}))
+	defer verifier.Close()
+
+	logger, _ := NewLogger(&LoggingConfig{Enabled: false})
+	challenge := NewChallenge(&ChallengeConfig{Enabled: true, Provider: "hcaptcha", Secret: "x"}, logger)
+	challenge.verifyURL = verifier.URL
+
+	for _, target := range []string{"https://evil.example/", "//evil.example/", "/\\evil.example/"} {
+		form := url.Values{"h-captcha-response": {"token"}, "return": {target}}
+		req := httptest.NewRequest("POST", "/_challenge", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		challenge.Handler().ServeHTTP(w, req)
+		if w.Header().Get("Location") != "/" {
+			t.Errorf("Expected redirect to / for %q, got %q", target, w.Header().Get("Location"))
+		}
+	}
+}
@@ -0,0 +1,446 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ChunkedUploads monta arquivos enviados em partes numeradas, no estilo do
+// multipart do S3: o cliente abre a sessão, envia as partes em PUTs
+// paralelos e pede a montagem, que confere o SHA-256 informado antes de
+// gravar o arquivo pelas mesmas regras do PUT
+//
+//	POST   /incoming/big.iso?chunked             abre a sessão ({"id": ...})
+//	PUT    /incoming/big.iso?chunked=ID&part=N   grava a parte N (1 a max_chunks)
+//	GET    /incoming/big.iso?chunked=ID          partes recebidas
+//	POST   /incoming/big.iso?chunked=ID&sha256=  monta o arquivo
+//	DELETE /incoming/big.iso?chunked=ID          descarta a sessão
+type ChunkedUploads struct {
+	dir       string
+	ttl       time.Duration
+	maxChunks int
+	now       func() time.Time
+
+	mu       sync.Mutex
+	sessions map[string]*chunkedUpload
+}
+
+// chunkedUpload sessão de envio em partes (ChunkedUploads.mu)
+type chunkedUpload struct {
+	root       string
+	path       string // caminho de URL do arquivo final
+	parts      map[int]int64
+	updated    time.Time
+	assembling bool
+}
+
+// ChunkedUploadStatus estado da sessão, como devolvido ao cliente
+type ChunkedUploadStatus struct {
+	ID    string        `json:"id"`
+	Path  string        `json:"path"`
+	Parts []chunkedPart `json:"parts"`
+	Size  int64         `json:"size"` // soma das partes recebidas
+}
+
+// chunkedPart parte recebida
+type chunkedPart struct {
+	Part int   `json:"part"`
+	Size int64 `json:"size"`
+}
+
+// NewChunkedUploads valida a configuração; o diretório das partes só é
+// criado na primeira sessão
+func NewChunkedUploads(config *UploadsConfig) (*ChunkedUploads, error) {
+	if config.ChunkTTL < 0 || config.MaxChunks < 0 {
+		return nil, errors.New("uploads: chunk_ttl and max_chunks must not be negative")
+	}
+	c := &ChunkedUploads{
+		dir:       config.ChunkDir,
+		ttl:       time.Duration(config.ChunkTTL) * time.Second,
+		maxChunks: config.MaxChunks,
+		now:       time.Now,
+		sessions:  make(map[string]*chunkedUpload),
+	}
+	if c.dir == "" {
+		c.dir = filepath.Join(os.TempDir(), "qserv-chunks")
+	}
+	if c.ttl == 0 {
+		c.ttl = 24 * time.Hour
+	}
+	if c.maxChunks == 0 {
+		c.maxChunks = 10000
+	}
+	return c, nil
+}
+
+// sessionDir diretório das partes de uma sessão
+func (c *ChunkedUploads) sessionDir(id string) string {
+	return filepath.Join(c.dir, id)
+}
+
+// Start abre uma sessão para o arquivo urlPath
+func (c *ChunkedUploads) Start(root, urlPath string) (string, error) {
+	b := make([]byte, 16)
+	rand.Read(b)
+	id := hex.EncodeToString(b)
+
+	// O diretório nasce com o lock travado para Sweep não tomá-lo por órfão
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := os.MkdirAll(c.sessionDir(id), 0700); err != nil {
+		return "", err
+	}
+	c.sessions[id] = &chunkedUpload{root: root, path: urlPath, parts: make(map[int]int64), updated: c.now()}
+	return id, nil
+}
+
+// interval retorna o intervalo entre as varreduras de sessões expiradas
+func (c *ChunkedUploads) interval() time.Duration {
+	switch interval := c.ttl / 4; {
+	case interval < time.Minute:
+		return time.Minute
+	case interval > time.Hour:
+		return time.Hour
+	default:
+		return interval
+	}
+}
+
+// Sweep descarta as sessões expiradas e passa a remove os diretórios de
+// partes sem sessão. As sessões só existem em memória: na inicialização
+// todo diretório deixado pela execução anterior é órfão
+func (c *ChunkedUploads) Sweep(remove func(string, fs.FileInfo)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	for id, session := range c.sessions {
+		if !session.assembling && now.Sub(session.updated) > c.ttl {
+			delete(c.sessions, id)
+		}
+	}
+	entries, _ := os.ReadDir(c.dir)
+	for _, entry := range entries {
+		// chunk_dir pode ser compartilhado: só mexe no que tem nome de sessão
+		id := entry.Name()
+		if _, active := c.sessions[id]; active || !entry.IsDir() || !chunkedSessionID(id) {
+			continue
+		}
+		if info, err := entry.Info(); err == nil {
+			remove(c.sessionDir(id), info)
+		}
+	}
+}
+
+// chunkedSessionID informa se name tem o formato dos IDs de Start
+func chunkedSessionID(name string) bool {
+	if len(name) != 32 {
+		return false
+	}
+	_, err := hex.DecodeString(name)
+	return err == nil
+}
+
+// session retorna a sessão id aberta para o arquivo (c.mu travado)
+func (c *ChunkedUploads) session(id, root, urlPath string) (*chunkedUpload, error) {
+	session, ok := c.sessions[id]
+	if !ok || session.root != root || session.path != urlPath || c.now().Sub(session.updated) > c.ttl {
+		return nil, &uploadError{http.StatusNotFound, "unknown or expired chunked upload"}
+	}
+	if session.assembling {
+		return nil, &uploadError{http.StatusConflict, "chunked upload is being assembled"}
+	}
+	return session, nil
+}
+
+// StorePart grava a parte part lendo body; partes repetidas substituem a
+// anterior. limit é o tamanho máximo do arquivo montado
+func (c *ChunkedUploads) StorePart(id, root, urlPath string, part int, body io.Reader, limit int64) (int64, error) {
+	if part < 1 || part > c.maxChunks {
+		return 0, &uploadError{http.StatusBadRequest, fmt.Sprintf("part must be between 1 and %d", c.maxChunks)}
+	}
+	c.mu.Lock()
+	_, err := c.session(id, root, urlPath)
+	c.mu.Unlock()
+	if err != nil {
+		return 0, err
+	}
+
+	// Grava fora do lock (as partes chegam em paralelo) e renomeia ao final
+	tmp, err := os.CreateTemp(c.sessionDir(id), ".part-*")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp.Name())
+	size, err := io.Copy(tmp, io.LimitReader(body, limit+1))
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	session, err := c.session(id, root, urlPath)
+	if err != nil {
+		return 0, err
+	}
+	total := size
+	for n, partSize := range session.parts {
+		if n != part {
+			total += partSize
+		}
+	}
+	if total > limit {
+		return 0, &http.MaxBytesError{Limit: limit}
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(c.sessionDir(id), strconv.Itoa(part))); err != nil {
+		return 0, err
+	}
+	session.parts[part] = size
+	session.updated = c.now()
+	return size, nil
+}
+
+// Status retorna as partes recebidas pela sessão
+func (c *ChunkedUploads) Status(id, root, urlPath string) (ChunkedUploadStatus, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	session, err := c.session(id, root, urlPath)
+	if err != nil {
+		return ChunkedUploadStatus{}, err
+	}
+	status := ChunkedUploadStatus{ID: id, Path: escapeURLPath(urlPath), Parts: []chunkedPart{}}
+	for part, size := range session.parts {
+		status.Parts = append(status.Parts, chunkedPart{Part: part, Size: size})
+		status.Size += size
+	}
+	sort.Slice(status.Parts, func(i, j int) bool { return status.Parts[i].Part < status.Parts[j].Part })
+	return status, nil
+}
+
+// Abort descarta a sessão e suas partes
+func (c *ChunkedUploads) Abort(id, root, urlPath string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, err := c.session(id, root, urlPath); err != nil {
+		return err
+	}
+	delete(c.sessions, id)
+	return os.RemoveAll(c.sessionDir(id))
+}
+
+// assemble reserva a sessão para montagem e retorna as partes em ordem;
+// faltando alguma entre 1 e a maior recebida, nada muda
+func (c *ChunkedUploads) assemble(id, root, urlPath string) ([]string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	session, err := c.session(id, root, urlPath)
+	if err != nil {
+		return nil, err
+	}
+	if len(session.parts) == 0 {
+		return nil, &uploadError{http.StatusBadRequest, "no parts uploaded"}
+	}
+	last := 0
+	for part := range session.parts {
+		if part > last {
+			last = part
+		}
+	}
+	var files, missing []string
+	for part := 1; part <= last; part++ {
+		if _, ok := session.parts[part]; !ok {
+			missing = append(missing, strconv.Itoa(part))
+			continue
+		}
+		files = append(files, filepath.Join(c.sessionDir(id), strconv.Itoa(part)))
+	}
+	if len(missing) > 0 {
+		return nil, &uploadError{http.StatusBadRequest, "missing parts: " + strings.Join(missing, ", ")}
+	}
+	session.assembling = true
+	return files, nil
+}
+
+// finish encerra a montagem: com sucesso a sessão some, senão volta a
+// aceitar partes
+func (c *ChunkedUploads) finish(id string, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if session, found := c.sessions[id]; found {
+		if !ok {
+			session.assembling = false
+			session.updated = c.now()
+			return
+		}
+		delete(c.sessions, id)
+	}
+	os.RemoveAll(c.sessionDir(id))
+}
+
+// partsReader lê as partes em sequência, abrindo cada uma só quando chega a
+// vez dela: uma sessão pode ter milhares de partes
+type partsReader struct {
+	files []string
+	cur   *os.File
+}
+
+func (p *partsReader) Read(b []byte) (int, error) {
+	for {
+		if p.cur == nil {
+			if len(p.files) == 0 {
+				return 0, io.EOF
+			}
+			f, err := os.Open(p.files[0])
+			if err != nil {
+				return 0, err
+			}
+			p.cur, p.files = f, p.files[1:]
+		}
+		n, err := p.cur.Read(b)
+		if err == io.EOF {
+			p.cur.Close()
+			p.cur = nil
+			if n == 0 {
+				continue
+			}
+			err = nil
+		}
+		return n, err
+	}
+}
+
+// Close fecha a parte em leitura
+func (p *partsReader) Close() error {
+	if p.cur == nil {
+		return nil
+	}
+	err := p.cur.Close()
+	p.cur = nil
+	return err
+}
+
+// sha256Parts calcula o SHA-256 do arquivo montado
+func sha256Parts(files []string) (string, error) {
+	body := &partsReader{files: files}
+	defer body.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, body); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// handleChunkedUpload atende as requisições com ?chunked
+func (s *Server) handleChunkedUpload(w http.ResponseWriter, r *http.Request, urlPath string) {
+	query := r.URL.Query()
+	chunks := s.uploads.chunks
+	root, id := s.requestRoot(r), query.Get("chunked")
+	if strings.HasSuffix(r.URL.Path, "/") {
+		s.serveError(w, r, http.StatusMethodNotAllowed)
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodPost && id == "":
+		name := filepath.Base(filepath.FromSlash(urlPath))
+		if !s.uploads.allowed(name) {
+			s.uploadFailed(w, r, &uploadError{http.StatusUnsupportedMediaType, "file type not allowed: " + name})
+			return
+		}
+		id, err := chunks.Start(root, urlPath)
+		if err != nil {
+			s.uploadFailed(w, r, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, map[string]string{"id": id, "path": escapeURLPath(urlPath)})
+
+	case r.Method == http.MethodPut && id != "":
+		part, err := strconv.Atoi(query.Get("part"))
+		if err != nil {
+			s.uploadFailed(w, r, &uploadError{http.StatusBadRequest, "part must be a number"})
+			return
+		}
+		size, err := chunks.StorePart(id, root, urlPath, part, http.MaxBytesReader(w, r.Body, s.uploads.maxSize()), s.uploads.maxSize())
+		if err != nil {
+			s.uploadFailed(w, r, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, chunkedPart{Part: part, Size: size})
+
+	case r.Method == http.MethodGet && id != "":
+		status, err := chunks.Status(id, root, urlPath)
+		if err != nil {
+			s.uploadFailed(w, r, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, status)
+
+	case r.Method == http.MethodDelete && id != "":
+		if err := chunks.Abort(id, root, urlPath); err != nil {
+			s.uploadFailed(w, r, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	case r.Method == http.MethodPost:
+		s.completeChunkedUpload(w, r, id, urlPath)
+
+	default:
+		s.serveError(w, r, http.StatusMethodNotAllowed)
+	}
+}
+
+// completeChunkedUpload confere o SHA-256 das partes (se informado) e grava o
+// arquivo montado
+func (s *Server) completeChunkedUpload(w http.ResponseWriter, r *http.Request, id, urlPath string) {
+	chunks := s.uploads.chunks
+	files, err := chunks.assemble(id, s.requestRoot(r), urlPath)
+	if err != nil {
+		s.uploadFailed(w, r, err)
+		return
+	}
+	ok := false
+	defer func() { chunks.finish(id, ok) }()
+
+	if want := strings.ToLower(r.URL.Query().Get("sha256")); want != "" {
+		got, err := sha256Parts(files)
+		if err != nil {
+			s.uploadFailed(w, r, err)
+			return
+		}
+		if got != want {
+			s.uploadFailed(w, r, &uploadError{http.StatusBadRequest, "checksum mismatch: got sha256 " + got})
+			return
+		}
+	}
+
+	body := &partsReader{files: files}
+	result, replaced, err := s.storeUpload(r, urlPath, body, true)
+	body.Close()
+	if err != nil {
+		s.uploadFailed(w, r, err)
+		return
+	}
+	ok = true
+	w.Header().Set("Location", result.Path)
+	status := http.StatusCreated
+	if replaced {
+		status = http.StatusOK
+	}
+	writeJSON(w, status, result)
+}
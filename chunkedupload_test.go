@@ -0,0 +1,218 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func chunkedRequest(server *Server, method, path, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	server.mux.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+	return w
+}
+
+func startChunkedUpload(t *testing.T, server *Server, path string) string {
+	t.Helper()
+	w := chunkedRequest(server, "POST", path+"?chunked", "")
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d %s", w.Code, w.Body.String())
+	}
+	var resp struct{ ID string }
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if resp.ID == "" {
+		t.Fatalf("Expected an upload id, got %s", w.Body.String())
+	}
+	return resp.ID
+}
+
+func TestChunkedUpload(t *testing.T) {
+	chunkDir := t.TempDir()
+	server, root := newUploadTestServer(t, func(u *UploadsConfig) {
+		u.Chunked = true
+		u.ChunkDir = chunkDir
+	})
+	parts := []string{strings.Repeat("a", 1000), strings.Repeat("b", 1000), "tail"}
+	whole := strings.Join(parts, "")
+	sum := sha256.Sum256([]byte(whole))
+
+	id := startChunkedUpload(t, server, "/incoming/big.iso")
+
+	// Parts arrive in parallel and out of order
+	var wg sync.WaitGroup
+	for i := len(parts) - 1; i >= 0; i-- {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			w := chunkedRequest(server, "PUT", fmt.Sprintf("/incoming/big.iso?chunked=%s&part=%d", id, i+1), parts[i])
+			if w.Code != http.StatusOK {
+				t.Errorf("Part %d: Expected 200, got %d %s", i+1, w.Code, w.Body.String())
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	w := chunkedRequest(server, "GET", "/incoming/big.iso?chunked="+id, "")
+	var status ChunkedUploadStatus
+	json.Unmarshal(w.Body.Bytes(), &status)
+	if len(status.Parts) != 3 || status.Parts[0].Part != 1 || status.Size != int64(len(whole)) {
+		t.Errorf("Expected 3 parts in order totalling %d bytes, got %s", len(whole), w.Body.String())
+	}
+
+	// A wrong checksum keeps the session so the client can fix the parts
+	w = chunkedRequest(server, "POST", "/incoming/big.iso?chunked="+id+"&sha256="+strings.Repeat("0", 64), "")
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "checksum mismatch") {
+		t.Errorf("Expected 400 checksum mismatch, got %d %s", w.Code, w.Body.String())
+	}
+	if _, err := os.Stat(filepath.Join(root, "incoming", "big.iso")); err == nil {
+		t.Errorf("Expected no file after a checksum mismatch")
+	}
+
+	w = chunkedRequest(server, "POST", "/incoming/big.iso?chunked="+id+"&sha256="+hex.EncodeToString(sum[:]), "")
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d %s", w.Code, w.Body.String())
+	}
+	if data, _ := os.ReadFile(filepath.Join(root, "incoming", "big.iso")); string(data) != whole {
+		t.Errorf("Expected the assembled file, got %d bytes", len(data))
+	}
+	if entries, _ := os.ReadDir(chunkDir); len(entries) != 0 {
+		t.Errorf("Expected parts to be removed, got %d entries", len(entries))
+	}
+
+	// The session is gone after assembly
+	if w := chunkedRequest(server, "GET", "/incoming/big.iso?chunked="+id, ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for a completed session, got %d", w.Code)
+	}
+}
+
+func TestChunkedUploadErrors(t *testing.T) {
+	server, root := newUploadTestServer(t, func(u *UploadsConfig) {
+		u.Chunked = true
+		u.ChunkDir = t.TempDir()
+		u.MaxSize = 1
+		u.MaxChunks = 4
+		u.AllowedExtensions = []string{".bin"}
+	})
+
+	if w := chunkedRequest(server, "POST", "/incoming/file.exe?chunked", ""); w.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("Expected 415 for a disallowed extension, got %d", w.Code)
+	}
+
+	id := startChunkedUpload(t, server, "/incoming/file.bin")
+	for _, tc := range []struct {
+		method, path, body string
+		code               int
+	}{
+		{"PUT", "/incoming/file.bin?chunked=" + id + "&part=5", "x", http.StatusBadRequest},
+		{"PUT", "/incoming/file.bin?chunked=" + id + "&part=x", "x", http.StatusBadRequest},
+		{"PUT", "/incoming/other.bin?chunked=" + id + "&part=1", "x", http.StatusNotFound},
+		{"PUT", "/incoming/file.bin?chunked=unknown&part=1", "x", http.StatusNotFound},
+		{"PUT", "/incoming/file.bin?chunked=" + id + "&part=1", strings.Repeat("x", 600<<10), http.StatusOK},
+		// Parts add up to more than max_size
+		{"PUT", "/incoming/file.bin?chunked=" + id + "&part=2", strings.Repeat("x", 600<<10), http.StatusRequestEntityTooLarge},
+		{"PUT", "/incoming/file.bin?chunked=" + id + "&part=3", "x", http.StatusOK},
+		{"POST", "/incoming/file.bin?chunked=" + id, "", http.StatusBadRequest}, // part 2 missing
+		{"DELETE", "/incoming/file.bin?chunked=" + id, "", http.StatusNoContent},
+		{"PUT", "/incoming/file.bin?chunked=" + id + "&part=2", "x", http.StatusNotFound},
+	} {
+		if w := chunkedRequest(server, tc.method, tc.path, tc.body); w.Code != tc.code {
+			t.Errorf("%s %s: Expected %d, got %d %s", tc.method, tc.path, tc.code, w.Code, w.Body.String())
+		}
+	}
+	if _, err := os.Stat(filepath.Join(root, "incoming", "file.bin")); err == nil {
+		t.Errorf("Expected no file from an aborted session")
+	}
+
+	// Without the option, ?chunked is a plain request
+	plain, _ := newUploadTestServer(t, nil)
+	if w := chunkedRequest(plain, "POST", "/incoming/file.bin?chunked", ""); w.Code == http.StatusCreated && strings.Contains(w.Body.String(), `"id"`) {
+		t.Errorf("Expected chunked uploads to be disabled by default")
+	}
+}
+
+func TestChunkedUploadSweep(t *testing.T) {
+	chunkDir := t.TempDir()
+	chunks, err := NewChunkedUploads(&UploadsConfig{ChunkDir: chunkDir, ChunkTTL: 60})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	chunks.now = func() time.Time { return now }
+
+	// Left behind by a previous run: sessions only live in memory
+	orphan := filepath.Join(chunkDir, strings.Repeat("ab", 16))
+	writeTestFile(t, filepath.Join(orphan, "1"), "stale")
+	// chunk_dir may be shared with other files
+	writeTestFile(t, filepath.Join(chunkDir, "keep", "file"), "keep")
+
+	expired, err := chunks.Start("/root", "/incoming/old.iso")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(2 * time.Minute)
+	active, err := chunks.Start("/root", "/incoming/new.iso")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var removed []string
+	chunks.Sweep(func(path string, info fs.FileInfo) {
+		removed = append(removed, filepath.Base(path))
+		os.RemoveAll(path)
+	})
+	sort.Strings(removed)
+	want := []string{strings.Repeat("ab", 16), expired}
+	sort.Strings(want)
+	if strings.Join(removed, ",") != strings.Join(want, ",") {
+		t.Errorf("Expected %v to be removed, got %v", want, removed)
+	}
+	if _, ok := chunks.sessions[expired]; ok {
+		t.Error("Expected the expired session to be dropped")
+	}
+	for _, name := range []string{active, "keep"} {
+		if _, err := os.Stat(filepath.Join(chunkDir, name)); err != nil {
+			t.Errorf("Expected %s to be kept, got %v", name, err)
+		}
+	}
+}
+
+func TestPartsReaderOpensLazily(t *testing.T) {
+	dir := t.TempDir()
+	var files []string
+	for i, content := range []string{"one", "", "three"} {
+		name := filepath.Join(dir, fmt.Sprint(i+1))
+		writeTestFile(t, name, content)
+		files = append(files, name)
+	}
+
+	// A missing part only fails once the reader gets to it
+	body := &partsReader{files: append(files, filepath.Join(dir, "missing"))}
+	defer body.Close()
+	b := make([]byte, 3)
+	if n, err := body.Read(b); err != nil || string(b[:n]) != "one" {
+		t.Fatalf("Expected the first part, got %q %v", b[:n], err)
+	}
+	if data, err := io.ReadAll(body); err == nil || string(data) != "three" {
+		t.Errorf("Expected the remaining parts and an error, got %q %v", data, err)
+	}
+
+	sum, err := sha256Parts(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := sha256.Sum256([]byte("onethree")); sum != hex.EncodeToString(want[:]) {
+		t.Errorf("Expected the checksum of the joined parts, got %s", sum)
+	}
+}
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// clusterClockSkew diferença máxima aceita no timestamp das requisições entre nós
+const clusterClockSkew = 30 * time.Second
+
+// clusterRetry tempo em que um nó que falhou é ignorado (vale o contador local)
+const clusterRetry = 10 * time.Second
+
+// Cluster distribui as cotas de rate limit entre as instâncias: cada chave
+// tem um dono (rendezvous hashing sobre os nós) que mantém o contador, e os
+// outros nós consultam o dono. Assim o limite vale para o cluster inteiro
+// mesmo com o balanceador espalhando as requisições de um cliente
+type Cluster struct {
+	config  *ClusterConfig
+	logger  *Logger
+	self    string
+	nodes   []string
+	client  *http.Client
+	limiter *RateLimiter // contadores dos quais este nó é dono
+
+	mu       sync.Mutex
+	down     map[string]time.Time // nó -> até quando é ignorado
+	errors   map[string]string
+	requests map[string]int64 // local, remote ou fallback
+}
+
+// clusterRateRequest consulta de cota ao nó dono da chave
+type clusterRateRequest struct {
+	Key      string `json:"key"`
+	Limit    int    `json:"limit,omitempty"`
+	Interval int64  `json:"interval_ms,omitempty"`
+}
+
+// clusterRateStatus estado da cota trocado entre os nós
+type clusterRateStatus struct {
+	Allowed    bool  `json:"allowed"`
+	Limit      int   `json:"limit"`
+	Remaining  int   `json:"remaining"`
+	Reset      int64 `json:"reset_ms"`
+	RetryAfter int64 `json:"retry_after_ms"`
+}
+
+// ClusterNodeStatus estado de um nó na API administrativa
+type ClusterNodeStatus struct {
+	URL       string    `json:"url"`
+	Self      bool      `json:"self,omitempty"`
+	DownUntil time.Time `json:"down_until,omitempty"`
+	LastError string    `json:"last_error,omitempty"`
+}
+
+// NewCluster valida a lista de nós
+func NewCluster(config *ClusterConfig, logger *Logger) (*Cluster, error) {
+	if config.Secret == "" {
+		return nil, errors.New("cluster: secret is required")
+	}
+	if config.Timeout < 0 {
+		return nil, errors.New("cluster: timeout must not be negative")
+	}
+	if route := config.Route; route != "" && !strings.HasPrefix(route, "/") {
+		return nil, fmt.Errorf("cluster: route %q must start with /", route)
+	}
+	self, err := clusterNodeURL(config.Self)
+	if err != nil {
+		return nil, fmt.Errorf("cluster: self: %w", err)
+	}
+	c := &Cluster{
+		config:   config,
+		logger:   logger,
+		self:     self,
+		nodes:    []string{self},
+		down:     make(map[string]time.Time),
+		errors:   make(map[string]string),
+		requests: make(map[string]int64),
+	}
+	for _, node := range config.Nodes {
+		node, err := clusterNodeURL(node)
+		if err != nil {
+			return nil, fmt.Errorf("cluster: nodes: %w", err)
+		}
+		if !containsString(c.nodes, node) {
+			c.nodes = append(c.nodes, node)
+		}
+	}
+	c.client = &http.Client{Timeout: c.timeout()}
+	return c, nil
+}
+
+// clusterNodeURL normaliza a URL base de um nó
+func clusterNodeURL(raw string) (string, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fmt.Errorf("%q is not an http(s) URL", raw)
+	}
+	return strings.TrimSuffix(u.String(), "/"), nil
+}
+
+// containsString indica se s está em list
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// route retorna o prefixo das rotas internas (default: /_cluster)
+func (c *Cluster) route() string {
+	if c.config.Route == "" {
+		return "/_cluster"
+	}
+	return strings.TrimSuffix(c.config.Route, "/")
+}
+
+// timeout retorna o limite de cada consulta a outro nó
+func (c *Cluster) timeout() time.Duration {
+	if c.config.Timeout <= 0 {
+		return 250 * time.Millisecond
+	}
+	return time.Duration(c.config.Timeout) * time.Millisecond
+}
+
+// owner retorna o nó dono da chave (maior hash de nó+chave)
+func (c *Cluster) owner(key string) string {
+	var best string
+	var bestScore uint64
+	for _, node := range c.nodes {
+		h := fnv.New64a()
+		io.WriteString(h, node)
+		h.Write([]byte{0})
+		io.WriteString(h, key)
+		if score := h.Sum64(); best == "" || score > bestScore {
+			best, bestScore = node, score
+		}
+	}
+	return best
+}
+
+// sign assina o corpo de uma requisição entre nós
+func (c *Cluster) sign(timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(c.config.Secret))
+	io.WriteString(mac, timestamp+"\n")
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// verify valida a assinatura e a idade de uma requisição de outro nó
+func (c *Cluster) verify(r *http.Request, body []byte) bool {
+	timestamp := r.Header.Get("X-Qserv-Cluster-Timestamp")
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return false
+	}
+	if skew := time.Since(time.Unix(unix, 0)); skew > clusterClockSkew || skew < -clusterClockSkew {
+		return false
+	}
+	return hmac.Equal([]byte(r.Header.Get("X-Qserv-Cluster-Signature")), []byte(c.sign(timestamp, body)))
+}
+
+// count registra o destino de uma consulta de cota
+func (c *Cluster) count(result string) {
+	c.mu.Lock()
+	c.requests[result]++
+	c.mu.Unlock()
+}
+
+// allow consome um token da chave no nó dono; erro quando o dono não
+// respondeu (o chamador usa o contador local)
+func (c *Cluster) allow(key string, limit int, interval time.Duration) (rateLimitStatus, error) {
+	owner := c.owner(key)
+	if owner == c.self {
+		c.count("local")
+		return c.limiter.allowBucket(key, limit, interval), nil
+	}
+
+	c.mu.Lock()
+	skip := time.Now().Before(c.down[owner])
+	c.mu.Unlock()
+	if skip {
+		c.count("fallback")
+		return rateLimitStatus{}, fmt.Errorf("node %s is down", owner)
+	}
+
+	status, err := c.remoteAllow(owner, key, limit, interval)
+	if err != nil {
+		c.mu.Lock()
+		c.down[owner] = time.Now().Add(clusterRetry)
+		c.errors[owner] = err.Error()
+		c.mu.Unlock()
+		c.count("fallback")
+		c.logger.Warn("Cluster node %s unreachable, using local rate limits for %s: %v", owner, clusterRetry, err)
+		return rateLimitStatus{}, err
+	}
+	c.count("remote")
+	return status, nil
+}
+
+// remoteAllow consulta o dono da chave
+func (c *Cluster) remoteAllow(node, key string, limit int, interval time.Duration) (rateLimitStatus, error) {
+	body, _ := json.Marshal(clusterRateRequest{Key: key, Limit: limit, Interval: interval.Milliseconds()})
+	req, err := http.NewRequest(http.MethodPost, node+c.route()+"/ratelimit", bytes.NewReader(body))
+	if err != nil {
+		return rateLimitStatus{}, err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "qserv")
+	req.Header.Set("X-Qserv-Cluster-Timestamp", timestamp)
+	req.Header.Set("X-Qserv-Cluster-Signature", c.sign(timestamp, body))
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return rateLimitStatus{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return rateLimitStatus{}, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	var remote clusterRateStatus
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&remote); err != nil {
+		return rateLimitStatus{}, err
+	}
+	return rateLimitStatus{
+		allowed:    remote.Allowed,
+		limit:      remote.Limit,
+		remaining:  remote.Remaining,
+		reset:      time.Duration(remote.Reset) * time.Millisecond,
+		retryAfter: time.Duration(remote.RetryAfter) * time.Millisecond,
+	}, nil
+}
+
+// Handler responde as consultas dos outros nós
+func (c *Cluster) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST "+c.route()+"/ratelimit", func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(io.LimitReader(r.Body, 64<<10))
+		if err != nil || !c.verify(r, body) {
+			writeJSONError(w, http.StatusUnauthorized, errors.New("invalid cluster signature"))
+			return
+		}
+		var req clusterRateRequest
+		if err := json.Unmarshal(body, &req); err != nil || req.Key == "" {
+			writeJSONError(w, http.StatusBadRequest, errors.New("missing key"))
+			return
+		}
+		if c.limiter == nil {
+			writeJSONError(w, http.StatusNotFound, errors.New("rate limiting disabled"))
+			return
+		}
+		// Nós sem limit e interval_ms (versões anteriores) usam a cota por IP
+		var status rateLimitStatus
+		if req.Limit > 0 && req.Interval > 0 {
+			status = c.limiter.allowBucket(req.Key, req.Limit, time.Duration(req.Interval)*time.Millisecond)
+		} else {
+			status = c.limiter.allow(req.Key)
+		}
+		writeJSON(w, http.StatusOK, clusterRateStatus{
+			Allowed:    status.allowed,
+			Limit:      status.limit,
+			Remaining:  status.remaining,
+			Reset:      status.reset.Milliseconds(),
+			RetryAfter: status.retryAfter.Milliseconds(),
+		})
+	})
+	return mux
+}
+
+// Status retorna os nós e as falhas recentes
+func (c *Cluster) Status() []ClusterNodeStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	nodes := make([]ClusterNodeStatus, 0, len(c.nodes))
+	for _, node := range c.nodes {
+		status := ClusterNodeStatus{URL: node, Self: node == c.self, LastError: c.errors[node]}
+		if until := c.down[node]; time.Now().Before(until) {
+			status.DownUntil = until
+		}
+		nodes = append(nodes, status)
+	}
+	return nodes
+}
+
+// WriteMetrics exporta as consultas de cota por destino
+func (c *Cluster) WriteMetrics(w io.Writer) {
+	c.mu.Lock()
+	var samples []metricSample
+	for _, result := range []string{"local", "remote", "fallback"} {
+		samples = append(samples, metricSample{labels: map[string]string{"result": result}, value: float64(c.requests[result])})
+	}
+	c.mu.Unlock()
+	writeMetric(w, "qserv_cluster_rate_limit_requests_total", "Rate-limit decisions by where they were taken (fallback: owner node unreachable).", "counter", samples)
+}
+
+// handleAdminCluster lista os nós do cluster
+func (s *Server) handleAdminCluster(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"self":  s.cluster.self,
+		"nodes": s.cluster.Status(),
+	})
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newClusterTestNodes starts two nodes sharing rate-limit state
+func newClusterTestNodes(t *testing.T) ([]*Server, []*httptest.Server) {
+	t.Helper()
+	handlers := make([]http.Handler, 2)
+	listeners := make([]*httptest.Server, 2)
+	for i := range listeners {
+		i := i
+		listeners[i] = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			handlers[i].ServeHTTP(w, r)
+		}))
+		t.Cleanup(listeners[i].Close)
+	}
+	root := t.TempDir()
+	writeTestFile(t, root+"/file.txt", "hello")
+	servers := make([]*Server, 2)
+	for i := range servers {
+		servers[i] = newListingTestServer(t, root, func(c *Config) {
+			c.Security.RateLimit = &RateLimitConfig{Enabled: true, RequestsPerIP: 3}
+			c.Cluster = &ClusterConfig{
+				Enabled: true,
+				Self:    listeners[i].URL,
+				Nodes:   []string{listeners[0].URL, listeners[1].URL + "/"},
+				Secret:  "shared",
+				Timeout: 2000,
+			}
+		})
+		handlers[i] = servers[i].mux
+	}
+	return servers, listeners
+}
+
+func TestClusterSharedRateLimit(t *testing.T) {
+	servers, _ := newClusterTestNodes(t)
+	if servers[0].cluster == nil || len(servers[0].cluster.nodes) != 2 {
+		t.Fatalf("Expected a two-node cluster")
+	}
+
+	// The limit applies across nodes, whichever one receives the request
+	allowed := 0
+	for i := 0; i < 6; i++ {
+		w := httptest.NewRecorder()
+		servers[i%2].mux.ServeHTTP(w, httptest.NewRequest("GET", "/file.txt", nil))
+		if w.Code == http.StatusOK {
+			allowed++
+		}
+	}
+	if allowed != 3 {
+		t.Errorf("Expected 3 requests allowed across the cluster, got %d", allowed)
+	}
+
+	var b strings.Builder
+	servers[0].cluster.WriteMetrics(&b)
+	if !strings.Contains(b.String(), `qserv_cluster_rate_limit_requests_total{result="fallback"} 0`) {
+		t.Errorf("Expected no fallbacks, got %s", b.String())
+	}
+}
+
+func TestClusterOwnerDown(t *testing.T) {
+	servers, listeners := newClusterTestNodes(t)
+	owner := servers[0].cluster.owner("192.0.2.1")
+	other := servers[0]
+	for i, listener := range listeners {
+		if listener.URL == owner {
+			listener.Close()
+			other = servers[1-i]
+		}
+	}
+
+	// The remaining node falls back to its own counters
+	w := httptest.NewRecorder()
+	other.mux.ServeHTTP(w, httptest.NewRequest("GET", "/file.txt", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected local fallback to allow the request, got %d", w.Code)
+	}
+	for _, node := range other.cluster.Status() {
+		if node.URL == owner && (node.LastError == "" || node.DownUntil.IsZero()) {
+			t.Errorf("Expected the unreachable owner to be reported, got %+v", node)
+		}
+	}
+}
+
+func TestClusterSignature(t *testing.T) {
+	servers, _ := newClusterTestNodes(t)
+	req := httptest.NewRequest("POST", "/_cluster/ratelimit", strings.NewReader(`{"key":"192.0.2.1"}`))
+	req.Header.Set("X-Qserv-Cluster-Timestamp", "0")
+	req.Header.Set("X-Qserv-Cluster-Signature", "forged")
+	w := httptest.NewRecorder()
+	servers[0].mux.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 for unsigned cluster request, got %d", w.Code)
+	}
+
+	if _, err := NewCluster(&ClusterConfig{Enabled: true, Self: "http://a:8080"}, nil); err == nil {
+		t.Errorf("Expected cluster without secret to be rejected")
+	}
+}
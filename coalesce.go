@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+// flightGroup junta chamadas simultâneas com a mesma chave em uma única
+// execução (zip montado, busca na origem): quem chega enquanto ela roda
+// espera e recebe o mesmo resultado, evitando o efeito manada após um
+// expurgo do cache
+type flightGroup struct {
+	operation string
+	mu        sync.Mutex
+	calls     map[string]*flightCall
+	led       atomic.Int64 // execuções
+	joined    atomic.Int64 // chamadas atendidas pela execução de outra
+}
+
+// flightCall execução em andamento
+type flightCall struct {
+	done chan struct{}
+	val  interface{}
+	err  error
+}
+
+// newFlightGroup cria o grupo; operation identifica as métricas
+func newFlightGroup(operation string) *flightGroup {
+	return &flightGroup{operation: operation, calls: make(map[string]*flightCall)}
+}
+
+// Do executa fn uma vez por chave. joined indica que o resultado veio da
+// execução iniciada por outra chamada; ctx limita apenas a espera
+func (g *flightGroup) Do(ctx context.Context, key string, fn func() (interface{}, error)) (val interface{}, err error, joined bool) {
+	g.mu.Lock()
+	if call, ok := g.calls[key]; ok {
+		g.mu.Unlock()
+		g.joined.Add(1)
+		select {
+		case <-call.done:
+			return call.val, call.err, true
+		case <-ctx.Done():
+			return nil, ctx.Err(), true
+		}
+	}
+	// Se fn entrar em pânico, quem espera recebe este erro
+	call := &flightCall{done: make(chan struct{}), err: fmt.Errorf("%s: operation aborted", g.operation)}
+	g.calls[key] = call
+	g.mu.Unlock()
+	g.led.Add(1)
+
+	defer func() {
+		g.mu.Lock()
+		delete(g.calls, key)
+		g.mu.Unlock()
+		close(call.done)
+	}()
+	call.val, call.err = fn()
+	return call.val, call.err, false
+}
+
+// flightGroups exporta as métricas de todos os grupos
+type flightGroups []*flightGroup
+
+// WriteMetrics exporta execuções e chamadas agrupadas, somadas por operação
+// (cada espelho pull-through tem seu grupo)
+func (groups flightGroups) WriteMetrics(w io.Writer) {
+	var operations []string
+	led := make(map[string]int64)
+	joined := make(map[string]int64)
+	for _, g := range groups {
+		if _, ok := led[g.operation]; !ok {
+			operations = append(operations, g.operation)
+		}
+		led[g.operation] += g.led.Load()
+		joined[g.operation] += g.joined.Load()
+	}
+	var ledSamples, joinedSamples []metricSample
+	for _, operation := range operations {
+		labels := map[string]string{"operation": operation}
+		ledSamples = append(ledSamples, metricSample{labels: labels, value: float64(led[operation])})
+		joinedSamples = append(joinedSamples, metricSample{labels: labels, value: float64(joined[operation])})
+	}
+	writeMetric(w, "qserv_coalesced_executions_total", "Expensive operations executed on behalf of one or more concurrent requests.", "counter", ledSamples)
+	writeMetric(w, "qserv_coalesced_requests_total", "Requests that waited for an identical operation already in flight instead of repeating it.", "counter", joinedSamples)
+}
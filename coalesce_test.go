@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFlightGroupCoalesces(t *testing.T) {
+	g := newFlightGroup("test")
+	release := make(chan struct{})
+	var runs atomic.Int32
+
+	var wg sync.WaitGroup
+	results := make([]interface{}, 5)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			v, _, _ := g.Do(context.Background(), "key", func() (interface{}, error) {
+				runs.Add(1)
+				<-release
+				return "value", nil
+			})
+			results[i] = v
+		}(i)
+	}
+	// Wait until the followers are queued behind the first call
+	for g.joined.Load() < 4 {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+
+	if runs.Load() != 1 {
+		t.Errorf("Expected one execution, got %d", runs.Load())
+	}
+	for i, v := range results {
+		if v != "value" {
+			t.Errorf("Call %d: expected shared value, got %v", i, v)
+		}
+	}
+
+	// Once finished, the key runs again
+	g.Do(context.Background(), "key", func() (interface{}, error) { runs.Add(1); return nil, nil })
+	if runs.Load() != 2 {
+		t.Errorf("Expected a new execution after completion, got %d", runs.Load())
+	}
+}
+
+func TestFlightGroupWaitHonorsContext(t *testing.T) {
+	g := newFlightGroup("test")
+	release := make(chan struct{})
+	defer close(release)
+	go g.Do(context.Background(), "key", func() (interface{}, error) { <-release; return nil, nil })
+	for g.led.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err, joined := g.Do(ctx, "key", func() (interface{}, error) { return nil, nil })
+	if !joined || err != context.DeadlineExceeded {
+		t.Errorf("Expected the wait to end with the context, got joined=%v err=%v", joined, err)
+	}
+}
+
+func TestPullThroughCoalescesMisses(t *testing.T) {
+	release := make(chan struct{})
+	mirror, hits := newPullThroughTest(t, func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.Header().Set("Cache-Control", "max-age=60")
+		io.WriteString(w, "payload")
+	}, &DiskCacheConfig{Enabled: true})
+
+	var wg sync.WaitGroup
+	recs := make([]*httptest.ResponseRecorder, 8)
+	for i := range recs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			recs[i] = pullThroughGet(mirror, "/mirror/big.iso", nil)
+		}(i)
+	}
+	for mirror.flights.joined.Load() < int64(len(recs)-1) {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+
+	if hits.Load() != 1 {
+		t.Errorf("Expected 1 upstream request for concurrent misses, got %d", hits.Load())
+	}
+	coalesced := 0
+	for i, rec := range recs {
+		if rec.Code != http.StatusOK || rec.Body.String() != "payload" {
+			t.Errorf("Request %d: expected 200 payload, got %d %q", i, rec.Code, rec.Body.String())
+		}
+		if strings.Contains(rec.Header().Get("Cache-Status"), "detail=coalesced") {
+			coalesced++
+		}
+	}
+	if coalesced != len(recs)-1 {
+		t.Errorf("Expected %d coalesced responses, got %d", len(recs)-1, coalesced)
+	}
+}
+
+func TestPullThroughCoalescedUncacheable(t *testing.T) {
+	release := make(chan struct{})
+	mirror, hits := newPullThroughTest(t, func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.Header().Set("Cache-Control", "no-store")
+		io.WriteString(w, "private")
+	}, &DiskCacheConfig{Enabled: true})
+
+	var wg sync.WaitGroup
+	recs := make([]*httptest.ResponseRecorder, 3)
+	for i := range recs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			recs[i] = pullThroughGet(mirror, "/mirror/me", nil)
+		}(i)
+	}
+	for mirror.flights.joined.Load() < 2 {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+
+	// Nothing was stored, so waiting requests fetch their own copy
+	if hits.Load() != 3 {
+		t.Errorf("Expected 3 upstream requests, got %d", hits.Load())
+	}
+	for i, rec := range recs {
+		if rec.Body.String() != "private" {
+			t.Errorf("Request %d: expected private, got %q", i, rec.Body.String())
+		}
+	}
+}
+
+// gateWriter blocks the first write until released
+type gateWriter struct {
+	release chan struct{}
+	once    sync.Once
+	buf     bytes.Buffer
+}
+
+func (g *gateWriter) Write(p []byte) (int, error) {
+	g.once.Do(func() { <-g.release })
+	return g.buf.Write(p)
+}
+
+func TestArchiveCoalescesConcurrentDownloads(t *testing.T) {
+	root := t.TempDir()
+	os.MkdirAll(filepath.Join(root, "docs"), 0755)
+	os.WriteFile(filepath.Join(root, "docs", "a.txt"), bytes.Repeat([]byte("a"), 64*1024), 0644)
+	spool := t.TempDir()
+	server := newListingTestServer(t, root, func(c *Config) {
+		c.Features.Archives = &ArchiveConfig{Enabled: true, SpoolDir: spool}
+	})
+	entries, _, _ := server.archiveEntries(httptest.NewRequest("GET", "/docs/?download=zip", nil), root, filepath.Join(root, "docs"))
+	etag, _ := archiveValidators(entries)
+
+	// The first download is still being built when the others arrive
+	leader := &gateWriter{release: make(chan struct{})}
+	done := make(chan bool)
+	go func() {
+		_, streamed, err := server.archives.Spool(context.Background(), etag, entries, leader)
+		done <- streamed && err == nil
+	}()
+	flights := server.archives.flights
+	for flights.led.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	var wg sync.WaitGroup
+	bodies := make([][]byte, 5)
+	for i := range bodies {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			w := httptest.NewRecorder()
+			server.mux.ServeHTTP(w, httptest.NewRequest("GET", "/docs/?download=zip", nil))
+			if w.Code != http.StatusOK {
+				t.Errorf("Request %d: expected 200, got %d", i, w.Code)
+			}
+			bodies[i] = w.Body.Bytes()
+		}(i)
+	}
+	for flights.joined.Load() < int64(len(bodies)) {
+		time.Sleep(time.Millisecond)
+	}
+	close(leader.release)
+	wg.Wait()
+
+	if !<-done {
+		t.Fatal("Expected the first download to be streamed while spooling")
+	}
+	if flights.led.Load() != 1 {
+		t.Errorf("Expected one archive build, got %d", flights.led.Load())
+	}
+	for i := range bodies {
+		if !bytes.Equal(bodies[i], leader.buf.Bytes()) {
+			t.Errorf("Request %d: expected the same archive bytes as the streamed copy", i)
+		}
+	}
+	if matches, _ := filepath.Glob(filepath.Join(spool, "qserv-archive-*.zip")); len(matches) != 1 {
+		t.Errorf("Expected one spooled archive, got %v", matches)
+	}
+
+	// Later downloads are served from the spooled copy without rebuilding
+	w := httptest.NewRecorder()
+	server.mux.ServeHTTP(w, httptest.NewRequest("GET", "/docs/?download=zip", nil))
+	if !bytes.Equal(w.Body.Bytes(), leader.buf.Bytes()) || flights.led.Load() != 1 {
+		t.Errorf("Expected the spooled archive to be reused")
+	}
+}
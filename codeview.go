@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// CodeView mostra arquivos de código e logs no navegador com destaque de
+// sintaxe e âncoras por linha; ?raw=1 serve o arquivo original
+type CodeView struct {
+	config *CodeViewConfig
+}
+
+// NewCodeView cria a visualização de código
+func NewCodeView(config *CodeViewConfig) *CodeView {
+	return &CodeView{config: config}
+}
+
+// maxSize retorna o maior arquivo exibido com destaque
+func (c *CodeView) maxSize() int64 {
+	if c.config.MaxSize <= 0 {
+		return 1 << 20
+	}
+	return c.config.MaxSize
+}
+
+// Handles informa se o arquivo tem visualização (extensão conhecida, até maxSize)
+func (c *CodeView) Handles(path string, info os.FileInfo) bool {
+	if info.Size() > c.maxSize() {
+		return false
+	}
+	_, ok := syntaxes[strings.ToLower(filepath.Ext(path))]
+	return ok
+}
+
+// Wants informa se a requisição é a navegação de um navegador (Accept:
+// text/html), sem ?raw e sem Range
+func (c *CodeView) Wants(r *http.Request) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	return wantsHTML(r) && !r.URL.Query().Has("raw") && r.Header.Get("Range") == ""
+}
+
+// serveCodeView responde com o arquivo destacado
+func (s *Server) serveCodeView(w http.ResponseWriter, r *http.Request, path string, info os.FileInfo) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		s.serveError(w, r, http.StatusInternalServerError)
+		return
+	}
+	// Conteúdo binário com extensão de texto: serve como está
+	if bytes.IndexByte(data[:min(len(data), 8192)], 0) >= 0 {
+		http.ServeFile(w, r, path)
+		return
+	}
+
+	msg := s.messages(w, r)
+	etag := fmt.Sprintf(`W/"%x-%x-view-%s"`, info.ModTime().Unix(), info.Size(), msg.Lang)
+	w.Header().Set("ETag", etag)
+	if match := r.Header.Get("If-None-Match"); match != "" && etagMatch(match, etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	var code bytes.Buffer
+	lines := writeHighlighted(&code, syntaxes[strings.ToLower(filepath.Ext(path))], string(data))
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Last-Modified", info.ModTime().UTC().Format(http.TimeFormat))
+	if r.Method == http.MethodHead {
+		return
+	}
+	base := filepath.Base(path)
+	err = codeViewTemplate.Execute(w, struct {
+		Theme  *Theme
+		Msg    *Messages
+		Name   string
+		Crumbs []listingCrumb
+		Size   string
+		Lines  int
+		Raw    string
+		Code   template.HTML
+	}{
+		Theme:  s.theme,
+		Msg:    msg,
+		Name:   base,
+		Crumbs: listingCrumbs(strings.TrimSuffix(r.URL.Path, base)),
+		Size:   formatSize(info.Size()),
+		Lines:  lines,
+		Raw:    "?raw=1",
+		Code:   template.HTML(code.String()), // já escapado por writeHighlighted
+	})
+	if err != nil {
+		s.logger.Error("Error rendering code view for %s: %v", path, err)
+	}
+}
+
+// codeViewTemplate página da visualização de código
+var codeViewTemplate = template.Must(template.New("code").Parse(`<!DOCTYPE html>
+<html lang="{{.Msg.Lang}}">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <title>{{.Name}}{{with .Theme.Title}} · {{.}}{{end}}</title>
+    <style>
+        {{.Theme.CSS}}
+        * { margin: 0; padding: 0; box-sizing: border-box; }
+        body {
+            font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, Oxygen, Ubuntu, Cantarell, sans-serif;
+            padding: 2rem;
+            background: var(--qs-bg);
+            color: var(--qs-text);
+        }
+        .container {
+            max-width: 1200px;
+            margin: 0 auto;
+            background: var(--qs-surface);
+            border-radius: 8px;
+            box-shadow: var(--qs-shadow);
+            overflow: hidden;
+        }
+        header {
+            display: flex;
+            flex-wrap: wrap;
+            align-items: center;
+            gap: 1rem;
+            padding: 1rem 2rem;
+            background: var(--qs-header-bg);
+            color: var(--qs-header-text);
+        }
+        header h1 { font-size: 1.25rem; font-weight: 600; word-break: break-all; flex: 1; }
+        header a { color: var(--qs-header-text); text-decoration: none; }
+        header a:hover { opacity: 0.8; }
+        header .sep { opacity: 0.6; margin: 0 0.15rem; }
+        header .meta { opacity: 0.8; font-size: 0.875rem; }
+        header .raw { border: 1px solid var(--qs-header-text); border-radius: 4px; padding: 0.25rem 0.75rem; font-size: 0.875rem; }
+        pre {
+            overflow-x: auto;
+            padding: 1rem 0;
+            font: 0.875rem/1.5 ui-monospace, SFMono-Regular, Menlo, Consolas, monospace;
+        }
+        .line { display: block; padding-right: 1rem; white-space: pre; }
+        .line:target { background: var(--qs-hover); outline: 1px solid var(--qs-accent); }
+        .ln {
+            display: inline-block;
+            width: 4.5rem;
+            padding-right: 1rem;
+            margin-right: 1rem;
+            text-align: right;
+            color: var(--qs-muted);
+            text-decoration: none;
+            border-right: 1px solid var(--qs-border);
+            user-select: none;
+        }
+        .ln:hover { color: var(--qs-accent); }
+        .kw { color: #a626a4; font-weight: 600; }
+        .str { color: #50a14f; }
+        .num { color: #986801; }
+        .com { color: var(--qs-muted); font-style: italic; }
+        .lvl-error, .diff-del { background: rgba(231, 76, 60, 0.12); }
+        .lvl-warn { background: rgba(241, 196, 15, 0.15); }
+        .lvl-debug { color: var(--qs-muted); }
+        .diff-add { background: rgba(46, 204, 113, 0.15); }
+        .diff-hunk { color: var(--qs-accent); }
+        .diff-file { font-weight: 600; }
+        @media (prefers-color-scheme: dark) {
+            .kw { color: #c678dd; }
+            .str { color: #98c379; }
+            .num { color: #d19a66; }
+        }
+        footer {
+            max-width: 1200px;
+            margin: 1rem auto 0;
+            color: var(--qs-muted);
+            font-size: 0.875rem;
+            text-align: center;
+        }
+        @media (max-width: 640px) {
+            body { padding: 0; }
+            .container { border-radius: 0; box-shadow: none; }
+            header { padding: 0.75rem 1rem; }
+            .ln { width: 3rem; padding-right: 0.5rem; margin-right: 0.5rem; }
+        }
+    </style>
+</head>
+<body>
+    <div class="container">
+        <header>
+            {{with .Theme.Logo}}<img src="{{.}}" alt="" style="max-height: 32px">{{end}}
+            <h1>{{range $i, $c := .Crumbs}}<a href="{{$c.Href}}">{{$c.Name}}</a>{{if $i}}<span class="sep">/</span>{{end}}{{end}}{{.Name}}</h1>
+            <span class="meta">{{.Lines}} {{.Msg.T "lines"}} · {{.Size}}</span>
+            <a class="raw" href="{{.Raw}}">{{.Msg.T "Raw"}}</a>
+        </header>
+        <pre><code>{{.Code}}</code></pre>
+    </div>
+    {{with .Theme.Footer}}<footer>{{.}}</footer>{{end}}
+</body>
+</html>`))
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestHighlightGo(t *testing.T) {
+	var b strings.Builder
+	src := "package main\n\n// say hi\nfunc main() {\n\ts := `a\nb` + \"<x>\"\n\tprintln(s, 42)\n}\n"
+	lines := writeHighlighted(&b, syntaxGo, src)
+	out := b.String()
+	if lines != 8 {
+		t.Errorf("Expected 8 lines, got %d", lines)
+	}
+	for _, want := range []string{
+		`<span class="kw">package</span>`,
+		`<span class="com">// say hi</span>`,
+		`<span class="str">&#34;&lt;x&gt;&#34;</span>`,
+		`<span class="num">42</span>`,
+		`id="L7"`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected output to contain %q, got %s", want, out)
+		}
+	}
+	// A raw string spanning lines is closed and reopened on each line
+	if !strings.Contains(out, "<span class=\"str\">`a</span></span>\n<span class=\"line\" id=\"L6\">") {
+		t.Errorf("Expected multi-line string split across lines, got %s", out)
+	}
+}
+
+func TestHighlightLog(t *testing.T) {
+	var b strings.Builder
+	writeHighlighted(&b, syntaxLog, "2024-01-01 INFO started\n2024-01-01 ERROR failed\nplain\n")
+	out := b.String()
+	if !strings.Contains(out, `class="line lvl-info" id="L1"`) || !strings.Contains(out, `class="line lvl-error" id="L2"`) || !strings.Contains(out, `class="line" id="L3"`) {
+		t.Errorf("Unexpected log highlighting: %s", out)
+	}
+}
+
+func TestCodeView(t *testing.T) {
+	root := t.TempDir()
+	writeTestFile(t, filepath.Join(root, "src", "main.go"), "package main\n")
+	writeTestFile(t, filepath.Join(root, "notes.bin.go"), "pack\x00age")
+	server := newListingTestServer(t, root, func(c *Config) {
+		c.Features.CodeView = &CodeViewConfig{Enabled: true}
+	})
+
+	get := func(path, accept string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		w := httptest.NewRecorder()
+		server.mux.ServeHTTP(w, req)
+		return w
+	}
+
+	// Browsers get the rendered view with a raw link
+	w := get("/src/main.go", "text/html,*/*")
+	if !strings.HasPrefix(w.Header().Get("Content-Type"), "text/html") || !strings.Contains(w.Body.String(), `href="?raw=1"`) {
+		t.Fatalf("Expected rendered view, got %s: %s", w.Header().Get("Content-Type"), w.Body.String())
+	}
+	if !strings.Contains(w.Header().Get("Vary"), "Accept") {
+		t.Errorf("Expected Vary: Accept, got %q", w.Header().Get("Vary"))
+	}
+
+	// ?raw=1 and non-browser clients get the file itself
+	for _, w := range []*httptest.ResponseRecorder{get("/src/main.go?raw=1", "text/html"), get("/src/main.go", "")} {
+		if w.Code != http.StatusOK || w.Body.String() != "package main\n" {
+			t.Errorf("Expected raw file, got %d %q", w.Code, w.Body.String())
+		}
+	}
+
+	// Binary content is never rendered
+	if w := get("/notes.bin.go", "text/html"); strings.Contains(w.Body.String(), "<html") {
+		t.Errorf("Expected binary file served as is")
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// compressor encoder de Content-Encoding reutilizável entre respostas
+type compressor interface {
+	io.Writer
+	Flush() error
+	Close() error
+	Reset(w io.Writer)
+}
+
+// compressionEncodings encodings da compressão dinâmica, com o intervalo e
+// o nível padrão de cada um
+var compressionEncodings = map[string]struct {
+	min, max, level int
+	new             func(level int) compressor
+}{
+	"gzip": {1, 9, 6, func(level int) compressor {
+		gz, _ := gzip.NewWriterLevel(io.Discard, level)
+		return gz
+	}},
+	"br":   {0, 11, 5, func(level int) compressor { return newBrotliWriter(level) }},
+	"zstd": {1, 19, 3, func(level int) compressor { return newZstdWriter(level) }},
+}
+
+// defaultCompressionEncodings ordem de preferência quando o cliente aceita
+// mais de um encoding com o mesmo q
+var defaultCompressionEncodings = []string{"br", "zstd", "gzip"}
+
+// Compression encodings habilitados e filtros da compressão dinâmica
+type Compression struct {
+	pools        []*encoderPool // em ordem de preferência
+	minSize      int64
+	contentTypes []string
+}
+
+// NewCompression valida encodings e níveis; level é o compression_level,
+// usado pelo gzip quando levels não o define
+func NewCompression(level int, config *CompressionConfig) (*Compression, error) {
+	if config == nil {
+		config = &CompressionConfig{}
+	}
+	if config.MinSize < 0 {
+		return nil, fmt.Errorf("compression: min_size must not be negative")
+	}
+	for name := range config.Levels {
+		if _, ok := compressionEncodings[name]; !ok {
+			return nil, fmt.Errorf("compression: unknown encoding %q in levels (use gzip, br or zstd)", name)
+		}
+	}
+	names := config.Encodings
+	if len(names) == 0 {
+		names = defaultCompressionEncodings
+	}
+
+	c := &Compression{minSize: config.MinSize}
+	for _, name := range names {
+		enc, ok := compressionEncodings[name]
+		if !ok {
+			return nil, fmt.Errorf("compression: unknown encoding %q (use gzip, br or zstd)", name)
+		}
+		l := enc.level
+		if name == "gzip" {
+			l = level
+		}
+		if v, ok := config.Levels[name]; ok {
+			l = v
+		}
+		if l < enc.min || l > enc.max {
+			return nil, fmt.Errorf("compression: %s level %d out of range (%d-%d)", name, l, enc.min, enc.max)
+		}
+		c.pools = append(c.pools, newEncoderPool(name, l, enc.new))
+	}
+	for _, ct := range config.ContentTypes {
+		c.contentTypes = append(c.contentTypes, strings.ToLower(strings.TrimSpace(ct)))
+	}
+	return c, nil
+}
+
+// negotiate escolhe o encoding de maior q no Accept-Encoding; empates ficam
+// com o primeiro da ordem configurada. nil se nenhum for aceito
+func (c *Compression) negotiate(header string) *encoderPool {
+	accepted := parseAcceptEncoding(header)
+	var best *encoderPool
+	bestQ := 0.0
+	for _, p := range c.pools {
+		if q := accepted.q(p.name); q > bestQ {
+			best, bestQ = p, q
+		}
+	}
+	return best
+}
+
+// eligible aplica os filtros de tamanho e de tipo aos headers da resposta
+func (c *Compression) eligible(h http.Header) bool {
+	if c.minSize > 0 {
+		if n, err := strconv.ParseInt(h.Get("Content-Length"), 10, 64); err == nil && n < c.minSize {
+			return false
+		}
+	}
+	if len(c.contentTypes) == 0 {
+		return true
+	}
+	contentType := strings.ToLower(h.Get("Content-Type"))
+	for _, prefix := range c.contentTypes {
+		if strings.HasPrefix(contentType, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// acceptEncoding q de cada encoding do Accept-Encoding (nomes em minúsculas)
+type acceptEncoding map[string]float64
+
+// parseAcceptEncoding lê o header; sem q vale 1 e q inválido vale 0
+func parseAcceptEncoding(header string) acceptEncoding {
+	accepted := make(acceptEncoding)
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(part, ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		q := 1.0
+		for _, param := range strings.Split(params, ";") {
+			key, value, ok := strings.Cut(param, "=")
+			if !ok || !strings.EqualFold(strings.TrimSpace(key), "q") {
+				continue
+			}
+			v, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if err != nil || v < 0 || v > 1 {
+				v = 0
+			}
+			q = v
+		}
+		accepted[name] = q
+	}
+	return accepted
+}
+
+// q retorna o q do encoding, caindo no de "*" quando ele não é citado
+func (a acceptEncoding) q(name string) float64 {
+	if q, ok := a[name]; ok {
+		return q
+	}
+	return a["*"]
+}
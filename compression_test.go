@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestCompressionNegotiate(t *testing.T) {
+	defaults, err := NewCompression(6, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gzipFirst, err := NewCompression(6, &CompressionConfig{Encodings: []string{"gzip", "zstd"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		compression *Compression
+		header      string
+		expected    string
+	}{
+		{defaults, "gzip, deflate, br, zstd", "br"},
+		{defaults, "gzip;q=1, br;q=0.5", "gzip"},
+		{defaults, "br;q=0, *", "zstd"},
+		{defaults, "GZIP", "gzip"},
+		{defaults, "identity", ""},
+		{defaults, "*;q=0", ""},
+		{defaults, "", ""},
+		{defaults, "br;q=abc, gzip;q=0.1", "gzip"},
+		{defaults, "zstd; q=0.9, gzip; q=0.9", "zstd"},
+		{gzipFirst, "zstd, gzip, br", "gzip"},
+		{gzipFirst, "br", ""},
+	}
+	for _, tt := range tests {
+		name := ""
+		if pool := tt.compression.negotiate(tt.header); pool != nil {
+			name = pool.name
+		}
+		if name != tt.expected {
+			t.Errorf("Accept-Encoding %q: expected %q, got %q", tt.header, tt.expected, name)
+		}
+	}
+}
+
+func TestCompressionFilters(t *testing.T) {
+	handler := CompressionMiddleware(6, &CompressionConfig{MinSize: 100, ContentTypes: []string{"text/", "application/json"}})(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", r.URL.Query().Get("type"))
+			if r.URL.Query().Get("small") != "" {
+				w.Header().Set("Content-Length", "5")
+				w.Write([]byte("small"))
+				return
+			}
+			w.Write([]byte(strings.Repeat("compressible ", 50)))
+		}))
+
+	get := func(target string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", target, nil)
+		req.Header.Set("Accept-Encoding", "gzip, br")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	w := get("/?type=text/html")
+	if w.Header().Get("Content-Encoding") != "br" || w.Header().Get("Vary") != "Accept-Encoding" {
+		t.Errorf("Expected br with Vary, got %q %q", w.Header().Get("Content-Encoding"), w.Header().Get("Vary"))
+	}
+	if w := get("/?type=application/json;+charset=utf-8"); w.Header().Get("Content-Encoding") != "br" {
+		t.Errorf("Expected JSON to be compressed, got %q", w.Header().Get("Content-Encoding"))
+	}
+	if w := get("/?type=image/png"); w.Header().Get("Content-Encoding") != "" {
+		t.Errorf("Expected image/png to be left alone, got %q", w.Header().Get("Content-Encoding"))
+	}
+	w = get("/?type=text/plain&small=1")
+	if w.Header().Get("Content-Encoding") != "" || w.Body.String() != "small" {
+		t.Errorf("Expected response below min_size to be left alone, got %q %q", w.Header().Get("Content-Encoding"), w.Body.String())
+	}
+}
+
+func TestNewCompressionErrors(t *testing.T) {
+	for _, config := range []*CompressionConfig{
+		{Encodings: []string{"deflate"}},
+		{Levels: map[string]int{"lzma": 1}},
+		{Levels: map[string]int{"br": 12}},
+		{Levels: map[string]int{"zstd": 0}},
+		{MinSize: -1},
+	} {
+		if _, err := NewCompression(6, config); err == nil {
+			t.Errorf("Expected error for %+v", config)
+		}
+	}
+}
+
+// decompressWith runs an external decoder over data
+func decompressWith(t *testing.T, data []byte, name string, args ...string) []byte {
+	t.Helper()
+	if _, err := exec.LookPath(name); err != nil {
+		t.Skipf("%s not installed", name)
+	}
+	cmd := exec.Command(name, args...)
+	cmd.Stdin = bytes.NewReader(data)
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("%s failed to decode the stream: %v", name, err)
+	}
+	return out
+}
+
+func TestCompressionEncodersRoundTrip(t *testing.T) {
+	// Text with repeats, a run of one byte and UTF-8 above 0x80
+	var input bytes.Buffer
+	for i := 0; i < 2000; i++ {
+		input.WriteString("func (s *Server) serveFile(w http.ResponseWriter, r *http.Request) // ação número ")
+		input.WriteString(strings.Repeat("x", i%7))
+		input.WriteByte(byte('a' + i%26))
+	}
+	input.Write(bytes.Repeat([]byte{0}, 100000))
+	data := input.Bytes()
+
+	encode := func(c compressor) []byte {
+		var out bytes.Buffer
+		c.Reset(&out)
+		// Uneven writes with a flush in the middle, like a streamed response
+		c.Write(data[:1000])
+		c.Flush()
+		c.Write(data[1000:70000])
+		c.Write(data[70000:])
+		c.Close()
+		if out.Len() >= len(data)/2 {
+			t.Errorf("Expected at least 2:1 compression, got %d -> %d", len(data), out.Len())
+		}
+		return out.Bytes()
+	}
+
+	t.Run("zstd", func(t *testing.T) {
+		got := decompressWith(t, encode(newZstdWriter(3)), "zstd", "-d", "-c")
+		if !bytes.Equal(got, data) {
+			t.Errorf("Expected zstd round trip, got %d bytes", len(got))
+		}
+	})
+	t.Run("br", func(t *testing.T) {
+		got := decompressWith(t, encode(newBrotliWriter(5)), "node", "-e",
+			"process.stdout.write(require('zlib').brotliDecompressSync(require('fs').readFileSync(0)))")
+		if !bytes.Equal(got, data) {
+			t.Errorf("Expected brotli round trip, got %d bytes", len(got))
+		}
+	})
+}
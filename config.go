@@ -8,36 +8,126 @@ import (
 
 // Config representa a configuração completa do servidor
 type Config struct {
-	Server        ServerConfig        `json:"server"`
-	Security      SecurityConfig      `json:"security"`
-	Performance   PerformanceConfig   `json:"performance"`
-	Logging       LoggingConfig       `json:"logging"`
-	Features      FeaturesConfig      `json:"features"`
+	Server        ServerConfig         `json:"server"`
+	Security      SecurityConfig       `json:"security"`
+	Performance   PerformanceConfig    `json:"performance"`
+	Logging       LoggingConfig        `json:"logging"`
+	Features      FeaturesConfig       `json:"features"`
 	RuntimeConfig *RuntimeConfigConfig `json:"runtime_config,omitempty"`
+	Admin         *AdminConfig         `json:"admin,omitempty"`
+	Git           *GitSourceConfig     `json:"git,omitempty"`
+	Deploy        *DeployConfig        `json:"deploy,omitempty"`
+	Integrity     *IntegrityConfig     `json:"integrity,omitempty"`
+	PullThrough   []PullThroughConfig  `json:"pull_through,omitempty"`
+	Proxy         []ProxyConfig        `json:"proxy,omitempty"`
+	Stats         *StatsConfig         `json:"stats,omitempty"`
+	WellKnown     *WellKnownConfig     `json:"well_known,omitempty"`
+	Mirrors       *MirrorConfig        `json:"mirrors,omitempty"`
+	Janitor       *JanitorConfig       `json:"janitor,omitempty"`
+	Jobs          *JobsConfig          `json:"jobs,omitempty"`
+	Index         *IndexConfig         `json:"index,omitempty"`
+	Feeds         *FeedsConfig         `json:"feeds,omitempty"`
+	FileWebhooks  *FileWebhooksConfig  `json:"file_webhooks,omitempty"`
+	FTP           *FTPConfig           `json:"ftp,omitempty"`
+	FileAPI       *FileAPIConfig       `json:"file_api,omitempty"`
+	Registry      *RegistryConfig      `json:"registry,omitempty"`
+	GoProxy       *GoProxyConfig       `json:"go_proxy,omitempty"`
+	PyPI          *PyPIConfig          `json:"pypi,omitempty"`
+	Npm           *NpmConfig           `json:"npm,omitempty"`
+	Maven         *MavenConfig         `json:"maven,omitempty"`
+	Probe         *ProbeConfig         `json:"probe,omitempty"`
+	Cluster       *ClusterConfig       `json:"cluster,omitempty"`
+	Redis         *RedisConfig         `json:"redis,omitempty"`
+	Tunnel        *TunnelConfig        `json:"tunnel,omitempty"`
+	Tailscale     *TailscaleConfig     `json:"tailscale,omitempty"`
+	Reload        *ReloadConfig        `json:"reload,omitempty"`
+	VHosts        []VHostConfig        `json:"vhosts,omitempty"`
 }
 
 // ServerConfig configurações básicas do servidor
 type ServerConfig struct {
-	Port         int    `json:"port"`
-	Host         string `json:"host"`
-	RootDir      string `json:"root_dir"`
-	ReadTimeout  int    `json:"read_timeout"`   // segundos
-	WriteTimeout int    `json:"write_timeout"`  // segundos
+	Port         int      `json:"port"`
+	Host         string   `json:"host"`
+	Hosts        []string `json:"hosts,omitempty"` // múltiplos endereços (substitui host)
+	IPFamily     string   `json:"ip_family"`       // auto, ipv4, ipv6 ou both (default: auto)
+	RootDir      string   `json:"root_dir"`
+	ReadTimeout  int      `json:"read_timeout"`  // segundos
+	WriteTimeout int      `json:"write_timeout"` // segundos
+	// Segundos para as requisições em andamento terminarem ao encerrar (default: 30)
+	ShutdownTimeout int `json:"shutdown_timeout"`
+	// Compartilhamento em rede local: restringe o Host aos endereços da máquina
+	// e os clientes a faixas privadas (allowed_hosts/ip_whitelist sobrescrevem)
+	LANShare bool `json:"lan_share"`
+	// Pede ao roteador (NAT-PMP ou UPnP) o mapeamento da porta e mostra a URL externa
+	PortMapping bool `json:"port_mapping"`
 }
 
 // SecurityConfig configurações de segurança
 type SecurityConfig struct {
-	EnableHTTPS      bool              `json:"enable_https"`
-	CertFile         string            `json:"cert_file"`
-	KeyFile          string            `json:"key_file"`
-	BasicAuth        *BasicAuthConfig  `json:"basic_auth,omitempty"`
-	CORS             *CORSConfig       `json:"cors,omitempty"`
-	RateLimit        *RateLimitConfig  `json:"rate_limit,omitempty"`
-	IPWhitelist      []string          `json:"ip_whitelist,omitempty"`
-	IPBlacklist      []string          `json:"ip_blacklist,omitempty"`
-	BlockHiddenFiles bool              `json:"block_hidden_files"`
-	AllowedPaths     []string          `json:"allowed_paths,omitempty"`
-	BlockedPaths     []string          `json:"blocked_paths,omitempty"`
+	EnableHTTPS       bool                  `json:"enable_https"`
+	CertFile          string                `json:"cert_file"`
+	KeyFile           string                `json:"key_file"`
+	BasicAuth         *BasicAuthConfig      `json:"basic_auth,omitempty"`
+	CORS              *CORSConfig           `json:"cors,omitempty"`
+	RateLimit         *RateLimitConfig      `json:"rate_limit,omitempty"`
+	IPWhitelist       []string              `json:"ip_whitelist,omitempty"`
+	IPBlacklist       []string              `json:"ip_blacklist,omitempty"`
+	BlockHiddenFiles  bool                  `json:"block_hidden_files"`
+	StrictPaths       bool                  `json:"strict_paths"` // rejeita caminhos não canônicos ou ambíguos
+	Challenge         *ChallengeConfig      `json:"challenge,omitempty"`
+	RequestFilter     *RequestFilterConfig  `json:"request_filter,omitempty"`
+	AllowedHosts      []string              `json:"allowed_hosts,omitempty"`       // hosts aceitos no header Host (ex: example.com, *.example.com)
+	UnknownHostStatus int                   `json:"unknown_host_status,omitempty"` // status para outros hosts (default: 421)
+	TimeWindows       []TimeWindowRule      `json:"time_windows,omitempty"`
+	AllowedPaths      []string              `json:"allowed_paths,omitempty"`
+	BlockedPaths      []string              `json:"blocked_paths,omitempty"`
+	CertMonitor       *CertMonitorConfig    `json:"cert_monitor,omitempty"` // ajustes do monitor de validade (ativo sempre que HTTPS está habilitado)
+	ProxyAuth         *ProxyAuthConfig      `json:"proxy_auth,omitempty"`
+	OCSPStapling      *OCSPStaplingConfig   `json:"ocsp_stapling,omitempty"`
+	ECH               *ECHConfig            `json:"ech,omitempty"`
+	SessionTickets    *SessionTicketsConfig `json:"session_tickets,omitempty"`
+	Hotlink           *HotlinkConfig        `json:"hotlink,omitempty"`
+	SignedCookies     *SignedCookiesConfig  `json:"signed_cookies,omitempty"`
+}
+
+// TimeWindowRule libera (allow) ou bloqueia (deny) caminhos conforme o
+// horário; a janela vale quando todas as condições informadas são atendidas
+type TimeWindowRule struct {
+	Paths    []string `json:"paths"`              // globs (ex: /provas/**)
+	Action   string   `json:"action"`             // allow (só dentro da janela) ou deny (bloqueia dentro da janela)
+	Timezone string   `json:"timezone,omitempty"` // IANA, ex: America/Sao_Paulo (default: local)
+	After    string   `json:"after,omitempty"`    // "2006-01-02 15:04" ou RFC 3339
+	Before   string   `json:"before,omitempty"`
+	Days     []string `json:"days,omitempty"`   // mon, tue, wed, thu, fri, sat, sun
+	Hours    string   `json:"hours,omitempty"`  // ex: 08:00-18:00 (pode cruzar a meia-noite)
+	Status   int      `json:"status,omitempty"` // status fora do permitido (default: 404)
+}
+
+// ProxyAuthConfig identidade vinda de um proxy de autenticação (oauth2-proxy,
+// Authelia); os headers de outros clientes são descartados
+type ProxyAuthConfig struct {
+	Enabled        bool           `json:"enabled"`
+	TrustedProxies []string       `json:"trusted_proxies"`          // IPs ou CIDRs dos proxies
+	UserHeaders    []string       `json:"user_headers,omitempty"`   // default: Remote-User, X-Auth-Request-User, X-Forwarded-User
+	EmailHeaders   []string       `json:"email_headers,omitempty"`  // default: X-Auth-Request-Email, Remote-Email, X-Forwarded-Email
+	GroupsHeaders  []string       `json:"groups_headers,omitempty"` // default: Remote-Groups, X-Auth-Request-Groups, X-Forwarded-Groups
+	Required       bool           `json:"required"`                 // recusa (401) requisições sem identidade
+	ACL            []ProxyACLRule `json:"acl,omitempty"`            // a primeira regra que casa com o caminho decide
+}
+
+// ProxyACLRule restringe um caminho a usuários ou grupos
+type ProxyACLRule struct {
+	Path   string   `json:"path"`             // glob (ex: /financeiro/**)
+	Users  []string `json:"users,omitempty"`  // usuários ou e-mails, com globs (ex: *@example.com)
+	Groups []string `json:"groups,omitempty"` // grupos aceitos
+}
+
+// CertMonitorConfig limites e alertas de expiração do certificado
+type CertMonitorConfig struct {
+	WarnDays []int  `json:"warn_days,omitempty"` // dias antes da expiração em que avisa (default: 30, 14, 7, 1)
+	Interval int    `json:"interval,omitempty"`  // segundos entre verificações (default: 3600)
+	Webhook  string `json:"webhook,omitempty"`   // URL que recebe um POST JSON a cada limite cruzado
+	Secret   string `json:"secret,omitempty"`    // assina o corpo (X-Qserv-Signature-256)
 }
 
 // BasicAuthConfig autenticação básica
@@ -60,19 +150,179 @@ type CORSConfig struct {
 
 // RateLimitConfig limitação de taxa
 type RateLimitConfig struct {
-	Enabled       bool `json:"enabled"`
-	RequestsPerIP int  `json:"requests_per_ip"` // requisições por minuto
-	BurstSize     int  `json:"burst_size"`
+	Enabled       bool            `json:"enabled"`
+	RequestsPerIP int             `json:"requests_per_ip"` // requisições por minuto (0 = só as regras)
+	BurstSize     int             `json:"burst_size"`
+	Rules         []RateLimitRule `json:"rules,omitempty"` // cotas adicionais por caminho, usuário ou globais
+}
+
+// RateLimitRule cota token bucket para um conjunto de caminhos, independente
+// da cota por IP; todas as regras que casam com a requisição são aplicadas.
+// Os contadores são locais a esta instância
+type RateLimitRule struct {
+	Paths    []string `json:"paths,omitempty"` // globs (ex: /downloads/**; vazio = todos os caminhos)
+	Key      string   `json:"key,omitempty"`   // ip (default), user (usuário autenticado; anônimos contam pelo IP) ou global
+	Requests int      `json:"requests"`        // requisições por minuto
+	Burst    int      `json:"burst,omitempty"` // default: requests
+}
+
+// RequestFilterConfig regras para rejeitar requisições (scanners, métodos indesejados)
+type RequestFilterConfig struct {
+	Enabled      bool               `json:"enabled"`
+	DenyMethods  []string           `json:"deny_methods"`   // ex: TRACE, CONNECT
+	MethodStatus int                `json:"method_status"`  // default: 405
+	MaxURLLength int                `json:"max_url_length"` // 0 = sem limite
+	URLStatus    int                `json:"url_status"`     // default: 414
+	RequireHost  bool               `json:"require_host"`
+	HostStatus   int                `json:"host_status"` // default: 400
+	Headers      []HeaderFilterRule `json:"headers"`
+}
+
+// HeaderFilterRule rejeita requisições cujo header casa com a expressão
+// regular (ou que não trazem o header, com missing)
+type HeaderFilterRule struct {
+	Header  string `json:"header"`
+	Pattern string `json:"pattern"`
+	Missing bool   `json:"missing"`
+	Status  int    `json:"status"` // default: 403
+}
+
+// ChallengeConfig desafio captcha (hCaptcha/Turnstile) para clientes abusivos
+type ChallengeConfig struct {
+	Enabled        bool     `json:"enabled"`
+	Provider       string   `json:"provider"` // turnstile ou hcaptcha
+	SiteKey        string   `json:"site_key"`
+	Secret         string   `json:"secret"`
+	Route          string   `json:"route"`            // default: /_challenge
+	CookieSecret   string   `json:"cookie_secret"`    // chave HMAC do cookie (aleatória se vazia)
+	CookieTTL      int      `json:"cookie_ttl"`       // segundos de isenção após o desafio (default: 3600)
+	OnRateLimit    bool     `json:"on_rate_limit"`    // desafia em vez de responder 429
+	UserAgents     []string `json:"user_agents"`      // trechos de User-Agent tratados como bots
+	EmptyUserAgent bool     `json:"empty_user_agent"` // desafia requisições sem User-Agent
 }
 
 // PerformanceConfig configurações de performance
 type PerformanceConfig struct {
-	EnableCompression bool              `json:"enable_compression"`
-	CompressionLevel  int               `json:"compression_level"` // 1-9
-	EnableCache       bool              `json:"enable_cache"`
-	CacheMaxAge       int               `json:"cache_max_age"` // segundos
-	EnableETags       bool              `json:"enable_etags"`
-	CustomHeaders     map[string]string `json:"custom_headers,omitempty"`
+	EnableCompression bool                   `json:"enable_compression"`
+	CompressionLevel  int                    `json:"compression_level"` // 1-9
+	Compression       *CompressionConfig     `json:"compression,omitempty"`
+	EnableCache       bool                   `json:"enable_cache"`
+	CacheMaxAge       int                    `json:"cache_max_age"` // segundos
+	EnableETags       bool                   `json:"enable_etags"`
+	CustomHeaders     map[string]string      `json:"custom_headers,omitempty"`
+	NegativeCache     *NegativeCacheConfig   `json:"negative_cache,omitempty"`
+	MinTransferRate   *MinTransferRateConfig `json:"min_transfer_rate,omitempty"`
+	Connections       *ConnectionConfig      `json:"connections,omitempty"`
+	Precompress       *PrecompressConfig     `json:"precompress,omitempty"`
+	MemoryCache       *MemoryCacheConfig     `json:"memory_cache,omitempty"`
+	ServeSidecars     bool                   `json:"serve_sidecars"` // serve app.js.br/app.js.gz gerados pelo build quando o cliente aceita
+	ETag              *ETagConfig            `json:"etag,omitempty"`
+	HostLimits        []HostLimitConfig      `json:"host_limits,omitempty"`
+	Throttle          *ThrottleConfig        `json:"throttle,omitempty"`
+	DiskIO            *DiskIOConfig          `json:"disk_io,omitempty"`
+	IOURing           *IOURingConfig         `json:"io_uring,omitempty"`
+}
+
+// HostLimitConfig limites de um grupo de hosts num servidor compartilhado;
+// vale a primeira regra cujo padrão casa com o Host. A espera pela banda
+// conta para min_transfer_rate
+type HostLimitConfig struct {
+	Name           string   `json:"name,omitempty"`             // label nas métricas (default: o primeiro host)
+	Hosts          []string `json:"hosts"`                      // padrões como em allowed_hosts (ex: *.example.com)
+	MaxConcurrent  int      `json:"max_concurrent,omitempty"`   // requisições simultâneas (0 = sem limite)
+	QueueTimeout   int      `json:"queue_timeout,omitempty"`    // segundos esperando uma vaga antes do 503 (default: não espera)
+	BytesPerSecond int      `json:"bytes_per_second,omitempty"` // banda de saída somando todas as respostas do grupo (0 = sem limite)
+}
+
+// ThrottleConfig banda de saída das respostas, por conexão e somando as
+// respostas simultâneas de cada IP; vale a primeira regra que casar com o
+// caminho e, sem regra, os limites globais. A espera pela banda conta para
+// min_transfer_rate
+type ThrottleConfig struct {
+	Enabled        bool           `json:"enabled"`
+	ConnectionRate int64          `json:"connection_rate,omitempty"` // bytes por segundo de cada resposta (0 = sem limite)
+	ClientRate     int64          `json:"client_rate,omitempty"`     // bytes por segundo somando as respostas de um IP (0 = sem limite)
+	Rules          []ThrottleRule `json:"rules,omitempty"`
+}
+
+// ThrottleRule limites para um conjunto de caminhos; sem nenhum dos dois, os
+// caminhos ficam isentos
+type ThrottleRule struct {
+	Paths          []string `json:"paths"` // globs (ex: /isos/**)
+	ConnectionRate int64    `json:"connection_rate,omitempty"`
+	ClientRate     int64    `json:"client_rate,omitempty"`
+}
+
+// ETagConfig estratégia de ETag (com enable_etags ligado): mtime+tamanho
+// (rápido), hash do conteúdo (forte) ou nenhum, com exceções por caminho
+type ETagConfig struct {
+	Algorithm string     `json:"algorithm"`       // mtime (default), hash ou none
+	Weak      bool       `json:"weak"`            // emite W/"..."
+	Rules     []ETagRule `json:"rules,omitempty"` // vale a primeira regra que casar
+}
+
+// ETagRule estratégia para um conjunto de caminhos
+type ETagRule struct {
+	Paths     []string `json:"paths"` // globs (ex: /videos/**)
+	Algorithm string   `json:"algorithm"`
+	Weak      bool     `json:"weak"`
+}
+
+// CompressionConfig encodings e filtros da compressão dinâmica (com
+// enable_compression ligado); o encoding vem do Accept-Encoding do cliente e,
+// em empates de q, vale a ordem de encodings
+type CompressionConfig struct {
+	Encodings    []string       `json:"encodings,omitempty"`     // gzip, br e zstd (default: br, zstd, gzip)
+	Levels       map[string]int `json:"levels,omitempty"`        // por encoding: gzip 1-9, br 0-11, zstd 1-19 (default: compression_level, 5 e 3)
+	MinSize      int64          `json:"min_size,omitempty"`      // bytes; respostas com Content-Length menor seguem sem compressão
+	ContentTypes []string       `json:"content_types,omitempty"` // prefixos de Content-Type comprimidos (ex: text/, application/json; default: todos)
+}
+
+// MemoryCacheConfig cache em memória de arquivos pequenos e das suas versões
+// comprimidas, com eviction LRU; uma entrada vale enquanto o arquivo mantiver
+// mtime e tamanho
+type MemoryCacheConfig struct {
+	Enabled     bool  `json:"enabled"`
+	MaxSize     int64 `json:"max_size"`      // bytes somando todas as entradas (default: 64 MiB)
+	MaxFileSize int64 `json:"max_file_size"` // bytes; arquivos maiores são lidos do disco (default: 1 MiB)
+	TTL         int   `json:"ttl"`           // segundos desde a leitura do disco (default: 300)
+}
+
+// PrecompressConfig gera versões gzip dos arquivos em segundo plano (na
+// inicialização e a cada troca de raiz) para servir sem comprimir por requisição
+type PrecompressConfig struct {
+	Enabled    bool     `json:"enabled"`
+	Dir        string   `json:"dir"`        // default: .qserv-precompressed
+	Workers    int      `json:"workers"`    // default: número de CPUs
+	Extensions []string `json:"extensions"` // default: .html, .css, .js, .json, .svg, ...
+	MinSize    int64    `json:"min_size"`   // bytes (default: 1024)
+	Interval   int      `json:"interval"`   // segundos entre varreduras (0 = só na inicialização e em trocas de raiz)
+}
+
+// ConnectionConfig ajustes de keep-alive e de sockets (zero mantém o padrão do Go)
+type ConnectionConfig struct {
+	DisableKeepAlive   bool `json:"disable_keep_alive"`
+	IdleTimeout        int  `json:"idle_timeout"`          // segundos (default: read_timeout)
+	MaxRequestsPerConn int  `json:"max_requests_per_conn"` // 0 = sem limite
+	TCPKeepAlive       int  `json:"tcp_keep_alive"`        // segundos; -1 desativa
+	DisableNoDelay     bool `json:"disable_no_delay"`      // habilita o algoritmo de Nagle
+	ReadBuffer         int  `json:"read_buffer"`           // SO_RCVBUF em bytes
+	WriteBuffer        int  `json:"write_buffer"`          // SO_SNDBUF em bytes
+}
+
+// MinTransferRateConfig aborta respostas para clientes que leem abaixo da taxa
+// mínima durante a janela (substitui o write_timeout fixo)
+type MinTransferRateConfig struct {
+	Enabled        bool `json:"enabled"`
+	BytesPerSecond int  `json:"bytes_per_second"` // default: 1024
+	Window         int  `json:"window"`           // segundos (default: 30)
+}
+
+// NegativeCacheConfig cache de respostas 404 (evita stats repetidos em caminhos inexistentes)
+type NegativeCacheConfig struct {
+	Enabled    bool `json:"enabled"`
+	TTL        int  `json:"ttl"`         // segundos (default: 10)
+	MaxEntries int  `json:"max_entries"` // default: 10000
 }
 
 // LoggingConfig configurações de logs
@@ -83,37 +333,368 @@ type LoggingConfig struct {
 	ErrorLog    bool   `json:"error_log"`
 	LogFile     string `json:"log_file,omitempty"`
 	ColorOutput bool   `json:"color_output"`
+	// Header X-Qserv-Debug com o caminho da requisição pelo servidor
+	DebugHeader *DebugHeaderConfig `json:"debug_header,omitempty"`
+	// Trace das chamadas aos upstreams (pull-through)
+	Tracing *TracingConfig `json:"tracing,omitempty"`
+	// Registro das respostas que quebram a retomada de downloads
+	ResumeAudit *ResumeAuditConfig `json:"resume_audit,omitempty"`
+}
+
+// TracingConfig propaga traceparent/tracestate (W3C Trace Context) aos
+// upstreams e mede DNS, conexão, TLS e primeiro byte de cada chamada
+// (métricas qserv_upstream_* e, no X-Qserv-Debug, upstream.*)
+type TracingConfig struct {
+	Enabled  bool `json:"enabled"`
+	LogSpans bool `json:"log_spans"` // registra cada chamada no log, com trace_id e os tempos
+}
+
+// ResumeAuditConfig auditoria da retomada de downloads: registra no log
+// (uma vez por caminho), nas métricas e em GET /_admin/resume-audit as
+// respostas com ETag instável, sem Accept-Ranges, com ranges sobre corpo
+// comprimido ou que ignoram o Range. Na inicialização, avisa das
+// combinações da configuração que causam esses problemas
+type ResumeAuditConfig struct {
+	Enabled bool  `json:"enabled"`
+	MinSize int64 `json:"min_size,omitempty"` // bytes; respostas completas menores são ignoradas (default: 1 MiB)
+}
+
+// DebugHeaderConfig header de diagnóstico para clientes autorizados: quem
+// enviar X-Qserv-Debug com o token (ou vier de um IP permitido) recebe na
+// resposta o mount/backend, o estado do cache, a compressão e os tempos
+type DebugHeaderConfig struct {
+	Enabled    bool     `json:"enabled"`
+	Token      string   `json:"token,omitempty"`
+	AllowedIPs []string `json:"allowed_ips,omitempty"`
 }
 
 // FeaturesConfig funcionalidades adicionais
 type FeaturesConfig struct {
-	DirectoryListing bool     `json:"directory_listing"`
-	IndexFiles       []string `json:"index_files"`
-	SPAMode          bool     `json:"spa_mode"` // redireciona tudo para index.html
-	SPAIndex         string   `json:"spa_index"`
+	DirectoryListing bool              `json:"directory_listing"`
+	IndexFiles       []string          `json:"index_files"`
+	SPAMode          bool              `json:"spa_mode"` // redireciona tudo para index.html
+	SPAIndex         string            `json:"spa_index"`
 	CustomErrorPages map[string]string `json:"custom_error_pages,omitempty"`
+	// Normalização Unicode de caminhos e nomes no disco: "", "nfc" ou "nfd"
+	UnicodeNormalization string `json:"unicode_normalization,omitempty"`
+	// Resolve caminhos sem distinção de maiúsculas (com redirect para a grafia correta)
+	CaseInsensitive bool `json:"case_insensitive"`
+	// Entradas por página da listagem de diretórios (default: 10000)
+	ListingMaxEntries int `json:"listing_max_entries,omitempty"`
+	// Publicação e expiração programadas de conteúdo
+	Schedule *ScheduleConfig `json:"schedule,omitempty"`
+	// Entradas ocultas e fixadas no topo das listagens
+	Listing *ListingConfig `json:"listing,omitempty"`
+	// Identidade visual das páginas embutidas (listagens, erros, desafio)
+	Theme *ThemeConfig `json:"theme,omitempty"`
+	// Código e logs com destaque de sintaxe no navegador
+	CodeView *CodeViewConfig `json:"code_view,omitempty"`
+	// Acompanhamento de logs no navegador (?follow=1), como tail -f
+	Tail *TailConfig `json:"tail,omitempty"`
+	// Trechos de arquivos de texto por linha (?lines=1000-2000, ?tail=500)
+	TextSlices *TextSlicesConfig `json:"text_slices,omitempty"`
+	// Uso de disco por diretório (?du=1)
+	DiskUsage *DiskUsageConfig `json:"disk_usage,omitempty"`
+	// Idioma das páginas embutidas: en, pt, es, fr, de ou it ("" = pelo Accept-Language)
+	Language string `json:"language,omitempty"`
+	// Caminhos removidos, respondidos com 410 Gone
+	Tombstones *TombstoneConfig `json:"tombstones,omitempty"`
+	// Download de diretórios como arquivo (?download=zip ou ?download=tar.gz)
+	Archives *ArchiveConfig `json:"archives,omitempty"`
+	// Geração de .torrent e Metalink para arquivos grandes
+	Torrents *TorrentConfig `json:"torrents,omitempty"`
+	// Arquivos de controle .zsync para atualização por blocos
+	Zsync *ZsyncConfig `json:"zsync,omitempty"`
+	// Diretórios que são repositórios apt ou yum
+	PackageRepos *PackageReposConfig `json:"package_repos,omitempty"`
+	// Arquivos servidos pelo hash do conteúdo (/=/<sha256>)
+	ContentAddress *ContentAddressConfig `json:"content_address,omitempty"`
+	// Versões anteriores dos arquivos sobrescritos por escritas
+	Versioning *VersioningConfig `json:"versioning,omitempty"`
+	// Limites de espaço e de arquivos por prefixo para as escritas
+	Quotas []QuotaRule `json:"quotas,omitempty"`
+	// Upload de arquivos (PUT e POST multipart) sob prefixos
+	Uploads *UploadsConfig `json:"uploads,omitempty"`
+	// Acesso WebDAV à raiz (montagem no Finder, Explorer ou davfs2)
+	WebDAV *WebDAVConfig `json:"webdav,omitempty"`
+	// Bytes por requisição e por cliente a cada hora em caminhos tarifados
+	DownloadLimits []DownloadLimitRule `json:"download_limits,omitempty"`
+	// Sessões de download retomáveis por token, independentes do IP do cliente
+	DownloadSessions *DownloadSessionsConfig `json:"download_sessions,omitempty"`
+}
+
+// ListingConfig curadoria das listagens de diretório sem mover arquivos.
+// Padrões com "/" casam com o caminho da URL (ex: /releases/*/*.sha256), os
+// demais só com o nome (ex: README*); "/" no fim restringe a diretórios.
+type ListingConfig struct {
+	Hide []ListingHideRule `json:"hide,omitempty"`
+	Pin  []string          `json:"pin,omitempty"` // entradas fixadas no topo, na ordem (ex: LATEST/, README*)
+}
+
+// ThemeConfig tema das páginas embutidas. As cores são variáveis CSS
+// (bg, surface, text, muted, accent, accent-hover, header-bg, header-text,
+// subheader-bg, border, hover, shadow) com valores separados para o modo
+// claro e o escuro; com tema configurado, navegadores recebem as páginas de
+// erro em HTML.
+type ThemeConfig struct {
+	Title       string            `json:"title,omitempty"`        // nome exibido no cabeçalho e no <title>
+	Logo        string            `json:"logo,omitempty"`         // URL da logo (ex: /assets/logo.svg)
+	Footer      string            `json:"footer,omitempty"`       // texto do rodapé
+	ColorScheme string            `json:"color_scheme,omitempty"` // auto (segue o sistema), light ou dark (default: auto)
+	Light       map[string]string `json:"light,omitempty"`        // variáveis do modo claro (ex: {"accent": "#e74c3c"})
+	Dark        map[string]string `json:"dark,omitempty"`         // variáveis do modo escuro
+}
+
+// CodeViewConfig mostra arquivos de código e logs (.go, .py, .json, .log,
+// ...) com destaque de sintaxe e âncoras por linha quando abertos no
+// navegador; ?raw=1 e clientes que não pedem HTML recebem o arquivo original
+type CodeViewConfig struct {
+	Enabled bool  `json:"enabled"`
+	MaxSize int64 `json:"max_size,omitempty"` // bytes; maiores são servidos sem destaque (default: 1 MiB)
+}
+
+// TailConfig acompanhamento de arquivos de log: ?follow=1 abre uma página
+// que recebe as linhas novas por SSE. Exige token, IP permitido ou
+// basic_auth, já que mantém a conexão aberta
+type TailConfig struct {
+	Enabled     bool     `json:"enabled"`
+	Extensions  []string `json:"extensions,omitempty"`   // default: .log, .txt
+	Token       string   `json:"token,omitempty"`        // ?token= ou Authorization: Bearer
+	AllowedIPs  []string `json:"allowed_ips,omitempty"`  // IPs liberados sem token
+	MaxClients  int      `json:"max_clients,omitempty"`  // streams simultâneos (default: 16)
+	MaxDuration int      `json:"max_duration,omitempty"` // segundos por stream (default: 3600)
+	Backlog     int      `json:"backlog,omitempty"`      // últimas linhas enviadas ao conectar (default: 100)
+}
+
+// TextSlicesConfig trechos de arquivos de texto: ?lines=A-B responde as
+// linhas de A a B e ?tail=N as últimas N, sem baixar o arquivo inteiro
+type TextSlicesConfig struct {
+	Enabled  bool `json:"enabled"`
+	MaxLines int  `json:"max_lines,omitempty"` // linhas por resposta (default: 10000)
+}
+
+// DiskUsageConfig ?du=1 em diretórios responde em JSON o tamanho e a
+// contagem de arquivos recursivos de cada item, a partir do índice da raiz
+// (index) ou, sem ele, varrendo o diretório
+type DiskUsageConfig struct {
+	Enabled  bool `json:"enabled"`
+	Listing  bool `json:"listing"`             // mostra o tamanho total dos diretórios na listagem (só com index)
+	CacheTTL int  `json:"cache_ttl,omitempty"` // segundos que uma varredura é reaproveitada (default: 300)
+}
+
+// ListingHideRule entradas ocultas das listagens
+type ListingHideRule struct {
+	Paths []string `json:"paths"`
+	Serve bool     `json:"serve"` // continua servindo as entradas ocultas (default: 404)
+}
+
+// TorrentConfig serve <arquivo>.torrent e <arquivo>.meta4 gerados sob demanda
+// para arquivos grandes; os hashes ficam em cache enquanto o arquivo não mudar
+type TorrentConfig struct {
+	Enabled  bool     `json:"enabled"`
+	MinSize  int64    `json:"min_size,omitempty"` // bytes (default: 64 MiB)
+	Trackers []string `json:"trackers,omitempty"`
+	WebSeeds []string `json:"web_seeds,omitempty"` // URLs base de mirrors; o próprio servidor sempre entra
+	Metalink bool     `json:"metalink"`            // também serve <arquivo>.meta4 (RFC 5854)
+	CacheDir string   `json:"cache_dir,omitempty"` // default: .qserv-torrents
+}
+
+// ZsyncConfig serve <arquivo>.zsync gerado sob demanda para artefatos
+// grandes, para que o cliente zsync baixe só os blocos alterados via Range;
+// o arquivo de controle fica em cache enquanto a origem não mudar
+type ZsyncConfig struct {
+	Enabled   bool     `json:"enabled"`
+	Paths     []string `json:"paths,omitempty"`      // globs (ex: /images/**.iso); vazio = todos
+	MinSize   int64    `json:"min_size,omitempty"`   // bytes (default: 16 MiB)
+	BlockSize int      `json:"block_size,omitempty"` // potência de 2 (default: 2048, ou 4096 a partir de 100 MB)
+	CacheDir  string   `json:"cache_dir,omitempty"`  // default: .qserv-zsync
+}
+
+// PackageReposConfig diretórios servidos como repositórios apt ou yum:
+// tipos de conteúdo dos pacotes, Release/InRelease e repomd.xml sem cache,
+// arquivos by-hash e de repodata imutáveis e bytes exatos (sem gzip, com
+// Range). Os índices podem ser regenerados por um comando (ex:
+// createrepo_c --update ., apt-ftparchive) quando os pacotes mudam
+type PackageReposConfig struct {
+	Enabled bool                `json:"enabled"`
+	Repos   []PackageRepoConfig `json:"repos"`
+}
+
+// PackageRepoConfig um repositório de pacotes
+type PackageRepoConfig struct {
+	Name       string   `json:"name"`                 // nome do job de regeneração (package-repo-<name>)
+	Path       string   `json:"path"`                 // prefixo da URL (ex: /debian/)
+	Type       string   `json:"type"`                 // apt ou yum
+	Regenerate []string `json:"regenerate,omitempty"` // comando executado no diretório do repositório
+	Interval   int      `json:"interval,omitempty"`   // segundos entre verificações (0 = só pela API de jobs e em trocas de raiz)
+}
+
+// ContentAddressConfig endpoint /=/<sha256>, que serve arquivos da raiz pelo
+// hash do conteúdo com cache imutável
+type ContentAddressConfig struct {
+	Enabled  bool   `json:"enabled"`
+	Prefix   string `json:"prefix,omitempty"`   // default: /=/
+	Interval int    `json:"interval,omitempty"` // segundos entre reindexações (0 = só na inicialização e em trocas de raiz)
+}
+
+// VersioningConfig mantém as versões anteriores dos arquivos sobrescritos
+// (uploads, WebDAV), com histórico e restauração pela API administrativa
+type VersioningConfig struct {
+	Enabled bool   `json:"enabled"`
+	Keep    int    `json:"keep"` // versões mantidas por arquivo (default: 5)
+	Dir     string `json:"dir"`  // default: .qserv-versions
+}
+
+// QuotaRule limite de espaço e de arquivos sob um prefixo; escritas que o
+// excederem são recusadas com 507
+type QuotaRule struct {
+	Prefix   string `json:"prefix"`              // ex: /tenants/acme/
+	MaxBytes int64  `json:"max_bytes,omitempty"` // 0 = sem limite
+	MaxFiles int    `json:"max_files,omitempty"` // 0 = sem limite
+}
+
+// ArchiveConfig download de diretórios listáveis como zip ou tar.gz. O zip é
+// determinístico (ordem e datas fixas), então requisições com Range são
+// atendidas a partir de uma cópia montada em disco; o tar.gz é gerado
+// durante o envio.
+type ArchiveConfig struct {
+	Enabled  bool   `json:"enabled"`
+	SpoolDir string `json:"spool_dir,omitempty"` // cópias para Range (default: diretório temporário do sistema)
+	SpoolTTL int    `json:"spool_ttl,omitempty"` // segundos sem uso até remover uma cópia (default: 3600)
+}
+
+// TombstoneConfig caminhos removidos de propósito: respondem 410 Gone em vez
+// de 404 (buscadores e mirrors descartam o conteúdo em vez de tentar de novo)
+type TombstoneConfig struct {
+	Enabled      bool     `json:"enabled"`
+	Paths        []string `json:"paths,omitempty"`         // globs (ex: /docs/v1/**)
+	Page         string   `json:"page,omitempty"`          // página explicativa, relativa à raiz
+	Markers      bool     `json:"markers"`                 // <caminho><marker_suffix> marca o caminho como removido
+	MarkerSuffix string   `json:"marker_suffix,omitempty"` // default: .gone; o conteúdo do marcador é a explicação
+}
+
+// ScheduleConfig publicação e expiração programadas: antes da publicação o
+// conteúdo responde 404, depois da expiração expired_status, e em ambos os
+// casos some das listagens
+type ScheduleConfig struct {
+	Enabled       bool           `json:"enabled"`
+	Rules         []ScheduleRule `json:"rules,omitempty"`
+	Sidecar       bool           `json:"sidecar"`                  // lê <arquivo><sidecar_suffix> ao lado do conteúdo
+	SidecarSuffix string         `json:"sidecar_suffix,omitempty"` // default: .schedule.json
+	ExpiredStatus int            `json:"expired_status,omitempty"` // 404 ou 410 (default: 410)
+}
+
+// ScheduleRule janela de publicação; também é o formato do arquivo sidecar
+// (sem paths). Diretórios agendados valem para todo o seu conteúdo.
+type ScheduleRule struct {
+	Paths    []string `json:"paths,omitempty"`   // globs (ex: /releases/v2/**)
+	Publish  string   `json:"publish,omitempty"` // "2006-01-02 15:04" ou RFC 3339
+	Expire   string   `json:"expire,omitempty"`
+	Timezone string   `json:"timezone,omitempty"` // IANA (default: local)
 }
 
 // RuntimeConfigConfig configuração de runtime config
 type RuntimeConfigConfig struct {
 	Enabled      bool     `json:"enabled"`
-	Route        string   `json:"route"`          // rota onde o config será servido (default: /runtime-config.js)
-	Format       string   `json:"format"`         // "js" ou "json" (default: js)
-	VarName      string   `json:"var_name"`       // nome da variável JavaScript (default: APP_CONFIG)
-	EnvPrefix    string   `json:"env_prefix"`     // prefixo das env vars (ex: "APP_" ou "RUNTIME_")
-	EnvVariables []string `json:"env_variables"`  // lista específica de variáveis (alternativa ao prefix)
-	NoCache      bool     `json:"no_cache"`       // se true, adiciona headers no-cache
+	Route        string   `json:"route"`         // rota onde o config será servido (default: /runtime-config.js)
+	Format       string   `json:"format"`        // "js" ou "json" (default: js)
+	VarName      string   `json:"var_name"`      // nome da variável JavaScript (default: APP_CONFIG)
+	EnvPrefix    string   `json:"env_prefix"`    // prefixo das env vars (ex: "APP_" ou "RUNTIME_")
+	EnvVariables []string `json:"env_variables"` // lista específica de variáveis (alternativa ao prefix)
+	NoCache      bool     `json:"no_cache"`      // se true, adiciona headers no-cache
+}
+
+// AdminConfig API administrativa
+type AdminConfig struct {
+	Enabled    bool     `json:"enabled"`
+	Route      string   `json:"route"` // prefixo das rotas administrativas (default: /_admin)
+	Token      string   `json:"token"` // bearer token exigido em todas as chamadas
+	AllowedIPs []string `json:"allowed_ips,omitempty"`
+}
+
+// GitSourceConfig conteúdo servido a partir de um repositório git
+type GitSourceConfig struct {
+	Enabled       bool   `json:"enabled"`
+	Repository    string `json:"repository"`     // URL ou caminho do repositório
+	Ref           string `json:"ref"`            // branch ou tag (default: main)
+	Subdir        string `json:"subdir"`         // subdiretório do repositório a servir (opcional)
+	WorkDir       string `json:"work_dir"`       // onde ficam o clone e os snapshots (default: .qserv-git)
+	PollInterval  int    `json:"poll_interval"`  // segundos entre sincronizações (0 = apenas via API)
+	KeepSnapshots int    `json:"keep_snapshots"` // snapshots antigos mantidos em disco (default: 2)
+}
+
+// DeployConfig webhook de deploy
+type DeployConfig struct {
+	Enabled       bool   `json:"enabled"`
+	Route         string `json:"route"`           // rota do webhook (default: /_deploy)
+	Token         string `json:"token"`           // bearer token aceito pelo webhook
+	Secret        string `json:"secret"`          // segredo HMAC (header X-Hub-Signature-256)
+	Action        string `json:"action"`          // git, rsync ou upload
+	Source        string `json:"source"`          // origem do rsync
+	ReleasesDir   string `json:"releases_dir"`    // onde as versões são criadas (default: .qserv-releases)
+	KeepReleases  int    `json:"keep_releases"`   // versões antigas mantidas em disco (default: 2)
+	MaxUploadSize int64  `json:"max_upload_size"` // MB aceitos no upload (default: 512)
+	Dedup         bool   `json:"dedup"`           // arquivos repetidos entre versões viram hardlinks
+	BlobsDir      string `json:"blobs_dir"`       // armazenamento dos blobs (default: <releases_dir>/.blobs)
+}
+
+// IntegrityConfig verificação do conteúdo contra um manifesto assinado
+type IntegrityConfig struct {
+	Enabled         bool   `json:"enabled"`
+	Manifest        string `json:"manifest"`          // caminho relativo à raiz (default: .qserv-manifest.json)
+	PublicKey       string `json:"public_key"`        // chave pública ed25519 em base64
+	Mode            string `json:"mode"`              // refuse ou flag (default: refuse)
+	VerifyOnRequest bool   `json:"verify_on_request"` // verifica o hash de cada arquivo servido
+	AllowUnlisted   bool   `json:"allow_unlisted"`    // permite servir arquivos fora do manifesto
+}
+
+// PullThroughConfig espelhamento sob demanda de um upstream (pull-through)
+type PullThroughConfig struct {
+	Prefix   string           `json:"prefix"`   // prefixo local (ex: /debian/)
+	Upstream string           `json:"upstream"` // URL base do upstream
+	Timeout  int              `json:"timeout"`  // segundos até os headers do upstream (default: 30)
+	Cache    *DiskCacheConfig `json:"cache,omitempty"`
+}
+
+// DiskCacheConfig cache de respostas em disco
+type DiskCacheConfig struct {
+	Enabled              bool   `json:"enabled"`
+	Dir                  string `json:"dir"`                    // diretório do cache
+	MaxSize              int64  `json:"max_size"`               // MB (default: 1024)
+	DefaultTTL           int    `json:"default_ttl"`            // segundos para respostas sem validade explícita
+	StaleWhileRevalidate int    `json:"stale_while_revalidate"` // segundos servindo conteúdo expirado enquanto revalida
+	StaleIfError         int    `json:"stale_if_error"`         // segundos servindo conteúdo expirado se a origem falhar
+}
+
+// WellKnownConfig diretório sobreposto em /.well-known/ e respostas prontas
+// para as entradas mais comuns
+type WellKnownConfig struct {
+	Enabled          bool                       `json:"enabled"`
+	Dir              string                     `json:"dir"`                 // consultado antes do diretório raiz
+	ACMEChallengeDir string                     `json:"acme_challenge_dir"`  // tokens HTTP-01 (/.well-known/acme-challenge/)
+	MatrixServer     string                     `json:"matrix_server"`       // ex: matrix.example.com:443
+	MatrixClient     string                     `json:"matrix_client"`       // ex: https://matrix.example.com
+	WebFinger        map[string]json.RawMessage `json:"webfinger,omitempty"` // resource (acct:...) -> JRD
+}
+
+// StatsConfig estatísticas de uso expostas pela API administrativa
+type StatsConfig struct {
+	Enabled         bool  `json:"enabled"`
+	DownloadMinSize int64 `json:"download_min_size"` // MB; arquivos menores não são acompanhados (default: 10)
+	MaxTrackedFiles int   `json:"max_tracked_files"` // default: 1000
 }
 
 // DefaultConfig retorna a configuração padrão
 func DefaultConfig() *Config {
 	return &Config{
 		Server: ServerConfig{
-			Port:         8080,
-			Host:         "0.0.0.0",
-			RootDir:      ".",
-			ReadTimeout:  30,
-			WriteTimeout: 30,
+			Port:            8080,
+			Host:            "0.0.0.0",
+			IPFamily:        "auto",
+			RootDir:         ".",
+			ReadTimeout:     30,
+			WriteTimeout:    30,
+			ShutdownTimeout: 30,
 		},
 		Security: SecurityConfig{
 			EnableHTTPS:      false,
@@ -187,3 +768,366 @@ func (c *ServerConfig) GetReadTimeout() time.Duration {
 func (c *ServerConfig) GetWriteTimeout() time.Duration {
 	return time.Duration(c.WriteTimeout) * time.Second
 }
+
+// GetShutdownTimeout retorna o tempo de drenagem no encerramento (default: 30s)
+func (c *ServerConfig) GetShutdownTimeout() time.Duration {
+	if c.ShutdownTimeout <= 0 {
+		return 30 * time.Second
+	}
+	return time.Duration(c.ShutdownTimeout) * time.Second
+}
+
+// MirrorConfig redireciona downloads para mirrors (modo portal de downloads);
+// o restante continua sendo servido localmente
+type MirrorConfig struct {
+	Enabled       bool           `json:"enabled"`
+	Paths         []string       `json:"paths"`                    // globs dos caminhos redirecionados (ex: /releases/**)
+	MinSize       int64          `json:"min_size,omitempty"`       // arquivos menores são servidos localmente
+	Mirrors       []MirrorTarget `json:"mirrors"`                  // mirrors candidatos
+	CountryHeader string         `json:"country_header,omitempty"` // header com o país do cliente (ex: CF-IPCountry)
+	Status        int            `json:"status,omitempty"`         // 302 ou 307 (default: 302)
+}
+
+// MirrorTarget mirror de destino
+type MirrorTarget struct {
+	URL       string   `json:"url"`                 // URL base; o caminho pedido é anexado
+	Weight    int      `json:"weight,omitempty"`    // peso relativo (default: 1)
+	Countries []string `json:"countries,omitempty"` // códigos ISO 3166 atendidos preferencialmente
+}
+
+// JanitorConfig limpeza periódica de cópias derivadas órfãs, downloads
+// expirados e temporários abandonados
+type JanitorConfig struct {
+	Enabled  bool `json:"enabled"`
+	Interval int  `json:"interval"` // segundos entre limpezas (default: 3600)
+	TempAge  int  `json:"temp_age"` // segundos até um temporário ser considerado abandonado (default: 3600)
+}
+
+// JobsConfig agendador das tarefas de segundo plano
+type JobsConfig struct {
+	MaxConcurrent int `json:"max_concurrent"` // jobs executando ao mesmo tempo (default: 2)
+	History       int `json:"history"`        // execuções mantidas no histórico (default: 100)
+}
+
+// IndexConfig índice da árvore da raiz (tamanhos, mtimes e hashes) gravado
+// em disco e consultado pelas funcionalidades que precisariam varrer a raiz
+type IndexConfig struct {
+	Enabled  bool   `json:"enabled"`
+	File     string `json:"file"`     // arquivo do índice (default: .qserv-index.json)
+	Interval int    `json:"interval"` // segundos entre reindexações (0 = só na inicialização e em trocas de raiz)
+	Hash     bool   `json:"hash"`     // calcula o SHA-256 dos arquivos
+}
+
+// FeedsConfig feeds RSS, Atom e JSON Feed dos arquivos adicionados ou
+// alterados recentemente, em <prefix><nome>.rss, .atom e .json
+type FeedsConfig struct {
+	Enabled bool         `json:"enabled"`
+	Prefix  string       `json:"prefix,omitempty"`   // default: /_feeds/
+	BaseURL string       `json:"base_url,omitempty"` // endereço público nos links (default: o host da requisição)
+	Feeds   []FeedConfig `json:"feeds"`
+}
+
+// FeedConfig um feed: os arquivos que casam com os globs, do mais recente
+// para o mais antigo
+type FeedConfig struct {
+	Name     string   `json:"name"`
+	Title    string   `json:"title,omitempty"`
+	Paths    []string `json:"paths"`               // globs (ex: /releases/**)
+	MaxItems int      `json:"max_items,omitempty"` // default: 50
+	MaxAge   int      `json:"max_age,omitempty"`   // dias (0 = sem limite)
+}
+
+// FileWebhooksConfig webhooks chamados quando um arquivo novo aparece na
+// raiz (observação do sistema de arquivos e trocas de raiz)
+type FileWebhooksConfig struct {
+	Enabled bool                `json:"enabled"`
+	Settle  int                 `json:"settle,omitempty"` // segundos sem escrita antes do aviso (default: 2)
+	Hooks   []FileWebhookConfig `json:"hooks"`
+}
+
+// FileWebhookConfig um webhook: recebe um POST JSON com caminho, tamanho e
+// (com hash) o SHA-256 de cada arquivo novo que casa com os globs
+type FileWebhookConfig struct {
+	Name    string            `json:"name"`
+	URL     string            `json:"url"`
+	Paths   []string          `json:"paths"`            // globs (ex: /releases/**)
+	Secret  string            `json:"secret,omitempty"` // assina o corpo (X-Qserv-Signature-256: sha256=...)
+	Hash    bool              `json:"hash"`
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+// FTPConfig listener FTP(S) somente leitura sobre a mesma raiz, para
+// clientes e equipamentos antigos que não falam HTTP com autenticação
+type FTPConfig struct {
+	Enabled      bool   `json:"enabled"`
+	Address      string `json:"address,omitempty"`       // default: :2121
+	PassivePorts string `json:"passive_ports,omitempty"` // ex: 50000-50100 (default: porta livre qualquer)
+	PublicIP     string `json:"public_ip,omitempty"`     // IPv4 anunciado no PASV (default: IP local da conexão)
+	TLS          bool   `json:"tls"`                     // AUTH TLS com security.cert_file/key_file
+	RequireTLS   bool   `json:"require_tls"`             // recusa login sem AUTH TLS
+	MaxClients   int    `json:"max_clients,omitempty"`   // default: 20
+	IdleTimeout  int    `json:"idle_timeout,omitempty"`  // segundos (default: 300)
+}
+
+// FileAPIConfig API tipada de arquivos (qserv.files.v1.FileService, protocolo
+// Connect com codec JSON) para serviços que preferem clientes gerados
+type FileAPIConfig struct {
+	Enabled      bool  `json:"enabled"`
+	AllowWrite   bool  `json:"allow_write"`
+	MaxWriteSize int64 `json:"max_write_size,omitempty"` // bytes (default: 32 MiB)
+	ChunkSize    int   `json:"chunk_size,omitempty"`     // bytes por mensagem de Read (default: 64 KiB)
+}
+
+// RegistryConfig OCI Distribution API somente leitura em /v2/, para
+// docker pull/oras buscarem artefatos guardados como OCI image layout
+type RegistryConfig struct {
+	Enabled bool   `json:"enabled"`
+	Dir     string `json:"dir"`     // layouts por repositório (ex: registry -> registry/library/alpine/index.json); relativo à raiz
+	Catalog bool   `json:"catalog"` // lista os repositórios em /v2/_catalog
+}
+
+// GoProxyConfig espelho de módulos Go (protocolo GOPROXY) sobre um diretório
+// no formato de $GOMODCACHE/cache/download, para redes isoladas:
+// GOPROXY=https://host/go/ GONOSUMDB=* (ou GOFLAGS=-mod=mod com go.sum)
+type GoProxyConfig struct {
+	Enabled bool   `json:"enabled"`
+	Prefix  string `json:"prefix,omitempty"` // default: /go/
+	Dir     string `json:"dir"`              // ex: gomod (cópia de $GOMODCACHE/cache/download); relativo à raiz
+}
+
+// PyPIConfig índice "simple" (PEP 503) gerado a partir de um diretório de
+// wheels e sdists, com o sha256 de cada arquivo:
+// pip install --index-url https://host/simple/ pacote
+type PyPIConfig struct {
+	Enabled bool   `json:"enabled"`
+	Prefix  string `json:"prefix,omitempty"` // default: /simple/
+	Dir     string `json:"dir"`              // distribuições (subdiretórios são percorridos); relativo à raiz
+}
+
+// NpmConfig registry npm somente leitura sobre um diretório de tarballs
+// (npm pack), para instalações offline:
+// npm install --registry https://host/npm/ pacote
+type NpmConfig struct {
+	Enabled bool   `json:"enabled"`
+	Prefix  string `json:"prefix,omitempty"`   // default: /npm/
+	Dir     string `json:"dir"`                // tarballs .tgz (subdiretórios são percorridos); relativo à raiz
+	BaseURL string `json:"base_url,omitempty"` // endereço público do registry nos links dos tarballs (default: host da requisição + prefix)
+}
+
+// MavenConfig diretório sob prefix organizado como repositório Maven: gera
+// maven-metadata.xml e checksums (.md5, .sha1, .sha256, .sha512) que
+// faltarem e, com allow_deploy, recebe PUT de mvn deploy e gradle publish
+type MavenConfig struct {
+	Enabled       bool   `json:"enabled"`
+	Prefix        string `json:"prefix"`                    // ex: /maven/ (diretório de mesmo nome na raiz)
+	AllowDeploy   bool   `json:"allow_deploy"`              // aceita PUT
+	Token         string `json:"token,omitempty"`           // senha do deploy (Basic, como no settings.xml, ou Bearer); sem token vale o basic_auth global
+	AllowRedeploy bool   `json:"allow_redeploy"`            // permite sobrescrever versões de release (SNAPSHOTs sempre podem)
+	MaxUploadSize int64  `json:"max_upload_size,omitempty"` // MB por arquivo (default: 512)
+}
+
+// ProbeConfig endpoint sintético (/_probe) para monitoramento blackbox:
+// verifica a leitura da raiz, a validade do certificado, os upstreams e os
+// jobs, e responde 503 se alguma verificação falhou (?format=prometheus
+// para métricas). Sem token nem allowed_ips, fica aberto
+type ProbeConfig struct {
+	Enabled      bool     `json:"enabled"`
+	Route        string   `json:"route,omitempty"`          // default: /_probe
+	Token        string   `json:"token,omitempty"`          // ?token= ou Authorization: Bearer
+	AllowedIPs   []string `json:"allowed_ips,omitempty"`    // IPs liberados sem token
+	Upstreams    []string `json:"upstreams,omitempty"`      // URLs verificadas com HEAD, além dos upstreams de pull_through
+	Timeout      int      `json:"timeout,omitempty"`        // segundos por upstream (default: 5)
+	CertWarnDays int      `json:"cert_warn_days,omitempty"` // dias antes da expiração em que o certificado vira warn (default: 14)
+	CacheTTL     int      `json:"cache_ttl,omitempty"`      // segundos que um resultado é reaproveitado (default: 5)
+}
+
+// ClusterConfig várias instâncias atrás de um balanceador compartilhando
+// estado: cada chave de rate limit pertence a um nó (hash sobre a lista de
+// nós) e os demais consultam o dono por HTTP, com requisições assinadas
+type ClusterConfig struct {
+	Enabled bool     `json:"enabled"`
+	Self    string   `json:"self"`              // URL pela qual os outros nós alcançam esta instância
+	Nodes   []string `json:"nodes"`             // URLs de todos os nós (pode incluir self)
+	Secret  string   `json:"secret"`            // chave HMAC comum a todos os nós
+	Route   string   `json:"route,omitempty"`   // default: /_cluster
+	Timeout int      `json:"timeout,omitempty"` // milissegundos por consulta (default: 250); se o dono não responde, vale o contador local
+}
+
+// RedisConfig estado externo para réplicas sem estado: as cotas de rate
+// limit ficam no Redis; se ele não responde, valem os contadores em memória
+type RedisConfig struct {
+	Enabled bool   `json:"enabled"`
+	URL     string `json:"url"`               // redis://[usuário:senha@]host:6379/0 (rediss:// para TLS)
+	Prefix  string `json:"prefix,omitempty"`  // prefixo das chaves (default: qserv:)
+	Timeout int    `json:"timeout,omitempty"` // milissegundos por comando (default: 250)
+}
+
+// TunnelConfig expõe a instância por um relay ("qserv relay") sem abrir
+// portas: o qserv conecta ao relay e atende por essas conexões as
+// requisições públicas que ele recebe (útil atrás de NAT)
+type TunnelConfig struct {
+	Enabled     bool   `json:"enabled"`
+	Relay       string `json:"relay"`                 // host:porta onde o relay aceita túneis
+	Token       string `json:"token"`                 // mesmo -token do relay
+	TLS         bool   `json:"tls"`                   // conecta com TLS (relay com -cert/-key)
+	Connections int    `json:"connections,omitempty"` // túneis mantidos abertos (default: 4)
+}
+
+// TailscaleConfig compartilhamento privado na tailnet: escuta só nos
+// endereços do Tailscale (ou de uma interface WireGuard), recusa clientes de
+// fora e registra no log de acesso o usuário e a máquina de cada conexão
+type TailscaleConfig struct {
+	Enabled      bool     `json:"enabled"`
+	Interface    string   `json:"interface,omitempty"`     // ex: wg0 (default: endereços de tailnet de qualquer interface)
+	Socket       string   `json:"socket,omitempty"`        // LocalAPI do tailscaled (default: /var/run/tailscale/tailscaled.sock)
+	AllowedUsers []string `json:"allowed_users,omitempty"` // logins aceitos, com globs (ex: *@example.com); vazio aceita toda a tailnet
+}
+
+// ReloadConfig recarga do arquivo de configuração sem reiniciar (além do
+// SIGHUP e de POST /_admin/config/reload)
+type ReloadConfig struct {
+	Watch bool `json:"watch"` // recarrega quando o arquivo muda
+}
+
+// VHostConfig host virtual: os hosts (padrões como em allowed_hosts) são
+// servidos a partir de root_dir; security, performance e features sobrepõem
+// apenas os campos informados da configuração global
+type VHostConfig struct {
+	Hosts       []string        `json:"hosts"`
+	RootDir     string          `json:"root_dir"`
+	Security    json.RawMessage `json:"security,omitempty"`
+	Performance json.RawMessage `json:"performance,omitempty"`
+	Features    json.RawMessage `json:"features,omitempty"`
+}
+
+// ProxyConfig backend HTTP atrás de um prefixo de caminho (reverse proxy)
+type ProxyConfig struct {
+	Prefix         string            `json:"prefix"`                    // prefixo local (ex: /api/)
+	Upstream       string            `json:"upstream"`                  // URL do backend (ex: http://127.0.0.1:3000)
+	StripPrefix    bool              `json:"strip_prefix,omitempty"`    // remove o prefixo antes de repassar (/api/users -> /users)
+	XForwarded     bool              `json:"x_forwarded,omitempty"`     // envia X-Forwarded-For, X-Forwarded-Host e X-Forwarded-Proto
+	PreserveHost   bool              `json:"preserve_host,omitempty"`   // repassa o Host original em vez do host do upstream
+	Headers        map[string]string `json:"headers,omitempty"`         // headers adicionados à requisição ao backend
+	ConnectTimeout int               `json:"connect_timeout,omitempty"` // segundos para conectar (default: 10)
+	Timeout        int               `json:"timeout,omitempty"`         // segundos até os headers da resposta (default: 30)
+}
+
+// DiskIOConfig limite de leituras simultâneas por disco; o tipo de cada ponto
+// de montagem é detectado no Linux e pode ser informado em mounts
+type DiskIOConfig struct {
+	Enabled        bool              `json:"enabled"`
+	HDDConcurrency int               `json:"hdd_concurrency,omitempty"` // leituras simultâneas em discos rotacionais (default: 4)
+	SSDConcurrency int               `json:"ssd_concurrency,omitempty"` // em SSD/NVMe e discos não identificados (default: 64)
+	Mounts         map[string]string `json:"mounts,omitempty"`          // ponto de montagem -> hdd ou ssd
+}
+
+// IOURingConfig leitura experimental de arquivos pequenos por io_uring
+// (Linux 5.15+); em outros sistemas ou se o kernel recusar, o caminho
+// padrão é usado
+type IOURingConfig struct {
+	Enabled     bool  `json:"enabled"`
+	MaxFileSize int64 `json:"max_file_size,omitempty"` // bytes; maiores seguem o caminho padrão (default: 65536)
+	Rings       int   `json:"rings,omitempty"`         // anéis usados em paralelo (default: GOMAXPROCS)
+	Entries     int   `json:"entries,omitempty"`       // tamanho de cada anel (default: 64)
+}
+
+// OCSPStaplingConfig envia a resposta OCSP do certificado no handshake; o
+// cert_file precisa trazer o intermediário depois do certificado
+type OCSPStaplingConfig struct {
+	Enabled   bool   `json:"enabled"`
+	Responder string `json:"responder,omitempty"` // URL do responder (default: a do certificado)
+	Interval  int    `json:"interval,omitempty"`  // segundos entre verificações (default: 3600); a busca ocorre após metade da validade
+}
+
+// ECHConfig Encrypted Client Hello no listener HTTPS; a ECHConfigList da
+// primeira chave vai no parâmetro ech do registro DNS HTTPS do domínio
+type ECHConfig struct {
+	Enabled bool           `json:"enabled"`
+	Keys    []ECHKeyConfig `json:"keys"` // a primeira é a atual; as demais seguem aceitas durante a rotação
+}
+
+// ECHKeyConfig uma chave ECH
+type ECHKeyConfig struct {
+	KeyFile    string `json:"key_file"`    // chave privada X25519 em PEM (openssl genpkey -algorithm X25519)
+	PublicName string `json:"public_name"` // SNI visível; o certificado deve cobri-lo
+	ConfigID   int    `json:"config_id"`   // 0-255, diferente entre as chaves
+}
+
+// UploadsConfig upload de arquivos para a raiz; a listagem dos diretórios
+// sob os prefixos mostra um formulário de envio
+type UploadsConfig struct {
+	Enabled           bool     `json:"enabled"`
+	Prefixes          []string `json:"prefixes"`                     // ex: /incoming/
+	MaxSize           int64    `json:"max_size,omitempty"`           // MB por arquivo (default: 512)
+	Overwrite         string   `json:"overwrite,omitempty"`          // deny (default: 409), allow ou rename (arquivo (1).ext)
+	AllowedExtensions []string `json:"allowed_extensions,omitempty"` // ex: [".jpg", ".pdf"]; vazio = qualquer
+	Progress          bool     `json:"progress"`                     // progresso por ?upload_id= (JSON ou SSE), usado pela listagem
+	ProgressRoute     string   `json:"progress_route,omitempty"`     // default: /_upload_progress
+	Chunked           bool     `json:"chunked"`                      // envio em partes paralelas (?chunked), montadas ao final
+	ChunkDir          string   `json:"chunk_dir,omitempty"`          // partes em andamento (default: qserv-chunks no diretório temporário)
+	ChunkTTL          int      `json:"chunk_ttl,omitempty"`          // segundos sem novas partes até a sessão ser descartada (default: 86400)
+	MaxChunks         int      `json:"max_chunks,omitempty"`         // partes por arquivo (default: 10000)
+	Dedup             bool     `json:"dedup"`                        // arquivos repetidos viram hardlinks de um blob (também no PUT do WebDAV)
+	BlobsDir          string   `json:"blobs_dir,omitempty"`          // armazenamento dos blobs: fora da raiz, no mesmo sistema de arquivos
+}
+
+// SessionTicketsConfig rotação das chaves dos session tickets TLS; sem ela
+// vale a rotação diária do Go, com chaves próprias de cada processo
+type SessionTicketsConfig struct {
+	Enabled  bool   `json:"enabled"`
+	Interval int    `json:"interval,omitempty"` // segundos entre rotações ou releituras do key_file (default: 3600)
+	Keep     int    `json:"keep,omitempty"`     // chaves anteriores aceitas na retomada (default: 23)
+	KeyFile  string `json:"key_file,omitempty"` // chaves comuns ao cluster: base64 de 32 bytes por linha, a atual primeiro
+}
+
+// WebDAVConfig acesso WebDAV à raiz, atrás da mesma autenticação e filtro
+// de IP dos arquivos
+type WebDAVConfig struct {
+	Enabled       bool   `json:"enabled"`
+	Prefix        string `json:"prefix,omitempty"`          // URL da montagem (default: /)
+	ReadOnly      bool   `json:"read_only"`                 // só OPTIONS, GET, HEAD e PROPFIND
+	MaxUploadSize int64  `json:"max_upload_size,omitempty"` // MB por PUT (default: 512)
+}
+
+// DownloadLimitRule limite de bytes servidos nos caminhos da regra; a
+// primeira regra que casar vale
+type DownloadLimitRule struct {
+	Paths                 []string `json:"paths"`                               // globs (ex: /isos/**)
+	MaxRequestBytes       int64    `json:"max_request_bytes,omitempty"`         // por resposta; acima disso o cliente continua com Range (0 = sem limite)
+	MaxClientBytesPerHour int64    `json:"max_client_bytes_per_hour,omitempty"` // por IP, em janelas de uma hora (0 = sem limite)
+}
+
+// HotlinkConfig proteção contra hotlinking: mídia pedida a partir de outros
+// sites (pelo Referer, ou Origin na falta dele) recebe 403 ou um redirect
+// para um placeholder. O próprio host é sempre aceito
+type HotlinkConfig struct {
+	Enabled      bool     `json:"enabled"`
+	Paths        []string `json:"paths,omitempty"`         // globs (default: imagens, vídeo e áudio pela extensão)
+	AllowedSites []string `json:"allowed_sites,omitempty"` // hosts como em allowed_hosts (ex: example.com, *.example.com)
+	BlockEmpty   bool     `json:"block_empty"`             // recusa também requisições sem Referer nem Origin (default: aceita, como acesso direto e apps)
+	Placeholder  string   `json:"placeholder,omitempty"`   // caminho ou URL para onde redirecionar (default: responde 403)
+}
+
+// SignedCookiesConfig acesso por cookie assinado, como os signed cookies do
+// CloudFront: a aplicação assina um prefixo e uma expiração, a rota grava o
+// cookie e os caminhos protegidos dentro do prefixo passam a ser servidos.
+// Útil para HLS, em que assinar cada segmento seria inviável
+type SignedCookiesConfig struct {
+	Enabled bool     `json:"enabled"`
+	Secret  string   `json:"secret"`            // chave HMAC compartilhada com a aplicação: sig = hex(HMAC-SHA256(secret, "<prefix>|<expires>"))
+	Paths   []string `json:"paths"`             // globs protegidos (ex: /hls/**)
+	Route   string   `json:"route,omitempty"`   // recebe ?prefix=&expires=&sig=[&return=] (default: /_gate)
+	Cookie  string   `json:"cookie,omitempty"`  // nome do cookie (default: qserv_access)
+	MaxTTL  int      `json:"max_ttl,omitempty"` // segundos; expirações mais distantes são recusadas (default: 86400)
+}
+
+// DownloadSessionsConfig sessões de download de arquivos grandes: a resposta
+// traz um token em X-Download-Session (ou usa o do cliente) e a rota devolve
+// o byte alcançado, para retomar com Range depois de trocar de rede
+type DownloadSessionsConfig struct {
+	Enabled     bool   `json:"enabled"`
+	Route       string `json:"route,omitempty"` // consulta por ?token= ou X-Download-Session (default: /_download_session)
+	MinSize     int64  `json:"min_size"`        // MB; arquivos menores não abrem sessão (default: 10)
+	TTL         int    `json:"ttl"`             // segundos sem uso até a sessão expirar (default: 86400)
+	MaxSessions int    `json:"max_sessions"`    // default: 10000
+}
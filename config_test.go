@@ -3,6 +3,7 @@ package main
 import (
 	"encoding/json"
 	"os"
+	"strings"
 	"testing"
 )
 
@@ -240,3 +241,52 @@ func TestConfigJSON(t *testing.T) {
 		t.Errorf("Expected env prefix TEST_, got %s", loadedConfig.RuntimeConfig.EnvPrefix)
 	}
 }
+
+func TestListenAddrs(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   ServerConfig
+		expected []string
+		wantErr  bool
+	}{
+		{"LegacyHost", ServerConfig{Host: "0.0.0.0", Port: 80}, []string{"tcp 0.0.0.0:80"}, false},
+		{"IPv6Brackets", ServerConfig{Host: "::1", Port: 80}, []string{"tcp [::1]:80"}, false},
+		{"HostsOverrideHost", ServerConfig{Host: "0.0.0.0", Hosts: []string{"127.0.0.1", "[::1]"}, Port: 80}, []string{"tcp 127.0.0.1:80", "tcp [::1]:80"}, false},
+		{"IPv4Only", ServerConfig{Host: "0.0.0.0", IPFamily: "ipv4", Port: 80}, []string{"tcp4 0.0.0.0:80"}, false},
+		{"IPv6Only", ServerConfig{Host: "", IPFamily: "ipv6", Port: 80}, []string{"tcp6 [::]:80"}, false},
+		{"BothWildcard", ServerConfig{Host: "0.0.0.0", IPFamily: "both", Port: 80}, []string{"tcp4 0.0.0.0:80", "tcp6 [::]:80"}, false},
+		{"BothLiterals", ServerConfig{Hosts: []string{"10.0.0.1", "fd00::1"}, IPFamily: "both", Port: 80}, []string{"tcp4 10.0.0.1:80", "tcp6 [fd00::1]:80"}, false},
+		{"FamilyMismatch", ServerConfig{Host: "::1", IPFamily: "ipv4", Port: 80}, nil, true},
+		{"InvalidFamily", ServerConfig{Host: "0.0.0.0", IPFamily: "ipx", Port: 80}, nil, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			addrs, err := test.config.ListenAddrs()
+			if test.wantErr {
+				if err == nil {
+					t.Errorf("Expected error, got %v", addrs)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			var got []string
+			for _, addr := range addrs {
+				got = append(got, addr.Network+" "+addr.Address())
+			}
+			if strings.Join(got, ",") != strings.Join(test.expected, ",") {
+				t.Errorf("Expected %v, got %v", test.expected, got)
+			}
+		})
+	}
+}
+
+func TestListenAddrURL(t *testing.T) {
+	addr := ListenAddr{Network: "tcp6", Host: "::1", Port: 8443}
+	if url := addr.URL("https"); url != "https://[::1]:8443" {
+		t.Errorf("Expected bracketed IPv6 URL, got %s", url)
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// connRequestsKey contador de requisições da conexão no contexto
+type connRequestsKey struct{}
+
+// httpServer cria o http.Server com os timeouts e os ajustes de conexão
+func (s *Server) httpServer(addr string) *http.Server {
+	server := &http.Server{
+		Addr:         addr,
+		Handler:      s,
+		ReadTimeout:  s.config.Server.GetReadTimeout(),
+		WriteTimeout: s.config.Server.GetWriteTimeout(),
+	}
+
+	server.TLSConfig = s.tlsConfig()
+
+	// Identidade da tailnet por conexão (usada no log de acesso)
+	if s.tailnet != nil {
+		server.ConnContext = s.tailnet.connContext
+	}
+
+	conn := s.config.Performance.Connections
+	if conn == nil {
+		return server
+	}
+	if conn.IdleTimeout > 0 {
+		server.IdleTimeout = time.Duration(conn.IdleTimeout) * time.Second
+	}
+	if conn.DisableKeepAlive {
+		server.SetKeepAlivesEnabled(false)
+	}
+	if conn.MaxRequestsPerConn > 0 {
+		parent := server.ConnContext
+		server.ConnContext = func(ctx context.Context, c net.Conn) context.Context {
+			if parent != nil {
+				ctx = parent(ctx, c)
+			}
+			return context.WithValue(ctx, connRequestsKey{}, new(atomic.Int64))
+		}
+	}
+	return server
+}
+
+// MaxRequestsPerConnMiddleware pede o fechamento da conexão (HTTP/1.x) ao
+// atingir o limite de requisições
+func MaxRequestsPerConnMiddleware(max int) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if count, ok := r.Context().Value(connRequestsKey{}).(*atomic.Int64); ok {
+				if count.Add(1) >= int64(max) {
+					w.Header().Set("Connection", "close")
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// tunedListener aplica as opções de socket às conexões aceitas
+type tunedListener struct {
+	net.Listener
+	config *ConnectionConfig
+}
+
+func (l *tunedListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	if tcp, ok := c.(*net.TCPConn); ok {
+		if l.config.DisableNoDelay {
+			tcp.SetNoDelay(false)
+		}
+		if l.config.ReadBuffer > 0 {
+			tcp.SetReadBuffer(l.config.ReadBuffer)
+		}
+		if l.config.WriteBuffer > 0 {
+			tcp.SetWriteBuffer(l.config.WriteBuffer)
+		}
+	}
+	return c, nil
+}
+
+// tlsConfig ajustes do listener HTTPS além do par de chaves (staple OCSP,
+// ECH, chaves dos session tickets); nil sem nenhum deles
+func (s *Server) tlsConfig() *tls.Config {
+	if s.ocsp == nil && s.ech == nil && s.tickets == nil {
+		return nil
+	}
+	config := &tls.Config{}
+	if s.ocsp != nil {
+		// Certificado com a resposta OCSP grampeada
+		config.GetCertificate = s.ocsp.GetCertificate
+	}
+	if s.ech != nil {
+		config.EncryptedClientHelloKeys = s.ech.keys
+	}
+	if s.tickets != nil {
+		config.WrapSession = s.tickets.wrap
+		config.UnwrapSession = s.tickets.unwrap
+	}
+	return config
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMaxRequestsPerConn(t *testing.T) {
+	root := t.TempDir()
+	os.WriteFile(filepath.Join(root, "file.txt"), []byte("hello"), 0644)
+
+	config := DefaultConfig()
+	config.Server.RootDir = root
+	config.Performance.Connections = &ConnectionConfig{MaxRequestsPerConn: 2, IdleTimeout: 5}
+
+	logger, _ := NewLogger(&LoggingConfig{Enabled: false})
+	server := NewServer(config, logger)
+	server.setupHandlers()
+
+	ts := httptest.NewUnstartedServer(nil)
+	ts.Config = server.httpServer("")
+	ts.Start()
+	defer ts.Close()
+
+	client := ts.Client()
+	for i, wantClose := range []bool{false, true, false} {
+		resp, err := client.Get(ts.URL + "/file.txt")
+		if err != nil {
+			t.Fatalf("Request %d failed: %v", i, err)
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("Request %d: expected status 200, got %d", i, resp.StatusCode)
+		}
+		// The counter restarts on the new connection opened after the close
+		if resp.Close != wantClose {
+			t.Errorf("Request %d: expected Close=%v, got %v", i, wantClose, resp.Close)
+		}
+	}
+}
+
+func TestTunedListener(t *testing.T) {
+	addrs := []ListenAddr{{Network: "tcp", Host: "127.0.0.1", Port: 0}}
+	listeners, err := listen(addrs, &ConnectionConfig{TCPKeepAlive: -1, DisableNoDelay: true, ReadBuffer: 64 << 10})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer listeners[0].Close()
+
+	if _, ok := listeners[0].(*tunedListener); !ok {
+		t.Fatalf("Expected tuned listener, got %T", listeners[0])
+	}
+
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	ts.Listener = listeners[0]
+	ts.Start()
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "ok" {
+		t.Errorf("Expected body ok, got %q", body)
+	}
+}
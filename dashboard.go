@@ -0,0 +1,135 @@
+package main
+
+import (
+	"html/template"
+	"net/http"
+	"sort"
+)
+
+// dashboardTemplate painel administrativo (atualiza a cada 10s)
+var dashboardTemplate = template.Must(template.New("dashboard").Funcs(template.FuncMap{
+	"mul100": func(v float64) float64 { return v * 100 },
+}).Parse(dashboardHTML))
+
+// handleAdminDashboard renderiza o painel com os rankings e as estatísticas de download
+func (s *Server) handleAdminDashboard(w http.ResponseWriter, r *http.Request) {
+	window := r.URL.Query().Get("window")
+	if window == "" {
+		window = "5m"
+	}
+	report, err := s.traffic.Report(window, 10)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	statuses := make([]TopEntry, 0, len(report.Statuses))
+	for status, count := range report.Statuses {
+		statuses = append(statuses, TopEntry{Key: status, Count: count})
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Key < statuses[j].Key })
+
+	var downloads []DownloadReport
+	if s.downloads != nil {
+		downloads = s.downloads.Report()
+		if len(downloads) > 10 {
+			downloads = downloads[:10]
+		}
+	}
+
+	data := struct {
+		Windows   []string
+		Report    *TrafficReport
+		Statuses  []TopEntry
+		Downloads []DownloadReport
+		Route     string
+	}{
+		Windows:   []string{"1m", "5m", "1h"},
+		Report:    report,
+		Statuses:  statuses,
+		Downloads: downloads,
+		Route:     s.adminRoute(),
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := dashboardTemplate.Execute(w, data); err != nil {
+		s.logger.Error("Error rendering dashboard: %v", err)
+	}
+}
+
+// Template do painel administrativo
+const dashboardHTML = `<!DOCTYPE html>
+<html lang="en">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <meta http-equiv="refresh" content="10">
+    <title>qserv dashboard</title>
+    <style>
+        * { margin: 0; padding: 0; box-sizing: border-box; }
+        body {
+            font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, Oxygen, Ubuntu, Cantarell, sans-serif;
+            padding: 2rem;
+            background: #f5f5f5;
+        }
+        h1 { margin-bottom: 1rem; color: #2c3e50; }
+        nav { margin-bottom: 1.5rem; }
+        nav a { margin-right: 1rem; color: #3498db; text-decoration: none; }
+        nav a.active { font-weight: 600; color: #2c3e50; }
+        .grid { display: grid; grid-template-columns: repeat(auto-fit, minmax(360px, 1fr)); gap: 1.5rem; }
+        .card {
+            background: white;
+            border-radius: 8px;
+            box-shadow: 0 2px 8px rgba(0,0,0,0.1);
+            overflow: hidden;
+        }
+        h2 { padding: 1rem; background: #34495e; color: white; font-size: 1rem; }
+        table { width: 100%; border-collapse: collapse; }
+        td, th { padding: 0.5rem 1rem; border-bottom: 1px solid #ecf0f1; text-align: left; }
+        td.count { text-align: right; color: #7f8c8d; }
+        .key { word-break: break-all; }
+    </style>
+</head>
+<body>
+    <h1>qserv &mdash; {{.Report.Requests}} requests in the last {{.Report.Window}}</h1>
+    <nav>
+        {{range .Windows}}<a href="{{$.Route}}/dashboard?window={{.}}"{{if eq . $.Report.Window}} class="active"{{end}}>{{.}}</a>{{end}}
+    </nav>
+    <div class="grid">
+        <div class="card">
+            <h2>Status codes</h2>
+            <table>{{range .Statuses}}<tr><td>{{.Key}}</td><td class="count">{{.Count}}</td></tr>{{end}}</table>
+        </div>
+        <div class="card">
+            <h2>Top paths</h2>
+            <table>{{range .Report.TopPaths}}<tr><td class="key">{{.Key}}</td><td class="count">{{.Count}}</td></tr>{{end}}</table>
+        </div>
+        <div class="card">
+            <h2>Top client IPs</h2>
+            <table>{{range .Report.TopIPs}}<tr><td class="key">{{.Key}}</td><td class="count">{{.Count}}</td></tr>{{end}}</table>
+        </div>
+        <div class="card">
+            <h2>Top referers</h2>
+            <table>{{range .Report.TopReferers}}<tr><td class="key">{{.Key}}</td><td class="count">{{.Count}}</td></tr>{{end}}</table>
+        </div>
+        {{if .Downloads}}
+        <div class="card">
+            <h2>Large downloads</h2>
+            <table>
+                <tr><th>Path</th><th>Downloads</th><th>Resumed</th><th>Aborted</th><th>Avg. completed</th></tr>
+                {{range .Downloads}}
+                <tr>
+                    <td class="key">{{.Path}}</td>
+                    <td class="count">{{.Downloads}}</td>
+                    <td class="count">{{printf "%.0f%%" (mul100 .ResumeRate)}}</td>
+                    <td class="count">{{printf "%.0f%%" (mul100 .AbortRate)}}</td>
+                    <td class="count">{{printf "%.0f%%" (mul100 .AvgCompletedFraction)}}</td>
+                </tr>
+                {{end}}
+            </table>
+        </div>
+        {{end}}
+    </div>
+</body>
+</html>`
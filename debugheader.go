@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// debugInfoKey chave do contexto com as anotações de diagnóstico
+type debugInfoKey struct{}
+
+// debugInfo anotações feitas pelos handlers durante a requisição
+type debugInfo struct {
+	mu    sync.Mutex
+	start time.Time
+	notes []string
+}
+
+// debugNote anota um item do header X-Qserv-Debug; não faz nada se a
+// requisição não pediu diagnóstico
+func debugNote(r *http.Request, key, value string) {
+	info, ok := r.Context().Value(debugInfoKey{}).(*debugInfo)
+	if !ok {
+		return
+	}
+	info.mu.Lock()
+	info.notes = append(info.notes, key+"="+value)
+	info.mu.Unlock()
+}
+
+// debugTiming anota uma duração
+func debugTiming(r *http.Request, key string, d time.Duration) {
+	debugNote(r, key, d.Round(time.Microsecond).String())
+}
+
+// debugAuthorized informa se o cliente pode receber o diagnóstico
+func debugAuthorized(config *DebugHeaderConfig, r *http.Request) bool {
+	token := r.Header.Get("X-Qserv-Debug")
+	if config.Token != "" && token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(config.Token)) == 1 {
+		return true
+	}
+	ip, _, _ := net.SplitHostPort(r.RemoteAddr)
+	for _, allowed := range config.AllowedIPs {
+		if ip == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// debugWriter acrescenta o header de diagnóstico antes de enviar a resposta
+type debugWriter struct {
+	http.ResponseWriter
+	info    *debugInfo
+	written bool
+}
+
+func (w *debugWriter) WriteHeader(code int) {
+	w.addHeader()
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *debugWriter) Write(b []byte) (int, error) {
+	w.addHeader()
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap permite ao http.ResponseController acessar o writer original
+func (w *debugWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// addHeader monta o header com as anotações, a compressão aplicada e o
+// tempo até o início da resposta
+func (w *debugWriter) addHeader() {
+	if w.written {
+		return
+	}
+	w.written = true
+
+	encoding := w.Header().Get("Content-Encoding")
+	if encoding == "" {
+		encoding = "identity"
+	}
+	w.info.mu.Lock()
+	notes := append(w.info.notes, "encoding="+encoding, "ttfb="+time.Since(w.info.start).Round(time.Microsecond).String())
+	w.Header().Set("X-Qserv-Debug", strings.Join(notes, "; "))
+	w.info.mu.Unlock()
+}
+
+// DebugHeaderMiddleware responde com X-Qserv-Debug aos clientes autorizados
+// que enviarem o header na requisição
+func DebugHeaderMiddleware(config *DebugHeaderConfig) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("X-Qserv-Debug") == "" || !debugAuthorized(config, r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			info := &debugInfo{start: time.Now()}
+			ctx := context.WithValue(r.Context(), debugInfoKey{}, info)
+			next.ServeHTTP(&debugWriter{ResponseWriter: w, info: info}, r.WithContext(ctx))
+		})
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDebugHeader(t *testing.T) {
+	root := t.TempDir()
+	os.WriteFile(filepath.Join(root, "notes.txt"), []byte("hello"), 0644)
+	server := newListingTestServer(t, root, func(c *Config) {
+		c.Logging.DebugHeader = &DebugHeaderConfig{Enabled: true, Token: "s3cret"}
+	})
+
+	req := httptest.NewRequest("GET", "/notes.txt", nil)
+	req.Header.Set("X-Qserv-Debug", "s3cret")
+	w := httptest.NewRecorder()
+	server.mux.ServeHTTP(w, req)
+	header := w.Header().Get("X-Qserv-Debug")
+	for _, want := range []string{"backend=files", "serve=file", "encoding=identity", "ttfb="} {
+		if !strings.Contains(header, want) {
+			t.Errorf("Expected %q in debug header, got %q", want, header)
+		}
+	}
+
+	// Wrong token or no token: no header
+	for _, token := range []string{"wrong", ""} {
+		req = httptest.NewRequest("GET", "/notes.txt", nil)
+		if token != "" {
+			req.Header.Set("X-Qserv-Debug", token)
+		}
+		w = httptest.NewRecorder()
+		server.mux.ServeHTTP(w, req)
+		if header := w.Header().Get("X-Qserv-Debug"); header != "" {
+			t.Errorf("Expected no debug header for token %q, got %q", token, header)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// BlobStore armazenamento endereçado por conteúdo: arquivos com o mesmo
+// conteúdo e permissões viram hardlinks de um único blob. Serve às versões
+// do deploy e aos uploads (PUT, POST, envio em partes e PUT do WebDAV); o
+// diretório precisa estar no mesmo sistema de arquivos que os arquivos
+type BlobStore struct {
+	dir string
+}
+
+// Link troca path pelo blob de mesmo conteúdo ou, sendo inédito, guarda-o
+// como blob. Retorna se path passou a apontar para um blob já existente;
+// sem hardlink (ex: outro sistema de arquivos) path fica como está e o erro
+// volta com deduped false
+func (b *BlobStore) Link(path string) (deduped bool, err error) {
+	info, err := os.Lstat(path)
+	if err != nil || !info.Mode().IsRegular() {
+		return false, err
+	}
+	sum, err := hashFile(path)
+	if err != nil {
+		return false, err
+	}
+	blob := filepath.Join(b.dir, sum[:2], sum)
+
+	if existing, err := os.Stat(blob); err == nil {
+		if existing.Size() != info.Size() || existing.Mode() != info.Mode() || os.SameFile(existing, info) {
+			return false, nil
+		}
+		tmp := filepath.Join(filepath.Dir(path), ".dedup-"+filepath.Base(path))
+		if err := os.Link(blob, tmp); err != nil {
+			return false, err
+		}
+		if err := os.Rename(tmp, path); err != nil {
+			os.Remove(tmp)
+			return false, err
+		}
+		return true, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(blob), 0755); err != nil {
+		return false, err
+	}
+	if err := os.Link(path, blob); err != nil && !os.IsExist(err) {
+		return false, err
+	}
+	return false, nil
+}
+
+// Prune passa a remove os blobs que nada mais usa (só o próprio
+// armazenamento aponta para eles)
+func (b *BlobStore) Prune(remove func(string, fs.FileInfo)) {
+	filepath.WalkDir(b.dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || !entry.Type().IsRegular() {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil
+		}
+		if links, ok := linkCount(info); ok && links <= 1 {
+			remove(path, info)
+		}
+		return nil
+	})
+}
+
+// blobs retorna o armazenamento das versões
+func (d *Deployer) blobs() *BlobStore {
+	if d.config.BlobsDir == "" {
+		return &BlobStore{dir: filepath.Join(d.releasesDir(), ".blobs")}
+	}
+	return &BlobStore{dir: d.config.BlobsDir}
+}
+
+// dedup troca os arquivos da nova versão por hardlinks de blobs com o mesmo
+// conteúdo (e permissões), guardando os inéditos no armazenamento. Arquivos
+// que não puderem ser ligados (ex: outro sistema de arquivos) ficam como estão.
+func (d *Deployer) dedup(release string) (files int, saved int64, err error) {
+	blobs := d.blobs()
+	err = filepath.WalkDir(release, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		deduped, err := blobs.Link(path)
+		if err != nil {
+			d.server.logger.Warn("Deploy dedup %s: %v", path, err)
+			return nil
+		}
+		if deduped {
+			files++
+			saved += info.Size()
+		}
+		return nil
+	})
+	return files, saved, err
+}
+
+// pruneBlobs remove os blobs que nenhuma versão usa mais
+func (d *Deployer) pruneBlobs() {
+	removed := 0
+	d.blobs().Prune(func(path string, info fs.FileInfo) {
+		if os.Remove(path) == nil {
+			removed++
+		}
+	})
+	if removed > 0 {
+		d.server.logger.Info("Deploy dedup: removed %d unused blobs", removed)
+	}
+}
+
+// dedupUpload liga ao armazenamento de blobs o temporário de um upload,
+// antes de ele ser renomeado para o destino. Falhas só custam espaço: o
+// arquivo segue como está
+func (s *Server) dedupUpload(tmp, urlPath string) {
+	if s.uploads == nil || s.uploads.blobs == nil {
+		return
+	}
+	deduped, err := s.uploads.blobs.Link(tmp)
+	if err != nil {
+		s.logger.Warn("Upload dedup %s: %v", urlPath, err)
+	} else if deduped {
+		s.logger.Debug("Upload dedup: %s matches a stored blob", urlPath)
+	}
+}
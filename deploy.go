@@ -0,0 +1,363 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Deployer executa a ação de deploy configurada e publica o resultado
+// como novo diretório raiz
+type Deployer struct {
+	config *DeployConfig
+	server *Server
+
+	running sync.Mutex
+	spools  chan struct{} // corpos sendo gravados em disco
+	mu      sync.Mutex
+	last    *DeployStatus
+}
+
+// DeployStatus resultado de um deploy
+type DeployStatus struct {
+	Action       string    `json:"action"`
+	Status       string    `json:"status"` // success, unchanged ou failed
+	RootDir      string    `json:"root_dir"`
+	Previous     string    `json:"previous,omitempty"`
+	Commit       string    `json:"commit,omitempty"`
+	StartedAt    time.Time `json:"started_at"`
+	Duration     string    `json:"duration"`
+	Error        string    `json:"error,omitempty"`
+	Deduplicated int       `json:"deduplicated,omitempty"` // arquivos trocados por hardlinks (dedup)
+	SavedBytes   int64     `json:"saved_bytes,omitempty"`
+}
+
+// errDeployInProgress deploy concorrente recusado
+var errDeployInProgress = errors.New("deploy already in progress")
+
+// NewDeployer cria um novo deployer
+func NewDeployer(config *DeployConfig, server *Server) *Deployer {
+	return &Deployer{config: config, server: server, spools: make(chan struct{}, maxDeploySpools)}
+}
+
+// maxDeploySpools corpos de deploy gravados em disco ao mesmo tempo
+const maxDeploySpools = 2
+
+// route retorna a rota do webhook
+func (d *Deployer) route() string {
+	if d.config.Route == "" {
+		return "/_deploy"
+	}
+	return d.config.Route
+}
+
+// releasesDir retorna o diretório das versões publicadas
+func (d *Deployer) releasesDir() string {
+	if d.config.ReleasesDir == "" {
+		return ".qserv-releases"
+	}
+	return d.config.ReleasesDir
+}
+
+// maxUploadSize retorna o limite do upload em bytes
+func (d *Deployer) maxUploadSize() int64 {
+	if d.config.MaxUploadSize <= 0 {
+		return 512 << 20
+	}
+	return d.config.MaxUploadSize << 20
+}
+
+// Handler retorna o handler do webhook
+func (d *Deployer) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			if !d.authorizedByToken(r) {
+				d.unauthorized(w)
+				return
+			}
+			d.mu.Lock()
+			last := d.last
+			d.mu.Unlock()
+			if last == nil {
+				writeJSON(w, http.StatusOK, map[string]string{"status": "idle"})
+				return
+			}
+			writeJSON(w, http.StatusOK, last)
+
+		case http.MethodPost:
+			d.handleDeploy(w, r)
+
+		default:
+			w.Header().Set("Allow", "GET, POST")
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		}
+	})
+}
+
+// handleDeploy autentica a requisição e executa o deploy
+func (d *Deployer) handleDeploy(w http.ResponseWriter, r *http.Request) {
+	// O token é conferido antes de ler o corpo; sem ele, só vale a pena
+	// gravar o corpo se houver assinatura HMAC para conferir
+	byToken := d.authorizedByToken(r)
+	if !byToken && !d.signed(r) {
+		d.unauthorized(w)
+		return
+	}
+
+	var body *os.File
+	if d.config.Action == "upload" || !byToken {
+		select {
+		case d.spools <- struct{}{}:
+			defer func() { <-d.spools }()
+		default:
+			writeJSONError(w, http.StatusServiceUnavailable, errors.New("too many deploy uploads in progress"))
+			return
+		}
+		var err error
+		body, err = d.spoolBody(w, r)
+		if err != nil {
+			writeJSONError(w, http.StatusRequestEntityTooLarge, err)
+			return
+		}
+		defer os.Remove(body.Name())
+		defer body.Close()
+
+		if !byToken && !d.authorizedBySignature(r, body) {
+			d.unauthorized(w)
+			return
+		}
+	}
+
+	status, err := d.Deploy(body, r.Header.Get("Content-Type"))
+	switch {
+	case errors.Is(err, errDeployInProgress):
+		writeJSONError(w, http.StatusConflict, err)
+	case err != nil:
+		writeJSON(w, http.StatusInternalServerError, status)
+	default:
+		writeJSON(w, http.StatusOK, status)
+	}
+}
+
+// spoolBody grava o corpo da requisição em um arquivo temporário
+func (d *Deployer) spoolBody(w http.ResponseWriter, r *http.Request) (*os.File, error) {
+	file, err := os.CreateTemp("", "qserv-deploy-*")
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := io.Copy(file, http.MaxBytesReader(w, r.Body, d.maxUploadSize())); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return nil, fmt.Errorf("upload exceeds %d bytes", d.maxUploadSize())
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return nil, err
+	}
+	return file, nil
+}
+
+// authorizedByToken valida o header Authorization: Bearer <token>
+func (d *Deployer) authorizedByToken(r *http.Request) bool {
+	if d.config.Token == "" {
+		return false
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(token), []byte(d.config.Token)) == 1
+}
+
+// signed informa se a requisição traz uma assinatura HMAC a conferir
+func (d *Deployer) signed(r *http.Request) bool {
+	return d.config.Secret != "" && strings.HasPrefix(r.Header.Get("X-Hub-Signature-256"), "sha256=")
+}
+
+// authorizedBySignature valida o header X-Hub-Signature-256 (HMAC-SHA256 do corpo)
+func (d *Deployer) authorizedBySignature(r *http.Request, body io.ReadSeeker) bool {
+	signature, ok := strings.CutPrefix(r.Header.Get("X-Hub-Signature-256"), "sha256=")
+	if d.config.Secret == "" || !ok {
+		return false
+	}
+	expected, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, []byte(d.config.Secret))
+	if _, err := io.Copy(mac, body); err != nil {
+		return false
+	}
+	if _, err := body.Seek(0, io.SeekStart); err != nil {
+		return false
+	}
+	return hmac.Equal(mac.Sum(nil), expected)
+}
+
+// unauthorized responde 401
+func (d *Deployer) unauthorized(w http.ResponseWriter) {
+	w.Header().Set("WWW-Authenticate", `Bearer realm="deploy"`)
+	http.Error(w, "Unauthorized", http.StatusUnauthorized)
+}
+
+// Deploy executa a ação configurada. body só é usado pela ação upload.
+func (d *Deployer) Deploy(body *os.File, contentType string) (*DeployStatus, error) {
+	if !d.running.TryLock() {
+		return nil, errDeployInProgress
+	}
+	defer d.running.Unlock()
+
+	status := &DeployStatus{Action: d.config.Action, StartedAt: time.Now()}
+	err := d.run(status, body, contentType)
+
+	status.Duration = time.Since(status.StartedAt).Round(time.Millisecond).String()
+	status.RootDir = d.server.RootDir()
+	if err != nil {
+		status.Status = "failed"
+		status.Error = err.Error()
+		d.server.logger.Error("Deploy (%s) failed: %v", d.config.Action, err)
+	} else {
+		d.server.logger.Info("Deploy (%s) %s in %s", d.config.Action, status.Status, status.Duration)
+	}
+
+	d.mu.Lock()
+	d.last = status
+	d.mu.Unlock()
+
+	return status, err
+}
+
+// run executa a ação de deploy
+func (d *Deployer) run(status *DeployStatus, body *os.File, contentType string) error {
+	if d.config.Action == "git" {
+		if d.server.git == nil {
+			return fmt.Errorf("git action requires the git source to be enabled")
+		}
+		gitStatus, err := d.server.git.Sync()
+		status.Commit = gitStatus.Commit
+		status.Status = "success"
+		if !gitStatus.Changed {
+			status.Status = "unchanged"
+		}
+		return err
+	}
+
+	if err := os.MkdirAll(d.releasesDir(), 0755); err != nil {
+		return err
+	}
+	release, err := os.MkdirTemp(d.releasesDir(), ".tmp-")
+	if err != nil {
+		return err
+	}
+
+	switch d.config.Action {
+	case "rsync":
+		err = d.rsync(release)
+	case "upload":
+		err = d.unpack(body, contentType, release)
+	default:
+		err = fmt.Errorf("unknown deploy action: %s", d.config.Action)
+	}
+	if err != nil {
+		os.RemoveAll(release)
+		return err
+	}
+
+	// Conteúdo repetido vira hardlink do armazenamento de blobs
+	if d.config.Dedup {
+		status.Deduplicated, status.SavedBytes, err = d.dedup(release)
+		if err != nil {
+			os.RemoveAll(release)
+			return err
+		}
+	}
+
+	// Publica a versão com um nome definitivo antes da troca
+	target := filepath.Join(d.releasesDir(), time.Now().UTC().Format("20060102T150405.000000000"))
+	if err := os.Rename(release, target); err != nil {
+		os.RemoveAll(release)
+		return err
+	}
+
+	previous, _, err := d.server.SwapRoot(target)
+	if err != nil {
+		os.RemoveAll(target)
+		return err
+	}
+	status.Previous = previous.dir
+	status.Status = "success"
+
+	go func() {
+		<-previous.drained
+		d.server.pruneSnapshots(d.releasesDir(), d.config.KeepReleases)
+		if d.config.Dedup {
+			d.pruneBlobs()
+		}
+	}()
+
+	return nil
+}
+
+// rsync copia a origem configurada para a nova versão
+func (d *Deployer) rsync(release string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	defer cancel()
+
+	source := strings.TrimSuffix(d.config.Source, "/") + "/"
+	args := []string{"-a", "--delete"}
+	// Arquivos inalterados viram hardlinks da versão atual
+	if current := d.server.RootDir(); current != "" {
+		args = append(args, "--link-dest="+current)
+	}
+	args = append(args, source, release+"/")
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "rsync", args...)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("rsync: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// unpack extrai o artefato enviado (zip ou tar.gz)
+func (d *Deployer) unpack(body *os.File, contentType, release string) error {
+	if body == nil {
+		return fmt.Errorf("upload action requires an artifact in the request body")
+	}
+	info, err := body.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() == 0 {
+		return fmt.Errorf("upload action requires an artifact in the request body")
+	}
+
+	switch contentType {
+	case "application/gzip", "application/x-gzip", "application/x-tar+gzip":
+		gz, err := gzip.NewReader(body)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		return extractTar(gz, release)
+	default:
+		return extractZip(body, info.Size(), release)
+	}
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// newDeployTestServer creates a server with the upload deploy action enabled
+func newDeployTestServer(t *testing.T) *Server {
+	t.Helper()
+
+	config := DefaultConfig()
+	config.Server.RootDir = t.TempDir()
+	config.Deploy = &DeployConfig{
+		Enabled:     true,
+		Token:       "deploy-token",
+		Secret:      "hook-secret",
+		Action:      "upload",
+		ReleasesDir: t.TempDir(),
+	}
+	logger, _ := NewLogger(&LoggingConfig{Enabled: false})
+	server := NewServer(config, logger)
+	server.setupHandlers()
+	return server
+}
+
+// buildZip creates a zip archive with the given files
+func buildZip(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range files {
+		f, err := zw.Create(name)
+		if err != nil {
+			t.Fatalf("Failed to create zip entry: %v", err)
+		}
+		f.Write([]byte(content))
+	}
+	zw.Close()
+	return buf.Bytes()
+}
+
+func TestDeployUploadWithToken(t *testing.T) {
+	server := newDeployTestServer(t)
+	artifact := buildZip(t, map[string]string{"index.html": "<h1>v2</h1>", "assets/app.js": "console.log(2)"})
+
+	req := httptest.NewRequest("POST", "/_deploy", bytes.NewReader(artifact))
+	req.Header.Set("Authorization", "Bearer deploy-token")
+	req.Header.Set("Content-Type", "application/zip")
+	w := httptest.NewRecorder()
+	server.mux.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var status DeployStatus
+	if err := json.Unmarshal(w.Body.Bytes(), &status); err != nil {
+		t.Fatalf("Invalid JSON response: %v", err)
+	}
+	if status.Status != "success" {
+		t.Errorf("Expected success, got %s (%s)", status.Status, status.Error)
+	}
+
+	content, err := os.ReadFile(filepath.Join(server.RootDir(), "assets", "app.js"))
+	if err != nil || string(content) != "console.log(2)" {
+		t.Errorf("Expected deployed artifact to be served, got %q (%v)", content, err)
+	}
+
+	// Last status is available through GET
+	req = httptest.NewRequest("GET", "/_deploy", nil)
+	req.Header.Set("Authorization", "Bearer deploy-token")
+	w = httptest.NewRecorder()
+	server.mux.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || !bytes.Contains(w.Body.Bytes(), []byte(`"success"`)) {
+		t.Errorf("Expected last deploy status, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestDeployWithSignature(t *testing.T) {
+	server := newDeployTestServer(t)
+	artifact := buildZip(t, map[string]string{"index.html": "signed"})
+
+	sign := func(secret string) string {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(artifact)
+		return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	}
+
+	tests := []struct {
+		name           string
+		signature      string
+		expectedStatus int
+	}{
+		{"NoSignature", "", http.StatusUnauthorized},
+		{"WrongSecret", sign("wrong"), http.StatusUnauthorized},
+		{"ValidSignature", sign("hook-secret"), http.StatusOK},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/_deploy", bytes.NewReader(artifact))
+			if test.signature != "" {
+				req.Header.Set("X-Hub-Signature-256", test.signature)
+			}
+			w := httptest.NewRecorder()
+			server.mux.ServeHTTP(w, req)
+
+			if w.Code != test.expectedStatus {
+				t.Errorf("Expected status %d, got %d: %s", test.expectedStatus, w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+// readTracker records whether the handler read the request body
+type readTracker struct {
+	read bool
+}
+
+func (r *readTracker) Read(p []byte) (int, error) {
+	r.read = true
+	return 0, io.EOF
+}
+
+func TestDeployRejectsBeforeSpooling(t *testing.T) {
+	server := newDeployTestServer(t)
+
+	// Without a valid token or a signature to check, the body is never read
+	for _, header := range []map[string]string{
+		{},
+		{"Authorization": "Bearer wrong"},
+		{"X-Hub-Signature-256": "not-a-signature"},
+	} {
+		body := &readTracker{}
+		req := httptest.NewRequest("POST", "/_deploy", body)
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		server.mux.ServeHTTP(w, req)
+		if w.Code != http.StatusUnauthorized || body.read {
+			t.Errorf("%v: Expected 401 without reading the body, got %d (read %v)", header, w.Code, body.read)
+		}
+	}
+
+	// Concurrent spools are capped
+	for i := 0; i < cap(server.deployer.spools); i++ {
+		server.deployer.spools <- struct{}{}
+	}
+	req := httptest.NewRequest("POST", "/_deploy", bytes.NewReader(buildZip(t, map[string]string{"index.html": "x"})))
+	req.Header.Set("Authorization", "Bearer deploy-token")
+	w := httptest.NewRecorder()
+	server.mux.ServeHTTP(w, req)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 with every spool slot taken, got %d", w.Code)
+	}
+}
+
+func TestDeployRouteAppliesIPFilter(t *testing.T) {
+	server := newDeployTestServer(t)
+	server.config.Security.IPBlacklist = []string{"192.0.2.1"}
+
+	req := httptest.NewRequest("POST", "/_deploy", nil)
+	req.Header.Set("Authorization", "Bearer deploy-token")
+	w := httptest.NewRecorder()
+	server.mux.ServeHTTP(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 for a blacklisted client, got %d", w.Code)
+	}
+}
+
+func TestDeployRejectsInvalidArtifact(t *testing.T) {
+	server := newDeployTestServer(t)
+	before := server.RootDir()
+
+	req := httptest.NewRequest("POST", "/_deploy", bytes.NewReader([]byte("not a zip")))
+	req.Header.Set("Authorization", "Bearer deploy-token")
+	w := httptest.NewRecorder()
+	server.mux.ServeHTTP(w, req)
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("Expected 500 for invalid artifact, got %d", w.Code)
+	}
+	if server.RootDir() != before {
+		t.Errorf("Root should not change after a failed deploy")
+	}
+}
+
+func TestDeployDedup(t *testing.T) {
+	server := newDeployTestServer(t)
+	server.config.Deploy.Dedup = true
+	files := map[string]string{"index.html": "<h1>v1</h1>", "assets/app.js": "console.log(1)"}
+
+	first, err := server.deployer.Deploy(writeTempArtifact(t, buildZip(t, files)), "application/zip")
+	if err != nil {
+		t.Fatalf("First deploy failed: %v", err)
+	}
+	files["index.html"] = "<h1>v2</h1>"
+	second, err := server.deployer.Deploy(writeTempArtifact(t, buildZip(t, files)), "application/zip")
+	if err != nil {
+		t.Fatalf("Second deploy failed: %v", err)
+	}
+
+	if first.Deduplicated != 0 || second.Deduplicated != 1 {
+		t.Errorf("Expected 0 then 1 deduplicated files, got %d and %d", first.Deduplicated, second.Deduplicated)
+	}
+	a, _ := os.Stat(filepath.Join(first.RootDir, "assets", "app.js"))
+	b, _ := os.Stat(filepath.Join(second.RootDir, "assets", "app.js"))
+	if a == nil || b == nil || !os.SameFile(a, b) {
+		t.Errorf("Expected unchanged file to be shared between releases")
+	}
+	content, _ := os.ReadFile(filepath.Join(second.RootDir, "index.html"))
+	if string(content) != "<h1>v2</h1>" {
+		t.Errorf("Expected changed file to be stored separately, got %q", content)
+	}
+}
+
+// writeTempArtifact stores an artifact in a temporary file, as the webhook does
+func writeTempArtifact(t *testing.T, data []byte) *os.File {
+	t.Helper()
+	f, err := os.CreateTemp(t.TempDir(), "artifact-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { f.Close() })
+	f.Write(data)
+	f.Seek(0, 0)
+	return f
+}
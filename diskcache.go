@@ -0,0 +1,395 @@
+package main
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DiskCache cache de respostas HTTP em disco com eviction LRU por tamanho.
+// Cada entrada é composta por um arquivo .meta (JSON) e um arquivo .body.
+type DiskCache struct {
+	name    string
+	dir     string
+	maxSize int64
+
+	mu      sync.Mutex
+	entries map[string]*list.Element // chave -> elemento do LRU
+	lru     *list.List               // frente = acesso mais recente
+	size    int64
+}
+
+// diskCacheEntry metadados de uma resposta armazenada
+type diskCacheEntry struct {
+	Key     string      `json:"key"`
+	Status  int         `json:"status"`
+	Header  http.Header `json:"header"`
+	Stored  time.Time   `json:"stored"`
+	Expires time.Time   `json:"expires"`
+	Size    int64       `json:"size"`
+
+	// Janelas após a expiração em que a entrada ainda pode ser servida (RFC 5861)
+	StaleWhileRevalidate time.Duration `json:"stale_while_revalidate,omitempty"`
+	StaleIfError         time.Duration `json:"stale_if_error,omitempty"`
+}
+
+// Fresh indica se a entrada ainda pode ser servida sem revalidação
+func (e *diskCacheEntry) Fresh(now time.Time) bool {
+	return now.Before(e.Expires)
+}
+
+// ServeWhileRevalidating indica se a entrada expirada pode ser servida
+// enquanto é revalidada em segundo plano
+func (e *diskCacheEntry) ServeWhileRevalidating(now time.Time) bool {
+	return now.Before(e.Expires.Add(e.StaleWhileRevalidate))
+}
+
+// ServeOnError indica se a entrada expirada pode ser servida quando a origem falha
+func (e *diskCacheEntry) ServeOnError(now time.Time) bool {
+	return now.Before(e.Expires.Add(e.StaleIfError))
+}
+
+// ModTime retorna o Last-Modified armazenado (ou o momento em que foi gravada)
+func (e *diskCacheEntry) ModTime() time.Time {
+	if t, err := http.ParseTime(e.Header.Get("Last-Modified")); err == nil {
+		return t
+	}
+	return e.Stored
+}
+
+// NewDiskCache abre (ou cria) um cache em dir, carregando as entradas existentes
+func NewDiskCache(name, dir string, maxSize int64) (*DiskCache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	c := &DiskCache{
+		name:    name,
+		dir:     dir,
+		maxSize: maxSize,
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+	}
+
+	if err := c.load(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Name identifica o cache (Purger)
+func (c *DiskCache) Name() string {
+	return c.name
+}
+
+// load reconstrói o índice a partir dos arquivos .meta, do mais antigo ao mais recente
+func (c *DiskCache) load() error {
+	type loaded struct {
+		entry   *diskCacheEntry
+		modTime time.Time
+	}
+	var found []loaded
+
+	err := filepath.WalkDir(c.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		// Restos de gravações interrompidas
+		if strings.HasSuffix(path, ".tmp") {
+			os.Remove(path)
+			return nil
+		}
+		if !strings.HasSuffix(path, ".meta") {
+			return nil
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil
+		}
+		var entry diskCacheEntry
+		if json.Unmarshal(data, &entry) != nil {
+			os.Remove(path)
+			return nil
+		}
+		info, _ := d.Info()
+		found = append(found, loaded{entry: &entry, modTime: info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	sort.Slice(found, func(i, j int) bool {
+		return found[i].modTime.Before(found[j].modTime)
+	})
+
+	for _, item := range found {
+		// Ordem aproximada de uso: a última gravação fica na frente
+		if elem, ok := c.entries[item.entry.Key]; ok {
+			c.size -= elem.Value.(*diskCacheEntry).Size
+			c.lru.Remove(elem)
+		}
+		c.entries[item.entry.Key] = c.lru.PushFront(item.entry)
+		c.size += item.entry.Size
+	}
+	c.mu.Lock()
+	c.evict()
+	c.mu.Unlock()
+	return nil
+}
+
+// paths retorna os arquivos de metadados e conteúdo de uma chave
+func (c *DiskCache) paths(key string) (meta, body string) {
+	sum := sha256.Sum256([]byte(key))
+	name := hex.EncodeToString(sum[:])
+	base := filepath.Join(c.dir, name[:2], name)
+	return base + ".meta", base + ".body"
+}
+
+// Get busca uma entrada e a marca como usada recentemente
+func (c *DiskCache) Get(key string) (*diskCacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	c.lru.MoveToFront(elem)
+	entry := *elem.Value.(*diskCacheEntry)
+	return &entry, true
+}
+
+// Open abre o conteúdo de uma entrada
+func (c *DiskCache) Open(key string) (*os.File, error) {
+	_, body := c.paths(key)
+	return os.Open(body)
+}
+
+// DiskCacheWriter gravação de uma nova entrada
+type DiskCacheWriter struct {
+	cache *DiskCache
+	key   string
+	file  *os.File
+	size  int64
+}
+
+// Create inicia a gravação de uma entrada; o conteúdo só fica visível após Commit
+func (c *DiskCache) Create(key string) (*DiskCacheWriter, error) {
+	_, body := c.paths(key)
+	if err := os.MkdirAll(filepath.Dir(body), 0755); err != nil {
+		return nil, err
+	}
+	file, err := os.CreateTemp(filepath.Dir(body), "*.tmp")
+	if err != nil {
+		return nil, err
+	}
+	return &DiskCacheWriter{cache: c, key: key, file: file}, nil
+}
+
+// Write grava parte do conteúdo
+func (w *DiskCacheWriter) Write(p []byte) (int, error) {
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+// Abort descarta a gravação
+func (w *DiskCacheWriter) Abort() {
+	w.file.Close()
+	os.Remove(w.file.Name())
+}
+
+// Commit publica o conteúdo gravado com os metadados informados
+func (w *DiskCacheWriter) Commit(entry *diskCacheEntry) error {
+	if err := w.file.Close(); err != nil {
+		os.Remove(w.file.Name())
+		return err
+	}
+
+	entry.Key = w.key
+	entry.Size = w.size
+
+	_, body := w.cache.paths(w.key)
+	if err := os.Rename(w.file.Name(), body); err != nil {
+		os.Remove(w.file.Name())
+		return err
+	}
+	return w.cache.store(entry)
+}
+
+// Refresh atualiza os metadados de uma entrada (ex: após um 304)
+func (c *DiskCache) Refresh(entry *diskCacheEntry) error {
+	return c.store(entry)
+}
+
+// store grava os metadados e atualiza o índice
+func (c *DiskCache) store(entry *diskCacheEntry) error {
+	meta, _ := c.paths(entry.Key)
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	tmp := meta + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, meta); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[entry.Key]; ok {
+		c.size -= elem.Value.(*diskCacheEntry).Size
+		c.lru.Remove(elem)
+	}
+	stored := *entry
+	c.entries[entry.Key] = c.lru.PushFront(&stored)
+	c.size += entry.Size
+	c.evict()
+	return nil
+}
+
+// Remove apaga uma entrada
+func (c *DiskCache) Remove(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.entries[key]; ok {
+		c.removeElement(elem)
+	}
+}
+
+// Purge remove as entradas cuja chave satisfaz match (Purger)
+func (c *DiskCache) Purge(match func(key string) bool) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var evicted []string
+	for key, elem := range c.entries {
+		if match(key) {
+			c.removeElement(elem)
+			evicted = append(evicted, key)
+		}
+	}
+	return evicted
+}
+
+// Stats retorna o número de entradas e o tamanho total
+func (c *DiskCache) Stats() (entries int, size int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries), c.size
+}
+
+// evict remove as entradas menos usadas até caber no limite (c.mu travado)
+func (c *DiskCache) evict() {
+	for c.maxSize > 0 && c.size > c.maxSize && c.lru.Len() > 0 {
+		c.removeElement(c.lru.Back())
+	}
+}
+
+// removeElement remove uma entrada do índice e do disco (c.mu travado)
+func (c *DiskCache) removeElement(elem *list.Element) {
+	entry := elem.Value.(*diskCacheEntry)
+	c.lru.Remove(elem)
+	delete(c.entries, entry.Key)
+	c.size -= entry.Size
+
+	meta, body := c.paths(entry.Key)
+	os.Remove(meta)
+	os.Remove(body)
+}
+
+// parseCacheControl interpreta o header Cache-Control em diretivas
+func parseCacheControl(h http.Header) map[string]string {
+	directives := make(map[string]string)
+	for _, value := range h.Values("Cache-Control") {
+		for _, part := range strings.Split(value, ",") {
+			name, arg, _ := strings.Cut(strings.TrimSpace(part), "=")
+			if name == "" {
+				continue
+			}
+			directives[strings.ToLower(name)] = strings.Trim(arg, `"`)
+		}
+	}
+	return directives
+}
+
+// directiveSeconds retorna o valor em segundos de uma diretiva, se presente
+func directiveSeconds(directives map[string]string, name string) (time.Duration, bool) {
+	value, ok := directives[name]
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	return time.Duration(n) * time.Second, true
+}
+
+// freshnessLifetime calcula por quanto tempo a resposta é válida (RFC 9111):
+// s-maxage, max-age, Expires e, na falta deles, defaultTTL
+func freshnessLifetime(h http.Header, defaultTTL time.Duration) time.Duration {
+	directives := parseCacheControl(h)
+	if _, ok := directives["no-cache"]; ok {
+		return 0
+	}
+	if d, ok := directiveSeconds(directives, "s-maxage"); ok {
+		return d
+	}
+	if d, ok := directiveSeconds(directives, "max-age"); ok {
+		return d
+	}
+	if expires := h.Get("Expires"); expires != "" {
+		t, err := http.ParseTime(expires)
+		if err != nil {
+			return 0
+		}
+		date, err := http.ParseTime(h.Get("Date"))
+		if err != nil {
+			date = time.Now()
+		}
+		if t.After(date) {
+			return t.Sub(date)
+		}
+		return 0
+	}
+	return defaultTTL
+}
+
+// staleWindows calcula as janelas stale-while-revalidate e stale-if-error de
+// uma resposta: as diretivas da origem têm precedência sobre os valores
+// configurados, e must-revalidate/proxy-revalidate/no-cache as desabilitam
+func staleWindows(h http.Header, swr, sie time.Duration) (time.Duration, time.Duration) {
+	directives := parseCacheControl(h)
+	for _, name := range []string{"must-revalidate", "proxy-revalidate", "no-cache"} {
+		if _, ok := directives[name]; ok {
+			return 0, 0
+		}
+	}
+	if d, ok := directiveSeconds(directives, "stale-while-revalidate"); ok {
+		swr = d
+	}
+	if d, ok := directiveSeconds(directives, "stale-if-error"); ok {
+		sie = d
+	}
+	return swr, sie
+}
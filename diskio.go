@@ -0,0 +1,230 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// DiskIO limita as leituras simultâneas por disco: em discos rotacionais,
+// centenas de leituras grandes em paralelo viram buscas aleatórias e a vazão
+// despenca; cada Read ocupa uma vaga do disco onde o arquivo está
+type DiskIO struct {
+	devices  []*diskDevice // mais específicos (pontos de montagem mais longos) primeiro
+	fallback *diskDevice   // arquivos fora dos pontos conhecidos
+}
+
+// diskDevice semáforo de um ponto de montagem
+type diskDevice struct {
+	mount     string
+	kind      string // hdd ou ssd
+	slots     chan struct{}
+	waits     atomic.Int64 // leituras que esperaram vaga
+	waitNanos atomic.Int64
+}
+
+// diskMount ponto de montagem detectado
+type diskMount struct {
+	path       string
+	rotational bool
+}
+
+// unescapeMountPath desfaz os escapes octais do mountinfo (ex: \040 = espaço)
+func unescapeMountPath(path string) string {
+	var b strings.Builder
+	for i := 0; i < len(path); i++ {
+		if path[i] == '\\' && i+3 < len(path) {
+			var c byte
+			valid := true
+			for _, d := range path[i+1 : i+4] {
+				if d < '0' || d > '7' {
+					valid = false
+					break
+				}
+				c = c*8 + byte(d-'0')
+			}
+			if valid {
+				b.WriteByte(c)
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(path[i])
+	}
+	return b.String()
+}
+
+// NewDiskIO cria os semáforos a partir dos pontos de montagem detectados e
+// dos tipos informados em mounts (que têm precedência)
+func NewDiskIO(config *DiskIOConfig) (*DiskIO, error) {
+	kinds := make(map[string]string)
+	for _, m := range detectMounts() {
+		kinds[filepath.Clean(m.path)] = map[bool]string{true: "hdd", false: "ssd"}[m.rotational]
+	}
+	for path, kind := range config.Mounts {
+		kind = strings.ToLower(kind)
+		if kind != "hdd" && kind != "ssd" {
+			return nil, fmt.Errorf("disk_io: mount %s: invalid type %q (must be hdd or ssd)", path, kind)
+		}
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return nil, fmt.Errorf("disk_io: mount %s: %w", path, err)
+		}
+		kinds[abs] = kind
+	}
+
+	d := &DiskIO{}
+	for path, kind := range kinds {
+		d.devices = append(d.devices, config.newDevice(path, kind))
+	}
+	sort.Slice(d.devices, func(i, j int) bool {
+		return len(d.devices[i].mount) > len(d.devices[j].mount)
+	})
+	d.fallback = config.newDevice("", "ssd")
+	return d, nil
+}
+
+// newDevice cria o semáforo com a concorrência do tipo de disco
+func (c *DiskIOConfig) newDevice(mount, kind string) *diskDevice {
+	n := c.SSDConcurrency
+	if n <= 0 {
+		n = 64
+	}
+	if kind == "hdd" {
+		n = c.HDDConcurrency
+		if n <= 0 {
+			n = 4
+		}
+	}
+	return &diskDevice{mount: mount, kind: kind, slots: make(chan struct{}, n)}
+}
+
+// device retorna o semáforo do disco que contém path
+func (d *DiskIO) device(path string) *diskDevice {
+	path = filepath.Clean(path)
+	for _, dev := range d.devices {
+		if path == dev.mount || strings.HasPrefix(path, strings.TrimSuffix(dev.mount, string(filepath.Separator))+string(filepath.Separator)) {
+			return dev
+		}
+	}
+	return d.fallback
+}
+
+// acquire ocupa uma vaga, registrando a espera quando o disco está cheio
+func (dev *diskDevice) acquire() {
+	select {
+	case dev.slots <- struct{}{}:
+		return
+	default:
+	}
+	start := time.Now()
+	dev.slots <- struct{}{}
+	dev.waits.Add(1)
+	dev.waitNanos.Add(int64(time.Since(start)))
+}
+
+func (dev *diskDevice) release() {
+	<-dev.slots
+}
+
+// Open abre path com as leituras limitadas pelo semáforo do seu disco
+func (d *DiskIO) Open(path string) (*diskFile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &diskFile{file: f, dev: d.device(path)}, nil
+}
+
+// diskFile arquivo cujas leituras passam pelo semáforo. Não expõe WriteTo
+// nem o *os.File: a cópia tem de passar por Read
+type diskFile struct {
+	file *os.File
+	dev  *diskDevice
+}
+
+func (f *diskFile) Read(p []byte) (int, error) {
+	f.dev.acquire()
+	defer f.dev.release()
+	return f.file.Read(p)
+}
+
+func (f *diskFile) Seek(offset int64, whence int) (int64, error) {
+	return f.file.Seek(offset, whence)
+}
+
+func (f *diskFile) Stat() (fs.FileInfo, error) {
+	return f.file.Stat()
+}
+
+func (f *diskFile) Close() error {
+	return f.file.Close()
+}
+
+// diskFS expõe um diretório ao http.ServeFileFS com leituras limitadas
+type diskFS struct {
+	disk *DiskIO
+	dir  string
+}
+
+func (fsys diskFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	f, err := fsys.disk.Open(filepath.Join(fsys.dir, filepath.FromSlash(name)))
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// openDiskFile abre um arquivo a servir, com as leituras limitadas quando
+// performance.disk_io está ligado
+func (s *Server) openDiskFile(path string) (io.ReadSeekCloser, error) {
+	if s.diskIO == nil {
+		return os.Open(path)
+	}
+	f, err := s.diskIO.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// serveDiskFile serve o arquivo como http.ServeFile, com as leituras
+// limitadas por disco quando performance.disk_io está ligado
+func (s *Server) serveDiskFile(w http.ResponseWriter, r *http.Request, path string) {
+	if s.diskIO == nil {
+		http.ServeFile(w, r, path)
+		return
+	}
+	http.ServeFileFS(w, r, diskFS{disk: s.diskIO, dir: filepath.Dir(path)}, filepath.Base(path))
+}
+
+// WriteMetrics exporta ocupação e espera por disco
+func (d *DiskIO) WriteMetrics(w io.Writer) {
+	var inFlight, limits, waits, waitSeconds []metricSample
+	devices := append(append([]*diskDevice(nil), d.devices...), d.fallback)
+	for _, dev := range devices {
+		mount := dev.mount
+		if mount == "" {
+			mount = "other"
+		}
+		labels := map[string]string{"mount": mount, "type": dev.kind}
+		inFlight = append(inFlight, metricSample{labels: labels, value: float64(len(dev.slots))})
+		limits = append(limits, metricSample{labels: labels, value: float64(cap(dev.slots))})
+		waits = append(waits, metricSample{labels: labels, value: float64(dev.waits.Load())})
+		waitSeconds = append(waitSeconds, metricSample{labels: labels, value: time.Duration(dev.waitNanos.Load()).Seconds()})
+	}
+	writeMetric(w, "qserv_disk_reads_in_flight", "Disk reads currently holding a slot, per mount.", "gauge", inFlight)
+	writeMetric(w, "qserv_disk_read_slots", "Concurrent disk reads allowed per mount.", "gauge", limits)
+	writeMetric(w, "qserv_disk_read_waits_total", "Disk reads that had to wait for a free slot.", "counter", waits)
+	writeMetric(w, "qserv_disk_read_wait_seconds_total", "Time disk reads spent waiting for a free slot.", "counter", waitSeconds)
+}
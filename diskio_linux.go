@@ -0,0 +1,46 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// detectMounts lê os pontos de montagem com dispositivo de bloco e se o
+// disco é rotacional (/sys/dev/block/MAJ:MIN/queue/rotational; partições
+// usam a fila do disco pai)
+func detectMounts() []diskMount {
+	f, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	var mounts []diskMount
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// id pai MAJ:MIN raiz ponto-de-montagem ...
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 5 || strings.HasPrefix(fields[2], "0:") {
+			continue
+		}
+		// O link aponta para o dispositivo em /sys/devices (o pai de uma partição é o disco)
+		dev, err := filepath.EvalSymlinks(filepath.Join("/sys/dev/block", fields[2]))
+		if err != nil {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dev, "queue", "rotational"))
+		if err != nil {
+			data, err = os.ReadFile(filepath.Join(dev, "..", "queue", "rotational"))
+		}
+		if err != nil {
+			continue
+		}
+		mounts = append(mounts, diskMount{
+			path:       unescapeMountPath(fields[4]),
+			rotational: strings.TrimSpace(string(data)) == "1",
+		})
+	}
+	return mounts
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package main
+
+// detectMounts não detecta o tipo de disco fora do Linux: sem disk_io.mounts,
+// todos os arquivos usam o limite de SSD
+func detectMounts() []diskMount {
+	return nil
+}
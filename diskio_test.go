@@ -0,0 +1,112 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDiskIODeviceByMount(t *testing.T) {
+	archive := filepath.Join(t.TempDir(), "archive")
+	data := filepath.Dir(archive)
+	d, err := NewDiskIO(&DiskIOConfig{
+		HDDConcurrency: 2,
+		Mounts:         map[string]string{archive: "HDD", data: "ssd"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path string
+		kind string
+		cap  int
+	}{
+		{filepath.Join(archive, "movies", "a.mkv"), "hdd", 2},
+		{archive, "hdd", 2},
+		{filepath.Join(data, "site", "index.html"), "ssd", 64},
+		{archive + "-old/file", "ssd", 64}, // prefix without a path boundary
+	}
+	for _, tt := range tests {
+		dev := d.device(tt.path)
+		if dev.kind != tt.kind || cap(dev.slots) != tt.cap {
+			t.Errorf("%s: expected %s with %d slots, got %s (%s) with %d", tt.path, tt.kind, tt.cap, dev.kind, dev.mount, cap(dev.slots))
+		}
+	}
+
+	if _, err := NewDiskIO(&DiskIOConfig{Mounts: map[string]string{"/mnt": "tape"}}); err == nil {
+		t.Error("Expected an error for an unknown disk type")
+	}
+}
+
+func TestDiskIOLimitsConcurrentReads(t *testing.T) {
+	root := t.TempDir()
+	path := filepath.Join(root, "big.bin")
+	writeTestFile(t, path, strings.Repeat("x", 1024))
+	d, _ := NewDiskIO(&DiskIOConfig{HDDConcurrency: 1, Mounts: map[string]string{root: "hdd"}})
+
+	f, err := d.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	// Another read holds the only slot of the disk
+	f.dev.acquire()
+	done := make(chan struct{})
+	go func() {
+		f.Read(make([]byte, 16))
+		close(done)
+	}()
+	select {
+	case <-done:
+		t.Fatal("Expected the read to wait for a free slot")
+	case <-time.After(50 * time.Millisecond):
+	}
+	f.dev.release()
+	<-done
+
+	if f.dev.waits.Load() != 1 || f.dev.waitNanos.Load() <= 0 {
+		t.Errorf("Expected one recorded wait, got %d (%dns)", f.dev.waits.Load(), f.dev.waitNanos.Load())
+	}
+	if len(f.dev.slots) != 0 {
+		t.Errorf("Expected the slot to be released after the read, got %d in use", len(f.dev.slots))
+	}
+}
+
+func TestDiskIOServesFiles(t *testing.T) {
+	root := t.TempDir()
+	writeTestFile(t, filepath.Join(root, "movie.bin"), "0123456789")
+	server := newListingTestServer(t, root, func(c *Config) {
+		c.Performance.DiskIO = &DiskIOConfig{Enabled: true, HDDConcurrency: 1, Mounts: map[string]string{root: "hdd"}}
+	})
+
+	w := httptest.NewRecorder()
+	server.mux.ServeHTTP(w, httptest.NewRequest("GET", "/movie.bin", nil))
+	if w.Code != http.StatusOK || w.Body.String() != "0123456789" {
+		t.Errorf("Expected full file, got %d %q", w.Code, w.Body.String())
+	}
+
+	req := httptest.NewRequest("GET", "/movie.bin", nil)
+	req.Header.Set("Range", "bytes=4-6")
+	w = httptest.NewRecorder()
+	server.mux.ServeHTTP(w, req)
+	if w.Code != http.StatusPartialContent || w.Body.String() != "456" {
+		t.Errorf("Expected range 456, got %d %q", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	server.mux.ServeHTTP(w, httptest.NewRequest("GET", "/missing.bin", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404, got %d", w.Code)
+	}
+}
+
+func TestUnescapeMountPath(t *testing.T) {
+	if got := unescapeMountPath(`/mnt/my\040disk\134x`); got != `/mnt/my disk\x` {
+		t.Errorf("Expected /mnt/my disk\\x, got %q", got)
+	}
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DownloadLimits limita os bytes servidos por requisição e por cliente a
+// cada hora nos caminhos configurados. Acima do limite por requisição a
+// resposta vira um 206 com o começo do trecho pedido, e o cliente continua
+// com Range (navegadores e gerenciadores de download fazem isso sozinhos);
+// esgotada a cota horária, o cliente recebe 429 até a janela virar
+type DownloadLimits struct {
+	rules []DownloadLimitRule
+
+	mu      sync.Mutex
+	clients map[string]*downloadUsage // regra + IP -> uso na janela atual
+	swept   time.Time
+
+	truncated atomic.Int64
+	rejected  atomic.Int64
+}
+
+// downloadUsage bytes servidos a um cliente na janela de uma hora
+type downloadUsage struct {
+	start time.Time
+	bytes atomic.Int64
+}
+
+// NewDownloadLimits valida as regras
+func NewDownloadLimits(rules []DownloadLimitRule) (*DownloadLimits, error) {
+	for i, rule := range rules {
+		if len(rule.Paths) == 0 {
+			return nil, fmt.Errorf("download_limits[%d]: at least one path is required", i)
+		}
+		if rule.MaxRequestBytes < 0 || rule.MaxClientBytesPerHour < 0 {
+			return nil, fmt.Errorf("download_limits[%d]: limits must not be negative", i)
+		}
+		if rule.MaxRequestBytes == 0 && rule.MaxClientBytesPerHour == 0 {
+			return nil, fmt.Errorf("download_limits[%d]: max_request_bytes or max_client_bytes_per_hour is required", i)
+		}
+	}
+	return &DownloadLimits{rules: rules, clients: make(map[string]*downloadUsage)}, nil
+}
+
+// match retorna o índice da primeira regra que cobre o caminho (-1 se nenhuma)
+func (d *DownloadLimits) match(urlPath string) int {
+	for i, rule := range d.rules {
+		for _, pattern := range rule.Paths {
+			if matchGlob(pattern, urlPath) {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// usage retorna o uso do cliente na janela atual, abrindo outra se a
+// anterior já passou de uma hora
+func (d *DownloadLimits) usage(rule int, ip string, now time.Time) *downloadUsage {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if now.Sub(d.swept) > time.Minute {
+		for key, u := range d.clients {
+			if now.Sub(u.start) >= time.Hour {
+				delete(d.clients, key)
+			}
+		}
+		d.swept = now
+	}
+	key := strconv.Itoa(rule) + "\x00" + ip
+	u, ok := d.clients[key]
+	if !ok || now.Sub(u.start) >= time.Hour {
+		u = &downloadUsage{start: now}
+		d.clients[key] = u
+	}
+	return u
+}
+
+// limitedWriter soma os bytes enviados à cota horária do cliente
+type limitedWriter struct {
+	http.ResponseWriter
+	usage *downloadUsage
+}
+
+func (w *limitedWriter) Write(p []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(p)
+	w.usage.bytes.Add(int64(n))
+	return n, err
+}
+
+// Unwrap permite ao http.ResponseController acessar o writer original
+func (w *limitedWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// limitDownload aplica a regra do caminho: limita o Range ao que resta para
+// esta requisição e conta os bytes enviados. Retorna false se já respondeu
+// (cota esgotada)
+func (s *Server) limitDownload(w http.ResponseWriter, r *http.Request, info os.FileInfo) (http.ResponseWriter, bool) {
+	d := s.byteLimits
+	i := d.match(r.URL.Path)
+	if i < 0 {
+		return w, true
+	}
+	rule := d.rules[i]
+	limit := rule.MaxRequestBytes
+
+	var usage *downloadUsage
+	if rule.MaxClientBytesPerHour > 0 {
+		ip, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			ip = r.RemoteAddr
+		}
+		now := time.Now()
+		usage = d.usage(i, ip, now)
+		remaining := rule.MaxClientBytesPerHour - usage.bytes.Load()
+		if remaining <= 0 {
+			d.rejected.Add(1)
+			debugNote(r, "download-limit", "exhausted")
+			w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(usage.start.Add(time.Hour).Sub(now))))
+			s.serveError(w, r, http.StatusTooManyRequests)
+			return nil, false
+		}
+		if limit == 0 || remaining < limit {
+			limit = remaining
+		}
+	}
+
+	if limit > 0 && info.Size() > limit {
+		d.truncated.Add(1)
+		debugNote(r, "download-limit", strconv.FormatInt(limit, 10))
+		clampRange(r, limit, w.Header().Get("ETag"), info.ModTime())
+	}
+	if usage != nil {
+		return &limitedWriter{ResponseWriter: w, usage: usage}, true
+	}
+	return w, true
+}
+
+// clampRange reescreve o Range para no máximo limit bytes. Sem Range, com
+// Range inválido ou com If-Range que não confere (que faria o arquivo
+// inteiro ser enviado), o cliente recebe o começo do arquivo
+func clampRange(r *http.Request, limit int64, etag string, modTime time.Time) {
+	spec := r.Header.Get("Range")
+	if ifRange := r.Header.Get("If-Range"); ifRange != "" {
+		r.Header.Del("If-Range")
+		if !ifRangeMatches(ifRange, etag, modTime) {
+			spec = ""
+		}
+	}
+
+	clamped := fmt.Sprintf("bytes=0-%d", limit-1)
+	// Só o primeiro trecho de um pedido com vários
+	if rest, ok := strings.CutPrefix(spec, "bytes="); ok {
+		first, _, _ := strings.Cut(rest, ",")
+		a, b, _ := strings.Cut(strings.TrimSpace(first), "-")
+		start, errStart := strconv.ParseInt(a, 10, 64)
+		end, errEnd := strconv.ParseInt(b, 10, 64)
+		switch {
+		case a == "" && errEnd == nil && end > 0:
+			// Sufixo: os últimos end bytes
+			if end > limit {
+				end = limit
+			}
+			clamped = fmt.Sprintf("bytes=-%d", end)
+		case errStart == nil && start >= 0 && (b == "" || (errEnd == nil && end >= start)):
+			if b == "" || end-start+1 > limit {
+				end = start + limit - 1
+			}
+			clamped = fmt.Sprintf("bytes=%d-%d", start, end)
+		}
+	}
+	r.Header.Set("Range", clamped)
+}
+
+// ifRangeMatches compara o If-Range com o ETag (forte) ou a data do arquivo
+func ifRangeMatches(value, etag string, modTime time.Time) bool {
+	if strings.HasPrefix(value, `"`) {
+		return etag != "" && value == etag
+	}
+	t, err := http.ParseTime(value)
+	return err == nil && modTime.Truncate(time.Second).Equal(t)
+}
+
+// WriteMetrics exporta as respostas limitadas e recusadas
+func (d *DownloadLimits) WriteMetrics(w io.Writer) {
+	writeMetric(w, "qserv_download_limit_truncated_total", "Responses shortened to the per-request or remaining hourly byte limit.", "counter",
+		[]metricSample{{value: float64(d.truncated.Load())}})
+	writeMetric(w, "qserv_download_limit_rejected_total", "Requests rejected because the client used up its hourly byte limit.", "counter",
+		[]metricSample{{value: float64(d.rejected.Load())}})
+}
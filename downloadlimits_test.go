@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDownloadLimitsPerRequest(t *testing.T) {
+	root := t.TempDir()
+	content := strings.Repeat("0123456789", 100)
+	writeTestFile(t, filepath.Join(root, "isos", "big.iso"), content)
+	writeTestFile(t, filepath.Join(root, "other.bin"), content)
+	server := newListingTestServer(t, root, func(c *Config) {
+		c.Performance.EnableETags = true
+		c.Features.DownloadLimits = []DownloadLimitRule{{Paths: []string{"/isos/**"}, MaxRequestBytes: 300}}
+	})
+
+	get := func(target string, header map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", target, nil)
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		server.mux.ServeHTTP(w, req)
+		return w
+	}
+
+	// A full download becomes the first chunk
+	w := get("/isos/big.iso", nil)
+	if w.Code != http.StatusPartialContent || w.Body.String() != content[:300] {
+		t.Fatalf("Expected 206 with the first 300 bytes, got %d (%d bytes)", w.Code, w.Body.Len())
+	}
+	if cr := w.Header().Get("Content-Range"); cr != "bytes 0-299/1000" {
+		t.Errorf("Expected Content-Range bytes 0-299/1000, got %q", cr)
+	}
+	etag := w.Header().Get("ETag")
+
+	// Continuation: open-ended and oversized ranges are shortened
+	w = get("/isos/big.iso", map[string]string{"Range": "bytes=300-", "If-Range": etag})
+	if w.Code != http.StatusPartialContent || w.Body.String() != content[300:600] {
+		t.Errorf("Expected bytes 300-599, got %d %q", w.Code, w.Header().Get("Content-Range"))
+	}
+	w = get("/isos/big.iso", map[string]string{"Range": "bytes=900-999"})
+	if w.Body.String() != content[900:] {
+		t.Errorf("Expected the last 100 bytes unchanged, got %q", w.Header().Get("Content-Range"))
+	}
+	w = get("/isos/big.iso", map[string]string{"Range": "bytes=-500"})
+	if w.Body.String() != content[700:] {
+		t.Errorf("Expected suffix range capped at 300 bytes, got %q", w.Header().Get("Content-Range"))
+	}
+
+	// A stale If-Range would send the whole file: it restarts from the beginning instead
+	w = get("/isos/big.iso", map[string]string{"Range": "bytes=300-", "If-Range": `"stale"`})
+	if w.Code != http.StatusPartialContent || w.Body.String() != content[:300] {
+		t.Errorf("Expected first chunk for stale If-Range, got %d %q", w.Code, w.Header().Get("Content-Range"))
+	}
+
+	// Paths outside the rule are not limited
+	if w := get("/other.bin", nil); w.Code != http.StatusOK || w.Body.Len() != len(content) {
+		t.Errorf("Expected full download outside the rule, got %d (%d bytes)", w.Code, w.Body.Len())
+	}
+}
+
+func TestDownloadLimitsPerClient(t *testing.T) {
+	root := t.TempDir()
+	content := bytes.Repeat([]byte("x"), 400)
+	writeTestFile(t, filepath.Join(root, "isos", "a.iso"), string(content))
+	server := newListingTestServer(t, root, func(c *Config) {
+		c.Features.DownloadLimits = []DownloadLimitRule{{Paths: []string{"/isos/*"}, MaxClientBytesPerHour: 1000}}
+	})
+
+	get := func(remote string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/isos/a.iso", nil)
+		req.RemoteAddr = remote
+		w := httptest.NewRecorder()
+		server.mux.ServeHTTP(w, req)
+		return w
+	}
+
+	for i := 0; i < 2; i++ {
+		if w := get("192.0.2.1:1234"); w.Code != http.StatusOK || w.Body.Len() != 400 {
+			t.Fatalf("Request %d: expected full file, got %d (%d bytes)", i, w.Code, w.Body.Len())
+		}
+	}
+	// 200 bytes left this hour
+	if w := get("192.0.2.1:1234"); w.Code != http.StatusPartialContent || w.Body.Len() != 200 {
+		t.Errorf("Expected the remaining 200 bytes, got %d (%d bytes)", w.Code, w.Body.Len())
+	}
+	w := get("192.0.2.1:1234")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+		t.Errorf("Expected 429 with Retry-After, got %d %q", w.Code, w.Header().Get("Retry-After"))
+	}
+
+	// Other clients have their own budget
+	if w := get("192.0.2.2:1234"); w.Code != http.StatusOK {
+		t.Errorf("Expected another client to be served, got %d", w.Code)
+	}
+
+	var metrics bytes.Buffer
+	server.byteLimits.WriteMetrics(&metrics)
+	for _, want := range []string{"qserv_download_limit_truncated_total 1", "qserv_download_limit_rejected_total 1"} {
+		if !strings.Contains(metrics.String(), want) {
+			t.Errorf("Expected %q in metrics:\n%s", want, metrics.String())
+		}
+	}
+}
+
+func TestNewDownloadLimitsErrors(t *testing.T) {
+	for _, rules := range [][]DownloadLimitRule{
+		{{MaxRequestBytes: 1}},
+		{{Paths: []string{"/a/**"}}},
+		{{Paths: []string{"/a/**"}, MaxRequestBytes: -1}},
+	} {
+		if _, err := NewDownloadLimits(rules); err == nil {
+			t.Errorf("Expected error for %+v", rules)
+		}
+	}
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DownloadStats acompanha retomadas, conclusões e abandonos de downloads de arquivos grandes
+type DownloadStats struct {
+	minSize  int64
+	maxFiles int
+
+	mu    sync.Mutex
+	files map[string]*downloadCounters // caminho de URL -> contadores
+}
+
+// downloadCounters contadores acumulados de um arquivo
+type downloadCounters struct {
+	size          int64
+	downloads     int64
+	resumed       int64
+	completed     int64
+	aborted       int64
+	bytes         int64
+	fractionTotal float64 // soma da fração do arquivo alcançada em cada resposta
+}
+
+// DownloadReport estatísticas de um arquivo
+type DownloadReport struct {
+	Path                 string  `json:"path"`
+	Size                 int64   `json:"size"`
+	Downloads            int64   `json:"downloads"`
+	Resumed              int64   `json:"resumed"`
+	Completed            int64   `json:"completed"`
+	Aborted              int64   `json:"aborted"`
+	BytesServed          int64   `json:"bytes_served"`
+	ResumeRate           float64 `json:"resume_rate"`
+	AbortRate            float64 `json:"abort_rate"`
+	AvgCompletedFraction float64 `json:"avg_completed_fraction"`
+}
+
+// NewDownloadStats cria o acompanhamento a partir da configuração
+func NewDownloadStats(config *StatsConfig) *DownloadStats {
+	minSize := config.DownloadMinSize
+	if minSize <= 0 {
+		minSize = 10
+	}
+	maxFiles := config.MaxTrackedFiles
+	if maxFiles <= 0 {
+		maxFiles = 1000
+	}
+	return &DownloadStats{
+		minSize:  minSize * 1024 * 1024,
+		maxFiles: maxFiles,
+		files:    make(map[string]*downloadCounters),
+	}
+}
+
+// Tracks indica se um arquivo deste tamanho é acompanhado
+func (d *DownloadStats) Tracks(size int64) bool {
+	return size >= d.minSize
+}
+
+// Record registra uma resposta: start é o primeiro byte enviado, written os
+// bytes efetivamente escritos e expected o Content-Length da resposta
+func (d *DownloadStats) Record(path string, size, start, written, expected int64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	counters, ok := d.files[path]
+	if !ok {
+		if len(d.files) >= d.maxFiles {
+			return
+		}
+		counters = &downloadCounters{}
+		d.files[path] = counters
+	}
+
+	counters.size = size
+	counters.downloads++
+	counters.bytes += written
+	if start > 0 {
+		counters.resumed++
+	}
+	if written >= expected {
+		counters.completed++
+	} else {
+		counters.aborted++
+	}
+	if size > 0 {
+		counters.fractionTotal += float64(start+written) / float64(size)
+	}
+}
+
+// Report retorna as estatísticas por arquivo, dos mais baixados para os menos
+func (d *DownloadStats) Report() []DownloadReport {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	reports := make([]DownloadReport, 0, len(d.files))
+	for path, c := range d.files {
+		report := DownloadReport{
+			Path:        path,
+			Size:        c.size,
+			Downloads:   c.downloads,
+			Resumed:     c.resumed,
+			Completed:   c.completed,
+			Aborted:     c.aborted,
+			BytesServed: c.bytes,
+		}
+		if c.downloads > 0 {
+			n := float64(c.downloads)
+			report.ResumeRate = float64(c.resumed) / n
+			report.AbortRate = float64(c.aborted) / n
+			report.AvgCompletedFraction = c.fractionTotal / n
+		}
+		reports = append(reports, report)
+	}
+
+	sort.Slice(reports, func(i, j int) bool {
+		if reports[i].Downloads != reports[j].Downloads {
+			return reports[i].Downloads > reports[j].Downloads
+		}
+		return reports[i].Path < reports[j].Path
+	})
+	return reports
+}
+
+// WriteMetrics exporta os contadores por arquivo (MetricsCollector)
+func (d *DownloadStats) WriteMetrics(w io.Writer) {
+	reports := d.Report()
+
+	series := []struct {
+		name, help string
+		value      func(DownloadReport) float64
+	}{
+		{"qserv_download_requests_total", "Responses served for tracked large files.", func(r DownloadReport) float64 { return float64(r.Downloads) }},
+		{"qserv_download_resumed_total", "Responses resuming a download (range starting after byte 0).", func(r DownloadReport) float64 { return float64(r.Resumed) }},
+		{"qserv_download_completed_total", "Responses fully delivered to the client.", func(r DownloadReport) float64 { return float64(r.Completed) }},
+		{"qserv_download_aborted_total", "Responses aborted before all bytes were delivered.", func(r DownloadReport) float64 { return float64(r.Aborted) }},
+		{"qserv_download_bytes_total", "Bytes delivered for tracked large files.", func(r DownloadReport) float64 { return float64(r.BytesServed) }},
+	}
+
+	for _, s := range series {
+		samples := make([]metricSample, len(reports))
+		for i, report := range reports {
+			samples[i] = metricSample{labels: map[string]string{"path": report.Path}, value: s.value(report)}
+		}
+		writeMetric(w, s.name, s.help, "counter", samples)
+	}
+}
+
+// handleAdminDownloads expõe as estatísticas de download
+func (s *Server) handleAdminDownloads(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.downloads.Report())
+}
+
+// countingWriter conta os bytes escritos na resposta
+type countingWriter struct {
+	http.ResponseWriter
+	written int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(p)
+	w.written += int64(n)
+	return n, err
+}
+
+// Unwrap permite ao http.ResponseController acessar o writer original
+func (w *countingWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// serveTrackedFile serve um arquivo registrando o resultado nas estatísticas
+// de download e na sessão de download do cliente
+func (s *Server) serveTrackedFile(w http.ResponseWriter, r *http.Request, path string, info os.FileInfo) {
+	var token string
+	if s.dlSessions != nil && s.dlSessions.Tracks(info.Size()) {
+		// Antes do corpo: o cliente guarda o token para consultar a sessão
+		token = s.dlSessions.Token(r)
+		w.Header().Set(downloadSessionHeader, token)
+	}
+
+	counter := &countingWriter{ResponseWriter: w}
+	s.serveDiskFile(counter, r, path)
+
+	header := w.Header()
+	expected, err := strconv.ParseInt(header.Get("Content-Length"), 10, 64)
+	if err != nil {
+		// Sem Content-Length (ex: 304, erro ou corpo comprimido): não é um download
+		return
+	}
+
+	// Content-Range: bytes início-fim/total
+	var start int64
+	if contentRange := header.Get("Content-Range"); contentRange != "" {
+		rangeSpec, _ := strings.CutPrefix(contentRange, "bytes ")
+		first, _, _ := strings.Cut(rangeSpec, "-")
+		start, _ = strconv.ParseInt(first, 10, 64)
+	}
+
+	if s.downloads != nil && s.downloads.Tracks(info.Size()) {
+		s.downloads.Record(r.URL.Path, info.Size(), start, counter.written, expected)
+	}
+	if token != "" {
+		ip, _, _ := net.SplitHostPort(r.RemoteAddr)
+		s.dlSessions.Record(token, r.URL.Path, ip, header, info.Size(), start, counter.written)
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// failingWriter simula um cliente que desconecta após limit bytes
+type failingWriter struct {
+	*httptest.ResponseRecorder
+	limit int
+}
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if w.Body.Len()+len(p) > w.limit {
+		n := w.limit - w.Body.Len()
+		w.ResponseRecorder.Write(p[:n])
+		return n, errors.New("connection reset")
+	}
+	return w.ResponseRecorder.Write(p)
+}
+
+func TestDownloadStats(t *testing.T) {
+	root := t.TempDir()
+	size := 1024 * 1024
+	writeTestFile(t, filepath.Join(root, "big.iso"), strings.Repeat("x", size))
+	writeTestFile(t, filepath.Join(root, "small.txt"), "small")
+
+	config := DefaultConfig()
+	config.Server.RootDir = root
+	config.Stats = &StatsConfig{Enabled: true, DownloadMinSize: 1}
+	logger, _ := NewLogger(&LoggingConfig{Enabled: false})
+	server := NewServer(config, logger)
+	handler := server.createFileHandler()
+
+	// Download completo
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/big.iso", nil))
+
+	// Retomada a partir da metade
+	req := httptest.NewRequest("GET", "/big.iso", nil)
+	req.Header.Set("Range", "bytes=524288-")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	// Abandono após 100KB
+	handler.ServeHTTP(&failingWriter{ResponseRecorder: httptest.NewRecorder(), limit: 100 * 1024}, httptest.NewRequest("GET", "/big.iso", nil))
+
+	// Arquivos pequenos não são acompanhados
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/small.txt", nil))
+
+	reports := server.downloads.Report()
+	if len(reports) != 1 {
+		t.Fatalf("Expected 1 tracked file, got %d", len(reports))
+	}
+	report := reports[0]
+	if report.Downloads != 3 || report.Resumed != 1 || report.Completed != 2 || report.Aborted != 1 {
+		t.Errorf("Unexpected counters: %+v", report)
+	}
+	// (1 + 1 + 0.0977) / 3
+	if report.AvgCompletedFraction < 0.69 || report.AvgCompletedFraction > 0.71 {
+		t.Errorf("Expected average completed fraction ~0.70, got %f", report.AvgCompletedFraction)
+	}
+
+	var metrics bytes.Buffer
+	server.downloads.WriteMetrics(&metrics)
+	if !strings.Contains(metrics.String(), `qserv_download_resumed_total{path="/big.iso"} 1`) {
+		t.Errorf("Expected resumed counter in metrics output, got:\n%s", metrics.String())
+	}
+}
+
+func TestFormatLabels(t *testing.T) {
+	labels := map[string]string{"path": `/a"b\c`, "code": "200"}
+	if got := formatLabels(labels); got != `{code="200",path="/a\"b\\c"}` {
+		t.Errorf("Unexpected label formatting: %s", got)
+	}
+	if got := formatLabels(nil); got != "" {
+		t.Errorf("Expected empty labels, got %s", got)
+	}
+}
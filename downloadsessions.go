@@ -0,0 +1,193 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// downloadSessionHeader identifica a sessão na requisição e na resposta
+const downloadSessionHeader = "X-Download-Session"
+
+// downloadSessionPattern tokens aceitos do cliente (os gerados têm 32 hex)
+var downloadSessionPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{16,128}$`)
+
+// DownloadSessions acompanha downloads de arquivos grandes por um token em
+// vez do IP: o cliente que troca de rede (Wi-Fi para 4G) consulta a sessão e
+// retoma do byte alcançado com Range e If-Range
+type DownloadSessions struct {
+	config      *DownloadSessionsConfig
+	minSize     int64
+	ttl         time.Duration
+	maxSessions int
+	now         func() time.Time
+
+	mu       sync.Mutex
+	sessions map[string]*DownloadSession // token -> sessão
+}
+
+// DownloadSession progresso de um download, como devolvido ao cliente
+type DownloadSession struct {
+	Path         string    `json:"path"`
+	Size         int64     `json:"size"`
+	Offset       int64     `json:"offset"` // bytes contíguos desde o início já entregues
+	Complete     bool      `json:"complete"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last_modified,omitempty"`
+	Client       string    `json:"client"` // último IP que usou o token
+	Updated      time.Time `json:"updated"`
+}
+
+// NewDownloadSessions valida a configuração
+func NewDownloadSessions(config *DownloadSessionsConfig) (*DownloadSessions, error) {
+	if config.MinSize < 0 || config.TTL < 0 || config.MaxSessions < 0 {
+		return nil, fmt.Errorf("download sessions: min_size, ttl and max_sessions must not be negative")
+	}
+	if config.Route != "" && !strings.HasPrefix(config.Route, "/") {
+		return nil, fmt.Errorf("download sessions: route must start with /, got %q", config.Route)
+	}
+	d := &DownloadSessions{
+		config:      config,
+		minSize:     config.MinSize * 1024 * 1024,
+		ttl:         time.Duration(config.TTL) * time.Second,
+		maxSessions: config.MaxSessions,
+		now:         time.Now,
+		sessions:    make(map[string]*DownloadSession),
+	}
+	if config.MinSize == 0 {
+		d.minSize = 10 * 1024 * 1024
+	}
+	if d.ttl == 0 {
+		d.ttl = 24 * time.Hour
+	}
+	if d.maxSessions == 0 {
+		d.maxSessions = 10000
+	}
+	return d, nil
+}
+
+// route retorna a rota de consulta
+func (d *DownloadSessions) route() string {
+	if d.config.Route == "" {
+		return "/_download_session"
+	}
+	return d.config.Route
+}
+
+// Tracks indica se um arquivo deste tamanho é acompanhado
+func (d *DownloadSessions) Tracks(size int64) bool {
+	return size >= d.minSize
+}
+
+// Token retorna o token informado pelo cliente (header ou ?download_session=)
+// ou um novo
+func (d *DownloadSessions) Token(r *http.Request) string {
+	token := r.Header.Get(downloadSessionHeader)
+	if token == "" {
+		token = r.URL.Query().Get("download_session")
+	}
+	if downloadSessionPattern.MatchString(token) {
+		return token
+	}
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Record registra uma resposta da sessão: start é o primeiro byte enviado e
+// written os bytes efetivamente escritos. O offset só avança com trechos
+// contíguos e volta a zero se o arquivo mudou
+func (d *DownloadSessions) Record(token, path, client string, header http.Header, size, start, written int64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := d.now()
+	session, ok := d.sessions[token]
+	if ok && now.Sub(session.Updated) > d.ttl {
+		ok = false
+	}
+	etag, lastModified := header.Get("ETag"), header.Get("Last-Modified")
+	if !ok || session.Path != path || session.Size != size || session.ETag != etag || session.LastModified != lastModified {
+		if !ok && len(d.sessions) >= d.maxSessions {
+			d.removeExpired(now)
+			if len(d.sessions) >= d.maxSessions {
+				return
+			}
+		}
+		session = &DownloadSession{Path: path, Size: size, ETag: etag, LastModified: lastModified}
+		d.sessions[token] = session
+	}
+
+	if start <= session.Offset && start+written > session.Offset {
+		session.Offset = start + written
+	}
+	session.Complete = session.Offset >= session.Size
+	session.Client = client
+	session.Updated = now
+}
+
+// Get retorna uma cópia da sessão, se existir e não tiver expirado
+func (d *DownloadSessions) Get(token string) (DownloadSession, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	session, ok := d.sessions[token]
+	if !ok || d.now().Sub(session.Updated) > d.ttl {
+		return DownloadSession{}, false
+	}
+	return *session, true
+}
+
+// removeExpired remove as sessões sem uso há mais que o TTL (d.mu travado)
+func (d *DownloadSessions) removeExpired(now time.Time) {
+	for token, session := range d.sessions {
+		if now.Sub(session.Updated) > d.ttl {
+			delete(d.sessions, token)
+		}
+	}
+}
+
+// Handler responde com o progresso da sessão do token; o token é o único
+// segredo, por isso vale de qualquer IP
+func (d *DownloadSessions) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-store")
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		token := r.Header.Get(downloadSessionHeader)
+		if token == "" {
+			token = r.URL.Query().Get("token")
+		}
+		session, ok := d.Get(token)
+		if !ok {
+			writeJSONError(w, http.StatusNotFound, fmt.Errorf("unknown or expired download session"))
+			return
+		}
+		writeJSON(w, http.StatusOK, session)
+	})
+}
+
+// WriteMetrics exporta as sessões ativas
+func (d *DownloadSessions) WriteMetrics(w io.Writer) {
+	d.mu.Lock()
+	now := d.now()
+	active := 0
+	for _, session := range d.sessions {
+		if now.Sub(session.Updated) <= d.ttl {
+			active++
+		}
+	}
+	d.mu.Unlock()
+
+	writeMetric(w, "qserv_download_sessions", "Resumable download sessions not yet expired.", "gauge",
+		[]metricSample{{value: float64(active)}})
+}
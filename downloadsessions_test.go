@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDownloadSessionResume(t *testing.T) {
+	root := t.TempDir()
+	content := strings.Repeat("x", 1<<20)
+	writeTestFile(t, filepath.Join(root, "big.iso"), content)
+	writeTestFile(t, filepath.Join(root, "small.txt"), "small")
+
+	server := newListingTestServer(t, root, func(c *Config) {
+		c.Performance.EnableETags = true
+		c.Features.DownloadSessions = &DownloadSessionsConfig{Enabled: true, MinSize: 1}
+	})
+	download := func(rangeHeader, token, remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/big.iso", nil)
+		req.RemoteAddr = remoteAddr
+		if rangeHeader != "" {
+			req.Header.Set("Range", rangeHeader)
+		}
+		if token != "" {
+			req.Header.Set(downloadSessionHeader, token)
+		}
+		w := httptest.NewRecorder()
+		server.mux.ServeHTTP(w, req)
+		return w
+	}
+	query := func(token string) (int, DownloadSession) {
+		w := httptest.NewRecorder()
+		server.mux.ServeHTTP(w, httptest.NewRequest("GET", "/_download_session?token="+token, nil))
+		var session DownloadSession
+		json.Unmarshal(w.Body.Bytes(), &session)
+		return w.Code, session
+	}
+
+	// First chunk from Wi-Fi: the server hands out a token
+	w := download("bytes=0-99999", "", "192.0.2.1:1234")
+	token := w.Header().Get(downloadSessionHeader)
+	if len(token) != 32 {
+		t.Fatalf("Expected a generated token, got %q", token)
+	}
+	code, session := query(token)
+	if code != http.StatusOK || session.Offset != 100000 || session.Complete || session.Client != "192.0.2.1" || session.ETag == "" {
+		t.Errorf("Unexpected session after first chunk: %d %+v", code, session)
+	}
+
+	// A gap does not advance the offset; the next contiguous chunk from another network does
+	download("bytes=500000-599999", token, "198.51.100.7:4321")
+	if _, session = query(token); session.Offset != 100000 {
+		t.Errorf("Expected offset to stay at 100000 after a gap, got %d", session.Offset)
+	}
+	w = download("bytes=100000-", token, "198.51.100.7:4321")
+	if w.Header().Get(downloadSessionHeader) != token {
+		t.Errorf("Expected client token to be echoed, got %q", w.Header().Get(downloadSessionHeader))
+	}
+	if _, session = query(token); session.Offset != int64(len(content)) || !session.Complete || session.Client != "198.51.100.7" {
+		t.Errorf("Expected completed session from the new address, got %+v", session)
+	}
+
+	// Small files open no session; unknown and expired tokens are 404
+	req := httptest.NewRequest("GET", "/small.txt", nil)
+	w = httptest.NewRecorder()
+	server.mux.ServeHTTP(w, req)
+	if w.Header().Get(downloadSessionHeader) != "" {
+		t.Errorf("Expected no session for small files")
+	}
+	if code, _ := query("unknown-token-0000"); code != http.StatusNotFound {
+		t.Errorf("Expected 404 for unknown token, got %d", code)
+	}
+	server.dlSessions.now = func() time.Time { return time.Now().Add(48 * time.Hour) }
+	if code, _ := query(token); code != http.StatusNotFound {
+		t.Errorf("Expected 404 for expired session, got %d", code)
+	}
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// duCacheLimit máximo de diretórios varridos mantidos em cache
+const duCacheLimit = 1024
+
+// DirUsage totais recursivos de um diretório
+type DirUsage struct {
+	Files int   `json:"files"`
+	Dirs  int   `json:"dirs"`
+	Bytes int64 `json:"bytes"`
+}
+
+// DiskUsageEntry item dentro do diretório com seus totais
+type DiskUsageEntry struct {
+	Name  string `json:"name"`
+	IsDir bool   `json:"is_dir"`
+	DirUsage
+}
+
+// DiskUsageReport resposta de ?du=1: totais do diretório e de cada item,
+// do maior para o menor
+type DiskUsageReport struct {
+	Path       string    `json:"path"`
+	Source     string    `json:"source"` // index ou scan
+	ComputedAt time.Time `json:"computed_at"`
+	DirUsage
+	Entries []DiskUsageEntry `json:"entries,omitempty"`
+}
+
+// duCacheEntry varredura guardada até expires
+type duCacheEntry struct {
+	report  DiskUsageReport
+	expires time.Time
+}
+
+// DiskUsage uso de disco por diretório (?du=1). Usa o índice da raiz quando
+// ativo; sem ele, varre o diretório e guarda o resultado por cache_ttl.
+type DiskUsage struct {
+	config *DiskUsageConfig
+	index  *RootIndex // nil: sempre varre
+
+	mu    sync.Mutex
+	cache map[string]duCacheEntry
+}
+
+// NewDiskUsage cria o cálculo de uso de disco
+func NewDiskUsage(config *DiskUsageConfig) *DiskUsage {
+	return &DiskUsage{config: config, cache: make(map[string]duCacheEntry)}
+}
+
+// cacheTTL retorna por quanto tempo uma varredura é reaproveitada
+func (d *DiskUsage) cacheTTL() time.Duration {
+	if d.config.CacheTTL <= 0 {
+		return 5 * time.Minute
+	}
+	return time.Duration(d.config.CacheTTL) * time.Second
+}
+
+// Report calcula os totais de dir (urlPath na URL), pelo índice ou varrendo
+func (d *DiskUsage) Report(dir, urlPath string) (DiskUsageReport, error) {
+	if d.index != nil {
+		if report, ok := d.index.Usage(dir); ok {
+			report.Path = urlPath
+			return report, nil
+		}
+	}
+
+	d.mu.Lock()
+	cached, ok := d.cache[dir]
+	d.mu.Unlock()
+	if ok && time.Now().Before(cached.expires) {
+		return cached.report, nil
+	}
+
+	report, err := scanUsage(dir)
+	if err != nil {
+		return DiskUsageReport{}, err
+	}
+	report.Path = urlPath
+	d.mu.Lock()
+	if len(d.cache) >= duCacheLimit {
+		d.cache = make(map[string]duCacheEntry)
+	}
+	d.cache[dir] = duCacheEntry{report: report, expires: time.Now().Add(d.cacheTTL())}
+	d.mu.Unlock()
+	return report, nil
+}
+
+// Name identifica o cache no relatório de remoção
+func (d *DiskUsage) Name() string {
+	return "disk-usage"
+}
+
+// Purge descarta as varreduras cujo caminho satisfaz match
+func (d *DiskUsage) Purge(match func(key string) bool) []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var evicted []string
+	for dir, entry := range d.cache {
+		if match(entry.report.Path) {
+			delete(d.cache, dir)
+			evicted = append(evicted, entry.report.Path)
+		}
+	}
+	return evicted
+}
+
+// listingDirSize tamanho total do diretório para a coluna da listagem; só
+// pelo índice, para não varrer a árvore a cada listagem
+func (s *Server) listingDirSize(dir string) (int64, bool) {
+	if s.diskUsage == nil || !s.diskUsage.config.Listing || s.rootIndex == nil {
+		return 0, false
+	}
+	total, ok := s.rootIndex.DirTotal(dir)
+	return total.Bytes, ok
+}
+
+// scanUsage varre dir somando cada item (ignora .git e arquivos do qserv,
+// como o índice)
+func scanUsage(dir string) (DiskUsageReport, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return DiskUsageReport{}, err
+	}
+	report := DiskUsageReport{Source: "scan", ComputedAt: time.Now()}
+	for _, entry := range entries {
+		name := entry.Name()
+		if name == ".git" || strings.HasPrefix(name, ".qserv-") {
+			continue
+		}
+		item := DiskUsageEntry{Name: name, IsDir: entry.IsDir()}
+		if entry.IsDir() {
+			filepath.WalkDir(filepath.Join(dir, name), func(path string, d fs.DirEntry, err error) error {
+				if err != nil {
+					return nil
+				}
+				if d.IsDir() {
+					if d.Name() == ".git" || strings.HasPrefix(d.Name(), ".qserv-") {
+						return filepath.SkipDir
+					}
+					item.Dirs++
+				} else if d.Type().IsRegular() && !strings.HasPrefix(d.Name(), ".qserv-") {
+					if info, err := d.Info(); err == nil {
+						item.Files++
+						item.Bytes += info.Size()
+					}
+				}
+				return nil
+			})
+			// O próprio diretório não conta como subdiretório dele
+			item.Dirs--
+			report.Dirs += item.Dirs + 1
+		} else if entry.Type().IsRegular() {
+			info, err := entry.Info()
+			if err != nil {
+				continue
+			}
+			item.Files, item.Bytes = 1, info.Size()
+		} else {
+			continue
+		}
+		report.Files += item.Files
+		report.Bytes += item.Bytes
+		report.Entries = append(report.Entries, item)
+	}
+	return report, nil
+}
+
+// serveDiskUsage responde ?du=1 com os totais do diretório; os itens só são
+// listados (sem os ocultos) quando a listagem de diretórios está ativa
+func (s *Server) serveDiskUsage(w http.ResponseWriter, r *http.Request, path string) {
+	report, err := s.diskUsage.Report(path, strings.TrimSuffix(r.URL.Path, "/")+"/")
+	if err != nil {
+		s.logger.Error("Error computing disk usage of %s: %v", path, err)
+		s.serveError(w, r, http.StatusInternalServerError)
+		return
+	}
+
+	entries := report.Entries
+	report.Entries = nil
+	if s.config.Features.DirectoryListing {
+		root := s.requestRoot(r)
+		for _, entry := range entries {
+			if s.listable(root, path, entry.Name) {
+				report.Entries = append(report.Entries, entry)
+			}
+		}
+		sort.Slice(report.Entries, func(i, j int) bool {
+			a, b := report.Entries[i], report.Entries[j]
+			if a.Bytes != b.Bytes {
+				return a.Bytes > b.Bytes
+			}
+			return a.Name < b.Name
+		})
+	}
+	w.Header().Set("Cache-Control", "no-cache")
+	writeJSON(w, http.StatusOK, report)
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newDiskUsageTree(t *testing.T) string {
+	t.Helper()
+	root := t.TempDir()
+	writeTestFile(t, filepath.Join(root, "small.txt"), "abc")
+	writeTestFile(t, filepath.Join(root, "builds", "a.bin"), strings.Repeat("x", 100))
+	writeTestFile(t, filepath.Join(root, "builds", "old", "b.bin"), strings.Repeat("x", 50))
+	writeTestFile(t, filepath.Join(root, "builds", ".git", "HEAD"), "ref")
+	writeTestFile(t, filepath.Join(root, "docs", "readme.md"), "hello")
+	return root
+}
+
+func getDiskUsage(t *testing.T, server *Server, target string) DiskUsageReport {
+	t.Helper()
+	w := httptest.NewRecorder()
+	server.mux.ServeHTTP(w, httptest.NewRequest("GET", target, nil))
+	var report DiskUsageReport
+	if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+		t.Fatalf("Expected JSON report, got %d %s", w.Code, w.Body.String())
+	}
+	return report
+}
+
+func TestDiskUsage(t *testing.T) {
+	root := newDiskUsageTree(t)
+	for _, indexed := range []bool{false, true} {
+		server := newListingTestServer(t, root, func(c *Config) {
+			c.Features.DiskUsage = &DiskUsageConfig{Enabled: true}
+			if indexed {
+				c.Index = &IndexConfig{Enabled: true, File: filepath.Join(t.TempDir(), "index.json")}
+			}
+		})
+		source := "scan"
+		if indexed {
+			source = "index"
+			if _, err := server.rootIndex.Build(root); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		report := getDiskUsage(t, server, "/?du=1")
+		if report.Source != source || report.Files != 4 || report.Dirs != 3 || report.Bytes != 158 {
+			t.Errorf("%s: Expected 4 files, 3 dirs, 158 bytes, got %+v", source, report)
+		}
+		// Largest first; directories carry recursive totals
+		if len(report.Entries) != 3 || report.Entries[0].Name != "builds" || report.Entries[0].Bytes != 150 ||
+			report.Entries[0].Files != 2 || report.Entries[0].Dirs != 1 {
+			t.Errorf("%s: Unexpected entries %+v", source, report.Entries)
+		}
+
+		sub := getDiskUsage(t, server, "/builds/?du=1")
+		if sub.Path != "/builds/" || sub.Bytes != 150 || len(sub.Entries) != 2 {
+			t.Errorf("%s: Unexpected subdirectory report %+v", source, sub)
+		}
+	}
+}
+
+func TestDiskUsageWithoutListing(t *testing.T) {
+	root := newDiskUsageTree(t)
+	server := newListingTestServer(t, root, func(c *Config) {
+		c.Features.DirectoryListing = false
+		c.Features.DiskUsage = &DiskUsageConfig{Enabled: true}
+	})
+	// Totals only; names are not revealed
+	report := getDiskUsage(t, server, "/?du=1")
+	if report.Bytes != 158 || len(report.Entries) != 0 {
+		t.Errorf("Expected totals without entries, got %+v", report)
+	}
+}
+
+func TestDiskUsageListingColumn(t *testing.T) {
+	root := newDiskUsageTree(t)
+	server := newListingTestServer(t, root, func(c *Config) {
+		c.Index = &IndexConfig{Enabled: true, File: filepath.Join(t.TempDir(), "index.json")}
+		c.Features.DiskUsage = &DiskUsageConfig{Enabled: true, Listing: true}
+	})
+	server.rootIndex.Build(root)
+
+	w := httptest.NewRecorder()
+	server.mux.ServeHTTP(w, httptest.NewRequest("GET", "/?format=json", nil))
+	var page listingPage
+	if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil {
+		t.Fatalf("Invalid listing JSON: %v", err)
+	}
+	for _, e := range page.Entries {
+		if e.Name == "builds" && e.Size != 150 {
+			t.Errorf("Expected directory size 150 in listing, got %d", e.Size)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"crypto/ecdh"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// Suíte HPKE das configurações ECH geradas: DHKEM(X25519, HKDF-SHA256) com
+// HKDF-SHA256 e AES-128-GCM ou ChaCha20-Poly1305
+const (
+	echVersion        = 0xfe0d
+	hpkeKEMX25519     = 0x0020
+	hpkeKDFHKDFSHA256 = 0x0001
+	hpkeAEADAES128GCM = 0x0001
+	hpkeAEADChaCha20  = 0x0003
+)
+
+// ECHKeys chaves do Encrypted Client Hello: o cliente cifra o ClientHello
+// (com o SNI real) usando a configuração publicada no registro DNS HTTPS, e
+// quem observa a conexão vê apenas o public_name
+type ECHKeys struct {
+	keys       []tls.EncryptedClientHelloKey
+	configList []byte // ECHConfigList da chave atual (a primeira)
+	publicName string
+}
+
+// NewECHKeys lê as chaves X25519 e monta a configuração de cada uma. A
+// primeira é a atual: é a publicada e a enviada como retry a clientes com
+// configuração desconhecida; as demais seguem aceitas durante a rotação
+func NewECHKeys(config *ECHConfig) (*ECHKeys, error) {
+	if len(config.Keys) == 0 {
+		return nil, errors.New("ech: at least one key is required")
+	}
+	e := &ECHKeys{publicName: config.Keys[0].PublicName}
+	ids := make(map[int]bool)
+	for i, k := range config.Keys {
+		if k.PublicName == "" || len(k.PublicName) > 255 {
+			return nil, fmt.Errorf("ech: keys[%d]: public_name is required (up to 255 bytes)", i)
+		}
+		if k.ConfigID < 0 || k.ConfigID > 255 {
+			return nil, fmt.Errorf("ech: keys[%d]: config_id must be between 0 and 255", i)
+		}
+		if ids[k.ConfigID] {
+			return nil, fmt.Errorf("ech: keys[%d]: duplicate config_id %d", i, k.ConfigID)
+		}
+		ids[k.ConfigID] = true
+
+		key, err := loadECHKey(k.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("ech: keys[%d]: %w", i, err)
+		}
+		echConfig := marshalECHConfig(uint8(k.ConfigID), key.PublicKey().Bytes(), k.PublicName)
+		e.keys = append(e.keys, tls.EncryptedClientHelloKey{
+			Config:      echConfig,
+			PrivateKey:  key.Bytes(),
+			SendAsRetry: i == 0,
+		})
+		if i == 0 {
+			e.configList = binary.BigEndian.AppendUint16(nil, uint16(len(echConfig)))
+			e.configList = append(e.configList, echConfig...)
+		}
+	}
+	return e, nil
+}
+
+// loadECHKey lê uma chave privada X25519 em PEM PKCS#8 (ex: openssl genpkey
+// -algorithm X25519)
+func loadECHKey(path string) (*ecdh.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "PRIVATE KEY" {
+		return nil, fmt.Errorf("%s: no PEM private key", path)
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	key, ok := parsed.(*ecdh.PrivateKey)
+	if !ok || key.Curve() != ecdh.X25519() {
+		return nil, fmt.Errorf("%s: not an X25519 key", path)
+	}
+	return key, nil
+}
+
+// marshalECHConfig codifica um ECHConfig (draft-ietf-tls-esni, versão 0xfe0d)
+func marshalECHConfig(id uint8, publicKey []byte, publicName string) []byte {
+	var contents []byte
+	contents = append(contents, id)
+	contents = binary.BigEndian.AppendUint16(contents, hpkeKEMX25519)
+	contents = binary.BigEndian.AppendUint16(contents, uint16(len(publicKey)))
+	contents = append(contents, publicKey...)
+	contents = binary.BigEndian.AppendUint16(contents, 8)
+	for _, aead := range []uint16{hpkeAEADAES128GCM, hpkeAEADChaCha20} {
+		contents = binary.BigEndian.AppendUint16(contents, hpkeKDFHKDFSHA256)
+		contents = binary.BigEndian.AppendUint16(contents, aead)
+	}
+	contents = append(contents, 0) // maximum_name_length: sem preferência
+	contents = append(contents, uint8(len(publicName)))
+	contents = append(contents, publicName...)
+	contents = binary.BigEndian.AppendUint16(contents, 0) // sem extensões
+
+	config := binary.BigEndian.AppendUint16(nil, echVersion)
+	config = binary.BigEndian.AppendUint16(config, uint16(len(contents)))
+	return append(config, contents...)
+}
+
+// ConfigList retorna a ECHConfigList atual em base64, o valor do parâmetro
+// ech do registro DNS HTTPS
+func (e *ECHKeys) ConfigList() string {
+	return base64.StdEncoding.EncodeToString(e.configList)
+}
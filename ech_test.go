@@ -0,0 +1,137 @@
+package main
+
+import (
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeECHKey writes a fresh X25519 key in PKCS#8 PEM
+func writeECHKey(t *testing.T, dir, name string) string {
+	t.Helper()
+	key, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, name)
+	os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600)
+	return path
+}
+
+// echHandshake connects with the given ECHConfigList and returns the state
+func echHandshake(t *testing.T, server *Server, configList []byte) (tls.ConnectionState, error) {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	httpServer := server.httpServer("")
+	go httpServer.ServeTLS(l, server.config.Security.CertFile, server.config.Security.KeyFile)
+	t.Cleanup(func() { httpServer.Close() })
+
+	conn, err := tls.Dial("tcp", l.Addr().String(), &tls.Config{
+		ServerName:                          "qserv.test",
+		InsecureSkipVerify:                  true,
+		EncryptedClientHelloConfigList:      configList,
+		EncryptedClientHelloRejectionVerify: func(tls.ConnectionState) error { return nil },
+	})
+	if err != nil {
+		return tls.ConnectionState{}, err
+	}
+	defer conn.Close()
+	return conn.ConnectionState(), nil
+}
+
+func newECHTestServer(t *testing.T, keys ...ECHKeyConfig) *Server {
+	t.Helper()
+	dir := t.TempDir()
+	certFile, keyFile := writeTestCert(t, dir, time.Now().Add(24*time.Hour))
+	server := newListingTestServer(t, dir, func(c *Config) {
+		c.Security.EnableHTTPS = true
+		c.Security.CertFile = certFile
+		c.Security.KeyFile = keyFile
+		c.Security.ECH = &ECHConfig{Enabled: true, Keys: keys}
+	})
+	if server.ech == nil {
+		t.Fatal("Expected ECH to be enabled")
+	}
+	return server
+}
+
+func TestECHHandshake(t *testing.T) {
+	dir := t.TempDir()
+	current := ECHKeyConfig{KeyFile: writeECHKey(t, dir, "current.pem"), PublicName: "public.example.com", ConfigID: 2}
+	previous := ECHKeyConfig{KeyFile: writeECHKey(t, dir, "previous.pem"), PublicName: "public.example.com", ConfigID: 1}
+	server := newECHTestServer(t, current, previous)
+
+	configList, err := base64.StdEncoding.DecodeString(server.ech.ConfigList())
+	if err != nil {
+		t.Fatal(err)
+	}
+	state, err := echHandshake(t, server, configList)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !state.ECHAccepted {
+		t.Error("Expected ECH to be accepted")
+	}
+
+	// Clients with the previous configuration still work during rotation
+	old, err := NewECHKeys(&ECHConfig{Enabled: true, Keys: []ECHKeyConfig{previous}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state, err := echHandshake(t, server, old.configList); err != nil || !state.ECHAccepted {
+		t.Errorf("Expected the previous key to be accepted, got %v", err)
+	}
+}
+
+func TestECHRetryConfig(t *testing.T) {
+	dir := t.TempDir()
+	server := newECHTestServer(t, ECHKeyConfig{KeyFile: writeECHKey(t, dir, "current.pem"), PublicName: "public.example.com", ConfigID: 2})
+
+	// A configuration the server does not know: rejected with the current one as retry
+	unknown, err := NewECHKeys(&ECHConfig{Enabled: true, Keys: []ECHKeyConfig{{KeyFile: writeECHKey(t, dir, "unknown.pem"), PublicName: "public.example.com", ConfigID: 9}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = echHandshake(t, server, unknown.configList)
+	var rejection *tls.ECHRejectionError
+	if !errors.As(err, &rejection) {
+		t.Fatalf("Expected ECH rejection, got %v", err)
+	}
+	if string(rejection.RetryConfigList) != string(server.ech.configList) {
+		t.Error("Expected the current configuration as retry config")
+	}
+}
+
+func TestNewECHKeysErrors(t *testing.T) {
+	dir := t.TempDir()
+	key := writeECHKey(t, dir, "ech.pem")
+	_, ecKey := writeTestCert(t, dir, time.Now().Add(24*time.Hour))
+	for _, config := range []*ECHConfig{
+		{Enabled: true},
+		{Enabled: true, Keys: []ECHKeyConfig{{KeyFile: key, ConfigID: 1}}},
+		{Enabled: true, Keys: []ECHKeyConfig{{KeyFile: key, PublicName: "p.example.com", ConfigID: 256}}},
+		{Enabled: true, Keys: []ECHKeyConfig{{KeyFile: key, PublicName: "p.example.com"}, {KeyFile: key, PublicName: "p.example.com"}}},
+		{Enabled: true, Keys: []ECHKeyConfig{{KeyFile: ecKey, PublicName: "p.example.com"}}},
+		{Enabled: true, Keys: []ECHKeyConfig{{KeyFile: filepath.Join(dir, "missing.pem"), PublicName: "p.example.com"}}},
+	} {
+		if _, err := NewECHKeys(config); err == nil {
+			t.Errorf("Expected error for %+v", config.Keys)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// etagAlgorithms estratégias de ETag aceitas
+var etagAlgorithms = map[string]bool{
+	"":      true, // mtime
+	"mtime": true,
+	"hash":  true,
+	"none":  true,
+}
+
+// etagHash hash de conteúdo guardado enquanto o arquivo não mudar
+type etagHash struct {
+	size    int64
+	modTime time.Time
+	sum     string
+}
+
+// ETagger calcula o ETag dos arquivos conforme a estratégia de cada caminho
+type ETagger struct {
+	config *ETagConfig
+	index  *RootIndex // hashes já calculados pelo índice da raiz (opcional)
+
+	mu     sync.Mutex
+	hashes map[string]etagHash // caminho no disco -> hash
+}
+
+// maxETagHashes limite de hashes guardados em memória
+const maxETagHashes = 10000
+
+// NewETagger cria o calculador validando as estratégias configuradas
+func NewETagger(config *ETagConfig) (*ETagger, error) {
+	if !etagAlgorithms[config.Algorithm] {
+		return nil, fmt.Errorf("unknown etag algorithm %q (use mtime, hash or none)", config.Algorithm)
+	}
+	for i, rule := range config.Rules {
+		if len(rule.Paths) == 0 {
+			return nil, fmt.Errorf("etag.rules[%d]: paths is required", i)
+		}
+		if !etagAlgorithms[rule.Algorithm] {
+			return nil, fmt.Errorf("etag.rules[%d]: unknown algorithm %q (use mtime, hash or none)", i, rule.Algorithm)
+		}
+	}
+	return &ETagger{config: config, hashes: make(map[string]etagHash)}, nil
+}
+
+// strategy retorna a estratégia do caminho: a primeira regra que casar ou o padrão
+func (e *ETagger) strategy(urlPath string) (algorithm string, weak bool) {
+	algorithm, weak = e.config.Algorithm, e.config.Weak
+	for _, rule := range e.config.Rules {
+		for _, pattern := range rule.Paths {
+			if matchGlob(pattern, urlPath) {
+				algorithm, weak = rule.Algorithm, rule.Weak
+				return
+			}
+		}
+	}
+	return
+}
+
+// ETag retorna o ETag do arquivo; vazio quando desativado para o caminho
+func (e *ETagger) ETag(urlPath, path string, info os.FileInfo) (string, error) {
+	algorithm, weak := e.strategy(urlPath)
+	var etag string
+	switch algorithm {
+	case "none":
+		return "", nil
+	case "hash":
+		sum, err := e.hash(path, info)
+		if err != nil {
+			return "", err
+		}
+		etag = `"` + sum + `"`
+	default:
+		etag = mtimeETag(info)
+	}
+	if weak {
+		etag = "W/" + etag
+	}
+	return etag, nil
+}
+
+// hash retorna o SHA-256 do conteúdo, recalculado só quando tamanho ou mtime mudam
+func (e *ETagger) hash(path string, info os.FileInfo) (string, error) {
+	e.mu.Lock()
+	cached, ok := e.hashes[path]
+	e.mu.Unlock()
+	if ok && cached.size == info.Size() && cached.modTime.Equal(info.ModTime()) {
+		return cached.sum, nil
+	}
+	if e.index != nil {
+		if entry, ok := e.index.Lookup(path, info); ok && entry.SHA256 != "" {
+			return entry.SHA256[:32], nil
+		}
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	sum := hex.EncodeToString(h.Sum(nil)[:16])
+
+	e.mu.Lock()
+	if len(e.hashes) >= maxETagHashes {
+		clear(e.hashes)
+	}
+	e.hashes[path] = etagHash{size: info.Size(), modTime: info.ModTime(), sum: sum}
+	e.mu.Unlock()
+	return sum, nil
+}
+
+// mtimeETag ETag rápido a partir de mtime e tamanho
+func mtimeETag(info os.FileInfo) string {
+	return fmt.Sprintf(`"%x-%x"`, info.ModTime().Unix(), info.Size())
+}
+
+// etagMatch compara If-None-Match com o ETag (comparação fraca, RFC 9110)
+func etagMatch(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestETagStrategies(t *testing.T) {
+	root := t.TempDir()
+	os.WriteFile(filepath.Join(root, "app.js"), []byte("console.log(1)"), 0644)
+	os.Mkdir(filepath.Join(root, "videos"), 0755)
+	os.WriteFile(filepath.Join(root, "videos", "big.mp4"), []byte("video"), 0644)
+	os.WriteFile(filepath.Join(root, "notes.txt"), []byte("notes"), 0644)
+	server := newListingTestServer(t, root, func(c *Config) {
+		c.Performance.EnableETags = true
+		c.Performance.ETag = &ETagConfig{
+			Algorithm: "hash",
+			Rules: []ETagRule{
+				{Paths: []string{"/videos/**"}, Algorithm: "mtime", Weak: true},
+				{Paths: []string{"/*.txt"}, Algorithm: "none"},
+			},
+		}
+	})
+
+	get := func(path, inm string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		if inm != "" {
+			req.Header.Set("If-None-Match", inm)
+		}
+		w := httptest.NewRecorder()
+		server.mux.ServeHTTP(w, req)
+		return w
+	}
+
+	// Content hash: strong and stable
+	etag := get("/app.js", "").Header().Get("ETag")
+	if len(etag) != 34 || strings.HasPrefix(etag, "W/") {
+		t.Errorf("Expected strong content hash ETag, got %q", etag)
+	}
+	if w := get("/app.js", etag); w.Code != http.StatusNotModified {
+		t.Errorf("Expected 304 for matching ETag, got %d", w.Code)
+	}
+	os.WriteFile(filepath.Join(root, "app.js"), []byte("console.log(2)"), 0644)
+	if changed := get("/app.js", "").Header().Get("ETag"); changed == etag {
+		t.Errorf("Expected ETag to change with the content")
+	}
+
+	// mtime+size, weak; strong If-None-Match still matches (weak comparison)
+	etag = get("/videos/big.mp4", "").Header().Get("ETag")
+	if !strings.HasPrefix(etag, `W/"`) {
+		t.Errorf("Expected weak ETag, got %q", etag)
+	}
+	if w := get("/videos/big.mp4", strings.TrimPrefix(etag, "W/")); w.Code != http.StatusNotModified {
+		t.Errorf("Expected 304 for weak match, got %d", w.Code)
+	}
+
+	// Disabled
+	if etag := get("/notes.txt", "").Header().Get("ETag"); etag != "" {
+		t.Errorf("Expected no ETag, got %q", etag)
+	}
+
+	if _, err := NewETagger(&ETagConfig{Algorithm: "crc"}); err == nil {
+		t.Errorf("Expected error for unknown algorithm")
+	}
+}
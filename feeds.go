@@ -0,0 +1,454 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// feedCacheTTL por quanto tempo os itens de um feed são reaproveitados
+const feedCacheTTL = time.Minute
+
+// feedNamePattern nomes aceitos (viram parte da URL)
+var feedNamePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._-]*$`)
+
+// feedItem arquivo recente de um feed
+type feedItem struct {
+	path    string // caminho na URL
+	size    int64
+	modTime time.Time
+}
+
+// feedCacheEntry itens calculados para uma raiz
+type feedCacheEntry struct {
+	root    string
+	items   []feedItem
+	expires time.Time
+}
+
+// Feeds feeds RSS, Atom e JSON Feed dos arquivos adicionados ou alterados
+// recentemente em caminhos configurados, para assinar novas versões em vez
+// de consultar listagens
+type Feeds struct {
+	config *FeedsConfig
+	feeds  map[string]*FeedConfig
+	index  *RootIndex // nil: varre a raiz
+
+	mu    sync.Mutex
+	cache map[string]feedCacheEntry
+}
+
+// NewFeeds valida os feeds configurados
+func NewFeeds(config *FeedsConfig) (*Feeds, error) {
+	f := &Feeds{config: config, feeds: make(map[string]*FeedConfig), cache: make(map[string]feedCacheEntry)}
+	if !strings.HasPrefix(f.prefix(), "/") {
+		return nil, fmt.Errorf("invalid feeds prefix %q (must start with /)", config.Prefix)
+	}
+	if len(config.Feeds) == 0 {
+		return nil, errors.New("feeds requires at least one feed")
+	}
+	for i := range config.Feeds {
+		feed := &config.Feeds[i]
+		if !feedNamePattern.MatchString(feed.Name) {
+			return nil, fmt.Errorf("invalid feed name %q", feed.Name)
+		}
+		if _, dup := f.feeds[feed.Name]; dup {
+			return nil, fmt.Errorf("duplicate feed name %q", feed.Name)
+		}
+		if len(feed.Paths) == 0 {
+			return nil, fmt.Errorf("feed %s has no paths", feed.Name)
+		}
+		for _, pattern := range feed.Paths {
+			if !strings.HasPrefix(pattern, "/") {
+				return nil, fmt.Errorf("invalid feed path %q (must start with /)", pattern)
+			}
+		}
+		if feed.MaxItems < 0 || feed.MaxAge < 0 {
+			return nil, fmt.Errorf("feed %s: max_items and max_age must not be negative", feed.Name)
+		}
+		f.feeds[feed.Name] = feed
+	}
+	return f, nil
+}
+
+// prefix retorna o caminho onde os feeds são servidos
+func (f *Feeds) prefix() string {
+	if f.config.Prefix == "" {
+		return "/_feeds/"
+	}
+	return f.config.Prefix
+}
+
+// feedMaxItems retorna o limite de itens do feed
+func feedMaxItems(feed *FeedConfig) int {
+	if feed.MaxItems <= 0 {
+		return 50
+	}
+	return feed.MaxItems
+}
+
+// globBase diretório fixo do glob (antes do primeiro curinga), onde a
+// varredura começa
+func globBase(pattern string) string {
+	i := strings.IndexAny(pattern, "*?")
+	if i < 0 {
+		return pattern
+	}
+	return pattern[:strings.LastIndexByte(pattern[:i], '/')+1]
+}
+
+// feedMatches informa se o caminho está em algum glob do feed
+func feedMatches(feed *FeedConfig, urlPath string) bool {
+	for _, pattern := range feed.Paths {
+		if matchGlob(pattern, urlPath) {
+			return true
+		}
+	}
+	return false
+}
+
+// visiblePath informa se o arquivo e todos os diretórios acima dele
+// aparecem nas listagens (ocultos, agendados e lápides ficam de fora)
+func (s *Server) visiblePath(root, rel string) bool {
+	dir := root
+	for _, name := range strings.Split(rel, "/") {
+		if !s.listable(root, dir, name) {
+			return false
+		}
+		dir = filepath.Join(dir, name)
+	}
+	return true
+}
+
+// feedItems arquivos do feed em root, do mais recente para o mais antigo
+func (s *Server) feedItems(feed *FeedConfig, root string) []feedItem {
+	f := s.feeds
+	f.mu.Lock()
+	cached, ok := f.cache[feed.Name]
+	f.mu.Unlock()
+	if ok && cached.root == root && time.Now().Before(cached.expires) {
+		return cached.items
+	}
+
+	var items []feedItem
+	add := func(rel string, size int64, modTime time.Time) {
+		urlPath := "/" + rel
+		if feedMatches(feed, urlPath) && s.visiblePath(root, rel) {
+			items = append(items, feedItem{path: urlPath, size: size, modTime: modTime})
+		}
+	}
+	indexed := f.index != nil && f.index.Each(root, func(rel string, entry IndexEntry) {
+		if !entry.Dir {
+			add(rel, entry.Size, entry.ModTime)
+		}
+	})
+	if !indexed {
+		seen := make(map[string]bool)
+		for _, pattern := range feed.Paths {
+			base := filepath.Join(root, filepath.FromSlash(globBase(pattern)))
+			if !isWithin(root, base) {
+				continue
+			}
+			filepath.WalkDir(base, func(path string, d fs.DirEntry, err error) error {
+				if err != nil || path == root {
+					return nil
+				}
+				if d.IsDir() {
+					if d.Name() == ".git" || !s.listable(root, filepath.Dir(path), d.Name()) {
+						return filepath.SkipDir
+					}
+					return nil
+				}
+				rel, err := relPath(root, path)
+				if err != nil || seen[rel] || !d.Type().IsRegular() {
+					return nil
+				}
+				seen[rel] = true
+				if info, err := d.Info(); err == nil {
+					add(rel, info.Size(), info.ModTime())
+				}
+				return nil
+			})
+		}
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		if !items[i].modTime.Equal(items[j].modTime) {
+			return items[i].modTime.After(items[j].modTime)
+		}
+		return items[i].path < items[j].path
+	})
+	if feed.MaxAge > 0 {
+		cutoff := time.Now().AddDate(0, 0, -feed.MaxAge)
+		n := sort.Search(len(items), func(i int) bool { return items[i].modTime.Before(cutoff) })
+		items = items[:n]
+	}
+	if max := feedMaxItems(feed); len(items) > max {
+		items = items[:max]
+	}
+
+	f.mu.Lock()
+	f.cache[feed.Name] = feedCacheEntry{root: root, items: items, expires: time.Now().Add(feedCacheTTL)}
+	f.mu.Unlock()
+	return items
+}
+
+// baseURL endereço público do servidor (base_url ou o host da requisição)
+func (f *Feeds) baseURL(r *http.Request) string {
+	if f.config.BaseURL != "" {
+		return strings.TrimSuffix(f.config.BaseURL, "/")
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
+
+// feedMimeType tipo do arquivo para o enclosure
+func feedMimeType(path string) string {
+	if ctype := mime.TypeByExtension(filepath.Ext(path)); ctype != "" {
+		return ctype
+	}
+	return "application/octet-stream"
+}
+
+// handleFeed serve /_feeds/<nome>.rss, .atom ou .json
+func (s *Server) handleFeed(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	debugNote(r, "backend", "feed")
+
+	file := strings.TrimPrefix(r.URL.Path, s.feeds.prefix())
+	ext := filepath.Ext(file)
+	feed, ok := s.feeds.feeds[strings.TrimSuffix(file, ext)]
+	if !ok || (ext != ".rss" && ext != ".atom" && ext != ".json") {
+		s.serveError(w, r, http.StatusNotFound)
+		return
+	}
+
+	// Os itens ficam em cache para todos: a ACL e demais regras por caminho
+	// valem para quem pede o feed
+	var items []feedItem
+	for _, item := range s.feedItems(feed, s.requestRoot(r)) {
+		if checkResource(r, item.path) == 0 {
+			items = append(items, item)
+		}
+	}
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%s\n", ext, s.feeds.baseURL(r))
+	for _, item := range items {
+		fmt.Fprintf(h, "%s\x00%d\x00%d\n", item.path, item.size, item.modTime.UnixNano())
+	}
+	etag := fmt.Sprintf(`W/"%x"`, h.Sum(nil)[:12])
+	w.Header().Set("ETag", etag)
+	if match := r.Header.Get("If-None-Match"); match != "" && etagMatch(match, etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	var body []byte
+	var err error
+	switch ext {
+	case ".rss":
+		w.Header().Set("Content-Type", "application/rss+xml; charset=utf-8")
+		body, err = s.rssFeed(r, feed, items)
+	case ".atom":
+		w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+		body, err = s.atomFeed(r, feed, items)
+	default:
+		w.Header().Set("Content-Type", "application/feed+json; charset=utf-8")
+		body, err = s.jsonFeed(r, feed, items)
+	}
+	if err != nil {
+		s.logger.Error("Error rendering feed %s: %v", feed.Name, err)
+		s.serveError(w, r, http.StatusInternalServerError)
+		return
+	}
+	if r.Method == http.MethodHead {
+		return
+	}
+	w.Write(body)
+}
+
+// feedTitle título do feed (default: o nome)
+func feedTitle(feed *FeedConfig) string {
+	if feed.Title != "" {
+		return feed.Title
+	}
+	return feed.Name
+}
+
+// feedUpdated data do item mais recente
+func feedUpdated(items []feedItem) time.Time {
+	if len(items) == 0 {
+		return time.Unix(0, 0).UTC()
+	}
+	return items[0].modTime.UTC()
+}
+
+// feedItemID identificador do item: muda quando o arquivo é alterado, para
+// que leitores o mostrem de novo
+func feedItemID(url string, item feedItem) string {
+	return fmt.Sprintf("%s#%d", url, item.modTime.Unix())
+}
+
+// rssFeed gera o feed RSS 2.0
+func (s *Server) rssFeed(r *http.Request, feed *FeedConfig, items []feedItem) ([]byte, error) {
+	type enclosure struct {
+		URL    string `xml:"url,attr"`
+		Length int64  `xml:"length,attr"`
+		Type   string `xml:"type,attr"`
+	}
+	type guid struct {
+		Value       string `xml:",chardata"`
+		IsPermaLink bool   `xml:"isPermaLink,attr"`
+	}
+	type item struct {
+		Title     string    `xml:"title"`
+		Link      string    `xml:"link"`
+		GUID      guid      `xml:"guid"`
+		PubDate   string    `xml:"pubDate"`
+		Enclosure enclosure `xml:"enclosure"`
+	}
+	type channel struct {
+		Title         string `xml:"title"`
+		Link          string `xml:"link"`
+		Description   string `xml:"description"`
+		LastBuildDate string `xml:"lastBuildDate"`
+		Items         []item `xml:"item"`
+	}
+	type rss struct {
+		XMLName xml.Name `xml:"rss"`
+		Version string   `xml:"version,attr"`
+		Channel channel  `xml:"channel"`
+	}
+
+	base := s.feeds.baseURL(r)
+	doc := rss{Version: "2.0", Channel: channel{
+		Title:         feedTitle(feed),
+		Link:          base + "/",
+		Description:   "Recently added or modified files: " + strings.Join(feed.Paths, ", "),
+		LastBuildDate: feedUpdated(items).Format(time.RFC1123Z),
+	}}
+	for _, it := range items {
+		url := base + escapeURLPath(it.path)
+		doc.Channel.Items = append(doc.Channel.Items, item{
+			Title:     strings.TrimPrefix(it.path, "/"),
+			Link:      url,
+			GUID:      guid{Value: feedItemID(url, it)},
+			PubDate:   it.modTime.UTC().Format(time.RFC1123Z),
+			Enclosure: enclosure{URL: url, Length: it.size, Type: feedMimeType(it.path)},
+		})
+	}
+	data, err := xml.MarshalIndent(doc, "", "  ")
+	return append([]byte(xml.Header), data...), err
+}
+
+// atomFeed gera o feed Atom (RFC 4287)
+func (s *Server) atomFeed(r *http.Request, feed *FeedConfig, items []feedItem) ([]byte, error) {
+	type link struct {
+		Href   string `xml:"href,attr"`
+		Rel    string `xml:"rel,attr,omitempty"`
+		Type   string `xml:"type,attr,omitempty"`
+		Length int64  `xml:"length,attr,omitempty"`
+	}
+	type entry struct {
+		ID      string `xml:"id"`
+		Title   string `xml:"title"`
+		Updated string `xml:"updated"`
+		Links   []link `xml:"link"`
+	}
+	type atom struct {
+		XMLName xml.Name `xml:"http://www.w3.org/2005/Atom feed"`
+		ID      string   `xml:"id"`
+		Title   string   `xml:"title"`
+		Updated string   `xml:"updated"`
+		Author  string   `xml:"author>name"`
+		Links   []link   `xml:"link"`
+		Entries []entry  `xml:"entry"`
+	}
+
+	base := s.feeds.baseURL(r)
+	self := base + escapeURLPath(r.URL.Path)
+	doc := atom{
+		ID:      self,
+		Title:   feedTitle(feed),
+		Updated: feedUpdated(items).Format(time.RFC3339),
+		Author:  "qserv",
+		Links:   []link{{Href: self, Rel: "self"}, {Href: base + "/"}},
+	}
+	for _, it := range items {
+		url := base + escapeURLPath(it.path)
+		doc.Entries = append(doc.Entries, entry{
+			ID:      feedItemID(url, it),
+			Title:   strings.TrimPrefix(it.path, "/"),
+			Updated: it.modTime.UTC().Format(time.RFC3339),
+			Links: []link{
+				{Href: url, Rel: "alternate"},
+				{Href: url, Rel: "enclosure", Type: feedMimeType(it.path), Length: it.size},
+			},
+		})
+	}
+	data, err := xml.MarshalIndent(doc, "", "  ")
+	return append([]byte(xml.Header), data...), err
+}
+
+// jsonFeed gera o JSON Feed 1.1
+func (s *Server) jsonFeed(r *http.Request, feed *FeedConfig, items []feedItem) ([]byte, error) {
+	type attachment struct {
+		URL         string `json:"url"`
+		MimeType    string `json:"mime_type"`
+		SizeInBytes int64  `json:"size_in_bytes"`
+	}
+	type item struct {
+		ID           string       `json:"id"`
+		URL          string       `json:"url"`
+		Title        string       `json:"title"`
+		ContentText  string       `json:"content_text"`
+		DateModified string       `json:"date_modified"`
+		Attachments  []attachment `json:"attachments"`
+	}
+	type jsonFeed struct {
+		Version     string `json:"version"`
+		Title       string `json:"title"`
+		HomePageURL string `json:"home_page_url"`
+		FeedURL     string `json:"feed_url"`
+		Items       []item `json:"items"`
+	}
+
+	base := s.feeds.baseURL(r)
+	doc := jsonFeed{
+		Version:     "https://jsonfeed.org/version/1.1",
+		Title:       feedTitle(feed),
+		HomePageURL: base + "/",
+		FeedURL:     base + escapeURLPath(r.URL.Path),
+		Items:       []item{},
+	}
+	for _, it := range items {
+		url := base + escapeURLPath(it.path)
+		doc.Items = append(doc.Items, item{
+			ID:           feedItemID(url, it),
+			URL:          url,
+			Title:        strings.TrimPrefix(it.path, "/"),
+			ContentText:  formatSize(it.size),
+			DateModified: it.modTime.UTC().Format(time.RFC3339),
+			Attachments:  []attachment{{URL: url, MimeType: feedMimeType(it.path), SizeInBytes: it.size}},
+		})
+	}
+	return json.MarshalIndent(doc, "", "  ")
+}
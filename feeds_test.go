@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newFeedsTestServer(t *testing.T, indexed bool) (*Server, string) {
+	t.Helper()
+	root := t.TempDir()
+	now := time.Now()
+	files := []struct {
+		path string
+		age  time.Duration
+	}{
+		{"releases/v1/app.tar.gz", 72 * time.Hour},
+		{"releases/v2/app.tar.gz", time.Hour},
+		{"releases/v2/.draft", 0},
+		{"releases/notes.txt", 24 * time.Hour},
+		{"other/file.txt", 0},
+	}
+	for _, f := range files {
+		path := filepath.Join(root, filepath.FromSlash(f.path))
+		writeTestFile(t, path, "data")
+		os.Chtimes(path, now.Add(-f.age), now.Add(-f.age))
+	}
+
+	server := newListingTestServer(t, root, func(c *Config) {
+		c.Security.BlockHiddenFiles = true
+		c.Feeds = &FeedsConfig{Enabled: true, BaseURL: "https://dl.example.com", Feeds: []FeedConfig{
+			{Name: "releases", Title: "Releases", Paths: []string{"/releases/**"}},
+			{Name: "latest", Paths: []string{"/releases/**"}, MaxItems: 1},
+		}}
+		if indexed {
+			c.Index = &IndexConfig{Enabled: true, File: filepath.Join(t.TempDir(), "index.json")}
+		}
+	})
+	if indexed {
+		if _, err := server.rootIndex.Build(root); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return server, root
+}
+
+func TestFeedJSON(t *testing.T) {
+	for _, indexed := range []bool{false, true} {
+		server, _ := newFeedsTestServer(t, indexed)
+		w := httptest.NewRecorder()
+		server.mux.ServeHTTP(w, httptest.NewRequest("GET", "/_feeds/releases.json", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d", w.Code)
+		}
+		var feed struct {
+			Title string `json:"title"`
+			Items []struct {
+				URL         string `json:"url"`
+				Attachments []struct {
+					SizeInBytes int64 `json:"size_in_bytes"`
+				} `json:"attachments"`
+			} `json:"items"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &feed); err != nil {
+			t.Fatalf("Invalid JSON feed: %v", err)
+		}
+		// Newest first; hidden files and other paths are left out
+		var urls []string
+		for _, item := range feed.Items {
+			urls = append(urls, item.URL)
+		}
+		want := "https://dl.example.com/releases/v2/app.tar.gz https://dl.example.com/releases/notes.txt https://dl.example.com/releases/v1/app.tar.gz"
+		if feed.Title != "Releases" || strings.Join(urls, " ") != want {
+			t.Errorf("indexed=%t: Unexpected feed %q %v", indexed, feed.Title, urls)
+		}
+		if len(feed.Items) > 0 && feed.Items[0].Attachments[0].SizeInBytes != 4 {
+			t.Errorf("Expected attachment size 4, got %+v", feed.Items[0].Attachments)
+		}
+	}
+}
+
+func TestFeedRSSAndAtom(t *testing.T) {
+	server, _ := newFeedsTestServer(t, false)
+
+	w := httptest.NewRecorder()
+	server.mux.ServeHTTP(w, httptest.NewRequest("GET", "/_feeds/latest.rss", nil))
+	var rss struct {
+		Channel struct {
+			Items []struct {
+				Link string `xml:"link"`
+			} `xml:"item"`
+		} `xml:"channel"`
+	}
+	if err := xml.Unmarshal(w.Body.Bytes(), &rss); err != nil {
+		t.Fatalf("Invalid RSS: %v", err)
+	}
+	if len(rss.Channel.Items) != 1 || rss.Channel.Items[0].Link != "https://dl.example.com/releases/v2/app.tar.gz" {
+		t.Errorf("Expected only the newest item, got %+v", rss.Channel.Items)
+	}
+
+	w = httptest.NewRecorder()
+	server.mux.ServeHTTP(w, httptest.NewRequest("GET", "/_feeds/releases.atom", nil))
+	var atom struct {
+		Entries []struct {
+			ID string `xml:"id"`
+		} `xml:"entry"`
+	}
+	if err := xml.Unmarshal(w.Body.Bytes(), &atom); err != nil {
+		t.Fatalf("Invalid Atom: %v", err)
+	}
+	if len(atom.Entries) != 3 || w.Header().Get("Content-Type") != "application/atom+xml; charset=utf-8" {
+		t.Errorf("Expected 3 Atom entries, got %d (%s)", len(atom.Entries), w.Header().Get("Content-Type"))
+	}
+
+	// Conditional requests
+	req := httptest.NewRequest("GET", "/_feeds/releases.atom", nil)
+	req.Header.Set("If-None-Match", w.Header().Get("ETag"))
+	w = httptest.NewRecorder()
+	server.mux.ServeHTTP(w, req)
+	if w.Code != http.StatusNotModified {
+		t.Errorf("Expected 304, got %d", w.Code)
+	}
+
+	for _, path := range []string{"/_feeds/missing.rss", "/_feeds/releases.xml"} {
+		w = httptest.NewRecorder()
+		server.mux.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if w.Code != http.StatusNotFound {
+			t.Errorf("%s: Expected 404, got %d", path, w.Code)
+		}
+	}
+}
+
+func TestNewFeedsValidation(t *testing.T) {
+	tests := []FeedsConfig{
+		{Feeds: nil},
+		{Feeds: []FeedConfig{{Name: "a/b", Paths: []string{"/x/**"}}}},
+		{Feeds: []FeedConfig{{Name: "a", Paths: []string{"x/**"}}}},
+		{Feeds: []FeedConfig{{Name: "a", Paths: []string{"/x"}}, {Name: "a", Paths: []string{"/y"}}}},
+	}
+	for i, config := range tests {
+		if _, err := NewFeeds(&config); err == nil {
+			t.Errorf("Case %d: Expected validation error", i)
+		}
+	}
+}
@@ -0,0 +1,512 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// fileAPIPrefix rota do serviço qserv.files.v1.FileService (protocolo
+// Connect: POST /<pacote>.<Serviço>/<Método>)
+const fileAPIPrefix = "/qserv.files.v1.FileService/"
+
+// Flags do envelope de streaming do Connect
+const (
+	connectFlagEndStream = 0x02
+	connectMaxEnvelope   = 1 << 20
+)
+
+// FileAPI API tipada de arquivos no protocolo Connect (codec JSON): List,
+// Stat, Read (streaming) e, com allow_write, Write. Passa pelos mesmos
+// middlewares do HTTP (basic auth, filtro de IP, rate limit) e aplica as
+// mesmas regras de visibilidade do servidor de arquivos. ACL, janelas de
+// horário e cookies assinados valem para o caminho do arquivo (checkResource).
+type FileAPI struct {
+	config *FileAPIConfig
+}
+
+// NewFileAPI cria a API de arquivos
+func NewFileAPI(config *FileAPIConfig) (*FileAPI, error) {
+	if config.MaxWriteSize < 0 || config.ChunkSize < 0 {
+		return nil, errors.New("file_api: max_write_size and chunk_size must not be negative")
+	}
+	return &FileAPI{config: config}, nil
+}
+
+// chunkSize retorna o tamanho de cada mensagem de Read
+func (a *FileAPI) chunkSize() int {
+	if a.config.ChunkSize <= 0 {
+		return 64 << 10
+	}
+	return a.config.ChunkSize
+}
+
+// maxWriteSize retorna o maior arquivo aceito por Write
+func (a *FileAPI) maxWriteSize() int64 {
+	if a.config.MaxWriteSize <= 0 {
+		return 32 << 20
+	}
+	return a.config.MaxWriteSize
+}
+
+// int64JSON inteiro de 64 bits no formato do protojson (string), aceitando
+// também número na entrada
+type int64JSON int64
+
+func (n int64JSON) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + strconv.FormatInt(int64(n), 10) + `"`), nil
+}
+
+func (n *int64JSON) UnmarshalJSON(data []byte) error {
+	v, err := strconv.ParseInt(strings.Trim(string(data), `"`), 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid int64 %s", data)
+	}
+	*n = int64JSON(v)
+	return nil
+}
+
+// Mensagens do serviço (nomes de campo do protojson, ver files.proto)
+type (
+	fileAPIPathRequest struct {
+		Path string `json:"path"`
+	}
+	fileAPIInfo struct {
+		Name    string    `json:"name"`
+		Path    string    `json:"path"`
+		IsDir   bool      `json:"isDir,omitempty"`
+		Size    int64JSON `json:"size"`
+		ModTime string    `json:"modTime"`
+		SHA256  string    `json:"sha256,omitempty"`
+	}
+	fileAPIListResponse struct {
+		Entries []fileAPIInfo `json:"entries"`
+	}
+	fileAPIReadRequest struct {
+		Path   string    `json:"path"`
+		Offset int64JSON `json:"offset"`
+		Length int64JSON `json:"length"` // 0: até o fim
+	}
+	fileAPIReadResponse struct {
+		Offset int64JSON `json:"offset"`
+		Data   []byte    `json:"data"`
+	}
+	fileAPIWriteRequest struct {
+		Path       string `json:"path"`
+		Data       []byte `json:"data"`
+		CreateOnly bool   `json:"createOnly"`
+	}
+)
+
+// connectError erro no formato do Connect
+type connectError struct {
+	Code    string `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+func (e *connectError) Error() string {
+	return e.Code + ": " + e.Message
+}
+
+// connectStatus status HTTP de cada código de erro do Connect
+var connectStatus = map[string]int{
+	"invalid_argument":    http.StatusBadRequest,
+	"failed_precondition": http.StatusBadRequest,
+	"out_of_range":        http.StatusBadRequest,
+	"unauthenticated":     http.StatusUnauthorized,
+	"permission_denied":   http.StatusForbidden,
+	"not_found":           http.StatusNotFound,
+	"already_exists":      http.StatusConflict,
+	"resource_exhausted":  http.StatusTooManyRequests,
+	"unimplemented":       http.StatusNotImplemented,
+	"internal":            http.StatusInternalServerError,
+}
+
+// apiError converte erros do sistema de arquivos em erros do Connect
+func apiError(err error) *connectError {
+	var ce *connectError
+	var quota *QuotaError
+	switch {
+	case errors.As(err, &ce):
+		return ce
+	case errors.As(err, &quota):
+		return &connectError{Code: "resource_exhausted", Message: quota.Error()}
+	case errors.Is(err, fs.ErrNotExist):
+		return &connectError{Code: "not_found", Message: "file not found"}
+	case errors.Is(err, fs.ErrPermission):
+		return &connectError{Code: "permission_denied", Message: "access denied"}
+	}
+	return &connectError{Code: "internal", Message: "internal error"}
+}
+
+// handleFileAPI despacha POST /qserv.files.v1.FileService/<Método>
+func (s *Server) handleFileAPI(w http.ResponseWriter, r *http.Request) {
+	method := strings.TrimPrefix(r.URL.Path, fileAPIPrefix)
+	debugNote(r, "serve", "file-api")
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeConnectError(w, http.StatusMethodNotAllowed, &connectError{Code: "unimplemented", Message: "use POST"})
+		return
+	}
+
+	ctype, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if method == "Read" {
+		if ctype != "application/connect+json" {
+			writeConnectError(w, http.StatusUnsupportedMediaType, &connectError{Code: "unimplemented", Message: "Read expects application/connect+json"})
+			return
+		}
+		s.fileAPIRead(w, r)
+		return
+	}
+	if ctype != "application/json" {
+		writeConnectError(w, http.StatusUnsupportedMediaType, &connectError{Code: "unimplemented", Message: "only the JSON codec is supported"})
+		return
+	}
+
+	limit := int64(64 << 10)
+	if method == "Write" {
+		// Conteúdo em base64 mais o restante da mensagem
+		limit = s.fileAPI.maxWriteSize()/3*4 + 64<<10
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, limit))
+	if err != nil {
+		writeConnectError(w, http.StatusBadRequest, &connectError{Code: "invalid_argument", Message: "request too large or unreadable"})
+		return
+	}
+
+	var resp interface{}
+	switch method {
+	case "List":
+		var req fileAPIPathRequest
+		if err = decodeConnect(body, &req); err == nil {
+			resp, err = s.fileAPIList(r, req)
+		}
+	case "Stat":
+		var req fileAPIPathRequest
+		if err = decodeConnect(body, &req); err == nil {
+			resp, err = s.fileAPIStat(r, req)
+		}
+	case "Write":
+		var req fileAPIWriteRequest
+		if err = decodeConnect(body, &req); err == nil {
+			resp, err = s.fileAPIWrite(r, req)
+		}
+	default:
+		err = &connectError{Code: "unimplemented", Message: "unknown method " + method}
+	}
+	if err != nil {
+		ce := apiError(err)
+		if ce.Code == "internal" {
+			s.logger.Error("File API %s: %v", method, err)
+		}
+		writeConnectError(w, connectStatus[ce.Code], ce)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// decodeConnect decodifica uma mensagem JSON (campos desconhecidos são
+// ignorados, como no protojson com DiscardUnknown)
+func decodeConnect(body []byte, v interface{}) error {
+	if err := json.Unmarshal(body, v); err != nil {
+		return &connectError{Code: "invalid_argument", Message: err.Error()}
+	}
+	return nil
+}
+
+// writeConnectError responde um erro unário do Connect
+func writeConnectError(w http.ResponseWriter, status int, ce *connectError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(ce)
+}
+
+// fileAPILookup resolve o caminho pedido com as regras de visibilidade
+func (s *Server) fileAPILookup(r *http.Request, urlPath string) (string, os.FileInfo, error) {
+	urlPath = cleanURLPath(urlPath)
+	if err := fileAPIAccess(r, urlPath); err != nil {
+		return "", nil, err
+	}
+	return s.resolveVisible(s.requestRoot(r), urlPath)
+}
+
+// fileAPIAccess aplica ao caminho pedido as regras por caminho da cadeia: a
+// rota é sempre a mesma URL, então os middlewares não as veem
+func fileAPIAccess(r *http.Request, urlPath string) error {
+	switch checkResource(r, urlPath) {
+	case 0:
+		return nil
+	case http.StatusUnauthorized:
+		return &connectError{Code: "unauthenticated", Message: "authentication required"}
+	}
+	return &connectError{Code: "permission_denied", Message: "access denied"}
+}
+
+// fileAPIEntry converte o FileInfo na mensagem da API
+func (s *Server) fileAPIEntry(path, urlPath string, info os.FileInfo) fileAPIInfo {
+	entry := fileAPIInfo{
+		Name:    info.Name(),
+		Path:    urlPath,
+		IsDir:   info.IsDir(),
+		ModTime: info.ModTime().UTC().Format(time.RFC3339Nano),
+	}
+	if !info.IsDir() {
+		entry.Size = int64JSON(info.Size())
+		if s.rootIndex != nil {
+			if indexed, ok := s.rootIndex.Lookup(path, info); ok {
+				entry.SHA256 = indexed.SHA256
+			}
+		}
+	}
+	return entry
+}
+
+// fileAPIStat implementa Stat
+func (s *Server) fileAPIStat(r *http.Request, req fileAPIPathRequest) (fileAPIInfo, error) {
+	path, info, err := s.fileAPILookup(r, req.Path)
+	if err != nil {
+		return fileAPIInfo{}, err
+	}
+	return s.fileAPIEntry(path, cleanURLPath(req.Path), info), nil
+}
+
+// fileAPIList implementa List; só com a listagem de diretórios ativa
+func (s *Server) fileAPIList(r *http.Request, req fileAPIPathRequest) (fileAPIListResponse, error) {
+	if !s.config.Features.DirectoryListing {
+		return fileAPIListResponse{}, &connectError{Code: "permission_denied", Message: "directory listing is disabled"}
+	}
+	path, info, err := s.fileAPILookup(r, req.Path)
+	if err != nil {
+		return fileAPIListResponse{}, err
+	}
+	if !info.IsDir() {
+		return fileAPIListResponse{}, &connectError{Code: "failed_precondition", Message: "not a directory"}
+	}
+	infos, err := s.visibleEntries(s.requestRoot(r), path)
+	if err != nil {
+		return fileAPIListResponse{}, err
+	}
+	dir := strings.TrimSuffix(cleanURLPath(req.Path), "/")
+	resp := fileAPIListResponse{Entries: make([]fileAPIInfo, 0, len(infos))}
+	for _, entry := range infos {
+		resp.Entries = append(resp.Entries, s.fileAPIEntry(filepath.Join(path, entry.Name()), dir+"/"+entry.Name(), entry))
+	}
+	return resp, nil
+}
+
+// fileAPIRead implementa Read: envia o arquivo em mensagens de chunk_size
+// bytes e fecha o stream com o erro, se houver
+func (s *Server) fileAPIRead(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/connect+json")
+	w.Header().Set("Cache-Control", "no-store")
+
+	var req fileAPIReadRequest
+	f, size, err := s.fileAPIOpen(r, &req)
+	if err != nil {
+		ce := apiError(err)
+		if ce.Code == "internal" {
+			s.logger.Error("File API Read: %v", err)
+		}
+		writeConnectEnd(w, ce)
+		return
+	}
+	defer f.Close()
+
+	end := size
+	if req.Length > 0 && int64(req.Offset)+int64(req.Length) < size {
+		end = int64(req.Offset) + int64(req.Length)
+	}
+	buf := make([]byte, s.fileAPI.chunkSize())
+	for offset := int64(req.Offset); offset < end; {
+		chunk := buf
+		if remaining := end - offset; remaining < int64(len(chunk)) {
+			chunk = chunk[:remaining]
+		}
+		n, err := f.ReadAt(chunk, offset)
+		if n > 0 {
+			if werr := writeConnectMessage(w, 0, fileAPIReadResponse{Offset: int64JSON(offset), Data: chunk[:n]}); werr != nil {
+				return
+			}
+			offset += int64(n)
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			s.logger.Error("File API Read: %v", err)
+			writeConnectEnd(w, &connectError{Code: "internal", Message: "read error"})
+			return
+		}
+	}
+	writeConnectEnd(w, nil)
+}
+
+// fileAPIOpen lê a mensagem envelopada de Read e abre o arquivo pedido
+func (s *Server) fileAPIOpen(r *http.Request, req *fileAPIReadRequest) (*os.File, int64, error) {
+	var prefix [5]byte
+	if _, err := io.ReadFull(r.Body, prefix[:]); err != nil {
+		return nil, 0, &connectError{Code: "invalid_argument", Message: "missing request envelope"}
+	}
+	length := binary.BigEndian.Uint32(prefix[1:])
+	if prefix[0] != 0 || length > connectMaxEnvelope {
+		return nil, 0, &connectError{Code: "invalid_argument", Message: "invalid request envelope"}
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r.Body, body); err != nil {
+		return nil, 0, &connectError{Code: "invalid_argument", Message: "truncated request envelope"}
+	}
+	if err := decodeConnect(body, req); err != nil {
+		return nil, 0, err
+	}
+	if req.Offset < 0 || req.Length < 0 {
+		return nil, 0, &connectError{Code: "invalid_argument", Message: "offset and length must not be negative"}
+	}
+
+	path, info, err := s.fileAPILookup(r, req.Path)
+	if err != nil {
+		return nil, 0, err
+	}
+	if info.IsDir() {
+		return nil, 0, &connectError{Code: "failed_precondition", Message: "is a directory"}
+	}
+	if int64(req.Offset) > info.Size() {
+		return nil, 0, &connectError{Code: "out_of_range", Message: "offset beyond end of file"}
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	return f, info.Size(), nil
+}
+
+// writeConnectMessage escreve uma mensagem envelopada do stream
+func writeConnectMessage(w http.ResponseWriter, flags byte, msg interface{}) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	var prefix [5]byte
+	prefix[0] = flags
+	binary.BigEndian.PutUint32(prefix[1:], uint32(len(data)))
+	if _, err := w.Write(prefix[:]); err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// writeConnectEnd encerra o stream, com o erro quando ce não é nil
+func writeConnectEnd(w http.ResponseWriter, ce *connectError) {
+	end := struct {
+		Error *connectError `json:"error,omitempty"`
+	}{ce}
+	writeConnectMessage(w, connectFlagEndStream, end)
+}
+
+// fileAPIWrite implementa Write (só com allow_write): grava o arquivo de
+// forma atômica, guardando a versão anterior e respeitando as quotas
+func (s *Server) fileAPIWrite(r *http.Request, req fileAPIWriteRequest) (fileAPIInfo, error) {
+	if !s.fileAPI.config.AllowWrite {
+		return fileAPIInfo{}, &connectError{Code: "permission_denied", Message: "writes are disabled"}
+	}
+	if int64(len(req.Data)) > s.fileAPI.maxWriteSize() {
+		return fileAPIInfo{}, &connectError{Code: "resource_exhausted", Message: "file exceeds max_write_size"}
+	}
+	urlPath := cleanURLPath(req.Path)
+	if urlPath == "/" || strings.HasSuffix(req.Path, "/") {
+		return fileAPIInfo{}, &connectError{Code: "invalid_argument", Message: "path must name a file"}
+	}
+
+	// O diretório precisa existir e estar visível; o nome também
+	root := s.requestRoot(r)
+	urlDir, name := urlPath[:strings.LastIndex(urlPath, "/")+1], urlPath[strings.LastIndex(urlPath, "/")+1:]
+	dir, dirInfo, err := s.fileAPILookup(r, urlDir)
+	if err != nil {
+		return fileAPIInfo{}, err
+	}
+	if !dirInfo.IsDir() {
+		return fileAPIInfo{}, &connectError{Code: "failed_precondition", Message: "parent is not a directory"}
+	}
+	path := filepath.Join(dir, name)
+	if !s.listable(root, dir, name) || (s.listingRules != nil && s.listingRules.Blocked(root, path)) {
+		return fileAPIInfo{}, fs.ErrPermission
+	}
+	if err := fileAPIAccess(r, urlPath); err != nil {
+		return fileAPIInfo{}, err
+	}
+
+	replaced := int64(-1)
+	if info, err := os.Stat(path); err == nil {
+		if info.IsDir() {
+			return fileAPIInfo{}, &connectError{Code: "failed_precondition", Message: "is a directory"}
+		}
+		if req.CreateOnly {
+			return fileAPIInfo{}, &connectError{Code: "already_exists", Message: "file already exists"}
+		}
+		replaced = info.Size()
+	}
+	if s.quotas != nil {
+		if err := s.quotas.Check(root, urlPath, int64(len(req.Data)), replaced); err != nil {
+			return fileAPIInfo{}, err
+		}
+	}
+	if s.versions != nil && replaced >= 0 {
+		if err := s.versions.Save(root, path); err != nil {
+			return fileAPIInfo{}, err
+		}
+	}
+
+	tmp, err := os.CreateTemp(dir, ".qserv-write-*")
+	if err != nil {
+		return fileAPIInfo{}, err
+	}
+	_, err = tmp.Write(req.Data)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return fileAPIInfo{}, err
+	}
+
+	if s.quotas != nil {
+		if replaced >= 0 {
+			s.quotas.Record(urlPath, int64(len(req.Data))-replaced, 0)
+		} else {
+			s.quotas.Record(urlPath, int64(len(req.Data)), 1)
+		}
+	}
+	s.PurgeCaches(PurgeRequest{Path: urlPath})
+	s.logger.Info("File API: wrote %s (%s)", urlPath, formatSize(int64(len(req.Data))))
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileAPIInfo{}, err
+	}
+	return s.fileAPIEntry(path, urlPath, info), nil
+}
+
+// cleanURLPath normaliza o caminho pedido (sempre começando por /)
+func cleanURLPath(p string) string {
+	clean := filepath.ToSlash(filepath.Clean(filepath.FromSlash("/" + p)))
+	if !strings.HasPrefix(clean, "/") {
+		clean = "/" + clean
+	}
+	return clean
+}
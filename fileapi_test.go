@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// callFileAPI posts a unary Connect request and decodes the response
+func callFileAPI(t *testing.T, server *Server, method, body string, out interface{}) int {
+	t.Helper()
+	req := httptest.NewRequest("POST", fileAPIPrefix+method, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	server.mux.ServeHTTP(w, req)
+	if out != nil {
+		if err := json.Unmarshal(w.Body.Bytes(), out); err != nil {
+			t.Fatalf("Expected JSON response, got %q", w.Body.String())
+		}
+	}
+	return w.Code
+}
+
+// readFileAPI calls the streaming Read method and returns the data and the end-of-stream error
+func readFileAPI(t *testing.T, server *Server, body string) (string, *connectError) {
+	t.Helper()
+	var envelope bytes.Buffer
+	envelope.WriteByte(0)
+	binary.Write(&envelope, binary.BigEndian, uint32(len(body)))
+	envelope.WriteString(body)
+	req := httptest.NewRequest("POST", fileAPIPrefix+"Read", &envelope)
+	req.Header.Set("Content-Type", "application/connect+json")
+	w := httptest.NewRecorder()
+	server.mux.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200 for streams, got %d", w.Code)
+	}
+
+	var data bytes.Buffer
+	stream := w.Body.Bytes()
+	for len(stream) >= 5 {
+		flags, size := stream[0], binary.BigEndian.Uint32(stream[1:5])
+		msg := stream[5 : 5+size]
+		stream = stream[5+size:]
+		if flags&connectFlagEndStream != 0 {
+			var end struct {
+				Error *connectError `json:"error"`
+			}
+			json.Unmarshal(msg, &end)
+			return data.String(), end.Error
+		}
+		var chunk fileAPIReadResponse
+		json.Unmarshal(msg, &chunk)
+		data.Write(chunk.Data)
+	}
+	t.Fatal("Expected end-of-stream message")
+	return "", nil
+}
+
+func newFileAPITestServer(t *testing.T, root string, allowWrite bool) *Server {
+	return newListingTestServer(t, root, func(c *Config) {
+		c.FileAPI = &FileAPIConfig{Enabled: true, AllowWrite: allowWrite, ChunkSize: 4}
+	})
+}
+
+func TestFileAPIListAndStat(t *testing.T) {
+	root := t.TempDir()
+	writeTestFile(t, filepath.Join(root, "docs", "a.txt"), "alpha")
+	writeTestFile(t, filepath.Join(root, "docs", ".hidden"), "x")
+	os.Mkdir(filepath.Join(root, "docs", "sub"), 0755)
+	server := newFileAPITestServer(t, root, false)
+
+	var list fileAPIListResponse
+	if code := callFileAPI(t, server, "List", `{"path":"/docs"}`, &list); code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", code)
+	}
+	if len(list.Entries) != 2 || list.Entries[0].Name != "a.txt" || list.Entries[1].Name != "sub" || !list.Entries[1].IsDir {
+		t.Errorf("Expected a.txt and sub/, got %+v", list.Entries)
+	}
+	if list.Entries[0].Path != "/docs/a.txt" || list.Entries[0].Size != 5 {
+		t.Errorf("Expected path and size of a.txt, got %+v", list.Entries[0])
+	}
+
+	var info map[string]interface{}
+	callFileAPI(t, server, "Stat", `{"path":"docs/a.txt"}`, &info)
+	if info["size"] != "5" {
+		t.Errorf("Expected int64 size as string, got %v", info["size"])
+	}
+
+	var ce connectError
+	if code := callFileAPI(t, server, "Stat", `{"path":"/docs/.hidden"}`, &ce); code != http.StatusNotFound || ce.Code != "not_found" {
+		t.Errorf("Expected not_found for hidden file, got %d %+v", code, ce)
+	}
+	if code := callFileAPI(t, server, "Stat", `{"path":"/../etc/passwd"}`, &ce); code != http.StatusNotFound {
+		t.Errorf("Expected not_found outside the root, got %d", code)
+	}
+	if code := callFileAPI(t, server, "Delete", `{}`, &ce); code != http.StatusNotImplemented || ce.Code != "unimplemented" {
+		t.Errorf("Expected unimplemented, got %d %+v", code, ce)
+	}
+}
+
+func TestFileAPIListRequiresDirectoryListing(t *testing.T) {
+	root := t.TempDir()
+	server := newListingTestServer(t, root, func(c *Config) {
+		c.Features.DirectoryListing = false
+		c.FileAPI = &FileAPIConfig{Enabled: true}
+	})
+	var ce connectError
+	if code := callFileAPI(t, server, "List", `{"path":"/"}`, &ce); code != http.StatusForbidden || ce.Code != "permission_denied" {
+		t.Errorf("Expected permission_denied, got %d %+v", code, ce)
+	}
+}
+
+func TestFileAPIRead(t *testing.T) {
+	root := t.TempDir()
+	writeTestFile(t, filepath.Join(root, "log.txt"), "0123456789")
+	server := newFileAPITestServer(t, root, false)
+
+	if data, ce := readFileAPI(t, server, `{"path":"/log.txt"}`); ce != nil || data != "0123456789" {
+		t.Errorf("Expected full content, got %q %+v", data, ce)
+	}
+	if data, ce := readFileAPI(t, server, `{"path":"/log.txt","offset":"3","length":5}`); ce != nil || data != "34567" {
+		t.Errorf("Expected range 3-7, got %q %+v", data, ce)
+	}
+	if _, ce := readFileAPI(t, server, `{"path":"/missing"}`); ce == nil || ce.Code != "not_found" {
+		t.Errorf("Expected not_found, got %+v", ce)
+	}
+	if _, ce := readFileAPI(t, server, `{"path":"/log.txt","offset":"20"}`); ce == nil || ce.Code != "out_of_range" {
+		t.Errorf("Expected out_of_range, got %+v", ce)
+	}
+}
+
+func TestFileAPIWrite(t *testing.T) {
+	root := t.TempDir()
+	writeTestFile(t, filepath.Join(root, "out", "old.txt"), "old")
+
+	server := newFileAPITestServer(t, root, false)
+	var ce connectError
+	if code := callFileAPI(t, server, "Write", `{"path":"/out/new.txt","data":"aGk="}`, &ce); code != http.StatusForbidden {
+		t.Errorf("Expected writes to be disabled by default, got %d", code)
+	}
+
+	server = newFileAPITestServer(t, root, true)
+	var info fileAPIInfo
+	if code := callFileAPI(t, server, "Write", `{"path":"/out/new.txt","data":"aGk="}`, &info); code != http.StatusOK || info.Size != 2 {
+		t.Fatalf("Expected write to succeed, got %d %+v", code, info)
+	}
+	if data, _ := os.ReadFile(filepath.Join(root, "out", "new.txt")); string(data) != "hi" {
+		t.Errorf("Expected written content, got %q", data)
+	}
+	if code := callFileAPI(t, server, "Write", `{"path":"/out/old.txt","data":"aGk=","createOnly":true}`, &ce); code != http.StatusConflict {
+		t.Errorf("Expected already_exists, got %d", code)
+	}
+	if code := callFileAPI(t, server, "Write", `{"path":"/out/.env","data":"aGk="}`, &ce); code != http.StatusForbidden {
+		t.Errorf("Expected hidden names to be rejected, got %d", code)
+	}
+	if code := callFileAPI(t, server, "Write", `{"path":"/missing/x.txt","data":"aGk="}`, &ce); code != http.StatusNotFound {
+		t.Errorf("Expected missing parent to be rejected, got %d", code)
+	}
+}
+
+func TestFileAPIWriteKeepsVersions(t *testing.T) {
+	root := t.TempDir()
+	writeTestFile(t, filepath.Join(root, "out", "app.txt"), "good")
+	server := newListingTestServer(t, root, func(c *Config) {
+		c.FileAPI = &FileAPIConfig{Enabled: true, AllowWrite: true}
+		c.Features.Versioning = &VersioningConfig{Enabled: true, Keep: 2, Dir: t.TempDir()}
+	})
+
+	var info fileAPIInfo
+	if code := callFileAPI(t, server, "Write", `{"path":"/out/app.txt","data":"aGk="}`, &info); code != http.StatusOK {
+		t.Fatalf("Expected write to succeed, got %d", code)
+	}
+	versions, _ := server.versions.List("/out/app.txt")
+	if len(versions) != 1 || versions[0].Size != int64(len("good")) {
+		t.Errorf("Expected the overwritten content to be kept as a version, got %+v", versions)
+	}
+}
+
+func TestFileAPIWriteEnforcesQuotas(t *testing.T) {
+	root := t.TempDir()
+	writeTestFile(t, filepath.Join(root, "out", "a.txt"), "12345678")
+	server := newListingTestServer(t, root, func(c *Config) {
+		c.FileAPI = &FileAPIConfig{Enabled: true, AllowWrite: true}
+		c.Features.Quotas = []QuotaRule{{Prefix: "/out/", MaxBytes: 10}}
+	})
+
+	var ce connectError
+	if code := callFileAPI(t, server, "Write", `{"path":"/out/b.txt","data":"aGVsbG8="}`, &ce); code != http.StatusTooManyRequests || ce.Code != "resource_exhausted" {
+		t.Errorf("Expected resource_exhausted over the quota, got %d %+v", code, ce)
+	}
+	if _, err := os.Stat(filepath.Join(root, "out", "b.txt")); err == nil {
+		t.Error("Expected the rejected write not to be stored")
+	}
+	var info fileAPIInfo
+	if code := callFileAPI(t, server, "Write", `{"path":"/out/a.txt","data":"aGk="}`, &info); code != http.StatusOK {
+		t.Errorf("Expected a smaller overwrite to fit the quota, got %d", code)
+	}
+}
+
+func TestFileAPIAppliesProxyACL(t *testing.T) {
+	root := t.TempDir()
+	writeTestFile(t, filepath.Join(root, "private", "secret.txt"), "secret")
+	server := newListingTestServer(t, root, func(c *Config) {
+		c.FileAPI = &FileAPIConfig{Enabled: true, AllowWrite: true}
+		c.Security.ProxyAuth = &ProxyAuthConfig{
+			Enabled:        true,
+			TrustedProxies: []string{"192.0.2.1"},
+			ACL:            []ProxyACLRule{{Path: "/private/**", Groups: []string{"admins"}}},
+		}
+	})
+
+	// The route is the same for every file: the ACL applies to the requested path
+	var ce connectError
+	if code := callFileAPI(t, server, "Stat", `{"path":"/private/secret.txt"}`, &ce); code != http.StatusUnauthorized || ce.Code != "unauthenticated" {
+		t.Errorf("Expected unauthenticated for Stat, got %d %+v", code, ce)
+	}
+	if code := callFileAPI(t, server, "Write", `{"path":"/private/secret.txt","data":"aGk="}`, &ce); code != http.StatusUnauthorized {
+		t.Errorf("Expected unauthenticated for Write, got %d", code)
+	}
+	if data, _ := os.ReadFile(filepath.Join(root, "private", "secret.txt")); string(data) != "secret" {
+		t.Errorf("Expected the file to be untouched, got %q", data)
+	}
+}
@@ -0,0 +1,416 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// fileWebhookAttempts tentativas de entrega (com espera crescente entre elas)
+const fileWebhookAttempts = 3
+
+// FileEvent corpo enviado aos webhooks quando um arquivo aparece
+type FileEvent struct {
+	Event   string    `json:"event"` // file.created
+	Hook    string    `json:"hook"`
+	Path    string    `json:"path"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+	SHA256  string    `json:"sha256,omitempty"`
+}
+
+// fileDelivery entrega pendente de um evento a um webhook
+type fileDelivery struct {
+	hook  *FileWebhookConfig
+	event FileEvent
+}
+
+// pendingFile arquivo novo aguardando ficar estável (sem escritas por settle)
+type pendingFile struct {
+	size    int64
+	changed time.Time
+}
+
+// FileWebhooks observa a raiz e chama os webhooks configurados quando um
+// arquivo novo que casa com os globs aparece. O aviso só sai depois que o
+// arquivo para de crescer, para não anunciar uploads pela metade.
+type FileWebhooks struct {
+	config *FileWebhooksConfig
+	logger *Logger
+	index  *RootIndex // hashes já calculados, quando ativo
+	client *http.Client
+	queue  chan fileDelivery
+	sleep  func(time.Duration) // espera entre tentativas (substituível nos testes)
+	settle time.Duration       // tempo sem mudanças antes do aviso
+	start  sync.Once
+
+	mu        sync.Mutex
+	watcher   *fsnotify.Watcher
+	root      string
+	delivered map[string]int64
+	failed    map[string]int64
+}
+
+// NewFileWebhooks valida os webhooks; as entregas começam com Watch
+func NewFileWebhooks(config *FileWebhooksConfig, logger *Logger) (*FileWebhooks, error) {
+	if len(config.Hooks) == 0 {
+		return nil, errors.New("file_webhooks requires at least one hook")
+	}
+	if config.Settle < 0 {
+		return nil, fmt.Errorf("invalid file_webhooks settle: %d", config.Settle)
+	}
+	names := make(map[string]bool)
+	for _, hook := range config.Hooks {
+		if hook.Name == "" || names[hook.Name] {
+			return nil, fmt.Errorf("file webhook names must be unique and non-empty (%q)", hook.Name)
+		}
+		names[hook.Name] = true
+		if u, err := url.Parse(hook.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("invalid URL for file webhook %s: %q", hook.Name, hook.URL)
+		}
+		if len(hook.Paths) == 0 {
+			return nil, fmt.Errorf("file webhook %s has no paths", hook.Name)
+		}
+		for _, pattern := range hook.Paths {
+			if !strings.HasPrefix(pattern, "/") {
+				return nil, fmt.Errorf("invalid file webhook path %q (must start with /)", pattern)
+			}
+		}
+	}
+
+	f := &FileWebhooks{
+		config:    config,
+		logger:    logger,
+		client:    &http.Client{Timeout: 10 * time.Second},
+		queue:     make(chan fileDelivery, 1000),
+		sleep:     time.Sleep,
+		settle:    2 * time.Second,
+		delivered: make(map[string]int64),
+		failed:    make(map[string]int64),
+	}
+	if config.Settle > 0 {
+		f.settle = time.Duration(config.Settle) * time.Second
+	}
+	return f, nil
+}
+
+// bases diretórios observados: a parte fixa de cada glob
+func (f *FileWebhooks) bases() []string {
+	var bases []string
+	for _, hook := range f.config.Hooks {
+		for _, pattern := range hook.Paths {
+			bases = append(bases, globBase(pattern))
+		}
+	}
+	sort.Strings(bases)
+	return bases
+}
+
+// fileWebhookIgnored nomes nunca anunciados: ocultos, como os temporários
+// (.arquivo.part, .qserv-*) renomeados ao final da escrita
+func fileWebhookIgnored(name string) bool {
+	return strings.HasPrefix(name, ".")
+}
+
+// Watch passa a observar root (na inicialização e em trocas de raiz)
+func (f *FileWebhooks) Watch(root string) error {
+	f.start.Do(func() { go f.deliver() })
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	if f.watcher != nil {
+		f.watcher.Close()
+	}
+	f.watcher, f.root = watcher, root
+	f.mu.Unlock()
+
+	for _, base := range f.bases() {
+		dir := filepath.Join(root, filepath.FromSlash(base))
+		if !isWithin(root, dir) {
+			continue
+		}
+		// Os diretórios base podem ainda não existir: observa o mais próximo
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			dir = existingParent(dir)
+		}
+		f.watchTree(watcher, dir)
+	}
+	go f.watch(watcher, root)
+	return nil
+}
+
+// Stop encerra a observação
+func (f *FileWebhooks) Stop() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.watcher != nil {
+		f.watcher.Close()
+		f.watcher = nil
+	}
+}
+
+// watchTree observa dir e seus subdiretórios; retorna os arquivos que já
+// existem nos subdiretórios (criados antes da observação começar)
+func (f *FileWebhooks) watchTree(watcher *fsnotify.Watcher, dir string) []string {
+	var files []string
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			if path != dir && (d.Name() == ".git" || fileWebhookIgnored(d.Name())) {
+				return filepath.SkipDir
+			}
+			if err := watcher.Add(path); err != nil {
+				f.logger.Debug("File webhooks: cannot watch %s: %v", path, err)
+			}
+			return nil
+		}
+		if d.Type().IsRegular() {
+			files = append(files, path)
+		}
+		return nil
+	})
+	return files
+}
+
+// watch recebe os eventos do sistema de arquivos até o watcher ser fechado
+func (f *FileWebhooks) watch(watcher *fsnotify.Watcher, root string) {
+	pending := make(map[string]*pendingFile)
+	track := func(path string) {
+		if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() {
+			pending[path] = &pendingFile{size: info.Size(), changed: time.Now()}
+		}
+	}
+	tick := time.NewTicker(f.settle / 4)
+	defer tick.Stop()
+
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			if fileWebhookIgnored(filepath.Base(event.Name)) {
+				continue
+			}
+			switch {
+			case event.Has(fsnotify.Create):
+				info, err := os.Stat(event.Name)
+				if err != nil {
+					continue
+				}
+				if info.IsDir() {
+					// Diretório novo (ou movido para dentro): seus arquivos também são novos
+					for _, path := range f.watchTree(watcher, event.Name) {
+						track(path)
+					}
+					continue
+				}
+				track(event.Name)
+			case event.Has(fsnotify.Write):
+				if p, ok := pending[event.Name]; ok {
+					p.changed = time.Now()
+				}
+			case event.Has(fsnotify.Remove), event.Has(fsnotify.Rename):
+				delete(pending, event.Name)
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			f.logger.Warn("File webhooks watcher: %v", err)
+		case <-tick.C:
+			for path, p := range pending {
+				if time.Since(p.changed) < f.settle {
+					continue
+				}
+				info, err := os.Stat(path)
+				if err != nil {
+					delete(pending, path)
+					continue
+				}
+				if info.Size() != p.size {
+					p.size, p.changed = info.Size(), time.Now()
+					continue
+				}
+				delete(pending, path)
+				f.notify(root, path, info)
+			}
+		}
+	}
+}
+
+// SwapRoot observa a nova raiz e anuncia os arquivos que não existiam na anterior
+func (f *FileWebhooks) SwapRoot(previous, current string) {
+	if err := f.Watch(current); err != nil {
+		f.logger.Error("File webhooks: cannot watch %s: %v", current, err)
+		return
+	}
+	for _, base := range f.bases() {
+		dir := filepath.Join(current, filepath.FromSlash(base))
+		if !isWithin(current, dir) {
+			continue
+		}
+		filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return nil
+			}
+			if fileWebhookIgnored(d.Name()) || d.Name() == ".git" {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if !d.Type().IsRegular() {
+				return nil
+			}
+			rel, err := relPath(current, path)
+			if err != nil {
+				return nil
+			}
+			if _, err := os.Stat(filepath.Join(previous, filepath.FromSlash(rel))); err == nil {
+				return nil
+			}
+			if info, err := d.Info(); err == nil {
+				f.notify(current, path, info)
+			}
+			return nil
+		})
+	}
+}
+
+// notify enfileira o evento para cada webhook cujo glob casa com o arquivo
+func (f *FileWebhooks) notify(root, path string, info os.FileInfo) {
+	rel, err := relPath(root, path)
+	if err != nil {
+		return
+	}
+	urlPath := "/" + rel
+
+	var sum string
+	for i := range f.config.Hooks {
+		hook := &f.config.Hooks[i]
+		matched := false
+		for _, pattern := range hook.Paths {
+			if matchGlob(pattern, urlPath) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			continue
+		}
+		if hook.Hash && sum == "" {
+			if sum, err = f.index.Sum(path, info); err != nil {
+				f.logger.Error("File webhooks: hashing %s: %v", path, err)
+			}
+		}
+		event := FileEvent{Event: "file.created", Hook: hook.Name, Path: urlPath, Size: info.Size(), ModTime: info.ModTime()}
+		if hook.Hash {
+			event.SHA256 = sum
+		}
+		select {
+		case f.queue <- fileDelivery{hook: hook, event: event}:
+		default:
+			f.logger.Warn("File webhooks: queue full, dropping %s for %s", urlPath, hook.Name)
+			f.count(f.failed, hook.Name)
+		}
+	}
+}
+
+// deliver envia os eventos da fila, um de cada vez, na ordem em que aparecem
+func (f *FileWebhooks) deliver() {
+	for d := range f.queue {
+		var err error
+		for attempt := 0; attempt < fileWebhookAttempts; attempt++ {
+			if attempt > 0 {
+				f.sleep(time.Duration(1<<(2*attempt)) * time.Second)
+			}
+			if err = f.post(d); err == nil {
+				break
+			}
+		}
+		if err != nil {
+			f.logger.Error("File webhook %s failed for %s: %v", d.hook.Name, d.event.Path, err)
+			f.count(f.failed, d.hook.Name)
+			continue
+		}
+		f.logger.Debug("File webhook %s notified: %s", d.hook.Name, d.event.Path)
+		f.count(f.delivered, d.hook.Name)
+	}
+}
+
+// post envia um evento; o corpo é assinado com HMAC-SHA256 quando há secret
+func (f *FileWebhooks) post(d fileDelivery) error {
+	body, err := json.Marshal(d.event)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, d.hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "qserv")
+	req.Header.Set("X-Qserv-Event", d.event.Event)
+	for key, value := range d.hook.Headers {
+		req.Header.Set(key, value)
+	}
+	if d.hook.Secret != "" {
+		mac := hmac.New(sha256.New, []byte(d.hook.Secret))
+		mac.Write(body)
+		req.Header.Set("X-Qserv-Signature-256", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return err
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// count incrementa o contador do webhook
+func (f *FileWebhooks) count(counter map[string]int64, hook string) {
+	f.mu.Lock()
+	counter[hook]++
+	f.mu.Unlock()
+}
+
+// WriteMetrics exporta as entregas por webhook
+func (f *FileWebhooks) WriteMetrics(w io.Writer) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var delivered, failed []metricSample
+	for _, hook := range f.config.Hooks {
+		labels := map[string]string{"hook": hook.Name}
+		delivered = append(delivered, metricSample{labels: labels, value: float64(f.delivered[hook.Name])})
+		failed = append(failed, metricSample{labels: labels, value: float64(f.failed[hook.Name])})
+	}
+	writeMetric(w, "qserv_file_webhook_deliveries_total", "File webhook events delivered.", "counter", delivered)
+	writeMetric(w, "qserv_file_webhook_failures_total", "File webhook events dropped after retries.", "counter", failed)
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// newFileWebhookReceiver records the events posted to it
+func newFileWebhookReceiver(t *testing.T, status func() int) (*httptest.Server, chan FileEvent) {
+	t.Helper()
+	events := make(chan FileEvent, 10)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		code := status()
+		w.WriteHeader(code)
+		if code != http.StatusOK {
+			return
+		}
+		mac := hmac.New(sha256.New, []byte("s3cret"))
+		mac.Write(body)
+		if r.Header.Get("X-Qserv-Signature-256") != "sha256="+hex.EncodeToString(mac.Sum(nil)) {
+			t.Errorf("Invalid signature %q", r.Header.Get("X-Qserv-Signature-256"))
+		}
+		var event FileEvent
+		json.Unmarshal(body, &event)
+		events <- event
+	}))
+	t.Cleanup(receiver.Close)
+	return receiver, events
+}
+
+func newTestFileWebhooks(t *testing.T, url string) *FileWebhooks {
+	t.Helper()
+	logger, _ := NewLogger(&LoggingConfig{Enabled: false})
+	hooks, err := NewFileWebhooks(&FileWebhooksConfig{Enabled: true, Hooks: []FileWebhookConfig{
+		{Name: "ci", URL: url, Paths: []string{"/releases/**"}, Secret: "s3cret", Hash: true},
+	}}, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hooks.settle = 50 * time.Millisecond
+	hooks.sleep = func(time.Duration) {}
+	t.Cleanup(hooks.Stop)
+	return hooks
+}
+
+func waitFileEvent(t *testing.T, events chan FileEvent) FileEvent {
+	t.Helper()
+	select {
+	case event := <-events:
+		return event
+	case <-time.After(3 * time.Second):
+		t.Fatal("Timed out waiting for webhook")
+		return FileEvent{}
+	}
+}
+
+func TestFileWebhookOnNewFile(t *testing.T) {
+	receiver, events := newFileWebhookReceiver(t, func() int { return http.StatusOK })
+	root := t.TempDir()
+	os.MkdirAll(filepath.Join(root, "releases"), 0755)
+	hooks := newTestFileWebhooks(t, receiver.URL)
+	if err := hooks.Watch(root); err != nil {
+		t.Fatal(err)
+	}
+
+	// Ignored: outside the globs and hidden temporary files
+	writeTestFile(t, filepath.Join(root, "other.txt"), "x")
+	writeTestFile(t, filepath.Join(root, "releases", ".app.part"), "x")
+	// A new subdirectory is watched as well
+	writeTestFile(t, filepath.Join(root, "releases", "v2", "app.tar.gz"), "payload")
+
+	event := waitFileEvent(t, events)
+	sum := sha256.Sum256([]byte("payload"))
+	if event.Event != "file.created" || event.Hook != "ci" || event.Path != "/releases/v2/app.tar.gz" ||
+		event.Size != 7 || event.SHA256 != hex.EncodeToString(sum[:]) {
+		t.Errorf("Unexpected event %+v", event)
+	}
+	select {
+	case event := <-events:
+		t.Errorf("Expected a single event, got %+v", event)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestFileWebhookRetries(t *testing.T) {
+	calls := 0
+	receiver, events := newFileWebhookReceiver(t, func() int {
+		if calls++; calls < 3 {
+			return http.StatusBadGateway
+		}
+		return http.StatusOK
+	})
+	root := t.TempDir()
+	hooks := newTestFileWebhooks(t, receiver.URL)
+	hooks.Watch(root)
+
+	writeTestFile(t, filepath.Join(root, "releases", "a.bin"), "a")
+	if event := waitFileEvent(t, events); event.Path != "/releases/a.bin" {
+		t.Errorf("Unexpected event %+v", event)
+	}
+	if calls != 3 {
+		t.Errorf("Expected 3 attempts, got %d", calls)
+	}
+}
+
+func TestFileWebhookRootSwap(t *testing.T) {
+	receiver, events := newFileWebhookReceiver(t, func() int { return http.StatusOK })
+	previous, current := t.TempDir(), t.TempDir()
+	writeTestFile(t, filepath.Join(previous, "releases", "old.bin"), "old")
+	writeTestFile(t, filepath.Join(current, "releases", "old.bin"), "old")
+	writeTestFile(t, filepath.Join(current, "releases", "new.bin"), "new")
+	hooks := newTestFileWebhooks(t, receiver.URL)
+	hooks.Watch(previous)
+
+	// Only files missing from the previous root are announced
+	hooks.SwapRoot(previous, current)
+	if event := waitFileEvent(t, events); event.Path != "/releases/new.bin" {
+		t.Errorf("Expected new.bin, got %+v", event)
+	}
+	select {
+	case event := <-events:
+		t.Errorf("Expected a single event, got %+v", event)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestNewFileWebhooksValidation(t *testing.T) {
+	tests := []FileWebhooksConfig{
+		{},
+		{Hooks: []FileWebhookConfig{{Name: "a", URL: "ftp://x", Paths: []string{"/x"}}}},
+		{Hooks: []FileWebhookConfig{{Name: "a", URL: "http://x", Paths: []string{"x/**"}}}},
+		{Hooks: []FileWebhookConfig{{Name: "a", URL: "http://x"}}},
+		{Hooks: []FileWebhookConfig{{Name: "a", URL: "http://x", Paths: []string{"/x"}}, {Name: "a", URL: "http://y", Paths: []string{"/y"}}}},
+	}
+	for i, config := range tests {
+		if _, err := NewFileWebhooks(&config, nil); err == nil {
+			t.Errorf("Case %d: Expected validation error", i)
+		}
+	}
+}
@@ -0,0 +1,829 @@
+package main
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ftpMaxLine tamanho máximo de um comando de controle
+const ftpMaxLine = 4096
+
+// ftpReadOnly comandos de escrita, sempre recusados
+var ftpReadOnly = map[string]bool{
+	"STOR": true, "STOU": true, "APPE": true, "DELE": true, "MKD": true, "XMKD": true,
+	"RMD": true, "XRMD": true, "RNFR": true, "RNTO": true, "SITE": true,
+}
+
+// ftpBeforeLogin comandos aceitos antes do login
+var ftpBeforeLogin = map[string]bool{
+	"USER": true, "PASS": true, "AUTH": true, "PBSZ": true, "PROT": true,
+	"FEAT": true, "SYST": true, "OPTS": true, "NOOP": true, "QUIT": true,
+}
+
+// FTPServer listener FTP(S) somente leitura: mesma raiz, mesmas regras de
+// visibilidade e o mesmo usuário/senha do basic auth (sem basic auth, o
+// acesso é anônimo)
+type FTPServer struct {
+	config   *FTPConfig
+	security *SecurityConfig // da inicialização; em uso vale a da configuração ativa
+	logger   *Logger
+	server   *Server
+	tls      *tls.Config // nil: sem AUTH TLS
+
+	pasvMin, pasvMax int
+	nextPort         atomic.Int64
+
+	mu       sync.Mutex
+	listener net.Listener
+
+	clients   atomic.Int64
+	rejected  atomic.Int64
+	downloads atomic.Int64
+	sent      atomic.Int64
+}
+
+// NewFTPServer valida a configuração e prepara o listener
+func NewFTPServer(config *FTPConfig, security *SecurityConfig, logger *Logger) (*FTPServer, error) {
+	f := &FTPServer{config: config, security: security, logger: logger}
+	if rule := ftpUnsupportedRule(security); rule != "" {
+		return nil, fmt.Errorf("ftp: cannot be enabled with %s (FTP clients carry no proxy identity or cookies)", rule)
+	}
+
+	if config.PassivePorts != "" {
+		from, to, _ := strings.Cut(config.PassivePorts, "-")
+		lo, err1 := strconv.Atoi(strings.TrimSpace(from))
+		hi, err2 := strconv.Atoi(strings.TrimSpace(to))
+		if err1 != nil || err2 != nil || lo <= 0 || hi > 65535 || lo > hi {
+			return nil, fmt.Errorf("ftp: invalid passive_ports %q (expected e.g. 50000-50100)", config.PassivePorts)
+		}
+		f.pasvMin, f.pasvMax = lo, hi
+	}
+	if config.PublicIP != "" {
+		if ip := net.ParseIP(config.PublicIP); ip == nil || ip.To4() == nil {
+			return nil, fmt.Errorf("ftp: public_ip must be an IPv4 address, got %q", config.PublicIP)
+		}
+	}
+	if config.RequireTLS && !config.TLS {
+		return nil, errors.New("ftp: require_tls needs tls")
+	}
+	if config.TLS {
+		if security.CertFile == "" || security.KeyFile == "" {
+			return nil, errors.New("ftp: tls needs security.cert_file and security.key_file")
+		}
+		cert, err := tls.LoadX509KeyPair(security.CertFile, security.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("ftp: %w", err)
+		}
+		f.tls = &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	}
+	return f, nil
+}
+
+// currentSecurity retorna a segurança da configuração ativa, para que
+// credenciais e listas de IPs recarregadas valham também no FTP
+func (f *FTPServer) currentSecurity() *SecurityConfig {
+	if f.server == nil {
+		return f.security
+	}
+	return &f.server.activeConfig().Security
+}
+
+// address retorna o endereço de escuta
+func (f *FTPServer) address() string {
+	if f.config.Address == "" {
+		return ":2121"
+	}
+	return f.config.Address
+}
+
+// maxClients retorna o máximo de sessões simultâneas
+func (f *FTPServer) maxClients() int64 {
+	if f.config.MaxClients <= 0 {
+		return 20
+	}
+	return int64(f.config.MaxClients)
+}
+
+// idleTimeout retorna quanto tempo uma sessão pode ficar sem comandos
+func (f *FTPServer) idleTimeout() time.Duration {
+	if f.config.IdleTimeout <= 0 {
+		return 5 * time.Minute
+	}
+	return time.Duration(f.config.IdleTimeout) * time.Second
+}
+
+// Listen abre o socket de controle
+func (f *FTPServer) Listen() (net.Listener, error) {
+	l, err := net.Listen("tcp", f.address())
+	if err != nil {
+		return nil, fmt.Errorf("ftp: %w", err)
+	}
+	f.mu.Lock()
+	f.listener = l
+	f.mu.Unlock()
+	return l, nil
+}
+
+// Serve aceita sessões até o listener ser fechado
+func (f *FTPServer) Serve(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return fmt.Errorf("ftp: %w", err)
+		}
+		go f.serveConn(conn)
+	}
+}
+
+// Close fecha o socket de controle (sessões abertas terminam sozinhas)
+func (f *FTPServer) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.listener == nil {
+		return nil
+	}
+	return f.listener.Close()
+}
+
+// allowedIP aplica ip_whitelist e ip_blacklist, como o IPFilterMiddleware
+func (f *FTPServer) allowedIP(ip string) bool {
+	security := f.currentSecurity()
+	for _, blocked := range security.IPBlacklist {
+		if ip == blocked {
+			return false
+		}
+	}
+	if len(security.IPWhitelist) == 0 {
+		return true
+	}
+	for _, allowed := range security.IPWhitelist {
+		if ip == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// ftpUnsupportedRule retorna a regra de acesso do HTTP que o FTP não tem
+// como aplicar, ou "": sem ela o FTP daria acesso ao que o HTTP protege
+func ftpUnsupportedRule(security *SecurityConfig) string {
+	if pa := security.ProxyAuth; pa != nil && pa.Enabled {
+		return "security.proxy_auth"
+	}
+	if sc := security.SignedCookies; sc != nil && sc.Enabled {
+		return "security.signed_cookies"
+	}
+	return ""
+}
+
+// allowedClient aplica ao endereço da conexão de controle as restrições de
+// clientes do HTTP: rede local no modo lan_share e tailnet
+func (f *FTPServer) allowedClient(remoteAddr string) bool {
+	if f.server == nil {
+		return true
+	}
+	config := f.server.activeConfig()
+	ip, _, _ := net.SplitHostPort(remoteAddr)
+	if config.Server.LANShare && len(config.Security.IPWhitelist) == 0 && !privateClient(ip) {
+		return false
+	}
+	return f.server.tailnet == nil || f.server.tailnet.allowedPeer(remoteAddr, nil)
+}
+
+// ftpConn estado de uma sessão de controle
+type ftpConn struct {
+	ftp      *FTPServer
+	conn     net.Conn
+	reader   *bufio.Reader
+	writer   *bufio.Writer
+	remoteIP string
+
+	user     string
+	loggedIn bool
+	secure   bool // canal de controle sob TLS
+	protect  bool // PROT P: dados sob TLS
+	cwd      string
+	rest     int64
+
+	pasv   net.Listener // PASV/EPSV pendente
+	active string       // PORT/EPRT pendente
+}
+
+// serveConn atende uma sessão até QUIT, erro ou inatividade
+func (f *FTPServer) serveConn(conn net.Conn) {
+	defer conn.Close()
+	ip, _, _ := net.SplitHostPort(conn.RemoteAddr().String())
+	c := &ftpConn{
+		ftp:      f,
+		conn:     conn,
+		reader:   bufio.NewReader(conn),
+		writer:   bufio.NewWriter(conn),
+		remoteIP: ip,
+		cwd:      "/",
+	}
+	defer c.closeData()
+
+	if !f.allowedIP(ip) || !f.allowedClient(conn.RemoteAddr().String()) {
+		f.rejected.Add(1)
+		c.reply(421, "Access denied")
+		return
+	}
+	// Regras que o FTP não aplica podem chegar por recarga da configuração
+	if rule := ftpUnsupportedRule(f.currentSecurity()); rule != "" {
+		f.rejected.Add(1)
+		f.logger.Warn("FTP %s: refused, %s is enabled", ip, rule)
+		c.reply(421, "Service not available")
+		return
+	}
+	if f.clients.Add(1) > f.maxClients() {
+		f.clients.Add(-1)
+		f.rejected.Add(1)
+		c.reply(421, "Too many connections, try again later")
+		return
+	}
+	defer f.clients.Add(-1)
+
+	c.reply(220, "qserv FTP ready (read-only)")
+	for {
+		conn.SetReadDeadline(time.Now().Add(f.idleTimeout()))
+		line, err := c.readLine()
+		if err != nil {
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				c.reply(421, "Idle timeout, closing connection")
+			}
+			return
+		}
+		cmd, arg, _ := strings.Cut(line, " ")
+		cmd = strings.ToUpper(cmd)
+		if cmd == "PASS" {
+			f.logger.Debug("FTP %s: PASS ***", ip)
+		} else {
+			f.logger.Debug("FTP %s: %s", ip, line)
+		}
+		if !c.handle(cmd, arg) {
+			return
+		}
+	}
+}
+
+// readLine lê um comando sem o CRLF, recusando linhas longas demais
+func (c *ftpConn) readLine() (string, error) {
+	var line []byte
+	for {
+		chunk, err := c.reader.ReadSlice('\n')
+		line = append(line, chunk...)
+		if len(line) > ftpMaxLine {
+			return "", errors.New("command line too long")
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimRight(string(line), "\r\n"), nil
+	}
+}
+
+// reply envia uma resposta de uma linha
+func (c *ftpConn) reply(code int, msg string) {
+	fmt.Fprintf(c.writer, "%d %s\r\n", code, msg)
+	c.writer.Flush()
+}
+
+// handle executa um comando; retorna false para encerrar a sessão
+func (c *ftpConn) handle(cmd, arg string) bool {
+	if !c.loggedIn && !ftpBeforeLogin[cmd] {
+		c.reply(530, "Please login with USER and PASS")
+		return true
+	}
+	if ftpReadOnly[cmd] {
+		c.reply(550, "Permission denied (read-only server)")
+		return true
+	}
+
+	switch cmd {
+	case "USER":
+		if c.ftp.config.RequireTLS && !c.secure {
+			c.reply(530, "TLS required, use AUTH TLS first")
+			return true
+		}
+		c.user, c.loggedIn = arg, false
+		c.reply(331, "Password required")
+	case "PASS":
+		if c.user == "" {
+			c.reply(503, "Login with USER first")
+			return true
+		}
+		if !c.checkLogin(c.user, arg) {
+			c.ftp.logger.Warn("FTP %s: login failed for %q", c.remoteIP, c.user)
+			// Atrasa a resposta para dificultar força bruta
+			time.Sleep(time.Second)
+			c.reply(530, "Login incorrect")
+			return true
+		}
+		c.loggedIn = true
+		c.ftp.logger.Info("FTP %s: logged in as %q", c.remoteIP, c.user)
+		c.reply(230, "Login successful")
+	case "AUTH":
+		if c.ftp.tls == nil {
+			c.reply(502, "TLS not available")
+			return true
+		}
+		if mode := strings.ToUpper(arg); mode != "TLS" && mode != "TLS-C" && mode != "SSL" {
+			c.reply(504, "Unsupported security mechanism")
+			return true
+		}
+		if c.secure {
+			c.reply(503, "Already using TLS")
+			return true
+		}
+		c.reply(234, "Proceed with TLS negotiation")
+		tlsConn := tls.Server(c.conn, c.ftp.tls)
+		if err := tlsConn.Handshake(); err != nil {
+			c.ftp.logger.Debug("FTP %s: TLS handshake failed: %v", c.remoteIP, err)
+			return false
+		}
+		c.conn, c.secure = tlsConn, true
+		c.reader, c.writer = bufio.NewReader(tlsConn), bufio.NewWriter(tlsConn)
+	case "PBSZ":
+		if !c.secure {
+			c.reply(503, "PBSZ requires AUTH TLS")
+			return true
+		}
+		c.reply(200, "PBSZ=0")
+	case "PROT":
+		switch {
+		case !c.secure:
+			c.reply(503, "PROT requires AUTH TLS")
+		case strings.EqualFold(arg, "P"):
+			c.protect = true
+			c.reply(200, "Protection level set to Private")
+		case strings.EqualFold(arg, "C"):
+			if c.ftp.config.RequireTLS {
+				c.reply(536, "Clear data connections are not allowed")
+				return true
+			}
+			c.protect = false
+			c.reply(200, "Protection level set to Clear")
+		default:
+			c.reply(504, "Unsupported protection level")
+		}
+	case "SYST":
+		c.reply(215, "UNIX Type: L8")
+	case "FEAT":
+		features := []string{"UTF8", "EPSV", "EPRT", "PASV", "SIZE", "MDTM", "REST STREAM", "MLST type*;size*;modify*;"}
+		if c.ftp.tls != nil {
+			features = append(features, "AUTH TLS", "PBSZ", "PROT")
+		}
+		fmt.Fprintf(c.writer, "211-Features:\r\n")
+		for _, feature := range features {
+			fmt.Fprintf(c.writer, " %s\r\n", feature)
+		}
+		c.reply(211, "End")
+	case "OPTS":
+		if strings.EqualFold(arg, "UTF8 ON") {
+			c.reply(200, "UTF8 mode enabled")
+			return true
+		}
+		c.reply(501, "Option not supported")
+	case "NOOP":
+		c.reply(200, "OK")
+	case "QUIT":
+		c.reply(221, "Goodbye")
+		return false
+	case "PWD", "XPWD":
+		c.reply(257, `"`+strings.ReplaceAll(c.cwd, `"`, `""`)+`" is the current directory`)
+	case "CWD", "XCWD":
+		c.changeDir(arg)
+	case "CDUP", "XCUP":
+		c.changeDir("..")
+	case "TYPE":
+		switch strings.ToUpper(strings.Fields(arg + " ")[0]) {
+		case "A", "I", "L":
+			c.reply(200, "Type set to "+arg)
+		default:
+			c.reply(504, "Unsupported type")
+		}
+	case "MODE":
+		if strings.EqualFold(arg, "S") {
+			c.reply(200, "Mode set to S")
+			return true
+		}
+		c.reply(504, "Only stream mode is supported")
+	case "STRU":
+		if strings.EqualFold(arg, "F") {
+			c.reply(200, "Structure set to F")
+			return true
+		}
+		c.reply(504, "Only file structure is supported")
+	case "PASV":
+		c.passive(false)
+	case "EPSV":
+		if strings.EqualFold(arg, "ALL") {
+			c.reply(200, "EPSV ALL ok")
+			return true
+		}
+		c.passive(true)
+	case "PORT", "EPRT":
+		c.activeMode(cmd, arg)
+	case "REST":
+		offset, err := strconv.ParseInt(arg, 10, 64)
+		if err != nil || offset < 0 {
+			c.reply(501, "Invalid offset")
+			return true
+		}
+		c.rest = offset
+		c.reply(350, fmt.Sprintf("Restarting at %d", offset))
+	case "LIST", "NLST", "MLSD":
+		c.list(cmd, arg)
+	case "MLST":
+		c.mlst(arg)
+	case "SIZE":
+		_, _, info, err := c.lookup(arg)
+		if err != nil || info.IsDir() {
+			c.reply(550, "File not found")
+			return true
+		}
+		c.reply(213, strconv.FormatInt(info.Size(), 10))
+	case "MDTM":
+		_, _, info, err := c.lookup(arg)
+		if err != nil || info.IsDir() {
+			c.reply(550, "File not found")
+			return true
+		}
+		c.reply(213, info.ModTime().UTC().Format("20060102150405"))
+	case "RETR":
+		c.retrieve(arg)
+	case "ABOR":
+		c.closeData()
+		c.reply(226, "No transfer in progress")
+	default:
+		c.reply(502, "Command not implemented")
+	}
+	return true
+}
+
+// checkLogin confere usuário e senha com o basic auth; sem basic auth,
+// qualquer login (inclusive anonymous) é aceito
+func (c *ftpConn) checkLogin(user, pass string) bool {
+	auth := c.ftp.currentSecurity().BasicAuth
+	if auth == nil || !auth.Enabled {
+		return true
+	}
+	userMatch := subtle.ConstantTimeCompare([]byte(user), []byte(auth.Username)) == 1
+	passMatch := subtle.ConstantTimeCompare([]byte(pass), []byte(auth.Password)) == 1
+	return userMatch && passMatch
+}
+
+// abs converte o argumento (relativo ao diretório atual ou absoluto) em
+// caminho virtual limpo, sempre começando por /
+func (c *ftpConn) abs(arg string) string {
+	if !strings.HasPrefix(arg, "/") {
+		arg = c.cwd + "/" + arg
+	}
+	return cleanURLPath(arg)
+}
+
+// lookup resolve o caminho com as mesmas regras de visibilidade do HTTP,
+// mais as janelas de horário
+func (c *ftpConn) lookup(arg string) (vpath, path string, info os.FileInfo, err error) {
+	vpath = c.abs(arg)
+	path, info, err = c.ftp.server.resolveVisible(c.ftp.server.RootDir(), vpath)
+	if err != nil {
+		return vpath, path, nil, err
+	}
+	if tws := c.ftp.server.timeWindows(); tws != nil && tws.Check(vpath) != 0 {
+		return vpath, path, nil, fs.ErrPermission
+	}
+	return vpath, path, info, nil
+}
+
+// changeDir troca o diretório atual
+func (c *ftpConn) changeDir(arg string) {
+	vpath, _, info, err := c.lookup(arg)
+	if err != nil || !info.IsDir() {
+		c.reply(550, "Directory not found")
+		return
+	}
+	c.cwd = vpath
+	c.reply(250, "Directory changed to "+vpath)
+}
+
+// passive abre o socket de dados (PASV ou EPSV) numa porta da faixa
+func (c *ftpConn) passive(extended bool) {
+	c.closeData()
+	host, _, _ := net.SplitHostPort(c.conn.LocalAddr().String())
+	l, err := c.ftp.listenPassive(host)
+	if err != nil {
+		c.ftp.logger.Error("FTP: cannot open passive port: %v", err)
+		c.reply(425, "Cannot open passive connection")
+		return
+	}
+	port := l.Addr().(*net.TCPAddr).Port
+	if extended {
+		c.pasv = l
+		c.reply(229, fmt.Sprintf("Entering Extended Passive Mode (|||%d|)", port))
+		return
+	}
+
+	ip := net.ParseIP(host).To4()
+	if c.ftp.config.PublicIP != "" {
+		ip = net.ParseIP(c.ftp.config.PublicIP).To4()
+	}
+	if ip == nil {
+		l.Close()
+		c.reply(425, "PASV needs IPv4, use EPSV")
+		return
+	}
+	c.pasv = l
+	c.reply(227, fmt.Sprintf("Entering Passive Mode (%d,%d,%d,%d,%d,%d)", ip[0], ip[1], ip[2], ip[3], port>>8, port&0xff))
+}
+
+// listenPassive escuta na próxima porta livre de passive_ports (ou em
+// qualquer porta, sem faixa configurada)
+func (f *FTPServer) listenPassive(host string) (net.Listener, error) {
+	if f.pasvMin == 0 {
+		return net.Listen("tcp", net.JoinHostPort(host, "0"))
+	}
+	span := f.pasvMax - f.pasvMin + 1
+	start := int(f.nextPort.Add(1))
+	var err error
+	for i := 0; i < span; i++ {
+		port := f.pasvMin + (start+i)%span
+		var l net.Listener
+		if l, err = net.Listen("tcp", net.JoinHostPort(host, strconv.Itoa(port))); err == nil {
+			return l, nil
+		}
+	}
+	return nil, fmt.Errorf("no free port in %s: %w", f.config.PassivePorts, err)
+}
+
+// activeMode registra o endereço de PORT/EPRT; só o IP do próprio cliente
+// é aceito (evita o uso do servidor para varrer outras máquinas)
+func (c *ftpConn) activeMode(cmd, arg string) {
+	c.closeData()
+	var host, port string
+	if cmd == "PORT" {
+		parts := strings.Split(arg, ",")
+		if len(parts) != 6 {
+			c.reply(501, "Invalid PORT argument")
+			return
+		}
+		hi, err1 := strconv.Atoi(parts[4])
+		lo, err2 := strconv.Atoi(parts[5])
+		if err1 != nil || err2 != nil || hi < 0 || hi > 255 || lo < 0 || lo > 255 {
+			c.reply(501, "Invalid PORT argument")
+			return
+		}
+		host, port = strings.Join(parts[:4], "."), strconv.Itoa(hi<<8|lo)
+	} else {
+		// EPRT |proto|host|port|
+		if len(arg) < 2 {
+			c.reply(501, "Invalid EPRT argument")
+			return
+		}
+		fields := strings.Split(arg[1:], arg[:1])
+		if len(fields) < 3 {
+			c.reply(501, "Invalid EPRT argument")
+			return
+		}
+		host, port = fields[1], fields[2]
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil || !ip.Equal(net.ParseIP(c.remoteIP)) {
+		c.reply(500, "Data connections are only allowed to the client address")
+		return
+	}
+	if n, err := strconv.Atoi(port); err != nil || n < 1024 || n > 65535 {
+		c.reply(501, "Invalid port")
+		return
+	}
+	c.active = net.JoinHostPort(host, port)
+	c.reply(200, cmd+" command successful")
+}
+
+// openData estabelece a conexão de dados pendente (sob TLS com PROT P)
+func (c *ftpConn) openData() (net.Conn, error) {
+	var conn net.Conn
+	switch {
+	case c.pasv != nil:
+		l := c.pasv
+		c.pasv = nil
+		defer l.Close()
+		if tl, ok := l.(*net.TCPListener); ok {
+			tl.SetDeadline(time.Now().Add(30 * time.Second))
+		}
+		accepted, err := l.Accept()
+		if err != nil {
+			return nil, err
+		}
+		// Só o próprio cliente pode usar a porta passiva
+		ip, _, _ := net.SplitHostPort(accepted.RemoteAddr().String())
+		if !net.ParseIP(ip).Equal(net.ParseIP(c.remoteIP)) {
+			accepted.Close()
+			return nil, fmt.Errorf("data connection from %s does not match %s", ip, c.remoteIP)
+		}
+		conn = accepted
+	case c.active != "":
+		addr := c.active
+		c.active = ""
+		dialed, err := net.DialTimeout("tcp", addr, 30*time.Second)
+		if err != nil {
+			return nil, err
+		}
+		conn = dialed
+	default:
+		return nil, errors.New("use PASV or PORT first")
+	}
+
+	if c.protect {
+		tlsConn := tls.Server(conn, c.ftp.tls)
+		if err := tlsConn.Handshake(); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		conn = tlsConn
+	}
+	return conn, nil
+}
+
+// closeData descarta a conexão de dados pendente
+func (c *ftpConn) closeData() {
+	if c.pasv != nil {
+		c.pasv.Close()
+		c.pasv = nil
+	}
+	c.active = ""
+}
+
+// transfer abre a conexão de dados, envia o conteúdo e responde o
+// resultado; retorna se a transferência foi concluída
+func (c *ftpConn) transfer(what string, send func(w io.Writer) error) bool {
+	c.reply(150, "Opening data connection for "+what)
+	conn, err := c.openData()
+	if err != nil {
+		c.ftp.logger.Debug("FTP %s: data connection failed: %v", c.remoteIP, err)
+		c.reply(425, "Cannot open data connection")
+		return false
+	}
+	w := bufio.NewWriterSize(conn, 64<<10)
+	err = send(w)
+	if err == nil {
+		err = w.Flush()
+	}
+	conn.Close()
+	if err != nil {
+		c.reply(426, "Connection closed, transfer aborted")
+		return false
+	}
+	c.reply(226, "Transfer complete")
+	return true
+}
+
+// list responde LIST (formato ls -l), NLST (só nomes) e MLSD (RFC 3659)
+func (c *ftpConn) list(cmd, arg string) {
+	// Clientes antigos mandam opções do ls (LIST -la)
+	var target string
+	for _, field := range strings.Fields(arg) {
+		if !strings.HasPrefix(field, "-") {
+			target = field
+			break
+		}
+	}
+	_, path, info, err := c.lookup(target)
+	if err != nil {
+		c.reply(550, "Directory not found")
+		return
+	}
+	var infos []os.FileInfo
+	if info.IsDir() {
+		if infos, err = c.ftp.server.visibleEntries(c.ftp.server.RootDir(), path); err != nil {
+			c.reply(550, "Cannot read directory")
+			return
+		}
+	} else if cmd == "MLSD" {
+		c.reply(501, "Not a directory")
+		return
+	} else {
+		infos = []os.FileInfo{info}
+	}
+
+	now := time.Now()
+	c.transfer("directory listing", func(w io.Writer) error {
+		for _, entry := range infos {
+			var err error
+			switch cmd {
+			case "NLST":
+				_, err = fmt.Fprintf(w, "%s\r\n", entry.Name())
+			case "MLSD":
+				_, err = fmt.Fprintf(w, "%s %s\r\n", mlstFacts(entry), entry.Name())
+			default:
+				_, err = fmt.Fprintf(w, "%s\r\n", lsLine(entry, now))
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// mlst responde os fatos de um único item pelo canal de controle
+func (c *ftpConn) mlst(arg string) {
+	vpath, _, info, err := c.lookup(arg)
+	if err != nil {
+		c.reply(550, "File not found")
+		return
+	}
+	fmt.Fprintf(c.writer, "250-Listing %s\r\n %s %s\r\n", vpath, mlstFacts(info), vpath)
+	c.reply(250, "End")
+}
+
+// retrieve envia um arquivo, a partir do offset de REST
+func (c *ftpConn) retrieve(arg string) {
+	offset := c.rest
+	c.rest = 0
+	vpath, path, info, err := c.lookup(arg)
+	if err != nil || info.IsDir() {
+		c.reply(550, "File not found")
+		return
+	}
+	if offset > info.Size() {
+		c.reply(554, "Restart offset beyond end of file")
+		return
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		c.reply(550, "Cannot open file")
+		return
+	}
+	defer f.Close()
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		c.reply(550, "Cannot seek file")
+		return
+	}
+
+	start := time.Now()
+	done := c.transfer(fmt.Sprintf("%s (%d bytes)", info.Name(), info.Size()-offset), func(w io.Writer) error {
+		n, err := io.Copy(w, f)
+		c.ftp.sent.Add(n)
+		return err
+	})
+	if !done {
+		return
+	}
+	c.ftp.downloads.Add(1)
+	c.ftp.logger.Info("FTP %s: RETR %s (%s, %v)", c.remoteIP, vpath, formatSize(info.Size()-offset), time.Since(start).Round(time.Millisecond))
+}
+
+// lsLine linha no formato do ls -l, que os clientes antigos sabem interpretar
+func lsLine(info os.FileInfo, now time.Time) string {
+	mode := "-r--r--r--"
+	if info.IsDir() {
+		mode = "dr-xr-xr-x"
+	}
+	date := info.ModTime().Format("Jan _2 15:04")
+	if age := now.Sub(info.ModTime()); age > 180*24*time.Hour || age < -time.Hour {
+		date = info.ModTime().Format("Jan _2  2006")
+	}
+	return fmt.Sprintf("%s 1 ftp ftp %12d %s %s", mode, info.Size(), date, info.Name())
+}
+
+// mlstFacts fatos de MLSD/MLST (tipo, tamanho e mtime em UTC)
+func mlstFacts(info os.FileInfo) string {
+	modify := info.ModTime().UTC().Format("20060102150405")
+	if info.IsDir() {
+		return "type=dir;modify=" + modify + ";"
+	}
+	return fmt.Sprintf("type=file;size=%d;modify=%s;", info.Size(), modify)
+}
+
+// WriteMetrics exporta sessões e transferências do FTP
+func (f *FTPServer) WriteMetrics(w io.Writer) {
+	writeMetric(w, "qserv_ftp_sessions", "Open FTP sessions.", "gauge",
+		[]metricSample{{value: float64(f.clients.Load())}})
+	writeMetric(w, "qserv_ftp_rejected_total", "FTP connections rejected by IP filter or max_clients.", "counter",
+		[]metricSample{{value: float64(f.rejected.Load())}})
+	writeMetric(w, "qserv_ftp_downloads_total", "Files retrieved over FTP.", "counter",
+		[]metricSample{{value: float64(f.downloads.Load())}})
+	writeMetric(w, "qserv_ftp_sent_bytes_total", "Bytes sent over FTP data connections.", "counter",
+		[]metricSample{{value: float64(f.sent.Load())}})
+}
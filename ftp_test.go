@@ -0,0 +1,225 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// startTestFTP serves root over FTP on a loopback port and returns its address
+func startTestFTP(t *testing.T, root string, configure func(*Config)) string {
+	t.Helper()
+	server := newListingTestServer(t, root, func(c *Config) {
+		c.FTP = &FTPConfig{Enabled: true, Address: "127.0.0.1:0"}
+		if configure != nil {
+			configure(c)
+		}
+	})
+	if server.ftp == nil {
+		t.Fatal("Expected FTP listener to be enabled")
+	}
+	l, err := server.ftp.Listen()
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.ftp.Serve(l)
+	t.Cleanup(func() { server.ftp.Close() })
+	return l.Addr().String()
+}
+
+// dialTestFTP connects and checks the greeting
+func dialTestFTP(t *testing.T, addr string) *textproto.Conn {
+	t.Helper()
+	conn, err := textproto.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	if _, _, err := conn.ReadResponse(220); err != nil {
+		t.Fatalf("Expected greeting, got %v", err)
+	}
+	return conn
+}
+
+// ftpCmd sends a command and expects the given reply code
+func ftpCmd(t *testing.T, conn *textproto.Conn, code int, format string, args ...any) string {
+	t.Helper()
+	id, err := conn.Cmd(format, args...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.StartResponse(id)
+	defer conn.EndResponse(id)
+	got, msg, err := conn.ReadResponse(code)
+	if err != nil {
+		t.Fatalf("%s: expected %d, got %d %s", fmt.Sprintf(format, args...), code, got, msg)
+	}
+	return msg
+}
+
+// ftpRead runs a data command over EPSV and returns what was transferred
+func ftpRead(t *testing.T, conn *textproto.Conn, addr string, format string, args ...any) string {
+	t.Helper()
+	msg := ftpCmd(t, conn, 229, "EPSV")
+	var port int
+	fmt.Sscanf(msg[strings.Index(msg, "|||"):], "|||%d|", &port)
+	host, _, _ := net.SplitHostPort(addr)
+	data, err := net.Dial("tcp", net.JoinHostPort(host, fmt.Sprint(port)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ftpCmd(t, conn, 150, format, args...)
+	body, _ := io.ReadAll(data)
+	data.Close()
+	if _, _, err := conn.ReadResponse(226); err != nil {
+		t.Fatalf("Expected transfer complete, got %v", err)
+	}
+	return string(body)
+}
+
+func TestFTPListAndRetrieve(t *testing.T) {
+	root := t.TempDir()
+	writeTestFile(t, filepath.Join(root, "pub", "readme.txt"), "hello ftp")
+	writeTestFile(t, filepath.Join(root, ".secret"), "hidden")
+	addr := startTestFTP(t, root, nil)
+	conn := dialTestFTP(t, addr)
+
+	ftpCmd(t, conn, 530, "PWD")
+	ftpCmd(t, conn, 331, "USER anonymous")
+	ftpCmd(t, conn, 230, "PASS guest@")
+	if msg := ftpCmd(t, conn, 257, "PWD"); !strings.HasPrefix(msg, `"/"`) {
+		t.Errorf("Expected root as current directory, got %q", msg)
+	}
+
+	listing := ftpRead(t, conn, addr, "LIST")
+	if !strings.Contains(listing, "pub") || strings.Contains(listing, ".secret") {
+		t.Errorf("Expected only visible entries, got %q", listing)
+	}
+
+	ftpCmd(t, conn, 250, "CWD pub")
+	if names := ftpRead(t, conn, addr, "NLST"); names != "readme.txt\r\n" {
+		t.Errorf("Expected readme.txt, got %q", names)
+	}
+	if facts := ftpRead(t, conn, addr, "MLSD"); !strings.Contains(facts, "type=file;size=9;") {
+		t.Errorf("Expected MLSD facts, got %q", facts)
+	}
+	ftpCmd(t, conn, 213, "SIZE readme.txt")
+	if body := ftpRead(t, conn, addr, "RETR /pub/readme.txt"); body != "hello ftp" {
+		t.Errorf("Expected file content, got %q", body)
+	}
+
+	ftpCmd(t, conn, 350, "REST 6")
+	if body := ftpRead(t, conn, addr, "RETR readme.txt"); body != "ftp" {
+		t.Errorf("Expected content from offset 6, got %q", body)
+	}
+
+	// Hidden files and escapes above the root are not reachable
+	ftpCmd(t, conn, 550, "SIZE /.secret")
+	ftpCmd(t, conn, 250, "CWD ../../..")
+	if msg := ftpCmd(t, conn, 257, "PWD"); !strings.HasPrefix(msg, `"/"`) {
+		t.Errorf("Expected to stay at the root, got %q", msg)
+	}
+	ftpCmd(t, conn, 221, "QUIT")
+}
+
+func TestFTPReadOnly(t *testing.T) {
+	root := t.TempDir()
+	writeTestFile(t, filepath.Join(root, "a.txt"), "a")
+	addr := startTestFTP(t, root, nil)
+	conn := dialTestFTP(t, addr)
+	ftpCmd(t, conn, 331, "USER anonymous")
+	ftpCmd(t, conn, 230, "PASS x")
+
+	for _, cmd := range []string{"STOR b.txt", "DELE a.txt", "MKD new", "RNFR a.txt"} {
+		ftpCmd(t, conn, 550, "%s", cmd)
+	}
+}
+
+func TestFTPBasicAuth(t *testing.T) {
+	root := t.TempDir()
+	addr := startTestFTP(t, root, func(c *Config) {
+		c.Security.BasicAuth = &BasicAuthConfig{Enabled: true, Username: "admin", Password: "s3cret"}
+	})
+	conn := dialTestFTP(t, addr)
+
+	ftpCmd(t, conn, 331, "USER admin")
+	ftpCmd(t, conn, 530, "PASS wrong")
+	ftpCmd(t, conn, 530, "PWD")
+	ftpCmd(t, conn, 331, "USER admin")
+	ftpCmd(t, conn, 230, "PASS s3cret")
+	ftpCmd(t, conn, 257, "PWD")
+}
+
+func TestFTPActiveModeOnlyToClient(t *testing.T) {
+	root := t.TempDir()
+	addr := startTestFTP(t, root, nil)
+	conn := dialTestFTP(t, addr)
+	ftpCmd(t, conn, 331, "USER anonymous")
+	ftpCmd(t, conn, 230, "PASS x")
+
+	ftpCmd(t, conn, 500, "PORT 10,0,0,1,200,10")
+	ftpCmd(t, conn, 200, "EPRT |1|127.0.0.1|51210|")
+}
+
+func TestNewFTPServerValidation(t *testing.T) {
+	security := &SecurityConfig{}
+	tests := []*FTPConfig{
+		{Enabled: true, PassivePorts: "50100-50000"},
+		{Enabled: true, PassivePorts: "abc"},
+		{Enabled: true, PublicIP: "::1"},
+		{Enabled: true, RequireTLS: true},
+		{Enabled: true, TLS: true},
+	}
+	for _, config := range tests {
+		if _, err := NewFTPServer(config, security, nil); err == nil {
+			t.Errorf("Expected error for %+v", config)
+		}
+	}
+	if _, err := NewFTPServer(&FTPConfig{Enabled: true, PassivePorts: "50000-50100"}, security, nil); err != nil {
+		t.Errorf("Expected valid config, got %v", err)
+	}
+
+	// FTP has no proxy identity or cookies to apply these rules to
+	for _, security := range []*SecurityConfig{
+		{ProxyAuth: &ProxyAuthConfig{Enabled: true, ACL: []ProxyACLRule{{Path: "/private/**", Groups: []string{"admins"}}}}},
+		{SignedCookies: &SignedCookiesConfig{Enabled: true, Secret: "s3cret", Paths: []string{"/hls/**"}}},
+	} {
+		if _, err := NewFTPServer(&FTPConfig{Enabled: true}, security, nil); err == nil {
+			t.Errorf("Expected error with %+v", security)
+		}
+	}
+}
+
+func TestFTPClientRestrictions(t *testing.T) {
+	server := newListingTestServer(t, t.TempDir(), func(c *Config) {
+		c.Server.Host = "127.0.0.1"
+		c.Server.LANShare = true
+		c.FTP = &FTPConfig{Enabled: true, Address: "127.0.0.1:0"}
+	})
+	for addr, want := range map[string]bool{
+		"127.0.0.1:40000":   true,
+		"192.168.1.20:4000": true,
+		"203.0.113.5:4000":  false,
+	} {
+		if got := server.ftp.allowedClient(addr); got != want {
+			t.Errorf("LAN share: Expected %v for %s, got %v", want, addr, got)
+		}
+	}
+
+	// Tailnet mode: only tailnet peers (and allowed users)
+	server.config.Server.LANShare = false
+	server.tailnet = newTestTailnet(t, &TailscaleConfig{Enabled: true, AllowedUsers: []string{"*@example.com"}})
+	for addr, want := range map[string]bool{
+		"100.101.102.103:41000": true,
+		"100.101.102.104:41000": false,
+		"192.168.1.20:4000":     false,
+	} {
+		if got := server.ftp.allowedClient(addr); got != want {
+			t.Errorf("Tailnet: Expected %v for %s, got %v", want, addr, got)
+		}
+	}
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// GitSyncer mantém o diretório raiz sincronizado com um repositório git.
+// Cada commit é extraído em um snapshot próprio, que passa a ser servido
+// através de uma troca atômica de raiz.
+type GitSyncer struct {
+	config *GitSourceConfig
+	server *Server
+
+	mu        sync.Mutex
+	commit    string
+	lastSync  time.Time
+	lastError string
+	syncCount int
+}
+
+// GitStatus estado da sincronização
+type GitStatus struct {
+	Repository string    `json:"repository"`
+	Ref        string    `json:"ref"`
+	Commit     string    `json:"commit,omitempty"`
+	RootDir    string    `json:"root_dir"`
+	LastSync   time.Time `json:"last_sync,omitempty"`
+	LastError  string    `json:"last_error,omitempty"`
+	Syncs      int       `json:"syncs"`
+	Changed    bool      `json:"changed"`
+}
+
+// gitCommandTimeout tempo máximo de cada comando git
+const gitCommandTimeout = 5 * time.Minute
+
+// NewGitSyncer cria um novo sincronizador
+func NewGitSyncer(config *GitSourceConfig, server *Server) *GitSyncer {
+	return &GitSyncer{config: config, server: server}
+}
+
+// ref retorna a branch/tag configurada
+func (g *GitSyncer) ref() string {
+	if g.config.Ref == "" {
+		return "main"
+	}
+	return g.config.Ref
+}
+
+// workDir retorna o diretório de trabalho
+func (g *GitSyncer) workDir() string {
+	if g.config.WorkDir == "" {
+		return ".qserv-git"
+	}
+	return g.config.WorkDir
+}
+
+// Start executa a primeira sincronização; o polling é o job git-sync
+func (g *GitSyncer) Start() {
+	if _, err := g.Sync(); err != nil {
+		g.server.logger.Error("Initial git sync failed, serving %s: %v", g.server.RootDir(), err)
+	}
+}
+
+// Sync busca o ref configurado e, se houver um novo commit, publica um snapshot
+func (g *GitSyncer) Sync() (GitStatus, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	changed, err := g.sync()
+	if err != nil {
+		g.lastError = err.Error()
+	} else {
+		g.lastError = ""
+		g.lastSync = time.Now()
+		g.syncCount++
+	}
+
+	status := g.status()
+	status.Changed = changed
+	return status, err
+}
+
+// sync implementa Sync (g.mu deve estar travado)
+func (g *GitSyncer) sync() (bool, error) {
+	repoDir := filepath.Join(g.workDir(), "repo.git")
+	if _, err := os.Stat(repoDir); os.IsNotExist(err) {
+		if err := os.MkdirAll(g.workDir(), 0755); err != nil {
+			return false, err
+		}
+		if _, err := g.git("init", "--bare", "--quiet", repoDir); err != nil {
+			return false, err
+		}
+	}
+
+	if _, err := g.git("--git-dir", repoDir, "fetch", "--quiet", "--depth=1", "--force", g.config.Repository, g.ref()); err != nil {
+		return false, err
+	}
+
+	out, err := g.git("--git-dir", repoDir, "rev-parse", "FETCH_HEAD^{commit}")
+	if err != nil {
+		return false, err
+	}
+	commit := strings.TrimSpace(out)
+
+	if commit == g.commit {
+		return false, nil
+	}
+
+	snapshotDir, err := g.extract(repoDir, commit)
+	if err != nil {
+		return false, err
+	}
+
+	previous, _, err := g.server.SwapRoot(snapshotDir)
+	if err != nil {
+		return false, err
+	}
+
+	g.server.logger.Info("Git sync: %s @ %s", g.ref(), shortCommit(commit))
+	g.commit = commit
+
+	go func() {
+		<-previous.drained
+		g.server.pruneSnapshots(filepath.Join(g.workDir(), "snapshots"), g.config.KeepSnapshots)
+	}()
+
+	return true, nil
+}
+
+// extract extrai o commit em um novo diretório de snapshot
+func (g *GitSyncer) extract(repoDir, commit string) (string, error) {
+	snapshotsDir := filepath.Join(g.workDir(), "snapshots")
+	target := filepath.Join(snapshotsDir, commit)
+
+	// Snapshot já extraído anteriormente (ex: após reinício)
+	if info, err := os.Stat(target); err == nil && info.IsDir() {
+		return target, nil
+	}
+
+	tmp, err := os.MkdirTemp(snapshotsDir, ".tmp-")
+	if os.IsNotExist(err) {
+		if err = os.MkdirAll(snapshotsDir, 0755); err == nil {
+			tmp, err = os.MkdirTemp(snapshotsDir, ".tmp-")
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+
+	treeish := commit
+	if subdir := strings.Trim(g.config.Subdir, "/"); subdir != "" {
+		treeish = commit + ":" + subdir
+	}
+
+	cmd, cancel := g.command("--git-dir", repoDir, "archive", "--format=tar", treeish)
+	defer cancel()
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		os.RemoveAll(tmp)
+		return "", err
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	if err := cmd.Start(); err != nil {
+		os.RemoveAll(tmp)
+		return "", err
+	}
+
+	extractErr := extractTar(stdout, tmp)
+	io.Copy(io.Discard, stdout)
+	if err := cmd.Wait(); err != nil {
+		os.RemoveAll(tmp)
+		return "", fmt.Errorf("git archive: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	if extractErr != nil {
+		os.RemoveAll(tmp)
+		return "", extractErr
+	}
+
+	if err := os.Rename(tmp, target); err != nil {
+		os.RemoveAll(tmp)
+		return "", err
+	}
+
+	return target, nil
+}
+
+// status retorna o estado atual (g.mu deve estar travado)
+func (g *GitSyncer) status() GitStatus {
+	return GitStatus{
+		Repository: redactURL(g.config.Repository),
+		Ref:        g.ref(),
+		Commit:     g.commit,
+		RootDir:    g.server.RootDir(),
+		LastSync:   g.lastSync,
+		LastError:  g.lastError,
+		Syncs:      g.syncCount,
+	}
+}
+
+// Status retorna o estado atual da sincronização
+func (g *GitSyncer) Status() GitStatus {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.status()
+}
+
+// command prepara um comando git sem prompts interativos
+func (g *GitSyncer) command(args ...string) (*exec.Cmd, context.CancelFunc) {
+	ctx, cancel := context.WithTimeout(context.Background(), gitCommandTimeout)
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	return cmd, cancel
+}
+
+// git executa um comando git e retorna a saída padrão
+func (g *GitSyncer) git(args ...string) (string, error) {
+	cmd, cancel := g.command(args...)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("git %s: %v: %s", args[0], err, redactURL(strings.TrimSpace(stderr.String())))
+	}
+	return stdout.String(), nil
+}
+
+// handleAdminGitStatus informa o estado da sincronização
+func (g *GitSyncer) handleAdminGitStatus(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, g.Status())
+}
+
+// handleAdminGitSync dispara uma sincronização (ex: a partir de um webhook)
+func (g *GitSyncer) handleAdminGitSync(w http.ResponseWriter, r *http.Request) {
+	status, err := g.Sync()
+	if err != nil {
+		writeJSON(w, http.StatusBadGateway, status)
+		return
+	}
+	writeJSON(w, http.StatusOK, status)
+}
+
+// redactURL remove credenciais de URLs presentes no texto
+func redactURL(text string) string {
+	for _, scheme := range []string{"https://", "http://"} {
+		start := 0
+		for {
+			i := strings.Index(text[start:], scheme)
+			if i < 0 {
+				break
+			}
+			i += start + len(scheme)
+			end := strings.IndexAny(text[i:], "/ \n")
+			if end < 0 {
+				end = len(text) - i
+			}
+			if at := strings.LastIndex(text[i:i+end], "@"); at >= 0 {
+				text = text[:i] + "***" + text[i+at:]
+			}
+			start = i
+		}
+	}
+	return text
+}
+
+// shortCommit abrevia o hash do commit
+func shortCommit(commit string) string {
+	if len(commit) > 12 {
+		return commit[:12]
+	}
+	return commit
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// globCache padrões já compilados
+var globCache sync.Map // map[string]*regexp.Regexp
+
+// compileGlob converte um glob de caminho em expressão regular:
+// "**" casa qualquer sequência (inclusive "/"), "*" casa dentro de um
+// segmento e "?" casa um único caractere que não seja "/"
+func compileGlob(pattern string) *regexp.Regexp {
+	if re, ok := globCache.Load(pattern); ok {
+		return re.(*regexp.Regexp)
+	}
+
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; c {
+		case '*':
+			if i+1 < len(pattern) && pattern[i+1] == '*' {
+				b.WriteString(".*")
+				i++
+			} else {
+				b.WriteString("[^/]*")
+			}
+		case '?':
+			b.WriteString("[^/]")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+
+	re := regexp.MustCompile(b.String())
+	globCache.Store(pattern, re)
+	return re
+}
+
+// matchGlob verifica se o caminho casa com o glob
+func matchGlob(pattern, path string) bool {
+	return compileGlob(pattern).MatchString(path)
+}
@@ -1,3 +1,10 @@
 module qserv
 
 go 1.24.7
+
+require (
+	github.com/fsnotify/fsnotify v1.9.0
+	golang.org/x/text v0.21.0
+)
+
+require golang.org/x/sys v0.13.0 // indirect
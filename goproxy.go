@@ -0,0 +1,357 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// goProxyModule caminho de módulo já escapado (maiúsculas viram !minúscula)
+	goProxyModule = regexp.MustCompile(`^[a-z0-9\-_~!][a-z0-9.\-_~!]*(?:/[a-z0-9\-_~!][a-z0-9.\-_~!]*)*$`)
+	// goProxyVersion versão escapada (v1.2.3, v0.0.0-2024...-abcdef, v2.0.0+incompatible)
+	goProxyVersion = regexp.MustCompile(`^v[0-9][0-9a-z.\-+!]*$`)
+)
+
+// GoProxy espelho de módulos Go no protocolo GOPROXY (<módulo>/@v/list,
+// <versão>.info, .mod, .zip e <módulo>/@latest) sobre um diretório no
+// formato de $GOMODCACHE/cache/download
+type GoProxy struct {
+	config *GoProxyConfig
+	root   func() string // raiz servida, para dir relativo
+}
+
+// NewGoProxy cria o espelho de módulos
+func NewGoProxy(config *GoProxyConfig) (*GoProxy, error) {
+	if config.Dir == "" {
+		return nil, errors.New("go_proxy: dir is required")
+	}
+	if !strings.HasPrefix(config.prefix(), "/") {
+		return nil, errors.New("go_proxy: prefix must start with /")
+	}
+	return &GoProxy{config: config}, nil
+}
+
+// prefix retorna o prefixo da URL (default: /go/)
+func (c *GoProxyConfig) prefix() string {
+	if c.Prefix == "" {
+		return "/go/"
+	}
+	return strings.TrimSuffix(c.Prefix, "/") + "/"
+}
+
+// dir retorna o diretório dos módulos (relativo à raiz servida)
+func (p *GoProxy) dir() string {
+	if filepath.IsAbs(p.config.Dir) {
+		return p.config.Dir
+	}
+	return filepath.Join(p.root(), p.config.Dir)
+}
+
+// versions lista as versões do módulo presentes no cache (.info ou .mod),
+// em ordem semântica
+func (p *GoProxy) versions(module string) ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(p.dir(), filepath.FromSlash(module), "@v"))
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	var versions []string
+	for _, entry := range entries {
+		name := entry.Name()
+		ext := filepath.Ext(name)
+		if entry.IsDir() || (ext != ".info" && ext != ".mod") {
+			continue
+		}
+		version := strings.TrimSuffix(name, ext)
+		if goProxyVersion.MatchString(version) && !seen[version] {
+			seen[version] = true
+			versions = append(versions, unescapeModule(version))
+		}
+	}
+	sort.Slice(versions, func(i, j int) bool { return semverCompare(versions[i], versions[j]) < 0 })
+	return versions, nil
+}
+
+// unescapeModule desfaz o escape de maiúsculas do protocolo (!a -> A)
+func unescapeModule(s string) string {
+	var b strings.Builder
+	bang := false
+	for _, r := range s {
+		switch {
+		case r == '!':
+			bang = true
+			continue
+		case bang && r >= 'a' && r <= 'z':
+			r -= 'a' - 'A'
+		}
+		bang = false
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// escapeModule escapa maiúsculas (A -> !a), como nos nomes de arquivo do cache
+func escapeModule(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if r >= 'A' && r <= 'Z' {
+			b.WriteByte('!')
+			r += 'a' - 'A'
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// semverCompare compara versões semânticas (vMAJOR.MINOR.PATCH[-pre][+build]);
+// pré-lançamentos (e pseudo-versões) vêm antes do lançamento
+func semverCompare(a, b string) int {
+	splitVersion := func(v string) (nums []int, pre string) {
+		v, _, _ = strings.Cut(strings.TrimPrefix(v, "v"), "+")
+		v, pre, _ = strings.Cut(v, "-")
+		for _, part := range strings.Split(v, ".") {
+			n, _ := strconv.Atoi(part)
+			nums = append(nums, n)
+		}
+		return nums, pre
+	}
+	na, pa := splitVersion(a)
+	nb, pb := splitVersion(b)
+	for i := 0; i < 3; i++ {
+		var x, y int
+		if i < len(na) {
+			x = na[i]
+		}
+		if i < len(nb) {
+			y = nb[i]
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	switch {
+	case pa == pb:
+		return 0
+	case pa == "":
+		return 1
+	case pb == "":
+		return -1
+	}
+	return comparePrerelease(pa, pb)
+}
+
+// comparePrerelease compara identificadores de pré-lançamento (numéricos
+// antes de alfanuméricos)
+func comparePrerelease(a, b string) int {
+	pa, pb := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(pa) && i < len(pb); i++ {
+		x, errX := strconv.Atoi(pa[i])
+		y, errY := strconv.Atoi(pb[i])
+		switch {
+		case errX == nil && errY == nil:
+			if x != y {
+				if x < y {
+					return -1
+				}
+				return 1
+			}
+		case errX == nil:
+			return -1
+		case errY == nil:
+			return 1
+		case pa[i] != pb[i]:
+			if pa[i] < pb[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	switch {
+	case len(pa) < len(pb):
+		return -1
+	case len(pa) > len(pb):
+		return 1
+	}
+	return 0
+}
+
+// goProxyInfo corpo de .info e @latest
+type goProxyInfo struct {
+	Version string    `json:"Version"`
+	Time    time.Time `json:"Time"`
+}
+
+// handleGoProxy atende <prefixo><módulo>/@v/list, /@v/<versão>.info|.mod|.zip
+// e /@latest; respostas 404 em texto, como o comando go espera
+func (s *Server) handleGoProxy(w http.ResponseWriter, r *http.Request) {
+	debugNote(r, "serve", "goproxy")
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	rest := strings.TrimPrefix(r.URL.Path, s.goProxy.config.prefix())
+	if module, ok := strings.CutSuffix(rest, "/@latest"); ok {
+		s.goProxyLatest(w, r, module)
+		return
+	}
+	module, file, ok := strings.Cut(rest, "/@v/")
+	if !ok || !goProxyModule.MatchString(module) || strings.Contains(file, "/") {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if file == "list" {
+		s.goProxyList(w, r, module)
+		return
+	}
+
+	ext := filepath.Ext(file)
+	version := strings.TrimSuffix(file, ext)
+	if !goProxyVersion.MatchString(version) {
+		http.Error(w, "not found: invalid version", http.StatusNotFound)
+		return
+	}
+	path := filepath.Join(s.goProxy.dir(), filepath.FromSlash(module), "@v", file)
+	protected, ok := s.goProxyAccess(w, r, path)
+	if !ok {
+		return
+	}
+	switch ext {
+	case ".info":
+		w.Header().Set("Content-Type", "application/json")
+		if _, err := os.Stat(path); err != nil {
+			// Caches preenchidos só com go.mod: monta o .info a partir dele
+			s.goProxySynthInfo(w, r, module, version)
+			return
+		}
+	case ".mod":
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	case ".zip":
+		w.Header().Set("Content-Type", "application/zip")
+	default:
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		http.Error(w, "not found: "+unescapeModule(module)+"@"+unescapeModule(version), http.StatusNotFound)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil || !info.Mode().IsRegular() {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	// Versões publicadas não mudam, mas as protegidas por alguma regra não
+	// vão para caches compartilhados
+	if protected {
+		w.Header().Set("Cache-Control", "private")
+	} else {
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	}
+	http.ServeContent(w, r, "", info.ModTime(), f)
+}
+
+// goProxyAccess aplica ao caminho do cache a visibilidade e as regras por
+// caminho da rota de arquivos, respondendo a recusa; retorna se alguma regra
+// cobre o caminho
+func (s *Server) goProxyAccess(w http.ResponseWriter, r *http.Request, path string) (protected, ok bool) {
+	status, protected := s.fileAccess(r, s.RootDir(), path)
+	switch status {
+	case 0:
+		return protected, true
+	case http.StatusNotFound:
+		http.Error(w, "not found", http.StatusNotFound)
+	default:
+		resourceDenied(w, status)
+	}
+	return false, false
+}
+
+// goProxySynthInfo responde o .info de uma versão que só tem .mod no cache
+func (s *Server) goProxySynthInfo(w http.ResponseWriter, r *http.Request, module, version string) {
+	path := filepath.Join(s.goProxy.dir(), filepath.FromSlash(module), "@v", version+".mod")
+	if _, ok := s.goProxyAccess(w, r, path); !ok {
+		return
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		http.Error(w, "not found: "+unescapeModule(module)+"@"+unescapeModule(version), http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-cache")
+	json.NewEncoder(w).Encode(goProxyInfo{Version: unescapeModule(version), Time: info.ModTime().UTC()})
+}
+
+// goProxyList lista as versões disponíveis, uma por linha
+func (s *Server) goProxyList(w http.ResponseWriter, r *http.Request, module string) {
+	protected, ok := s.goProxyAccess(w, r, filepath.Join(s.goProxy.dir(), filepath.FromSlash(module), "@v"))
+	if !ok {
+		return
+	}
+	versions, err := s.goProxy.versions(module)
+	if err != nil && !os.IsNotExist(err) {
+		s.logger.Error("Go proxy: %s: %v", module, err)
+	}
+	if len(versions) == 0 {
+		http.Error(w, "not found: "+unescapeModule(module), http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if protected {
+		w.Header().Set("Cache-Control", "private, no-cache")
+	} else {
+		w.Header().Set("Cache-Control", "no-cache")
+	}
+	if r.Method == http.MethodHead {
+		return
+	}
+	w.Write([]byte(strings.Join(versions, "\n") + "\n"))
+}
+
+// goProxyLatest responde a versão mais recente (lançamentos antes de
+// pré-lançamentos e pseudo-versões)
+func (s *Server) goProxyLatest(w http.ResponseWriter, r *http.Request, module string) {
+	if !goProxyModule.MatchString(module) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if _, ok := s.goProxyAccess(w, r, filepath.Join(s.goProxy.dir(), filepath.FromSlash(module), "@v")); !ok {
+		return
+	}
+	versions, _ := s.goProxy.versions(module)
+	if len(versions) == 0 {
+		http.Error(w, "not found: "+unescapeModule(module), http.StatusNotFound)
+		return
+	}
+	latest := versions[len(versions)-1]
+	for i := len(versions) - 1; i >= 0; i-- {
+		if !strings.Contains(strings.SplitN(versions[i], "+", 2)[0], "-") {
+			latest = versions[i]
+			break
+		}
+	}
+
+	base := filepath.Join(s.goProxy.dir(), filepath.FromSlash(module), "@v", escapeModule(latest))
+	info := goProxyInfo{Version: latest}
+	if data, err := os.ReadFile(base + ".info"); err == nil {
+		json.Unmarshal(data, &info)
+	} else if stat, err := os.Stat(base + ".mod"); err == nil {
+		info.Time = stat.ModTime().UTC()
+	}
+	writeJSON(w, http.StatusOK, info)
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newGoProxyTestServer builds a module cache with github.com/Example/lib
+func newGoProxyTestServer(t *testing.T) *Server {
+	t.Helper()
+	root := t.TempDir()
+	dir := filepath.Join(root, "gomod", "github.com", "!example", "lib", "@v")
+	writeTestFile(t, filepath.Join(dir, "v1.0.0.info"), `{"Version":"v1.0.0","Time":"2024-01-02T03:04:05Z"}`)
+	writeTestFile(t, filepath.Join(dir, "v1.0.0.mod"), "module github.com/Example/lib\n")
+	writeTestFile(t, filepath.Join(dir, "v1.0.0.zip"), "zip-content")
+	writeTestFile(t, filepath.Join(dir, "v1.10.0.mod"), "module github.com/Example/lib\n")
+	writeTestFile(t, filepath.Join(dir, "v1.2.0.info"), `{"Version":"v1.2.0","Time":"2024-02-02T03:04:05Z"}`)
+	writeTestFile(t, filepath.Join(dir, "v2.0.0-rc.1.info"), `{"Version":"v2.0.0-rc.1","Time":"2024-03-02T03:04:05Z"}`)
+	writeTestFile(t, filepath.Join(dir, "v1.0.0.lock"), "")
+
+	return newListingTestServer(t, root, func(c *Config) {
+		c.GoProxy = &GoProxyConfig{Enabled: true, Dir: "gomod"}
+	})
+}
+
+func goProxyRequest(server *Server, path string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	server.mux.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+	return w
+}
+
+func TestGoProxyList(t *testing.T) {
+	server := newGoProxyTestServer(t)
+	w := goProxyRequest(server, "/go/github.com/!example/lib/@v/list")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", w.Code)
+	}
+	if got := w.Body.String(); got != "v1.0.0\nv1.2.0\nv1.10.0\nv2.0.0-rc.1\n" {
+		t.Errorf("Expected versions in semver order, got %q", got)
+	}
+	if w := goProxyRequest(server, "/go/github.com/!example/missing/@v/list"); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for unknown module, got %d", w.Code)
+	}
+}
+
+func TestGoProxyFiles(t *testing.T) {
+	server := newGoProxyTestServer(t)
+	base := "/go/github.com/!example/lib/@v/"
+
+	w := goProxyRequest(server, base+"v1.0.0.zip")
+	if w.Code != http.StatusOK || w.Body.String() != "zip-content" || w.Header().Get("Content-Type") != "application/zip" {
+		t.Errorf("Expected module zip, got %d %q", w.Code, w.Body.String())
+	}
+	if !strings.Contains(w.Header().Get("Cache-Control"), "immutable") {
+		t.Errorf("Expected immutable caching, got %q", w.Header().Get("Cache-Control"))
+	}
+	if w := goProxyRequest(server, base+"v1.0.0.mod"); w.Body.String() != "module github.com/Example/lib\n" {
+		t.Errorf("Expected go.mod, got %q", w.Body.String())
+	}
+
+	// .info synthesized from a go.mod-only download
+	var info goProxyInfo
+	w = goProxyRequest(server, base+"v1.10.0.info")
+	if err := json.Unmarshal(w.Body.Bytes(), &info); err != nil || info.Version != "v1.10.0" || info.Time.IsZero() {
+		t.Errorf("Expected synthesized info, got %d %q", w.Code, w.Body.String())
+	}
+
+	for _, path := range []string{
+		base + "v9.9.9.zip",
+		base + "v1.0.0.lock",
+		base + "v1.0.0.ziphash",
+		"/go/github.com/../etc/@v/v1.0.0.mod",
+		"/go/github.com/!example/lib/@v/..%2f..%2fv1.0.0.mod",
+		"/go/sumdb/sum.golang.org/supported",
+	} {
+		if w := goProxyRequest(server, path); w.Code == http.StatusOK {
+			t.Errorf("Expected %s to be rejected", path)
+		}
+	}
+}
+
+func TestGoProxyLatest(t *testing.T) {
+	server := newGoProxyTestServer(t)
+	var info goProxyInfo
+	w := goProxyRequest(server, "/go/github.com/!example/lib/@latest")
+	json.Unmarshal(w.Body.Bytes(), &info)
+	if info.Version != "v1.10.0" {
+		t.Errorf("Expected latest release v1.10.0, got %q", w.Body.String())
+	}
+}
+
+func TestSemverCompare(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"v1.2.3", "v1.2.3", 0},
+		{"v1.2.3", "v1.10.0", -1},
+		{"v2.0.0-rc.1", "v2.0.0", -1},
+		{"v2.0.0-rc.2", "v2.0.0-rc.10", -1},
+		{"v2.0.0-alpha", "v2.0.0-1", 1},
+		{"v0.0.0-20240102030405-abcdef123456", "v0.1.0", -1},
+		{"v2.0.0+incompatible", "v1.9.0", 1},
+	}
+	for _, tt := range tests {
+		if got := semverCompare(tt.a, tt.b); got != tt.want {
+			t.Errorf("semverCompare(%s, %s) = %d, expected %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+	if got := escapeModule("github.com/BurntSushi/toml"); got != "github.com/!burnt!sushi/toml" || unescapeModule(got) != "github.com/BurntSushi/toml" {
+		t.Errorf("Unexpected module escaping %q", got)
+	}
+}
+
+func TestGoProxyAppliesPathRules(t *testing.T) {
+	root := t.TempDir()
+	writeTestFile(t, filepath.Join(root, "gomod", "example.com", "public", "@v", "v1.0.0.mod"), "module example.com/public\n")
+	writeTestFile(t, filepath.Join(root, "gomod", "example.com", "internal", "@v", "v1.0.0.mod"), "module example.com/internal\n")
+	writeTestFile(t, filepath.Join(root, "gomod", "example.com", "internal", "@v", "v1.0.0.zip"), "zip-content")
+	server := newListingTestServer(t, root, func(c *Config) {
+		c.GoProxy = &GoProxyConfig{Enabled: true, Dir: "gomod"}
+		c.Security.ProxyAuth = &ProxyAuthConfig{
+			Enabled:        true,
+			TrustedProxies: []string{"192.0.2.1"},
+			ACL:            []ProxyACLRule{{Path: "/gomod/example.com/internal/**", Groups: []string{"admins"}}},
+		}
+	})
+	get := func(target string, groups string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", target, nil)
+		if groups != "" {
+			req.Header.Set("Remote-User", "alice")
+			req.Header.Set("Remote-Groups", groups)
+		}
+		w := httptest.NewRecorder()
+		server.mux.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := get("/go/example.com/public/@v/list", ""); w.Code != http.StatusOK {
+		t.Errorf("Expected public module to be listed, got %d", w.Code)
+	}
+	for _, path := range []string{"/go/example.com/internal/@v/list", "/go/example.com/internal/@latest", "/go/example.com/internal/@v/v1.0.0.zip", "/go/example.com/internal/@v/v1.0.0.info"} {
+		if w := get(path, ""); w.Code == http.StatusOK {
+			t.Errorf("Expected %s to be refused, got %d", path, w.Code)
+		}
+	}
+	w := get("/go/example.com/internal/@v/v1.0.0.zip", "admins")
+	if w.Code != http.StatusOK || w.Body.String() != "zip-content" {
+		t.Errorf("Expected admins to download, got %d %q", w.Code, w.Body.String())
+	}
+	if cc := w.Header().Get("Cache-Control"); cc != "private" {
+		t.Errorf("Expected private zip, got %q", cc)
+	}
+}
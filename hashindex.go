@@ -0,0 +1,201 @@
+package main
+
+import (
+	"io/fs"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// sha256Pattern hash SHA-256 em hex minúsculo
+var sha256Pattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// hashStamp hash de um arquivo indexado e a versão (tamanho e mtime) em que foi calculado
+type hashStamp struct {
+	rel     string
+	size    int64
+	modTime time.Time
+	sum     string
+}
+
+// HashIndex índice SHA-256 -> arquivo da raiz, usado pelo endpoint
+// endereçado por conteúdo (/=/<sha256>)
+type HashIndex struct {
+	config  *ContentAddressConfig
+	logger  *Logger
+	index   *RootIndex // índice da raiz (opcional), evita reler arquivos já indexados
+	running sync.Mutex // serializa as varreduras
+
+	mu     sync.RWMutex
+	byHash map[string][]hashStamp // caminhos com o conteúdo, em ordem lexical
+	byPath map[string]hashStamp   // caminho relativo -> hash (reaproveitado entre varreduras)
+}
+
+// NewHashIndex cria o índice vazio; Build o preenche
+func NewHashIndex(config *ContentAddressConfig, logger *Logger) *HashIndex {
+	return &HashIndex{
+		config: config,
+		logger: logger,
+		byHash: make(map[string][]hashStamp),
+		byPath: make(map[string]hashStamp),
+	}
+}
+
+// prefix retorna o prefixo de URL do endpoint
+func (h *HashIndex) prefix() string {
+	if h.config.Prefix == "" {
+		return "/=/"
+	}
+	return h.config.Prefix
+}
+
+// Build indexa os arquivos visíveis de root; só arquivos novos ou alterados
+// são lidos novamente
+func (h *HashIndex) Build(root string, visible func(root, dir, name string) bool) (hashed, fresh int) {
+	h.running.Lock()
+	defer h.running.Unlock()
+
+	start := time.Now()
+	byHash := make(map[string][]hashStamp)
+	byPath := make(map[string]hashStamp)
+
+	filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || path == root {
+			return nil
+		}
+		name := d.Name()
+		if name == ".git" || strings.HasPrefix(name, ".qserv-") || !visible(root, filepath.Dir(path), name) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		rel := filepath.ToSlash(strings.TrimPrefix(path, root+string(filepath.Separator)))
+
+		h.mu.RLock()
+		stamp, ok := h.byPath[rel]
+		h.mu.RUnlock()
+		if ok && stamp.size == info.Size() && stamp.modTime.Equal(info.ModTime()) {
+			fresh++
+		} else {
+			sum, err := h.index.Sum(path, info)
+			if err != nil {
+				h.logger.Error("Hash index %s: %v", path, err)
+				return nil
+			}
+			stamp = hashStamp{rel: rel, size: info.Size(), modTime: info.ModTime(), sum: sum}
+			hashed++
+		}
+		byPath[rel] = stamp
+		// Conteúdo duplicado: guarda todos os caminhos, cada cliente recebe
+		// o primeiro que pode ler
+		byHash[stamp.sum] = append(byHash[stamp.sum], stamp)
+		return nil
+	})
+
+	h.mu.Lock()
+	h.byHash, h.byPath = byHash, byPath
+	h.mu.Unlock()
+
+	h.logger.Info("Hash index: %d files (%d hashed) in %s", len(byPath), hashed, time.Since(start).Round(time.Millisecond))
+	return hashed, fresh
+}
+
+// Lookup retorna os arquivos indexados com o hash, em ordem lexical
+func (h *HashIndex) Lookup(sum string) []hashStamp {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.byHash[sum]
+}
+
+// handleContentAddressed serve /=/<sha256>: o conteúdo nunca muda para a
+// mesma URL, então a resposta é imutável (exceto se protegida por alguma regra)
+func (s *Server) handleContentAddressed(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	debugNote(r, "backend", "content-addressed")
+
+	sum := strings.ToLower(strings.TrimPrefix(r.URL.Path, s.hashIndex.prefix()))
+	stamps := s.hashIndex.Lookup(sum)
+	if !sha256Pattern.MatchString(sum) || len(stamps) == 0 {
+		s.serveError(w, r, http.StatusNotFound)
+		return
+	}
+
+	// A URL não revela o arquivo: ACL, janelas de horário e cookies assinados
+	// valem para o caminho indexado, como se fosse pedido diretamente. Entre
+	// duplicatas vale o primeiro caminho que o cliente pode ler; se alguma
+	// regra cobre um deles, a resposta depende de quem pede
+	var stamp hashStamp
+	denied, protected := 0, false
+	for _, candidate := range stamps {
+		protected = protected || protectedResource(r, candidate.rel)
+		if stamp.rel != "" {
+			continue
+		}
+		if status := checkResource(r, candidate.rel); status != 0 {
+			if denied == 0 {
+				denied = status
+			}
+			continue
+		}
+		stamp = candidate
+	}
+	if stamp.rel == "" {
+		resourceDenied(w, denied)
+		return
+	}
+
+	root := s.requestRoot(r)
+	path := filepath.Join(root, filepath.FromSlash(stamp.rel))
+	f, err := os.Open(path)
+	if err != nil {
+		s.serveError(w, r, http.StatusNotFound)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil || !info.Mode().IsRegular() {
+		s.serveError(w, r, http.StatusNotFound)
+		return
+	}
+
+	// O arquivo mudou desde a indexação: só serve se o conteúdo ainda confere
+	if info.Size() != stamp.size || !info.ModTime().Equal(stamp.modTime) {
+		current, err := hashFile(path)
+		if err != nil || current != sum {
+			s.serveError(w, r, http.StatusNotFound)
+			return
+		}
+	}
+	if s.schedule != nil {
+		if status, _ := s.schedule.Status(root, path); status != 0 {
+			s.serveError(w, r, http.StatusNotFound)
+			return
+		}
+	}
+
+	if protected {
+		w.Header().Set("Cache-Control", "private")
+	} else {
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	}
+	w.Header().Set("ETag", `"`+sum+`"`)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("inline", map[string]string{"filename": info.Name()}))
+	http.ServeContent(w, r, info.Name(), info.ModTime(), f)
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestContentAddressedEndpoint(t *testing.T) {
+	root := t.TempDir()
+	os.MkdirAll(filepath.Join(root, "builds"), 0755)
+	os.WriteFile(filepath.Join(root, "builds", "app-1.2.tar.gz"), []byte("artifact"), 0644)
+	os.WriteFile(filepath.Join(root, ".secret"), []byte("hidden"), 0644)
+	server := newListingTestServer(t, root, func(c *Config) {
+		c.Security.BlockHiddenFiles = true
+		c.Features.ContentAddress = &ContentAddressConfig{Enabled: true}
+	})
+	server.hashIndex.Build(root, server.listable)
+
+	digest := func(data string) string {
+		sum := sha256.Sum256([]byte(data))
+		return hex.EncodeToString(sum[:])
+	}
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		server.mux.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w
+	}
+
+	w := get("/=/" + digest("artifact"))
+	if w.Code != http.StatusOK || w.Body.String() != "artifact" {
+		t.Fatalf("Expected 200 artifact, got %d %q", w.Code, w.Body.String())
+	}
+	if cc := w.Header().Get("Cache-Control"); cc != "public, max-age=31536000, immutable" {
+		t.Errorf("Expected immutable Cache-Control, got %q", cc)
+	}
+
+	// Hidden files are not indexed; unknown and malformed hashes are 404
+	for _, path := range []string{"/=/" + digest("hidden"), "/=/" + digest("nope"), "/=/not-a-hash"} {
+		if w := get(path); w.Code != http.StatusNotFound {
+			t.Errorf("Expected 404 for %s, got %d", path, w.Code)
+		}
+	}
+
+	// Content changed after indexing: the old hash no longer resolves
+	os.WriteFile(filepath.Join(root, "builds", "app-1.2.tar.gz"), []byte("tampered"), 0644)
+	if w := get("/=/" + digest("artifact")); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 after content change, got %d", w.Code)
+	}
+}
+
+func TestContentAddressedAppliesProxyACL(t *testing.T) {
+	root := t.TempDir()
+	os.MkdirAll(filepath.Join(root, "private"), 0755)
+	os.WriteFile(filepath.Join(root, "private", "report.pdf"), []byte("report"), 0644)
+	server := newListingTestServer(t, root, func(c *Config) {
+		c.Features.ContentAddress = &ContentAddressConfig{Enabled: true}
+		c.Security.ProxyAuth = &ProxyAuthConfig{
+			Enabled:        true,
+			TrustedProxies: []string{"192.0.2.1"},
+			ACL:            []ProxyACLRule{{Path: "/private/**", Groups: []string{"admins"}}},
+		}
+	})
+	server.hashIndex.Build(root, server.listable)
+	sum := sha256.Sum256([]byte("report"))
+
+	// The hash URL leads to /private/report.pdf: the ACL of that path applies
+	req := httptest.NewRequest("GET", "/=/"+hex.EncodeToString(sum[:]), nil)
+	w := httptest.NewRecorder()
+	server.mux.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401, got %d", w.Code)
+	}
+
+	req.Header.Set("Remote-User", "alice")
+	req.Header.Set("Remote-Groups", "admins")
+	w = httptest.NewRecorder()
+	server.mux.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || w.Body.String() != "report" {
+		t.Errorf("Expected 200 for admins, got %d %q", w.Code, w.Body.String())
+	}
+	if cc := w.Header().Get("Cache-Control"); cc != "private" {
+		t.Errorf("Expected private Cache-Control, got %q", cc)
+	}
+}
+
+func TestContentAddressedDuplicatesResolvePerCaller(t *testing.T) {
+	root := t.TempDir()
+	os.MkdirAll(filepath.Join(root, "a-private"), 0755)
+	os.MkdirAll(filepath.Join(root, "b-public"), 0755)
+	os.WriteFile(filepath.Join(root, "a-private", "first.bin"), []byte("same"), 0644)
+	os.WriteFile(filepath.Join(root, "b-public", "second.bin"), []byte("same"), 0644)
+	server := newListingTestServer(t, root, func(c *Config) {
+		c.Features.ContentAddress = &ContentAddressConfig{Enabled: true}
+		c.Security.ProxyAuth = &ProxyAuthConfig{
+			Enabled:        true,
+			TrustedProxies: []string{"192.0.2.1"},
+			ACL:            []ProxyACLRule{{Path: "/a-private/**", Groups: []string{"admins"}}},
+		}
+	})
+	server.hashIndex.Build(root, server.listable)
+	sum := sha256.Sum256([]byte("same"))
+
+	// The lexically first copy is protected: anonymous clients get the public one
+	req := httptest.NewRequest("GET", "/=/"+hex.EncodeToString(sum[:]), nil)
+	w := httptest.NewRecorder()
+	server.mux.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || !strings.Contains(w.Header().Get("Content-Disposition"), "second.bin") {
+		t.Errorf("Expected the public copy, got %d %q", w.Code, w.Header().Get("Content-Disposition"))
+	}
+	if cc := w.Header().Get("Cache-Control"); cc != "private" {
+		t.Errorf("Expected private Cache-Control, got %q", cc)
+	}
+
+	req.Header.Set("Remote-User", "alice")
+	req.Header.Set("Remote-Groups", "admins")
+	w = httptest.NewRecorder()
+	server.mux.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || !strings.Contains(w.Header().Get("Content-Disposition"), "first.bin") {
+		t.Errorf("Expected the first copy for admins, got %d %q", w.Code, w.Header().Get("Content-Disposition"))
+	}
+}
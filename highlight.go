@@ -0,0 +1,350 @@
+package main
+
+import (
+	"html"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// syntax regras léxicas de uma linguagem para o destaque de sintaxe
+type syntax struct {
+	lineComments  []string                 // ex: "//", "#"
+	blockComments [][2]string              // ex: {"/*", "*/"}
+	quotes        string                   // delimitadores de string
+	rawQuotes     string                   // delimitadores sem escapes que atravessam linhas (ex: ` em Go)
+	triple        bool                     // strings com aspas triplas (Python)
+	keywords      map[string]bool          // palavras reservadas e literais
+	foldCase      bool                     // palavras reservadas sem distinção de maiúsculas (SQL)
+	lines         func(line string) string // classe por linha (logs, diffs) em vez de tokens
+}
+
+// words monta o conjunto de palavras reservadas
+func words(list string) map[string]bool {
+	m := make(map[string]bool)
+	for _, w := range strings.Fields(list) {
+		m[w] = true
+	}
+	return m
+}
+
+var (
+	cLikeKeywords = "if else for while do switch case default break continue return goto struct union enum typedef " +
+		"const static extern volatile inline void char short int long float double signed unsigned bool true false " +
+		"class public private protected new delete this super extends implements interface abstract final try catch " +
+		"finally throw throws import package namespace using template typename virtual override auto null nullptr " +
+		"fn let mut pub impl trait mod use crate self Self match loop where as in move ref dyn unsafe async await " +
+		"var val fun when object companion is func guard defer struct sizeof"
+
+	syntaxGo = &syntax{
+		lineComments:  []string{"//"},
+		blockComments: [][2]string{{"/*", "*/"}},
+		quotes:        `"'`,
+		rawQuotes:     "`",
+		keywords: words("break case chan const continue default defer else fallthrough for func go goto if import " +
+			"interface map package range return select struct switch type var true false nil iota any error " +
+			"string bool byte rune int int8 int16 int32 int64 uint uint8 uint16 uint32 uint64 uintptr float32 " +
+			"float64 complex64 complex128 append cap close copy delete len make new panic print println recover"),
+	}
+	syntaxPython = &syntax{
+		lineComments: []string{"#"},
+		quotes:       `"'`,
+		triple:       true,
+		keywords: words("False None True and as assert async await break class continue def del elif else except " +
+			"finally for from global if import in is lambda nonlocal not or pass raise return try while with yield " +
+			"self print len range"),
+	}
+	syntaxJS = &syntax{
+		lineComments:  []string{"//"},
+		blockComments: [][2]string{{"/*", "*/"}},
+		quotes:        `"'`,
+		rawQuotes:     "`",
+		keywords: words("break case catch class const continue debugger default delete do else export extends " +
+			"finally for function if import in instanceof let new return super switch this throw try typeof var void " +
+			"while with yield async await of static get set true false null undefined NaN Infinity interface type " +
+			"enum implements private public protected readonly declare namespace as from"),
+	}
+	syntaxJSON = &syntax{
+		quotes:   `"`,
+		keywords: words("true false null"),
+	}
+	syntaxYAML = &syntax{
+		lineComments: []string{"#"},
+		quotes:       `"'`,
+		keywords:     words("true false null yes no on off True False Null Yes No"),
+	}
+	syntaxShell = &syntax{
+		lineComments: []string{"#"},
+		quotes:       `"'`,
+		keywords: words("if then else elif fi for while until do done case esac in function return exit local " +
+			"export readonly set unset shift echo cd test true false source alias"),
+	}
+	syntaxC = &syntax{
+		lineComments:  []string{"//"},
+		blockComments: [][2]string{{"/*", "*/"}},
+		quotes:        `"'`,
+		keywords:      words(cLikeKeywords),
+	}
+	syntaxCSS = &syntax{
+		blockComments: [][2]string{{"/*", "*/"}},
+		quotes:        `"'`,
+		keywords:      words("important inherit initial unset none auto"),
+	}
+	syntaxSQL = &syntax{
+		lineComments:  []string{"--"},
+		blockComments: [][2]string{{"/*", "*/"}},
+		quotes:        `'"`,
+		foldCase:      true,
+		keywords: words("select from where and or not insert into values update set delete create table drop " +
+			"alter index view join left right inner outer full on as group by order having limit offset union all " +
+			"distinct null is in like between exists case when then else end primary key foreign references " +
+			"default begin commit rollback transaction int integer text varchar boolean true false"),
+	}
+	syntaxConf = &syntax{
+		lineComments: []string{"#", ";"},
+		quotes:       `"'`,
+		keywords:     words("true false yes no on off"),
+	}
+	syntaxRuby = &syntax{
+		lineComments: []string{"#"},
+		quotes:       `"'`,
+		keywords: words("alias and begin break case class def defined? do else elsif end ensure false for if in " +
+			"module next nil not or redo rescue retry return self super then true undef unless until when while " +
+			"yield require attr_accessor puts"),
+	}
+	syntaxLog  = &syntax{lines: logLineClass}
+	syntaxDiff = &syntax{lines: diffLineClass}
+)
+
+// syntaxes linguagem por extensão
+var syntaxes = map[string]*syntax{
+	".go": syntaxGo, ".py": syntaxPython, ".pyi": syntaxPython,
+	".js": syntaxJS, ".mjs": syntaxJS, ".cjs": syntaxJS, ".jsx": syntaxJS, ".ts": syntaxJS, ".tsx": syntaxJS,
+	".json": syntaxJSON, ".jsonl": syntaxJSON, ".ndjson": syntaxJSON, ".yaml": syntaxYAML, ".yml": syntaxYAML,
+	".sh": syntaxShell, ".bash": syntaxShell, ".zsh": syntaxShell,
+	".c": syntaxC, ".h": syntaxC, ".cc": syntaxC, ".cpp": syntaxC, ".hpp": syntaxC, ".java": syntaxC,
+	".rs": syntaxC, ".cs": syntaxC, ".kt": syntaxC, ".swift": syntaxC, ".css": syntaxCSS, ".scss": syntaxCSS,
+	".sql": syntaxSQL, ".toml": syntaxConf, ".ini": syntaxConf, ".conf": syntaxConf, ".cfg": syntaxConf,
+	".env": syntaxConf, ".properties": syntaxConf, ".rb": syntaxRuby,
+	".log": syntaxLog, ".diff": syntaxDiff, ".patch": syntaxDiff,
+}
+
+// logLineClass classe da linha de log pelo nível
+func logLineClass(line string) string {
+	upper := strings.ToUpper(line)
+	for _, level := range []struct{ word, class string }{
+		{"FATAL", "lvl-error"}, {"PANIC", "lvl-error"}, {"ERROR", "lvl-error"}, {"ERR", "lvl-error"},
+		{"WARN", "lvl-warn"}, {"INFO", "lvl-info"}, {"DEBUG", "lvl-debug"}, {"TRACE", "lvl-debug"},
+	} {
+		if i := strings.Index(upper, level.word); i >= 0 && wordBoundary(upper, i, len(level.word)) {
+			return level.class
+		}
+	}
+	return ""
+}
+
+// wordBoundary informa se s[i:i+n] é uma palavra inteira
+func wordBoundary(s string, i, n int) bool {
+	before, _ := utf8.DecodeLastRuneInString(s[:i])
+	after, _ := utf8.DecodeRuneInString(s[i+n:])
+	return (i == 0 || !isIdentRune(before)) && (i+n == len(s) || !isIdentRune(after))
+}
+
+// diffLineClass classe da linha de um diff unificado
+func diffLineClass(line string) string {
+	switch {
+	case strings.HasPrefix(line, "+++"), strings.HasPrefix(line, "---"):
+		return "diff-file"
+	case strings.HasPrefix(line, "+"):
+		return "diff-add"
+	case strings.HasPrefix(line, "-"):
+		return "diff-del"
+	case strings.HasPrefix(line, "@@"):
+		return "diff-hunk"
+	}
+	return ""
+}
+
+// token trecho do código com a classe de destaque ("" = texto comum)
+type token struct {
+	class, text string
+}
+
+// isIdentRune informa se r pode fazer parte de um identificador
+func isIdentRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// tokenize divide o código em trechos destacáveis
+func (sx *syntax) tokenize(src string) []token {
+	var tokens []token
+	plain := 0 // início do texto comum pendente
+	emit := func(start, end int, class string) {
+		if plain < start {
+			tokens = append(tokens, token{"", src[plain:start]})
+		}
+		tokens = append(tokens, token{class, src[start:end]})
+		plain = end
+	}
+
+	for i := 0; i < len(src); {
+		rest := src[i:]
+
+		if end, ok := sx.comment(rest); ok {
+			emit(i, i+end, "com")
+			i += end
+			continue
+		}
+
+		if c := rest[0]; strings.IndexByte(sx.quotes, c) >= 0 || strings.IndexByte(sx.rawQuotes, c) >= 0 {
+			end := sx.stringEnd(rest)
+			emit(i, i+end, "str")
+			i += end
+			continue
+		}
+
+		r, size := utf8.DecodeRuneInString(rest)
+		prev, _ := utf8.DecodeLastRuneInString(src[:i])
+		if i > 0 && isIdentRune(prev) {
+			i += size
+			continue
+		}
+		if unicode.IsDigit(r) {
+			end := 0
+			for end < len(rest) && (isIdentRune(rune(rest[end])) || rest[end] == '.') {
+				end++
+			}
+			emit(i, i+end, "num")
+			i += end
+			continue
+		}
+		if isIdentRune(r) {
+			end := 0
+			for end < len(rest) {
+				r, size := utf8.DecodeRuneInString(rest[end:])
+				if !isIdentRune(r) {
+					break
+				}
+				end += size
+			}
+			word := rest[:end]
+			if sx.foldCase {
+				word = strings.ToLower(word)
+			}
+			if sx.keywords[word] {
+				emit(i, i+end, "kw")
+			}
+			i += end
+			continue
+		}
+		i += size
+	}
+	if plain < len(src) {
+		tokens = append(tokens, token{"", src[plain:]})
+	}
+	return tokens
+}
+
+// comment retorna o tamanho do comentário no início de s, se houver
+func (sx *syntax) comment(s string) (int, bool) {
+	for _, block := range sx.blockComments {
+		if strings.HasPrefix(s, block[0]) {
+			if end := strings.Index(s[len(block[0]):], block[1]); end >= 0 {
+				return len(block[0]) + end + len(block[1]), true
+			}
+			return len(s), true
+		}
+	}
+	for _, prefix := range sx.lineComments {
+		if strings.HasPrefix(s, prefix) {
+			if end := strings.IndexByte(s, '\n'); end >= 0 {
+				return end, true
+			}
+			return len(s), true
+		}
+	}
+	return 0, false
+}
+
+// stringEnd retorna o tamanho da string no início de s; strings comuns
+// terminam no fim da linha se não forem fechadas
+func (sx *syntax) stringEnd(s string) int {
+	quote := s[0]
+	if sx.triple && len(s) >= 3 && s[1] == quote && s[2] == quote {
+		delim := s[:3]
+		if end := strings.Index(s[3:], delim); end >= 0 {
+			return 3 + end + 3
+		}
+		return len(s)
+	}
+	if strings.IndexByte(sx.rawQuotes, quote) >= 0 {
+		if end := strings.IndexByte(s[1:], quote); end >= 0 {
+			return end + 2
+		}
+		return len(s)
+	}
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '\n':
+			return i
+		case quote:
+			return i + 1
+		}
+	}
+	return len(s)
+}
+
+// writeHighlighted escreve o código em HTML, uma <span> por linha com âncora
+// (#L<n>); trechos que atravessam linhas são fechados e reabertos
+func writeHighlighted(w io.Writer, sx *syntax, src string) int {
+	src = strings.ToValidUTF8(strings.ReplaceAll(src, "\r\n", "\n"), "�")
+	src = strings.TrimSuffix(src, "\n")
+
+	var tokens []token
+	if sx.lines == nil {
+		tokens = sx.tokenize(src)
+	} else {
+		tokens = []token{{"", src}}
+	}
+
+	var b strings.Builder
+	n := 0
+	startLine := func(text string) {
+		n++
+		class := "line"
+		if sx.lines != nil {
+			if c := sx.lines(text); c != "" {
+				class += " " + c
+			}
+		}
+		b.WriteString(`<span class="` + class + `" id="L` + strconv.Itoa(n) + `"><a class="ln" href="#L` + strconv.Itoa(n) + `">` + strconv.Itoa(n) + `</a>`)
+	}
+
+	// Texto de cada linha (para a classe por linha)
+	lines := strings.Split(src, "\n")
+	startLine(lines[0])
+	for _, t := range tokens {
+		parts := strings.Split(t.text, "\n")
+		for j, part := range parts {
+			if j > 0 {
+				b.WriteString("</span>\n")
+				startLine(lines[n])
+			}
+			if part == "" {
+				continue
+			}
+			if t.class != "" {
+				b.WriteString(`<span class="` + t.class + `">` + html.EscapeString(part) + `</span>`)
+			} else {
+				b.WriteString(html.EscapeString(part))
+			}
+		}
+	}
+	b.WriteString("</span>\n")
+	io.WriteString(w, b.String())
+	return n
+}
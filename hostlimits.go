@@ -0,0 +1,269 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// hostLimitChunk maior bloco escrito de uma vez numa resposta com banda limitada
+const hostLimitChunk = 32 * 1024
+
+// HostLimits isola os hosts (tenants) de uma instância compartilhada:
+// requisições simultâneas e banda de saída por grupo de hosts, para que um
+// site barulhento não esgote os recursos dos outros
+type HostLimits struct {
+	rules   []*hostLimit
+	timeout time.Duration // write_timeout do servidor, renovado a cada bloco limitado
+}
+
+// hostLimit estado de uma regra
+type hostLimit struct {
+	config *HostLimitConfig
+	slots  chan struct{} // nil sem max_concurrent
+	bucket *byteBucket   // nil sem bytes_per_second
+
+	mu        sync.Mutex
+	requests  int64
+	rejected  int64
+	bytes     int64
+	throttled time.Duration
+}
+
+// byteBucket token bucket de bytes compartilhado pelas respostas de uma regra
+// (capacidade de um segundo de banda)
+type byteBucket struct {
+	mu     sync.Mutex
+	rate   float64 // bytes por segundo
+	tokens float64
+	last   time.Time
+}
+
+// NewHostLimits valida as regras
+func NewHostLimits(configs []HostLimitConfig, writeTimeout time.Duration) (*HostLimits, error) {
+	hl := &HostLimits{timeout: writeTimeout}
+	for i := range configs {
+		config := &configs[i]
+		if len(config.Hosts) == 0 {
+			return nil, fmt.Errorf("host_limits[%d]: hosts is required", i)
+		}
+		if config.MaxConcurrent < 0 || config.BytesPerSecond < 0 || config.QueueTimeout < 0 {
+			return nil, fmt.Errorf("host_limits[%d]: max_concurrent, bytes_per_second and queue_timeout must not be negative", i)
+		}
+		if config.MaxConcurrent == 0 && config.BytesPerSecond == 0 {
+			return nil, fmt.Errorf("host_limits[%d]: set max_concurrent or bytes_per_second", i)
+		}
+		rule := &hostLimit{config: config}
+		if config.MaxConcurrent > 0 {
+			rule.slots = make(chan struct{}, config.MaxConcurrent)
+		}
+		if config.BytesPerSecond > 0 {
+			rule.bucket = newByteBucket(int64(config.BytesPerSecond))
+		}
+		hl.rules = append(hl.rules, rule)
+	}
+	return hl, nil
+}
+
+// name identifica a regra nas métricas (default: o primeiro host)
+func (l *hostLimit) name() string {
+	if l.config.Name != "" {
+		return l.config.Name
+	}
+	return l.config.Hosts[0]
+}
+
+// match retorna a primeira regra que casa com o header Host
+func (hl *HostLimits) match(host string) *hostLimit {
+	for _, rule := range hl.rules {
+		for _, pattern := range rule.config.Hosts {
+			if matchHost(pattern, host) {
+				return rule
+			}
+		}
+	}
+	return nil
+}
+
+// acquire ocupa uma vaga, esperando até queue_timeout
+func (l *hostLimit) acquire(ctx context.Context) bool {
+	if l.slots == nil {
+		return true
+	}
+	select {
+	case l.slots <- struct{}{}:
+		return true
+	default:
+	}
+	if l.config.QueueTimeout <= 0 {
+		return false
+	}
+	timer := time.NewTimer(time.Duration(l.config.QueueTimeout) * time.Second)
+	defer timer.Stop()
+	select {
+	case l.slots <- struct{}{}:
+		return true
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+	return false
+}
+
+// release libera a vaga
+func (l *hostLimit) release() {
+	if l.slots != nil {
+		<-l.slots
+	}
+}
+
+// newByteBucket cria um bucket cheio com rate bytes por segundo
+func newByteBucket(rate int64) *byteBucket {
+	return &byteBucket{rate: float64(rate), tokens: float64(rate), last: time.Now()}
+}
+
+// reserve consome n bytes e retorna quanto esperar até poder enviá-los
+func (b *byteBucket) reserve(n int) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.rate {
+		b.tokens = b.rate
+	}
+	b.last = now
+	b.tokens -= float64(n)
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// throttledWriter envia a resposta em blocos no ritmo dos buckets; cada bloco
+// espera pelo bucket mais lento
+type throttledWriter struct {
+	http.ResponseWriter
+	ctx     context.Context
+	buckets []*byteBucket
+	chunk   int // maior bloco escrito de uma vez
+	rc      *http.ResponseController
+	timeout time.Duration
+	account func(written int, waited time.Duration) // contabiliza cada bloco (opcional)
+}
+
+func (w *throttledWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		chunk := p
+		if len(chunk) > w.chunk {
+			chunk = chunk[:w.chunk]
+		}
+		var wait time.Duration
+		for _, bucket := range w.buckets {
+			if d := bucket.reserve(len(chunk)); d > wait {
+				wait = d
+			}
+		}
+		if wait > 0 {
+			timer := time.NewTimer(wait)
+			select {
+			case <-timer.C:
+			case <-w.ctx.Done():
+				timer.Stop()
+				return written, w.ctx.Err()
+			}
+		}
+		// A espera não conta para o write_timeout da resposta inteira
+		if w.timeout > 0 {
+			w.rc.SetWriteDeadline(time.Now().Add(w.timeout))
+		}
+		n, err := w.ResponseWriter.Write(chunk)
+		written += n
+		if w.account != nil {
+			w.account(n, wait)
+		}
+		if err != nil {
+			return written, err
+		}
+		p = p[len(chunk):]
+	}
+	return written, nil
+}
+
+// Unwrap permite ao http.ResponseController acessar o writer original
+func (w *throttledWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// account soma os bytes enviados e a espera pela banda
+func (l *hostLimit) account(written int, waited time.Duration) {
+	l.mu.Lock()
+	l.bytes += int64(written)
+	l.throttled += waited
+	l.mu.Unlock()
+}
+
+// errHostBusy todas as vagas do host ocupadas
+var errHostBusy = errors.New("host is at its concurrency limit")
+
+// HostLimitsMiddleware aplica o limite de concorrência (503 quando não há
+// vaga) e a banda da regra que casa com o Host
+func HostLimitsMiddleware(hl *HostLimits) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rule := hl.match(r.Host)
+			if rule == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if !rule.acquire(r.Context()) {
+				rule.mu.Lock()
+				rule.rejected++
+				rule.mu.Unlock()
+				w.Header().Set("Retry-After", "1")
+				http.Error(w, "503 Service Unavailable: "+errHostBusy.Error(), http.StatusServiceUnavailable)
+				return
+			}
+			defer rule.release()
+			rule.mu.Lock()
+			rule.requests++
+			rule.mu.Unlock()
+
+			if rule.bucket != nil {
+				w = &throttledWriter{
+					ResponseWriter: w,
+					ctx:            r.Context(),
+					buckets:        []*byteBucket{rule.bucket},
+					chunk:          min(hostLimitChunk, rule.config.BytesPerSecond),
+					rc:             http.NewResponseController(w),
+					timeout:        hl.timeout,
+					account:        rule.account,
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// WriteMetrics exporta uso e rejeições por regra
+func (hl *HostLimits) WriteMetrics(w io.Writer) {
+	var active, requests, rejected, bytes, throttled []metricSample
+	for _, rule := range hl.rules {
+		labels := map[string]string{"host": rule.name()}
+		rule.mu.Lock()
+		requests = append(requests, metricSample{labels: labels, value: float64(rule.requests)})
+		rejected = append(rejected, metricSample{labels: labels, value: float64(rule.rejected)})
+		bytes = append(bytes, metricSample{labels: labels, value: float64(rule.bytes)})
+		throttled = append(throttled, metricSample{labels: labels, value: rule.throttled.Seconds()})
+		rule.mu.Unlock()
+		active = append(active, metricSample{labels: labels, value: float64(len(rule.slots))})
+	}
+	writeMetric(w, "qserv_host_active_requests", "Requests in progress per host limit (only with max_concurrent).", "gauge", active)
+	writeMetric(w, "qserv_host_requests_total", "Requests admitted per host limit.", "counter", requests)
+	writeMetric(w, "qserv_host_rejected_total", "Requests rejected with 503 because the host had no free slot.", "counter", rejected)
+	writeMetric(w, "qserv_host_throttled_bytes_total", "Response bytes sent under a host bandwidth cap.", "counter", bytes)
+	writeMetric(w, "qserv_host_throttled_seconds_total", "Time responses waited for host bandwidth.", "counter", throttled)
+}
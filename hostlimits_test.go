@@ -0,0 +1,83 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHostLimitsConcurrency(t *testing.T) {
+	hl, err := NewHostLimits([]HostLimitConfig{{Name: "tenant", Hosts: []string{"*.tenant.test"}, MaxConcurrent: 1}}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	started, release := make(chan struct{}), make(chan struct{})
+	handler := HostLimitsMiddleware(hl)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			close(started)
+			<-release
+		}
+	}))
+
+	done := make(chan struct{})
+	go func() {
+		req := httptest.NewRequest("GET", "/slow", nil)
+		req.Host = "a.tenant.test"
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+		close(done)
+	}()
+	<-started
+
+	// The tenant's only slot is taken; other hosts are unaffected
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Host = "b.tenant.test"
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") == "" {
+		t.Errorf("Expected 503 with Retry-After, got %d", w.Code)
+	}
+	req = httptest.NewRequest("GET", "/", nil)
+	req.Host = "other.test"
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected other hosts to be served, got %d", w.Code)
+	}
+
+	close(release)
+	<-done
+	var b strings.Builder
+	hl.WriteMetrics(&b)
+	for _, want := range []string{`qserv_host_rejected_total{host="tenant"} 1`, `qserv_host_requests_total{host="tenant"} 1`, `qserv_host_active_requests{host="tenant"} 0`} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("Expected %q in metrics, got %s", want, b.String())
+		}
+	}
+}
+
+func TestHostLimitsBandwidth(t *testing.T) {
+	root := t.TempDir()
+	writeTestFile(t, root+"/big.bin", strings.Repeat("x", 3000))
+	server := newListingTestServer(t, root, func(c *Config) {
+		c.Performance.HostLimits = []HostLimitConfig{{Hosts: []string{"slow.test"}, BytesPerSecond: 2000}}
+	})
+
+	// The first second of bandwidth is available at once, the rest waits
+	start := time.Now()
+	req := httptest.NewRequest("GET", "/big.bin", nil)
+	req.Host = "slow.test"
+	w := httptest.NewRecorder()
+	server.mux.ServeHTTP(w, req)
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond {
+		t.Errorf("Expected the response to be throttled, took %s", elapsed)
+	}
+	if w.Body.Len() != 3000 {
+		t.Errorf("Expected full body, got %d bytes", w.Body.Len())
+	}
+
+	if _, err := NewHostLimits([]HostLimitConfig{{Hosts: []string{"a.test"}}}, 0); err == nil {
+		t.Errorf("Expected a rule without limits to be rejected")
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// normalizeHost separa host e porta do header Host, em minúsculas e sem o
+// ponto final de FQDN
+func normalizeHost(hostport string) (host, port string) {
+	host = hostport
+	if h, p, err := net.SplitHostPort(hostport); err == nil {
+		host, port = h, p
+	} else {
+		host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+	}
+	return strings.TrimSuffix(strings.ToLower(host), "."), port
+}
+
+// matchHost verifica o header Host contra um padrão: "example.com",
+// "*.example.com" (apenas subdomínios) ou com porta ("example.com:8080")
+func matchHost(pattern, hostport string) bool {
+	host, port := normalizeHost(hostport)
+	patternHost, patternPort := normalizeHost(pattern)
+	if patternPort != "" && patternPort != port {
+		return false
+	}
+	if suffix, ok := strings.CutPrefix(patternHost, "*."); ok {
+		return strings.HasSuffix(host, "."+suffix)
+	}
+	return host == patternHost
+}
+
+// HostFilterMiddleware rejeita requisições cujo Host não está na lista
+// (protege contra DNS rebinding e envenenamento de cache)
+func HostFilterMiddleware(allowed []string, status int, logger *Logger) Middleware {
+	if status == 0 {
+		status = http.StatusMisdirectedRequest
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for _, pattern := range allowed {
+				if matchHost(pattern, r.Host) {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+			logger.Debug("Rejected request for unexpected host %q from %s", r.Host, r.RemoteAddr)
+			http.Error(w, http.StatusText(status), status)
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMatchHost(t *testing.T) {
+	tests := []struct {
+		pattern, host string
+		want          bool
+	}{
+		{"example.com", "example.com", true},
+		{"example.com", "EXAMPLE.com.:8080", true},
+		{"example.com", "www.example.com", false},
+		{"*.example.com", "cdn.example.com", true},
+		{"*.example.com", "example.com", false},
+		{"*.example.com", "evil-example.com", false},
+		{"example.com:8080", "example.com:8080", true},
+		{"example.com:8080", "example.com:9090", false},
+		{"[::1]", "[::1]:8080", true},
+		{"::1", "[::1]", true},
+		{"localhost", "127.0.0.1", false},
+	}
+	for _, tt := range tests {
+		if got := matchHost(tt.pattern, tt.host); got != tt.want {
+			t.Errorf("matchHost(%q, %q) = %v, expected %v", tt.pattern, tt.host, got, tt.want)
+		}
+	}
+}
+
+func TestHostFilterMiddleware(t *testing.T) {
+	logger, _ := NewLogger(&LoggingConfig{Enabled: false})
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	for _, tt := range []struct {
+		status, want int
+	}{{0, http.StatusMisdirectedRequest}, {http.StatusNotFound, http.StatusNotFound}} {
+		handler := HostFilterMiddleware([]string{"example.com"}, tt.status, logger)(ok)
+
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Host = "example.com"
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Errorf("Expected allowed host to pass, got %d", w.Code)
+		}
+
+		req.Host = "attacker.test"
+		w = httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code != tt.want {
+			t.Errorf("Expected %d for unexpected host, got %d", tt.want, w.Code)
+		}
+	}
+}
+
+func TestHostFilterCoversSideRoutes(t *testing.T) {
+	server := newListingTestServer(t, t.TempDir(), func(c *Config) {
+		c.Security.AllowedHosts = []string{"files.example.com"}
+		c.RuntimeConfig = &RuntimeConfigConfig{Enabled: true}
+	})
+
+	// Routes registered directly on the mux are behind the filter too
+	for _, path := range []string{"/", "/runtime-config.js"} {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Host = "rebind.attacker.test"
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		if w.Code != http.StatusMisdirectedRequest {
+			t.Errorf("%s: Expected 421 for unexpected host, got %d", path, w.Code)
+		}
+
+		req.Host = "files.example.com"
+		w = httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Errorf("%s: Expected allowed host to pass, got %d", path, w.Code)
+		}
+	}
+}
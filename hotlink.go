@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync/atomic"
+)
+
+// hotlinkMediaExtensions caminhos protegidos quando paths não é configurado
+var hotlinkMediaExtensions = map[string]bool{
+	".jpg": true, ".jpeg": true, ".png": true, ".gif": true, ".webp": true, ".avif": true, ".svg": true, ".ico": true,
+	".mp4": true, ".webm": true, ".mov": true, ".m4v": true, ".mp3": true, ".ogg": true, ".wav": true, ".flac": true,
+}
+
+// Hotlink recusa requisições a arquivos de mídia embutidos por outros
+// sites: o Referer (ou o Origin, na falta dele) precisa ser o próprio host
+// ou um dos sites permitidos
+type Hotlink struct {
+	config      *HotlinkConfig
+	placeholder string // caminho local do placeholder, que nunca é bloqueado
+
+	blocked atomic.Int64
+}
+
+// NewHotlink valida a configuração
+func NewHotlink(config *HotlinkConfig) (*Hotlink, error) {
+	h := &Hotlink{config: config}
+	if config.Placeholder != "" {
+		u, err := url.Parse(config.Placeholder)
+		if err != nil || (u.Scheme == "" && !strings.HasPrefix(u.Path, "/")) {
+			return nil, fmt.Errorf("hotlink: placeholder must be an absolute path or URL, got %q", config.Placeholder)
+		}
+		if u.Host == "" {
+			h.placeholder = u.Path
+		}
+	}
+	for _, site := range config.AllowedSites {
+		if site == "" || strings.Contains(site, "/") {
+			return nil, fmt.Errorf("hotlink: invalid allowed site %q (use a host such as example.com or *.example.com)", site)
+		}
+	}
+	return h, nil
+}
+
+// protects informa se o caminho está sujeito à proteção
+func (h *Hotlink) protects(urlPath string) bool {
+	if urlPath == h.placeholder {
+		return false
+	}
+	if len(h.config.Paths) == 0 {
+		return hotlinkMediaExtensions[strings.ToLower(path.Ext(urlPath))]
+	}
+	for _, pattern := range h.config.Paths {
+		if matchGlob(pattern, urlPath) {
+			return true
+		}
+	}
+	return false
+}
+
+// Allowed verifica a origem da requisição: o próprio host, um site
+// permitido ou, se block_empty estiver desligado, nenhuma origem informada
+func (h *Hotlink) Allowed(r *http.Request) bool {
+	source := r.Header.Get("Referer")
+	if source == "" {
+		source = r.Header.Get("Origin")
+	}
+	if source == "" || source == "null" {
+		return !h.config.BlockEmpty
+	}
+	u, err := url.Parse(source)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	if host, _ := normalizeHost(u.Host); host == hostname(r.Host) {
+		return true
+	}
+	for _, site := range h.config.AllowedSites {
+		if matchHost(site, u.Host) {
+			return true
+		}
+	}
+	return false
+}
+
+// hostname retorna o host sem porta, normalizado
+func hostname(hostport string) string {
+	host, _ := normalizeHost(hostport)
+	return host
+}
+
+// WriteMetrics exporta as requisições recusadas
+func (h *Hotlink) WriteMetrics(w io.Writer) {
+	writeMetric(w, "qserv_hotlink_blocked_total", "Requests for protected media refused because of a foreign Referer or Origin.", "counter",
+		[]metricSample{{value: float64(h.blocked.Load())}})
+}
+
+// HotlinkMiddleware redireciona para o placeholder ou responde 403 quando a
+// mídia é pedida a partir de outro site
+func HotlinkMiddleware(h *Hotlink, logger *Logger) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !h.protects(r.URL.Path) || h.Allowed(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			h.blocked.Add(1)
+			logger.Debug("Hotlink: %s %s refused (referer %q)", r.Method, r.URL.Path, r.Referer())
+			// A resposta depende do Referer: não pode ficar em cache
+			w.Header().Set("Cache-Control", "no-store")
+			if h.config.Placeholder != "" {
+				http.Redirect(w, r, h.config.Placeholder, http.StatusFound)
+				return
+			}
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		})
+	}
+}
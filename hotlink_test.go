@@ -0,0 +1,82 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHotlinkMiddleware(t *testing.T) {
+	logger, _ := NewLogger(&LoggingConfig{Enabled: false})
+	newHandler := func(config *HotlinkConfig) http.Handler {
+		h, err := NewHotlink(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return HotlinkMiddleware(h, logger)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("ok"))
+		}))
+	}
+	get := func(handler http.Handler, target string, headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", target, nil)
+		req.Host = "files.local:8080"
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	handler := newHandler(&HotlinkConfig{Enabled: true, AllowedSites: []string{"*.example.com"}})
+	tests := []struct {
+		target   string
+		headers  map[string]string
+		expected int
+	}{
+		{"/photo.JPG", map[string]string{"Referer": "http://files.local:8080/gallery/"}, http.StatusOK},
+		{"/photo.jpg", map[string]string{"Referer": "https://blog.example.com/post"}, http.StatusOK},
+		{"/photo.jpg", map[string]string{"Referer": "https://evil.test/"}, http.StatusForbidden},
+		{"/photo.jpg", map[string]string{"Origin": "https://evil.test"}, http.StatusForbidden},
+		{"/photo.jpg", map[string]string{"Origin": "https://www.example.com"}, http.StatusOK},
+		{"/photo.jpg", nil, http.StatusOK},
+		{"/photo.jpg", map[string]string{"Origin": "null"}, http.StatusOK},
+		{"/notes.txt", map[string]string{"Referer": "https://evil.test/"}, http.StatusOK},
+	}
+	for _, tt := range tests {
+		w := get(handler, tt.target, tt.headers)
+		if w.Code != tt.expected {
+			t.Errorf("%s %v: expected %d, got %d", tt.target, tt.headers, tt.expected, w.Code)
+		}
+	}
+	if w := get(handler, "/photo.jpg", map[string]string{"Referer": "https://evil.test/"}); w.Header().Get("Cache-Control") != "no-store" {
+		t.Errorf("Expected refused response to be no-store, got %q", w.Header().Get("Cache-Control"))
+	}
+
+	// block_empty, custom paths and placeholder redirect
+	handler = newHandler(&HotlinkConfig{Enabled: true, BlockEmpty: true, Paths: []string{"/media/**"}, Placeholder: "/media/hotlink.png"})
+	if w := get(handler, "/media/clip.bin", nil); w.Code != http.StatusFound || w.Header().Get("Location") != "/media/hotlink.png" {
+		t.Errorf("Expected redirect to placeholder, got %d %q", w.Code, w.Header().Get("Location"))
+	}
+	if w := get(handler, "/media/hotlink.png", map[string]string{"Referer": "https://evil.test/"}); w.Code != http.StatusOK {
+		t.Errorf("Expected placeholder itself to be served, got %d", w.Code)
+	}
+	if w := get(handler, "/photo.jpg", map[string]string{"Referer": "https://evil.test/"}); w.Code != http.StatusOK {
+		t.Errorf("Expected path outside configured globs to be served, got %d", w.Code)
+	}
+}
+
+func TestNewHotlinkErrors(t *testing.T) {
+	for _, config := range []*HotlinkConfig{
+		{Placeholder: "hotlink.png"},
+		{AllowedSites: []string{""}},
+		{AllowedSites: []string{"https://example.com/"}},
+	} {
+		if _, err := NewHotlink(config); err == nil {
+			t.Errorf("Expected error for %+v", config)
+		}
+	}
+	if _, err := NewHotlink(&HotlinkConfig{Placeholder: "https://cdn.example.com/hotlink.png"}); err != nil {
+		t.Errorf("Expected URL placeholder to be accepted, got %v", err)
+	}
+}
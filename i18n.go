@@ -0,0 +1,234 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// translations textos das páginas embutidas; a chave é o texto em inglês
+var translations = map[string]map[string]string{
+	"pt": {
+		"Index of":                           "Índice de",
+		"Name":                               "Nome",
+		"Size":                               "Tamanho",
+		"Modified":                           "Modificado",
+		"Parent directory":                   "Diretório acima",
+		"Upload":                             "Enviar",
+		"Download":                           "Baixar",
+		"More entries…":                      "Mais entradas…",
+		"Home":                               "Início",
+		"Checking your browser":              "Verificando seu navegador",
+		"Please confirm you are not a robot": "Confirme que você não é um robô",
+		"Continue":                           "Continuar",
+		"Raw":                                "Original",
+		"lines":                              "linhas",
+		"Connecting…":                        "Conectando…",
+		"Following":                          "Acompanhando",
+		"Reconnecting…":                      "Reconectando…",
+		"Stopped (time limit reached)":       "Encerrado (limite de tempo atingido)",
+		"Bad Request":                        "Requisição inválida",
+		"Unauthorized":                       "Não autorizado",
+		"Forbidden":                          "Acesso negado",
+		"Not Found":                          "Não encontrado",
+		"Method Not Allowed":                 "Método não permitido",
+		"Gone":                               "Removido",
+		"Too Many Requests":                  "Muitas requisições",
+		"Internal Server Error":              "Erro interno do servidor",
+		"Service Unavailable":                "Serviço indisponível",
+		"Insufficient Storage":               "Espaço insuficiente",
+	},
+	"es": {
+		"Index of":                           "Índice de",
+		"Name":                               "Nombre",
+		"Size":                               "Tamaño",
+		"Modified":                           "Modificado",
+		"Parent directory":                   "Directorio superior",
+		"Upload":                             "Subir",
+		"Download":                           "Descargar",
+		"More entries…":                      "Más entradas…",
+		"Home":                               "Inicio",
+		"Checking your browser":              "Comprobando su navegador",
+		"Please confirm you are not a robot": "Confirme que no es un robot",
+		"Continue":                           "Continuar",
+		"Raw":                                "Original",
+		"lines":                              "líneas",
+		"Connecting…":                        "Conectando…",
+		"Following":                          "Siguiendo",
+		"Reconnecting…":                      "Reconectando…",
+		"Stopped (time limit reached)":       "Detenido (límite de tiempo alcanzado)",
+		"Bad Request":                        "Solicitud incorrecta",
+		"Unauthorized":                       "No autorizado",
+		"Forbidden":                          "Prohibido",
+		"Not Found":                          "No encontrado",
+		"Method Not Allowed":                 "Método no permitido",
+		"Gone":                               "Eliminado",
+		"Too Many Requests":                  "Demasiadas solicitudes",
+		"Internal Server Error":              "Error interno del servidor",
+		"Service Unavailable":                "Servicio no disponible",
+		"Insufficient Storage":               "Almacenamiento insuficiente",
+	},
+	"fr": {
+		"Index of":                           "Index de",
+		"Name":                               "Nom",
+		"Size":                               "Taille",
+		"Modified":                           "Modifié",
+		"Parent directory":                   "Répertoire parent",
+		"Upload":                             "Téléverser",
+		"Download":                           "Télécharger",
+		"More entries…":                      "Plus d’entrées…",
+		"Home":                               "Accueil",
+		"Checking your browser":              "Vérification de votre navigateur",
+		"Please confirm you are not a robot": "Veuillez confirmer que vous n’êtes pas un robot",
+		"Continue":                           "Continuer",
+		"Raw":                                "Brut",
+		"lines":                              "lignes",
+		"Connecting…":                        "Connexion…",
+		"Following":                          "Suivi en direct",
+		"Reconnecting…":                      "Reconnexion…",
+		"Stopped (time limit reached)":       "Arrêté (limite de temps atteinte)",
+		"Bad Request":                        "Requête incorrecte",
+		"Unauthorized":                       "Non autorisé",
+		"Forbidden":                          "Interdit",
+		"Not Found":                          "Introuvable",
+		"Method Not Allowed":                 "Méthode non autorisée",
+		"Gone":                               "Supprimé",
+		"Too Many Requests":                  "Trop de requêtes",
+		"Internal Server Error":              "Erreur interne du serveur",
+		"Service Unavailable":                "Service indisponible",
+		"Insufficient Storage":               "Espace insuffisant",
+	},
+	"de": {
+		"Index of":                           "Verzeichnis",
+		"Name":                               "Name",
+		"Size":                               "Größe",
+		"Modified":                           "Geändert",
+		"Parent directory":                   "Übergeordnetes Verzeichnis",
+		"Upload":                             "Hochladen",
+		"Download":                           "Herunterladen",
+		"More entries…":                      "Weitere Einträge…",
+		"Home":                               "Startseite",
+		"Checking your browser":              "Ihr Browser wird überprüft",
+		"Please confirm you are not a robot": "Bitte bestätigen Sie, dass Sie kein Roboter sind",
+		"Continue":                           "Weiter",
+		"Raw":                                "Roh",
+		"lines":                              "Zeilen",
+		"Connecting…":                        "Verbinden…",
+		"Following":                          "Live-Verfolgung",
+		"Reconnecting…":                      "Neu verbinden…",
+		"Stopped (time limit reached)":       "Beendet (Zeitlimit erreicht)",
+		"Bad Request":                        "Ungültige Anfrage",
+		"Unauthorized":                       "Nicht autorisiert",
+		"Forbidden":                          "Zugriff verweigert",
+		"Not Found":                          "Nicht gefunden",
+		"Method Not Allowed":                 "Methode nicht erlaubt",
+		"Gone":                               "Entfernt",
+		"Too Many Requests":                  "Zu viele Anfragen",
+		"Internal Server Error":              "Interner Serverfehler",
+		"Service Unavailable":                "Dienst nicht verfügbar",
+		"Insufficient Storage":               "Speicherplatz nicht ausreichend",
+	},
+	"it": {
+		"Index of":                           "Indice di",
+		"Name":                               "Nome",
+		"Size":                               "Dimensione",
+		"Modified":                           "Modificato",
+		"Parent directory":                   "Cartella superiore",
+		"Upload":                             "Carica",
+		"Download":                           "Scarica",
+		"More entries…":                      "Altre voci…",
+		"Home":                               "Home",
+		"Checking your browser":              "Verifica del browser in corso",
+		"Please confirm you are not a robot": "Conferma di non essere un robot",
+		"Continue":                           "Continua",
+		"Raw":                                "Originale",
+		"lines":                              "righe",
+		"Connecting…":                        "Connessione…",
+		"Following":                          "In ascolto",
+		"Reconnecting…":                      "Riconnessione…",
+		"Stopped (time limit reached)":       "Interrotto (limite di tempo raggiunto)",
+		"Bad Request":                        "Richiesta non valida",
+		"Unauthorized":                       "Non autorizzato",
+		"Forbidden":                          "Accesso negato",
+		"Not Found":                          "Non trovato",
+		"Method Not Allowed":                 "Metodo non consentito",
+		"Gone":                               "Rimosso",
+		"Too Many Requests":                  "Troppe richieste",
+		"Internal Server Error":              "Errore interno del server",
+		"Service Unavailable":                "Servizio non disponibile",
+		"Insufficient Storage":               "Spazio insufficiente",
+	},
+}
+
+// Messages textos de um idioma para os templates ({{.Msg.T "Name"}})
+type Messages struct {
+	Lang string
+	m    map[string]string
+}
+
+// T traduz o texto; sem tradução, retorna o original em inglês
+func (m *Messages) T(text string) string {
+	if translated, ok := m.m[text]; ok {
+		return translated
+	}
+	return text
+}
+
+// supportedLanguage normaliza o código (pt-BR -> pt) e informa se há tradução
+func supportedLanguage(tag string) (string, bool) {
+	lang := strings.ToLower(strings.TrimSpace(tag))
+	if i := strings.IndexAny(lang, "-_"); i >= 0 {
+		lang = lang[:i]
+	}
+	_, ok := translations[lang]
+	return lang, ok || lang == "en"
+}
+
+// negotiateLanguage escolhe o idioma pelo Accept-Language (q-values); inglês
+// quando nenhum dos pedidos tem tradução
+func negotiateLanguage(header string) string {
+	type candidate struct {
+		lang string
+		q    float64
+	}
+	var candidates []candidate
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(part, ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+				q = parsed
+			}
+		}
+		if lang, ok := supportedLanguage(tag); ok && q > 0 {
+			candidates = append(candidates, candidate{lang, q})
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].q > candidates[j].q })
+	if len(candidates) == 0 {
+		return "en"
+	}
+	return candidates[0].lang
+}
+
+// messagesFor retorna os textos para a requisição: o idioma configurado ou,
+// sem configuração, o negociado pelo Accept-Language
+func messagesFor(r *http.Request, language string) *Messages {
+	lang := "en"
+	if language != "" {
+		lang, _ = supportedLanguage(language)
+	} else {
+		lang = negotiateLanguage(r.Header.Get("Accept-Language"))
+	}
+	return &Messages{Lang: lang, m: translations[lang]}
+}
+
+// messages retorna os textos das páginas embutidas para a requisição; com o
+// idioma negociado, a resposta varia com o Accept-Language
+func (s *Server) messages(w http.ResponseWriter, r *http.Request) *Messages {
+	if s.config.Features.Language == "" {
+		w.Header().Add("Vary", "Accept-Language")
+	}
+	return messagesFor(r, s.config.Features.Language)
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNegotiateLanguage(t *testing.T) {
+	cases := map[string]string{
+		"":                        "en",
+		"pt-BR,pt;q=0.9,en;q=0.8": "pt",
+		"en-US,en;q=0.9,de;q=0.8": "en",
+		"ja,fr;q=0.5":             "fr",
+		"es;q=0.2, de;q=0.7":      "de",
+		"zh-CN":                   "en",
+		"fr;q=0, it":              "it",
+	}
+	for header, want := range cases {
+		if got := negotiateLanguage(header); got != want {
+			t.Errorf("Expected %s for %q, got %s", want, header, got)
+		}
+	}
+}
+
+func TestListingTranslated(t *testing.T) {
+	root := t.TempDir()
+	server := newListingTestServer(t, root, nil)
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Language", "pt-BR,pt;q=0.9")
+	w := httptest.NewRecorder()
+	server.mux.ServeHTTP(w, req)
+	body := w.Body.String()
+	if !strings.Contains(body, `<html lang="pt">`) || !strings.Contains(body, "Índice de") || !strings.Contains(body, "Tamanho") {
+		t.Errorf("Expected Portuguese listing, got %s", body)
+	}
+	if !strings.Contains(w.Header().Get("Vary"), "Accept-Language") {
+		t.Errorf("Expected Vary: Accept-Language, got %q", w.Header().Get("Vary"))
+	}
+
+	// The ETag differs per language so caches don't mix translations
+	req.Header.Set("Accept-Language", "de")
+	w2 := httptest.NewRecorder()
+	server.mux.ServeHTTP(w2, req)
+	if !strings.Contains(w2.Body.String(), "Größe") || w.Header().Get("ETag") == w2.Header().Get("ETag") {
+		t.Errorf("Expected German listing with a different ETag")
+	}
+}
+
+func TestErrorPageLanguageOverride(t *testing.T) {
+	server := newListingTestServer(t, t.TempDir(), func(c *Config) { c.Features.Language = "es" })
+
+	req := httptest.NewRequest("GET", "/missing", nil)
+	req.Header.Set("Accept", "text/html")
+	req.Header.Set("Accept-Language", "fr")
+	w := httptest.NewRecorder()
+	server.mux.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound || !strings.Contains(w.Body.String(), "No encontrado") {
+		t.Errorf("Expected Spanish 404 page, got %d %s", w.Code, w.Body.String())
+	}
+	if w.Header().Get("Vary") != "" {
+		t.Errorf("Expected no Vary with a fixed language, got %q", w.Header().Get("Vary"))
+	}
+}
@@ -0,0 +1,353 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// IndexEntry tamanho, mtime e (opcionalmente) hash de um item da raiz
+type IndexEntry struct {
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+	Dir     bool      `json:"dir,omitempty"`
+	SHA256  string    `json:"sha256,omitempty"`
+}
+
+// rootIndexFile formato persistido do índice
+type rootIndexFile struct {
+	Root    string                `json:"root"`
+	BuiltAt time.Time             `json:"built_at"`
+	Entries map[string]IndexEntry `json:"entries"` // caminho relativo (com "/") -> entrada
+}
+
+// IndexSummary resumo do índice para a API
+type IndexSummary struct {
+	Root    string    `json:"root"`
+	BuiltAt time.Time `json:"built_at"`
+	Files   int       `json:"files"`
+	Dirs    int       `json:"dirs"`
+	Bytes   int64     `json:"bytes"`
+	Hashed  int       `json:"hashed"`
+}
+
+// RootIndex índice da árvore da raiz (tamanhos, mtimes e hashes), gravado em
+// disco para sobreviver a reinícios. Integridade, o endpoint por hash e ETags
+// por conteúdo consultam o índice em vez de reler os arquivos.
+type RootIndex struct {
+	config  *IndexConfig
+	logger  *Logger
+	file    string
+	running sync.Mutex // serializa as varreduras
+
+	mu    sync.RWMutex
+	index rootIndexFile
+	usage *indexUsage // totais por diretório, calculados sob demanda
+}
+
+// indexUsage totais recursivos de cada diretório do índice ("" é a raiz) e
+// os itens diretamente dentro de cada um
+type indexUsage struct {
+	dirs     map[string]*DirUsage
+	children map[string][]string
+}
+
+// NewRootIndex cria o índice e carrega a última versão gravada, se houver
+func NewRootIndex(config *IndexConfig, logger *Logger) *RootIndex {
+	file := config.File
+	if file == "" {
+		file = ".qserv-index.json"
+	}
+	if abs, err := filepath.Abs(file); err == nil {
+		file = abs
+	}
+	x := &RootIndex{config: config, logger: logger, file: file}
+	x.load()
+	return x
+}
+
+// load lê o índice gravado; um arquivo ausente ou inválido é ignorado
+func (x *RootIndex) load() {
+	data, err := os.ReadFile(x.file)
+	if err != nil {
+		return
+	}
+	var index rootIndexFile
+	if err := json.Unmarshal(data, &index); err != nil {
+		x.logger.Warn("Ignoring invalid root index %s: %v", x.file, err)
+		return
+	}
+	x.index = index
+}
+
+// save grava o índice (escreve ao lado e renomeia)
+func (x *RootIndex) save(index rootIndexFile) error {
+	data, err := json.Marshal(index)
+	if err != nil {
+		return err
+	}
+	tmp := x.file + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, x.file); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// Build varre root; hashes de arquivos que não mudaram são reaproveitados
+func (x *RootIndex) Build(root string) (IndexSummary, error) {
+	x.running.Lock()
+	defer x.running.Unlock()
+
+	x.mu.RLock()
+	previous := x.index
+	x.mu.RUnlock()
+	reuse := previous.Root == root
+
+	index := rootIndexFile{Root: root, BuiltAt: time.Now(), Entries: make(map[string]IndexEntry)}
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || path == root {
+			return nil
+		}
+		name := d.Name()
+		if name == ".git" || strings.HasPrefix(name, ".qserv-") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.IsDir() && !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		rel := filepath.ToSlash(strings.TrimPrefix(path, root+string(filepath.Separator)))
+		entry := IndexEntry{Size: info.Size(), ModTime: info.ModTime(), Dir: d.IsDir()}
+		if entry.Dir {
+			entry.Size = 0
+		} else if x.config.Hash {
+			old, ok := previous.Entries[rel]
+			if reuse && ok && old.SHA256 != "" && old.Size == entry.Size && old.ModTime.Equal(entry.ModTime) {
+				entry.SHA256 = old.SHA256
+			} else if sum, err := hashFile(path); err == nil {
+				entry.SHA256 = sum
+			} else {
+				x.logger.Error("Root index %s: %v", path, err)
+			}
+		}
+		index.Entries[rel] = entry
+		return nil
+	})
+	if err != nil {
+		return IndexSummary{}, err
+	}
+
+	x.mu.Lock()
+	x.index = index
+	x.usage = nil
+	x.mu.Unlock()
+
+	summary := x.Summary()
+	if err := x.save(index); err != nil {
+		return summary, fmt.Errorf("saving root index: %w", err)
+	}
+	return summary, nil
+}
+
+// Lookup retorna a entrada do caminho no disco, se ele estiver na raiz
+// indexada e a entrada ainda corresponder ao arquivo (mesmo tamanho e mtime)
+func (x *RootIndex) Lookup(path string, info fs.FileInfo) (IndexEntry, bool) {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	if x.index.Root == "" {
+		return IndexEntry{}, false
+	}
+	rel, err := relPath(x.index.Root, path)
+	if err != nil {
+		return IndexEntry{}, false
+	}
+	entry, ok := x.index.Entries[rel]
+	if !ok || entry.Dir || entry.Size != info.Size() || !entry.ModTime.Equal(info.ModTime()) {
+		return IndexEntry{}, false
+	}
+	return entry, true
+}
+
+// Sum retorna o SHA-256 do arquivo, do índice quando atualizado ou lendo o
+// conteúdo; pode ser chamado com o índice desativado (nil)
+func (x *RootIndex) Sum(path string, info fs.FileInfo) (string, error) {
+	if x != nil {
+		if entry, ok := x.Lookup(path, info); ok && entry.SHA256 != "" {
+			return entry.SHA256, nil
+		}
+	}
+	return hashFile(path)
+}
+
+// Each chama fn para cada item do índice de root; false se o índice atual
+// não for dessa raiz (ainda não gerado ou raiz trocada)
+func (x *RootIndex) Each(root string, fn func(rel string, entry IndexEntry)) bool {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	if x.index.Root == "" || x.index.Root != root {
+		return false
+	}
+	for rel, entry := range x.index.Entries {
+		fn(rel, entry)
+	}
+	return true
+}
+
+// BuiltAt retorna quando o índice atual foi gerado
+func (x *RootIndex) BuiltAt() time.Time {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	return x.index.BuiltAt
+}
+
+// Summary resume o índice atual
+func (x *RootIndex) Summary() IndexSummary {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	summary := IndexSummary{Root: x.index.Root, BuiltAt: x.index.BuiltAt}
+	for _, entry := range x.index.Entries {
+		if entry.Dir {
+			summary.Dirs++
+			continue
+		}
+		summary.Files++
+		summary.Bytes += entry.Size
+		if entry.SHA256 != "" {
+			summary.Hashed++
+		}
+	}
+	return summary
+}
+
+// indexRel caminho relativo de path na raiz indexada ("" para a própria raiz)
+func (x *RootIndex) indexRel(path string) (string, bool) {
+	if x.index.Root == "" {
+		return "", false
+	}
+	if filepath.Clean(path) == x.index.Root {
+		return "", true
+	}
+	rel, err := relPath(x.index.Root, path)
+	return rel, err == nil
+}
+
+// indexSplit separa o caminho relativo em diretório ("" na raiz) e nome
+func indexSplit(rel string) (string, string) {
+	i := strings.LastIndexByte(rel, '/')
+	if i < 0 {
+		return "", rel
+	}
+	return rel[:i], rel[i+1:]
+}
+
+// buildUsage soma cada item em todos os diretórios acima dele; chamado com
+// x.mu travado para escrita
+func (x *RootIndex) buildUsage() *indexUsage {
+	usage := &indexUsage{dirs: map[string]*DirUsage{"": {}}, children: make(map[string][]string)}
+	for rel, entry := range x.index.Entries {
+		if entry.Dir && usage.dirs[rel] == nil {
+			usage.dirs[rel] = &DirUsage{}
+		}
+		parent, name := indexSplit(rel)
+		usage.children[parent] = append(usage.children[parent], name)
+		for dir := parent; ; dir, _ = indexSplit(dir) {
+			total := usage.dirs[dir]
+			if total == nil {
+				total = &DirUsage{}
+				usage.dirs[dir] = total
+			}
+			if entry.Dir {
+				total.Dirs++
+			} else {
+				total.Files++
+				total.Bytes += entry.Size
+			}
+			if dir == "" {
+				break
+			}
+		}
+	}
+	return usage
+}
+
+// DirTotal retorna os totais recursivos do diretório path, se ele estiver
+// na raiz indexada
+func (x *RootIndex) DirTotal(path string) (DirUsage, bool) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	rel, ok := x.indexRel(path)
+	if !ok {
+		return DirUsage{}, false
+	}
+	if x.usage == nil {
+		x.usage = x.buildUsage()
+	}
+	total, ok := x.usage.dirs[rel]
+	if !ok {
+		return DirUsage{}, false
+	}
+	return *total, true
+}
+
+// Usage retorna os totais do diretório path e de cada item dentro dele
+func (x *RootIndex) Usage(path string) (DiskUsageReport, bool) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	rel, ok := x.indexRel(path)
+	if !ok {
+		return DiskUsageReport{}, false
+	}
+	if x.usage == nil {
+		x.usage = x.buildUsage()
+	}
+	total, ok := x.usage.dirs[rel]
+	if !ok {
+		return DiskUsageReport{}, false
+	}
+
+	report := DiskUsageReport{Source: "index", ComputedAt: x.index.BuiltAt, DirUsage: *total}
+	for _, name := range x.usage.children[rel] {
+		child := name
+		if rel != "" {
+			child = rel + "/" + name
+		}
+		entry := DiskUsageEntry{Name: name, IsDir: x.index.Entries[child].Dir}
+		if entry.IsDir {
+			entry.DirUsage = *x.usage.dirs[child]
+		} else {
+			entry.Files, entry.Bytes = 1, x.index.Entries[child].Size
+		}
+		report.Entries = append(report.Entries, entry)
+	}
+	return report, true
+}
+
+// handleAdminIndex informa o estado do índice da raiz
+func (s *Server) handleAdminIndex(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.rootIndex.Summary())
+}
+
+// relPath converte o caminho no disco em caminho relativo à raiz
+func relPath(root, path string) (string, error) {
+	rel, err := filepath.Rel(root, path)
+	if err != nil || rel == "." || !isWithin(root, path) {
+		return "", fmt.Errorf("%s is outside the root", path)
+	}
+	return filepath.ToSlash(rel), nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRootIndexBuild(t *testing.T) {
+	root := t.TempDir()
+	writeTestFile(t, filepath.Join(root, "a.txt"), "hello")
+	writeTestFile(t, filepath.Join(root, "sub", "b.txt"), "world!")
+	writeTestFile(t, filepath.Join(root, ".git", "HEAD"), "ref")
+
+	logger, _ := NewLogger(&LoggingConfig{Enabled: false})
+	file := filepath.Join(t.TempDir(), "index.json")
+	index := NewRootIndex(&IndexConfig{Enabled: true, File: file, Hash: true}, logger)
+
+	summary, err := index.Build(root)
+	if err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+	if summary.Files != 2 || summary.Dirs != 1 || summary.Bytes != 11 || summary.Hashed != 2 {
+		t.Errorf("Expected 2 files, 1 dir, 11 bytes, 2 hashed, got %+v", summary)
+	}
+
+	path := filepath.Join(root, "a.txt")
+	info, _ := os.Stat(path)
+	want, _ := hashFile(path)
+	if sum, err := index.Sum(path, info); err != nil || sum != want {
+		t.Errorf("Expected %s, got %s (%v)", want, sum, err)
+	}
+
+	// The index is persisted and reloaded on the next start
+	reloaded := NewRootIndex(&IndexConfig{Enabled: true, File: file, Hash: true}, logger)
+	if entry, ok := reloaded.Lookup(path, info); !ok || entry.SHA256 != want {
+		t.Errorf("Expected reloaded entry with hash %s, got %+v", want, entry)
+	}
+}
+
+func TestRootIndexStaleEntry(t *testing.T) {
+	root := t.TempDir()
+	path := filepath.Join(root, "a.txt")
+	writeTestFile(t, path, "hello")
+
+	logger, _ := NewLogger(&LoggingConfig{Enabled: false})
+	index := NewRootIndex(&IndexConfig{Enabled: true, File: filepath.Join(t.TempDir(), "index.json"), Hash: true}, logger)
+	if _, err := index.Build(root); err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+
+	// A changed file no longer matches its entry and is hashed again
+	writeTestFile(t, path, "hello, world")
+	info, _ := os.Stat(path)
+	if _, ok := index.Lookup(path, info); ok {
+		t.Error("Expected stale entry to be ignored")
+	}
+	want, _ := hashFile(path)
+	if sum, _ := index.Sum(path, info); sum != want {
+		t.Errorf("Expected %s, got %s", want, sum)
+	}
+
+	// Without an index, Sum reads the file
+	var disabled *RootIndex
+	if sum, _ := disabled.Sum(path, info); sum != want {
+		t.Errorf("Expected %s, got %s", want, sum)
+	}
+}
@@ -0,0 +1,339 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Manifest lista os arquivos esperados e seus hashes SHA-256
+type Manifest struct {
+	Version int               `json:"version"`
+	Files   map[string]string `json:"files"` // caminho relativo (com "/") -> sha256 em hex
+}
+
+// IntegrityReport resultado de uma verificação completa
+type IntegrityReport struct {
+	RootDir  string   `json:"root_dir"`
+	Checked  int      `json:"checked"`
+	Missing  []string `json:"missing,omitempty"`
+	Modified []string `json:"modified,omitempty"`
+	Unlisted []string `json:"unlisted,omitempty"`
+}
+
+// OK indica se o conteúdo confere com o manifesto
+func (r *IntegrityReport) OK(allowUnlisted bool) bool {
+	return len(r.Missing) == 0 && len(r.Modified) == 0 && (allowUnlisted || len(r.Unlisted) == 0)
+}
+
+// Err descreve as divergências encontradas
+func (r *IntegrityReport) Err() error {
+	return fmt.Errorf("content does not match manifest: %d missing, %d modified, %d unlisted",
+		len(r.Missing), len(r.Modified), len(r.Unlisted))
+}
+
+// IntegrityVerifier verifica o conteúdo servido contra um manifesto assinado
+type IntegrityVerifier struct {
+	config    *IntegrityConfig
+	publicKey ed25519.PublicKey
+	logger    *Logger
+	index     *RootIndex // índice da raiz (opcional), evita reler arquivos já indexados
+
+	mu        sync.Mutex
+	manifests map[string]*Manifest // por diretório raiz
+	verified  map[string]fileStamp // hashes já conferidos por caminho absoluto
+}
+
+// fileStamp identifica uma versão de arquivo já verificada
+type fileStamp struct {
+	size    int64
+	modTime time.Time
+	ok      bool
+}
+
+// NewIntegrityVerifier cria um verificador a partir da configuração
+func NewIntegrityVerifier(config *IntegrityConfig, logger *Logger) (*IntegrityVerifier, error) {
+	key, err := base64.StdEncoding.DecodeString(config.PublicKey)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid integrity public_key: expected base64 ed25519 public key")
+	}
+	return &IntegrityVerifier{
+		config:    config,
+		publicKey: ed25519.PublicKey(key),
+		logger:    logger,
+		manifests: make(map[string]*Manifest),
+		verified:  make(map[string]fileStamp),
+	}, nil
+}
+
+// manifestName retorna o caminho do manifesto relativo à raiz
+func (v *IntegrityVerifier) manifestName() string {
+	if v.config.Manifest == "" {
+		return ".qserv-manifest.json"
+	}
+	return v.config.Manifest
+}
+
+// refuse indica se conteúdo divergente deve ser recusado (e não apenas sinalizado)
+func (v *IntegrityVerifier) refuse() bool {
+	return v.config.Mode != "flag"
+}
+
+// loadManifest lê e valida a assinatura do manifesto de uma raiz
+func (v *IntegrityVerifier) loadManifest(root string) (*Manifest, error) {
+	v.mu.Lock()
+	if manifest, ok := v.manifests[root]; ok {
+		v.mu.Unlock()
+		return manifest, nil
+	}
+	v.mu.Unlock()
+
+	manifestPath := filepath.Join(root, v.manifestName())
+	data, err := os.ReadFile(manifestPath)
+	if err != nil {
+		return nil, fmt.Errorf("reading manifest: %w", err)
+	}
+
+	sigData, err := os.ReadFile(manifestPath + ".sig")
+	if err != nil {
+		return nil, fmt.Errorf("reading manifest signature: %w", err)
+	}
+	signature, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(sigData)))
+	if err != nil {
+		return nil, fmt.Errorf("decoding manifest signature: %w", err)
+	}
+	if !ed25519.Verify(v.publicKey, data, signature) {
+		return nil, fmt.Errorf("manifest signature verification failed")
+	}
+
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("parsing manifest: %w", err)
+	}
+
+	v.mu.Lock()
+	// Mantém apenas os manifestos da raiz atual e da anterior (em drenagem)
+	if len(v.manifests) >= 2 {
+		v.manifests = make(map[string]*Manifest)
+		v.verified = make(map[string]fileStamp)
+	}
+	v.manifests[root] = &manifest
+	v.mu.Unlock()
+
+	return &manifest, nil
+}
+
+// isManifestFile indica se o caminho relativo é o manifesto ou sua assinatura
+func (v *IntegrityVerifier) isManifestFile(rel string) bool {
+	name := filepath.ToSlash(v.manifestName())
+	return rel == name || rel == name+".sig"
+}
+
+// VerifyRoot confere todos os arquivos de uma raiz contra o manifesto
+func (v *IntegrityVerifier) VerifyRoot(root string) (*IntegrityReport, error) {
+	manifest, err := v.loadManifest(root)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &IntegrityReport{RootDir: root}
+	seen := make(map[string]bool, len(manifest.Files))
+
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		rel, _ := filepath.Rel(root, path)
+		rel = filepath.ToSlash(rel)
+		if v.isManifestFile(rel) {
+			return nil
+		}
+
+		expected, listed := manifest.Files[rel]
+		if !listed {
+			report.Unlisted = append(report.Unlisted, rel)
+			return nil
+		}
+		seen[rel] = true
+		report.Checked++
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		sum, err := v.index.Sum(path, info)
+		if err != nil {
+			return err
+		}
+		if !strings.EqualFold(sum, expected) {
+			report.Modified = append(report.Modified, rel)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for rel := range manifest.Files {
+		if !seen[rel] {
+			report.Missing = append(report.Missing, rel)
+		}
+	}
+	sort.Strings(report.Missing)
+
+	return report, nil
+}
+
+// Check verifica (com cache por tamanho/mtime) um arquivo prestes a ser servido
+func (v *IntegrityVerifier) Check(root, path string, info os.FileInfo) bool {
+	manifest, err := v.loadManifest(root)
+	if err != nil {
+		v.logger.Error("Integrity: %v", err)
+		return !v.refuse()
+	}
+
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return !v.refuse()
+	}
+	rel = filepath.ToSlash(rel)
+
+	expected, listed := manifest.Files[rel]
+	if !listed {
+		if v.config.AllowUnlisted || v.isManifestFile(rel) {
+			return true
+		}
+		v.logger.Warn("Integrity: file not in manifest: %s", rel)
+		return !v.refuse()
+	}
+
+	v.mu.Lock()
+	stamp, cached := v.verified[path]
+	v.mu.Unlock()
+	if cached && stamp.size == info.Size() && stamp.modTime.Equal(info.ModTime()) {
+		return stamp.ok || !v.refuse()
+	}
+
+	sum, err := v.index.Sum(path, info)
+	ok := err == nil && strings.EqualFold(sum, expected)
+	if !ok {
+		v.logger.Error("Integrity: content of %s does not match manifest", rel)
+	}
+
+	v.mu.Lock()
+	v.verified[path] = fileStamp{size: info.Size(), modTime: info.ModTime(), ok: ok}
+	v.mu.Unlock()
+
+	return ok || !v.refuse()
+}
+
+// CheckRoot verifica uma raiz antes de ela ser servida. No modo flag as
+// divergências são apenas registradas no log.
+func (v *IntegrityVerifier) CheckRoot(root string) error {
+	report, err := v.VerifyRoot(root)
+	if err == nil && !report.OK(v.config.AllowUnlisted) {
+		for _, rel := range report.Modified {
+			v.logger.Warn("Integrity: modified: %s", rel)
+		}
+		for _, rel := range report.Missing {
+			v.logger.Warn("Integrity: missing: %s", rel)
+		}
+		err = report.Err()
+	}
+	if err != nil {
+		if v.refuse() {
+			return err
+		}
+		v.logger.Warn("Integrity check of %s failed: %v", root, err)
+		return nil
+	}
+
+	v.logger.Info("Integrity: %d files verified in %s", report.Checked, root)
+	return nil
+}
+
+// handleAdminVerify executa uma verificação completa da raiz ativa
+func (s *Server) handleAdminVerify(w http.ResponseWriter, r *http.Request) {
+	report, err := s.integrity.VerifyRoot(s.RootDir())
+	if err != nil {
+		writeJSONError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	status := http.StatusOK
+	if !report.OK(s.config.Integrity.AllowUnlisted) {
+		status = http.StatusConflict
+	}
+	writeJSON(w, status, report)
+}
+
+// GenerateManifest gera o manifesto de um diretório e, se uma chave privada
+// for informada, grava também a assinatura
+func GenerateManifest(root, name string, privateKey ed25519.PrivateKey) error {
+	manifest := Manifest{Version: 1, Files: make(map[string]string)}
+	sigName := filepath.ToSlash(name) + ".sig"
+
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, _ := filepath.Rel(root, path)
+		rel = filepath.ToSlash(rel)
+		if rel == filepath.ToSlash(name) || rel == sigName {
+			return nil
+		}
+		sum, err := hashFile(path)
+		if err != nil {
+			return err
+		}
+		manifest.Files[rel] = sum
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	manifestPath := filepath.Join(root, name)
+	if err := os.WriteFile(manifestPath, data, 0644); err != nil {
+		return err
+	}
+
+	if privateKey != nil {
+		signature := base64.StdEncoding.EncodeToString(ed25519.Sign(privateKey, data))
+		return os.WriteFile(manifestPath+".sig", []byte(signature+"\n"), 0644)
+	}
+	return nil
+}
+
+// hashFile calcula o SHA-256 de um arquivo
+func hashFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// newSignedRoot creates a directory with a signed manifest and returns the public key
+func newSignedRoot(t *testing.T, files map[string]string) (string, string, ed25519.PrivateKey) {
+	t.Helper()
+
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+
+	root := t.TempDir()
+	for name, content := range files {
+		writeTestFile(t, filepath.Join(root, name), content)
+	}
+	if err := GenerateManifest(root, ".qserv-manifest.json", privateKey); err != nil {
+		t.Fatalf("Failed to generate manifest: %v", err)
+	}
+
+	return root, base64.StdEncoding.EncodeToString(publicKey), privateKey
+}
+
+func TestIntegrityVerifyRoot(t *testing.T) {
+	root, publicKey, _ := newSignedRoot(t, map[string]string{"index.html": "home", "js/app.js": "app"})
+
+	logger, _ := NewLogger(&LoggingConfig{Enabled: false})
+	verifier, err := NewIntegrityVerifier(&IntegrityConfig{Enabled: true, PublicKey: publicKey}, logger)
+	if err != nil {
+		t.Fatalf("Failed to create verifier: %v", err)
+	}
+
+	report, err := verifier.VerifyRoot(root)
+	if err != nil {
+		t.Fatalf("Verification failed: %v", err)
+	}
+	if !report.OK(false) || report.Checked != 2 {
+		t.Errorf("Expected clean report with 2 files, got %+v", report)
+	}
+
+	// Tamper with content, add an unlisted file and remove a listed one
+	os.WriteFile(filepath.Join(root, "index.html"), []byte("hacked"), 0644)
+	os.WriteFile(filepath.Join(root, "extra.js"), []byte("evil"), 0644)
+	os.Remove(filepath.Join(root, "js", "app.js"))
+
+	report, _ = verifier.VerifyRoot(root)
+	if len(report.Modified) != 1 || report.Modified[0] != "index.html" {
+		t.Errorf("Expected index.html modified, got %v", report.Modified)
+	}
+	if len(report.Unlisted) != 1 || report.Unlisted[0] != "extra.js" {
+		t.Errorf("Expected extra.js unlisted, got %v", report.Unlisted)
+	}
+	if len(report.Missing) != 1 || report.Missing[0] != "js/app.js" {
+		t.Errorf("Expected js/app.js missing, got %v", report.Missing)
+	}
+}
+
+func TestIntegrityRejectsBadSignature(t *testing.T) {
+	root, publicKey, _ := newSignedRoot(t, map[string]string{"index.html": "home"})
+
+	// Rewrite the manifest without updating the signature
+	manifestPath := filepath.Join(root, ".qserv-manifest.json")
+	os.WriteFile(manifestPath, []byte(`{"version":1,"files":{}}`), 0644)
+
+	logger, _ := NewLogger(&LoggingConfig{Enabled: false})
+	verifier, _ := NewIntegrityVerifier(&IntegrityConfig{Enabled: true, PublicKey: publicKey}, logger)
+
+	if _, err := verifier.VerifyRoot(root); err == nil {
+		t.Errorf("Expected signature verification error")
+	}
+}
+
+func TestIntegrityVerifyOnRequest(t *testing.T) {
+	root, publicKey, _ := newSignedRoot(t, map[string]string{"app.txt": "original"})
+
+	for _, mode := range []string{"refuse", "flag"} {
+		t.Run(mode, func(t *testing.T) {
+			config := DefaultConfig()
+			config.Server.RootDir = root
+			config.Integrity = &IntegrityConfig{Enabled: true, PublicKey: publicKey, Mode: mode, VerifyOnRequest: true}
+			logger, _ := NewLogger(&LoggingConfig{Enabled: false})
+			server := NewServer(config, logger)
+			server.setupHandlers()
+
+			os.WriteFile(filepath.Join(root, "app.txt"), []byte("tampered"), 0644)
+
+			w := httptest.NewRecorder()
+			server.mux.ServeHTTP(w, httptest.NewRequest("GET", "/app.txt", nil))
+
+			expected := http.StatusInternalServerError
+			if mode == "flag" {
+				expected = http.StatusOK
+			}
+			if w.Code != expected {
+				t.Errorf("Expected status %d in %s mode, got %d", expected, mode, w.Code)
+			}
+		})
+	}
+}
+
+func TestIntegrityBlocksTamperedSwap(t *testing.T) {
+	current, publicKey, privateKey := newSignedRoot(t, map[string]string{"app.txt": "v1"})
+
+	next := t.TempDir()
+	writeTestFile(t, filepath.Join(next, "app.txt"), "v2")
+	GenerateManifest(next, ".qserv-manifest.json", privateKey)
+	os.WriteFile(filepath.Join(next, "app.txt"), []byte("tampered"), 0644)
+
+	config := DefaultConfig()
+	config.Server.RootDir = current
+	config.Integrity = &IntegrityConfig{Enabled: true, PublicKey: publicKey}
+	logger, _ := NewLogger(&LoggingConfig{Enabled: false})
+	server := NewServer(config, logger)
+	before := server.RootDir()
+
+	if _, _, err := server.SwapRoot(next); err == nil {
+		t.Errorf("Expected swap to a tampered root to fail")
+	}
+	if server.RootDir() != before {
+		t.Errorf("Root should not change after a refused swap")
+	}
+}
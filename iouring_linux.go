@@ -0,0 +1,323 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"unsafe"
+)
+
+// Chamadas e constantes do io_uring (mesmos números em todas as arquiteturas)
+const (
+	sysIOURingSetup    = 425
+	sysIOURingEnter    = 426
+	sysIOURingRegister = 427
+
+	ioringOffSQRing = 0
+	ioringOffCQRing = 0x8000000
+	ioringOffSQEs   = 0x10000000
+
+	ioringOpOpenat = 18
+	ioringOpClose  = 19
+	ioringOpRead   = 22
+
+	iosqeFixedFile = 1 << 0
+	iosqeIOLink    = 1 << 2
+	iosqeHardlink  = 1 << 3
+
+	ioringEnterGetEvents = 1 << 0
+	ioringRegisterFiles  = 2
+
+	atFDCWD = -100
+)
+
+// ioURingParams struct io_uring_params
+type ioURingParams struct {
+	sqEntries    uint32
+	cqEntries    uint32
+	flags        uint32
+	sqThreadCPU  uint32
+	sqThreadIdle uint32
+	features     uint32
+	wqFD         uint32
+	resv         [3]uint32
+	sqOff        struct {
+		head, tail, ringMask, ringEntries, flags, dropped, array, resv1 uint32
+		userAddr                                                        uint64
+	}
+	cqOff struct {
+		head, tail, ringMask, ringEntries, overflow, cqes, flags, resv1 uint32
+		userAddr                                                        uint64
+	}
+}
+
+// ioURingSQE struct io_uring_sqe (64 bytes)
+type ioURingSQE struct {
+	opcode      uint8
+	flags       uint8
+	ioprio      uint16
+	fd          int32
+	off         uint64
+	addr        uint64
+	len         uint32
+	opFlags     uint32
+	userData    uint64
+	bufIndex    uint16
+	personality uint16
+	fileIndex   uint32
+	addr3       uint64
+	pad         uint64
+}
+
+// ioURingCQE struct io_uring_cqe (16 bytes)
+type ioURingCQE struct {
+	userData uint64
+	res      int32
+	flags    uint32
+}
+
+// ioRing um anel usado de forma síncrona: cada leitura envia abrir, ler e
+// fechar encadeados numa única io_uring_enter e espera as três conclusões
+type ioRing struct {
+	mu     sync.Mutex
+	broken bool // envio interrompido: o estado da fila é incerto
+	fd     int
+	sqRing []byte
+	cqRing []byte
+	sqes   []byte
+
+	sqTail, sqMask         *uint32
+	sqArray                unsafe.Pointer
+	cqHead, cqTail, cqMask *uint32
+	cqes                   unsafe.Pointer
+	sqeBase                unsafe.Pointer
+}
+
+// IOURing leitura de arquivos pequenos por io_uring (experimental): abrir,
+// ler e fechar custam uma chamada ao kernel em vez de quatro ou mais
+type IOURing struct {
+	config    *IOURingConfig
+	rings     []*ioRing
+	next      atomic.Uint64
+	reads     atomic.Int64
+	fallbacks atomic.Int64 // erros que voltaram ao caminho padrão
+}
+
+// errIOURingBroken anel desativado após uma falha no envio
+var errIOURingBroken = errors.New("io_uring: ring disabled after a submission error")
+
+// NewIOURing cria os anéis; falha se o kernel não suportar io_uring ou
+// descritores diretos (Linux 5.15+) ou se ele estiver bloqueado (seccomp)
+func NewIOURing(config *IOURingConfig) (*IOURing, error) {
+	n := config.Rings
+	if n <= 0 {
+		n = runtime.GOMAXPROCS(0)
+	}
+	u := &IOURing{config: config}
+	for i := 0; i < n; i++ {
+		ring, err := newIORing(config.entries())
+		if err != nil {
+			u.Close()
+			return nil, err
+		}
+		u.rings = append(u.rings, ring)
+	}
+	// Confere o suporte a abrir e fechar descritores diretos
+	ring := u.rings[0]
+	ring.mu.Lock()
+	_, err := ring.readFile("/proc/self/stat", 0)
+	ring.mu.Unlock()
+	if err != nil {
+		u.Close()
+		return nil, fmt.Errorf("io_uring: direct descriptors unsupported: %w", err)
+	}
+	return u, nil
+}
+
+// entries retorna o tamanho de cada anel
+func (c *IOURingConfig) entries() uint32 {
+	if c.Entries <= 0 {
+		return 64
+	}
+	return uint32(c.Entries)
+}
+
+// maxFileSize retorna o maior arquivo lido por io_uring
+func (c *IOURingConfig) maxFileSize() int64 {
+	if c.MaxFileSize <= 0 {
+		return 64 * 1024
+	}
+	return c.MaxFileSize
+}
+
+func newIORing(entries uint32) (*ioRing, error) {
+	var p ioURingParams
+	fd, _, errno := syscall.Syscall(sysIOURingSetup, uintptr(entries), uintptr(unsafe.Pointer(&p)), 0)
+	if errno != 0 {
+		return nil, fmt.Errorf("io_uring_setup: %w", errno)
+	}
+	r := &ioRing{fd: int(fd)}
+
+	var err error
+	sqSize := int(p.sqOff.array + p.sqEntries*4)
+	if r.sqRing, err = syscall.Mmap(r.fd, ioringOffSQRing, sqSize, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED|syscall.MAP_POPULATE); err != nil {
+		r.close()
+		return nil, fmt.Errorf("io_uring mmap: %w", err)
+	}
+	cqSize := int(p.cqOff.cqes + p.cqEntries*uint32(unsafe.Sizeof(ioURingCQE{})))
+	if r.cqRing, err = syscall.Mmap(r.fd, ioringOffCQRing, cqSize, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED|syscall.MAP_POPULATE); err != nil {
+		r.close()
+		return nil, fmt.Errorf("io_uring mmap: %w", err)
+	}
+	sqeSize := int(p.sqEntries) * int(unsafe.Sizeof(ioURingSQE{}))
+	if r.sqes, err = syscall.Mmap(r.fd, ioringOffSQEs, sqeSize, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED|syscall.MAP_POPULATE); err != nil {
+		r.close()
+		return nil, fmt.Errorf("io_uring mmap: %w", err)
+	}
+
+	sq := unsafe.Pointer(&r.sqRing[0])
+	r.sqTail = (*uint32)(unsafe.Add(sq, p.sqOff.tail))
+	r.sqMask = (*uint32)(unsafe.Add(sq, p.sqOff.ringMask))
+	r.sqArray = unsafe.Add(sq, p.sqOff.array)
+	cq := unsafe.Pointer(&r.cqRing[0])
+	r.cqHead = (*uint32)(unsafe.Add(cq, p.cqOff.head))
+	r.cqTail = (*uint32)(unsafe.Add(cq, p.cqOff.tail))
+	r.cqMask = (*uint32)(unsafe.Add(cq, p.cqOff.ringMask))
+	r.cqes = unsafe.Add(cq, p.cqOff.cqes)
+	r.sqeBase = unsafe.Pointer(&r.sqes[0])
+
+	// Uma vaga de descritor direto: o anel é usado por uma leitura de cada vez
+	files := []int32{-1}
+	if _, _, errno := syscall.Syscall6(sysIOURingRegister, uintptr(r.fd), ioringRegisterFiles, uintptr(unsafe.Pointer(&files[0])), 1, 0, 0); errno != 0 {
+		r.close()
+		return nil, fmt.Errorf("io_uring_register: %w", errno)
+	}
+	return r, nil
+}
+
+// push coloca uma SQE na fila de envio
+func (r *ioRing) push(sqe ioURingSQE) {
+	tail := atomic.LoadUint32(r.sqTail)
+	index := tail & *r.sqMask
+	*(*ioURingSQE)(unsafe.Add(r.sqeBase, uintptr(index)*unsafe.Sizeof(sqe))) = sqe
+	*(*uint32)(unsafe.Add(r.sqArray, uintptr(index)*4)) = index
+	atomic.StoreUint32(r.sqTail, tail+1)
+}
+
+// readFile lê os primeiros size bytes de path (abrir, ler e fechar
+// encadeados); retorna o erro da primeira operação que falhar. Chamado com
+// r.mu travado
+func (r *ioRing) readFile(path string, size int64) ([]byte, error) {
+	name, err := syscall.BytePtrFromString(path)
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, size)
+
+	r.push(ioURingSQE{opcode: ioringOpOpenat, flags: iosqeIOLink, fd: atFDCWD,
+		addr: uint64(uintptr(unsafe.Pointer(name))), opFlags: syscall.O_RDONLY, fileIndex: 1, userData: 0})
+	var bufAddr uint64
+	if size > 0 {
+		bufAddr = uint64(uintptr(unsafe.Pointer(&buf[0])))
+	}
+	// Hardlink: o fechamento acontece mesmo se a leitura falhar
+	r.push(ioURingSQE{opcode: ioringOpRead, flags: iosqeFixedFile | iosqeHardlink, fd: 0,
+		addr: bufAddr, len: uint32(size), userData: 1})
+	r.push(ioURingSQE{opcode: ioringOpClose, fileIndex: 1, userData: 2})
+
+	for submitted := 0; submitted < 3; {
+		n, _, errno := syscall.Syscall6(sysIOURingEnter, uintptr(r.fd), uintptr(3-submitted), uintptr(3-submitted), ioringEnterGetEvents, 0, 0)
+		if errno == syscall.EINTR {
+			continue
+		}
+		if errno != 0 {
+			r.broken = true
+			return nil, fmt.Errorf("io_uring_enter: %w", errno)
+		}
+		submitted += int(n)
+	}
+
+	var results [3]int32
+	for seen := 0; seen < 3; {
+		head := atomic.LoadUint32(r.cqHead)
+		if head == atomic.LoadUint32(r.cqTail) {
+			if _, _, errno := syscall.Syscall6(sysIOURingEnter, uintptr(r.fd), 0, 1, ioringEnterGetEvents, 0, 0); errno != 0 && errno != syscall.EINTR {
+				r.broken = true
+				return nil, fmt.Errorf("io_uring_enter: %w", errno)
+			}
+			continue
+		}
+		cqe := (*ioURingCQE)(unsafe.Add(r.cqes, uintptr(head&*r.cqMask)*unsafe.Sizeof(ioURingCQE{})))
+		results[cqe.userData] = cqe.res
+		atomic.StoreUint32(r.cqHead, head+1)
+		seen++
+	}
+	runtime.KeepAlive(name)
+	runtime.KeepAlive(buf)
+
+	for _, res := range results[:2] {
+		if res < 0 {
+			return nil, syscall.Errno(-res)
+		}
+	}
+	if int64(results[1]) != size {
+		return nil, fmt.Errorf("io_uring: short read of %s (%d of %d bytes)", path, results[1], size)
+	}
+	return buf, nil
+}
+
+func (r *ioRing) close() {
+	for _, m := range [][]byte{r.sqRing, r.cqRing, r.sqes} {
+		if m != nil {
+			syscall.Munmap(m)
+		}
+	}
+	syscall.Close(r.fd)
+}
+
+// ReadFile lê um arquivo de até max_file_size bytes no primeiro anel livre
+func (u *IOURing) ReadFile(path string, size int64) ([]byte, error) {
+	n := uint64(len(u.rings))
+	start := u.next.Add(1)
+	ring := u.rings[start%n]
+	locked := false
+	for i := uint64(0); i < n && !locked; i++ {
+		if r := u.rings[(start+i)%n]; r.mu.TryLock() {
+			ring, locked = r, true
+		}
+	}
+	if !locked {
+		ring.mu.Lock()
+	}
+	var data []byte
+	err := errIOURingBroken
+	if !ring.broken {
+		data, err = ring.readFile(path, size)
+	}
+	ring.mu.Unlock()
+
+	if err != nil {
+		u.fallbacks.Add(1)
+		return nil, err
+	}
+	u.reads.Add(1)
+	return data, nil
+}
+
+// WriteMetrics exporta leituras por io_uring e as que voltaram ao caminho padrão
+func (u *IOURing) WriteMetrics(w io.Writer) {
+	writeMetric(w, "qserv_io_uring_reads_total", "Files read through io_uring.", "counter", []metricSample{{value: float64(u.reads.Load())}})
+	writeMetric(w, "qserv_io_uring_fallbacks_total", "io_uring reads that failed and were served through the standard path.", "counter", []metricSample{{value: float64(u.fallbacks.Load())}})
+}
+
+// Close libera os anéis
+func (u *IOURing) Close() {
+	for _, ring := range u.rings {
+		ring.close()
+	}
+	u.rings = nil
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func newTestIOURing(tb testing.TB, config *IOURingConfig) *IOURing {
+	tb.Helper()
+	u, err := NewIOURing(config)
+	if err != nil {
+		tb.Skipf("io_uring unavailable: %v", err)
+	}
+	tb.Cleanup(u.Close)
+	return u
+}
+
+func TestIOURingReadFile(t *testing.T) {
+	u := newTestIOURing(t, &IOURingConfig{Enabled: true, Rings: 2})
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "tile.png"), "tile data")
+	writeTestFile(t, filepath.Join(dir, "empty.txt"), "")
+
+	data, err := u.ReadFile(filepath.Join(dir, "tile.png"), 9)
+	if err != nil || string(data) != "tile data" {
+		t.Errorf("Expected %q, got %q (%v)", "tile data", data, err)
+	}
+	if data, err := u.ReadFile(filepath.Join(dir, "empty.txt"), 0); err != nil || len(data) != 0 {
+		t.Errorf("Expected empty file, got %q (%v)", data, err)
+	}
+
+	// The file changed size since stat: reported instead of serving a partial body
+	if _, err := u.ReadFile(filepath.Join(dir, "tile.png"), 20); err == nil {
+		t.Error("Expected error on short read")
+	}
+	if _, err := u.ReadFile(filepath.Join(dir, "missing.png"), 4); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Expected not-exist error, got %v", err)
+	}
+
+	// The ring still works after failed reads
+	if data, err := u.ReadFile(filepath.Join(dir, "tile.png"), 9); err != nil || string(data) != "tile data" {
+		t.Errorf("Expected ring to recover, got %q (%v)", data, err)
+	}
+	if u.reads.Load() != 3 || u.fallbacks.Load() != 2 {
+		t.Errorf("Expected 3 reads and 2 fallbacks, got %d and %d", u.reads.Load(), u.fallbacks.Load())
+	}
+}
+
+func TestIOURingConcurrent(t *testing.T) {
+	u := newTestIOURing(t, &IOURingConfig{Enabled: true, Rings: 2, Entries: 8})
+	dir := t.TempDir()
+	for i := 0; i < 50; i++ {
+		writeTestFile(t, filepath.Join(dir, fmt.Sprintf("%d.txt", i)), strings.Repeat("x", i))
+	}
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				data, err := u.ReadFile(filepath.Join(dir, fmt.Sprintf("%d.txt", i)), int64(i))
+				if err != nil || len(data) != i {
+					t.Errorf("File %d: expected %d bytes, got %d (%v)", i, i, len(data), err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestIOURingServeFile(t *testing.T) {
+	newTestIOURing(t, &IOURingConfig{Enabled: true})
+	root := t.TempDir()
+	writeTestFile(t, filepath.Join(root, "small.txt"), "small file")
+	writeTestFile(t, filepath.Join(root, "large.txt"), strings.Repeat("y", 2048))
+
+	server := newListingTestServer(t, root, func(c *Config) {
+		c.Performance.IOURing = &IOURingConfig{Enabled: true, MaxFileSize: 1024}
+	})
+	if server.uring == nil {
+		t.Fatal("Expected io_uring to be enabled")
+	}
+
+	for _, tt := range []struct {
+		path string
+		size int
+	}{
+		{"/small.txt", 10},
+		{"/large.txt", 2048},
+	} {
+		w := httptest.NewRecorder()
+		server.mux.ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+		if w.Code != http.StatusOK || w.Body.Len() != tt.size {
+			t.Errorf("%s: expected 200 with %d bytes, got %d with %d", tt.path, tt.size, w.Code, w.Body.Len())
+		}
+	}
+	if server.uring.reads.Load() != 1 {
+		t.Errorf("Expected only the small file through io_uring, got %d reads", server.uring.reads.Load())
+	}
+
+	// Ranges still work
+	req := httptest.NewRequest("GET", "/small.txt", nil)
+	req.Header.Set("Range", "bytes=0-4")
+	w := httptest.NewRecorder()
+	server.mux.ServeHTTP(w, req)
+	if w.Code != http.StatusPartialContent || w.Body.String() != "small" {
+		t.Errorf("Expected 206 %q, got %d %q", "small", w.Code, w.Body.String())
+	}
+}
+
+// benchmarkSmallFiles serves 1000 small tiles through the handler chain
+func benchmarkSmallFiles(b *testing.B, configure func(c *Config)) {
+	root := b.TempDir()
+	for i := 0; i < 1000; i++ {
+		if err := os.WriteFile(filepath.Join(root, fmt.Sprintf("%d.png", i)), make([]byte, 700), 0644); err != nil {
+			b.Fatal(err)
+		}
+	}
+	server := newListingTestServer(b, root, configure)
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			w := httptest.NewRecorder()
+			server.mux.ServeHTTP(w, httptest.NewRequest("GET", fmt.Sprintf("/%d.png", i%1000), nil))
+			if w.Code != http.StatusOK {
+				b.Fatalf("Expected 200, got %d", w.Code)
+			}
+			i++
+		}
+	})
+}
+
+func BenchmarkSmallFileStandard(b *testing.B) {
+	benchmarkSmallFiles(b, func(c *Config) {})
+}
+
+func BenchmarkSmallFileIOURing(b *testing.B) {
+	newTestIOURing(b, &IOURingConfig{Enabled: true})
+	benchmarkSmallFiles(b, func(c *Config) {
+		c.Performance.IOURing = &IOURingConfig{Enabled: true}
+	})
+}
@@ -0,0 +1,29 @@
+//go:build !linux
+
+package main
+
+import (
+	"errors"
+	"io"
+)
+
+// IOURing só existe no Linux
+type IOURing struct{}
+
+// NewIOURing recusa a configuração fora do Linux
+func NewIOURing(config *IOURingConfig) (*IOURing, error) {
+	return nil, errors.New("io_uring is only available on Linux")
+}
+
+func (c *IOURingConfig) maxFileSize() int64 {
+	return 0
+}
+
+// ReadFile nunca é chamado (NewIOURing falha)
+func (u *IOURing) ReadFile(path string, size int64) ([]byte, error) {
+	return nil, errors.New("io_uring is only available on Linux")
+}
+
+func (u *IOURing) WriteMetrics(w io.Writer) {}
+
+func (u *IOURing) Close() {}
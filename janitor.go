@@ -0,0 +1,228 @@
+package main
+
+import (
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// JanitorReport resultado de uma limpeza, por tipo de resíduo
+type JanitorReport struct {
+	Files    map[string]int   `json:"files"`
+	Bytes    map[string]int64 `json:"bytes"`
+	Duration string           `json:"duration"`
+}
+
+// Janitor remove periodicamente o que o servidor deixa para trás: cópias
+// pré-comprimidas e hashes de arquivos que não existem mais, arquivos de
+// download expirados, temporários de escritas interrompidas, partes de envios
+// abandonados e blobs de upload sem uso
+type Janitor struct {
+	config *JanitorConfig
+	server *Server
+
+	running sync.Mutex // serializa as limpezas
+	mu      sync.Mutex
+	runs    int64
+	files   map[string]int64 // tipo -> arquivos removidos
+	bytes   map[string]int64 // tipo -> bytes liberados
+}
+
+// NewJanitor cria o coletor
+func NewJanitor(config *JanitorConfig, server *Server) *Janitor {
+	return &Janitor{
+		config: config,
+		server: server,
+		files:  make(map[string]int64),
+		bytes:  make(map[string]int64),
+	}
+}
+
+// interval retorna o intervalo entre limpezas
+func (j *Janitor) interval() time.Duration {
+	if j.config.Interval <= 0 {
+		return time.Hour
+	}
+	return time.Duration(j.config.Interval) * time.Second
+}
+
+// tempAge retorna a idade a partir da qual temporários são considerados abandonados
+func (j *Janitor) tempAge() time.Duration {
+	if j.config.TempAge <= 0 {
+		return time.Hour
+	}
+	return time.Duration(j.config.TempAge) * time.Second
+}
+
+// Sweep executa uma limpeza completa
+func (j *Janitor) Sweep() *JanitorReport {
+	j.running.Lock()
+	defer j.running.Unlock()
+
+	start := time.Now()
+	report := &JanitorReport{Files: make(map[string]int), Bytes: make(map[string]int64)}
+	remove := func(kind, path string, info fs.FileInfo) {
+		size := info.Size()
+		var err error
+		if info.IsDir() {
+			size = dirSize(path)
+			err = os.RemoveAll(path)
+		} else {
+			err = os.Remove(path)
+		}
+		if err != nil {
+			j.server.logger.Warn("Janitor: failed to remove %s: %v", path, err)
+			return
+		}
+		report.Files[kind]++
+		report.Bytes[kind] += size
+	}
+
+	s := j.server
+	root := s.RootDir()
+	if s.precompress != nil {
+		j.sweepOrphans(s.precompress.dir, ".gz", root, func(path string, info fs.FileInfo) { remove("precompressed", path, info) })
+	}
+	if s.torrents != nil {
+		j.sweepOrphans(s.torrents.dir, ".digest.json", root, func(path string, info fs.FileInfo) { remove("torrent_digests", path, info) })
+	}
+	if s.zsync != nil {
+		j.sweepOrphans(s.zsync.dir, ".zsync", root, func(path string, info fs.FileInfo) { remove("zsync", path, info) })
+	}
+	if s.archives != nil {
+		j.sweepOlder(s.archives.spoolDir(), "qserv-archive-*.zip", s.archives.spoolTTL(), func(path string, info fs.FileInfo) { remove("archives", path, info) })
+		j.sweepOlder(s.archives.spoolDir(), ".qserv-archive-*", j.tempAge(), func(path string, info fs.FileInfo) { remove("temp", path, info) })
+	}
+	if s.deployer != nil {
+		j.sweepOlder(s.deployer.releasesDir(), ".tmp-*", j.tempAge(), func(path string, info fs.FileInfo) { remove("temp", path, info) })
+	}
+	if s.uploads != nil && s.uploads.chunks != nil {
+		s.uploads.chunks.Sweep(func(path string, info fs.FileInfo) { remove("chunks", path, info) })
+	}
+	if s.uploads != nil && s.uploads.blobs != nil {
+		s.uploads.blobs.Prune(func(path string, info fs.FileInfo) { remove("blobs", path, info) })
+	}
+	j.sweepTempFiles(root, func(path string, info fs.FileInfo) { remove("temp", path, info) })
+
+	report.Duration = time.Since(start).Round(time.Millisecond).String()
+
+	j.mu.Lock()
+	j.runs++
+	total, reclaimed := 0, int64(0)
+	for kind, n := range report.Files {
+		j.files[kind] += int64(n)
+		j.bytes[kind] += report.Bytes[kind]
+		total += n
+		reclaimed += report.Bytes[kind]
+	}
+	j.mu.Unlock()
+
+	if total > 0 {
+		s.logger.Info("Janitor: removed %d files (%s) in %s", total, formatSize(reclaimed), report.Duration)
+	}
+	return report
+}
+
+// sweepOrphans remove de dir as cópias derivadas (<rel><suffix>) cujo
+// arquivo de origem não existe mais na raiz
+func (j *Janitor) sweepOrphans(dir, suffix, root string, remove func(string, fs.FileInfo)) {
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() || !strings.HasSuffix(path, suffix) {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, strings.TrimSuffix(path, suffix))
+		if err != nil {
+			return nil
+		}
+		if _, err := os.Lstat(filepath.Join(root, rel)); os.IsNotExist(err) {
+			if info, err := d.Info(); err == nil {
+				remove(path, info)
+			}
+		}
+		return nil
+	})
+}
+
+// sweepOlder remove as entradas de dir que casam com pattern e não são
+// modificadas há mais de age
+func (j *Janitor) sweepOlder(dir, pattern string, age time.Duration, remove func(string, fs.FileInfo)) {
+	matches, _ := filepath.Glob(filepath.Join(dir, pattern))
+	for _, path := range matches {
+		if info, err := os.Lstat(path); err == nil && time.Since(info.ModTime()) > age {
+			remove(path, info)
+		}
+	}
+}
+
+// sweepTempFiles remove da raiz os temporários abandonados por restaurações
+// e deduplicações interrompidas
+func (j *Janitor) sweepTempFiles(root string, remove func(string, fs.FileInfo)) {
+	filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			if d.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		name := d.Name()
+		if !strings.HasPrefix(name, ".restore-") && !strings.HasPrefix(name, ".dedup-") {
+			return nil
+		}
+		if info, err := d.Info(); err == nil && time.Since(info.ModTime()) > j.tempAge() {
+			remove(path, info)
+		}
+		return nil
+	})
+}
+
+// dirSize soma o tamanho dos arquivos sob dir
+func dirSize(dir string) int64 {
+	var size int64
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err == nil && d.Type().IsRegular() {
+			if info, err := d.Info(); err == nil {
+				size += info.Size()
+			}
+		}
+		return nil
+	})
+	return size
+}
+
+// WriteMetrics exporta as execuções e o espaço liberado
+func (j *Janitor) WriteMetrics(w io.Writer) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	kinds := make([]string, 0, len(j.files))
+	for kind := range j.files {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	files := make([]metricSample, 0, len(kinds))
+	bytes := make([]metricSample, 0, len(kinds))
+	for _, kind := range kinds {
+		labels := map[string]string{"kind": kind}
+		files = append(files, metricSample{labels: labels, value: float64(j.files[kind])})
+		bytes = append(bytes, metricSample{labels: labels, value: float64(j.bytes[kind])})
+	}
+
+	writeMetric(w, "qserv_janitor_runs_total", "Janitor sweeps completed.", "counter",
+		[]metricSample{{value: float64(j.runs)}})
+	writeMetric(w, "qserv_janitor_removed_files_total", "Files removed by the janitor.", "counter", files)
+	writeMetric(w, "qserv_janitor_reclaimed_bytes_total", "Bytes reclaimed by the janitor.", "counter", bytes)
+}
+
+// handleAdminJanitor executa uma limpeza imediatamente
+func (s *Server) handleAdminJanitor(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.janitor.Sweep())
+}
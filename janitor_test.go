@@ -0,0 +1,47 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJanitorSweep(t *testing.T) {
+	root := t.TempDir()
+	cacheDir := t.TempDir()
+	writeTestFile(t, filepath.Join(root, "app.js"), "console.log(1)")
+	writeTestFile(t, filepath.Join(cacheDir, "app.js.gz"), "live")
+	writeTestFile(t, filepath.Join(cacheDir, "old", "removed.js.gz"), "orphan")
+	writeTestFile(t, filepath.Join(root, ".restore-index.html"), "stale temp")
+	writeTestFile(t, filepath.Join(root, ".restore-fresh.html"), "fresh temp")
+	old := time.Now().Add(-2 * time.Hour)
+	os.Chtimes(filepath.Join(root, ".restore-index.html"), old, old)
+
+	config := DefaultConfig()
+	config.Server.RootDir = root
+	config.Performance.Precompress = &PrecompressConfig{Enabled: true, Dir: cacheDir}
+	config.Janitor = &JanitorConfig{Enabled: true}
+	logger, _ := NewLogger(&LoggingConfig{Enabled: false})
+	server := NewServer(config, logger)
+
+	report := server.janitor.Sweep()
+	if report.Files["precompressed"] != 1 || report.Bytes["precompressed"] != int64(len("orphan")) {
+		t.Errorf("Expected 1 orphaned precompressed copy removed, got %+v", report)
+	}
+	if report.Files["temp"] != 1 {
+		t.Errorf("Expected 1 stale temp file removed, got %+v", report)
+	}
+	for _, path := range []string{filepath.Join(cacheDir, "app.js.gz"), filepath.Join(root, ".restore-fresh.html")} {
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("Expected %s to be kept", path)
+		}
+	}
+
+	var metrics strings.Builder
+	server.janitor.WriteMetrics(&metrics)
+	if !strings.Contains(metrics.String(), `qserv_janitor_reclaimed_bytes_total{kind="precompressed"} 6`) {
+		t.Errorf("Expected reclaimed bytes metric, got %q", metrics.String())
+	}
+}
@@ -0,0 +1,430 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// errJobRunning execução recusada porque o job já está rodando
+var errJobRunning = errors.New("job already running")
+
+// JobSpec tarefa de segundo plano registrada no agendador
+type JobSpec struct {
+	Name     string
+	Interval time.Duration          // 0 = apenas sob demanda (e na inicialização, com OnStart)
+	OnStart  bool                   // executa quando o agendador inicia
+	Run      func() (string, error) // retorna um resumo do resultado
+}
+
+// JobRun registro de uma execução
+type JobRun struct {
+	Job       string    `json:"job"`
+	Trigger   string    `json:"trigger"` // start, schedule, manual ou o evento que disparou
+	StartedAt time.Time `json:"started_at"`
+	Duration  string    `json:"duration"`
+	Result    string    `json:"result,omitempty"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// JobStatus estado de um job
+type JobStatus struct {
+	Name     string    `json:"name"`
+	Interval string    `json:"interval,omitempty"`
+	Running  bool      `json:"running"`
+	Runs     int64     `json:"runs"`
+	Failures int64     `json:"failures"`
+	NextRun  time.Time `json:"next_run,omitempty"`
+	LastRun  *JobRun   `json:"last_run,omitempty"`
+}
+
+// jobState estado interno de um job registrado
+type jobState struct {
+	spec     JobSpec
+	running  bool
+	pending  string // gatilho de uma execução pedida durante a atual (Queue)
+	runs     int64
+	failures int64
+	nextRun  time.Time
+	lastRun  *JobRun
+}
+
+// Jobs agenda as tarefas de segundo plano (pré-compressão, índice de
+// hashes, limpeza, sincronização git) com limite de concorrência e
+// histórico das execuções
+type Jobs struct {
+	config *JobsConfig
+	logger *Logger
+	slots  chan struct{}
+
+	mu      sync.Mutex
+	jobs    map[string]*jobState
+	history []JobRun // mais recentes no fim
+	stop    chan struct{}
+	wg      sync.WaitGroup
+}
+
+// NewJobs cria o agendador; config pode ser nil (valores padrão)
+func NewJobs(config *JobsConfig, logger *Logger) *Jobs {
+	if config == nil {
+		config = &JobsConfig{}
+	}
+	j := &Jobs{config: config, logger: logger, jobs: make(map[string]*jobState)}
+	j.slots = make(chan struct{}, j.maxConcurrent())
+	return j
+}
+
+// maxConcurrent retorna quantos jobs podem rodar ao mesmo tempo
+func (j *Jobs) maxConcurrent() int {
+	if j.config.MaxConcurrent <= 0 {
+		return 2
+	}
+	return j.config.MaxConcurrent
+}
+
+// historySize retorna quantas execuções ficam no histórico
+func (j *Jobs) historySize() int {
+	if j.config.History <= 0 {
+		return 100
+	}
+	return j.config.History
+}
+
+// Register adiciona um job; deve ser chamado antes de Start
+func (j *Jobs) Register(spec JobSpec) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.jobs[spec.Name] = &jobState{spec: spec}
+}
+
+// Start dispara os jobs de inicialização e os agendamentos periódicos
+func (j *Jobs) Start() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.stop != nil {
+		return
+	}
+	j.stop = make(chan struct{})
+	for name, state := range j.jobs {
+		if state.spec.OnStart {
+			go j.Trigger(name, "start")
+		}
+		if state.spec.Interval > 0 {
+			state.nextRun = time.Now().Add(state.spec.Interval)
+			j.wg.Add(1)
+			go j.schedule(name, state.spec.Interval, j.stop)
+		}
+	}
+}
+
+// Stop interrompe os agendamentos (execuções em andamento terminam)
+func (j *Jobs) Stop() {
+	j.mu.Lock()
+	if j.stop != nil {
+		close(j.stop)
+		j.stop = nil
+	}
+	j.mu.Unlock()
+	j.wg.Wait()
+}
+
+// schedule executa o job a cada interval
+func (j *Jobs) schedule(name string, interval time.Duration, stop chan struct{}) {
+	defer j.wg.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			j.mu.Lock()
+			j.jobs[name].nextRun = time.Now().Add(interval)
+			j.mu.Unlock()
+			if err := j.Trigger(name, "schedule"); errors.Is(err, errJobRunning) {
+				j.logger.Debug("Job %s still running, skipping scheduled run", name)
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+// Trigger executa o job e aguarda o término; recusa se ele já estiver rodando
+func (j *Jobs) Trigger(name, trigger string) error {
+	j.mu.Lock()
+	state, ok := j.jobs[name]
+	if !ok {
+		j.mu.Unlock()
+		return fmt.Errorf("unknown job %q", name)
+	}
+	if state.running {
+		j.mu.Unlock()
+		return errJobRunning
+	}
+	state.running = true
+	j.mu.Unlock()
+
+	j.slots <- struct{}{}
+	run := JobRun{Job: name, Trigger: trigger, StartedAt: time.Now()}
+	result, err := state.spec.Run()
+	<-j.slots
+
+	run.Duration = time.Since(run.StartedAt).Round(time.Millisecond).String()
+	run.Result = result
+	if err != nil {
+		run.Error = err.Error()
+		j.logger.Error("Job %s failed: %v", name, err)
+	} else {
+		j.logger.Debug("Job %s (%s) finished in %s: %s", name, trigger, run.Duration, result)
+	}
+
+	j.mu.Lock()
+	state.running = false
+	state.runs++
+	if err != nil {
+		state.failures++
+	}
+	state.lastRun = &run
+	j.history = append(j.history, run)
+	if over := len(j.history) - j.historySize(); over > 0 {
+		j.history = append([]JobRun(nil), j.history[over:]...)
+	}
+	pending := state.pending
+	state.pending = ""
+	j.mu.Unlock()
+
+	if pending != "" {
+		go j.Trigger(name, pending)
+	}
+	return err
+}
+
+// Queue executa o job em segundo plano; se ele já estiver rodando, uma nova
+// execução acontece assim que a atual terminar (ex: troca de raiz no meio
+// de uma varredura)
+func (j *Jobs) Queue(name, trigger string) {
+	j.mu.Lock()
+	state, ok := j.jobs[name]
+	if ok && state.running {
+		state.pending = trigger
+		ok = false
+	}
+	j.mu.Unlock()
+	if ok {
+		go j.Trigger(name, trigger)
+	}
+}
+
+// Status retorna o estado dos jobs, em ordem de nome
+func (j *Jobs) Status() []JobStatus {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	statuses := make([]JobStatus, 0, len(j.jobs))
+	for name, state := range j.jobs {
+		status := JobStatus{
+			Name:     name,
+			Running:  state.running,
+			Runs:     state.runs,
+			Failures: state.failures,
+			NextRun:  state.nextRun,
+			LastRun:  state.lastRun,
+		}
+		if state.spec.Interval > 0 {
+			status.Interval = state.spec.Interval.String()
+		}
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(a, b int) bool { return statuses[a].Name < statuses[b].Name })
+	return statuses
+}
+
+// History retorna as últimas execuções, das mais recentes para as mais antigas
+func (j *Jobs) History() []JobRun {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	history := make([]JobRun, len(j.history))
+	for i, run := range j.history {
+		history[len(j.history)-1-i] = run
+	}
+	return history
+}
+
+// WriteMetrics exporta execuções e falhas por job
+func (j *Jobs) WriteMetrics(w io.Writer) {
+	var runs, failures []metricSample
+	for _, status := range j.Status() {
+		labels := map[string]string{"job": status.Name}
+		runs = append(runs, metricSample{labels: labels, value: float64(status.Runs)})
+		failures = append(failures, metricSample{labels: labels, value: float64(status.Failures)})
+	}
+	writeMetric(w, "qserv_job_runs_total", "Background job runs.", "counter", runs)
+	writeMetric(w, "qserv_job_failures_total", "Background job runs that failed.", "counter", failures)
+}
+
+// registerJobs registra as tarefas de segundo plano dos componentes habilitados
+func (s *Server) registerJobs() {
+	if s.git != nil && s.config.Git.PollInterval > 0 {
+		s.jobs.Register(JobSpec{
+			Name:     "git-sync",
+			Interval: time.Duration(s.config.Git.PollInterval) * time.Second,
+			Run: func() (string, error) {
+				status, err := s.git.Sync()
+				if err != nil {
+					return "", err
+				}
+				if !status.Changed {
+					return "unchanged", nil
+				}
+				return "published " + status.Commit, nil
+			},
+		})
+	}
+
+	if s.rootIndex != nil {
+		s.jobs.Register(JobSpec{
+			Name:     "root-index",
+			Interval: time.Duration(s.config.Index.Interval) * time.Second,
+			OnStart:  true,
+			Run: func() (string, error) {
+				summary, err := s.rootIndex.Build(s.RootDir())
+				return fmt.Sprintf("%d files, %d dirs, %d hashed", summary.Files, summary.Dirs, summary.Hashed), err
+			},
+		})
+	}
+
+	if s.precompress != nil {
+		s.jobs.Register(JobSpec{
+			Name:     "precompress",
+			Interval: time.Duration(s.config.Performance.Precompress.Interval) * time.Second,
+			OnStart:  true,
+			Run: func() (string, error) {
+				compressed, fresh := s.precompress.Warm(s.RootDir())
+				return fmt.Sprintf("%d compressed, %d up to date", compressed, fresh), nil
+			},
+		})
+	}
+
+	if s.hashIndex != nil {
+		s.jobs.Register(JobSpec{
+			Name:     "hash-index",
+			Interval: time.Duration(s.config.Features.ContentAddress.Interval) * time.Second,
+			OnStart:  true,
+			Run: func() (string, error) {
+				hashed, fresh := s.hashIndex.Build(s.RootDir(), s.listable)
+				return fmt.Sprintf("%d hashed, %d up to date", hashed, fresh), nil
+			},
+		})
+	}
+
+	if s.packageRepos != nil {
+		for i := range s.packageRepos.config.Repos {
+			repo := &s.packageRepos.config.Repos[i]
+			if len(repo.Regenerate) == 0 {
+				continue
+			}
+			s.jobs.Register(JobSpec{
+				Name:     pkgRepoJob(repo),
+				Interval: time.Duration(repo.Interval) * time.Second,
+				Run: func() (string, error) {
+					return s.packageRepos.Regenerate(repo, s.RootDir())
+				},
+			})
+		}
+	}
+
+	if s.certMonitor != nil {
+		s.jobs.Register(JobSpec{
+			Name:     "certificate",
+			Interval: s.certMonitor.interval(),
+			OnStart:  true,
+			Run:      s.certMonitor.Check,
+		})
+	}
+
+	if s.ocsp != nil {
+		s.jobs.Register(JobSpec{
+			Name:     "ocsp",
+			Interval: s.ocsp.interval(),
+			Run:      s.ocsp.Refresh,
+		})
+	}
+
+	if s.tickets != nil {
+		s.jobs.Register(JobSpec{
+			Name:     "ticket-keys",
+			Interval: s.tickets.config.interval(),
+			Run:      s.tickets.Rotate,
+		})
+	}
+
+	if s.janitor != nil {
+		s.jobs.Register(JobSpec{
+			Name:     "janitor",
+			Interval: s.janitor.interval(),
+			Run: func() (string, error) {
+				report := s.janitor.Sweep()
+				files, bytes := 0, int64(0)
+				for kind, n := range report.Files {
+					files += n
+					bytes += report.Bytes[kind]
+				}
+				return fmt.Sprintf("removed %d files (%s)", files, formatSize(bytes)), nil
+			},
+		})
+	}
+
+	if s.uploads != nil && s.uploads.chunks != nil {
+		chunks := s.uploads.chunks
+		s.jobs.Register(JobSpec{
+			Name:     "chunked-uploads",
+			Interval: chunks.interval(),
+			OnStart:  true,
+			Run: func() (string, error) {
+				removed, bytes := 0, int64(0)
+				chunks.Sweep(func(path string, info fs.FileInfo) {
+					size := dirSize(path)
+					if err := os.RemoveAll(path); err != nil {
+						s.logger.Warn("Chunked uploads: failed to remove %s: %v", path, err)
+						return
+					}
+					removed++
+					bytes += size
+				})
+				return fmt.Sprintf("removed %d sessions (%s)", removed, formatSize(bytes)), nil
+			},
+		})
+	}
+}
+
+// handleAdminJobs lista os jobs e o histórico de execuções
+func (s *Server) handleAdminJobs(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"jobs":    s.jobs.Status(),
+		"history": s.jobs.History(),
+	})
+}
+
+// handleAdminRunJob dispara um job em segundo plano (202) ou responde 409
+// se ele já estiver rodando
+func (s *Server) handleAdminRunJob(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	s.jobs.mu.Lock()
+	state, ok := s.jobs.jobs[name]
+	running := ok && state.running
+	s.jobs.mu.Unlock()
+
+	switch {
+	case !ok:
+		writeJSONError(w, http.StatusNotFound, fmt.Errorf("unknown job %q", name))
+	case running:
+		writeJSONError(w, http.StatusConflict, errJobRunning)
+	default:
+		go s.jobs.Trigger(name, "manual")
+		writeJSON(w, http.StatusAccepted, map[string]string{"job": name, "status": "started"})
+	}
+}
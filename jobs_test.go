@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func newTestJobs() *Jobs {
+	logger, _ := NewLogger(&LoggingConfig{Enabled: false})
+	return NewJobs(nil, logger)
+}
+
+func TestJobsTrigger(t *testing.T) {
+	jobs := newTestJobs()
+	release := make(chan struct{})
+	started := make(chan struct{})
+	jobs.Register(JobSpec{
+		Name: "slow",
+		Run: func() (string, error) {
+			close(started)
+			<-release
+			return "done", nil
+		},
+	})
+
+	done := make(chan error)
+	go func() { done <- jobs.Trigger("slow", "manual") }()
+	<-started
+
+	// A second run while the first is in progress is refused
+	if err := jobs.Trigger("slow", "manual"); !errors.Is(err, errJobRunning) {
+		t.Errorf("Expected errJobRunning, got %v", err)
+	}
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	status := jobs.Status()
+	if len(status) != 1 || status[0].Runs != 1 || status[0].Running {
+		t.Fatalf("Expected one finished run, got %+v", status)
+	}
+	history := jobs.History()
+	if len(history) != 1 || history[0].Result != "done" || history[0].Trigger != "manual" {
+		t.Errorf("Expected history with the manual run, got %+v", history)
+	}
+
+	if err := jobs.Trigger("missing", "manual"); err == nil {
+		t.Error("Expected error for unknown job")
+	}
+}
+
+func TestJobsFailureAndHistoryLimit(t *testing.T) {
+	logger, _ := NewLogger(&LoggingConfig{Enabled: false})
+	jobs := NewJobs(&JobsConfig{History: 2}, logger)
+	jobs.Register(JobSpec{Name: "broken", Run: func() (string, error) { return "", errors.New("boom") }})
+
+	for i := 0; i < 3; i++ {
+		jobs.Trigger("broken", "manual")
+	}
+	if history := jobs.History(); len(history) != 2 || history[0].Error != "boom" {
+		t.Errorf("Expected 2 failed runs in history, got %+v", history)
+	}
+	if status := jobs.Status(); status[0].Failures != 3 {
+		t.Errorf("Expected 3 failures, got %d", status[0].Failures)
+	}
+}
+
+func TestJobsQueueWhileRunning(t *testing.T) {
+	jobs := newTestJobs()
+	release := make(chan struct{})
+	runs := make(chan string, 2)
+	jobs.Register(JobSpec{
+		Name: "index",
+		Run: func() (string, error) {
+			<-release
+			return "", nil
+		},
+	})
+
+	go func() {
+		jobs.Trigger("index", "start")
+		runs <- "start"
+	}()
+	deadline := time.Now().Add(2 * time.Second)
+	for !jobs.Status()[0].Running && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// Queued while running: runs again once the current run finishes
+	jobs.Queue("index", "root-swap")
+	close(release)
+	<-runs
+	for jobs.Status()[0].Runs < 2 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	history := jobs.History()
+	if len(history) != 2 || history[0].Trigger != "root-swap" {
+		t.Errorf("Expected the queued run after the first, got %+v", history)
+	}
+}
+
+func TestAdminJobs(t *testing.T) {
+	server := newAdminTestServer(t, t.TempDir())
+	ran := make(chan struct{}, 1)
+	server.jobs.Register(JobSpec{Name: "noop", Run: func() (string, error) {
+		ran <- struct{}{}
+		return "ok", nil
+	}})
+
+	w := adminRequest(server, "POST", "/_admin/jobs/noop/run", "")
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("Expected 202, got %d: %s", w.Code, w.Body.String())
+	}
+	select {
+	case <-ran:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected the job to run")
+	}
+
+	w = adminRequest(server, "POST", "/_admin/jobs/missing/run", "")
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for unknown job, got %d", w.Code)
+	}
+
+	w = adminRequest(server, "GET", "/_admin/jobs", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", w.Code)
+	}
+	var body struct {
+		Jobs []JobStatus `json:"jobs"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(body.Jobs) != 1 || body.Jobs[0].Name != "noop" {
+		t.Errorf("Expected the noop job, got %+v", body.Jobs)
+	}
+}
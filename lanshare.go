@@ -0,0 +1,67 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"strings"
+)
+
+// lanShareHosts hosts aceitos no modo lan_share: localhost, o nome da máquina
+// (também com .local, do mDNS) e os IPs em que o servidor escuta (todos os
+// IPs das interfaces quando escuta em 0.0.0.0 ou ::)
+func lanShareHosts(addrs []ListenAddr) []string {
+	hosts := []string{"localhost", "127.0.0.1", "::1"}
+	if name, err := os.Hostname(); err == nil && name != "" {
+		name = strings.ToLower(name)
+		hosts = append(hosts, name)
+		if !strings.HasSuffix(name, ".local") {
+			hosts = append(hosts, strings.SplitN(name, ".", 2)[0]+".local")
+		}
+	}
+
+	wildcard := false
+	for _, addr := range addrs {
+		ip := net.ParseIP(addr.Host)
+		if addr.Host == "" || ip != nil && ip.IsUnspecified() {
+			wildcard = true
+			continue
+		}
+		hosts = append(hosts, addr.Host)
+	}
+	if wildcard {
+		if ifaceAddrs, err := net.InterfaceAddrs(); err == nil {
+			for _, a := range ifaceAddrs {
+				if ipnet, ok := a.(*net.IPNet); ok {
+					hosts = append(hosts, ipnet.IP.String())
+				}
+			}
+		}
+	}
+	return hosts
+}
+
+// privateClient informa se o IP é de loopback, de rede privada ou link-local
+func privateClient(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	return addr.IsLoopback() || addr.IsPrivate() || addr.IsLinkLocalUnicast()
+}
+
+// PrivateClientsMiddleware aceita apenas clientes da rede local
+func PrivateClientsMiddleware() Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ip, _, _ := net.SplitHostPort(r.RemoteAddr)
+			if !privateClient(ip) {
+				http.Error(w, "403 Forbidden", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
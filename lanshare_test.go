@@ -0,0 +1,99 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLANShareHosts(t *testing.T) {
+	hosts := lanShareHosts([]ListenAddr{{Network: "tcp4", Host: "192.168.1.20", Port: 8080}})
+	for _, want := range []string{"localhost", "127.0.0.1", "192.168.1.20"} {
+		found := false
+		for _, h := range hosts {
+			found = found || h == want
+		}
+		if !found {
+			t.Errorf("Expected %s in LAN share hosts, got %v", want, hosts)
+		}
+	}
+}
+
+func TestPrivateClient(t *testing.T) {
+	for ip, want := range map[string]bool{
+		"127.0.0.1":          true,
+		"10.1.2.3":           true,
+		"192.168.0.10":       true,
+		"fe80::1":            true,
+		"fd00::1":            true,
+		"::ffff:172.16.0.1":  true,
+		"8.8.8.8":            false,
+		"2001:4860:4860::88": false,
+		"not-an-ip":          false,
+	} {
+		if got := privateClient(ip); got != want {
+			t.Errorf("privateClient(%q) = %v, expected %v", ip, got, want)
+		}
+	}
+}
+
+func TestLANShareMode(t *testing.T) {
+	root := t.TempDir()
+	os.WriteFile(filepath.Join(root, "file.txt"), []byte("hello"), 0644)
+
+	config := DefaultConfig()
+	config.Server.RootDir = root
+	config.Server.Host = "127.0.0.1"
+	config.Server.LANShare = true
+
+	logger, _ := NewLogger(&LoggingConfig{Enabled: false})
+	server := NewServer(config, logger)
+	server.setupHandlers()
+
+	get := func(host, remote string) int {
+		req := httptest.NewRequest("GET", "/file.txt", nil)
+		req.Host = host
+		req.RemoteAddr = remote
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if code := get("127.0.0.1:8080", "192.168.1.5:5000"); code != http.StatusOK {
+		t.Errorf("Expected LAN client with local host to be served, got %d", code)
+	}
+	// DNS rebinding: attacker-controlled name resolving to this machine
+	if code := get("rebind.attacker.test:8080", "192.168.1.5:5000"); code != http.StatusMisdirectedRequest {
+		t.Errorf("Expected 421 for foreign Host, got %d", code)
+	}
+	if code := get("localhost:8080", "203.0.113.7:5000"); code != http.StatusForbidden {
+		t.Errorf("Expected public client to be rejected, got %d", code)
+	}
+}
+
+func TestLANShareCoversSideRoutes(t *testing.T) {
+	server := newListingTestServer(t, t.TempDir(), func(c *Config) {
+		c.Server.Host = "127.0.0.1"
+		c.Server.LANShare = true
+		c.RuntimeConfig = &RuntimeConfigConfig{Enabled: true}
+	})
+
+	// Routes registered directly on the mux only answer local clients too
+	req := httptest.NewRequest("GET", "/runtime-config.js", nil)
+	req.Host = "127.0.0.1:8080"
+	req.RemoteAddr = "203.0.113.7:5000"
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected public client to be rejected, got %d", w.Code)
+	}
+
+	req.RemoteAddr = "192.168.1.5:5000"
+	w = httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected LAN client to be served, got %d", w.Code)
+	}
+}
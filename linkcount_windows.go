@@ -0,0 +1,9 @@
+package main
+
+import "io/fs"
+
+// linkCount não está disponível no os.FileInfo do Windows; os blobs não são
+// removidos automaticamente
+func linkCount(info fs.FileInfo) (uint64, bool) {
+	return 0, false
+}
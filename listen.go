@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ListenAddr endereço em que o servidor aceita conexões
+type ListenAddr struct {
+	Network string // tcp, tcp4 ou tcp6
+	Host    string
+	Port    int
+}
+
+// Address retorna host:porta com literais IPv6 entre colchetes
+func (a ListenAddr) Address() string {
+	return net.JoinHostPort(a.Host, strconv.Itoa(a.Port))
+}
+
+// URL retorna a URL de acesso para o protocolo informado
+func (a ListenAddr) URL(scheme string) string {
+	return scheme + "://" + a.Address()
+}
+
+// String descreve o endereço para logs
+func (a ListenAddr) String() string {
+	return fmt.Sprintf("%s (%s)", a.Address(), a.Network)
+}
+
+// hostList retorna os hosts configurados (hosts tem precedência sobre host)
+func (c *ServerConfig) hostList() []string {
+	if len(c.Hosts) > 0 {
+		return c.Hosts
+	}
+	return []string{c.Host}
+}
+
+// isWildcardHost indica se o host significa "todas as interfaces"
+func isWildcardHost(host string) bool {
+	return host == "" || host == "0.0.0.0" || host == "::"
+}
+
+// ListenAddrs calcula os endereços de escuta conforme hosts e ip_family:
+//   - auto: comportamento padrão do Go/SO ("tcp")
+//   - ipv4/ipv6: restringe todos os sockets à família escolhida
+//   - both: cria sockets separados por família, inclusive para curingas,
+//     evitando depender do comportamento dual-stack de cada SO
+func (c *ServerConfig) ListenAddrs() ([]ListenAddr, error) {
+	var addrs []ListenAddr
+	seen := make(map[string]bool)
+
+	add := func(network, host string) {
+		key := network + "|" + host
+		if !seen[key] {
+			seen[key] = true
+			addrs = append(addrs, ListenAddr{Network: network, Host: host, Port: c.Port})
+		}
+	}
+
+	for _, raw := range c.hostList() {
+		host := strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(raw), "["), "]")
+		ip := net.ParseIP(host)
+
+		switch c.IPFamily {
+		case "", "auto":
+			add("tcp", host)
+
+		case "ipv4":
+			if ip != nil && ip.To4() == nil {
+				return nil, fmt.Errorf("host %s is IPv6 but ip_family is ipv4", host)
+			}
+			if host == "::" {
+				host = "0.0.0.0"
+			}
+			add("tcp4", host)
+
+		case "ipv6":
+			if ip != nil && ip.To4() != nil {
+				return nil, fmt.Errorf("host %s is IPv4 but ip_family is ipv6", host)
+			}
+			if host == "" {
+				host = "::"
+			}
+			add("tcp6", host)
+
+		case "both":
+			switch {
+			case isWildcardHost(host):
+				add("tcp4", "0.0.0.0")
+				add("tcp6", "::")
+			case ip != nil && ip.To4() != nil:
+				add("tcp4", host)
+			case ip != nil:
+				add("tcp6", host)
+			default:
+				// Nome de host: a família vem da resolução
+				add("tcp", host)
+			}
+
+		default:
+			return nil, fmt.Errorf("invalid ip_family: %q (must be auto, ipv4, ipv6 or both)", c.IPFamily)
+		}
+	}
+
+	return addrs, nil
+}
+
+// listen abre os sockets configurados, aplicando os ajustes de conexão
+// (conn pode ser nil); em caso de erro fecha os já abertos
+func listen(addrs []ListenAddr, conn *ConnectionConfig) ([]net.Listener, error) {
+	var lc net.ListenConfig
+	if conn != nil && conn.TCPKeepAlive != 0 {
+		lc.KeepAlive = time.Duration(conn.TCPKeepAlive) * time.Second
+		if conn.TCPKeepAlive < 0 {
+			lc.KeepAlive = -1
+		}
+	}
+
+	var listeners []net.Listener
+	for _, addr := range addrs {
+		l, err := lc.Listen(context.Background(), addr.Network, addr.Address())
+		if err != nil {
+			for _, opened := range listeners {
+				opened.Close()
+			}
+			return nil, fmt.Errorf("listen on %s: %w", addr, err)
+		}
+		if conn != nil {
+			l = &tunedListener{Listener: l, config: conn}
+		}
+		listeners = append(listeners, l)
+	}
+	return listeners, nil
+}
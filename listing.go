@@ -0,0 +1,687 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	listingBatch             = 1000  // entradas lidas por vez; diretórios menores saem ordenados
+	listingDefaultMaxEntries = 10000 // entradas por página
+)
+
+// listingEntry entrada da listagem
+type listingEntry struct {
+	Name    string    `json:"name"`
+	Path    string    `json:"path"`
+	IsDir   bool      `json:"is_dir"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+// listingWriter formato de saída da listagem (HTML ou JSON)
+type listingWriter interface {
+	begin(path string, sorted bool) error
+	entry(e listingEntry) error
+	end(next string) error
+}
+
+// listingMaxEntries retorna o limite de entradas por página
+func (s *Server) listingMaxEntries() int {
+	if s.config.Features.ListingMaxEntries <= 0 {
+		return listingDefaultMaxEntries
+	}
+	return s.config.Features.ListingMaxEntries
+}
+
+// serveDirectoryListing serve a listagem de diretório. Diretórios com até
+// listingBatch entradas são ordenados (diretórios primeiro); maiores são
+// transmitidos na ordem do disco, em lotes, sem manter a listagem inteira em
+// memória. Cada página tem no máximo listingMaxEntries entradas e termina com
+// um token para continuar (?continue=...).
+func (s *Server) serveDirectoryListing(w http.ResponseWriter, r *http.Request, path string) {
+	offset := 0
+	if token := r.URL.Query().Get("continue"); token != "" {
+		n, err := strconv.Atoi(token)
+		if err != nil || n < 0 {
+			http.Error(w, "invalid continue token", http.StatusBadRequest)
+			return
+		}
+		offset = n
+	}
+
+	// Validadores para GET condicional (If-None-Match / If-Modified-Since)
+	if !wantsJSONListing(r) && s.config.Features.Language == "" {
+		w.Header().Add("Vary", "Accept-Language")
+	}
+	etag, modTime, err := s.listingValidators(path, r)
+	if err != nil {
+		s.logger.Error("Error reading directory %s: %v", path, err)
+		s.serveError(w, r, http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Last-Modified", modTime.UTC().Format(http.TimeFormat))
+	if s.config.Performance.EnableETags {
+		w.Header().Set("ETag", etag)
+	}
+	if listingNotModified(r, etag, modTime, s.config.Performance.EnableETags) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	root := s.requestRoot(r)
+	dir, err := os.Open(path)
+	if err != nil {
+		s.logger.Error("Error reading directory %s: %v", path, err)
+		s.serveError(w, r, http.StatusInternalServerError)
+		return
+	}
+	defer dir.Close()
+
+	entries, done, err := s.readListingBatch(root, dir)
+	if err != nil {
+		s.logger.Error("Error reading directory %s: %v", path, err)
+		s.serveError(w, r, http.StatusInternalServerError)
+		return
+	}
+
+	// Ordenação só é possível quando tudo cabe em um lote
+	base := strings.TrimSuffix(r.URL.Path, "/") + "/"
+	sorted := offset == 0 && done
+	key, desc := listingSort(r)
+	if sorted {
+		s.sortListing(entries, base, key, desc)
+	}
+
+	var out listingWriter
+	if wantsJSONListing(r) {
+		w.Header().Set("Content-Type", "application/json")
+		out = &jsonListingWriter{w: w}
+	} else {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		html := &htmlListingWriter{w: w, theme: s.theme, msg: s.messages(w, r), sort: key, desc: desc,
+			upload: s.uploads != nil && s.uploads.Accepts(base), archive: s.archives != nil}
+		if s.upProgress != nil {
+			html.upRoute = s.upProgress.route
+		}
+		out = html
+	}
+	rc := http.NewResponseController(w)
+
+	if err := out.begin(r.URL.Path, sorted); err != nil {
+		return
+	}
+
+	max := s.listingMaxEntries()
+	skip, emitted, next := offset, 0, ""
+stream:
+	for {
+		for _, entry := range entries {
+			if skip > 0 {
+				skip--
+				continue
+			}
+			if emitted == max {
+				next = strconv.Itoa(offset + emitted)
+				break stream
+			}
+			info, err := entry.Info()
+			if err != nil {
+				continue
+			}
+			e := listingEntry{
+				Name:    entry.Name(),
+				Path:    escapeURLPath(base + entry.Name()),
+				IsDir:   entry.IsDir(),
+				ModTime: info.ModTime(),
+			}
+			if !e.IsDir {
+				e.Size = info.Size()
+			} else if size, ok := s.listingDirSize(filepath.Join(path, e.Name)); ok {
+				e.Size = size
+			}
+			if err := out.entry(e); err != nil {
+				return
+			}
+			emitted++
+		}
+		if done {
+			break
+		}
+		rc.Flush()
+
+		entries, done, err = s.readListingBatch(root, dir)
+		if err != nil {
+			// Os headers já foram enviados: encerra a listagem como está
+			s.logger.Error("Error reading directory %s: %v", path, err)
+			break
+		}
+	}
+
+	out.end(next)
+}
+
+// listingSort retorna a ordenação pedida (?sort=name|size|modified&order=desc)
+func listingSort(r *http.Request) (key string, desc bool) {
+	key = r.URL.Query().Get("sort")
+	if key != "size" && key != "modified" {
+		key = "name"
+	}
+	return key, r.URL.Query().Get("order") == "desc"
+}
+
+// sortListing ordena as entradas: as fixadas primeiro, na ordem das regras,
+// depois os diretórios e então os arquivos pela coluna pedida
+func (s *Server) sortListing(entries []fs.DirEntry, base, key string, desc bool) {
+	pinned := make(map[string]int)
+	infos := make(map[string]fs.FileInfo, len(entries))
+	for _, entry := range entries {
+		if s.listingRules != nil {
+			if rank := s.listingRules.pinRank(base+entry.Name(), entry.Name(), entry.IsDir()); rank >= 0 {
+				pinned[entry.Name()] = rank
+			}
+		}
+		if key != "name" {
+			if info, err := entry.Info(); err == nil {
+				infos[entry.Name()] = info
+			}
+		}
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		ra, pa := pinned[a.Name()]
+		rb, pb := pinned[b.Name()]
+		if pa != pb {
+			return pa
+		}
+		if pa && ra != rb {
+			return ra < rb
+		}
+		if a.IsDir() != b.IsDir() {
+			return a.IsDir()
+		}
+		ia, ib := infos[a.Name()], infos[b.Name()]
+		switch {
+		case key == "size" && ia != nil && ib != nil && ia.Size() != ib.Size():
+			return (ia.Size() < ib.Size()) != desc
+		case key == "modified" && ia != nil && ib != nil && !ia.ModTime().Equal(ib.ModTime()):
+			return ia.ModTime().Before(ib.ModTime()) != desc
+		}
+		return (a.Name() < b.Name()) != desc
+	})
+}
+
+// readListingBatch lê o próximo lote de entradas visíveis
+func (s *Server) readListingBatch(root string, dir *os.File) ([]fs.DirEntry, bool, error) {
+	entries, err := dir.ReadDir(listingBatch)
+	if err == io.EOF {
+		return nil, true, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	done := len(entries) < listingBatch
+
+	filtered := entries[:0]
+	for _, entry := range entries {
+		if s.listable(root, dir.Name(), entry.Name()) {
+			filtered = append(filtered, entry)
+		}
+	}
+	return filtered, done, nil
+}
+
+// listable informa se a entrada name de dir aparece na listagem (e nos
+// arquivos gerados do diretório): sem os arquivos ocultos se configurado,
+// sem o conteúdo fora da janela de publicação, sem marcadores de remoção e
+// sem as entradas ocultas pelas regras de listagem
+func (s *Server) listable(root, dir, name string) bool {
+	if s.config.Security.BlockHiddenFiles && strings.HasPrefix(name, ".") {
+		return false
+	}
+	if s.schedule != nil && !s.schedule.Listed(root, dir, name) {
+		return false
+	}
+	if s.tombstones != nil && s.tombstones.IsMarker(name) {
+		return false
+	}
+	if s.listingRules != nil && s.listingRules.Hidden(root, dir, name) {
+		return false
+	}
+	return true
+}
+
+// listingValidators calcula um ETag fraco a partir das entradas visíveis
+// (nome, tipo, tamanho e mtime) e da representação pedida, e o Last-Modified
+// como o mtime mais recente entre o diretório e suas entradas. A leitura é
+// feita em lotes, sem manter a listagem em memória.
+func (s *Server) listingValidators(path string, r *http.Request) (string, time.Time, error) {
+	root := s.requestRoot(r)
+	dir, err := os.Open(path)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	defer dir.Close()
+
+	info, err := dir.Stat()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	modTime := info.ModTime()
+
+	h := sha256.New()
+	key, desc := listingSort(r)
+	lang := messagesFor(r, s.config.Features.Language).Lang
+	fmt.Fprintf(h, "%t\x00%s\x00%s\x00%t\x00%s\n", wantsJSONListing(r), r.URL.Query().Get("continue"), key, desc, lang)
+	if s.diskUsage != nil && s.diskUsage.config.Listing && s.rootIndex != nil {
+		// Tamanhos dos diretórios mudam a cada reindexação
+		fmt.Fprintf(h, "%d\n", s.rootIndex.BuiltAt().UnixNano())
+	}
+	for {
+		entries, done, err := s.readListingBatch(root, dir)
+		if err != nil {
+			return "", time.Time{}, err
+		}
+		for _, entry := range entries {
+			info, err := entry.Info()
+			if err != nil {
+				continue
+			}
+			if info.ModTime().After(modTime) {
+				modTime = info.ModTime()
+			}
+			fmt.Fprintf(h, "%s\x00%t\x00%d\x00%d\n", entry.Name(), entry.IsDir(), info.Size(), info.ModTime().UnixNano())
+		}
+		if done {
+			break
+		}
+	}
+	return fmt.Sprintf(`W/"%x"`, h.Sum(nil)[:12]), modTime, nil
+}
+
+// listingNotModified avalia as pré-condições; If-None-Match tem precedência
+// sobre If-Modified-Since (RFC 9110)
+func listingNotModified(r *http.Request, etag string, modTime time.Time, useETag bool) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	if inm := r.Header.Get("If-None-Match"); inm != "" && useETag {
+		return etagMatch(inm, etag)
+	}
+	if ims := r.Header.Get("If-Modified-Since"); ims != "" {
+		t, err := http.ParseTime(ims)
+		// Resolução de segundos, como no cabeçalho
+		return err == nil && !modTime.Truncate(time.Second).After(t)
+	}
+	return false
+}
+
+// wantsJSONListing informa se o cliente pediu a listagem em JSON (?format=json ou Accept)
+func wantsJSONListing(r *http.Request) bool {
+	if format := r.URL.Query().Get("format"); format != "" {
+		return format == "json"
+	}
+	return strings.Contains(r.Header.Get("Accept"), "application/json")
+}
+
+// htmlListingWriter escreve a listagem em HTML, linha a linha
+type htmlListingWriter struct {
+	w       io.Writer
+	theme   *Theme
+	msg     *Messages
+	sort    string // coluna ordenada
+	desc    bool
+	upload  bool   // mostra o formulário de upload
+	upRoute string // rota de progresso dos uploads ("" = sem barra de progresso)
+	archive bool   // mostra os links de download do diretório
+}
+
+// listingCrumb item da navegação (breadcrumb)
+type listingCrumb struct {
+	Name, Href string
+}
+
+// listingColumn cabeçalho de coluna, com link para ordenar
+type listingColumn struct {
+	Label, Class, Href, Arrow string
+}
+
+// listingCrumbs divide o caminho em links para cada diretório acima
+func listingCrumbs(path string) []listingCrumb {
+	crumbs := []listingCrumb{{Name: "/", Href: "/"}}
+	href := "/"
+	for _, part := range strings.Split(strings.Trim(path, "/"), "/") {
+		if part == "" {
+			continue
+		}
+		href += part + "/"
+		crumbs = append(crumbs, listingCrumb{Name: part, Href: escapeURLPath(href)})
+	}
+	return crumbs
+}
+
+func (h *htmlListingWriter) begin(path string, sorted bool) error {
+	columns := []listingColumn{
+		{Label: h.msg.T("Name"), Class: "name"},
+		{Label: h.msg.T("Size"), Class: "size"},
+		{Label: h.msg.T("Modified"), Class: "modified"},
+	}
+	// Cabeçalhos só ordenam quando o diretório inteiro cabe em uma página ordenada
+	if sorted {
+		for i, key := range []string{"name", "size", "modified"} {
+			order := "asc"
+			if key == h.sort {
+				columns[i].Arrow = "▲"
+				if !h.desc {
+					order = "desc"
+				} else {
+					columns[i].Arrow = "▼"
+				}
+			}
+			columns[i].Href = "?sort=" + key + "&order=" + order
+		}
+	}
+	return directoryListingTemplate.ExecuteTemplate(h.w, "head", struct {
+		Path    string
+		Theme   *Theme
+		Msg     *Messages
+		Crumbs  []listingCrumb
+		Columns []listingColumn
+	}{path, h.theme, h.msg, listingCrumbs(path), columns})
+}
+
+func (h *htmlListingWriter) entry(e listingEntry) error {
+	size := "-"
+	if !e.IsDir || e.Size > 0 {
+		size = formatSize(e.Size)
+	}
+	return directoryListingTemplate.ExecuteTemplate(h.w, "row", struct {
+		Name, Path, Size, ModTime, Icon string
+		IsDir                           bool
+	}{e.Name, e.Path, size, e.ModTime.Format("2006-01-02 15:04:05"), listingIcon(e.Name, e.IsDir), e.IsDir})
+}
+
+func (h *htmlListingWriter) end(next string) error {
+	var more string
+	if next != "" {
+		more = "?continue=" + next
+	}
+	return directoryListingTemplate.ExecuteTemplate(h.w, "foot", struct {
+		More     string
+		Upload   bool
+		Progress string
+		Archive  bool
+		Theme    *Theme
+		Msg      *Messages
+	}{more, h.upload, h.upRoute, h.archive, h.theme, h.msg})
+}
+
+// listingIcons ícone por extensão
+var listingIcons = map[string]string{
+	".png": "🖼️", ".jpg": "🖼️", ".jpeg": "🖼️", ".gif": "🖼️", ".svg": "🖼️", ".webp": "🖼️", ".ico": "🖼️", ".avif": "🖼️",
+	".mp3": "🎵", ".ogg": "🎵", ".flac": "🎵", ".wav": "🎵", ".m4a": "🎵", ".opus": "🎵",
+	".mp4": "🎬", ".mkv": "🎬", ".webm": "🎬", ".mov": "🎬", ".avi": "🎬",
+	".zip": "📦", ".gz": "📦", ".tgz": "📦", ".bz2": "📦", ".xz": "📦", ".zst": "📦", ".7z": "📦", ".rar": "📦", ".tar": "📦",
+	".deb": "📦", ".rpm": "📦", ".apk": "📦", ".dmg": "📦", ".msi": "📦", ".exe": "⚙️", ".iso": "💿", ".img": "💿",
+	".pdf": "📕", ".txt": "📝", ".md": "📝", ".rst": "📝", ".log": "📝", ".csv": "📊", ".xls": "📊", ".xlsx": "📊",
+	".go": "📜", ".js": "📜", ".ts": "📜", ".py": "📜", ".rs": "📜", ".c": "📜", ".h": "📜", ".java": "📜", ".sh": "📜",
+	".html": "🌐", ".htm": "🌐", ".css": "🎨", ".json": "🔧", ".yaml": "🔧", ".yml": "🔧", ".toml": "🔧", ".xml": "🔧",
+	".asc": "🔏", ".sig": "🔏", ".sha256": "🔏", ".sha512": "🔏", ".md5": "🔏", ".torrent": "🧲", ".meta4": "🧲",
+}
+
+// listingIcon retorna o ícone da entrada pelo tipo
+func listingIcon(name string, isDir bool) string {
+	if isDir {
+		return "📁"
+	}
+	if icon, ok := listingIcons[strings.ToLower(filepath.Ext(name))]; ok {
+		return icon
+	}
+	return "📄"
+}
+
+// jsonListingWriter escreve a listagem em JSON, entrada a entrada
+type jsonListingWriter struct {
+	w     io.Writer
+	count int
+}
+
+func (j *jsonListingWriter) begin(path string, sorted bool) error {
+	p, _ := json.Marshal(path)
+	_, err := fmt.Fprintf(j.w, "{\"path\":%s,\"sorted\":%t,\"entries\":[", p, sorted)
+	return err
+}
+
+func (j *jsonListingWriter) entry(e listingEntry) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	sep := ",\n"
+	if j.count == 0 {
+		sep = "\n"
+	}
+	j.count++
+	_, err = fmt.Fprintf(j.w, "%s%s", sep, data)
+	return err
+}
+
+func (j *jsonListingWriter) end(next string) error {
+	if next == "" {
+		_, err := io.WriteString(j.w, "\n]}\n")
+		return err
+	}
+	_, err := fmt.Fprintf(j.w, "\n],\"continue\":%q}\n", next)
+	return err
+}
+
+// directoryListingTemplate template da listagem, em partes para permitir o
+// streaming; sem dependências externas (CSS embutido, ícones em emoji)
+var directoryListingTemplate = template.Must(template.New("listing").Parse(
+	`{{define "head"}}<!DOCTYPE html>
+<html lang="{{.Msg.Lang}}">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <title>{{.Msg.T "Index of"}} {{.Path}}{{with .Theme.Title}} · {{.}}{{end}}</title>
+    <style>
+        {{.Theme.CSS}}
+        * { margin: 0; padding: 0; box-sizing: border-box; }
+        body {
+            font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, Oxygen, Ubuntu, Cantarell, sans-serif;
+            padding: 2rem;
+            background: var(--qs-bg);
+            color: var(--qs-text);
+        }
+        .container {
+            max-width: 1200px;
+            margin: 0 auto;
+            background: var(--qs-surface);
+            border-radius: 8px;
+            box-shadow: var(--qs-shadow);
+            overflow: hidden;
+        }
+        .brand {
+            display: flex;
+            align-items: center;
+            gap: 0.75rem;
+            padding: 1rem 2rem 0;
+            background: var(--qs-header-bg);
+            color: var(--qs-header-text);
+            font-weight: 600;
+        }
+        .brand img { max-height: 32px; }
+        h1 {
+            padding: 1.5rem 2rem;
+            background: var(--qs-header-bg);
+            color: var(--qs-header-text);
+            font-size: 1.5rem;
+            font-weight: 600;
+            word-break: break-all;
+        }
+        h1 a { color: var(--qs-header-text); display: inline; }
+        h1 a:hover { color: var(--qs-header-text); opacity: 0.8; }
+        h1 .crumbs { display: inline; }
+        h1 .sep { opacity: 0.6; margin: 0 0.15rem; }
+        table {
+            width: 100%;
+            border-collapse: collapse;
+        }
+        th {
+            background: var(--qs-subheader-bg);
+            color: var(--qs-header-text);
+            padding: 1rem;
+            text-align: left;
+            font-weight: 600;
+        }
+        th a { color: var(--qs-header-text); display: inline; }
+        th a:hover { color: var(--qs-header-text); opacity: 0.8; }
+        th.size, td.size { width: 150px; }
+        th.modified, td.modified { width: 200px; }
+        td {
+            padding: 1rem;
+            border-bottom: 1px solid var(--qs-border);
+        }
+        tbody tr:hover {
+            background: var(--qs-hover);
+        }
+        a {
+            color: var(--qs-accent);
+            text-decoration: none;
+            display: flex;
+            align-items: center;
+            word-break: break-all;
+        }
+        a:hover {
+            color: var(--qs-accent-hover);
+            text-decoration: underline;
+        }
+        .icon {
+            margin-right: 0.5rem;
+            font-size: 1.2rem;
+        }
+        td.size, td.modified {
+            color: var(--qs-muted);
+            white-space: nowrap;
+        }
+        form.upload {
+            display: flex;
+            gap: 0.75rem;
+            align-items: center;
+            padding: 1rem;
+            border-top: 1px solid var(--qs-border);
+        }
+        form.upload button {
+            padding: 0.4rem 1rem;
+            border: 0;
+            border-radius: 4px;
+            background: var(--qs-accent);
+            color: var(--qs-surface);
+            cursor: pointer;
+        }
+        p.download {
+            margin: 0;
+            padding: 1rem;
+            border-top: 1px solid var(--qs-border);
+            color: var(--qs-muted);
+        }
+        footer {
+            max-width: 1200px;
+            margin: 1rem auto 0;
+            color: var(--qs-muted);
+            font-size: 0.875rem;
+            text-align: center;
+        }
+        @media (max-width: 640px) {
+            body { padding: 0; }
+            .brand { padding: 0.75rem 1rem 0; }
+            .container { border-radius: 0; box-shadow: none; }
+            h1 { padding: 1rem; font-size: 1.1rem; }
+            th, td { padding: 0.75rem 0.5rem; }
+            th.size, td.size { width: auto; }
+            th.modified, td.modified { display: none; }
+        }
+    </style>
+</head>
+<body>
+    <div class="container">
+        {{if or .Theme.Logo .Theme.Title}}<div class="brand">{{with .Theme.Logo}}<img src="{{.}}" alt="">{{end}}{{with .Theme.Title}}<span>{{.}}</span>{{end}}</div>{{end}}
+        <h1>📁 {{.Msg.T "Index of"}} <nav class="crumbs">{{range $i, $c := .Crumbs}}<a href="{{$c.Href}}">{{$c.Name}}</a>{{if $i}}<span class="sep">/</span>{{end}}{{end}}</nav></h1>
+        <table>
+            <thead>
+                <tr>
+                    {{range .Columns}}<th class="{{.Class}}">{{if .Href}}<a href="{{.Href}}">{{.Label}}</a> {{.Arrow}}{{else}}{{.Label}}{{end}}</th>
+                    {{end}}
+                </tr>
+            </thead>
+            <tbody>
+                {{if ne .Path "/"}}
+                <tr>
+                    <td><a href=".."><span class="icon">⬆️</span> {{.Msg.T "Parent directory"}}</a></td>
+                    <td class="size">-</td>
+                    <td class="modified">-</td>
+                </tr>
+                {{end}}
+{{end}}` +
+		`{{define "row"}}                <tr>
+                    <td>
+                        <a href="{{.Path}}">
+                            <span class="icon">{{.Icon}}</span>
+                            {{.Name}}{{if .IsDir}}/{{end}}
+                        </a>
+                    </td>
+                    <td class="size">{{.Size}}</td>
+                    <td class="modified">{{.ModTime}}</td>
+                </tr>
+{{end}}` +
+		`{{define "foot"}}                {{if .More}}
+                <tr>
+                    <td colspan="3"><a href="{{.More}}">{{.Msg.T "More entries…"}}</a></td>
+                </tr>
+                {{end}}
+            </tbody>
+        </table>
+        {{if .Archive}}<p class="download">⬇️ {{.Msg.T "Download"}}: <a href="?download=zip" download>zip</a> · <a href="?download=tar.gz" download>tar.gz</a></p>{{end}}
+        {{if .Upload}}<form class="upload" method="post" enctype="multipart/form-data">
+            <input type="file" name="file" multiple required>
+            <button type="submit">{{.Msg.T "Upload"}}</button>
+            {{if .Progress}}<progress max="100" value="0" hidden></progress>{{end}}
+        </form>{{end}}
+        {{if and .Upload .Progress}}<script>
+            (function () {
+                var form = document.querySelector('form.upload'), bar = form.querySelector('progress');
+                form.addEventListener('submit', function () {
+                    // O formulário segue normalmente; o EventSource acompanha pelo ID
+                    var id = Date.now().toString(36) + Math.random().toString(36).slice(2);
+                    form.action = '?upload_id=' + id;
+                    bar.hidden = false;
+                    var events = new EventSource({{.Progress}} + '?id=' + id);
+                    events.addEventListener('progress', function (e) {
+                        var report = JSON.parse(e.data);
+                        if (report.total > 0) {
+                            bar.value = report.percent;
+                            bar.title = Math.round(report.percent) + '%' + (report.eta ? ' · ' + Math.ceil(report.eta) + 's' : '');
+                        }
+                    });
+                    ['done', 'error', 'timeout'].forEach(function (name) {
+                        events.addEventListener(name, function () { events.close(); });
+                    });
+                });
+            })();
+        </script>{{end}}
+    </div>
+    {{with .Theme.Footer}}<footer>{{.}}</footer>{{end}}
+</body>
+</html>{{end}}`))
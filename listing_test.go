@@ -0,0 +1,207 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type listingPage struct {
+	Path     string         `json:"path"`
+	Sorted   bool           `json:"sorted"`
+	Entries  []listingEntry `json:"entries"`
+	Continue string         `json:"continue"`
+}
+
+func newListingTestServer(t testing.TB, root string, configure func(*Config)) *Server {
+	t.Helper()
+	config := DefaultConfig()
+	config.Server.RootDir = root
+	config.Performance.EnableCompression = false
+	config.Features.DirectoryListing = true
+	if configure != nil {
+		configure(config)
+	}
+
+	logger, _ := NewLogger(&LoggingConfig{Enabled: false})
+	server := NewServer(config, logger)
+	server.setupHandlers()
+	return server
+}
+
+func TestDirectoryListingSorted(t *testing.T) {
+	root := t.TempDir()
+	os.WriteFile(filepath.Join(root, "b.txt"), []byte("b"), 0644)
+	os.WriteFile(filepath.Join(root, "a b.txt"), []byte("a"), 0644)
+	os.Mkdir(filepath.Join(root, "zdir"), 0755)
+	server := newListingTestServer(t, root, nil)
+
+	w := httptest.NewRecorder()
+	server.mux.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	body := w.Body.String()
+	if w.Code != http.StatusOK || !strings.Contains(body, "</html>") {
+		t.Fatalf("Expected complete HTML listing, got %d", w.Code)
+	}
+	zdir, a, b := strings.Index(body, "zdir/"), strings.Index(body, `href="/a%20b.txt"`), strings.Index(body, "b.txt")
+	if zdir < 0 || a < 0 || !(zdir < a && a < b) {
+		t.Errorf("Expected directories first, then files by name")
+	}
+
+	w = httptest.NewRecorder()
+	server.mux.ServeHTTP(w, httptest.NewRequest("GET", "/?format=json", nil))
+	var page listingPage
+	if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil {
+		t.Fatalf("Invalid JSON: %v", err)
+	}
+	if !page.Sorted || len(page.Entries) != 3 || page.Entries[0].Name != "zdir" || page.Continue != "" {
+		t.Errorf("Unexpected JSON listing: %+v", page)
+	}
+}
+
+func TestDirectoryListingStreamingPages(t *testing.T) {
+	root := t.TempDir()
+	total := listingBatch + 50
+	for i := 0; i < total; i++ {
+		os.WriteFile(filepath.Join(root, fmt.Sprintf("f%05d", i)), nil, 0644)
+	}
+	server := newListingTestServer(t, root, func(c *Config) { c.Features.ListingMaxEntries = 600 })
+
+	seen := make(map[string]bool)
+	token, pages := "", 0
+	for {
+		req := httptest.NewRequest("GET", "/?continue="+token, nil)
+		req.Header.Set("Accept", "application/json")
+		w := httptest.NewRecorder()
+		server.mux.ServeHTTP(w, req)
+
+		var page listingPage
+		if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil {
+			t.Fatalf("Invalid JSON on page %d: %v", pages, err)
+		}
+		if page.Sorted {
+			t.Errorf("Expected large directory to be streamed unsorted")
+		}
+		if len(page.Entries) > 600 {
+			t.Errorf("Expected at most 600 entries per page, got %d", len(page.Entries))
+		}
+		for _, e := range page.Entries {
+			seen[e.Name] = true
+		}
+		pages++
+		if page.Continue == "" || pages > 5 {
+			break
+		}
+		token = page.Continue
+	}
+
+	if pages != 2 || len(seen) != total {
+		t.Errorf("Expected %d distinct entries in 2 pages, got %d in %d", total, len(seen), pages)
+	}
+
+	// The HTML listing links to the next page
+	w := httptest.NewRecorder()
+	server.mux.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if !strings.Contains(w.Body.String(), `href="?continue=600"`) {
+		t.Errorf("Expected continue link in HTML listing")
+	}
+
+	w = httptest.NewRecorder()
+	server.mux.ServeHTTP(w, httptest.NewRequest("GET", "/?continue=abc", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for invalid continue token, got %d", w.Code)
+	}
+}
+
+func TestDirectoryListingConditionalGet(t *testing.T) {
+	root := t.TempDir()
+	os.WriteFile(filepath.Join(root, "a.txt"), []byte("a"), 0644)
+	server := newListingTestServer(t, root, func(c *Config) { c.Performance.EnableCompression = true })
+
+	get := func(header, value string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		if header != "" {
+			req.Header.Set(header, value)
+		}
+		w := httptest.NewRecorder()
+		server.mux.ServeHTTP(w, req)
+		return w
+	}
+
+	w := get("", "")
+	etag, lastModified := w.Header().Get("ETag"), w.Header().Get("Last-Modified")
+	if !strings.HasPrefix(etag, `W/"`) || lastModified == "" {
+		t.Fatalf("Expected weak ETag and Last-Modified, got %q %q", etag, lastModified)
+	}
+
+	if w := get("If-None-Match", etag); w.Code != http.StatusNotModified || w.Body.Len() != 0 || w.Header().Get("Content-Encoding") != "" {
+		t.Errorf("Expected bare 304 for matching ETag, got %d (%d bytes, encoding %q)", w.Code, w.Body.Len(), w.Header().Get("Content-Encoding"))
+	}
+	if w := get("If-Modified-Since", lastModified); w.Code != http.StatusNotModified {
+		t.Errorf("Expected 304 for If-Modified-Since, got %d", w.Code)
+	}
+
+	// JSON is a different representation with its own ETag
+	req := httptest.NewRequest("GET", "/?format=json", nil)
+	req.Header.Set("If-None-Match", etag)
+	w = httptest.NewRecorder()
+	server.mux.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected 200 for JSON listing with HTML ETag, got %d", w.Code)
+	}
+
+	// Changing an entry (without touching the directory) changes the ETag
+	os.WriteFile(filepath.Join(root, "a.txt"), []byte("changed"), 0644)
+	if w := get("If-None-Match", etag); w.Code != http.StatusOK {
+		t.Errorf("Expected 200 after entry changed, got %d", w.Code)
+	}
+}
+
+func TestDirectoryListingSortColumns(t *testing.T) {
+	root := t.TempDir()
+	os.WriteFile(filepath.Join(root, "small.txt"), []byte("a"), 0644)
+	os.WriteFile(filepath.Join(root, "big.txt"), []byte("aaaaaaaaaa"), 0644)
+	os.WriteFile(filepath.Join(root, "medium.txt"), []byte("aaaaa"), 0644)
+	os.Mkdir(filepath.Join(root, "dir"), 0755)
+	server := newListingTestServer(t, root, nil)
+
+	w := httptest.NewRecorder()
+	server.mux.ServeHTTP(w, httptest.NewRequest("GET", "/?format=json&sort=size&order=desc", nil))
+	var page listingPage
+	if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil {
+		t.Fatalf("Invalid JSON: %v", err)
+	}
+	var names []string
+	for _, e := range page.Entries {
+		names = append(names, e.Name)
+	}
+	if strings.Join(names, ",") != "dir,big.txt,medium.txt,small.txt" {
+		t.Errorf("Expected directories first, then files by size descending, got %v", names)
+	}
+
+	w = httptest.NewRecorder()
+	server.mux.ServeHTTP(w, httptest.NewRequest("GET", "/?sort=size&order=desc", nil))
+	if !strings.Contains(w.Body.String(), `href="?sort=size&amp;order=asc"`) {
+		t.Errorf("Expected the size header to toggle to ascending order")
+	}
+}
+
+func TestDirectoryListingBreadcrumbs(t *testing.T) {
+	root := t.TempDir()
+	writeTestFile(t, filepath.Join(root, "a b", "c", "photo.png"), "png")
+	server := newListingTestServer(t, root, nil)
+
+	w := httptest.NewRecorder()
+	server.mux.ServeHTTP(w, httptest.NewRequest("GET", "/a%20b/c/", nil))
+	body := w.Body.String()
+	for _, want := range []string{`<a href="/">/</a>`, `<a href="/a%20b/">a b</a>`, `<a href="/a%20b/c/">c</a>`, "🖼️"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected listing to contain %q", want)
+		}
+	}
+}
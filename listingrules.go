@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ListingRules curadoria das listagens de diretório: entradas ocultas (e
+// opcionalmente ainda servidas) e entradas fixadas no topo
+type ListingRules struct {
+	config *ListingConfig
+}
+
+// NewListingRules valida as regras de listagem
+func NewListingRules(config *ListingConfig) (*ListingRules, error) {
+	for i, rule := range config.Hide {
+		if len(rule.Paths) == 0 {
+			return nil, fmt.Errorf("listing.hide[%d]: paths is required", i)
+		}
+		for _, pattern := range rule.Paths {
+			if strings.TrimSuffix(pattern, "/") == "" {
+				return nil, fmt.Errorf("listing.hide[%d]: empty pattern", i)
+			}
+		}
+	}
+	for i, pattern := range config.Pin {
+		if strings.TrimSuffix(pattern, "/") == "" {
+			return nil, fmt.Errorf("listing.pin[%d]: empty pattern", i)
+		}
+	}
+	return &ListingRules{config: config}, nil
+}
+
+// matchEntry casa um padrão com uma entrada: padrões com "/" casam com o
+// caminho da URL, os demais só com o nome; "/" no fim restringe a diretórios
+func matchEntry(pattern, urlPath, name string, isDir func() bool) bool {
+	dirOnly := strings.HasSuffix(pattern, "/")
+	pattern = strings.TrimSuffix(pattern, "/")
+	target := name
+	if strings.Contains(pattern, "/") {
+		target = urlPath
+	}
+	return matchGlob(pattern, target) && (!dirOnly || isDir())
+}
+
+// hideRule retorna a regra que oculta a entrada name de dir, se houver
+func (l *ListingRules) hideRule(root, dir, name string) (ListingHideRule, bool) {
+	if len(l.config.Hide) == 0 {
+		return ListingHideRule{}, false
+	}
+	path := filepath.Join(dir, name)
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return ListingHideRule{}, false
+	}
+	urlPath := "/" + filepath.ToSlash(rel)
+	isDir := func() bool {
+		info, err := os.Stat(path)
+		return err == nil && info.IsDir()
+	}
+	for _, rule := range l.config.Hide {
+		for _, pattern := range rule.Paths {
+			if matchEntry(pattern, urlPath, name, isDir) {
+				return rule, true
+			}
+		}
+	}
+	return ListingHideRule{}, false
+}
+
+// Hidden informa se a entrada name de dir fica fora das listagens
+func (l *ListingRules) Hidden(root, dir, name string) bool {
+	_, hidden := l.hideRule(root, dir, name)
+	return hidden
+}
+
+// Blocked informa se o caminho (ou um diretório acima dele) está oculto sem
+// permissão para ser servido
+func (l *ListingRules) Blocked(root, path string) bool {
+	for ; path != root && isWithin(root, path); path = filepath.Dir(path) {
+		if rule, hidden := l.hideRule(root, filepath.Dir(path), filepath.Base(path)); hidden && !rule.Serve {
+			return true
+		}
+	}
+	return false
+}
+
+// pinRank retorna a posição da entrada entre as fixadas (-1 se não for fixada)
+func (l *ListingRules) pinRank(urlPath, name string, isDir bool) int {
+	for i, pattern := range l.config.Pin {
+		if matchEntry(pattern, urlPath, name, func() bool { return isDir }) {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func TestListingRulesHideAndPin(t *testing.T) {
+	root := t.TempDir()
+	writeTestFile(t, filepath.Join(root, "releases", "app-1.0.tar.gz"), "1.0")
+	writeTestFile(t, filepath.Join(root, "releases", "app-1.0.tar.gz.sha256"), "sum")
+	writeTestFile(t, filepath.Join(root, "releases", "README"), "readme")
+	writeTestFile(t, filepath.Join(root, "releases", "LATEST", "app.tar.gz"), "latest")
+	writeTestFile(t, filepath.Join(root, "releases", "drafts", "next.tar.gz"), "next")
+	writeTestFile(t, filepath.Join(root, "releases", "archive", "old.tar.gz"), "old")
+
+	server := newListingTestServer(t, root, func(c *Config) {
+		c.Features.Listing = &ListingConfig{
+			Hide: []ListingHideRule{
+				{Paths: []string{"/releases/*.sha256"}, Serve: true},
+				{Paths: []string{"drafts/"}},
+			},
+			Pin: []string{"LATEST/", "README*"},
+		}
+	})
+
+	w := httptest.NewRecorder()
+	server.mux.ServeHTTP(w, httptest.NewRequest("GET", "/releases/?format=json", nil))
+	var page listingPage
+	if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil {
+		t.Fatalf("Invalid JSON: %v", err)
+	}
+	var names []string
+	for _, e := range page.Entries {
+		names = append(names, e.Name)
+	}
+	want := []string{"LATEST", "README", "archive", "app-1.0.tar.gz"}
+	if len(names) != len(want) {
+		t.Fatalf("Expected %v, got %v", want, names)
+	}
+	for i := range want {
+		if names[i] != want[i] {
+			t.Errorf("Expected %v, got %v", want, names)
+			break
+		}
+	}
+
+	// Hidden with serve: still downloadable
+	w = httptest.NewRecorder()
+	server.mux.ServeHTTP(w, httptest.NewRequest("GET", "/releases/app-1.0.tar.gz.sha256", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected 200 for hidden but served file, got %d", w.Code)
+	}
+
+	// Hidden without serve: the directory and everything below it is 404
+	for _, path := range []string{"/releases/drafts/", "/releases/drafts/next.tar.gz"} {
+		w = httptest.NewRecorder()
+		server.mux.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if w.Code != http.StatusNotFound {
+			t.Errorf("Expected 404 for %s, got %d", path, w.Code)
+		}
+	}
+}
+
+func TestListingRulesValidation(t *testing.T) {
+	if _, err := NewListingRules(&ListingConfig{Hide: []ListingHideRule{{}}}); err == nil {
+		t.Error("Expected error for hide rule without paths")
+	}
+	if _, err := NewListingRules(&ListingConfig{Pin: []string{"/"}}); err == nil {
+		t.Error("Expected error for empty pin pattern")
+	}
+}
@@ -5,9 +5,14 @@ import (
 	"io"
 	"log"
 	"os"
+	"strings"
+	"sync/atomic"
 	"time"
 )
 
+// logLevels níveis de log aceitos
+var logLevels = map[string]bool{"debug": true, "info": true, "warn": true, "error": true}
+
 // Logger gerencia os logs da aplicação
 type Logger struct {
 	config      *LoggingConfig
@@ -16,6 +21,7 @@ type Logger struct {
 	infoLog     *log.Logger
 	debugLog    *log.Logger
 	colorOutput bool
+	level       atomic.Pointer[string] // alterável em tempo de execução
 }
 
 // Cores ANSI
@@ -37,6 +43,8 @@ func NewLogger(config *LoggingConfig) (*Logger, error) {
 		config:      config,
 		colorOutput: config.ColorOutput,
 	}
+	level := config.Level
+	logger.level.Store(&level)
 
 	var writer io.Writer = os.Stdout
 
@@ -58,6 +66,20 @@ func NewLogger(config *LoggingConfig) (*Logger, error) {
 	return logger, nil
 }
 
+// Level retorna o nível de log atual
+func (l *Logger) Level() string {
+	return *l.level.Load()
+}
+
+// SetLevel altera o nível de log sem reiniciar o servidor
+func (l *Logger) SetLevel(level string) error {
+	if !logLevels[level] {
+		return fmt.Errorf("invalid log level %q (use debug, info, warn or error)", level)
+	}
+	l.level.Store(&level)
+	return nil
+}
+
 // colorize adiciona cor ao texto se habilitado
 func (l *Logger) colorize(color, text string) string {
 	if l.colorOutput {
@@ -114,7 +136,7 @@ func (l *Logger) Info(format string, v ...interface{}) {
 		return
 	}
 
-	if l.config.Level == "error" || l.config.Level == "warn" {
+	if level := l.Level(); level == "error" || level == "warn" {
 		return
 	}
 
@@ -131,7 +153,7 @@ func (l *Logger) Warn(format string, v ...interface{}) {
 		return
 	}
 
-	if l.config.Level == "error" {
+	if l.Level() == "error" {
 		return
 	}
 
@@ -144,7 +166,7 @@ func (l *Logger) Warn(format string, v ...interface{}) {
 
 // Debug registra um log de debug
 func (l *Logger) Debug(format string, v ...interface{}) {
-	if !l.config.Enabled || l.config.Level != "debug" {
+	if !l.config.Enabled || l.Level() != "debug" {
 		return
 	}
 
@@ -156,7 +178,7 @@ func (l *Logger) Debug(format string, v ...interface{}) {
 }
 
 // PrintBanner imprime o banner de inicialização
-func (l *Logger) PrintBanner(config *Config) {
+func (l *Logger) PrintBanner(config *Config, addrs []ListenAddr) {
 	if !l.config.Enabled {
 		return
 	}
@@ -177,8 +199,9 @@ func (l *Logger) PrintBanner(config *Config) {
 
 	l.Info("Server starting...")
 	l.Info("Protocol: %s", protocol)
-	l.Info("Host: %s", config.Server.Host)
-	l.Info("Port: %d", config.Server.Port)
+	for _, addr := range addrs {
+		l.Info("Listen: %s", addr)
+	}
 	l.Info("Root Directory: %s", config.Server.RootDir)
 	l.Info("Directory Listing: %v", config.Features.DirectoryListing)
 	l.Info("SPA Mode: %v", config.Features.SPAMode)
@@ -187,24 +210,32 @@ func (l *Logger) PrintBanner(config *Config) {
 		l.Info("Basic Auth: Enabled")
 	}
 
+	if pa := config.Security.ProxyAuth; pa != nil && pa.Enabled {
+		l.Info("Proxy Auth: trusting %s", strings.Join(pa.TrustedProxies, ", "))
+	}
+
 	if config.Security.CORS != nil && config.Security.CORS.Enabled {
 		l.Info("CORS: Enabled")
 	}
 
 	if config.Security.RateLimit != nil && config.Security.RateLimit.Enabled {
-		l.Info("Rate Limit: %d req/min", config.Security.RateLimit.RequestsPerIP)
+		l.Info("Rate Limit: %d req/min per IP, %d rules", config.Security.RateLimit.RequestsPerIP, len(config.Security.RateLimit.Rules))
 	}
 
 	if config.Performance.EnableCompression {
-		l.Info("Compression: Enabled (level %d)", config.Performance.CompressionLevel)
+		encodings := defaultCompressionEncodings
+		if cc := config.Performance.Compression; cc != nil && len(cc.Encodings) > 0 {
+			encodings = cc.Encodings
+		}
+		l.Info("Compression: Enabled (%s; gzip level %d)", strings.Join(encodings, ", "), config.Performance.CompressionLevel)
 	}
 
 	fmt.Println()
-	l.Info("%s Server running at %s://%s:%d",
-		l.colorize(colorGreen, "✓"),
-		protocol,
-		config.Server.Host,
-		config.Server.Port)
+	for _, addr := range addrs {
+		l.Info("%s Server running at %s",
+			l.colorize(colorGreen, "✓"),
+			addr.URL(strings.ToLower(protocol)))
+	}
 	l.Info("Press Ctrl+C to stop")
 	fmt.Println()
 }
@@ -0,0 +1,26 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// watchLogLevelSignals alterna o nível de log por sinais: SIGUSR1 ativa
+// debug e SIGUSR2 volta para info
+func watchLogLevelSignals(logger *Logger) {
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGUSR1, syscall.SIGUSR2)
+	go func() {
+		for sig := range sigChan {
+			level := "info"
+			if sig == syscall.SIGUSR1 {
+				level = "debug"
+			}
+			logger.SetLevel(level)
+			logger.Warn("Log level set to %s (%v)", level, sig)
+		}
+	}()
+}
@@ -0,0 +1,4 @@
+package main
+
+// watchLogLevelSignals não faz nada no Windows (sem SIGUSR1/SIGUSR2); use a API administrativa
+func watchLogLevelSignals(logger *Logger) {}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"encoding/binary"
+	"math/bits"
+	"sort"
+)
+
+// Parâmetros comuns dos encoders brotli e zstd: referências até lzWindow
+// bytes para trás, comprimindo lzBlock bytes de cada vez
+const (
+	lzWindow   = 64 << 10
+	lzBlock    = 64 << 10
+	lzHashBits = 15
+	lzMinMatch = 4
+	lzMaxMatch = 1 << 16
+)
+
+// lzSequence literais seguidos de uma cópia de length bytes que começa
+// distance bytes antes
+type lzSequence struct {
+	literals int
+	length   int
+	distance int
+}
+
+// lzMatcher encontra repetições (LZ77) por cadeias de hash, como o zlib. buf
+// guarda até lzWindow bytes já comprimidos seguidos dos pendentes
+type lzMatcher struct {
+	buf   []byte
+	start int // início dos bytes pendentes em buf
+	depth int // candidatos examinados por posição
+	head  [1 << lzHashBits]int32
+	prev  [lzWindow]int32 // posição+1 anterior com o mesmo hash, por posição % lzWindow
+}
+
+// newLZMatcher cria o matcher; depth cresce com o nível de compressão
+func newLZMatcher(depth int) *lzMatcher {
+	return &lzMatcher{buf: make([]byte, 0, lzWindow+lzBlock), depth: max(depth, 1)}
+}
+
+// reset descarta o histórico para um novo stream
+func (m *lzMatcher) reset() {
+	m.buf = m.buf[:0]
+	m.start = 0
+	m.head = [1 << lzHashBits]int32{}
+}
+
+// pending retorna quantos bytes aguardam compressão
+func (m *lzMatcher) pending() int {
+	return len(m.buf) - m.start
+}
+
+// fill copia de p o que couber no bloco atual; compress deve ser chamado
+// quando o bloco encher
+func (m *lzMatcher) fill(p []byte) int {
+	if len(m.buf) == cap(m.buf) {
+		m.slide()
+	}
+	n := min(min(len(p), lzBlock-m.pending()), cap(m.buf)-len(m.buf))
+	m.buf = append(m.buf, p[:n]...)
+	return n
+}
+
+// slide descarta o histórico além de lzWindow (sempre um múltiplo de
+// lzWindow, o que mantém os índices de prev)
+func (m *lzMatcher) slide() {
+	delta := len(m.buf) - lzWindow
+	copy(m.buf, m.buf[delta:])
+	m.buf = m.buf[:lzWindow]
+	m.start -= delta
+	for i, v := range m.head {
+		m.head[i] = max(v-int32(delta), 0)
+	}
+	for i, v := range m.prev {
+		m.prev[i] = max(v-int32(delta), 0)
+	}
+}
+
+func lzHash(b []byte) uint32 {
+	return (binary.LittleEndian.Uint32(b) * 2654435761) >> (32 - lzHashBits)
+}
+
+// insert registra a posição i nas cadeias de hash
+func (m *lzMatcher) insert(i int) {
+	h := lzHash(m.buf[i:])
+	m.prev[i%lzWindow] = m.head[h]
+	m.head[h] = int32(i + 1)
+}
+
+// matchLen conta os bytes iguais no começo de a e b
+func matchLen(a, b []byte) int {
+	n := 0
+	for len(a) >= 8 && len(b) >= 8 {
+		if x := binary.LittleEndian.Uint64(a) ^ binary.LittleEndian.Uint64(b); x != 0 {
+			return n + bits.TrailingZeros64(x)/8
+		}
+		a, b, n = a[8:], b[8:], n+8
+	}
+	for i := 0; i < len(a) && i < len(b) && a[i] == b[i]; i++ {
+		n++
+	}
+	return n
+}
+
+// compress divide os bytes pendentes em sequências, acrescentadas a seqs, e
+// retorna também quantos literais sobram depois da última cópia e os bytes
+// do bloco. Os pendentes passam a ser histórico
+func (m *lzMatcher) compress(seqs []lzSequence) ([]lzSequence, int, []byte) {
+	end := len(m.buf)
+	block := m.buf[m.start:end]
+	lit := 0
+	for i := m.start; i < end; {
+		if i+lzMinMatch > end {
+			lit += end - i
+			break
+		}
+		best, dist := 0, 0
+		limit := min(end-i, lzMaxMatch)
+		cand := int(m.head[lzHash(m.buf[i:])]) - 1
+		for tries := m.depth; cand >= 0 && tries > 0 && i-cand <= lzWindow; tries-- {
+			if m.buf[cand+best] == m.buf[i+best] {
+				if l := matchLen(m.buf[cand:cand+limit], m.buf[i:i+limit]); l > best {
+					best, dist = l, i-cand
+					if l == limit {
+						break
+					}
+				}
+			}
+			next := int(m.prev[cand%lzWindow]) - 1
+			if next >= cand {
+				break
+			}
+			cand = next
+		}
+		m.insert(i)
+		if best < lzMinMatch {
+			lit++
+			i++
+			continue
+		}
+		seqs = append(seqs, lzSequence{literals: lit, length: best, distance: dist})
+		for j := i + 1; j < i+best && j+lzMinMatch <= end; j++ {
+			m.insert(j)
+		}
+		i += best
+		lit = 0
+	}
+	m.start = end
+	return seqs, lit, block
+}
+
+// lzDepth converte o nível de compressão em candidatos examinados
+func lzDepth(level int) int {
+	return min(max(level*level, 1), 512)
+}
+
+// huffmanLengths calcula comprimentos de código de Huffman limitados a
+// maxBits; símbolos sem ocorrências ficam com 0. Com um único símbolo, ele
+// recebe comprimento 1
+func huffmanLengths(freq []int, maxBits int) []uint8 {
+	lengths := make([]uint8, len(freq))
+	var symbols []int
+	for s, f := range freq {
+		if f > 0 {
+			symbols = append(symbols, s)
+		}
+	}
+	switch len(symbols) {
+	case 0:
+		return lengths
+	case 1:
+		lengths[symbols[0]] = 1
+		return lengths
+	}
+
+	weights := make([]int, len(symbols))
+	for i, s := range symbols {
+		weights[i] = freq[s]
+	}
+	for {
+		depths := huffmanDepths(weights)
+		longest := 0
+		for _, d := range depths {
+			longest = max(longest, d)
+		}
+		if longest <= maxBits {
+			for i, s := range symbols {
+				lengths[s] = uint8(depths[i])
+			}
+			return lengths
+		}
+		// Aproxima as frequências até a árvore caber no limite
+		for i := range weights {
+			weights[i] = weights[i]/2 + 1
+		}
+	}
+}
+
+// huffmanDepths profundidade de cada folha da árvore de Huffman dos pesos
+func huffmanDepths(weights []int) []int {
+	n := len(weights)
+	order := make([]int, n)
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return weights[order[a]] < weights[order[b]] })
+
+	// Duas filas: folhas em ordem e nós internos na ordem de criação
+	parent := make([]int, 2*n-1)
+	weight := make([]int, 2*n-1)
+	for i, leaf := range order {
+		weight[i] = weights[leaf]
+	}
+	leaf, node := 0, n
+	next := n
+	pick := func() int {
+		if leaf < n && (node >= next || weight[leaf] <= weight[node]) {
+			leaf++
+			return leaf - 1
+		}
+		node++
+		return node - 1
+	}
+	for ; next < 2*n-1; next++ {
+		a, b := pick(), pick()
+		weight[next] = weight[a] + weight[b]
+		parent[a], parent[b] = next, next
+	}
+
+	depth := make([]int, 2*n-1)
+	for i := 2*n - 3; i >= 0; i-- {
+		depth[i] = depth[parent[i]] + 1
+	}
+	depths := make([]int, n)
+	for i, leaf := range order {
+		depths[leaf] = depth[i]
+	}
+	return depths
+}
+
+// bitWriter grava campos de bits a partir do bit menos significativo, como
+// brotli e zstd esperam
+type bitWriter struct {
+	out   []byte
+	acc   uint64
+	nbits uint
+}
+
+// write grava os n bits menos significativos de v (n <= 32)
+func (b *bitWriter) write(v uint64, n uint) {
+	b.acc |= (v & (1<<n - 1)) << b.nbits
+	b.nbits += n
+	for b.nbits >= 8 {
+		b.out = append(b.out, byte(b.acc))
+		b.acc >>= 8
+		b.nbits -= 8
+	}
+}
+
+// align completa o último byte com zeros
+func (b *bitWriter) align() {
+	if b.nbits > 0 {
+		b.out = append(b.out, byte(b.acc))
+		b.acc, b.nbits = 0, 0
+	}
+}
+
+// highBit posição do bit mais significativo de v (v > 0)
+func highBit(v uint32) int {
+	return 31 - bits.LeadingZeros32(v)
+}
@@ -1,23 +1,50 @@
 package main
 
 import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
 	"flag"
 	"fmt"
+	"net/url"
 	"os"
 	"os/signal"
+	"path"
+	"regexp"
+	"strings"
 	"syscall"
 )
 
 var version = "dev" // set via ldflags during build
 
 func main() {
+	// Subcomando de benchmark
+	if len(os.Args) > 1 && os.Args[1] == "bench" {
+		os.Exit(runBench(os.Args[2:], os.Stdout, os.Stderr))
+	}
+
+	// Subcomando do relay de túneis
+	if len(os.Args) > 1 && os.Args[1] == "relay" {
+		os.Exit(runRelay(os.Args[2:], os.Stdout, os.Stderr))
+	}
+
 	// Flags de linha de comando
 	configFile := flag.String("config", "", "Path to configuration file (JSON)")
 	port := flag.Int("port", 0, "Port to listen on (overrides config)")
-	host := flag.String("host", "", "Host to bind to (overrides config)")
+	host := flag.String("host", "", "Host(s) to bind to, comma-separated (overrides config)")
 	rootDir := flag.String("dir", "", "Root directory to serve (overrides config)")
 	enableListing := flag.Bool("list", false, "Enable directory listing")
+	lanShare := flag.Bool("share", false, "LAN sharing mode: accept only local hosts and private-range clients")
+	tailscale := flag.Bool("tailscale", false, "Listen only on the Tailscale addresses and log the tailnet user of each request")
+	upnp := flag.Bool("upnp", false, "Map the port on the router (NAT-PMP or UPnP) and print the external URL")
 	generateConfig := flag.String("generate-config", "", "Generate example config file and exit")
+	generateManifest := flag.String("generate-manifest", "", "Generate integrity manifest for a directory and exit")
+	signingKey := flag.String("signing-key", "", "Private key file used to sign the generated manifest")
+	generateSigningKey := flag.String("generate-signing-key", "", "Generate manifest signing key file and exit")
+	tunnelRelay := flag.String("tunnel", "", "Serve through a relay started with \"qserv relay\" (host:port)")
+	tunnelToken := flag.String("tunnel-token", os.Getenv("QSERV_TUNNEL_TOKEN"), "Token for -tunnel (default: $QSERV_TUNNEL_TOKEN)")
 	showVersion := flag.Bool("version", false, "Show version and exit")
 	showHelp := flag.Bool("help", false, "Show help and exit")
 
@@ -45,6 +72,42 @@ func main() {
 		os.Exit(0)
 	}
 
+	// Gera chave para assinatura de manifestos
+	if *generateSigningKey != "" {
+		publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+		if err == nil {
+			err = os.WriteFile(*generateSigningKey, []byte(base64.StdEncoding.EncodeToString(privateKey)+"\n"), 0600)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error generating signing key: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Signing key saved to: %s\n", *generateSigningKey)
+		fmt.Printf("Public key (integrity.public_key): %s\n", base64.StdEncoding.EncodeToString(publicKey))
+		os.Exit(0)
+	}
+
+	// Gera manifesto de integridade
+	if *generateManifest != "" {
+		var privateKey ed25519.PrivateKey
+		if *signingKey != "" {
+			data, err := os.ReadFile(*signingKey)
+			if err == nil {
+				privateKey, err = base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+			}
+			if err != nil || len(privateKey) != ed25519.PrivateKeySize {
+				fmt.Fprintf(os.Stderr, "Invalid signing key: %s\n", *signingKey)
+				os.Exit(1)
+			}
+		}
+		if err := GenerateManifest(*generateManifest, ".qserv-manifest.json", privateKey); err != nil {
+			fmt.Fprintf(os.Stderr, "Error generating manifest: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Manifest saved to: %s\n", *generateManifest)
+		os.Exit(0)
+	}
+
 	// Carrega configuração
 	config, err := loadConfiguration(*configFile)
 	if err != nil {
@@ -57,7 +120,12 @@ func main() {
 		config.Server.Port = *port
 	}
 	if *host != "" {
+		// Aceita múltiplos endereços separados por vírgula (ex: 0.0.0.0,::)
 		config.Server.Host = *host
+		config.Server.Hosts = nil
+		if strings.Contains(*host, ",") {
+			config.Server.Hosts = strings.Split(*host, ",")
+		}
 	}
 	if *rootDir != "" {
 		config.Server.RootDir = *rootDir
@@ -65,6 +133,21 @@ func main() {
 	if *enableListing {
 		config.Features.DirectoryListing = true
 	}
+	if *lanShare {
+		config.Server.LANShare = true
+	}
+	if *upnp {
+		config.Server.PortMapping = true
+	}
+	if *tailscale {
+		if config.Tailscale == nil {
+			config.Tailscale = &TailscaleConfig{}
+		}
+		config.Tailscale.Enabled = true
+	}
+	if *tunnelRelay != "" {
+		config.Tunnel = &TunnelConfig{Enabled: true, Relay: *tunnelRelay, Token: *tunnelToken}
+	}
 
 	// Valida configuração
 	if err := validateConfig(config); err != nil {
@@ -72,6 +155,14 @@ func main() {
 		os.Exit(1)
 	}
 
+	// Compartilhamento na tailnet: escuta só nos endereços dela
+	if config.Tailscale != nil && config.Tailscale.Enabled {
+		if err := bindTailnet(config); err != nil {
+			fmt.Fprintf(os.Stderr, "Tailscale: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
 	// Cria o logger
 	logger, err := NewLogger(&config.Logging)
 	if err != nil {
@@ -79,9 +170,33 @@ func main() {
 		os.Exit(1)
 	}
 
+	// SIGUSR1/SIGUSR2 alternam entre debug e info sem reiniciar
+	watchLogLevelSignals(logger)
+
 	// Cria e inicia o servidor
 	server := NewServer(config, logger)
 
+	// Recarga da configuração: SIGHUP, observação do arquivo e API administrativa
+	if *configFile != "" {
+		reloader, err := server.enableReload(*configFile)
+		if err != nil {
+			logger.Error("Configuration reload disabled: %v", err)
+		} else {
+			watchReloadSignal(reloader)
+			if config.Reload != nil && config.Reload.Watch {
+				if err := reloader.Watch(); err != nil {
+					logger.Error("Config watch disabled: %v", err)
+				}
+			}
+		}
+	}
+
+	// Mapeamento da porta no roteador, removido ao encerrar
+	var portMapper *PortMapper
+	if config.Server.PortMapping {
+		portMapper = mapServerPort(config, logger)
+	}
+
 	// Configura handler para SIGINT/SIGTERM
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
@@ -98,10 +213,31 @@ func main() {
 	select {
 	case err := <-errChan:
 		logger.Error("Server error: %v", err)
+		if portMapper != nil {
+			portMapper.Close()
+		}
 		os.Exit(1)
 	case sig := <-sigChan:
-		logger.Info("\nReceived signal %v, shutting down gracefully...", sig)
-		os.Exit(0)
+		timeout := config.Server.GetShutdownTimeout()
+		logger.Info("\nReceived signal %v, shutting down gracefully (waiting up to %s for in-flight requests)...", sig, timeout)
+		// Um segundo sinal encerra sem esperar
+		go func() {
+			<-sigChan
+			logger.Warn("Second signal received, exiting immediately")
+			os.Exit(1)
+		}()
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		err := server.Shutdown(ctx)
+		cancel()
+		code := 0
+		if err != nil {
+			logger.Warn("Shutdown timed out after %s, remaining connections were closed", timeout)
+			code = 1
+		}
+		if portMapper != nil {
+			portMapper.Close()
+		}
+		os.Exit(code)
 	}
 }
 
@@ -126,6 +262,11 @@ func validateConfig(config *Config) error {
 		return fmt.Errorf("invalid port: %d (must be between 1-65535)", config.Server.Port)
 	}
 
+	// Valida endereços de escuta
+	if _, err := config.Server.ListenAddrs(); err != nil {
+		return err
+	}
+
 	// Valida diretório raiz
 	if info, err := os.Stat(config.Server.RootDir); err != nil {
 		return fmt.Errorf("root directory error: %w", err)
@@ -144,6 +285,24 @@ func validateConfig(config *Config) error {
 		if _, err := os.Stat(config.Security.KeyFile); err != nil {
 			return fmt.Errorf("key file not found: %s", config.Security.KeyFile)
 		}
+		if _, err := NewCertMonitor(config.Security.CertMonitor, config.Security.CertFile, nil); err != nil {
+			return err
+		}
+		if oc := config.Security.OCSPStapling; oc != nil && oc.Enabled {
+			if _, err := NewOCSPStapler(oc, config.Security.CertFile, config.Security.KeyFile, nil); err != nil {
+				return err
+			}
+		}
+		if ec := config.Security.ECH; ec != nil && ec.Enabled {
+			if _, err := NewECHKeys(ec); err != nil {
+				return err
+			}
+		}
+		if tc := config.Security.SessionTickets; tc != nil && tc.Enabled {
+			if _, err := NewTicketKeys(tc, nil); err != nil {
+				return err
+			}
+		}
 	}
 
 	// Valida autenticação básica
@@ -156,17 +315,454 @@ func validateConfig(config *Config) error {
 		}
 	}
 
+	// Valida API administrativa
+	if config.Admin != nil && config.Admin.Enabled && config.Admin.Token == "" {
+		return fmt.Errorf("admin API enabled but token not specified")
+	}
+
+	// Valida conteúdo a partir do git
+	if config.Git != nil && config.Git.Enabled && config.Git.Repository == "" {
+		return fmt.Errorf("git source enabled but repository not specified")
+	}
+
+	// Valida hosts permitidos
+	if status := config.Security.UnknownHostStatus; status != 0 && (status < 400 || status > 499) {
+		return fmt.Errorf("invalid unknown_host_status: %d (must be 4xx, e.g. 421 or 404)", status)
+	}
+	for _, host := range config.Security.AllowedHosts {
+		if host == "" || strings.ContainsAny(host, "/ ") {
+			return fmt.Errorf("invalid allowed host: %q", host)
+		}
+	}
+
+	// Valida publicação programada
+	if sc := config.Features.Schedule; sc != nil && sc.Enabled {
+		if _, err := NewSchedule(sc, nil); err != nil {
+			return err
+		}
+	}
+
+	// Valida caminhos removidos
+	if ts := config.Features.Tombstones; ts != nil && ts.Enabled {
+		for _, pattern := range ts.Paths {
+			if !strings.HasPrefix(pattern, "/") {
+				return fmt.Errorf("invalid tombstone path %q (must start with /)", pattern)
+			}
+		}
+		if strings.ContainsAny(ts.MarkerSuffix, `/\`) {
+			return fmt.Errorf("invalid tombstone marker_suffix: %q", ts.MarkerSuffix)
+		}
+	}
+
+	// Valida tema
+	if _, err := NewTheme(config.Features.Theme); err != nil {
+		return err
+	}
+
+	// Valida acompanhamento de logs
+	if tc := config.Features.Tail; tc != nil && tc.Enabled {
+		basicAuth := config.Security.BasicAuth != nil && config.Security.BasicAuth.Enabled
+		if _, err := NewLogTail(tc, basicAuth); err != nil {
+			return err
+		}
+	}
+
+	// Valida trechos de arquivos de texto
+	if ts := config.Features.TextSlices; ts != nil && ts.Enabled && ts.MaxLines < 0 {
+		return fmt.Errorf("invalid text_slices max_lines: %d", ts.MaxLines)
+	}
+
+	// Valida uso de disco
+	if du := config.Features.DiskUsage; du != nil && du.Enabled {
+		if du.CacheTTL < 0 {
+			return fmt.Errorf("invalid disk_usage cache_ttl: %d", du.CacheTTL)
+		}
+		if du.Listing && (config.Index == nil || !config.Index.Enabled) {
+			return fmt.Errorf("disk_usage.listing requires the root index (index.enabled)")
+		}
+	}
+
+	// Valida feeds
+	if config.Feeds != nil && config.Feeds.Enabled {
+		if _, err := NewFeeds(config.Feeds); err != nil {
+			return err
+		}
+	}
+
+	// Valida webhooks de arquivos novos
+	if fw := config.FileWebhooks; fw != nil && fw.Enabled {
+		if _, err := NewFileWebhooks(fw, nil); err != nil {
+			return err
+		}
+	}
+
+	// Valida listener FTP
+	if config.FTP != nil && config.FTP.Enabled {
+		if _, err := NewFTPServer(config.FTP, &config.Security, nil); err != nil {
+			return err
+		}
+	}
+
+	// Valida API de arquivos
+	if config.FileAPI != nil && config.FileAPI.Enabled {
+		if _, err := NewFileAPI(config.FileAPI); err != nil {
+			return err
+		}
+	}
+
+	// Valida zsync
+	if zc := config.Features.Zsync; zc != nil && zc.Enabled {
+		if _, err := NewZsync(zc, nil); err != nil {
+			return err
+		}
+	}
+
+	// Valida repositórios de pacotes
+	if pc := config.Features.PackageRepos; pc != nil && pc.Enabled {
+		if _, err := NewPackageRepos(pc, nil); err != nil {
+			return err
+		}
+	}
+
+	// Valida registry OCI
+	if config.Registry != nil && config.Registry.Enabled {
+		if _, err := NewRegistry(config.Registry); err != nil {
+			return err
+		}
+	}
+
+	// Valida espelho de módulos Go
+	if config.GoProxy != nil && config.GoProxy.Enabled {
+		if _, err := NewGoProxy(config.GoProxy); err != nil {
+			return err
+		}
+	}
+
+	// Valida índice PyPI
+	if config.PyPI != nil && config.PyPI.Enabled {
+		if _, err := NewPyPI(config.PyPI); err != nil {
+			return err
+		}
+	}
+
+	// Valida registry npm
+	if config.Npm != nil && config.Npm.Enabled {
+		if _, err := NewNpm(config.Npm, nil); err != nil {
+			return err
+		}
+	}
+
+	// Valida repositório Maven
+	if config.Maven != nil && config.Maven.Enabled {
+		if _, err := NewMaven(config.Maven, &config.Security); err != nil {
+			return err
+		}
+	}
+
+	// Valida probe
+	if config.Probe != nil && config.Probe.Enabled {
+		if _, err := NewProbe(config.Probe); err != nil {
+			return err
+		}
+	}
+
+	// Valida cluster (o cookie do desafio precisa valer em todos os nós)
+	if config.Cluster != nil && config.Cluster.Enabled {
+		if _, err := NewCluster(config.Cluster, nil); err != nil {
+			return err
+		}
+		if ch := config.Security.Challenge; ch != nil && ch.Enabled && ch.CookieSecret == "" {
+			return fmt.Errorf("cluster mode requires security.challenge.cookie_secret")
+		}
+	}
+
+	// Valida Redis (guarda as mesmas cotas que o cluster; só um dos dois)
+	if config.Redis != nil && config.Redis.Enabled {
+		if _, err := NewRedisStore(config.Redis, nil); err != nil {
+			return err
+		}
+		if config.Cluster != nil && config.Cluster.Enabled {
+			return fmt.Errorf("redis and cluster cannot both be enabled")
+		}
+	}
+
+	// Valida túnel
+	if config.Tunnel != nil && config.Tunnel.Enabled {
+		if err := config.Tunnel.validate(); err != nil {
+			return err
+		}
+	}
+
+	// Valida identidade via proxy
+	if pa := config.Security.ProxyAuth; pa != nil && pa.Enabled {
+		if _, err := NewProxyAuth(pa, nil); err != nil {
+			return err
+		}
+	}
+
+	// Valida tailnet
+	if config.Tailscale != nil && config.Tailscale.Enabled {
+		if config.Server.LANShare || config.Server.PortMapping || config.Tunnel != nil && config.Tunnel.Enabled {
+			return fmt.Errorf("tailscale cannot be combined with lan_share, port_mapping or tunnel")
+		}
+		for _, pattern := range config.Tailscale.AllowedUsers {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("tailscale: invalid allowed_users pattern %q", pattern)
+			}
+		}
+	}
+
+	// Valida idioma das páginas embutidas
+	if lang := config.Features.Language; lang != "" {
+		if _, ok := supportedLanguage(lang); !ok {
+			return fmt.Errorf("unsupported features.language %q", lang)
+		}
+	}
+
+	// Valida regras de listagem
+	if lc := config.Features.Listing; lc != nil {
+		if _, err := NewListingRules(lc); err != nil {
+			return err
+		}
+	}
+
+	// Valida endpoint endereçado por conteúdo
+	if ca := config.Features.ContentAddress; ca != nil && ca.Enabled && ca.Prefix != "" {
+		if !strings.HasPrefix(ca.Prefix, "/") || !strings.HasSuffix(ca.Prefix, "/") || ca.Prefix == "/" {
+			return fmt.Errorf("features.content_address.prefix must start and end with / (e.g. /=/)")
+		}
+	}
+
+	// Valida quotas
+	if _, err := NewQuotas(config.Features.Quotas); err != nil {
+		return err
+	}
+
+	// Valida uploads
+	if uc := config.Features.Uploads; uc != nil && uc.Enabled {
+		if _, err := NewUploads(uc); err != nil {
+			return err
+		}
+	}
+
+	// Valida limites de download
+	if _, err := NewDownloadLimits(config.Features.DownloadLimits); err != nil {
+		return err
+	}
+
+	// Valida WebDAV
+	if wc := config.Features.WebDAV; wc != nil && wc.Enabled {
+		if _, err := NewWebDAV(wc); err != nil {
+			return err
+		}
+	}
+
+	// Valida mirrors
+	if config.Mirrors != nil && config.Mirrors.Enabled {
+		if err := validateMirrors(config.Mirrors); err != nil {
+			return err
+		}
+	}
+
+	// Valida janelas de horário
+	if _, err := NewTimeWindows(config.Security.TimeWindows); err != nil {
+		return err
+	}
+
+	// Valida regras de rate limiting
+	if rl := config.Security.RateLimit; rl != nil && rl.Enabled {
+		if _, err := NewRateLimitRules(rl.Rules, nil); err != nil {
+			return err
+		}
+	}
+
+	// Valida sessões de download
+	if dc := config.Features.DownloadSessions; dc != nil && dc.Enabled {
+		if _, err := NewDownloadSessions(dc); err != nil {
+			return err
+		}
+	}
+
+	// Valida cache em memória
+	if mc := config.Performance.MemoryCache; mc != nil && mc.Enabled {
+		if _, err := NewMemoryCache(mc, nil); err != nil {
+			return err
+		}
+	}
+
+	// Valida cookies assinados
+	if sc := config.Security.SignedCookies; sc != nil && sc.Enabled {
+		if _, err := NewSignedCookies(sc); err != nil {
+			return err
+		}
+	}
+
+	// Valida proteção contra hotlinking
+	if hc := config.Security.Hotlink; hc != nil && hc.Enabled {
+		if _, err := NewHotlink(hc); err != nil {
+			return err
+		}
+	}
+
+	// Valida filtros de requisição
+	if f := config.Security.RequestFilter; f != nil && f.Enabled {
+		for _, status := range []int{f.MethodStatus, f.URLStatus, f.HostStatus} {
+			if status != 0 && (status < 400 || status > 599) {
+				return fmt.Errorf("invalid request filter status: %d (must be 4xx or 5xx)", status)
+			}
+		}
+		for _, rule := range f.Headers {
+			if rule.Header == "" {
+				return fmt.Errorf("request filter header rule requires header")
+			}
+			if rule.Pattern == "" && !rule.Missing {
+				return fmt.Errorf("request filter rule for %s requires pattern or missing", rule.Header)
+			}
+			if _, err := regexp.Compile(rule.Pattern); err != nil {
+				return fmt.Errorf("invalid request filter pattern for %s: %v", rule.Header, err)
+			}
+			if rule.Status != 0 && (rule.Status < 400 || rule.Status > 599) {
+				return fmt.Errorf("invalid request filter status: %d (must be 4xx or 5xx)", rule.Status)
+			}
+		}
+	}
+
+	// Valida /.well-known/
+	if wk := config.WellKnown; wk != nil && wk.Enabled {
+		for resource, jrd := range wk.WebFinger {
+			var doc map[string]json.RawMessage
+			if err := json.Unmarshal(jrd, &doc); err != nil {
+				return fmt.Errorf("webfinger entry for %q must be a JSON object", resource)
+			}
+		}
+	}
+
+	// Valida desafio captcha
+	if c := config.Security.Challenge; c != nil && c.Enabled {
+		if _, ok := challengeProviders[c.Provider]; !ok {
+			return fmt.Errorf("invalid challenge provider: %q (must be turnstile or hcaptcha)", c.Provider)
+		}
+		if c.SiteKey == "" || c.Secret == "" {
+			return fmt.Errorf("challenge enabled but site_key or secret not specified")
+		}
+	}
+
+	// Valida webhook de deploy
+	if config.Deploy != nil && config.Deploy.Enabled {
+		if config.Deploy.Token == "" && config.Deploy.Secret == "" {
+			return fmt.Errorf("deploy webhook enabled but neither token nor secret specified")
+		}
+		switch config.Deploy.Action {
+		case "git":
+			if config.Git == nil || !config.Git.Enabled {
+				return fmt.Errorf("deploy action git requires the git source to be enabled")
+			}
+		case "rsync":
+			if config.Deploy.Source == "" {
+				return fmt.Errorf("deploy action rsync requires source")
+			}
+		case "upload":
+		default:
+			return fmt.Errorf("invalid deploy action: %q (must be git, rsync or upload)", config.Deploy.Action)
+		}
+	}
+
+	// Valida verificação de integridade
+	if config.Integrity != nil && config.Integrity.Enabled {
+		key, err := base64.StdEncoding.DecodeString(config.Integrity.PublicKey)
+		if err != nil || len(key) != ed25519.PublicKeySize {
+			return fmt.Errorf("integrity enabled but public_key is not a base64 ed25519 public key")
+		}
+		if config.Integrity.Mode != "" && config.Integrity.Mode != "refuse" && config.Integrity.Mode != "flag" {
+			return fmt.Errorf("invalid integrity mode: %q (must be refuse or flag)", config.Integrity.Mode)
+		}
+	}
+
+	// Valida espelhos pull-through
+	for _, pt := range config.PullThrough {
+		if !strings.HasPrefix(pt.Prefix, "/") {
+			return fmt.Errorf("pull_through prefix must start with /: %q", pt.Prefix)
+		}
+		u, err := url.Parse(pt.Upstream)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("pull_through %s: invalid upstream URL: %q", pt.Prefix, pt.Upstream)
+		}
+	}
+
+	// Valida reverse proxy
+	for i := range config.Proxy {
+		if _, err := NewProxyBackend(&config.Proxy[i], nil); err != nil {
+			return fmt.Errorf("proxy %s: %w", config.Proxy[i].Prefix, err)
+		}
+	}
+
+	// Valida normalização Unicode
+	switch strings.ToLower(config.Features.UnicodeNormalization) {
+	case "", "nfc", "nfd":
+	default:
+		return fmt.Errorf("invalid unicode_normalization: %q (must be nfc or nfd)", config.Features.UnicodeNormalization)
+	}
+
+	// Valida limites por host
+	if _, err := NewHostLimits(config.Performance.HostLimits, 0); err != nil {
+		return err
+	}
+
+	// Valida limites de banda dos downloads
+	if tc := config.Performance.Throttle; tc != nil && tc.Enabled {
+		if _, err := NewThrottle(tc, 0); err != nil {
+			return err
+		}
+	}
+
+	// Valida limites de leitura em disco
+	if dc := config.Performance.DiskIO; dc != nil && dc.Enabled {
+		if _, err := NewDiskIO(dc); err != nil {
+			return err
+		}
+	}
+
+	// Valida estratégia de ETag
+	if ec := config.Performance.ETag; ec != nil {
+		if _, err := NewETagger(ec); err != nil {
+			return err
+		}
+	}
+
 	// Valida nível de compressão
 	if config.Performance.CompressionLevel < 1 || config.Performance.CompressionLevel > 9 {
 		config.Performance.CompressionLevel = 6
 	}
 
+	// Valida encodings de compressão
+	if config.Performance.EnableCompression {
+		if _, err := NewCompression(config.Performance.CompressionLevel, config.Performance.Compression); err != nil {
+			return err
+		}
+	}
+
 	// Valida log level
-	validLevels := map[string]bool{"debug": true, "info": true, "warn": true, "error": true}
-	if !validLevels[config.Logging.Level] {
+	if !logLevels[config.Logging.Level] {
 		config.Logging.Level = "info"
 	}
 
+	// Valida header de diagnóstico
+	if d := config.Logging.DebugHeader; d != nil && d.Enabled && d.Token == "" && len(d.AllowedIPs) == 0 {
+		return fmt.Errorf("logging.debug_header requires a token or allowed_ips")
+	}
+
+	// Valida auditoria da retomada de downloads
+	if ac := config.Logging.ResumeAudit; ac != nil && ac.Enabled {
+		if _, err := NewResumeAudit(ac, nil, nil); err != nil {
+			return err
+		}
+	}
+
+	// Valida hosts virtuais
+	if err := validateVHosts(config); err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -179,6 +775,8 @@ VERSION:
 
 USAGE:
   qserv [options]
+  qserv bench [bench options]
+  qserv relay [relay options]
 
 OPTIONS:
   -config string
@@ -188,7 +786,7 @@ OPTIONS:
         Port to listen on (overrides config)
 
   -host string
-        Host to bind to (overrides config)
+        Host(s) to bind to, comma-separated (overrides config)
 
   -dir string
         Root directory to serve (overrides config)
@@ -196,9 +794,37 @@ OPTIONS:
   -list
         Enable directory listing
 
+  -share
+        LAN sharing mode: accept only requests for this machine's addresses
+        and names (DNS rebinding protection) from private-range clients
+
+  -tailscale
+        Share only on the tailnet: listen on the Tailscale addresses, refuse
+        other clients and log the user and machine of each request
+
+  -upnp
+        Ask the router for a port mapping (NAT-PMP, then UPnP IGD), print
+        the external URL and remove the mapping on shutdown
+
+  -tunnel string
+        Serve through a relay started with "qserv relay" (host:port),
+        without opening ports (works behind NAT)
+
+  -tunnel-token string
+        Token for -tunnel (default: $QSERV_TUNNEL_TOKEN)
+
   -generate-config string
         Generate example config file and exit
 
+  -generate-signing-key string
+        Generate manifest signing key file and exit
+
+  -generate-manifest string
+        Generate integrity manifest for a directory and exit
+
+  -signing-key string
+        Private key file used to sign the generated manifest
+
   -version
         Show version and exit
 
@@ -215,15 +841,74 @@ EXAMPLES:
   # Enable directory listing
   qserv -list
 
+  # Share a directory on the local network
+  qserv -dir ~/Downloads -list -share
+
+  # Share a directory privately with your tailnet
+  qserv -dir ~/share -list -tailscale
+
+  # Share a directory over the internet through the home router
+  qserv -dir ~/share -list -upnp
+
+  # Share a directory from behind NAT through a public relay
+  qserv relay -listen :7000 -public :80 -token s3cret     (on the public host)
+  qserv -dir ~/share -list -tunnel relay.example.com:7000 -tunnel-token s3cret
+
+  # Listen on IPv4 and IPv6 explicitly
+  qserv -host 0.0.0.0,::
+
   # Use configuration file
   qserv -config config.json
 
   # Generate example configuration
   qserv -generate-config config.example.json
 
+  # Benchmark the in-process handler with 50 workers for 10 seconds
+  qserv bench -c 50 -duration 10s
+
+  # Benchmark a running instance
+  qserv bench -url http://localhost:8080 -paths /,/app.js -n 10000
+
+BENCH OPTIONS:
+  -url string
+        Base URL of a running instance (default: in-process server)
+
+  -paths string
+        Comma-separated paths requested against -url (default "/")
+
+  -sizes string
+        File sizes served by the in-process server (default "1KB,100KB,1MB")
+
+  -c int
+        Number of concurrent workers (default 10)
+
+  -n int
+        Total number of requests (default 1000)
+
+  -duration duration
+        Run for a fixed duration instead of -n requests
+
+  -json
+        Print the result as JSON
+
+RELAY OPTIONS:
+  -listen string
+        Address where qserv instances open tunnels (default ":7000")
+
+  -public string
+        Public HTTP address forwarded through the tunnels (default ":8080")
+
+  -token string
+        Token required from tunnels (default: $QSERV_TUNNEL_TOKEN)
+
+  -cert string, -key string
+        TLS certificate and key for the tunnel listener (tunnel.tls)
+
 CONFIGURATION:
   Configuration can be provided via a JSON file using the -config flag.
   Use -generate-config to create an example configuration file.
+  Send SIGHUP (or set reload.watch) to reload security settings, custom
+  headers and the log level without restarting; invalid files are rejected.
 
 FEATURES:
   • Static file serving
@@ -233,7 +918,7 @@ FEATURES:
   • CORS support
   • Rate limiting
   • IP whitelist/blacklist
-  • Gzip compression
+  • Gzip, brotli and zstd compression
   • Cache headers
   • ETags
   • SPA mode
@@ -0,0 +1,501 @@
+package main
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// mavenMetadata nome do arquivo de metadados de um artefato
+const mavenMetadata = "maven-metadata.xml"
+
+// mavenChecksums algoritmos dos arquivos de checksum (<arquivo>.<alg>)
+var mavenChecksums = map[string]func() hash.Hash{
+	".md5":    md5.New,
+	".sha1":   sha1.New,
+	".sha256": sha256.New,
+	".sha512": sha512.New,
+}
+
+// Maven repositório Maven sob um prefixo: gera maven-metadata.xml e os
+// arquivos de checksum que faltarem e, com allow_deploy, aceita PUT dos
+// clientes Maven e Gradle
+type Maven struct {
+	config *MavenConfig
+	files  http.Handler // arquivos existentes seguem o fluxo normal
+
+	mu   sync.Mutex
+	sums map[string]mavenSum // caminho no disco + algoritmo -> checksum
+}
+
+// mavenSum checksum de um arquivo, válido enquanto tamanho e mtime não mudam
+type mavenSum struct {
+	size    int64
+	modTime time.Time
+	sum     string
+}
+
+// NewMaven valida o repositório Maven
+func NewMaven(config *MavenConfig, security *SecurityConfig) (*Maven, error) {
+	if !strings.HasPrefix(config.Prefix, "/") || config.Prefix == "/" {
+		return nil, errors.New("maven: prefix must be a directory below / (ex: /maven/)")
+	}
+	basicAuth := security.BasicAuth != nil && security.BasicAuth.Enabled
+	if config.AllowDeploy && config.Token == "" && !basicAuth {
+		return nil, errors.New("maven: allow_deploy requires a token or security.basic_auth")
+	}
+	if config.MaxUploadSize < 0 {
+		return nil, errors.New("maven: max_upload_size must not be negative")
+	}
+	return &Maven{config: config, sums: make(map[string]mavenSum)}, nil
+}
+
+// prefix retorna o prefixo do repositório, sempre terminado em /
+func (c *MavenConfig) prefix() string {
+	return strings.TrimSuffix(c.Prefix, "/") + "/"
+}
+
+// maxUploadSize retorna o maior arquivo aceito por PUT
+func (m *Maven) maxUploadSize() int64 {
+	if m.config.MaxUploadSize <= 0 {
+		return 512 << 20
+	}
+	return m.config.MaxUploadSize << 20
+}
+
+// authorized valida o token (Bearer ou senha do Basic, como nos settings.xml)
+func (m *Maven) authorized(r *http.Request) bool {
+	if m.config.Token == "" {
+		// Sem token, a autenticação é a do basic_auth global
+		return true
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		_, token, ok = r.BasicAuth()
+	}
+	return ok && subtle.ConstantTimeCompare([]byte(token), []byte(m.config.Token)) == 1
+}
+
+// checksum calcula o checksum do arquivo no algoritmo de ext
+func (m *Maven) checksum(path, ext string, info os.FileInfo) (string, error) {
+	key := path + ext
+	m.mu.Lock()
+	cached, ok := m.sums[key]
+	m.mu.Unlock()
+	if ok && cached.size == info.Size() && cached.modTime.Equal(info.ModTime()) {
+		return cached.sum, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := mavenChecksums[ext]()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	sum := hex.EncodeToString(h.Sum(nil))
+
+	m.mu.Lock()
+	if len(m.sums) >= maxETagHashes {
+		clear(m.sums)
+	}
+	m.sums[key] = mavenSum{size: info.Size(), modTime: info.ModTime(), sum: sum}
+	m.mu.Unlock()
+	return sum, nil
+}
+
+// handleMaven gera metadados e checksums ausentes e recebe deploys; o
+// restante segue para o handler de arquivos
+func (s *Server) handleMaven(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPut:
+		s.mavenDeploy(w, r)
+		return
+	case http.MethodGet, http.MethodHead:
+	default:
+		s.maven.files.ServeHTTP(w, r)
+		return
+	}
+
+	root := s.requestRoot(r)
+	if _, info, err := s.resolveVisible(root, r.URL.Path); err == nil && info.Mode().IsRegular() {
+		s.maven.files.ServeHTTP(w, r)
+		return
+	}
+
+	name := path.Base(r.URL.Path)
+	ext := path.Ext(name)
+	if _, ok := mavenChecksums[ext]; ok {
+		if sum, ok := s.mavenChecksum(root, strings.TrimSuffix(r.URL.Path, ext), ext); ok {
+			debugNote(r, "serve", "maven-checksum")
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			w.Header().Set("Cache-Control", "no-cache")
+			w.Write([]byte(sum))
+			return
+		}
+	}
+	if name == mavenMetadata {
+		if data, ok := s.mavenMetadata(root, r.URL.Path); ok {
+			debugNote(r, "serve", "maven-metadata")
+			w.Header().Set("Content-Type", "application/xml")
+			w.Header().Set("Cache-Control", "no-cache")
+			w.Write(data)
+			return
+		}
+	}
+	s.maven.files.ServeHTTP(w, r)
+}
+
+// mavenChecksum checksum de um arquivo do repositório (ou do
+// maven-metadata.xml gerado)
+func (s *Server) mavenChecksum(root, urlPath, ext string) (string, bool) {
+	file, info, err := s.resolveVisible(root, urlPath)
+	if err == nil && info.Mode().IsRegular() {
+		sum, err := s.maven.checksum(file, ext, info)
+		if err != nil {
+			s.logger.Error("Maven: checksum of %s: %v", file, err)
+			return "", false
+		}
+		return sum, true
+	}
+	if path.Base(urlPath) == mavenMetadata {
+		if data, ok := s.mavenMetadata(root, urlPath); ok {
+			h := mavenChecksums[ext]()
+			h.Write(data)
+			return hex.EncodeToString(h.Sum(nil)), true
+		}
+	}
+	return "", false
+}
+
+// mavenMetadataXML maven-metadata.xml de um artefato
+type mavenMetadataXML struct {
+	XMLName    xml.Name `xml:"metadata"`
+	GroupID    string   `xml:"groupId"`
+	ArtifactID string   `xml:"artifactId"`
+	Versioning struct {
+		Latest      string   `xml:"latest"`
+		Release     string   `xml:"release,omitempty"`
+		Versions    []string `xml:"versions>version"`
+		LastUpdated string   `xml:"lastUpdated"`
+	} `xml:"versioning"`
+}
+
+// mavenMetadata gera o maven-metadata.xml do diretório do artefato
+// (<grupo>/<artefato>/maven-metadata.xml) a partir das versões com .pom
+func (s *Server) mavenMetadata(root, urlPath string) ([]byte, bool) {
+	artifactURL := path.Dir(urlPath)
+	rel, ok := strings.CutPrefix(artifactURL+"/", s.maven.config.prefix())
+	group := path.Dir(strings.TrimSuffix(rel, "/"))
+	if !ok || rel == "" || group == "." {
+		return nil, false
+	}
+	dir, info, err := s.resolveVisible(root, artifactURL)
+	if err != nil || !info.IsDir() {
+		return nil, false
+	}
+	entries, err := s.visibleEntries(root, dir)
+	if err != nil {
+		return nil, false
+	}
+
+	var meta mavenMetadataXML
+	var updated time.Time
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		poms, _ := filepath.Glob(filepath.Join(dir, entry.Name(), "*.pom"))
+		if len(poms) == 0 {
+			continue
+		}
+		meta.Versioning.Versions = append(meta.Versioning.Versions, entry.Name())
+		if entry.ModTime().After(updated) {
+			updated = entry.ModTime()
+		}
+	}
+	versions := meta.Versioning.Versions
+	if len(versions) == 0 {
+		return nil, false
+	}
+	sort.Slice(versions, func(i, j int) bool { return mavenCompare(versions[i], versions[j]) < 0 })
+	meta.GroupID = strings.ReplaceAll(group, "/", ".")
+	meta.ArtifactID = path.Base(artifactURL)
+	meta.Versioning.Latest = versions[len(versions)-1]
+	for i := len(versions) - 1; i >= 0; i-- {
+		if !strings.HasSuffix(versions[i], "-SNAPSHOT") {
+			meta.Versioning.Release = versions[i]
+			break
+		}
+	}
+	meta.Versioning.LastUpdated = updated.UTC().Format("20060102150405")
+
+	data, err := xml.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return nil, false
+	}
+	return append([]byte(xml.Header), append(data, '\n')...), true
+}
+
+// mavenDeploy grava o arquivo enviado por PUT (mvn deploy, gradle publish);
+// versões de release não são sobrescritas sem allow_redeploy
+func (s *Server) mavenDeploy(w http.ResponseWriter, r *http.Request) {
+	if !s.maven.config.AllowDeploy {
+		w.Header().Set("Allow", "GET, HEAD")
+		s.serveError(w, r, http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.maven.authorized(r) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="maven"`)
+		s.serveError(w, r, http.StatusUnauthorized)
+		return
+	}
+
+	root := s.requestRoot(r)
+	urlPath := cleanURLPath(r.URL.Path)
+	rel, ok := strings.CutPrefix(urlPath, s.maven.config.prefix())
+	if !ok || rel == "" || strings.HasSuffix(r.URL.Path, "/") || !s.visiblePath(root, strings.TrimPrefix(urlPath, "/")) {
+		s.serveError(w, r, http.StatusForbidden)
+		return
+	}
+	path := filepath.Join(root, filepath.FromSlash(urlPath))
+	if !isWithin(root, path) || (s.listingRules != nil && s.listingRules.Blocked(root, path)) {
+		s.serveError(w, r, http.StatusForbidden)
+		return
+	}
+
+	name := filepath.Base(path)
+	_, isChecksum := mavenChecksums[filepath.Ext(name)]
+	release := !isChecksum && !strings.HasPrefix(name, mavenMetadata) && !strings.Contains(rel, "-SNAPSHOT/")
+	replaced := int64(-1)
+	if info, err := os.Stat(path); err == nil {
+		if info.IsDir() {
+			s.serveError(w, r, http.StatusConflict)
+			return
+		}
+		if release && !s.maven.config.AllowRedeploy {
+			http.Error(w, "release already deployed: "+urlPath, http.StatusConflict)
+			return
+		}
+		replaced = info.Size()
+	}
+
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		s.logger.Error("Maven: %v", err)
+		s.serveError(w, r, http.StatusInternalServerError)
+		return
+	}
+	tmp, err := os.CreateTemp(dir, ".qserv-write-*")
+	if err != nil {
+		s.logger.Error("Maven: %v", err)
+		s.serveError(w, r, http.StatusInternalServerError)
+		return
+	}
+	defer os.Remove(tmp.Name())
+	size, err := io.Copy(tmp, http.MaxBytesReader(w, r.Body, s.maven.maxUploadSize()))
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			s.serveError(w, r, http.StatusRequestEntityTooLarge)
+			return
+		}
+		s.serveError(w, r, http.StatusBadRequest)
+		return
+	}
+
+	// Checksum enviado depois do arquivo: confere com o que foi gravado
+	if isChecksum {
+		if err := s.mavenVerifyChecksum(tmp.Name(), strings.TrimSuffix(path, filepath.Ext(name)), filepath.Ext(name)); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if s.quotas != nil {
+		if err := s.quotas.Check(root, urlPath, size, replaced); err != nil {
+			http.Error(w, err.Error(), http.StatusInsufficientStorage)
+			return
+		}
+	}
+	if s.versions != nil && replaced >= 0 {
+		if err := s.versions.Save(root, path); err != nil {
+			s.logger.Error("Maven: saving previous version of %s: %v", path, err)
+			s.serveError(w, r, http.StatusInternalServerError)
+			return
+		}
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		s.logger.Error("Maven: %v", err)
+		s.serveError(w, r, http.StatusInternalServerError)
+		return
+	}
+
+	if s.quotas != nil {
+		if replaced >= 0 {
+			s.quotas.Record(urlPath, size-replaced, 0)
+		} else {
+			s.quotas.Record(urlPath, size, 1)
+		}
+	}
+	s.PurgeCaches(PurgeRequest{Path: urlPath})
+	s.logger.Info("Maven: deployed %s (%s)", urlPath, formatSize(size))
+	if replaced >= 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+// mavenVerifyChecksum compara o checksum enviado com o do arquivo já gravado
+// (checksums de arquivos ausentes são aceitos como vieram)
+func (s *Server) mavenVerifyChecksum(upload, target, ext string) error {
+	info, err := os.Stat(target)
+	if err != nil || !info.Mode().IsRegular() {
+		return nil
+	}
+	data, err := os.ReadFile(upload)
+	if err != nil {
+		return err
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return errors.New("empty checksum")
+	}
+	sum, err := s.maven.checksum(target, ext, info)
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(fields[0], sum) {
+		return errors.New("checksum mismatch for " + filepath.Base(target))
+	}
+	return nil
+}
+
+// mavenToken parte de uma versão Maven (número ou qualificador)
+type mavenToken struct {
+	num   int
+	str   string
+	isNum bool
+}
+
+// mavenQualifiers ordem dos qualificadores conhecidos ("" = release)
+var mavenQualifiers = map[string]int{
+	"alpha": 1, "a": 1, "beta": 2, "b": 2, "milestone": 3, "m": 3,
+	"rc": 4, "cr": 4, "snapshot": 5, "": 6, "ga": 6, "final": 6, "release": 6, "sp": 7,
+}
+
+// mavenTokens separa a versão em números e qualificadores (pontos, hífens
+// e transições entre dígitos e letras)
+func mavenTokens(version string) []mavenToken {
+	var tokens []mavenToken
+	var current bytes.Buffer
+	flush := func() {
+		if current.Len() == 0 {
+			return
+		}
+		s := current.String()
+		if n, err := strconv.Atoi(s); err == nil {
+			tokens = append(tokens, mavenToken{num: n, isNum: true})
+		} else {
+			tokens = append(tokens, mavenToken{str: s})
+		}
+		current.Reset()
+	}
+	var last rune
+	for _, r := range strings.ToLower(version) {
+		switch {
+		case r == '.' || r == '-':
+			flush()
+		case current.Len() > 0 && unicode.IsDigit(r) != unicode.IsDigit(last):
+			flush()
+			current.WriteRune(r)
+		default:
+			current.WriteRune(r)
+		}
+		last = r
+	}
+	flush()
+	return tokens
+}
+
+// mavenCompare compara versões Maven (versão simplificada da
+// ComparableVersion: 1.0-alpha < 1.0-rc1 < 1.0-SNAPSHOT < 1.0 < 1.0-sp1 < 1.0.1)
+func mavenCompare(a, b string) int {
+	ta, tb := mavenTokens(a), mavenTokens(b)
+	for i := 0; i < len(ta) || i < len(tb); i++ {
+		var x, y mavenToken
+		if i < len(ta) {
+			x = ta[i]
+		}
+		if i < len(tb) {
+			y = tb[i]
+		}
+		// Token ausente: 0 diante de número, release diante de qualificador
+		if i >= len(ta) {
+			x.isNum = y.isNum
+		}
+		if i >= len(tb) {
+			y.isNum = x.isNum
+		}
+		if c := compareMavenTokens(x, y); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// compareMavenTokens compara dois tokens de versão
+func compareMavenTokens(x, y mavenToken) int {
+	cmp := func(a, b int) int {
+		switch {
+		case a < b:
+			return -1
+		case a > b:
+			return 1
+		}
+		return 0
+	}
+	switch {
+	case x.isNum && y.isNum:
+		return cmp(x.num, y.num)
+	case x.isNum:
+		return 1
+	case y.isNum:
+		return -1
+	}
+	rx, okx := mavenQualifiers[x.str]
+	ry, oky := mavenQualifiers[y.str]
+	switch {
+	case okx && oky:
+		return cmp(rx, ry)
+	case okx:
+		return -1
+	case oky:
+		return 1
+	}
+	return strings.Compare(x.str, y.str)
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newMavenTestServer(t *testing.T, configure func(c *MavenConfig)) (*Server, string) {
+	t.Helper()
+	root := t.TempDir()
+	artifact := filepath.Join(root, "maven", "com", "example", "lib")
+	for _, version := range []string{"1.0", "1.10", "1.2-rc1", "2.0-SNAPSHOT"} {
+		writeTestFile(t, filepath.Join(artifact, version, "lib-"+version+".pom"), "<project/>")
+		writeTestFile(t, filepath.Join(artifact, version, "lib-"+version+".jar"), "jar "+version)
+	}
+	writeTestFile(t, filepath.Join(artifact, "notes", "README"), "not a version")
+	mc := &MavenConfig{Enabled: true, Prefix: "/maven/"}
+	if configure != nil {
+		configure(mc)
+	}
+	server := newListingTestServer(t, root, func(c *Config) {
+		c.Maven = mc
+	})
+	return server, root
+}
+
+func mavenRequest(server *Server, method, path, body, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if token != "" {
+		req.SetBasicAuth("deployer", token)
+	}
+	w := httptest.NewRecorder()
+	server.mux.ServeHTTP(w, req)
+	return w
+}
+
+func TestMavenGeneratedMetadata(t *testing.T) {
+	server, _ := newMavenTestServer(t, nil)
+	w := mavenRequest(server, "GET", "/maven/com/example/lib/maven-metadata.xml", "", "")
+	body := w.Body.String()
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", w.Code)
+	}
+	for _, want := range []string{
+		"<groupId>com.example</groupId>",
+		"<artifactId>lib</artifactId>",
+		"<latest>2.0-SNAPSHOT</latest>",
+		"<release>1.10</release>",
+		"<version>1.0</version>\n      <version>1.2-rc1</version>\n      <version>1.10</version>",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected %q in metadata, got %s", want, body)
+		}
+	}
+	if strings.Contains(body, "notes") {
+		t.Errorf("Expected directories without a pom to be ignored")
+	}
+
+	// Checksum of the generated metadata matches its content
+	sum := sha1.Sum([]byte(body))
+	if w := mavenRequest(server, "GET", "/maven/com/example/lib/maven-metadata.xml.sha1", "", ""); w.Body.String() != hex.EncodeToString(sum[:]) {
+		t.Errorf("Expected metadata checksum, got %q", w.Body.String())
+	}
+}
+
+func TestMavenGeneratedChecksums(t *testing.T) {
+	server, _ := newMavenTestServer(t, nil)
+	sum := sha1.Sum([]byte("jar 1.0"))
+	w := mavenRequest(server, "GET", "/maven/com/example/lib/1.0/lib-1.0.jar.sha1", "", "")
+	if w.Code != http.StatusOK || w.Body.String() != hex.EncodeToString(sum[:]) {
+		t.Errorf("Expected generated sha1, got %d %q", w.Code, w.Body.String())
+	}
+	if w := mavenRequest(server, "GET", "/maven/com/example/lib/1.0/missing.jar.sha1", "", ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for checksum of a missing file, got %d", w.Code)
+	}
+}
+
+func TestMavenDeploy(t *testing.T) {
+	server, root := newMavenTestServer(t, func(c *MavenConfig) {
+		c.AllowDeploy = true
+		c.Token = "secret"
+	})
+	path := "/maven/com/example/lib/3.0/lib-3.0.jar"
+
+	if w := mavenRequest(server, "PUT", path, "jar 3.0", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without token, got %d", w.Code)
+	}
+	if w := mavenRequest(server, "PUT", path, "jar 3.0", "secret"); w.Code != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d %s", w.Code, w.Body.String())
+	}
+	data, err := os.ReadFile(filepath.Join(root, "maven", "com", "example", "lib", "3.0", "lib-3.0.jar"))
+	if err != nil || string(data) != "jar 3.0" {
+		t.Errorf("Expected deployed file, got %q %v", data, err)
+	}
+
+	// Releases are immutable, snapshots are not
+	if w := mavenRequest(server, "PUT", path, "other", "secret"); w.Code != http.StatusConflict {
+		t.Errorf("Expected 409 on release redeploy, got %d", w.Code)
+	}
+	if w := mavenRequest(server, "PUT", "/maven/com/example/lib/2.0-SNAPSHOT/lib-2.0-SNAPSHOT.jar", "new", "secret"); w.Code != http.StatusNoContent {
+		t.Errorf("Expected snapshot overwrite, got %d", w.Code)
+	}
+
+	// Uploaded checksums must match the artifact
+	if w := mavenRequest(server, "PUT", path+".sha1", "0000", "secret"); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected checksum mismatch to be rejected, got %d", w.Code)
+	}
+	sum := sha1.Sum([]byte("jar 3.0"))
+	if w := mavenRequest(server, "PUT", path+".sha1", hex.EncodeToString(sum[:]), "secret"); w.Code != http.StatusCreated {
+		t.Errorf("Expected matching checksum to be stored, got %d", w.Code)
+	}
+
+	if w := mavenRequest(server, "PUT", "/maven/com/.hidden/x.jar", "x", "secret"); w.Code != http.StatusForbidden {
+		t.Errorf("Expected hidden path to be rejected, got %d", w.Code)
+	}
+}
+
+func TestMavenDeployDisabled(t *testing.T) {
+	server, _ := newMavenTestServer(t, nil)
+	if w := mavenRequest(server, "PUT", "/maven/com/example/lib/3.0/lib-3.0.jar", "x", ""); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405 without allow_deploy, got %d", w.Code)
+	}
+	if _, err := NewMaven(&MavenConfig{Enabled: true, Prefix: "/maven/", AllowDeploy: true}, &SecurityConfig{}); err == nil {
+		t.Errorf("Expected allow_deploy without authentication to be rejected")
+	}
+}
+
+func TestMavenCompare(t *testing.T) {
+	ordered := []string{"1.0-alpha-1", "1.0-beta", "1.0-rc1", "1.0-SNAPSHOT", "1.0", "1.0-sp1", "1.0.1", "1.2", "1.10"}
+	for i := 1; i < len(ordered); i++ {
+		if mavenCompare(ordered[i-1], ordered[i]) >= 0 {
+			t.Errorf("Expected %s < %s", ordered[i-1], ordered[i])
+		}
+	}
+	if mavenCompare("1.0", "1.0.0") != 0 || mavenCompare("1.0-final", "1.0") != 0 {
+		t.Errorf("Expected equivalent versions to compare equal")
+	}
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"bytes"
+	"container/list"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// MemoryCache guarda em RAM arquivos pequenos e muito pedidos, junto com as
+// versões comprimidas já servidas, com eviction LRU pelo tamanho total. Uma
+// entrada vale enquanto o arquivo mantiver mtime e tamanho e o TTL não vencer
+type MemoryCache struct {
+	maxSize     int64
+	maxFileSize int64
+	ttl         time.Duration
+	compression *Compression // nil: guarda apenas o conteúdo original
+	now         func() time.Time
+
+	mu        sync.Mutex
+	entries   map[string]*list.Element // caminho no disco -> elemento do LRU
+	lru       *list.List               // frente = acesso mais recente
+	size      int64
+	hits      int64
+	misses    int64
+	evictions int64
+}
+
+// memoryCacheEntry arquivo em memória
+type memoryCacheEntry struct {
+	path    string
+	urlPath string
+	modTime time.Time
+	data    []byte
+	encoded map[string][]byte // encoding -> conteúdo comprimido
+	expires time.Time
+}
+
+// bytes retorna o espaço ocupado pela entrada
+func (e *memoryCacheEntry) bytes() int64 {
+	n := int64(len(e.data))
+	for _, data := range e.encoded {
+		n += int64(len(data))
+	}
+	return n
+}
+
+// NewMemoryCache cria o cache; compression define os encodings guardados
+func NewMemoryCache(config *MemoryCacheConfig, compression *Compression) (*MemoryCache, error) {
+	if config.MaxSize < 0 || config.MaxFileSize < 0 || config.TTL < 0 {
+		return nil, fmt.Errorf("memory cache: max_size, max_file_size and ttl must not be negative")
+	}
+	c := &MemoryCache{
+		maxSize:     config.MaxSize,
+		maxFileSize: config.MaxFileSize,
+		ttl:         time.Duration(config.TTL) * time.Second,
+		compression: compression,
+		now:         time.Now,
+		entries:     make(map[string]*list.Element),
+		lru:         list.New(),
+	}
+	if c.maxSize == 0 {
+		c.maxSize = 64 << 20
+	}
+	if c.maxFileSize == 0 {
+		c.maxFileSize = 1 << 20
+		if c.maxFileSize > c.maxSize {
+			c.maxFileSize = c.maxSize
+		}
+	}
+	if c.ttl == 0 {
+		c.ttl = 5 * time.Minute
+	}
+	if c.maxFileSize > c.maxSize {
+		return nil, fmt.Errorf("memory cache: max_file_size (%d) exceeds max_size (%d)", c.maxFileSize, c.maxSize)
+	}
+	return c, nil
+}
+
+// Name identifica o cache (Purger)
+func (c *MemoryCache) Name() string {
+	return "memory"
+}
+
+// Caches informa se o arquivo cabe no cache
+func (c *MemoryCache) Caches(info fs.FileInfo) bool {
+	return info.Mode().IsRegular() && info.Size() <= c.maxFileSize
+}
+
+// lookup retorna a entrada válida de path (c.mu travado)
+func (c *MemoryCache) lookup(path string, info fs.FileInfo) (*memoryCacheEntry, bool) {
+	elem, ok := c.entries[path]
+	if !ok {
+		return nil, false
+	}
+	entry := elem.Value.(*memoryCacheEntry)
+	if !entry.modTime.Equal(info.ModTime()) || int64(len(entry.data)) != info.Size() || !c.now().Before(entry.expires) {
+		c.removeElement(elem)
+		return nil, false
+	}
+	return entry, true
+}
+
+// Get retorna o conteúdo de path, se estiver em memória e atualizado
+func (c *MemoryCache) Get(path string, info fs.FileInfo) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.lookup(path, info)
+	if !ok {
+		c.misses++
+		return nil, false
+	}
+	c.hits++
+	c.lru.MoveToFront(c.entries[path])
+	return entry.data, true
+}
+
+// Put guarda o conteúdo lido do disco
+func (c *MemoryCache) Put(path, urlPath string, info fs.FileInfo, data []byte) {
+	if int64(len(data)) > c.maxFileSize {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[path]; ok {
+		c.removeElement(elem)
+	}
+	entry := &memoryCacheEntry{
+		path:    path,
+		urlPath: urlPath,
+		modTime: info.ModTime(),
+		data:    data,
+		expires: c.now().Add(c.ttl),
+	}
+	c.entries[path] = c.lru.PushFront(entry)
+	c.size += entry.bytes()
+	c.evict()
+}
+
+// Encoded retorna o conteúdo de path comprimido pelo encoder do pool,
+// comprimindo e guardando na primeira vez
+func (c *MemoryCache) Encoded(path string, info fs.FileInfo, data []byte, pool *encoderPool) []byte {
+	c.mu.Lock()
+	if entry, ok := c.lookup(path, info); ok {
+		if encoded, ok := entry.encoded[pool.name]; ok {
+			c.mu.Unlock()
+			return encoded
+		}
+	}
+	c.mu.Unlock()
+
+	// Comprime fora do lock; requisições simultâneas podem repetir o trabalho
+	var buf bytes.Buffer
+	enc := pool.Get(&buf)
+	enc.Write(data)
+	enc.Close()
+	pool.Put(enc)
+	encoded := buf.Bytes()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if entry, ok := c.lookup(path, info); ok {
+		if entry.encoded == nil {
+			entry.encoded = make(map[string][]byte)
+		}
+		if _, ok := entry.encoded[pool.name]; !ok {
+			entry.encoded[pool.name] = encoded
+			c.size += int64(len(encoded))
+			c.evict()
+		}
+	}
+	return encoded
+}
+
+// Purge remove as entradas cujo caminho de URL satisfaz match (Purger)
+func (c *MemoryCache) Purge(match func(key string) bool) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var evicted []string
+	for _, elem := range c.entries {
+		if entry := elem.Value.(*memoryCacheEntry); match(entry.urlPath) {
+			c.removeElement(elem)
+			evicted = append(evicted, entry.urlPath)
+		}
+	}
+	return evicted
+}
+
+// evict remove as entradas menos usadas até caber em maxSize (c.mu travado)
+func (c *MemoryCache) evict() {
+	for c.size > c.maxSize && c.lru.Len() > 0 {
+		c.removeElement(c.lru.Back())
+		c.evictions++
+	}
+}
+
+// removeElement apaga uma entrada (c.mu travado)
+func (c *MemoryCache) removeElement(elem *list.Element) {
+	entry := elem.Value.(*memoryCacheEntry)
+	c.lru.Remove(elem)
+	delete(c.entries, entry.path)
+	c.size -= entry.bytes()
+}
+
+// WriteMetrics exporta acertos, faltas e ocupação do cache
+func (c *MemoryCache) WriteMetrics(w io.Writer) {
+	c.mu.Lock()
+	hits, misses, evictions, entries, size := c.hits, c.misses, c.evictions, len(c.entries), c.size
+	c.mu.Unlock()
+
+	writeMetric(w, "qserv_memory_cache_requests_total", "Memory cache lookups by result.", "counter", []metricSample{
+		{labels: map[string]string{"result": "hit"}, value: float64(hits)},
+		{labels: map[string]string{"result": "miss"}, value: float64(misses)},
+	})
+	writeMetric(w, "qserv_memory_cache_evictions_total", "Memory cache entries evicted to stay within max_size.", "counter",
+		[]metricSample{{value: float64(evictions)}})
+	writeMetric(w, "qserv_memory_cache_entries", "Files held in the memory cache.", "gauge",
+		[]metricSample{{value: float64(entries)}})
+	writeMetric(w, "qserv_memory_cache_bytes", "Bytes held in the memory cache, compressed forms included.", "gauge",
+		[]metricSample{{value: float64(size)}})
+}
+
+// serveMemoryCached serve path da memória, lendo do disco na primeira vez;
+// com compressão habilitada, a versão negociada também fica em memória
+func (s *Server) serveMemoryCached(w http.ResponseWriter, r *http.Request, path string, info fs.FileInfo) bool {
+	data, ok := s.memCache.Get(path, info)
+	if !ok {
+		f, err := s.openDiskFile(path)
+		if err != nil {
+			return false
+		}
+		data, err = io.ReadAll(io.LimitReader(f, info.Size()+1))
+		f.Close()
+		// Tamanho diferente: o arquivo mudou durante a leitura
+		if err != nil || int64(len(data)) != info.Size() {
+			return false
+		}
+		s.memCache.Put(path, r.URL.Path, info, data)
+		debugNote(r, "memory_cache", "miss")
+	} else {
+		debugNote(r, "memory_cache", "hit")
+	}
+
+	if w.Header().Get("Content-Type") == "" {
+		ctype := mime.TypeByExtension(filepath.Ext(info.Name()))
+		if ctype == "" {
+			ctype = http.DetectContentType(data)
+		}
+		w.Header().Set("Content-Type", ctype)
+	}
+
+	// Mesmos critérios do CompressionMiddleware, que deixa passar respostas
+	// com Content-Encoding; Range continua sobre o conteúdo original
+	if c := s.memCache.compression; c != nil && r.Header.Get("Range") == "" && w.Header().Get("Content-Encoding") == "" {
+		if pool := c.negotiate(r.Header.Get("Accept-Encoding")); pool != nil {
+			h := w.Header().Clone()
+			h.Set("Content-Length", strconv.Itoa(len(data)))
+			if c.eligible(h) {
+				w.Header().Set("Content-Encoding", pool.name)
+				w.Header().Add("Vary", "Accept-Encoding")
+				http.ServeContent(w, r, info.Name(), info.ModTime(), bytes.NewReader(s.memCache.Encoded(path, info, data, pool)))
+				return true
+			}
+		}
+	}
+	http.ServeContent(w, r, info.Name(), info.ModTime(), bytes.NewReader(data))
+	return true
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMemoryCacheServe(t *testing.T) {
+	root := t.TempDir()
+	script := strings.Repeat("console.log('qserv');\n", 100)
+	writeTestFile(t, filepath.Join(root, "app.js"), script)
+
+	server := newListingTestServer(t, root, func(c *Config) {
+		c.Performance.EnableCompression = true
+		c.Performance.Compression = &CompressionConfig{Encodings: []string{"gzip"}}
+		c.Performance.MemoryCache = &MemoryCacheConfig{Enabled: true}
+	})
+	get := func(acceptEncoding string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/app.js", nil)
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+		w := httptest.NewRecorder()
+		server.mux.ServeHTTP(w, req)
+		return w
+	}
+
+	for i := 0; i < 2; i++ {
+		w := get("gzip")
+		if w.Header().Get("Content-Encoding") != "gzip" || !strings.Contains(w.Header().Get("Content-Type"), "javascript") {
+			t.Fatalf("Request %d: unexpected headers %v", i, w.Header())
+		}
+		// A single gzip layer: the compression middleware must not compress again
+		gz, err := gzip.NewReader(w.Body)
+		if err != nil {
+			t.Fatalf("Request %d: invalid gzip stream: %v", i, err)
+		}
+		if body, _ := io.ReadAll(gz); string(body) != script {
+			t.Errorf("Request %d: expected original script after one decompression, got %d bytes", i, len(body))
+		}
+	}
+	if w := get(""); w.Header().Get("Content-Encoding") != "" || w.Body.String() != script {
+		t.Errorf("Expected identity response without Accept-Encoding")
+	}
+	if server.memCache.hits != 2 || server.memCache.misses != 1 {
+		t.Errorf("Expected 2 hits and 1 miss, got %d and %d", server.memCache.hits, server.memCache.misses)
+	}
+
+	// A changed file is read again from disk
+	writeTestFile(t, filepath.Join(root, "app.js"), "changed")
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(filepath.Join(root, "app.js"), later, later)
+	if w := get(""); w.Body.String() != "changed" {
+		t.Errorf("Expected changed file to be served, got %q", w.Body.String())
+	}
+}
+
+func TestMemoryCacheEviction(t *testing.T) {
+	cache, err := NewMemoryCache(&MemoryCacheConfig{MaxSize: 10, MaxFileSize: 4}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := t.TempDir()
+	put := func(name string) (string, os.FileInfo) {
+		path := filepath.Join(root, name)
+		writeTestFile(t, path, "1234")
+		info, _ := os.Stat(path)
+		cache.Put(path, "/"+name, info, []byte("1234"))
+		return path, info
+	}
+	pathA, infoA := put("a")
+	pathB, infoB := put("b")
+	cache.Get(pathA, infoA)
+	pathC, infoC := put("c")
+
+	// 3 files of 4 bytes do not fit in 10: b is the least recently used
+	if _, ok := cache.Get(pathB, infoB); ok {
+		t.Errorf("Expected b to be evicted")
+	}
+	if _, ok := cache.Get(pathA, infoA); !ok {
+		t.Errorf("Expected a to be cached")
+	}
+	if _, ok := cache.Get(pathC, infoC); !ok {
+		t.Errorf("Expected c to be cached")
+	}
+
+	cache.now = func() time.Time { return time.Now().Add(time.Hour) }
+	if _, ok := cache.Get(pathC, infoC); ok {
+		t.Errorf("Expected entry to expire after the TTL")
+	}
+
+	if _, err := NewMemoryCache(&MemoryCacheConfig{MaxSize: 10, MaxFileSize: 20}, nil); err == nil {
+		t.Errorf("Expected error when max_file_size exceeds max_size")
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// MetricsCollector fonte de métricas no formato de exposição do Prometheus
+type MetricsCollector interface {
+	WriteMetrics(w io.Writer)
+}
+
+// registerMetrics registra uma fonte de métricas para o endpoint administrativo
+func (s *Server) registerMetrics(collector MetricsCollector) {
+	s.metricsMu.Lock()
+	defer s.metricsMu.Unlock()
+	s.metrics = append(s.metrics, collector)
+}
+
+// handleAdminMetrics expõe as métricas de todas as fontes registradas
+func (s *Server) handleAdminMetrics(w http.ResponseWriter, r *http.Request) {
+	s.metricsMu.Lock()
+	collectors := append([]MetricsCollector(nil), s.metrics...)
+	s.metricsMu.Unlock()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	for _, collector := range collectors {
+		collector.WriteMetrics(w)
+	}
+}
+
+// metricSample valor de uma série com seus labels
+type metricSample struct {
+	labels map[string]string
+	value  float64
+}
+
+// writeMetric escreve uma métrica com cabeçalho HELP/TYPE e suas amostras
+func writeMetric(w io.Writer, name, help, kind string, samples []metricSample) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(w, "# TYPE %s %s\n", name, kind)
+	for _, sample := range samples {
+		fmt.Fprintf(w, "%s%s %v\n", name, formatLabels(sample.labels), sample.value)
+	}
+}
+
+// formatLabels formata os labels em ordem alfabética, com escape dos valores
+func formatLabels(labels map[string]string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	escaper := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = fmt.Sprintf(`%s="%s"`, name, escaper.Replace(labels[name]))
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
@@ -1,16 +1,16 @@
 package main
 
 import (
-	"compress/gzip"
+	"context"
 	"crypto/subtle"
 	"fmt"
-	"io"
 	"net"
 	"net/http"
 	"path/filepath"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -25,11 +25,42 @@ func Chain(h http.Handler, middlewares ...Middleware) http.Handler {
 	return h
 }
 
+// requestUserKey chave do contexto com o usuário autenticado da requisição
+type requestUserKey struct{}
+
+// requestUser usuário identificado pelos middlewares internos, para o log
+type requestUser struct {
+	mu   sync.Mutex
+	name string
+}
+
+// setRequestUser registra o usuário da requisição para o log de acesso
+func setRequestUser(r *http.Request, name string) {
+	if u, ok := r.Context().Value(requestUserKey{}).(*requestUser); ok {
+		u.mu.Lock()
+		u.name = name
+		u.mu.Unlock()
+	}
+}
+
+// requestUserName retorna o usuário registrado por setRequestUser ("" se
+// anônimo ou fora do LoggingMiddleware)
+func requestUserName(r *http.Request) string {
+	if u, ok := r.Context().Value(requestUserKey{}).(*requestUser); ok {
+		u.mu.Lock()
+		defer u.mu.Unlock()
+		return u.name
+	}
+	return ""
+}
+
 // LoggingMiddleware adiciona logging de requisições
 func LoggingMiddleware(logger *Logger) Middleware {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			start := time.Now()
+			user := &requestUser{}
+			r = r.WithContext(context.WithValue(r.Context(), requestUserKey{}, user))
 
 			// Wrapper para capturar o status code
 			wrapped := &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}
@@ -37,7 +68,17 @@ func LoggingMiddleware(logger *Logger) Middleware {
 			next.ServeHTTP(wrapped, r)
 
 			duration := time.Since(start)
-			logger.Access(r.Method, r.URL.Path, wrapped.statusCode, duration, r.RemoteAddr)
+			remote := r.RemoteAddr
+			user.mu.Lock()
+			id := user.name
+			user.mu.Unlock()
+			if id == "" {
+				id = peerIdentity(r.Context())
+			}
+			if id != "" {
+				remote += " (" + id + ")"
+			}
+			logger.Access(r.Method, r.URL.Path, wrapped.statusCode, duration, remote)
 		})
 	}
 }
@@ -53,6 +94,11 @@ func (rw *responseWriter) WriteHeader(code int) {
 	rw.ResponseWriter.WriteHeader(code)
 }
 
+// Unwrap permite ao http.ResponseController acessar o writer original
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
 // SecurityHeadersMiddleware adiciona headers de segurança
 func SecurityHeadersMiddleware() Middleware {
 	return func(next http.Handler) http.Handler {
@@ -66,9 +112,17 @@ func SecurityHeadersMiddleware() Middleware {
 }
 
 // BlockHiddenFilesMiddleware bloqueia acesso a arquivos ocultos
-func BlockHiddenFilesMiddleware(rootDir string) Middleware {
+// (exceto sob os prefixos permitidos, ex: /.well-known/)
+func BlockHiddenFilesMiddleware(rootDir string, allowedPrefixes ...string) Middleware {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for _, prefix := range allowedPrefixes {
+				if strings.HasPrefix(r.URL.Path, prefix) {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+
 			// Verifica se o caminho contém arquivos/diretórios ocultos
 			parts := strings.Split(filepath.Clean(r.URL.Path), string(filepath.Separator))
 			for _, part := range parts {
@@ -82,24 +136,9 @@ func BlockHiddenFilesMiddleware(rootDir string) Middleware {
 	}
 }
 
-// PathTraversalMiddleware protege contra path traversal
+// PathTraversalMiddleware protege contra path traversal (normalização não estrita)
 func PathTraversalMiddleware(rootDir string) Middleware {
-	return func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			// Limpa e resolve o caminho
-			cleanPath := filepath.Clean(r.URL.Path)
-
-			// Verifica se contém ..
-			if strings.Contains(cleanPath, "..") {
-				http.Error(w, "403 Forbidden", http.StatusForbidden)
-				return
-			}
-
-			// Atualiza o path limpo
-			r.URL.Path = cleanPath
-			next.ServeHTTP(w, r)
-		})
-	}
+	return NormalizePathMiddleware(false, nil)
 }
 
 // BasicAuthMiddleware adiciona autenticação básica
@@ -128,6 +167,7 @@ func BasicAuthMiddleware(config *BasicAuthConfig) Middleware {
 				return
 			}
 
+			setRequestUser(r, username)
 			next.ServeHTTP(w, r)
 		})
 	}
@@ -192,19 +232,37 @@ func CORSMiddleware(config *CORSConfig) Middleware {
 type RateLimiter struct {
 	mu       sync.Mutex
 	visitors map[string]*visitor
-	config   *RateLimitConfig
+	config   atomic.Pointer[RateLimitConfig]              // trocada ao recarregar a configuração
+	onLimit  func(w http.ResponseWriter, r *http.Request) // substitui o 429 (ex: desafio captcha)
+	backend  rateBackend                                  // cotas compartilhadas entre instâncias (nil = só locais)
+}
+
+// rateBackend guarda as cotas fora desta instância (ex: no nó dono, no
+// cluster): o bucket key tem capacidade limit e ganha um token a cada interval
+type rateBackend interface {
+	allow(key string, limit int, interval time.Duration) (rateLimitStatus, error)
 }
 
 type visitor struct {
 	lastSeen time.Time
+	refilled time.Time // instante até o qual os tokens já foram reabastecidos
 	tokens   int
 }
 
+// rateLimitStatus estado da cota de um cliente após uma requisição
+type rateLimitStatus struct {
+	allowed    bool
+	limit      int
+	remaining  int
+	reset      time.Duration // até a cota estar cheia novamente
+	retryAfter time.Duration // até o próximo token (quando bloqueado)
+}
+
 func NewRateLimiter(config *RateLimitConfig) *RateLimiter {
 	rl := &RateLimiter{
 		visitors: make(map[string]*visitor),
-		config:   config,
 	}
+	rl.config.Store(config)
 
 	// Limpeza periódica de visitantes antigos
 	go rl.cleanupVisitors()
@@ -225,28 +283,44 @@ func (rl *RateLimiter) cleanupVisitors() {
 	}
 }
 
-func (rl *RateLimiter) allow(ip string) bool {
+func (rl *RateLimiter) allow(ip string) rateLimitStatus {
+	return rl.allowBucket(ip, rl.burst(), rl.refillInterval())
+}
+
+// allowBucket consome um token do bucket local key, com capacidade limit e
+// um token a cada interval (a cota por IP e as regras por caminho)
+func (rl *RateLimiter) allowBucket(key string, limit int, interval time.Duration) rateLimitStatus {
 	rl.mu.Lock()
 	defer rl.mu.Unlock()
 
 	now := time.Now()
-	v, exists := rl.visitors[ip]
+	v, exists := rl.visitors[key]
 
 	if !exists {
-		rl.visitors[ip] = &visitor{
+		// Novo cliente começa com a cota cheia
+		v = &visitor{
 			lastSeen: now,
-			tokens:   rl.config.RequestsPerIP - 1,
+			refilled: now,
+			tokens:   limit - 1,
 		}
-		return true
+		rl.visitors[key] = v
+		return bucketStatus(v, now, limit, interval, true)
 	}
 
-	// Reabastece tokens baseado no tempo decorrido
-	elapsed := now.Sub(v.lastSeen)
-	tokensToAdd := int(elapsed.Minutes() * float64(rl.config.RequestsPerIP))
-	v.tokens += tokensToAdd
+	return bucketStatus(v, now, limit, interval, takeToken(v, now, limit, interval))
+}
 
-	if v.tokens > rl.config.BurstSize {
-		v.tokens = rl.config.BurstSize
+// takeToken reabastece o bucket pelo tempo decorrido e consome um token, se
+// houver (frações de token são preservadas para a próxima requisição)
+func takeToken(v *visitor, now time.Time, limit int, interval time.Duration) bool {
+	if tokensToAdd := int(now.Sub(v.refilled) / interval); tokensToAdd > 0 {
+		v.tokens += tokensToAdd
+		v.refilled = v.refilled.Add(time.Duration(tokensToAdd) * interval)
+	}
+
+	if v.tokens >= limit {
+		v.tokens = limit
+		v.refilled = now
 	}
 
 	v.lastSeen = now
@@ -255,22 +329,103 @@ func (rl *RateLimiter) allow(ip string) bool {
 		v.tokens--
 		return true
 	}
-
 	return false
 }
 
+// take consome um token do cliente no backend compartilhado, se houver;
+// se ele falhar, vale o contador local
+func (rl *RateLimiter) take(ip string) rateLimitStatus {
+	return rl.takeBucket(ip, rl.burst(), rl.refillInterval())
+}
+
+// takeBucket é take para um bucket qualquer
+func (rl *RateLimiter) takeBucket(key string, limit int, interval time.Duration) rateLimitStatus {
+	if rl.backend != nil {
+		if status, err := rl.backend.allow(key, limit, interval); err == nil {
+			return status
+		}
+	}
+	return rl.allowBucket(key, limit, interval)
+}
+
+// burst capacidade da cota (burst_size ou, se ausente, requests_per_ip)
+func (rl *RateLimiter) burst() int {
+	config := rl.config.Load()
+	if config.BurstSize > 0 {
+		return config.BurstSize
+	}
+	return config.RequestsPerIP
+}
+
+// refillInterval intervalo para reabastecer um token
+func (rl *RateLimiter) refillInterval() time.Duration {
+	config := rl.config.Load()
+	if config.RequestsPerIP <= 0 {
+		return time.Minute
+	}
+	return time.Minute / time.Duration(config.RequestsPerIP)
+}
+
+// bucketStatus calcula o estado de um bucket com capacidade limit que ganha
+// um token a cada interval
+func bucketStatus(v *visitor, now time.Time, limit int, interval time.Duration, allowed bool) rateLimitStatus {
+	remaining := v.tokens
+	if remaining < 0 {
+		remaining = 0
+	}
+	if remaining > limit {
+		remaining = limit
+	}
+
+	nextToken := interval - now.Sub(v.refilled)
+	status := rateLimitStatus{allowed: allowed, limit: limit, remaining: remaining}
+	if missing := limit - remaining; missing > 0 {
+		status.reset = nextToken + time.Duration(missing-1)*interval
+	}
+	if !allowed {
+		status.retryAfter = nextToken
+	}
+	return status
+}
+
+// setRateLimitHeaders escreve os headers RateLimit-* (draft IETF httpapi-ratelimit-headers)
+func setRateLimitHeaders(h http.Header, config *RateLimitConfig, status rateLimitStatus) {
+	h.Set("RateLimit-Limit", strconv.Itoa(status.limit))
+	h.Set("RateLimit-Remaining", strconv.Itoa(status.remaining))
+	h.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(status.reset)))
+	h.Set("RateLimit-Policy", fmt.Sprintf("%d;w=60;burst=%d", config.RequestsPerIP, status.limit))
+	if !status.allowed {
+		h.Set("Retry-After", strconv.Itoa(ceilSeconds(status.retryAfter)))
+	}
+}
+
+// ceilSeconds arredonda uma duração para cima em segundos
+func ceilSeconds(d time.Duration) int {
+	if d <= 0 {
+		return 0
+	}
+	return int((d + time.Second - 1) / time.Second)
+}
+
 // RateLimitMiddleware adiciona limitação de taxa
 func RateLimitMiddleware(limiter *RateLimiter) Middleware {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			if limiter == nil || !limiter.config.Enabled {
+			// requests_per_ip zerado deixa só as regras por caminho
+			if limiter == nil || !limiter.config.Load().Enabled || limiter.config.Load().RequestsPerIP <= 0 || challengePassed(r) {
 				next.ServeHTTP(w, r)
 				return
 			}
 
 			ip, _, _ := net.SplitHostPort(r.RemoteAddr)
 
-			if !limiter.allow(ip) {
+			status := limiter.take(ip)
+			setRateLimitHeaders(w.Header(), limiter.config.Load(), status)
+			if !status.allowed {
+				if limiter.onLimit != nil {
+					limiter.onLimit(w, r)
+					return
+				}
 				http.Error(w, "429 Too Many Requests", http.StatusTooManyRequests)
 				return
 			}
@@ -314,38 +469,117 @@ func IPFilterMiddleware(whitelist, blacklist []string) Middleware {
 	}
 }
 
-// CompressionMiddleware adiciona compressão gzip
-func CompressionMiddleware(level int) Middleware {
+// CompressionMiddleware comprime as respostas com gzip, brotli ou zstd,
+// conforme o Accept-Encoding do cliente
+func CompressionMiddleware(level int, config *CompressionConfig) Middleware {
+	// Encoders reutilizados entre requisições (evita alocar o compressor a cada resposta)
+	compression, err := NewCompression(level, config)
+
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			// Verifica se o cliente aceita gzip
-			if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+			if err != nil {
 				next.ServeHTTP(w, r)
 				return
 			}
-
-			w.Header().Set("Content-Encoding", "gzip")
-
-			gz, err := gzip.NewWriterLevel(w, level)
-			if err != nil {
+			// Verifica se o cliente aceita algum dos encodings
+			pool := compression.negotiate(r.Header.Get("Accept-Encoding"))
+			if pool == nil {
 				next.ServeHTTP(w, r)
 				return
 			}
-			defer gz.Close()
 
-			gzw := &gzipResponseWriter{ResponseWriter: w, Writer: gz}
-			next.ServeHTTP(gzw, r)
+			cw := &compressResponseWriter{ResponseWriter: w, compression: compression, pool: pool}
+			defer cw.Close()
+			next.ServeHTTP(cw, r)
 		})
 	}
 }
 
-type gzipResponseWriter struct {
+// compressResponseWriter comprime a resposta, a menos que o handler já tenha
+// definido um Content-Encoding (ex: arquivo pré-comprimido), que seja uma
+// resposta parcial (os bytes do Range são do conteúdo original) ou um
+// arquivo zip (downloads retomáveis dependem dos bytes exatos); streams SSE
+// também seguem sem compressão para cada evento chegar imediatamente
+type compressResponseWriter struct {
 	http.ResponseWriter
-	io.Writer
+	compression *Compression
+	pool        *encoderPool
+	enc         compressor
+	started     bool
 }
 
-func (w *gzipResponseWriter) Write(b []byte) (int, error) {
-	return w.Writer.Write(b)
+// start decide, antes dos headers serem enviados, se a resposta será
+// comprimida (respostas sem corpo nunca são)
+func (w *compressResponseWriter) start(code int) {
+	if w.started {
+		return
+	}
+	w.started = true
+	h := w.ResponseWriter.Header()
+	if h.Get("Content-Encoding") != "" || code == http.StatusNoContent || code == http.StatusNotModified ||
+		code == http.StatusPartialContent || h.Get("Content-Type") == "application/zip" ||
+		h.Get("Content-Type") == "text/event-stream" || !w.compression.eligible(h) {
+		return
+	}
+	h.Set("Content-Encoding", w.pool.name)
+	h.Add("Vary", "Accept-Encoding")
+	h.Del("Content-Length")
+	w.enc = w.pool.Get(w.ResponseWriter)
+}
+
+func (w *compressResponseWriter) WriteHeader(code int) {
+	w.start(code)
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *compressResponseWriter) Write(b []byte) (int, error) {
+	if !w.started && w.Header().Get("Content-Type") == "" {
+		// O net/http detectaria o tipo pelos bytes já comprimidos
+		w.Header().Set("Content-Type", http.DetectContentType(b))
+	}
+	w.start(http.StatusOK)
+	if w.enc == nil {
+		return w.ResponseWriter.Write(b)
+	}
+	return w.enc.Write(b)
+}
+
+// Flush envia o que já foi comprimido
+func (w *compressResponseWriter) Flush() {
+	if w.enc != nil {
+		w.enc.Flush()
+	}
+	http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// Unwrap permite ao http.ResponseController acessar o writer original
+func (w *compressResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// skipCompression desativa a compressão desta resposta (chamado antes de
+// escrever o corpo)
+func skipCompression(w http.ResponseWriter) {
+	for {
+		if cw, ok := w.(*compressResponseWriter); ok {
+			cw.started = true
+			return
+		}
+		unwrapper, ok := w.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			return
+		}
+		w = unwrapper.Unwrap()
+	}
+}
+
+// Close finaliza o stream comprimido e devolve o encoder ao pool
+func (w *compressResponseWriter) Close() {
+	if w.enc != nil {
+		w.enc.Close()
+		w.pool.Put(w.enc)
+		w.enc = nil
+	}
 }
 
 // CustomHeadersMiddleware adiciona headers customizados
@@ -295,6 +295,48 @@ func TestRateLimitMiddleware(t *testing.T) {
 	}
 }
 
+func TestRateLimitHeaders(t *testing.T) {
+	config := &RateLimitConfig{
+		Enabled:       true,
+		RequestsPerIP: 60,
+		BurstSize:     2,
+	}
+	handler := RateLimitMiddleware(NewRateLimiter(config))(testHandler())
+
+	request := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = "192.168.1.100:1234"
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	w := request()
+	if w.Header().Get("RateLimit-Limit") != "2" {
+		t.Errorf("Expected RateLimit-Limit 2, got %q", w.Header().Get("RateLimit-Limit"))
+	}
+	if w.Header().Get("RateLimit-Policy") != "60;w=60;burst=2" {
+		t.Errorf("Unexpected RateLimit-Policy: %q", w.Header().Get("RateLimit-Policy"))
+	}
+
+	w = request()
+	if w.Header().Get("RateLimit-Remaining") != "0" {
+		t.Errorf("Expected RateLimit-Remaining 0, got %q", w.Header().Get("RateLimit-Remaining"))
+	}
+
+	w = request()
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected 429, got %d", w.Code)
+	}
+	// One token per second: full again in at most 2s, next token within 1s
+	if reset := w.Header().Get("RateLimit-Reset"); reset != "1" && reset != "2" {
+		t.Errorf("Expected RateLimit-Reset of 1-2s, got %q", reset)
+	}
+	if w.Header().Get("Retry-After") != "1" {
+		t.Errorf("Expected Retry-After 1, got %q", w.Header().Get("Retry-After"))
+	}
+}
+
 func TestIPFilterMiddleware(t *testing.T) {
 	// Test with whitelist
 	t.Run("Whitelist", func(t *testing.T) {
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"time"
+)
+
+// errSlowClient resposta abortada por taxa de transferência insuficiente
+var errSlowClient = errors.New("client below minimum transfer rate")
+
+// minRateWriter renova o prazo de escrita a cada Write enquanto o cliente
+// mantém a taxa mínima; abaixo dela o prazo expira e a conexão é encerrada
+type minRateWriter struct {
+	http.ResponseWriter
+	rc      *http.ResponseController
+	rate    int64         // bytes por segundo
+	window  time.Duration // período de medição
+	start   time.Time     // início da janela atual (zero até o primeiro Write)
+	written int64         // bytes escritos na janela atual
+	aborted bool
+	now     func() time.Time
+}
+
+func newMinRateWriter(w http.ResponseWriter, config *MinTransferRateConfig, timeout time.Duration) *minRateWriter {
+	mw := &minRateWriter{
+		ResponseWriter: w,
+		rc:             http.NewResponseController(w),
+		rate:           int64(config.BytesPerSecond),
+		window:         time.Duration(config.Window) * time.Second,
+		now:            time.Now,
+	}
+	if mw.rate <= 0 {
+		mw.rate = 1024
+	}
+	if mw.window <= 0 {
+		mw.window = 30 * time.Second
+	}
+
+	// Prazo inicial para o handler começar a responder
+	if timeout < mw.window {
+		timeout = mw.window
+	}
+	mw.rc.SetWriteDeadline(mw.now().Add(timeout))
+	return mw
+}
+
+func (w *minRateWriter) Write(p []byte) (int, error) {
+	if w.aborted {
+		return 0, errSlowClient
+	}
+
+	// O Write precisa terminar dentro da janela mais o tempo que a taxa
+	// mínima leva para transferir o bloco
+	now := w.now()
+	if w.start.IsZero() {
+		w.start = now
+	}
+	w.rc.SetWriteDeadline(now.Add(w.window + time.Duration(int64(len(p))*int64(time.Second)/w.rate)))
+
+	n, err := w.ResponseWriter.Write(p)
+	w.written += int64(n)
+	if err != nil {
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			w.aborted = true
+		}
+		return n, err
+	}
+
+	now = w.now()
+	if elapsed := now.Sub(w.start); elapsed >= w.window {
+		if float64(w.written)/elapsed.Seconds() < float64(w.rate) {
+			w.abort()
+			return n, errSlowClient
+		}
+		w.start, w.written = now, 0
+	}
+	return n, nil
+}
+
+// abort expira o prazo de escrita para que o servidor encerre a conexão
+// (ou o stream, em HTTP/2) em vez de concluir a resposta truncada
+func (w *minRateWriter) abort() {
+	w.aborted = true
+	w.rc.SetWriteDeadline(time.Unix(1, 0))
+}
+
+// Unwrap permite ao http.ResponseController acessar o writer original
+func (w *minRateWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// MinTransferRateMiddleware encerra respostas de clientes lentos (ver minRateWriter)
+func MinTransferRateMiddleware(config *MinTransferRateConfig, timeout time.Duration, logger *Logger) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mw := newMinRateWriter(w, config, timeout)
+			next.ServeHTTP(mw, r)
+
+			if mw.aborted {
+				ip, _, _ := net.SplitHostPort(r.RemoteAddr)
+				logger.Warn("Aborted %s for %s: below %d bytes/s", r.URL.Path, ip, mw.rate)
+			}
+		})
+	}
+}
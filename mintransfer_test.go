@@ -0,0 +1,57 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// deadlineRecorder records the write deadlines set through http.ResponseController
+type deadlineRecorder struct {
+	*httptest.ResponseRecorder
+	deadline time.Time
+}
+
+func (d *deadlineRecorder) SetWriteDeadline(t time.Time) error {
+	d.deadline = t
+	return nil
+}
+
+func TestMinRateWriter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	rec := &deadlineRecorder{ResponseRecorder: httptest.NewRecorder()}
+
+	w := newMinRateWriter(rec, &MinTransferRateConfig{Enabled: true, BytesPerSecond: 1000, Window: 10}, time.Minute)
+	w.now = func() time.Time { return now }
+
+	// The initial deadline is the larger of the write timeout and the window
+	if rec.deadline.Sub(time.Now()) < 50*time.Second {
+		t.Errorf("Expected initial deadline of about one minute, got %v", time.Until(rec.deadline))
+	}
+
+	// A 5000-byte write gets the window plus 5s at the minimum rate
+	if _, err := w.Write(make([]byte, 5000)); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got := rec.deadline.Sub(now); got != 15*time.Second {
+		t.Errorf("Expected deadline 15s ahead, got %v", got)
+	}
+
+	// 10500 bytes over 10s keeps above 1000 bytes/s and starts a new window
+	now = now.Add(10 * time.Second)
+	if _, err := w.Write(make([]byte, 5500)); err != nil {
+		t.Fatalf("Expected client above the minimum rate to continue, got %v", err)
+	}
+
+	// 500 bytes over the next 10s is too slow
+	now = now.Add(10 * time.Second)
+	if _, err := w.Write(make([]byte, 500)); err != errSlowClient {
+		t.Fatalf("Expected errSlowClient, got %v", err)
+	}
+	if !rec.deadline.Before(now) {
+		t.Errorf("Expected write deadline to be expired after abort, got %v", rec.deadline)
+	}
+	if _, err := w.Write([]byte("more")); err != errSlowClient {
+		t.Errorf("Expected further writes to fail, got %v", err)
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// MirrorRedirector escolhe um mirror para os caminhos configurados
+type MirrorRedirector struct {
+	config *MirrorConfig
+	rand   func(n int) int
+}
+
+// NewMirrorRedirector cria o redirecionador
+func NewMirrorRedirector(config *MirrorConfig) *MirrorRedirector {
+	return &MirrorRedirector{config: config, rand: rand.IntN}
+}
+
+// validateMirrors valida a configuração de mirrors
+func validateMirrors(config *MirrorConfig) error {
+	if len(config.Mirrors) == 0 {
+		return fmt.Errorf("mirrors: at least one mirror is required")
+	}
+	for _, m := range config.Mirrors {
+		u, err := url.Parse(m.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("mirrors: invalid url %q", m.URL)
+		}
+		if m.Weight < 0 {
+			return fmt.Errorf("mirrors: invalid weight %d for %s", m.Weight, m.URL)
+		}
+	}
+	if s := config.Status; s != 0 && s != http.StatusFound && s != http.StatusTemporaryRedirect {
+		return fmt.Errorf("mirrors: invalid status %d (use 302 or 307)", s)
+	}
+	return nil
+}
+
+// Matches informa se o arquivo deve ser redirecionado
+func (m *MirrorRedirector) Matches(urlPath string, info os.FileInfo) bool {
+	if !info.Mode().IsRegular() || info.Size() < m.config.MinSize {
+		return false
+	}
+	for _, pattern := range m.config.Paths {
+		if matchGlob(pattern, urlPath) {
+			return true
+		}
+	}
+	return false
+}
+
+// candidates retorna os mirrors do país do cliente; sem país ou sem mirror
+// para ele, os mirrors sem países (globais) ou, na falta deles, todos
+func (m *MirrorRedirector) candidates(r *http.Request) []MirrorTarget {
+	if m.config.CountryHeader != "" {
+		if country := strings.TrimSpace(r.Header.Get(m.config.CountryHeader)); country != "" {
+			var local []MirrorTarget
+			for _, mirror := range m.config.Mirrors {
+				for _, c := range mirror.Countries {
+					if strings.EqualFold(c, country) {
+						local = append(local, mirror)
+						break
+					}
+				}
+			}
+			if len(local) > 0 {
+				return local
+			}
+		}
+	}
+
+	var global []MirrorTarget
+	for _, mirror := range m.config.Mirrors {
+		if len(mirror.Countries) == 0 {
+			global = append(global, mirror)
+		}
+	}
+	if len(global) > 0 {
+		return global
+	}
+	return m.config.Mirrors
+}
+
+// Pick sorteia um mirror entre os candidatos, proporcionalmente ao peso
+func (m *MirrorRedirector) Pick(r *http.Request) MirrorTarget {
+	candidates := m.candidates(r)
+	total := 0
+	for _, mirror := range candidates {
+		total += max(mirror.Weight, 1)
+	}
+	n := m.rand(total)
+	for _, mirror := range candidates {
+		n -= max(mirror.Weight, 1)
+		if n < 0 {
+			return mirror
+		}
+	}
+	return candidates[len(candidates)-1]
+}
+
+// mirrorURL monta a URL do caminho no mirror
+func mirrorURL(base, urlPath string) string {
+	return strings.TrimSuffix(base, "/") + escapeURLPath(urlPath)
+}
+
+// Redirect redireciona para o mirror escolhido; os demais vão no header
+// Link como rel=duplicate (RFC 6249), para clientes que trocam de mirror
+func (m *MirrorRedirector) Redirect(w http.ResponseWriter, r *http.Request) {
+	target := m.Pick(r)
+	for i, mirror := range m.config.Mirrors {
+		w.Header().Add("Link", fmt.Sprintf("<%s>; rel=duplicate; pri=%d", mirrorURL(mirror.URL, r.URL.Path), i+1))
+	}
+	w.Header().Set("Cache-Control", "no-store")
+
+	status := m.config.Status
+	if status == 0 {
+		status = http.StatusFound
+	}
+	http.Redirect(w, r, mirrorURL(target.URL, r.URL.Path), status)
+}
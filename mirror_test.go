@@ -0,0 +1,85 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMirrorRedirect(t *testing.T) {
+	root := t.TempDir()
+	os.MkdirAll(filepath.Join(root, "releases"), 0755)
+	os.WriteFile(filepath.Join(root, "releases", "app 1.0.tar.gz"), []byte("release"), 0644)
+	os.WriteFile(filepath.Join(root, "notes.txt"), []byte("notes"), 0644)
+
+	server := newListingTestServer(t, root, func(c *Config) {
+		c.Mirrors = &MirrorConfig{
+			Enabled:       true,
+			Paths:         []string{"/releases/**"},
+			CountryHeader: "CF-IPCountry",
+			Mirrors: []MirrorTarget{
+				{URL: "https://eu.example.net/pub/", Countries: []string{"DE", "FR"}},
+				{URL: "https://us.example.net", Weight: 3},
+				{URL: "https://asia.example.net", Weight: 1},
+			},
+		}
+	})
+
+	get := func(path, country string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		if country != "" {
+			req.Header.Set("CF-IPCountry", country)
+		}
+		w := httptest.NewRecorder()
+		server.mux.ServeHTTP(w, req)
+		return w
+	}
+
+	w := get("/releases/app%201.0.tar.gz", "de")
+	if w.Code != http.StatusFound {
+		t.Fatalf("Expected 302, got %d", w.Code)
+	}
+	if loc := w.Header().Get("Location"); loc != "https://eu.example.net/pub/releases/app%201.0.tar.gz" {
+		t.Errorf("Expected EU mirror, got %q", loc)
+	}
+	if links := w.Header().Values("Link"); len(links) != 3 {
+		t.Errorf("Expected 3 rel=duplicate links, got %v", links)
+	}
+
+	// Weighted choice among global mirrors: 0-2 -> us, 3 -> asia
+	for n, want := range map[int]string{0: "https://us.example.net", 2: "https://us.example.net", 3: "https://asia.example.net"} {
+		server.mirrors.rand = func(total int) int {
+			if total != 4 {
+				t.Errorf("Expected total weight 4, got %d", total)
+			}
+			return n
+		}
+		w := get("/releases/app%201.0.tar.gz", "BR")
+		if loc := w.Header().Get("Location"); loc != want+"/releases/app%201.0.tar.gz" {
+			t.Errorf("rand=%d: expected %s, got %q", n, want, loc)
+		}
+	}
+
+	// Unmatched paths and missing files are served locally
+	if w := get("/notes.txt", ""); w.Code != http.StatusOK {
+		t.Errorf("Expected local file to be served, got %d", w.Code)
+	}
+	if w := get("/releases/missing.tar.gz", ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for missing release, got %d", w.Code)
+	}
+}
+
+func TestValidateMirrors(t *testing.T) {
+	for _, config := range []*MirrorConfig{
+		{},
+		{Mirrors: []MirrorTarget{{URL: "ftp://mirror"}}},
+		{Mirrors: []MirrorTarget{{URL: "https://mirror", Weight: -1}}},
+		{Mirrors: []MirrorTarget{{URL: "https://mirror"}}, Status: 301},
+	} {
+		if err := validateMirrors(config); err == nil {
+			t.Errorf("Expected error for %+v", config)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"path"
+	"runtime"
+	"strings"
+	"unicode/utf8"
+)
+
+// Erros de normalização (sempre resultam em 400)
+var (
+	errInvalidEscape    = errors.New("invalid percent-encoding")
+	errInvalidUTF8      = errors.New("invalid or overlong UTF-8")
+	errControlChar      = errors.New("NUL or control character")
+	errEncodedSeparator = errors.New("encoded path separator")
+	errDoubleEncoding   = errors.New("double percent-encoding")
+	errBackslash        = errors.New("backslash in path")
+	errWindowsName      = errors.New("ambiguous Windows file name")
+	errNonCanonical     = errors.New("dot segments or duplicate slashes")
+)
+
+// windowsDevices nomes reservados de dispositivos no Windows
+var windowsDevices = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true,
+	"COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true,
+	"LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// NormalizePath é o ponto único de normalização de caminhos de requisição.
+// Recebe o caminho ainda codificado (URL.EscapedPath) e retorna o caminho
+// decodificado, absoluto e canônico (preservando a barra final).
+//
+// Sempre rejeitados: escapes inválidos, UTF-8 inválido/overlong, NUL e
+// caracteres de controle. Fora do modo estrito, dot segments e barras
+// duplicadas são resolvidos e contrabarras viram separadores. No modo
+// estrito o caminho precisa já estar na forma canônica, e separadores
+// codificados, dupla codificação e nomes ambíguos no Windows são rejeitados
+// (estes últimos também fora do modo estrito quando rodando no Windows).
+func NormalizePath(escaped string, strict bool) (string, error) {
+	decoded, err := url.PathUnescape(escaped)
+	if err != nil {
+		return "", errInvalidEscape
+	}
+	if !utf8.ValidString(decoded) {
+		return "", errInvalidUTF8
+	}
+	for _, r := range decoded {
+		if r < 0x20 || r == 0x7f {
+			return "", errControlChar
+		}
+	}
+
+	if strict {
+		lower := strings.ToLower(escaped)
+		if strings.Contains(lower, "%2f") || strings.Contains(lower, "%5c") {
+			return "", errEncodedSeparator
+		}
+		if hasEscape(decoded) {
+			return "", errDoubleEncoding
+		}
+	}
+
+	if strings.Contains(decoded, `\`) {
+		if strict {
+			return "", errBackslash
+		}
+		decoded = strings.ReplaceAll(decoded, `\`, "/")
+	}
+
+	if strict || runtime.GOOS == "windows" {
+		for _, segment := range strings.Split(decoded, "/") {
+			if isAmbiguousWindowsName(segment) {
+				return "", errWindowsName
+			}
+		}
+	}
+
+	cleaned := path.Clean("/" + decoded)
+	if strings.HasSuffix(decoded, "/") && cleaned != "/" {
+		cleaned += "/"
+	}
+	if strict && cleaned != decoded {
+		return "", errNonCanonical
+	}
+	return cleaned, nil
+}
+
+// hasEscape indica se o texto (já decodificado) ainda contém um escape %XX
+func hasEscape(s string) bool {
+	for i := 0; i+2 < len(s); i++ {
+		if s[i] == '%' && isHex(s[i+1]) && isHex(s[i+2]) {
+			return true
+		}
+	}
+	return false
+}
+
+func isHex(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+// isAmbiguousWindowsName detecta segmentos que o Windows interpreta de forma
+// diferente do nome literal: pontos/espaços finais, streams (":") e dispositivos
+func isAmbiguousWindowsName(segment string) bool {
+	if segment == "" || segment == "." || segment == ".." {
+		return false
+	}
+	if strings.HasSuffix(segment, ".") || strings.HasSuffix(segment, " ") || strings.Contains(segment, ":") {
+		return true
+	}
+	base, _, _ := strings.Cut(segment, ".")
+	return windowsDevices[strings.ToUpper(strings.TrimSpace(base))]
+}
+
+// escapeURLPath codifica um caminho para uso em links (ex: listagem)
+func escapeURLPath(p string) string {
+	return (&url.URL{Path: p}).EscapedPath()
+}
+
+// NormalizePathMiddleware aplica NormalizePath a todas as requisições,
+// respondendo 400 para caminhos rejeitados
+func NormalizePathMiddleware(strict bool, logger *Logger) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			normalized, err := NormalizePath(r.URL.EscapedPath(), strict)
+			if err != nil {
+				if logger != nil {
+					logger.Debug("Rejected path %q: %v", r.URL.EscapedPath(), err)
+				}
+				http.Error(w, "400 Bad Request", http.StatusBadRequest)
+				return
+			}
+			r.URL.Path = normalized
+			r.URL.RawPath = ""
+			next.ServeHTTP(w, r)
+		})
+	}
+}
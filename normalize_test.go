@@ -0,0 +1,71 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNormalizePath(t *testing.T) {
+	tests := []struct {
+		escaped  string
+		strict   bool
+		expected string
+		err      error
+	}{
+		{"/a/b.txt", false, "/a/b.txt", nil},
+		{"/a/b/", false, "/a/b/", nil},
+		{"/a//b/./c/../d", false, "/a/b/d", nil},
+		{"/../../etc/passwd", false, "/etc/passwd", nil},
+		{"/%2e%2e/%2e%2e/etc/passwd", false, "/etc/passwd", nil},
+		{"/caf%C3%A9.txt", false, "/café.txt", nil},
+		{`/a\..\b`, false, "/b", nil},
+		{"/file%00.txt", false, "", errControlChar},
+		{"/%0d%0aSet-Cookie", false, "", errControlChar},
+		{"/%C0%AE%C0%AE/etc/passwd", false, "", errInvalidUTF8},
+		{"/bad%zz", false, "", errInvalidEscape},
+
+		{"/a/b.txt", true, "/a/b.txt", nil},
+		{"/a//b", true, "", errNonCanonical},
+		{"/a/../b", true, "", errNonCanonical},
+		{"/a%2Fb", true, "", errEncodedSeparator},
+		{"/%252e%252e/", true, "", errDoubleEncoding},
+		{`/a\b`, true, "", errBackslash},
+		{"/file.txt.", true, "", errWindowsName},
+		{"/file.txt::$DATA", true, "", errWindowsName},
+		{"/con.txt", true, "", errWindowsName},
+		{"/console.txt", true, "/console.txt", nil},
+	}
+
+	for _, test := range tests {
+		got, err := NormalizePath(test.escaped, test.strict)
+		if err != test.err {
+			t.Errorf("NormalizePath(%q, strict=%v): expected error %v, got %v", test.escaped, test.strict, test.err, err)
+			continue
+		}
+		if got != test.expected {
+			t.Errorf("NormalizePath(%q, strict=%v): expected %q, got %q", test.escaped, test.strict, test.expected, got)
+		}
+	}
+}
+
+func TestNormalizePathMiddleware(t *testing.T) {
+	var seen string
+	handler := NormalizePathMiddleware(false, nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = r.URL.Path
+	}))
+
+	req := httptest.NewRequest("GET", "/docs//guide/../index.html", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || seen != "/docs/index.html" {
+		t.Errorf("Expected normalized path /docs/index.html, got %d %q", w.Code, seen)
+	}
+
+	req = httptest.NewRequest("GET", "/secret%00.txt", nil)
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for NUL byte, got %d", w.Code)
+	}
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// NotFoundCache cache negativo de caminhos inexistentes. As entradas expiram
+// pelo TTL e são invalidadas quando algo é criado no diretório observado.
+type NotFoundCache struct {
+	ttl        time.Duration
+	maxEntries int
+	logger     *Logger
+	watcher    *fsnotify.Watcher // nil: apenas TTL
+
+	mu      sync.Mutex
+	entries map[string]notFoundEntry // caminho no disco -> entrada
+	watched map[string]int           // diretório observado -> número de entradas
+}
+
+// notFoundEntry caminho inexistente registrado
+type notFoundEntry struct {
+	urlPath string
+	dir     string // diretório existente mais próximo (observado)
+	expires time.Time
+}
+
+// NewNotFoundCache cria o cache negativo a partir da configuração
+func NewNotFoundCache(config *NegativeCacheConfig, logger *Logger) *NotFoundCache {
+	ttl := time.Duration(config.TTL) * time.Second
+	if ttl <= 0 {
+		ttl = 10 * time.Second
+	}
+	maxEntries := config.MaxEntries
+	if maxEntries <= 0 {
+		maxEntries = 10000
+	}
+
+	c := &NotFoundCache{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		logger:     logger,
+		entries:    make(map[string]notFoundEntry),
+		watched:    make(map[string]int),
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		logger.Warn("Negative cache: file watching unavailable, relying on TTL: %v", err)
+		return c
+	}
+	c.watcher = watcher
+	go c.watch()
+	return c
+}
+
+// Name identifica o cache (Purger)
+func (c *NotFoundCache) Name() string {
+	return "negative"
+}
+
+// Contains indica se o caminho está registrado como inexistente
+func (c *NotFoundCache) Contains(path string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[path]
+	if !ok {
+		return false
+	}
+	if time.Now().After(entry.expires) {
+		c.remove(path)
+		return false
+	}
+	return true
+}
+
+// Add registra um caminho inexistente
+func (c *NotFoundCache) Add(path, urlPath string) {
+	dir := existingParent(path)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.entries[path]; ok {
+		return
+	}
+	if len(c.entries) >= c.maxEntries {
+		c.removeExpired()
+		if len(c.entries) >= c.maxEntries {
+			return
+		}
+	}
+
+	if c.watcher != nil && c.watched[dir] == 0 {
+		if err := c.watcher.Add(dir); err != nil {
+			// Sem observação não há como invalidar antes do TTL com segurança
+			c.logger.Debug("Negative cache: cannot watch %s: %v", dir, err)
+			return
+		}
+	}
+	c.watched[dir]++
+	c.entries[path] = notFoundEntry{urlPath: urlPath, dir: dir, expires: time.Now().Add(c.ttl)}
+}
+
+// Purge remove as entradas cujo caminho de URL satisfaz match (Purger)
+func (c *NotFoundCache) Purge(match func(key string) bool) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var evicted []string
+	for path, entry := range c.entries {
+		if match(entry.urlPath) {
+			c.remove(path)
+			evicted = append(evicted, entry.urlPath)
+		}
+	}
+	return evicted
+}
+
+// watch invalida as entradas afetadas por arquivos criados ou renomeados
+func (c *NotFoundCache) watch() {
+	for {
+		select {
+		case event, ok := <-c.watcher.Events:
+			if !ok {
+				return
+			}
+			if event.Has(fsnotify.Create) || event.Has(fsnotify.Rename) {
+				c.invalidate(event.Name)
+			}
+		case err, ok := <-c.watcher.Errors:
+			if !ok {
+				return
+			}
+			// Eventos podem ter sido perdidos: descarta tudo
+			c.logger.Warn("Negative cache watcher: %v", err)
+			c.Purge(func(string) bool { return true })
+		}
+	}
+}
+
+// invalidate remove as entradas no caminho criado ou abaixo dele
+func (c *NotFoundCache) invalidate(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for path := range c.entries {
+		if path == name || strings.HasPrefix(path, name+string(filepath.Separator)) {
+			c.remove(path)
+		}
+	}
+}
+
+// removeExpired remove as entradas vencidas (c.mu travado)
+func (c *NotFoundCache) removeExpired() {
+	now := time.Now()
+	for path, entry := range c.entries {
+		if now.After(entry.expires) {
+			c.remove(path)
+		}
+	}
+}
+
+// remove apaga uma entrada e deixa de observar diretórios sem entradas (c.mu travado)
+func (c *NotFoundCache) remove(path string) {
+	entry, ok := c.entries[path]
+	if !ok {
+		return
+	}
+	delete(c.entries, path)
+
+	c.watched[entry.dir]--
+	if c.watched[entry.dir] <= 0 {
+		delete(c.watched, entry.dir)
+		if c.watcher != nil {
+			c.watcher.Remove(entry.dir)
+		}
+	}
+}
+
+// existingParent retorna o diretório existente mais próximo de um caminho
+func existingParent(path string) string {
+	dir := filepath.Dir(path)
+	for {
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			return dir
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return dir
+		}
+		dir = parent
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestNotFoundCache(t *testing.T, ttl int) *NotFoundCache {
+	t.Helper()
+	logger, _ := NewLogger(&LoggingConfig{Enabled: false})
+	cache := NewNotFoundCache(&NegativeCacheConfig{Enabled: true, TTL: ttl}, logger)
+	if cache.watcher != nil {
+		t.Cleanup(func() { cache.watcher.Close() })
+	}
+	return cache
+}
+
+// waitUntil repete cond até ser verdadeira ou o prazo acabar
+func waitUntil(t *testing.T, cond func() bool) bool {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if cond() {
+			return true
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return false
+}
+
+func TestNotFoundCacheInvalidation(t *testing.T) {
+	cache := newTestNotFoundCache(t, 60)
+	if cache.watcher == nil {
+		t.Skip("file watching not available")
+	}
+
+	root := t.TempDir()
+	missing := filepath.Join(root, "sub", "deep", "page.html")
+	cache.Add(missing, "/sub/deep/page.html")
+	if !cache.Contains(missing) {
+		t.Fatalf("Expected path to be cached as missing")
+	}
+
+	// Criar um diretório intermediário invalida os caminhos abaixo dele
+	if err := os.Mkdir(filepath.Join(root, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if !waitUntil(t, func() bool { return !cache.Contains(missing) }) {
+		t.Errorf("Expected entry to be invalidated when parent directory is created")
+	}
+}
+
+func TestNotFoundCacheTTLAndPurge(t *testing.T) {
+	cache := newTestNotFoundCache(t, 60)
+	root := t.TempDir()
+
+	a := filepath.Join(root, "wp-login.php")
+	b := filepath.Join(root, "xmlrpc.php")
+	cache.Add(a, "/wp-login.php")
+	cache.Add(b, "/xmlrpc.php")
+
+	evicted := cache.Purge(func(key string) bool { return key == "/wp-login.php" })
+	if len(evicted) != 1 || cache.Contains(a) || !cache.Contains(b) {
+		t.Errorf("Expected only /wp-login.php to be purged, got %v", evicted)
+	}
+
+	// Força a expiração
+	cache.mu.Lock()
+	entry := cache.entries[b]
+	entry.expires = time.Now().Add(-time.Second)
+	cache.entries[b] = entry
+	cache.mu.Unlock()
+
+	if cache.Contains(b) {
+		t.Errorf("Expected expired entry to be dropped")
+	}
+	if len(cache.watched) != 0 {
+		t.Errorf("Expected no watched directories after all entries are removed, got %v", cache.watched)
+	}
+}
+
+func TestNotFoundCacheStatusHeader(t *testing.T) {
+	root := t.TempDir()
+	server := newListingTestServer(t, root, func(c *Config) {
+		c.Performance.NegativeCache = &NegativeCacheConfig{Enabled: true, TTL: 60}
+	})
+	if server.notFound.watcher != nil {
+		t.Cleanup(func() { server.notFound.watcher.Close() })
+	}
+
+	for i, want := range []string{"MISS", "HIT"} {
+		w := httptest.NewRecorder()
+		server.mux.ServeHTTP(w, httptest.NewRequest("GET", "/missing.html", nil))
+		if w.Code != http.StatusNotFound {
+			t.Errorf("Request %d: expected 404, got %d", i, w.Code)
+		}
+		if got := w.Header().Get("X-Cache"); got != want {
+			t.Errorf("Request %d: expected X-Cache %s, got %q", i, want, got)
+		}
+	}
+}
@@ -0,0 +1,326 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha1"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// npmMaxManifest tamanho máximo do package.json lido de um tarball
+const npmMaxManifest = 1 << 20
+
+// npmName nome de pacote npm (com escopo opcional)
+var npmName = regexp.MustCompile(`^(?:@[a-z0-9][a-z0-9._~-]*/)?[a-z0-9][a-z0-9._~-]*$`)
+
+// Npm fachada somente leitura do registry npm sobre um diretório de
+// tarballs (.tgz de npm pack); os packuments são gerados a partir do
+// package.json de cada tarball
+type Npm struct {
+	config *NpmConfig
+	root   func() string // raiz servida, para dir relativo
+	logger *Logger
+
+	mu       sync.Mutex
+	tarballs map[string]npmTarball // caminho no disco -> manifesto e hashes
+}
+
+// npmTarball package.json e hashes de um tarball, válidos enquanto tamanho
+// e mtime não mudam
+type npmTarball struct {
+	path     string
+	size     int64
+	modTime  time.Time
+	manifest map[string]interface{}
+	name     string
+	version  string
+	shasum   string
+	sha512   string
+}
+
+// NewNpm cria a fachada do registry npm
+func NewNpm(config *NpmConfig, logger *Logger) (*Npm, error) {
+	if config.Dir == "" {
+		return nil, errors.New("npm: dir is required")
+	}
+	if !strings.HasPrefix(config.prefix(), "/") {
+		return nil, errors.New("npm: prefix must start with /")
+	}
+	return &Npm{config: config, logger: logger, tarballs: make(map[string]npmTarball)}, nil
+}
+
+// prefix retorna o prefixo do registry (default: /npm/)
+func (c *NpmConfig) prefix() string {
+	if c.Prefix == "" {
+		return "/npm/"
+	}
+	return strings.TrimSuffix(c.Prefix, "/") + "/"
+}
+
+// dir retorna o diretório dos tarballs (relativo à raiz servida)
+func (n *Npm) dir() string {
+	if filepath.IsAbs(n.config.Dir) {
+		return n.config.Dir
+	}
+	return filepath.Join(n.root(), n.config.Dir)
+}
+
+// baseURL endereço público do registry (base_url ou o host da requisição)
+func (n *Npm) baseURL(r *http.Request) string {
+	if n.config.BaseURL != "" {
+		return strings.TrimSuffix(n.config.BaseURL, "/")
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + strings.TrimSuffix(n.config.prefix(), "/")
+}
+
+// readTarball lê o package.json e calcula os hashes do tarball
+func readTarball(path string) (npmTarball, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return npmTarball{}, err
+	}
+	defer f.Close()
+
+	sha1sum, sha512sum := sha1.New(), sha512.New()
+	gz, err := gzip.NewReader(io.TeeReader(f, io.MultiWriter(sha1sum, sha512sum)))
+	if err != nil {
+		return npmTarball{}, err
+	}
+	var tb npmTarball
+	tr := tar.NewReader(gz)
+	for tb.manifest == nil {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return npmTarball{}, errors.New("package.json not found")
+		}
+		if err != nil {
+			return npmTarball{}, err
+		}
+		// npm pack usa package/, mas alguns tarballs usam outro diretório
+		dir, name, _ := strings.Cut(strings.TrimPrefix(hdr.Name, "./"), "/")
+		if dir == "" || name != "package.json" || hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		data, err := io.ReadAll(io.LimitReader(tr, npmMaxManifest))
+		if err != nil {
+			return npmTarball{}, err
+		}
+		if err := json.Unmarshal(data, &tb.manifest); err != nil {
+			return npmTarball{}, fmt.Errorf("invalid package.json: %w", err)
+		}
+	}
+	tb.name, _ = tb.manifest["name"].(string)
+	tb.version, _ = tb.manifest["version"].(string)
+	if !npmName.MatchString(tb.name) || tb.version == "" {
+		return npmTarball{}, errors.New("package.json without valid name and version")
+	}
+
+	// O hash cobre o arquivo inteiro, não só até o package.json
+	if _, err := io.Copy(io.Discard, f); err != nil {
+		return npmTarball{}, err
+	}
+	tb.shasum = hex.EncodeToString(sha1sum.Sum(nil))
+	tb.sha512 = "sha512-" + base64.StdEncoding.EncodeToString(sha512sum.Sum(nil))
+	return tb, nil
+}
+
+// packages lê os tarballs do diretório (reaproveitando os inalterados),
+// indexados por nome do pacote
+func (n *Npm) packages() (map[string][]npmTarball, error) {
+	base := n.dir()
+	packages := make(map[string][]npmTarball)
+	seen := make(map[string]bool)
+	err := filepath.WalkDir(base, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if p == base {
+				return err
+			}
+			return nil
+		}
+		if d.IsDir() {
+			if p != base && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasSuffix(d.Name(), ".tgz") || !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		seen[p] = true
+
+		n.mu.Lock()
+		tb, ok := n.tarballs[p]
+		n.mu.Unlock()
+		if !ok || tb.size != info.Size() || !tb.modTime.Equal(info.ModTime()) {
+			if tb, err = readTarball(p); err != nil {
+				n.logger.Warn("npm: skipping %s: %v", p, err)
+				return nil
+			}
+			tb.path, tb.size, tb.modTime = p, info.Size(), info.ModTime()
+			n.mu.Lock()
+			n.tarballs[p] = tb
+			n.mu.Unlock()
+		}
+		packages[tb.name] = append(packages[tb.name], tb)
+		return nil
+	})
+
+	// Tarballs removidos saem do cache
+	n.mu.Lock()
+	for p := range n.tarballs {
+		if !seen[p] {
+			delete(n.tarballs, p)
+		}
+	}
+	n.mu.Unlock()
+	return packages, err
+}
+
+// tarballName nome do arquivo no registry (<nome sem escopo>-<versão>.tgz)
+func tarballName(name, version string) string {
+	return path.Base(name) + "-" + version + ".tgz"
+}
+
+// handleNpm atende <prefixo><pacote> (packument) e
+// <prefixo><pacote>/-/<nome>-<versão>.tgz (tarball)
+func (s *Server) handleNpm(w http.ResponseWriter, r *http.Request) {
+	debugNote(r, "serve", "npm")
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		writeJSONError(w, http.StatusMethodNotAllowed, errors.New("this registry is read-only"))
+		return
+	}
+
+	// Pacotes com escopo chegam como @escopo%2fnome
+	rest := strings.TrimPrefix(r.URL.Path, s.npm.config.prefix())
+	name, file, isTarball := strings.Cut(rest, "/-/")
+	if !npmName.MatchString(name) {
+		writeJSONError(w, http.StatusNotFound, errors.New("not found"))
+		return
+	}
+	packages, err := s.npm.packages()
+	if err != nil {
+		s.logger.Error("npm: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, errors.New("cannot read packages"))
+		return
+	}
+	versions, protected := s.visibleNpm(r, packages[name])
+	if len(versions) == 0 {
+		writeJSONError(w, http.StatusNotFound, errors.New("not found"))
+		return
+	}
+
+	if isTarball {
+		for _, tb := range versions {
+			if tarballName(name, tb.version) == file {
+				s.serveNpmTarball(w, r, tb, protected)
+				return
+			}
+		}
+		writeJSONError(w, http.StatusNotFound, errors.New("not found"))
+		return
+	}
+	writeJSON(w, http.StatusOK, s.npm.packument(r, name, versions))
+}
+
+// packument documento do pacote com todas as versões
+func (n *Npm) packument(r *http.Request, name string, tarballs []npmTarball) map[string]interface{} {
+	versions := make(map[string]interface{})
+	times := make(map[string]string)
+	latest := ""
+	var modified time.Time
+	for _, tb := range tarballs {
+		manifest := make(map[string]interface{}, len(tb.manifest)+2)
+		for k, v := range tb.manifest {
+			manifest[k] = v
+		}
+		manifest["_id"] = name + "@" + tb.version
+		manifest["dist"] = map[string]string{
+			"tarball":   n.baseURL(r) + "/" + name + "/-/" + tarballName(name, tb.version),
+			"shasum":    tb.shasum,
+			"integrity": tb.sha512,
+		}
+		versions[tb.version] = manifest
+		times[tb.version] = tb.modTime.UTC().Format(time.RFC3339)
+		if tb.modTime.After(modified) {
+			modified = tb.modTime
+		}
+
+		// latest: a maior versão que não seja pré-lançamento
+		if !strings.Contains(tb.version, "-") && (latest == "" || semverCompare(tb.version, latest) > 0) {
+			latest = tb.version
+		}
+	}
+	if latest == "" {
+		for version := range versions {
+			if latest == "" || semverCompare(version, latest) > 0 {
+				latest = version
+			}
+		}
+	}
+	times["modified"] = modified.UTC().Format(time.RFC3339)
+	return map[string]interface{}{
+		"_id":       name,
+		"name":      name,
+		"dist-tags": map[string]string{"latest": latest},
+		"versions":  versions,
+		"time":      times,
+	}
+}
+
+// visibleNpm descarta as versões cujo tarball a rota de arquivos não serviria
+// a quem pede (ocultos, ou recusados pelas regras por caminho). Retorna se
+// alguma regra cobre os tarballs
+func (s *Server) visibleNpm(r *http.Request, tarballs []npmTarball) (visible []npmTarball, protected bool) {
+	root := s.RootDir()
+	for _, tb := range tarballs {
+		status, covered := s.fileAccess(r, root, tb.path)
+		protected = protected || covered
+		if status == 0 {
+			visible = append(visible, tb)
+		}
+	}
+	return visible, protected
+}
+
+// serveNpmTarball serve o tarball com os bytes exatos (o npm confere o
+// integrity); protegido por alguma regra, não vai para caches compartilhados
+func (s *Server) serveNpmTarball(w http.ResponseWriter, r *http.Request, tb npmTarball, protected bool) {
+	f, err := os.Open(tb.path)
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, errors.New("not found"))
+		return
+	}
+	defer f.Close()
+	w.Header().Set("Content-Type", "application/octet-stream")
+	if protected {
+		w.Header().Set("Cache-Control", "private")
+	} else {
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	}
+	skipCompression(w)
+	http.ServeContent(w, r, "", tb.modTime, f)
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeTestTarball writes an npm pack style tarball with the given package.json
+func writeTestTarball(t *testing.T, path, manifest string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for name, content := range map[string]string{"package/package.json": manifest, "package/index.js": "module.exports = 1\n"} {
+		tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg})
+		tw.Write([]byte(content))
+	}
+	tw.Close()
+	gz.Close()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+type testPackument struct {
+	Name     string            `json:"name"`
+	DistTags map[string]string `json:"dist-tags"`
+	Versions map[string]struct {
+		Version      string            `json:"version"`
+		Dependencies map[string]string `json:"dependencies"`
+		Dist         struct {
+			Tarball   string `json:"tarball"`
+			Shasum    string `json:"shasum"`
+			Integrity string `json:"integrity"`
+		} `json:"dist"`
+	} `json:"versions"`
+}
+
+func newNpmTestServer(t *testing.T) (*Server, []byte) {
+	t.Helper()
+	root := t.TempDir()
+	tarball := writeTestTarball(t, filepath.Join(root, "npm", "left-pad-1.0.0.tgz"), `{"name":"left-pad","version":"1.0.0","dependencies":{"a":"^1.0.0"}}`)
+	writeTestTarball(t, filepath.Join(root, "npm", "left-pad-1.1.0.tgz"), `{"name":"left-pad","version":"1.1.0"}`)
+	writeTestTarball(t, filepath.Join(root, "npm", "left-pad-2.0.0-beta.1.tgz"), `{"name":"left-pad","version":"2.0.0-beta.1"}`)
+	writeTestTarball(t, filepath.Join(root, "npm", "scoped", "util-0.1.0.tgz"), `{"name":"@acme/util","version":"0.1.0"}`)
+	writeTestFile(t, filepath.Join(root, "npm", "broken.tgz"), "not a tarball")
+	server := newListingTestServer(t, root, func(c *Config) {
+		c.Npm = &NpmConfig{Enabled: true, Dir: "npm"}
+	})
+	return server, tarball
+}
+
+func TestNpmPackument(t *testing.T) {
+	server, tarball := newNpmTestServer(t)
+	req := httptest.NewRequest("GET", "http://registry.local/npm/left-pad", nil)
+	w := httptest.NewRecorder()
+	server.mux.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d %s", w.Code, w.Body.String())
+	}
+	var doc testPackument
+	if err := json.Unmarshal(w.Body.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc.Name != "left-pad" || len(doc.Versions) != 3 || doc.DistTags["latest"] != "1.1.0" {
+		t.Errorf("Unexpected packument %+v", doc)
+	}
+	v1 := doc.Versions["1.0.0"]
+	sum := sha512.Sum512(tarball)
+	if v1.Dist.Integrity != "sha512-"+base64.StdEncoding.EncodeToString(sum[:]) || len(v1.Dist.Shasum) != 40 {
+		t.Errorf("Unexpected dist %+v", v1.Dist)
+	}
+	if v1.Dist.Tarball != "http://registry.local/npm/left-pad/-/left-pad-1.0.0.tgz" || v1.Dependencies["a"] != "^1.0.0" {
+		t.Errorf("Expected tarball URL and manifest fields, got %+v", v1)
+	}
+}
+
+func TestNpmScopedPackageAndTarball(t *testing.T) {
+	server, tarball := newNpmTestServer(t)
+
+	w := httptest.NewRecorder()
+	server.mux.ServeHTTP(w, httptest.NewRequest("GET", "/npm/@acme%2futil", nil))
+	var doc testPackument
+	json.Unmarshal(w.Body.Bytes(), &doc)
+	if doc.Name != "@acme/util" || doc.Versions["0.1.0"].Dist.Tarball == "" {
+		t.Errorf("Expected scoped packument, got %d %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	server.mux.ServeHTTP(w, httptest.NewRequest("GET", "/npm/left-pad/-/left-pad-1.0.0.tgz", nil))
+	if w.Code != http.StatusOK || !bytes.Equal(w.Body.Bytes(), tarball) {
+		t.Errorf("Expected exact tarball bytes, got %d", w.Code)
+	}
+
+	for _, path := range []string{"/npm/left-pad/-/left-pad-9.9.9.tgz", "/npm/missing", "/npm/../etc"} {
+		w := httptest.NewRecorder()
+		server.mux.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if w.Code == http.StatusOK {
+			t.Errorf("Expected %s to be rejected", path)
+		}
+	}
+
+	w = httptest.NewRecorder()
+	server.mux.ServeHTTP(w, httptest.NewRequest("PUT", "/npm/left-pad", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected publish to be rejected, got %d", w.Code)
+	}
+}
+
+func TestNpmAppliesPathRules(t *testing.T) {
+	root := t.TempDir()
+	writeTestTarball(t, filepath.Join(root, "npm", "left-pad-1.0.0.tgz"), `{"name":"left-pad","version":"1.0.0"}`)
+	writeTestTarball(t, filepath.Join(root, "npm", "internal", "left-pad-1.1.0.tgz"), `{"name":"left-pad","version":"1.1.0"}`)
+	server := newListingTestServer(t, root, func(c *Config) {
+		c.Npm = &NpmConfig{Enabled: true, Dir: "npm"}
+		c.Security.ProxyAuth = &ProxyAuthConfig{
+			Enabled:        true,
+			TrustedProxies: []string{"192.0.2.1"},
+			ACL:            []ProxyACLRule{{Path: "/npm/internal/**", Groups: []string{"admins"}}},
+		}
+	})
+	get := func(target string, groups string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", target, nil)
+		if groups != "" {
+			req.Header.Set("Remote-User", "alice")
+			req.Header.Set("Remote-Groups", groups)
+		}
+		w := httptest.NewRecorder()
+		server.mux.ServeHTTP(w, req)
+		return w
+	}
+
+	var doc testPackument
+	json.Unmarshal(get("/npm/left-pad", "").Body.Bytes(), &doc)
+	if _, ok := doc.Versions["1.1.0"]; ok || doc.DistTags["latest"] != "1.0.0" {
+		t.Errorf("Expected protected version to be hidden, got %+v", doc)
+	}
+	if w := get("/npm/left-pad/-/left-pad-1.1.0.tgz", ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for protected tarball, got %d", w.Code)
+	}
+	w := get("/npm/left-pad/-/left-pad-1.1.0.tgz", "admins")
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected admins to download, got %d", w.Code)
+	}
+	if cc := w.Header().Get("Cache-Control"); cc != "private" {
+		t.Errorf("Expected private tarball, got %q", cc)
+	}
+}
@@ -0,0 +1,399 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// OCSPStapler busca a resposta OCSP do certificado no responder da CA e a
+// entrega no handshake TLS (stapling): clientes que exigem a resposta não
+// precisam consultar a CA e os que falham sem ela deixam de falhar
+type OCSPStapler struct {
+	config    *OCSPStaplingConfig
+	certFile  string
+	logger    *Logger
+	client    *http.Client
+	cert      tls.Certificate
+	leaf      *x509.Certificate
+	issuer    *x509.Certificate
+	responder string
+
+	mu       sync.Mutex
+	stapled  *tls.Certificate // cert com a resposta atual; nil sem resposta válida
+	staple   ocspStaple
+	failures atomic.Int64
+}
+
+// ocspStaple resposta OCSP aceita
+type ocspStaple struct {
+	raw        []byte
+	thisUpdate time.Time
+	nextUpdate time.Time
+}
+
+var (
+	oidSHA1              = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}
+	oidOCSPBasicResponse = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 48, 1, 1}
+)
+
+// Estruturas ASN.1 da RFC 6960 (apenas os campos usados)
+type ocspCertID struct {
+	HashAlgorithm pkix.AlgorithmIdentifier
+	NameHash      []byte
+	IssuerKeyHash []byte
+	SerialNumber  *big.Int
+}
+
+type ocspRequestEntry struct {
+	Cert ocspCertID
+}
+
+type ocspTBSRequest struct {
+	RequestList []ocspRequestEntry
+}
+
+type ocspRequest struct {
+	TBSRequest ocspTBSRequest
+}
+
+type ocspResponse struct {
+	Status   asn1.Enumerated
+	Response ocspResponseBytes `asn1:"explicit,tag:0,optional"`
+}
+
+type ocspResponseBytes struct {
+	ResponseType asn1.ObjectIdentifier
+	Response     []byte
+}
+
+type ocspBasicResponse struct {
+	TBSResponseData    asn1.RawValue
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          asn1.BitString
+	Certificates       []asn1.RawValue `asn1:"explicit,tag:0,optional"`
+}
+
+type ocspResponseData struct {
+	Raw            asn1.RawContent
+	Version        int `asn1:"optional,default:0,explicit,tag:0"`
+	RawResponderID asn1.RawValue
+	ProducedAt     time.Time `asn1:"generalized"`
+	Responses      []ocspSingleResponse
+}
+
+type ocspSingleResponse struct {
+	CertID           ocspCertID
+	Good             asn1.Flag        `asn1:"tag:0,optional"`
+	Revoked          ocspRevokedInfo  `asn1:"tag:1,optional"`
+	Unknown          asn1.Flag        `asn1:"tag:2,optional"`
+	ThisUpdate       time.Time        `asn1:"generalized"`
+	NextUpdate       time.Time        `asn1:"generalized,explicit,tag:0,optional"`
+	SingleExtensions []pkix.Extension `asn1:"explicit,tag:1,optional"`
+}
+
+type ocspRevokedInfo struct {
+	RevocationTime time.Time       `asn1:"generalized"`
+	Reason         asn1.Enumerated `asn1:"explicit,tag:0,optional"`
+}
+
+// ocspSignatureAlgorithms algoritmos aceitos na assinatura da resposta
+var ocspSignatureAlgorithms = []struct {
+	oid  asn1.ObjectIdentifier
+	algo x509.SignatureAlgorithm
+}{
+	{asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 5}, x509.SHA1WithRSA},
+	{asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 11}, x509.SHA256WithRSA},
+	{asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 12}, x509.SHA384WithRSA},
+	{asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 13}, x509.SHA512WithRSA},
+	{asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 1}, x509.ECDSAWithSHA1},
+	{asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}, x509.ECDSAWithSHA256},
+	{asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 3}, x509.ECDSAWithSHA384},
+	{asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 4}, x509.ECDSAWithSHA512},
+	{asn1.ObjectIdentifier{1, 3, 101, 112}, x509.PureEd25519},
+}
+
+// NewOCSPStapler carrega o par de chaves; o cert_file precisa trazer o
+// certificado intermediário (emissor) logo após o da folha
+func NewOCSPStapler(config *OCSPStaplingConfig, certFile, keyFile string, logger *Logger) (*OCSPStapler, error) {
+	if config.Interval < 0 {
+		return nil, errors.New("ocsp_stapling: interval must not be negative")
+	}
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	if len(cert.Certificate) < 2 {
+		return nil, fmt.Errorf("ocsp_stapling: %s has no issuer certificate (append the intermediate to the file)", certFile)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return nil, err
+	}
+	issuer, err := x509.ParseCertificate(cert.Certificate[1])
+	if err != nil {
+		return nil, err
+	}
+	responder := config.Responder
+	if responder == "" {
+		if len(leaf.OCSPServer) == 0 {
+			return nil, fmt.Errorf("ocsp_stapling: %s has no OCSP responder URL (set responder)", certFile)
+		}
+		responder = leaf.OCSPServer[0]
+	}
+	return &OCSPStapler{
+		config:    config,
+		certFile:  certFile,
+		logger:    logger,
+		client:    &http.Client{Timeout: 15 * time.Second},
+		cert:      cert,
+		leaf:      leaf,
+		issuer:    issuer,
+		responder: responder,
+	}, nil
+}
+
+// interval retorna o intervalo entre verificações da resposta
+func (o *OCSPStapler) interval() time.Duration {
+	if o.config.Interval <= 0 {
+		return time.Hour
+	}
+	return time.Duration(o.config.Interval) * time.Second
+}
+
+// Refresh busca uma nova resposta quando a atual passou da metade da
+// validade (ou não existe); se a busca falhar, a atual segue em uso até
+// expirar
+func (o *OCSPStapler) Refresh() (string, error) {
+	o.mu.Lock()
+	current := o.staple
+	o.mu.Unlock()
+	if current.raw != nil && time.Now().Before(current.refreshAt()) {
+		return fmt.Sprintf("staple valid until %s", current.nextUpdate.UTC().Format(time.RFC3339)), nil
+	}
+
+	staple, err := o.fetch()
+	o.mu.Lock()
+	if err == nil {
+		o.staple = staple
+		stapled := o.cert
+		stapled.OCSPStaple = staple.raw
+		o.stapled = &stapled
+	} else if o.staple.raw != nil && !o.staple.nextUpdate.IsZero() && time.Now().After(o.staple.nextUpdate) {
+		o.staple = ocspStaple{}
+		o.stapled = nil
+	}
+	o.mu.Unlock()
+	if err != nil {
+		o.failures.Add(1)
+		return "", err
+	}
+	if staple.nextUpdate.IsZero() {
+		return "stapled", nil
+	}
+	return fmt.Sprintf("stapled, valid until %s", staple.nextUpdate.UTC().Format(time.RFC3339)), nil
+}
+
+// refreshAt momento de buscar a próxima resposta: metade da validade, ou
+// um intervalo depois de thisUpdate quando o responder não informa nextUpdate
+func (s ocspStaple) refreshAt() time.Time {
+	if s.nextUpdate.IsZero() {
+		return s.thisUpdate.Add(12 * time.Hour)
+	}
+	return s.thisUpdate.Add(s.nextUpdate.Sub(s.thisUpdate) / 2)
+}
+
+// fetch consulta o responder e valida a resposta
+func (o *OCSPStapler) fetch() (ocspStaple, error) {
+	body, err := o.request()
+	if err != nil {
+		return ocspStaple{}, err
+	}
+	req, err := http.NewRequest(http.MethodPost, o.responder, bytes.NewReader(body))
+	if err != nil {
+		return ocspStaple{}, err
+	}
+	req.Header.Set("Content-Type", "application/ocsp-request")
+	req.Header.Set("Accept", "application/ocsp-response")
+	req.Header.Set("User-Agent", "qserv")
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return ocspStaple{}, fmt.Errorf("OCSP responder: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return ocspStaple{}, fmt.Errorf("OCSP responder: unexpected status %s", resp.Status)
+	}
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return ocspStaple{}, fmt.Errorf("OCSP responder: %w", err)
+	}
+	return o.parse(raw)
+}
+
+// certID identifica o certificado da folha na requisição e na resposta
+func (o *OCSPStapler) certID() (ocspCertID, error) {
+	var spki struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}
+	if _, err := asn1.Unmarshal(o.issuer.RawSubjectPublicKeyInfo, &spki); err != nil {
+		return ocspCertID{}, err
+	}
+	nameHash := sha1.Sum(o.issuer.RawSubject)
+	keyHash := sha1.Sum(spki.PublicKey.RightAlign())
+	return ocspCertID{
+		HashAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidSHA1, Parameters: asn1.NullRawValue},
+		NameHash:      nameHash[:],
+		IssuerKeyHash: keyHash[:],
+		SerialNumber:  o.leaf.SerialNumber,
+	}, nil
+}
+
+// request monta a requisição OCSP (DER)
+func (o *OCSPStapler) request() ([]byte, error) {
+	id, err := o.certID()
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(ocspRequest{TBSRequest: ocspTBSRequest{RequestList: []ocspRequestEntry{{Cert: id}}}})
+}
+
+// parse valida a resposta: sucesso, assinada pelo emissor (ou por um
+// responder delegado por ele), sobre este certificado, status good e dentro
+// da validade
+func (o *OCSPStapler) parse(raw []byte) (ocspStaple, error) {
+	var resp ocspResponse
+	if rest, err := asn1.Unmarshal(raw, &resp); err != nil || len(rest) > 0 {
+		return ocspStaple{}, errors.New("OCSP response: malformed")
+	}
+	if resp.Status != 0 {
+		return ocspStaple{}, fmt.Errorf("OCSP response: responder status %d", resp.Status)
+	}
+	if !resp.Response.ResponseType.Equal(oidOCSPBasicResponse) {
+		return ocspStaple{}, errors.New("OCSP response: unsupported response type")
+	}
+	var basic ocspBasicResponse
+	if _, err := asn1.Unmarshal(resp.Response.Response, &basic); err != nil {
+		return ocspStaple{}, errors.New("OCSP response: malformed basic response")
+	}
+	var data ocspResponseData
+	if _, err := asn1.Unmarshal(basic.TBSResponseData.FullBytes, &data); err != nil {
+		return ocspStaple{}, errors.New("OCSP response: malformed response data")
+	}
+
+	if err := o.verify(&basic); err != nil {
+		return ocspStaple{}, err
+	}
+
+	id, err := o.certID()
+	if err != nil {
+		return ocspStaple{}, err
+	}
+	for _, single := range data.Responses {
+		if !single.CertID.HashAlgorithm.Algorithm.Equal(oidSHA1) || single.CertID.SerialNumber == nil ||
+			single.CertID.SerialNumber.Cmp(id.SerialNumber) != 0 ||
+			!bytes.Equal(single.CertID.NameHash, id.NameHash) || !bytes.Equal(single.CertID.IssuerKeyHash, id.IssuerKeyHash) {
+			continue
+		}
+		switch {
+		case bool(single.Good):
+		case bool(single.Unknown):
+			return ocspStaple{}, errors.New("OCSP response: certificate status unknown")
+		default:
+			return ocspStaple{}, fmt.Errorf("OCSP response: certificate revoked at %s", single.Revoked.RevocationTime.UTC().Format(time.RFC3339))
+		}
+		now := time.Now()
+		if single.ThisUpdate.After(now.Add(5 * time.Minute)) {
+			return ocspStaple{}, errors.New("OCSP response: thisUpdate is in the future")
+		}
+		if !single.NextUpdate.IsZero() && now.After(single.NextUpdate) {
+			return ocspStaple{}, errors.New("OCSP response: expired")
+		}
+		return ocspStaple{raw: raw, thisUpdate: single.ThisUpdate, nextUpdate: single.NextUpdate}, nil
+	}
+	return ocspStaple{}, errors.New("OCSP response: no status for the certificate")
+}
+
+// verify confere a assinatura da resposta
+func (o *OCSPStapler) verify(basic *ocspBasicResponse) error {
+	algo := x509.UnknownSignatureAlgorithm
+	for _, a := range ocspSignatureAlgorithms {
+		if a.oid.Equal(basic.SignatureAlgorithm.Algorithm) {
+			algo = a.algo
+		}
+	}
+	if algo == x509.UnknownSignatureAlgorithm {
+		return errors.New("OCSP response: unsupported signature algorithm")
+	}
+
+	signer := o.issuer
+	if len(basic.Certificates) > 0 {
+		delegated, err := x509.ParseCertificate(basic.Certificates[0].FullBytes)
+		if err != nil {
+			return errors.New("OCSP response: malformed responder certificate")
+		}
+		if !bytes.Equal(delegated.Raw, o.issuer.Raw) {
+			if err := delegated.CheckSignatureFrom(o.issuer); err != nil {
+				return fmt.Errorf("OCSP response: responder certificate not issued by the CA: %w", err)
+			}
+			ocspSigning := false
+			for _, usage := range delegated.ExtKeyUsage {
+				ocspSigning = ocspSigning || usage == x509.ExtKeyUsageOCSPSigning
+			}
+			if !ocspSigning {
+				return errors.New("OCSP response: responder certificate lacks OCSP signing usage")
+			}
+			signer = delegated
+		}
+	}
+	if err := signer.CheckSignature(algo, basic.TBSResponseData.FullBytes, basic.Signature.RightAlign()); err != nil {
+		return fmt.Errorf("OCSP response: bad signature: %w", err)
+	}
+	return nil
+}
+
+// GetCertificate entrega o certificado com a resposta OCSP atual, ou sem
+// ela enquanto não houver uma válida
+func (o *OCSPStapler) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.stapled != nil && (o.staple.nextUpdate.IsZero() || time.Now().Before(o.staple.nextUpdate)) {
+		return o.stapled, nil
+	}
+	return &o.cert, nil
+}
+
+// WriteMetrics exporta idade e validade da resposta grampeada
+func (o *OCSPStapler) WriteMetrics(w io.Writer) {
+	o.mu.Lock()
+	staple := o.staple
+	o.mu.Unlock()
+	labels := map[string]string{"file": o.certFile}
+	stapled, age := 0.0, 0.0
+	if staple.raw != nil && (staple.nextUpdate.IsZero() || time.Now().Before(staple.nextUpdate)) {
+		stapled = 1
+		age = time.Since(staple.thisUpdate).Seconds()
+	}
+	writeMetric(w, "qserv_ocsp_staple_valid", "Whether a valid OCSP response is being stapled (1) or not (0).", "gauge",
+		[]metricSample{{labels: labels, value: stapled}})
+	writeMetric(w, "qserv_ocsp_staple_age_seconds", "Age of the stapled OCSP response (since thisUpdate).", "gauge",
+		[]metricSample{{labels: labels, value: age}})
+	if !staple.nextUpdate.IsZero() {
+		writeMetric(w, "qserv_ocsp_staple_next_update_timestamp_seconds", "nextUpdate of the stapled OCSP response (Unix time).", "gauge",
+			[]metricSample{{labels: labels, value: float64(staple.nextUpdate.Unix())}})
+	}
+	writeMetric(w, "qserv_ocsp_fetch_errors_total", "Failed OCSP response fetches.", "counter",
+		[]metricSample{{labels: labels, value: float64(o.failures.Load())}})
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// ocspResponder signs OCSP responses for a test CA
+type ocspResponder struct {
+	ca       *x509.Certificate
+	key      *ecdsa.PrivateKey
+	signer   *ecdsa.PrivateKey // key used to sign (ca key unless overridden)
+	revoked  bool
+	validFor time.Duration
+	requests atomic.Int64
+}
+
+func (o *ocspResponder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	o.requests.Add(1)
+	body, _ := io.ReadAll(r.Body)
+	var req ocspRequest
+	if _, err := asn1.Unmarshal(body, &req); err != nil || len(req.TBSRequest.RequestList) != 1 {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now().Add(-time.Minute)
+	single := ocspSingleResponse{CertID: req.TBSRequest.RequestList[0].Cert, ThisUpdate: now, NextUpdate: now.Add(o.validFor)}
+	if o.revoked {
+		single.Revoked = ocspRevokedInfo{RevocationTime: now.Add(-time.Hour)}
+	} else {
+		single.Good = true
+	}
+	keyHash, _ := asn1.Marshal(sha256.Sum256(o.ca.RawSubjectPublicKeyInfo))
+	tbs, err := asn1.Marshal(ocspResponseData{
+		RawResponderID: asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 2, IsCompound: true, Bytes: keyHash},
+		ProducedAt:     now,
+		Responses:      []ocspSingleResponse{single},
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	digest := sha256.Sum256(tbs)
+	signer := o.signer
+	if signer == nil {
+		signer = o.key
+	}
+	sig, _ := ecdsa.SignASN1(rand.Reader, signer, digest[:])
+	basic, _ := asn1.Marshal(ocspBasicResponse{
+		TBSResponseData:    asn1.RawValue{FullBytes: tbs},
+		SignatureAlgorithm: pkix.AlgorithmIdentifier{Algorithm: asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}},
+		Signature:          asn1.BitString{Bytes: sig, BitLength: len(sig) * 8},
+	})
+	resp, _ := asn1.Marshal(ocspResponse{Response: ocspResponseBytes{ResponseType: oidOCSPBasicResponse, Response: basic}})
+	w.Header().Set("Content-Type", "application/ocsp-response")
+	w.Write(resp)
+}
+
+// writeTestChain writes a leaf certificate followed by its CA and returns
+// the files and a responder for the CA; ocspURL goes into the leaf
+func writeTestChain(t *testing.T, dir string, ocspURL string) (certFile, keyFile string, responder *ocspResponder) {
+	t.Helper()
+	caKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "qserv test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, _ := x509.ParseCertificate(caDER)
+
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(4242),
+		Subject:      pkix.Name{CommonName: "qserv.test"},
+		DNSNames:     []string{"qserv.test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+	}
+	if ocspURL != "" {
+		template.OCSPServer = []string{ocspURL}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+
+	chain := append(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER})...)
+	certFile, keyFile = filepath.Join(dir, "chain.pem"), filepath.Join(dir, "key.pem")
+	os.WriteFile(certFile, chain, 0644)
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+	return certFile, keyFile, &ocspResponder{ca: ca, key: caKey, validFor: 4 * 24 * time.Hour}
+}
+
+// newTestStapler starts a responder and a stapler for a fresh chain
+func newTestStapler(t *testing.T) (*OCSPStapler, *ocspResponder) {
+	t.Helper()
+	var responder *ocspResponder
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { responder.ServeHTTP(w, r) })
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	certFile, keyFile, responder := writeTestChain(t, t.TempDir(), server.URL)
+	logger, _ := NewLogger(&LoggingConfig{Enabled: false})
+	stapler, err := NewOCSPStapler(&OCSPStaplingConfig{Enabled: true}, certFile, keyFile, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return stapler, responder
+}
+
+func TestOCSPStaplerRefresh(t *testing.T) {
+	stapler, responder := newTestStapler(t)
+
+	if cert, _ := stapler.GetCertificate(nil); cert.OCSPStaple != nil {
+		t.Error("Expected no staple before the first fetch")
+	}
+	if _, err := stapler.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := stapler.GetCertificate(nil)
+	if len(cert.OCSPStaple) == 0 {
+		t.Fatal("Expected stapled OCSP response")
+	}
+
+	// Still fresh: no new request
+	if _, err := stapler.Refresh(); err != nil || responder.requests.Load() != 1 {
+		t.Errorf("Expected the staple to be reused, got %d requests (%v)", responder.requests.Load(), err)
+	}
+
+	var metrics bytes.Buffer
+	stapler.WriteMetrics(&metrics)
+	for _, want := range []string{"qserv_ocsp_staple_valid{", "} 1\n", "qserv_ocsp_staple_age_seconds{", "qserv_ocsp_staple_next_update_timestamp_seconds{"} {
+		if !strings.Contains(metrics.String(), want) {
+			t.Errorf("Expected %q in metrics:\n%s", want, metrics.String())
+		}
+	}
+}
+
+func TestOCSPStaplerRejects(t *testing.T) {
+	other, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	tests := []struct {
+		name      string
+		configure func(*ocspResponder)
+		want      string
+	}{
+		{"revoked", func(r *ocspResponder) { r.revoked = true }, "revoked"},
+		{"bad signature", func(r *ocspResponder) { r.signer = other }, "signature"},
+		{"expired", func(r *ocspResponder) { r.validFor = time.Second }, "expired"},
+	}
+	for _, tt := range tests {
+		stapler, responder := newTestStapler(t)
+		tt.configure(responder)
+		if _, err := stapler.Refresh(); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: expected error containing %q, got %v", tt.name, tt.want, err)
+		}
+		if cert, _ := stapler.GetCertificate(nil); cert.OCSPStaple != nil {
+			t.Errorf("%s: expected no staple", tt.name)
+		}
+		if stapler.failures.Load() != 1 {
+			t.Errorf("%s: expected one failure, got %d", tt.name, stapler.failures.Load())
+		}
+	}
+}
+
+func TestOCSPStaplingHandshake(t *testing.T) {
+	var responder *ocspResponder
+	ocspServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { responder.ServeHTTP(w, r) }))
+	defer ocspServer.Close()
+	certFile, keyFile, responder := writeTestChain(t, t.TempDir(), ocspServer.URL)
+
+	server := newListingTestServer(t, t.TempDir(), func(c *Config) {
+		c.Security.EnableHTTPS = true
+		c.Security.CertFile = certFile
+		c.Security.KeyFile = keyFile
+		c.Security.OCSPStapling = &OCSPStaplingConfig{Enabled: true}
+	})
+	if server.ocsp == nil {
+		t.Fatal("Expected OCSP stapling to be enabled")
+	}
+	if _, err := server.ocsp.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	httpServer := server.httpServer("")
+	go httpServer.ServeTLS(l, "", "")
+	defer httpServer.Close()
+
+	conn, err := tls.Dial("tcp", l.Addr().String(), &tls.Config{ServerName: "qserv.test", InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if len(conn.ConnectionState().OCSPResponse) == 0 {
+		t.Error("Expected the handshake to carry the OCSP response")
+	}
+}
+
+func TestNewOCSPStaplerErrors(t *testing.T) {
+	config := &OCSPStaplingConfig{Enabled: true}
+
+	// Without the issuer in the file
+	certFile, keyFile := writeTestCert(t, t.TempDir(), time.Now().Add(24*time.Hour))
+	if _, err := NewOCSPStapler(config, certFile, keyFile, nil); err == nil || !strings.Contains(err.Error(), "issuer") {
+		t.Errorf("Expected missing issuer error, got %v", err)
+	}
+
+	// Without a responder URL
+	certFile, keyFile, _ = writeTestChain(t, t.TempDir(), "")
+	if _, err := NewOCSPStapler(config, certFile, keyFile, nil); err == nil || !strings.Contains(err.Error(), "responder") {
+		t.Errorf("Expected missing responder error, got %v", err)
+	}
+	if _, err := NewOCSPStapler(&OCSPStaplingConfig{Enabled: true, Responder: "http://ocsp.example.com"}, certFile, keyFile, nil); err != nil {
+		t.Errorf("Expected configured responder to be accepted, got %v", err)
+	}
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// pkgRepoCommandTimeout tempo máximo de um comando de regeneração
+const pkgRepoCommandTimeout = 30 * time.Minute
+
+// pkgRepoTypes tipos de conteúdo por extensão dentro dos repositórios
+var pkgRepoTypes = map[string]string{
+	".deb":       "application/vnd.debian.binary-package",
+	".udeb":      "application/vnd.debian.binary-package",
+	".ddeb":      "application/vnd.debian.binary-package",
+	".rpm":       "application/x-rpm",
+	".dsc":       "text/plain; charset=utf-8",
+	".changes":   "text/plain; charset=utf-8",
+	".buildinfo": "text/plain; charset=utf-8",
+	".gz":        "application/gzip",
+	".xz":        "application/x-xz",
+	".bz2":       "application/x-bzip2",
+	".zst":       "application/zstd",
+	".lz4":       "application/x-lz4",
+	".gpg":       "application/pgp-signature",
+	".asc":       "application/pgp-signature",
+	".sig":       "application/pgp-signature",
+	".key":       "application/pgp-keys",
+	".xml":       "application/xml",
+	".sqlite":    "application/vnd.sqlite3",
+}
+
+// PackageRepos tratamento de diretórios que são repositórios apt ou yum:
+// tipos de conteúdo corretos, metadados sem cache, arquivos por hash
+// imutáveis, bytes exatos (sem gzip) e regeneração opcional dos índices
+type PackageRepos struct {
+	config *PackageReposConfig
+	logger *Logger
+
+	mu    sync.Mutex
+	state map[string]pkgRepoState // por nome: conteúdo na última regeneração
+}
+
+// pkgRepoState pacotes vistos na última regeneração
+type pkgRepoState struct {
+	files  int
+	newest time.Time
+}
+
+// NewPackageRepos valida os repositórios configurados
+func NewPackageRepos(config *PackageReposConfig, logger *Logger) (*PackageRepos, error) {
+	names := make(map[string]bool)
+	for i, repo := range config.Repos {
+		if repo.Name == "" || names[repo.Name] {
+			return nil, fmt.Errorf("package_repos: repo %d needs a unique name", i)
+		}
+		names[repo.Name] = true
+		if !strings.HasPrefix(repo.Path, "/") {
+			return nil, fmt.Errorf("package_repos: %s: path must start with /", repo.Name)
+		}
+		if repo.Type != "apt" && repo.Type != "yum" {
+			return nil, fmt.Errorf("package_repos: %s: type must be apt or yum, got %q", repo.Name, repo.Type)
+		}
+		if repo.Interval > 0 && len(repo.Regenerate) == 0 {
+			return nil, fmt.Errorf("package_repos: %s: interval needs a regenerate command", repo.Name)
+		}
+	}
+	return &PackageRepos{config: config, logger: logger, state: make(map[string]pkgRepoState)}, nil
+}
+
+// repoPrefix prefixo do repositório na URL, sempre terminado em /
+func repoPrefix(repo *PackageRepoConfig) string {
+	return strings.TrimSuffix(repo.Path, "/") + "/"
+}
+
+// match retorna o repositório que contém urlPath
+func (p *PackageRepos) match(urlPath string) (*PackageRepoConfig, string, bool) {
+	for i := range p.config.Repos {
+		repo := &p.config.Repos[i]
+		if rel, ok := strings.CutPrefix(urlPath, repoPrefix(repo)); ok {
+			return repo, rel, true
+		}
+	}
+	return nil, "", false
+}
+
+// Prepare ajusta os headers de um arquivo de repositório antes de servi-lo;
+// retorna false se urlPath não está em um repositório
+func (p *PackageRepos) Prepare(w http.ResponseWriter, urlPath string) bool {
+	repo, rel, ok := p.match(urlPath)
+	if !ok {
+		return false
+	}
+	name := path.Base(rel)
+	h := w.Header()
+	if ctype, ok := pkgRepoTypes[strings.ToLower(path.Ext(name))]; ok {
+		h.Set("Content-Type", ctype)
+	} else if path.Ext(name) == "" {
+		// Release, InRelease, Packages, Sources, Contents-amd64, ...
+		h.Set("Content-Type", "text/plain; charset=utf-8")
+	}
+	switch pkgRepoCaching(repo.Type, rel) {
+	case "metadata":
+		h.Set("Cache-Control", "no-cache")
+	case "immutable":
+		h.Set("Cache-Control", "public, max-age=31536000, immutable")
+	}
+
+	// Os clientes conferem tamanho e hash dos arquivos baixados
+	skipCompression(w)
+	return true
+}
+
+// pkgRepoCaching classifica o arquivo: metadata (muda a cada publicação),
+// immutable (nome derivado do conteúdo) ou "" (política padrão)
+func pkgRepoCaching(kind, rel string) string {
+	parts := strings.Split(rel, "/")
+	name := parts[len(parts)-1]
+	in := func(dir string) bool {
+		for _, part := range parts[:len(parts)-1] {
+			if part == dir {
+				return true
+			}
+		}
+		return false
+	}
+	if kind == "apt" {
+		switch {
+		case in("by-hash"):
+			return "immutable"
+		case in("dists"), name == "InRelease", name == "Release", name == "Release.gpg",
+			strings.HasPrefix(name, "Packages"), strings.HasPrefix(name, "Sources"):
+			return "metadata"
+		}
+		return ""
+	}
+	switch {
+	case strings.HasPrefix(name, "repomd.xml"):
+		return "metadata"
+	case in("repodata"):
+		// Os demais arquivos de repodata têm o checksum no nome
+		return "immutable"
+	}
+	return ""
+}
+
+// metadataDir diretório dos índices gerados, ignorado na detecção de mudanças
+func metadataDir(kind string) string {
+	if kind == "apt" {
+		return "dists"
+	}
+	return "repodata"
+}
+
+// scanPackages conta os arquivos do repositório (fora dos índices) e
+// retorna o mtime mais recente
+func scanPackages(dir, kind string) (pkgRepoState, error) {
+	var state pkgRepoState
+	skip := filepath.Join(dir, metadataDir(kind))
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path == skip || (path != dir && strings.HasPrefix(d.Name(), ".")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		state.files++
+		if info.ModTime().After(state.newest) {
+			state.newest = info.ModTime()
+		}
+		return nil
+	})
+	return state, err
+}
+
+// Regenerate executa o comando de regeneração do repositório no diretório
+// dele, se os pacotes mudaram desde a última execução
+func (p *PackageRepos) Regenerate(repo *PackageRepoConfig, root string) (string, error) {
+	dir := filepath.Join(root, filepath.FromSlash(strings.TrimPrefix(repoPrefix(repo), "/")))
+	current, err := scanPackages(dir, repo.Type)
+	if err != nil {
+		return "", err
+	}
+	p.mu.Lock()
+	last, ok := p.state[repo.Name]
+	p.mu.Unlock()
+	if ok && last.files == current.files && last.newest.Equal(current.newest) {
+		return "unchanged", nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), pkgRepoCommandTimeout)
+	defer cancel()
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, repo.Regenerate[0], repo.Regenerate[1:]...)
+	cmd.Dir = dir
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return "", fmt.Errorf("%s: timed out after %s", repo.Regenerate[0], pkgRepoCommandTimeout)
+		}
+		return "", fmt.Errorf("%s: %v: %s", repo.Regenerate[0], err, strings.TrimSpace(stderr.String()))
+	}
+
+	p.mu.Lock()
+	p.state[repo.Name] = current
+	p.mu.Unlock()
+	p.logger.Info("Package repo %s: metadata regenerated (%d files)", repo.Name, current.files)
+	return fmt.Sprintf("regenerated (%d files)", current.files), nil
+}
+
+// pkgRepoJob nome do job de regeneração do repositório
+func pkgRepoJob(repo *PackageRepoConfig) string {
+	return "package-repo-" + repo.Name
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newPackageRepoTestServer(t *testing.T, root string, repos ...PackageRepoConfig) *Server {
+	t.Helper()
+	return newListingTestServer(t, root, func(c *Config) {
+		c.Features.PackageRepos = &PackageReposConfig{Enabled: true, Repos: repos}
+	})
+}
+
+func TestPackageRepoContentTypesAndCaching(t *testing.T) {
+	root := t.TempDir()
+	writeTestFile(t, filepath.Join(root, "debian", "dists", "stable", "InRelease"), "signed")
+	writeTestFile(t, filepath.Join(root, "debian", "dists", "stable", "main", "binary-amd64", "by-hash", "SHA256", "abc"), "packages")
+	writeTestFile(t, filepath.Join(root, "debian", "pool", "main", "h", "hello_1.0_amd64.deb"), "deb")
+	writeTestFile(t, filepath.Join(root, "rpms", "repodata", "repomd.xml"), "<repomd/>")
+	writeTestFile(t, filepath.Join(root, "rpms", "repodata", "0123-primary.xml.zst"), "primary")
+	writeTestFile(t, filepath.Join(root, "rpms", "hello-1.0.x86_64.rpm"), "rpm")
+	server := newPackageRepoTestServer(t, root,
+		PackageRepoConfig{Name: "debian", Path: "/debian/", Type: "apt"},
+		PackageRepoConfig{Name: "rpms", Path: "/rpms", Type: "yum"},
+	)
+
+	tests := []struct {
+		path, contentType, cacheControl string
+	}{
+		{"/debian/dists/stable/InRelease", "text/plain; charset=utf-8", "no-cache"},
+		{"/debian/dists/stable/main/binary-amd64/by-hash/SHA256/abc", "text/plain; charset=utf-8", "immutable"},
+		{"/debian/pool/main/h/hello_1.0_amd64.deb", "application/vnd.debian.binary-package", ""},
+		{"/rpms/repodata/repomd.xml", "application/xml", "no-cache"},
+		{"/rpms/repodata/0123-primary.xml.zst", "application/zstd", "immutable"},
+		{"/rpms/hello-1.0.x86_64.rpm", "application/x-rpm", ""},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		server.mux.ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+		if w.Code != http.StatusOK {
+			t.Errorf("%s: expected 200, got %d", tt.path, w.Code)
+			continue
+		}
+		if got := w.Header().Get("Content-Type"); got != tt.contentType {
+			t.Errorf("%s: expected Content-Type %q, got %q", tt.path, tt.contentType, got)
+		}
+		if tt.cacheControl != "" && !strings.Contains(w.Header().Get("Cache-Control"), tt.cacheControl) {
+			t.Errorf("%s: expected Cache-Control with %q, got %q", tt.path, tt.cacheControl, w.Header().Get("Cache-Control"))
+		}
+	}
+}
+
+func TestPackageRepoSkipsCompression(t *testing.T) {
+	root := t.TempDir()
+	writeTestFile(t, filepath.Join(root, "debian", "dists", "stable", "Release"), strings.Repeat("Origin: qserv\n", 200))
+	writeTestFile(t, filepath.Join(root, "other.txt"), strings.Repeat("text\n", 200))
+	server := newListingTestServer(t, root, func(c *Config) {
+		c.Performance.EnableCompression = true
+		c.Features.PackageRepos = &PackageReposConfig{Enabled: true, Repos: []PackageRepoConfig{
+			{Name: "debian", Path: "/debian/", Type: "apt"},
+		}}
+	})
+	get := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		w := httptest.NewRecorder()
+		server.mux.ServeHTTP(w, req)
+		return w
+	}
+
+	w := get("/debian/dists/stable/Release")
+	if w.Header().Get("Content-Encoding") != "" || !strings.HasPrefix(w.Body.String(), "Origin: qserv") {
+		t.Errorf("Expected repository metadata to be served uncompressed, got %q", w.Header().Get("Content-Encoding"))
+	}
+	if w := get("/other.txt"); w.Header().Get("Content-Encoding") != "gzip" {
+		t.Errorf("Expected files outside repositories to stay compressed")
+	}
+}
+
+func TestPackageRepoRangeRequest(t *testing.T) {
+	root := t.TempDir()
+	writeTestFile(t, filepath.Join(root, "rpms", "hello.rpm"), "0123456789")
+	server := newPackageRepoTestServer(t, root, PackageRepoConfig{Name: "rpms", Path: "/rpms/", Type: "yum"})
+
+	req := httptest.NewRequest("GET", "/rpms/hello.rpm", nil)
+	req.Header.Set("Range", "bytes=4-")
+	w := httptest.NewRecorder()
+	server.mux.ServeHTTP(w, req)
+	if w.Code != http.StatusPartialContent || w.Body.String() != "456789" {
+		t.Errorf("Expected ranged package, got %d %q", w.Code, w.Body.String())
+	}
+}
+
+func TestPackageRepoValidation(t *testing.T) {
+	for _, repos := range [][]PackageRepoConfig{
+		{{Name: "", Path: "/a/", Type: "apt"}},
+		{{Name: "a", Path: "a/", Type: "apt"}},
+		{{Name: "a", Path: "/a/", Type: "pacman"}},
+		{{Name: "a", Path: "/a/", Type: "yum", Interval: 60}},
+		{{Name: "a", Path: "/a/", Type: "apt"}, {Name: "a", Path: "/b/", Type: "apt"}},
+	} {
+		if _, err := NewPackageRepos(&PackageReposConfig{Enabled: true, Repos: repos}, nil); err == nil {
+			t.Errorf("Expected error for %+v", repos)
+		}
+	}
+}
+
+func TestPackageRepoRegenerate(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	root := t.TempDir()
+	writeTestFile(t, filepath.Join(root, "rpms", "hello.rpm"), "rpm")
+	logger, _ := NewLogger(&LoggingConfig{Enabled: false})
+	repos, err := NewPackageRepos(&PackageReposConfig{Enabled: true, Repos: []PackageRepoConfig{{
+		Name: "rpms", Path: "/rpms/", Type: "yum",
+		Regenerate: []string{"sh", "-c", "mkdir -p repodata && date +%N >> repodata/runs"},
+	}}}, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := &repos.config.Repos[0]
+
+	if result, err := repos.Regenerate(repo, root); err != nil || !strings.HasPrefix(result, "regenerated") {
+		t.Fatalf("Expected first run to regenerate, got %q %v", result, err)
+	}
+	// The command's own output in repodata/ does not count as a change
+	if result, _ := repos.Regenerate(repo, root); result != "unchanged" {
+		t.Errorf("Expected unchanged, got %q", result)
+	}
+
+	later := time.Now().Add(time.Minute)
+	writeTestFile(t, filepath.Join(root, "rpms", "hello-2.rpm"), "rpm")
+	os.Chtimes(filepath.Join(root, "rpms", "hello-2.rpm"), later, later)
+	if result, _ := repos.Regenerate(repo, root); !strings.HasPrefix(result, "regenerated") {
+		t.Errorf("Expected new package to trigger regeneration, got %q", result)
+	}
+
+	repo.Regenerate = []string{"sh", "-c", "echo broken index >&2; exit 3"}
+	writeTestFile(t, filepath.Join(root, "rpms", "hello-3.rpm"), "rpm")
+	if _, err := repos.Regenerate(repo, root); err == nil || !strings.Contains(err.Error(), "broken index") {
+		t.Errorf("Expected command failure with stderr, got %v", err)
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"io"
+	"sync"
+)
+
+// copyBufferPool buffers de cópia reutilizados entre requisições
+var copyBufferPool = sync.Pool{
+	New: func() any {
+		buf := make([]byte, 32<<10)
+		return &buf
+	},
+}
+
+// copyBuffer equivale a io.Copy, mas com um buffer do pool
+func copyBuffer(dst io.Writer, src io.Reader) (int64, error) {
+	buf := copyBufferPool.Get().(*[]byte)
+	defer copyBufferPool.Put(buf)
+	return io.CopyBuffer(dst, src, *buf)
+}
+
+// encoderPool encoders de um encoding e nível reutilizados entre requisições
+type encoderPool struct {
+	name string
+	pool sync.Pool
+}
+
+// newEncoderPool cria o pool; newEncoder recebe o nível já validado
+func newEncoderPool(name string, level int, newEncoder func(level int) compressor) *encoderPool {
+	p := &encoderPool{name: name}
+	p.pool.New = func() any {
+		return newEncoder(level)
+	}
+	return p
+}
+
+// Get retorna um encoder apontando para w
+func (p *encoderPool) Get(w io.Writer) compressor {
+	c := p.pool.Get().(compressor)
+	c.Reset(w)
+	return c
+}
+
+// Put devolve o encoder ao pool (deve estar fechado)
+func (p *encoderPool) Put(c compressor) {
+	p.pool.Put(c)
+}
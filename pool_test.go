@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCompressionMiddlewareReusesWriters(t *testing.T) {
+	body := strings.Repeat("hello qserv ", 100)
+	handler := CompressionMiddleware(6, nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body))
+	}))
+
+	// Pooled writers must produce a complete, independent stream on every request
+	for i := 0; i < 3; i++ {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		gz, err := gzip.NewReader(w.Body)
+		if err != nil {
+			t.Fatalf("Request %d: invalid gzip stream: %v", i, err)
+		}
+		got, err := io.ReadAll(gz)
+		if err != nil || string(got) != body {
+			t.Errorf("Request %d: unexpected body (err: %v)", i, err)
+		}
+	}
+}
+
+func TestCompressionMiddlewareInvalidLevel(t *testing.T) {
+	handler := CompressionMiddleware(42, nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("plain"))
+	}))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if w.Header().Get("Content-Encoding") != "" || w.Body.String() != "plain" {
+		t.Errorf("Expected uncompressed response for invalid level, got %q %q", w.Header().Get("Content-Encoding"), w.Body.String())
+	}
+}
+
+func BenchmarkCompressionMiddleware(b *testing.B) {
+	body := []byte(strings.Repeat("hello qserv ", 1000))
+	handler := CompressionMiddleware(6, nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(body)
+	}))
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+
+	b.ReportAllocs()
+	for b.Loop() {
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+}
+
+// writerOnly hides io.ReaderFrom so the copy goes through the buffer
+type writerOnly struct{ io.Writer }
+
+// readerOnly hides io.WriterTo for the same reason
+type readerOnly struct{ io.Reader }
+
+func BenchmarkCopyBuffer(b *testing.B) {
+	data := bytes.Repeat([]byte("x"), 256<<10)
+
+	b.ReportAllocs()
+	for b.Loop() {
+		copyBuffer(writerOnly{io.Discard}, readerOnly{bytes.NewReader(data)})
+	}
+}
@@ -0,0 +1,405 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// natPMPPort porta do NAT-PMP no gateway
+var natPMPPort = 5351
+
+// portMappingLease validade pedida ao roteador; o mapeamento é renovado na metade
+const portMappingLease = time.Hour
+
+// PortMapper mapeamento da porta do servidor no roteador, por NAT-PMP (RFC
+// 6886) ou UPnP IGD, renovado enquanto o servidor roda e removido em Close
+type PortMapper struct {
+	port     int
+	logger   *Logger
+	protocol string // nat-pmp ou upnp
+	gateway  net.IP
+	upnp     *upnpGateway
+	external net.IP
+	mapped   int // porta externa concedida
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+// startPortMapping pede o mapeamento (NAT-PMP primeiro, depois UPnP) e
+// inicia a renovação
+func startPortMapping(port int, logger *Logger) (*PortMapper, error) {
+	m := &PortMapper{port: port, logger: logger, stop: make(chan struct{}), done: make(chan struct{})}
+	gateway, gwErr := defaultGateway()
+	var pmpErr error
+	if gwErr == nil {
+		m.gateway = gateway
+		if pmpErr = m.mapNATPMP(portMappingLease); pmpErr == nil {
+			m.protocol = "nat-pmp"
+		}
+	}
+	if m.protocol == "" {
+		upnp, err := discoverUPnP(3 * time.Second)
+		if err == nil {
+			m.upnp = upnp
+			err = m.mapUPnP(portMappingLease)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("no router accepted the mapping (nat-pmp: %v; upnp: %v)", errors.Join(gwErr, pmpErr), err)
+		}
+		m.protocol = "upnp"
+	}
+	go m.renew()
+	return m, nil
+}
+
+// mapServerPort mapeia a porta do servidor e mostra a URL externa; falhas
+// só são logadas (o servidor segue acessível na rede local)
+func mapServerPort(config *Config, logger *Logger) *PortMapper {
+	m, err := startPortMapping(config.Server.Port, logger)
+	if err != nil {
+		logger.Error("Port mapping disabled: %v", err)
+		return nil
+	}
+	scheme := "http"
+	if config.Security.EnableHTTPS {
+		scheme = "https"
+	}
+	logger.Info("Port %d mapped on the router via %s, external URL: %s", config.Server.Port, m.protocol, m.URL(scheme))
+	if config.Server.LANShare && len(config.Security.IPWhitelist) == 0 {
+		logger.Warn("lan_share only accepts private-range clients: external requests through the mapping will be rejected")
+	}
+	return m
+}
+
+// URL endereço externo do servidor
+func (m *PortMapper) URL(scheme string) string {
+	return scheme + "://" + net.JoinHostPort(m.external.String(), strconv.Itoa(m.mapped)) + "/"
+}
+
+// renew refaz o mapeamento na metade da validade até Close
+func (m *PortMapper) renew() {
+	defer close(m.done)
+	ticker := time.NewTicker(portMappingLease / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-m.stop:
+			return
+		case <-ticker.C:
+			var err error
+			if m.protocol == "nat-pmp" {
+				err = m.mapNATPMP(portMappingLease)
+			} else {
+				err = m.mapUPnP(portMappingLease)
+			}
+			if err != nil {
+				m.logger.Warn("Port mapping renewal (%s) failed: %v", m.protocol, err)
+			}
+		}
+	}
+}
+
+// Close remove o mapeamento do roteador
+func (m *PortMapper) Close() error {
+	close(m.stop)
+	<-m.done
+	if m.protocol == "nat-pmp" {
+		return m.natPMP(natPMPRequest(m.port, 0, 0), nil)
+	}
+	return m.upnp.soap("DeletePortMapping", upnpArgs{
+		{"NewRemoteHost", ""},
+		{"NewExternalPort", strconv.Itoa(m.mapped)},
+		{"NewProtocol", "TCP"},
+	}, nil)
+}
+
+// defaultGateway lê o gateway padrão (Linux: /proc/net/route); nos outros
+// sistemas supõe o .1 da rede da interface principal
+func defaultGateway() (net.IP, error) {
+	if data, err := os.ReadFile("/proc/net/route"); err == nil {
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		for scanner.Scan() {
+			fields := strings.Fields(scanner.Text())
+			if len(fields) < 3 || fields[1] != "00000000" {
+				continue
+			}
+			raw, err := strconv.ParseUint(fields[2], 16, 32)
+			if err != nil || raw == 0 {
+				continue
+			}
+			ip := make(net.IP, 4)
+			binary.LittleEndian.PutUint32(ip, uint32(raw))
+			return ip, nil
+		}
+	}
+	local, err := localIPv4()
+	if err != nil {
+		return nil, err
+	}
+	return net.IPv4(local[0], local[1], local[2], 1).To4(), nil
+}
+
+// localIPv4 endereço da interface usada para sair da rede local
+func localIPv4() (net.IP, error) {
+	conn, err := net.Dial("udp4", "192.0.2.1:9")
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	ip := conn.LocalAddr().(*net.UDPAddr).IP.To4()
+	if ip == nil || !ip.IsPrivate() {
+		return nil, errors.New("not on a private IPv4 network")
+	}
+	return ip, nil
+}
+
+// natPMPRequest pedido de mapeamento TCP (lifetime 0 remove)
+func natPMPRequest(internal, external int, lifetime time.Duration) []byte {
+	req := make([]byte, 12)
+	req[1] = 2 // TCP
+	binary.BigEndian.PutUint16(req[4:], uint16(internal))
+	binary.BigEndian.PutUint16(req[6:], uint16(external))
+	binary.BigEndian.PutUint32(req[8:], uint32(lifetime/time.Second))
+	return req
+}
+
+// natPMP envia o pedido ao gateway com retransmissões e
+// devolve a resposta em reply
+func (m *PortMapper) natPMP(req, reply []byte) error {
+	conn, err := net.DialUDP("udp4", nil, &net.UDPAddr{IP: m.gateway, Port: natPMPPort})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	buf := make([]byte, 16)
+	timeout := 250 * time.Millisecond
+	for attempt := 0; attempt < 4; attempt++ {
+		conn.Write(req)
+		conn.SetReadDeadline(time.Now().Add(timeout))
+		n, err := conn.Read(buf)
+		if err != nil {
+			timeout *= 2
+			continue
+		}
+		if n < 8 || buf[1] != req[1]+128 {
+			return errors.New("invalid nat-pmp response")
+		}
+		if code := binary.BigEndian.Uint16(buf[2:]); code != 0 {
+			return fmt.Errorf("nat-pmp result code %d", code)
+		}
+		copy(reply, buf[:n])
+		return nil
+	}
+	return errors.New("gateway did not answer nat-pmp")
+}
+
+// mapNATPMP pede o endereço externo e o mapeamento
+func (m *PortMapper) mapNATPMP(lease time.Duration) error {
+	reply := make([]byte, 16)
+	if err := m.natPMP([]byte{0, 0}, reply); err != nil {
+		return err
+	}
+	m.external = net.IP(append([]byte(nil), reply[8:12]...))
+	external := m.mapped
+	if external == 0 {
+		external = m.port
+	}
+	if err := m.natPMP(natPMPRequest(m.port, external, lease), reply); err != nil {
+		return err
+	}
+	m.mapped = int(binary.BigEndian.Uint16(reply[10:]))
+	return nil
+}
+
+// upnpGateway serviço WANIPConnection/WANPPPConnection do roteador
+type upnpGateway struct {
+	control string // URL de controle SOAP
+	service string // tipo do serviço
+	localIP string
+}
+
+// upnpArgs argumentos de uma ação SOAP, em ordem
+type upnpArgs [][2]string
+
+// discoverUPnP procura o roteador por SSDP e lê a descrição do dispositivo
+func discoverUPnP(timeout time.Duration) (*upnpGateway, error) {
+	conn, err := net.ListenPacket("udp4", ":0")
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	search := "M-SEARCH * HTTP/1.1\r\nHOST: 239.255.255.250:1900\r\nMAN: \"ssdp:discover\"\r\nMX: 2\r\nST: urn:schemas-upnp-org:device:InternetGatewayDevice:1\r\n\r\n"
+	ssdp := &net.UDPAddr{IP: net.IPv4(239, 255, 255, 250), Port: 1900}
+	if _, err := conn.WriteTo([]byte(search), ssdp); err != nil {
+		return nil, err
+	}
+	conn.SetReadDeadline(time.Now().Add(timeout))
+	buf := make([]byte, 2048)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			return nil, errors.New("no internet gateway device found")
+		}
+		resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(buf[:n])), nil)
+		if err != nil {
+			continue
+		}
+		if location := resp.Header.Get("Location"); location != "" {
+			if gw, err := upnpDescribe(location); err == nil {
+				return gw, nil
+			}
+		}
+	}
+}
+
+// upnpDescribe lê a descrição do dispositivo e acha o serviço de conexão WAN
+func upnpDescribe(location string) (*upnpGateway, error) {
+	client := &http.Client{Timeout: 3 * time.Second}
+	resp, err := client.Get(location)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var desc struct {
+		URLBase string `xml:"URLBase"`
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	if err := xml.Unmarshal(data, &desc); err != nil {
+		return nil, err
+	}
+	base, err := url.Parse(location)
+	if err != nil {
+		return nil, err
+	}
+	if desc.URLBase != "" {
+		if u, err := url.Parse(desc.URLBase); err == nil {
+			base = u
+		}
+	}
+
+	// Serviços aninhados em qualquer nível de deviceList
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, errors.New("no WAN connection service in device description")
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != "service" {
+			continue
+		}
+		var service struct {
+			ServiceType string `xml:"serviceType"`
+			ControlURL  string `xml:"controlURL"`
+		}
+		if err := decoder.DecodeElement(&service, &start); err != nil {
+			continue
+		}
+		if !strings.Contains(service.ServiceType, ":WANIPConnection:") && !strings.Contains(service.ServiceType, ":WANPPPConnection:") {
+			continue
+		}
+		control, err := base.Parse(service.ControlURL)
+		if err != nil {
+			continue
+		}
+		gw := &upnpGateway{control: control.String(), service: service.ServiceType}
+		// Endereço local na rede do roteador (NewInternalClient)
+		if conn, err := net.Dial("udp4", net.JoinHostPort(control.Hostname(), "1900")); err == nil {
+			gw.localIP = conn.LocalAddr().(*net.UDPAddr).IP.String()
+			conn.Close()
+		}
+		return gw, nil
+	}
+}
+
+// soap executa uma ação no serviço e decodifica os campos de resposta em out
+func (g *upnpGateway) soap(action string, args upnpArgs, out map[string]string) error {
+	var body strings.Builder
+	body.WriteString(`<?xml version="1.0"?><s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/"><s:Body>`)
+	fmt.Fprintf(&body, `<u:%s xmlns:u="%s">`, action, g.service)
+	for _, arg := range args {
+		body.WriteString("<" + arg[0] + ">")
+		xml.EscapeText(&body, []byte(arg[1]))
+		body.WriteString("</" + arg[0] + ">")
+	}
+	fmt.Fprintf(&body, `</u:%s></s:Body></s:Envelope>`, action)
+
+	req, err := http.NewRequest(http.MethodPost, g.control, strings.NewReader(body.String()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", `text/xml; charset="utf-8"`)
+	req.Header.Set("SOAPAction", `"`+g.service+"#"+action+`"`)
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", action, resp.Status)
+	}
+	if out == nil {
+		return nil
+	}
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	var field string
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			field = t.Name.Local
+		case xml.CharData:
+			if _, wanted := out[field]; wanted {
+				out[field] = strings.TrimSpace(string(t))
+			}
+		}
+	}
+}
+
+// mapUPnP cria (ou renova) o mapeamento e consulta o endereço externo
+func (m *PortMapper) mapUPnP(lease time.Duration) error {
+	if m.mapped == 0 {
+		m.mapped = m.port
+	}
+	err := m.upnp.soap("AddPortMapping", upnpArgs{
+		{"NewRemoteHost", ""},
+		{"NewExternalPort", strconv.Itoa(m.mapped)},
+		{"NewProtocol", "TCP"},
+		{"NewInternalPort", strconv.Itoa(m.port)},
+		{"NewInternalClient", m.upnp.localIP},
+		{"NewEnabled", "1"},
+		{"NewPortMappingDescription", "qserv"},
+		{"NewLeaseDuration", strconv.Itoa(int(lease / time.Second))},
+	}, nil)
+	if err != nil {
+		return err
+	}
+	out := map[string]string{"NewExternalIPAddress": ""}
+	if err := m.upnp.soap("GetExternalIPAddress", nil, out); err != nil {
+		return err
+	}
+	if m.external = net.ParseIP(out["NewExternalIPAddress"]); m.external == nil {
+		return errors.New("router did not report its external address")
+	}
+	return nil
+}
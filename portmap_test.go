@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeNATPMP answers NAT-PMP requests like a router with external address 203.0.113.7
+func fakeNATPMP(t *testing.T) (*net.UDPConn, func() []byte) {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	var mu sync.Mutex
+	var last []byte
+	go func() {
+		buf := make([]byte, 64)
+		for {
+			n, addr, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			req := append([]byte(nil), buf[:n]...)
+			mu.Lock()
+			last = req
+			mu.Unlock()
+			if req[1] == 0 {
+				conn.WriteToUDP([]byte{0, 128, 0, 0, 0, 0, 0, 1, 203, 0, 113, 7}, addr)
+				continue
+			}
+			reply := make([]byte, 16)
+			reply[1] = req[1] + 128
+			copy(reply[8:10], req[4:6])
+			binary.BigEndian.PutUint16(reply[10:], binary.BigEndian.Uint16(req[6:])+1) // router picks another port
+			copy(reply[12:], req[8:12])
+			conn.WriteToUDP(reply, addr)
+		}
+	}()
+	return conn, func() []byte {
+		mu.Lock()
+		defer mu.Unlock()
+		return last
+	}
+}
+
+func TestNATPMPMapping(t *testing.T) {
+	conn, lastRequest := fakeNATPMP(t)
+	saved := natPMPPort
+	natPMPPort = conn.LocalAddr().(*net.UDPAddr).Port
+	defer func() { natPMPPort = saved }()
+
+	logger, _ := NewLogger(&LoggingConfig{Enabled: false})
+	m := &PortMapper{port: 8080, logger: logger, protocol: "nat-pmp", gateway: net.IPv4(127, 0, 0, 1), stop: make(chan struct{}), done: make(chan struct{})}
+	if err := m.mapNATPMP(time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if got := m.URL("http"); got != "http://203.0.113.7:8081/" {
+		t.Errorf("Expected external URL with the granted port, got %s", got)
+	}
+
+	go m.renew()
+	if err := m.Close(); err != nil {
+		t.Fatal(err)
+	}
+	last := lastRequest()
+	if last[1] != 2 || binary.BigEndian.Uint32(last[8:]) != 0 || binary.BigEndian.Uint16(last[4:]) != 8080 {
+		t.Errorf("Expected a zero-lifetime TCP request removing the mapping, got %v", last)
+	}
+}
+
+func TestUPnPMapping(t *testing.T) {
+	var mu sync.Mutex
+	var actions []string
+	var addBody string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/desc.xml", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `<?xml version="1.0"?><root><device><deviceList><device><deviceList><device><serviceList>
+<service><serviceType>urn:schemas-upnp-org:service:WANCommonInterfaceConfig:1</serviceType><controlURL>/common</controlURL></service>
+<service><serviceType>urn:schemas-upnp-org:service:WANIPConnection:1</serviceType><controlURL>/ctl/IPConn</controlURL></service>
+</serviceList></device></deviceList></device></deviceList></device></root>`)
+	})
+	mux.HandleFunc("/ctl/IPConn", func(w http.ResponseWriter, r *http.Request) {
+		action := r.Header.Get("SOAPAction")
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		actions = append(actions, action)
+		if strings.Contains(action, "AddPortMapping") {
+			addBody = string(body)
+		}
+		mu.Unlock()
+		if strings.Contains(action, "GetExternalIPAddress") {
+			io.WriteString(w, `<s:Envelope><s:Body><u:GetExternalIPAddressResponse><NewExternalIPAddress>198.51.100.4</NewExternalIPAddress></u:GetExternalIPAddressResponse></s:Body></s:Envelope>`)
+		}
+	})
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	gw, err := upnpDescribe(ts.URL + "/desc.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gw.control != ts.URL+"/ctl/IPConn" {
+		t.Errorf("Expected the WANIPConnection control URL, got %s", gw.control)
+	}
+	if gw.localIP != "127.0.0.1" {
+		t.Errorf("Expected local address 127.0.0.1, got %s", gw.localIP)
+	}
+
+	logger, _ := NewLogger(&LoggingConfig{Enabled: false})
+	m := &PortMapper{port: 8080, logger: logger, protocol: "upnp", upnp: gw, stop: make(chan struct{}), done: make(chan struct{})}
+	if err := m.mapUPnP(time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if got := m.URL("https"); got != "https://198.51.100.4:8080/" {
+		t.Errorf("Expected external URL https://198.51.100.4:8080/, got %s", got)
+	}
+	for _, want := range []string{"<NewExternalPort>8080</NewExternalPort>", "<NewInternalClient>127.0.0.1</NewInternalClient>", "<NewLeaseDuration>3600</NewLeaseDuration>"} {
+		if !strings.Contains(addBody, want) {
+			t.Errorf("Expected AddPortMapping to contain %s, got %s", want, addBody)
+		}
+	}
+
+	go m.renew()
+	if err := m.Close(); err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if last := actions[len(actions)-1]; last != `"urn:schemas-upnp-org:service:WANIPConnection:1#DeletePortMapping"` {
+		t.Errorf("Expected DeletePortMapping on close, got %s", last)
+	}
+}
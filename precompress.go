@@ -0,0 +1,267 @@
+package main
+
+import (
+	"compress/gzip"
+	"io/fs"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultPrecompressExtensions tipos textuais que compensam comprimir
+var defaultPrecompressExtensions = []string{
+	".html", ".htm", ".css", ".js", ".mjs", ".json", ".map", ".svg", ".txt", ".xml", ".wasm",
+}
+
+// Precompressor mantém cópias .gz dos arquivos elegíveis em um diretório de
+// cache; uma cópia é válida enquanto tiver o mesmo mtime do original
+type Precompressor struct {
+	config     *PrecompressConfig
+	logger     *Logger
+	dir        string
+	extensions map[string]bool
+	running    sync.Mutex
+}
+
+// NewPrecompressor cria o precompressor
+func NewPrecompressor(config *PrecompressConfig, logger *Logger) *Precompressor {
+	dir := config.Dir
+	if dir == "" {
+		dir = ".qserv-precompressed"
+	}
+	if abs, err := filepath.Abs(dir); err == nil {
+		dir = abs
+	}
+
+	extensions := config.Extensions
+	if len(extensions) == 0 {
+		extensions = defaultPrecompressExtensions
+	}
+	p := &Precompressor{config: config, logger: logger, dir: dir, extensions: make(map[string]bool)}
+	for _, ext := range extensions {
+		p.extensions[strings.ToLower(ext)] = true
+	}
+	return p
+}
+
+// workers retorna o número de compressões simultâneas
+func (p *Precompressor) workers() int {
+	if p.config.Workers <= 0 {
+		return runtime.NumCPU()
+	}
+	return p.config.Workers
+}
+
+// minSize retorna o tamanho mínimo para comprimir
+func (p *Precompressor) minSize() int64 {
+	if p.config.MinSize <= 0 {
+		return 1024
+	}
+	return p.config.MinSize
+}
+
+// eligible informa se o arquivo deve ser pré-comprimido
+func (p *Precompressor) eligible(name string, info fs.FileInfo) bool {
+	return info.Mode().IsRegular() && info.Size() >= p.minSize() &&
+		p.extensions[strings.ToLower(filepath.Ext(name))]
+}
+
+// cachePath retorna o caminho da cópia comprimida de um arquivo da raiz
+func (p *Precompressor) cachePath(root, path string) (string, bool) {
+	rel, err := filepath.Rel(root, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return filepath.Join(p.dir, rel+".gz"), true
+}
+
+// Lookup retorna a cópia comprimida de path se ela estiver atualizada
+func (p *Precompressor) Lookup(root, path string, info fs.FileInfo) (string, bool) {
+	gzPath, ok := p.cachePath(root, path)
+	if !ok {
+		return "", false
+	}
+	gzInfo, err := os.Stat(gzPath)
+	if err != nil || !gzInfo.ModTime().Equal(info.ModTime()) {
+		return "", false
+	}
+	return gzPath, true
+}
+
+// Warm comprime os arquivos elegíveis de root que ainda não têm cópia
+// atualizada; varreduras concorrentes são serializadas
+func (p *Precompressor) Warm(root string) (compressed, fresh int) {
+	p.running.Lock()
+	defer p.running.Unlock()
+
+	start := time.Now()
+	jobs := make(chan string)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for i := 0; i < p.workers(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for path := range jobs {
+				done, err := p.compress(root, path)
+				if err != nil {
+					p.logger.Error("Precompress %s: %v", path, err)
+					continue
+				}
+				mu.Lock()
+				if done {
+					compressed++
+				} else {
+					fresh++
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			if path == p.dir || d.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		info, err := d.Info()
+		if err == nil && p.eligible(d.Name(), info) {
+			jobs <- path
+		}
+		return nil
+	})
+	close(jobs)
+	wg.Wait()
+
+	p.logger.Info("Precompressed %d files (%d up to date) in %s", compressed, fresh, time.Since(start).Round(time.Millisecond))
+	return compressed, fresh
+}
+
+// compress grava a cópia comprimida de path, exceto se já estiver atualizada
+func (p *Precompressor) compress(root, path string) (bool, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return false, err
+	}
+	if _, ok := p.Lookup(root, path, info); ok {
+		return false, nil
+	}
+	gzPath, ok := p.cachePath(root, path)
+	if !ok {
+		return false, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(gzPath), 0755); err != nil {
+		return false, err
+	}
+
+	src, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer src.Close()
+
+	// Grava em arquivo temporário e renomeia: leitores nunca veem cópias parciais
+	tmp, err := os.CreateTemp(filepath.Dir(gzPath), ".precompress-*")
+	if err != nil {
+		return false, err
+	}
+	defer os.Remove(tmp.Name())
+
+	gz, _ := gzip.NewWriterLevel(tmp, gzip.BestCompression)
+	if _, err := copyBuffer(gz, src); err != nil {
+		tmp.Close()
+		return false, err
+	}
+	if err := gz.Close(); err != nil {
+		tmp.Close()
+		return false, err
+	}
+	if err := tmp.Close(); err != nil {
+		return false, err
+	}
+	if err := os.Chtimes(tmp.Name(), info.ModTime(), info.ModTime()); err != nil {
+		return false, err
+	}
+	return true, os.Rename(tmp.Name(), gzPath)
+}
+
+// acceptsGzip informa se o cliente aceita respostas gzip
+func acceptsGzip(r *http.Request) bool {
+	return parseAcceptEncoding(r.Header.Get("Accept-Encoding")).q("gzip") > 0
+}
+
+// sidecarEncodings arquivos comprimidos pelo build ao lado do original, na
+// ordem de preferência em empates de q
+var sidecarEncodings = []struct{ encoding, ext string }{{"br", ".br"}, {"gzip", ".gz"}}
+
+// serveSidecar serve app.js.br ou app.js.gz gerado pelo build ao lado de
+// app.js, se o cliente aceitar o encoding; cópias mais antigas que o
+// original são ignoradas
+func (s *Server) serveSidecar(w http.ResponseWriter, r *http.Request, path string, info fs.FileInfo) bool {
+	if !s.config.Performance.ServeSidecars || r.Header.Get("Range") != "" {
+		return false
+	}
+	accepted := parseAcceptEncoding(r.Header.Get("Accept-Encoding"))
+	var sidecar, encoding string
+	var best float64
+	for _, e := range sidecarEncodings {
+		q := accepted.q(e.encoding)
+		if q <= best {
+			continue
+		}
+		sidecarInfo, err := os.Stat(path + e.ext)
+		if err != nil || !sidecarInfo.Mode().IsRegular() || sidecarInfo.ModTime().Before(info.ModTime()) {
+			continue
+		}
+		sidecar, encoding, best = path+e.ext, e.encoding, q
+	}
+	if sidecar == "" {
+		return false
+	}
+	return s.serveEncoded(w, r, sidecar, encoding, info)
+}
+
+// servePrecompressed serve a cópia comprimida de path, se houver uma atualizada
+func (s *Server) servePrecompressed(w http.ResponseWriter, r *http.Request, path string, info fs.FileInfo) bool {
+	if s.precompress == nil || !acceptsGzip(r) || r.Header.Get("Range") != "" {
+		return false
+	}
+	gzPath, ok := s.precompress.Lookup(s.requestRoot(r), path, info)
+	if !ok {
+		return false
+	}
+	return s.serveEncoded(w, r, gzPath, "gzip", info)
+}
+
+// serveEncoded serve encPath, já comprimido com encoding, no lugar do
+// original descrito por info
+func (s *Server) serveEncoded(w http.ResponseWriter, r *http.Request, encPath, encoding string, info fs.FileInfo) bool {
+	f, err := s.openDiskFile(encPath)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	// O tipo vem do nome original (sem isso o ServeContent detectaria gzip);
+	// Content-Encoding também impede que o CompressionMiddleware comprima de novo
+	ctype := mime.TypeByExtension(filepath.Ext(info.Name()))
+	if ctype == "" {
+		ctype = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", ctype)
+	w.Header().Set("Content-Encoding", encoding)
+	w.Header().Add("Vary", "Accept-Encoding")
+	debugNote(r, "precompressed", filepath.Base(encPath))
+	http.ServeContent(w, r, info.Name(), info.ModTime(), f)
+	return true
+}
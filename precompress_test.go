@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPrecompressorWarm(t *testing.T) {
+	root := t.TempDir()
+	script := strings.Repeat("console.log('qserv');\n", 100)
+	os.MkdirAll(filepath.Join(root, "assets"), 0755)
+	os.WriteFile(filepath.Join(root, "assets", "app.js"), []byte(script), 0644)
+	os.WriteFile(filepath.Join(root, "small.css"), []byte("a{}"), 0644)
+	os.WriteFile(filepath.Join(root, "photo.png"), make([]byte, 4096), 0644)
+
+	logger, _ := NewLogger(&LoggingConfig{Enabled: false})
+	p := NewPrecompressor(&PrecompressConfig{Enabled: true, Dir: t.TempDir(), Workers: 2}, logger)
+
+	if compressed, fresh := p.Warm(root); compressed != 1 || fresh != 0 {
+		t.Errorf("Expected only app.js to be compressed, got %d compressed, %d fresh", compressed, fresh)
+	}
+	if compressed, fresh := p.Warm(root); compressed != 0 || fresh != 1 {
+		t.Errorf("Expected app.js to be skipped as fresh, got %d compressed, %d fresh", compressed, fresh)
+	}
+
+	// Changing the source invalidates the copy
+	path := filepath.Join(root, "assets", "app.js")
+	later := time.Now().Add(time.Hour)
+	os.Chtimes(path, later, later)
+	info, _ := os.Stat(path)
+	if _, ok := p.Lookup(root, path, info); ok {
+		t.Errorf("Expected stale copy to be ignored")
+	}
+	if compressed, _ := p.Warm(root); compressed != 1 {
+		t.Errorf("Expected modified file to be compressed again, got %d", compressed)
+	}
+}
+
+func TestServePrecompressed(t *testing.T) {
+	root := t.TempDir()
+	script := strings.Repeat("console.log('qserv');\n", 100)
+	os.WriteFile(filepath.Join(root, "app.js"), []byte(script), 0644)
+
+	config := DefaultConfig()
+	config.Server.RootDir = root
+	config.Performance.EnableCompression = true
+	config.Performance.Precompress = &PrecompressConfig{Enabled: true, Dir: t.TempDir()}
+
+	logger, _ := NewLogger(&LoggingConfig{Enabled: false})
+	server := NewServer(config, logger)
+	server.setupHandlers()
+	server.precompress.Warm(server.RootDir())
+
+	req := httptest.NewRequest("GET", "/app.js", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	server.mux.ServeHTTP(w, req)
+
+	if w.Header().Get("Content-Encoding") != "gzip" || !strings.Contains(w.Header().Get("Content-Type"), "javascript") {
+		t.Errorf("Unexpected headers: %v", w.Header())
+	}
+	// A single gzip layer: the compression middleware must not compress again
+	gz, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatalf("Invalid gzip stream: %v", err)
+	}
+	body, _ := io.ReadAll(gz)
+	if string(body) != script {
+		t.Errorf("Expected original script after one decompression, got %d bytes", len(body))
+	}
+
+	// Clients without gzip get the original file
+	w = httptest.NewRecorder()
+	server.mux.ServeHTTP(w, httptest.NewRequest("GET", "/app.js", nil))
+	if w.Header().Get("Content-Encoding") != "" || w.Body.String() != script {
+		t.Errorf("Expected identity response without Accept-Encoding")
+	}
+}
+
+func TestServeSidecar(t *testing.T) {
+	root := t.TempDir()
+	script := strings.Repeat("console.log('qserv');\n", 100)
+	os.WriteFile(filepath.Join(root, "app.js"), []byte(script), 0644)
+	os.WriteFile(filepath.Join(root, "app.js.br"), []byte("brotli bytes"), 0644)
+	var gzipped bytes.Buffer
+	gz := gzip.NewWriter(&gzipped)
+	gz.Write([]byte(script))
+	gz.Close()
+	os.WriteFile(filepath.Join(root, "app.js.gz"), gzipped.Bytes(), 0644)
+
+	config := DefaultConfig()
+	config.Server.RootDir = root
+	config.Performance.EnableCompression = true
+	config.Performance.ServeSidecars = true
+
+	logger, _ := NewLogger(&LoggingConfig{Enabled: false})
+	server := NewServer(config, logger)
+	server.setupHandlers()
+
+	get := func(acceptEncoding string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/app.js", nil)
+		if acceptEncoding != "" {
+			req.Header.Set("Accept-Encoding", acceptEncoding)
+		}
+		w := httptest.NewRecorder()
+		server.mux.ServeHTTP(w, req)
+		return w
+	}
+
+	w := get("gzip, br")
+	if w.Header().Get("Content-Encoding") != "br" || w.Body.String() != "brotli bytes" || !strings.Contains(w.Header().Get("Content-Type"), "javascript") {
+		t.Errorf("Expected app.js.br as javascript, got %v %q", w.Header(), w.Body.String())
+	}
+	w = get("gzip;q=1, br;q=0.5")
+	if w.Header().Get("Content-Encoding") != "gzip" || !bytes.Equal(w.Body.Bytes(), gzipped.Bytes()) {
+		t.Errorf("Expected app.js.gz untouched, got %q (%d bytes)", w.Header().Get("Content-Encoding"), w.Body.Len())
+	}
+	if w := get(""); w.Header().Get("Content-Encoding") != "" || w.Body.String() != script {
+		t.Errorf("Expected identity response without Accept-Encoding")
+	}
+
+	// A sidecar older than the original is stale and ignored
+	old := time.Now().Add(-time.Hour)
+	os.Chtimes(filepath.Join(root, "app.js.br"), old, old)
+	if w := get("br"); w.Body.String() == "brotli bytes" {
+		t.Errorf("Expected stale app.js.br to be ignored")
+	}
+}
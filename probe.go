@@ -0,0 +1,275 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Estados de uma verificação do probe (o pior define o resultado)
+const (
+	probeOK   = "ok"
+	probeWarn = "warn"
+	probeFail = "fail"
+)
+
+// ProbeCheck resultado de uma verificação
+type ProbeCheck struct {
+	Name     string   `json:"name"`
+	Status   string   `json:"status"`
+	Message  string   `json:"message,omitempty"`
+	Value    *float64 `json:"value,omitempty"` // ex: dias até o certificado expirar
+	Duration float64  `json:"duration_ms"`
+}
+
+// ProbeResult resultado de uma rodada de verificações
+type ProbeResult struct {
+	Status    string       `json:"status"`
+	CheckedAt time.Time    `json:"checked_at"`
+	Checks    []ProbeCheck `json:"checks"`
+}
+
+// Probe endpoint sintético para monitoramento blackbox: verifica a raiz, o
+// certificado, os upstreams e os jobs e responde 503 se algo falhou
+type Probe struct {
+	config *ProbeConfig
+	client *http.Client
+
+	mu     sync.Mutex
+	last   *ProbeResult // reaproveitado por cache_ttl (evita amplificar requisições aos upstreams)
+	expiry time.Time
+}
+
+// NewProbe cria o endpoint de probe
+func NewProbe(config *ProbeConfig) (*Probe, error) {
+	if config.CertWarnDays < 0 || config.Timeout < 0 || config.CacheTTL < 0 {
+		return nil, errors.New("probe: cert_warn_days, timeout and cache_ttl must not be negative")
+	}
+	p := &Probe{config: config}
+	p.client = &http.Client{
+		Timeout: p.timeout(),
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	return p, nil
+}
+
+// route retorna a rota do probe (default: /_probe)
+func (p *Probe) route() string {
+	if p.config.Route == "" {
+		return "/_probe"
+	}
+	return p.config.Route
+}
+
+// timeout retorna o limite de cada verificação de upstream
+func (p *Probe) timeout() time.Duration {
+	if p.config.Timeout <= 0 {
+		return 5 * time.Second
+	}
+	return time.Duration(p.config.Timeout) * time.Second
+}
+
+// certWarnDays retorna a antecedência do aviso de expiração
+func (p *Probe) certWarnDays() float64 {
+	if p.config.CertWarnDays <= 0 {
+		return 14
+	}
+	return float64(p.config.CertWarnDays)
+}
+
+// cacheTTL retorna por quanto tempo um resultado é reaproveitado
+func (p *Probe) cacheTTL() time.Duration {
+	if p.config.CacheTTL <= 0 {
+		return 5 * time.Second
+	}
+	return time.Duration(p.config.CacheTTL) * time.Second
+}
+
+// authorized valida o token ou o IP do cliente (sem nenhum dos dois, aberto)
+func (p *Probe) authorized(r *http.Request) bool {
+	if p.config.Token == "" && len(p.config.AllowedIPs) == 0 {
+		return true
+	}
+	if p.config.Token != "" {
+		token := r.URL.Query().Get("token")
+		if bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+			token = bearer
+		}
+		if token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(p.config.Token)) == 1 {
+			return true
+		}
+	}
+	ip, _, _ := net.SplitHostPort(r.RemoteAddr)
+	for _, allowed := range p.config.AllowedIPs {
+		if ip == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// runProbe executa as verificações (ou devolve o resultado recente)
+func (s *Server) runProbe(ctx context.Context) *ProbeResult {
+	p := s.probe
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.last != nil && time.Now().Before(p.expiry) {
+		return p.last
+	}
+
+	result := &ProbeResult{Status: probeOK, CheckedAt: time.Now().UTC()}
+	check := func(name string, fn func() (string, string, *float64)) {
+		start := time.Now()
+		status, message, value := fn()
+		result.Checks = append(result.Checks, ProbeCheck{
+			Name:     name,
+			Status:   status,
+			Message:  message,
+			Value:    value,
+			Duration: float64(time.Since(start).Microseconds()) / 1000,
+		})
+		if status == probeFail || (status == probeWarn && result.Status == probeOK) {
+			result.Status = status
+		}
+	}
+
+	// Raiz legível
+	check("root", func() (string, string, *float64) {
+		f, err := os.Open(s.RootDir())
+		if err != nil {
+			return probeFail, err.Error(), nil
+		}
+		defer f.Close()
+		if _, err := f.Readdirnames(1); err != nil && err != io.EOF {
+			return probeFail, err.Error(), nil
+		}
+		return probeOK, "", nil
+	})
+
+	// Dias até o certificado expirar
+	if s.config.Security.EnableHTTPS {
+		check("certificate", func() (string, string, *float64) {
+			cert, err := loadCertificate(s.config.Security.CertFile)
+			if err != nil {
+				return probeFail, err.Error(), nil
+			}
+			notAfter := cert.NotAfter
+			days := certDaysLeft(notAfter)
+			message := "expires " + notAfter.UTC().Format(time.RFC3339)
+			switch {
+			case days <= 0:
+				return probeFail, "expired " + notAfter.UTC().Format(time.RFC3339), &days
+			case days < p.certWarnDays():
+				return probeWarn, message, &days
+			}
+			return probeOK, message, &days
+		})
+	}
+
+	// Upstreams dos espelhos pull-through e os configurados
+	upstreams := append([]string{}, p.config.Upstreams...)
+	for _, pt := range s.config.PullThrough {
+		upstreams = append(upstreams, pt.Upstream)
+	}
+	for _, upstream := range upstreams {
+		check("upstream "+upstream, func() (string, string, *float64) {
+			req, err := http.NewRequestWithContext(ctx, http.MethodHead, upstream, nil)
+			if err != nil {
+				return probeFail, err.Error(), nil
+			}
+			resp, err := p.client.Do(req)
+			if err != nil {
+				return probeFail, err.Error(), nil
+			}
+			resp.Body.Close()
+			if resp.StatusCode >= 500 {
+				return probeFail, resp.Status, nil
+			}
+			return probeOK, resp.Status, nil
+		})
+	}
+
+	// Jobs cuja última execução falhou
+	if s.jobs != nil {
+		check("jobs", func() (string, string, *float64) {
+			var failed []string
+			for _, status := range s.jobs.Status() {
+				if status.LastRun != nil && status.LastRun.Error != "" {
+					failed = append(failed, status.Name)
+				}
+			}
+			if len(failed) > 0 {
+				return probeWarn, "last run failed: " + strings.Join(failed, ", "), nil
+			}
+			return probeOK, "", nil
+		})
+	}
+
+	p.last = result
+	p.expiry = time.Now().Add(p.cacheTTL())
+	return result
+}
+
+// handleProbe responde o resultado em JSON (503 se alguma verificação
+// falhou) ou, com ?format=prometheus, como métricas
+func (s *Server) handleProbe(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		writeJSONError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+	if !s.probe.authorized(r) {
+		writeJSONError(w, http.StatusUnauthorized, errors.New("unauthorized"))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), s.probe.timeout()+time.Second)
+	defer cancel()
+	result := s.runProbe(ctx)
+	status := http.StatusOK
+	if result.Status == probeFail {
+		status = http.StatusServiceUnavailable
+	}
+
+	if r.URL.Query().Get("format") == "prometheus" {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(status)
+		writeProbeMetrics(w, result)
+		return
+	}
+	writeJSON(w, status, result)
+}
+
+// writeProbeMetrics escreve o resultado no formato do Prometheus
+func writeProbeMetrics(w io.Writer, result *ProbeResult) {
+	success := []metricSample{{labels: map[string]string{"check": "all"}, value: 1}}
+	if result.Status == probeFail {
+		success[0].value = 0
+	}
+	var durations, values []metricSample
+	for _, check := range result.Checks {
+		labels := map[string]string{"check": check.Name}
+		value := 1.0
+		if check.Status == probeFail {
+			value = 0
+		}
+		success = append(success, metricSample{labels: labels, value: value})
+		durations = append(durations, metricSample{labels: labels, value: check.Duration / 1000})
+		if check.Value != nil {
+			values = append(values, metricSample{labels: labels, value: *check.Value})
+		}
+	}
+	writeMetric(w, "qserv_probe_success", "Whether the probe check succeeded (warnings count as success).", "gauge", success)
+	writeMetric(w, "qserv_probe_duration_seconds", "Time taken by each probe check.", "gauge", durations)
+	writeMetric(w, "qserv_probe_value", "Value reported by the check (certificate: days until expiry).", "gauge", values)
+}
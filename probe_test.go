@@ -0,0 +1,130 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeTestCert writes a self-signed certificate valid until notAfter
+func writeTestCert(t *testing.T, dir string, notAfter time.Time) (certFile, keyFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "qserv.test"},
+		DNSNames:     []string{"qserv.test"},
+		NotBefore:    notAfter.Add(-365 * 24 * time.Hour),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644)
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+	return certFile, keyFile
+}
+
+func probeRequest(server *Server, path string) (*httptest.ResponseRecorder, ProbeResult) {
+	w := httptest.NewRecorder()
+	server.mux.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+	var result ProbeResult
+	json.Unmarshal(w.Body.Bytes(), &result)
+	return w, result
+}
+
+func findCheck(result ProbeResult, name string) *ProbeCheck {
+	for i := range result.Checks {
+		if result.Checks[i].Name == name {
+			return &result.Checks[i]
+		}
+	}
+	return nil
+}
+
+func TestProbeHealthy(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer upstream.Close()
+
+	root := t.TempDir()
+	certFile, keyFile := writeTestCert(t, t.TempDir(), time.Now().Add(5*24*time.Hour))
+	server := newListingTestServer(t, root, func(c *Config) {
+		c.Security.EnableHTTPS = true
+		c.Security.CertFile, c.Security.KeyFile = certFile, keyFile
+		c.Probe = &ProbeConfig{Enabled: true, Upstreams: []string{upstream.URL}}
+	})
+
+	w, result := probeRequest(server, "/_probe")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d %s", w.Code, w.Body.String())
+	}
+	if check := findCheck(result, "root"); check == nil || check.Status != probeOK {
+		t.Errorf("Expected root check to pass, got %+v", check)
+	}
+	if check := findCheck(result, "upstream "+upstream.URL); check == nil || check.Status != probeOK {
+		t.Errorf("Expected upstream check to pass, got %+v", check)
+	}
+	// 5 days left is below the default 14-day warning
+	check := findCheck(result, "certificate")
+	if check == nil || check.Status != probeWarn || check.Value == nil || *check.Value < 4 || *check.Value > 5 {
+		t.Errorf("Expected certificate warning with days left, got %+v", check)
+	}
+	if result.Status != probeWarn {
+		t.Errorf("Expected overall warn, got %s", result.Status)
+	}
+}
+
+func TestProbeFailure(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer upstream.Close()
+
+	server := newListingTestServer(t, t.TempDir(), func(c *Config) {
+		c.Probe = &ProbeConfig{Enabled: true, Upstreams: []string{upstream.URL}}
+	})
+	w, result := probeRequest(server, "/_probe")
+	if w.Code != http.StatusServiceUnavailable || result.Status != probeFail {
+		t.Errorf("Expected 503 when an upstream fails, got %d %s", w.Code, result.Status)
+	}
+
+	w = httptest.NewRecorder()
+	server.mux.ServeHTTP(w, httptest.NewRequest("GET", "/_probe?format=prometheus", nil))
+	body := w.Body.String()
+	if !strings.Contains(body, `qserv_probe_success{check="all"} 0`) || !strings.Contains(body, `qserv_probe_success{check="root"} 1`) {
+		t.Errorf("Expected probe metrics, got %s", body)
+	}
+}
+
+func TestProbeToken(t *testing.T) {
+	server := newListingTestServer(t, t.TempDir(), func(c *Config) {
+		c.Probe = &ProbeConfig{Enabled: true, Route: "/healthz", Token: "secret"}
+	})
+	if w, _ := probeRequest(server, "/healthz"); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without token, got %d", w.Code)
+	}
+	if w, _ := probeRequest(server, "/healthz?token=secret"); w.Code != http.StatusOK {
+		t.Errorf("Expected 200 with token, got %d", w.Code)
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ProxyBackend repassa um prefixo de caminho a um backend HTTP (ex: /api/
+// para a aplicação), ao lado dos arquivos estáticos
+type ProxyBackend struct {
+	config   *ProxyConfig
+	upstream *url.URL
+	proxy    *httputil.ReverseProxy
+	logger   *Logger
+	tracer   *Tracer // nil sem logging.tracing
+}
+
+// NewProxyBackend cria o reverse proxy a partir da configuração
+func NewProxyBackend(config *ProxyConfig, logger *Logger) (*ProxyBackend, error) {
+	if !strings.HasPrefix(config.Prefix, "/") {
+		return nil, fmt.Errorf("prefix must start with /: %q", config.Prefix)
+	}
+	upstream, err := url.Parse(config.Upstream)
+	if err != nil || (upstream.Scheme != "http" && upstream.Scheme != "https") || upstream.Host == "" {
+		return nil, fmt.Errorf("invalid upstream URL: %q", config.Upstream)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = (&net.Dialer{Timeout: config.connectTimeout(), KeepAlive: 30 * time.Second}).DialContext
+	transport.ResponseHeaderTimeout = config.timeout()
+	// O corpo segue como veio do backend; a compressão fica com o qserv
+	transport.DisableCompression = true
+
+	p := &ProxyBackend{config: config, upstream: upstream, logger: logger}
+	p.proxy = &httputil.ReverseProxy{
+		Rewrite:      p.rewrite,
+		Transport:    &tracedTransport{backend: p, base: transport},
+		ErrorHandler: p.handleError,
+	}
+	return p, nil
+}
+
+// connectTimeout retorna o limite para conectar ao backend
+func (c *ProxyConfig) connectTimeout() time.Duration {
+	if c.ConnectTimeout <= 0 {
+		return 10 * time.Second
+	}
+	return time.Duration(c.ConnectTimeout) * time.Second
+}
+
+// timeout retorna o limite até os headers da resposta do backend
+func (c *ProxyConfig) timeout() time.Duration {
+	if c.Timeout <= 0 {
+		return 30 * time.Second
+	}
+	return time.Duration(c.Timeout) * time.Second
+}
+
+// rewrite monta a requisição ao backend
+func (p *ProxyBackend) rewrite(pr *httputil.ProxyRequest) {
+	if p.config.StripPrefix {
+		rest := strings.TrimPrefix(pr.In.URL.Path, strings.TrimSuffix(p.config.Prefix, "/"))
+		pr.Out.URL.Path = "/" + strings.TrimPrefix(rest, "/")
+		pr.Out.URL.RawPath = ""
+	}
+	pr.SetURL(p.upstream)
+	if p.config.PreserveHost {
+		pr.Out.Host = pr.In.Host
+	}
+	if p.config.XForwarded {
+		pr.SetXForwarded()
+	}
+	for name, value := range p.config.Headers {
+		pr.Out.Header.Set(name, value)
+	}
+}
+
+// handleError responde 504 quando o backend não responde a tempo e 502 nos
+// demais erros
+func (p *ProxyBackend) handleError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, context.Canceled) {
+		// Cliente desconectou
+		return
+	}
+	p.logger.Error("Proxy %s -> %s: %v", r.URL.Path, redactURL(p.upstream.String()), err)
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		http.Error(w, "504 Gateway Timeout", http.StatusGatewayTimeout)
+		return
+	}
+	http.Error(w, "502 Bad Gateway", http.StatusBadGateway)
+}
+
+// ServeHTTP repassa a requisição ao backend
+func (p *ProxyBackend) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	debugNote(r, "backend", "proxy")
+	p.proxy.ServeHTTP(w, r)
+}
+
+// tracedTransport registra as chamadas ao backend no tracer
+type tracedTransport struct {
+	backend *ProxyBackend
+	base    http.RoundTripper
+}
+
+func (t *tracedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.backend.tracer == nil {
+		return t.base.RoundTrip(req)
+	}
+	// Redirecionamentos voltam ao cliente, como no proxy sem tracing
+	client := &http.Client{
+		Transport:     t.base,
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	return t.backend.tracer.Do(client, req, req)
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// echoBackend answers with the request line and selected headers
+func echoBackend(t *testing.T) *httptest.Server {
+	t.Helper()
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		fmt.Fprintf(w, "%s %s host=%s xff=%s proto=%s token=%s body=%s",
+			r.Method, r.URL.RequestURI(), r.Host, r.Header.Get("X-Forwarded-For"),
+			r.Header.Get("X-Forwarded-Proto"), r.Header.Get("X-Backend-Token"), body)
+	}))
+	t.Cleanup(backend.Close)
+	return backend
+}
+
+func newProxyTestServer(t *testing.T, proxies ...ProxyConfig) *Server {
+	t.Helper()
+	root := t.TempDir()
+	writeTestFile(t, filepath.Join(root, "app.js"), "static")
+	return newListingTestServer(t, root, func(c *Config) {
+		c.Proxy = proxies
+	})
+}
+
+func proxyGet(server *Server, method, target, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.RemoteAddr = "192.0.2.7:5000"
+	req.Host = "www.example.com"
+	w := httptest.NewRecorder()
+	server.mux.ServeHTTP(w, req)
+	return w
+}
+
+func TestProxyPrefixes(t *testing.T) {
+	backend := echoBackend(t)
+	server := newProxyTestServer(t,
+		ProxyConfig{Prefix: "/api/", Upstream: backend.URL, StripPrefix: true},
+		ProxyConfig{Prefix: "/svc/", Upstream: backend.URL + "/v1"},
+	)
+
+	tests := []struct {
+		method, target, want string
+	}{
+		{"GET", "/api/users?page=2", "GET /users?page=2 "},
+		{"POST", "/api/users", "POST /users "},
+		{"GET", "/svc/status", "GET /v1/svc/status "},
+	}
+	for _, tt := range tests {
+		w := proxyGet(server, tt.method, tt.target, "payload")
+		if w.Code != http.StatusOK || !strings.HasPrefix(w.Body.String(), tt.want) {
+			t.Errorf("%s %s: expected %q, got %d %q", tt.method, tt.target, tt.want, w.Code, w.Body.String())
+		}
+	}
+	if w := proxyGet(server, "POST", "/api/users", "payload"); !strings.HasSuffix(w.Body.String(), "body=payload") {
+		t.Errorf("Expected request body to reach the backend, got %q", w.Body.String())
+	}
+
+	// Everything else is still served from disk
+	if w := proxyGet(server, "GET", "/app.js", ""); w.Body.String() != "static" {
+		t.Errorf("Expected static file, got %q", w.Body.String())
+	}
+}
+
+func TestProxyHeaders(t *testing.T) {
+	backend := echoBackend(t)
+	server := newProxyTestServer(t,
+		ProxyConfig{Prefix: "/plain/", Upstream: backend.URL},
+		ProxyConfig{Prefix: "/fwd/", Upstream: backend.URL, XForwarded: true, PreserveHost: true,
+			Headers: map[string]string{"X-Backend-Token": "t0k"}},
+	)
+
+	body := proxyGet(server, "GET", "/plain/", "").Body.String()
+	if strings.Contains(body, "xff=192.0.2.7") || strings.Contains(body, "host=www.example.com") {
+		t.Errorf("Expected no forwarding headers by default, got %q", body)
+	}
+
+	body = proxyGet(server, "GET", "/fwd/", "").Body.String()
+	for _, want := range []string{"host=www.example.com", "xff=192.0.2.7", "proto=http", "token=t0k"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected %s in %q", want, body)
+		}
+	}
+}
+
+func TestProxyErrors(t *testing.T) {
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(1500 * time.Millisecond)
+	}))
+	defer slow.Close()
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	server := newProxyTestServer(t,
+		ProxyConfig{Prefix: "/slow/", Upstream: slow.URL, Timeout: 1},
+		ProxyConfig{Prefix: "/down/", Upstream: down.URL},
+	)
+	if w := proxyGet(server, "GET", "/slow/", ""); w.Code != http.StatusGatewayTimeout {
+		t.Errorf("Expected 504 for a slow backend, got %d", w.Code)
+	}
+	if w := proxyGet(server, "GET", "/down/", ""); w.Code != http.StatusBadGateway {
+		t.Errorf("Expected 502 for an unreachable backend, got %d", w.Code)
+	}
+}
+
+func TestProxyConfigErrors(t *testing.T) {
+	for _, config := range []ProxyConfig{
+		{Prefix: "api/", Upstream: "http://127.0.0.1:3000"},
+		{Prefix: "/api/", Upstream: "127.0.0.1:3000"},
+		{Prefix: "/api/", Upstream: "ftp://example.com"},
+	} {
+		if _, err := NewProxyBackend(&config, nil); err == nil {
+			t.Errorf("Expected error for %+v", config)
+		}
+	}
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"path"
+	"strings"
+)
+
+// ProxyAuth confia na identidade enviada por um proxy de autenticação à
+// frente do qserv (oauth2-proxy, Authelia): os headers só valem quando a
+// conexão vem de um proxy confiável e alimentam as ACLs e o log de acesso
+type ProxyAuth struct {
+	config  *ProxyAuthConfig
+	logger  *Logger
+	trusted []netip.Prefix
+}
+
+// proxyIdentity usuário informado pelo proxy
+type proxyIdentity struct {
+	User   string
+	Email  string
+	Groups []string
+}
+
+// name identifica o usuário no log (usuário ou, na falta, e-mail)
+func (id proxyIdentity) name() string {
+	if id.User != "" {
+		return id.User
+	}
+	return id.Email
+}
+
+// NewProxyAuth valida os proxies confiáveis e as regras
+func NewProxyAuth(config *ProxyAuthConfig, logger *Logger) (*ProxyAuth, error) {
+	if len(config.TrustedProxies) == 0 {
+		return nil, fmt.Errorf("proxy_auth: trusted_proxies is required")
+	}
+	p := &ProxyAuth{config: config, logger: logger}
+	for _, raw := range config.TrustedProxies {
+		prefix, err := netip.ParsePrefix(raw)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(raw)
+			if addrErr != nil {
+				return nil, fmt.Errorf("proxy_auth: invalid trusted proxy %q", raw)
+			}
+			prefix = netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen())
+		}
+		p.trusted = append(p.trusted, prefix.Masked())
+	}
+	for i, rule := range config.ACL {
+		if rule.Path == "" {
+			return nil, fmt.Errorf("proxy_auth: acl[%d]: path is required", i)
+		}
+		if len(rule.Users) == 0 && len(rule.Groups) == 0 {
+			return nil, fmt.Errorf("proxy_auth: acl[%d]: set users or groups", i)
+		}
+	}
+	return p, nil
+}
+
+// userHeaders retorna os headers com o nome do usuário, em ordem de preferência
+func (c *ProxyAuthConfig) userHeaders() []string {
+	if len(c.UserHeaders) == 0 {
+		return []string{"Remote-User", "X-Auth-Request-User", "X-Forwarded-User"}
+	}
+	return c.UserHeaders
+}
+
+// emailHeaders retorna os headers com o e-mail do usuário
+func (c *ProxyAuthConfig) emailHeaders() []string {
+	if len(c.EmailHeaders) == 0 {
+		return []string{"X-Auth-Request-Email", "Remote-Email", "X-Forwarded-Email"}
+	}
+	return c.EmailHeaders
+}
+
+// groupsHeaders retorna os headers com os grupos (separados por vírgula)
+func (c *ProxyAuthConfig) groupsHeaders() []string {
+	if len(c.GroupsHeaders) == 0 {
+		return []string{"Remote-Groups", "X-Auth-Request-Groups", "X-Forwarded-Groups"}
+	}
+	return c.GroupsHeaders
+}
+
+// fromTrustedProxy informa se a conexão vem de um proxy confiável
+func (p *ProxyAuth) fromTrustedProxy(r *http.Request) bool {
+	ip, _, _ := net.SplitHostPort(r.RemoteAddr)
+	addr, err := netip.ParseAddr(ip)
+	return err == nil && inPrefixes(addr.Unmap(), p.trusted)
+}
+
+// firstHeader retorna o primeiro header não vazio
+func firstHeader(r *http.Request, names []string) string {
+	for _, name := range names {
+		if v := strings.TrimSpace(r.Header.Get(name)); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// identity lê a identidade dos headers (só chamada para proxies confiáveis)
+func (p *ProxyAuth) identity(r *http.Request) proxyIdentity {
+	id := proxyIdentity{
+		User:  firstHeader(r, p.config.userHeaders()),
+		Email: firstHeader(r, p.config.emailHeaders()),
+	}
+	for _, group := range strings.Split(firstHeader(r, p.config.groupsHeaders()), ",") {
+		if group = strings.TrimSpace(group); group != "" {
+			id.Groups = append(id.Groups, group)
+		}
+	}
+	return id
+}
+
+// stripIdentity remove os headers de identidade (enviados por quem não é proxy)
+func (p *ProxyAuth) stripIdentity(r *http.Request) {
+	for _, names := range [][]string{p.config.userHeaders(), p.config.emailHeaders(), p.config.groupsHeaders()} {
+		for _, name := range names {
+			r.Header.Del(name)
+		}
+	}
+}
+
+// matchUser compara o usuário com um glob (ex: *@example.com)
+func matchUser(pattern, user string) bool {
+	ok, _ := path.Match(pattern, user)
+	return ok && user != ""
+}
+
+// allowed aplica a primeira regra da ACL que casa com o caminho; sem regra, libera
+func (p *ProxyAuth) allowed(id proxyIdentity, urlPath string) bool {
+	for _, rule := range p.config.ACL {
+		if !matchGlob(rule.Path, urlPath) {
+			continue
+		}
+		for _, pattern := range rule.Users {
+			if matchUser(pattern, id.User) || matchUser(pattern, id.Email) {
+				return true
+			}
+		}
+		for _, group := range rule.Groups {
+			if containsString(id.Groups, group) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// covers informa se a identidade decide o acesso a urlPath (required ou
+// alguma regra da ACL casa com o caminho)
+func (p *ProxyAuth) covers(urlPath string) bool {
+	if p.config.Required {
+		return true
+	}
+	for _, rule := range p.config.ACL {
+		if matchGlob(rule.Path, urlPath) {
+			return true
+		}
+	}
+	return false
+}
+
+// check aplica a ACL a resourcePath, o caminho do arquivo acessado: nas rotas
+// que mapeiam a URL para outro arquivo (/dav, API de arquivos, /=/<sha256>)
+// ele difere de r.URL.Path. Retorna 0 ou o status da recusa
+func (p *ProxyAuth) check(r *http.Request, resourcePath string) int {
+	var id proxyIdentity
+	if p.fromTrustedProxy(r) {
+		id = p.identity(r)
+	}
+	if p.allowed(id, resourcePath) {
+		return 0
+	}
+	if id.name() == "" {
+		return http.StatusUnauthorized
+	}
+	p.logger.Warn("Proxy auth: %s denied access to %s", id.name(), resourcePath)
+	return http.StatusForbidden
+}
+
+// proxyAuthError mensagem de cada recusa de check
+func proxyAuthError(status int) string {
+	if status == http.StatusUnauthorized {
+		return "401 Unauthorized: authentication required"
+	}
+	return "403 Forbidden"
+}
+
+// ProxyAuthMiddleware lê a identidade dos proxies confiáveis, descarta os
+// headers forjados pelos demais clientes e aplica required e a ACL
+func ProxyAuthMiddleware(p *ProxyAuth) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var id proxyIdentity
+			if p.fromTrustedProxy(r) {
+				id = p.identity(r)
+			} else {
+				p.stripIdentity(r)
+			}
+			if name := id.name(); name != "" {
+				setRequestUser(r, name)
+			} else if p.config.Required {
+				http.Error(w, "401 Unauthorized: authentication required", http.StatusUnauthorized)
+				return
+			}
+			if status := p.check(r, r.URL.Path); status != 0 {
+				http.Error(w, proxyAuthError(status), status)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
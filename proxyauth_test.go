@@ -0,0 +1,147 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func newTestProxyAuth(t *testing.T, config *ProxyAuthConfig) *ProxyAuth {
+	t.Helper()
+	config.Enabled = true
+	if config.TrustedProxies == nil {
+		config.TrustedProxies = []string{"10.0.0.5", "192.168.10.0/24"}
+	}
+	logger, _ := NewLogger(&LoggingConfig{Enabled: false})
+	p, err := NewProxyAuth(config, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func proxyAuthRequest(handler http.Handler, remote, path string, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", path, nil)
+	req.RemoteAddr = remote
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	return w
+}
+
+func TestProxyAuthTrustsOnlyConfiguredProxies(t *testing.T) {
+	p := newTestProxyAuth(t, &ProxyAuthConfig{Required: true})
+	var seen string
+	handler := ProxyAuthMiddleware(p)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = r.Header.Get("Remote-User")
+	}))
+
+	w := proxyAuthRequest(handler, "10.0.0.5:4000", "/", map[string]string{"Remote-User": "alice"})
+	if w.Code != http.StatusOK || seen != "alice" {
+		t.Errorf("Expected request from trusted proxy to pass as alice, got %d %q", w.Code, seen)
+	}
+	w = proxyAuthRequest(handler, "192.168.10.7:4000", "/", map[string]string{"X-Auth-Request-Email": "bob@example.com"})
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected email identity from proxy range to pass, got %d", w.Code)
+	}
+
+	// A client talking to qserv directly cannot claim an identity
+	w = proxyAuthRequest(handler, "203.0.113.9:4000", "/", map[string]string{"Remote-User": "alice"})
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 for spoofed identity, got %d", w.Code)
+	}
+	w = proxyAuthRequest(handler, "10.0.0.5:4000", "/", nil)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without identity when required, got %d", w.Code)
+	}
+}
+
+func TestProxyAuthStripsSpoofedHeaders(t *testing.T) {
+	p := newTestProxyAuth(t, &ProxyAuthConfig{})
+	var seen string
+	handler := ProxyAuthMiddleware(p)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = r.Header.Get("Remote-User") + r.Header.Get("Remote-Groups")
+	}))
+	w := proxyAuthRequest(handler, "203.0.113.9:4000", "/", map[string]string{"Remote-User": "alice", "Remote-Groups": "admins"})
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected anonymous access without required, got %d", w.Code)
+	}
+	if seen != "" {
+		t.Errorf("Expected identity headers from untrusted client to be removed, got %q", seen)
+	}
+}
+
+func TestProxyAuthACL(t *testing.T) {
+	p := newTestProxyAuth(t, &ProxyAuthConfig{ACL: []ProxyACLRule{
+		{Path: "/finance/**", Groups: []string{"finance"}},
+		{Path: "/team/**", Users: []string{"*@example.com"}},
+	}})
+	handler := ProxyAuthMiddleware(p)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	tests := []struct {
+		path    string
+		headers map[string]string
+		status  int
+	}{
+		{"/finance/q1.xlsx", map[string]string{"Remote-User": "carol", "Remote-Groups": "staff, finance"}, http.StatusOK},
+		{"/finance/q1.xlsx", map[string]string{"Remote-User": "dave", "Remote-Groups": "staff"}, http.StatusForbidden},
+		{"/finance/q1.xlsx", nil, http.StatusUnauthorized},
+		{"/team/notes.txt", map[string]string{"X-Auth-Request-Email": "erin@example.com"}, http.StatusOK},
+		{"/team/notes.txt", map[string]string{"X-Auth-Request-Email": "frank@other.org"}, http.StatusForbidden},
+		{"/public/readme.txt", nil, http.StatusOK},
+	}
+	for _, tt := range tests {
+		if w := proxyAuthRequest(handler, "10.0.0.5:4000", tt.path, tt.headers); w.Code != tt.status {
+			t.Errorf("%s %v: expected %d, got %d", tt.path, tt.headers, tt.status, w.Code)
+		}
+	}
+}
+
+func TestProxyAuthLogsUser(t *testing.T) {
+	p := newTestProxyAuth(t, &ProxyAuthConfig{})
+	var user string
+	inner := ProxyAuthMiddleware(p)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		u := r.Context().Value(requestUserKey{}).(*requestUser)
+		u.mu.Lock()
+		user = u.name
+		u.mu.Unlock()
+	}))
+	logger, _ := NewLogger(&LoggingConfig{Enabled: false})
+	proxyAuthRequest(LoggingMiddleware(logger)(inner), "10.0.0.5:4000", "/", map[string]string{"Remote-User": "alice"})
+	if user != "alice" {
+		t.Errorf("Expected access log user alice, got %q", user)
+	}
+}
+
+func TestProxyAuthConfigErrors(t *testing.T) {
+	for _, config := range []*ProxyAuthConfig{
+		{},
+		{TrustedProxies: []string{"not-an-ip"}},
+		{TrustedProxies: []string{"10.0.0.5"}, ACL: []ProxyACLRule{{Path: "/x/**"}}},
+	} {
+		if _, err := NewProxyAuth(config, nil); err == nil {
+			t.Errorf("Expected error for %+v", config)
+		}
+	}
+}
+
+func TestProxyAuthCheckResourcePath(t *testing.T) {
+	p := newTestProxyAuth(t, &ProxyAuthConfig{ACL: []ProxyACLRule{{Path: "/private/**", Groups: []string{"admins"}}}})
+
+	// Routes like /dav map the URL onto another file; the ACL applies to the file
+	req := httptest.NewRequest("GET", "/dav/private/secret.txt", nil)
+	req.RemoteAddr = "10.0.0.5:4000"
+	if status := p.check(req, "/private/secret.txt"); status != http.StatusUnauthorized {
+		t.Errorf("Expected 401 for an anonymous resource access, got %d", status)
+	}
+	req.Header.Set("Remote-User", "bob")
+	if status := p.check(req, "/private/secret.txt"); status != http.StatusForbidden {
+		t.Errorf("Expected 403 outside the group, got %d", status)
+	}
+	req.Header.Set("Remote-Groups", "admins")
+	if status := p.check(req, "/private/secret.txt"); status != 0 {
+		t.Errorf("Expected access for admins, got %d", status)
+	}
+}
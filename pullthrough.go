@@ -0,0 +1,448 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// hopHeaders headers de conexão que não são repassados nem armazenados
+var hopHeaders = []string{
+	"Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Proxy-Connection",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// PullThrough espelha sob demanda um upstream, opcionalmente com cache em disco
+type PullThrough struct {
+	config   *PullThroughConfig
+	upstream *url.URL
+	client   *http.Client
+	cache    *DiskCache
+	logger   *Logger
+	tracer   *Tracer // nil sem logging.tracing
+
+	revalidating sync.Map     // chaves com revalidação em andamento
+	flights      *flightGroup // buscas simultâneas da mesma chave
+}
+
+// NewPullThrough cria um espelho pull-through a partir da configuração
+func NewPullThrough(config *PullThroughConfig, logger *Logger) (*PullThrough, error) {
+	upstream, err := url.Parse(config.Upstream)
+	if err != nil {
+		return nil, fmt.Errorf("invalid upstream URL: %w", err)
+	}
+
+	timeout := time.Duration(config.Timeout) * time.Second
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ResponseHeaderTimeout = timeout
+
+	p := &PullThrough{
+		config:   config,
+		upstream: upstream,
+		client:   &http.Client{Transport: transport},
+		logger:   logger,
+		flights:  newFlightGroup("pull-through"),
+	}
+
+	if config.Cache != nil && config.Cache.Enabled {
+		dir := config.Cache.Dir
+		if dir == "" {
+			dir = filepath.Join(".qserv-cache", strings.Trim(config.Prefix, "/"))
+		}
+		maxSize := config.Cache.MaxSize
+		if maxSize <= 0 {
+			maxSize = 1024
+		}
+		cache, err := NewDiskCache("disk:"+config.Prefix, dir, maxSize*1024*1024)
+		if err != nil {
+			return nil, fmt.Errorf("opening cache: %w", err)
+		}
+		p.cache = cache
+	}
+
+	return p, nil
+}
+
+// expiration calcula validade e janelas de conteúdo expirado de uma resposta
+func (p *PullThrough) expiration(entry *diskCacheEntry, header http.Header) {
+	cfg := p.config.Cache
+	ttl := time.Duration(cfg.DefaultTTL) * time.Second
+	entry.Expires = entry.Stored.Add(freshnessLifetime(header, ttl))
+	entry.StaleWhileRevalidate, entry.StaleIfError = staleWindows(header,
+		time.Duration(cfg.StaleWhileRevalidate)*time.Second,
+		time.Duration(cfg.StaleIfError)*time.Second,
+	)
+}
+
+// upstreamURL calcula a URL no upstream para o caminho local
+func (p *PullThrough) upstreamURL(r *http.Request) string {
+	u := *p.upstream
+	rest := strings.TrimPrefix(r.URL.Path, strings.TrimSuffix(p.config.Prefix, "/"))
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + strings.TrimPrefix(rest, "/")
+	u.RawPath = ""
+	u.RawQuery = r.URL.RawQuery
+	return u.String()
+}
+
+// cacheKey chave de cache: caminho local mais a query
+func cacheKey(r *http.Request) string {
+	if r.URL.RawQuery != "" {
+		return r.URL.Path + "?" + r.URL.RawQuery
+	}
+	return r.URL.Path
+}
+
+// ServeHTTP serve a requisição a partir do cache ou do upstream
+func (p *PullThrough) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	debugNote(r, "backend", "pull-through")
+
+	if p.cache == nil {
+		p.proxy(w, r)
+		return
+	}
+
+	key := cacheKey(r)
+	entry, ok := p.cache.Get(key)
+	if ok {
+		now := time.Now()
+		if entry.Fresh(now) {
+			p.serveCached(w, r, entry, "hit")
+			return
+		}
+		if entry.ServeWhileRevalidating(now) {
+			p.revalidateAsync(r, entry)
+			p.serveCached(w, r, entry, "stale")
+			return
+		}
+	}
+
+	// Falhas simultâneas da mesma chave geram uma só busca na origem: as
+	// demais esperam o download e são servidas do cache
+	_, err, joined := p.flights.Do(r.Context(), key, func() (interface{}, error) {
+		p.fetch(w, r, key, entry)
+		return nil, nil
+	})
+	if !joined || err != nil {
+		return
+	}
+	if fresh, ok := p.cache.Get(key); ok && fresh.Fresh(time.Now()) {
+		p.serveCached(w, r, fresh, "coalesced")
+		return
+	}
+	// A resposta não foi armazenada (não cacheável ou erro): busca própria
+	p.fetch(w, r, key, entry)
+}
+
+// proxy repassa a requisição sem cache
+func (p *PullThrough) proxy(w http.ResponseWriter, r *http.Request) {
+	req, err := http.NewRequestWithContext(r.Context(), r.Method, p.upstreamURL(r), nil)
+	if err != nil {
+		http.Error(w, "Bad Gateway", http.StatusBadGateway)
+		return
+	}
+	for name, values := range r.Header {
+		req.Header[name] = values
+	}
+	removeHopHeaders(req.Header)
+
+	resp, err := p.tracer.Do(p.client, r, req)
+	if err != nil {
+		p.logger.Error("Pull-through %s: %v", redactURL(req.URL.String()), err)
+		http.Error(w, "Bad Gateway", http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+
+	copyResponseHeader(w.Header(), resp.Header)
+	setCacheStatus(w, r, "bypass")
+	w.WriteHeader(resp.StatusCode)
+	copyBuffer(w, resp.Body)
+}
+
+// newUpstreamRequest cria a requisição ao upstream, condicional se houver cópia em cache
+func (p *PullThrough) newUpstreamRequest(ctx context.Context, r *http.Request, cached *diskCacheEntry) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.upstreamURL(r), nil)
+	if err != nil {
+		return nil, err
+	}
+	if ua := r.Header.Get("User-Agent"); ua != "" {
+		req.Header.Set("User-Agent", ua)
+	}
+	if cached != nil {
+		if etag := cached.Header.Get("ETag"); etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		if lastModified := cached.Header.Get("Last-Modified"); lastModified != "" {
+			req.Header.Set("If-Modified-Since", lastModified)
+		}
+	}
+	return req, nil
+}
+
+// fetch busca a resposta no upstream, grava no cache e serve ao cliente
+func (p *PullThrough) fetch(w http.ResponseWriter, r *http.Request, key string, cached *diskCacheEntry) {
+	// O download continua mesmo se o cliente desconectar, para completar o cache
+	ctx := context.WithoutCancel(r.Context())
+
+	req, err := p.newUpstreamRequest(ctx, r, cached)
+	if err != nil {
+		http.Error(w, "Bad Gateway", http.StatusBadGateway)
+		return
+	}
+
+	start := time.Now()
+	resp, err := p.tracer.Do(p.client, r, req)
+	debugTiming(r, "upstream", time.Since(start))
+	if err != nil {
+		p.logger.Error("Pull-through %s: %v", redactURL(req.URL.String()), err)
+		if cached != nil && cached.ServeOnError(time.Now()) {
+			p.serveCached(w, r, cached, "stale-if-error")
+			return
+		}
+		http.Error(w, "Bad Gateway", http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+
+	// Erros da origem: serve a cópia expirada dentro da janela stale-if-error
+	if cached != nil && resp.StatusCode >= 500 && cached.ServeOnError(time.Now()) {
+		p.logger.Warn("Pull-through %s: upstream returned %d, serving stale", key, resp.StatusCode)
+		p.serveCached(w, r, cached, "stale-if-error")
+		return
+	}
+
+	if cached != nil && resp.StatusCode == http.StatusNotModified {
+		p.refresh(cached, resp.Header)
+		p.serveCached(w, r, cached, "revalidated")
+		return
+	}
+
+	if !p.cacheable(resp) {
+		if cached != nil {
+			p.cache.Remove(key)
+		}
+		copyResponseHeader(w.Header(), resp.Header)
+		setCacheStatus(w, r, "uncacheable")
+		w.WriteHeader(resp.StatusCode)
+		if r.Method != http.MethodHead {
+			copyBuffer(w, resp.Body)
+		}
+		return
+	}
+
+	writer, err := p.cache.Create(key)
+	if err != nil {
+		p.logger.Error("Pull-through cache %s: %v", key, err)
+		copyResponseHeader(w.Header(), resp.Header)
+		setCacheStatus(w, r, "uncacheable")
+		w.WriteHeader(resp.StatusCode)
+		copyBuffer(w, resp.Body)
+		return
+	}
+
+	// Requisições simples recebem o conteúdo enquanto ele é gravado; HEAD e
+	// Range são servidos a partir do cache depois do download completo
+	stream := r.Method == http.MethodGet && r.Header.Get("Range") == ""
+	if stream {
+		copyResponseHeader(w.Header(), resp.Header)
+		setCacheStatus(w, r, "miss")
+		w.WriteHeader(resp.StatusCode)
+	}
+
+	entry, err := p.store(writer, resp, stream, w)
+	if err != nil {
+		p.logger.Error("Pull-through %s: %v", key, err)
+		if !stream {
+			http.Error(w, "Bad Gateway", http.StatusBadGateway)
+		}
+		return
+	}
+
+	if !stream {
+		p.serveCached(w, r, entry, "miss")
+	}
+}
+
+// store grava o corpo da resposta no cache, opcionalmente repassando ao cliente
+func (p *PullThrough) store(writer *DiskCacheWriter, resp *http.Response, stream bool, w io.Writer) (*diskCacheEntry, error) {
+	var dst io.Writer = writer
+	if stream {
+		dst = &teeWriter{primary: writer, secondary: w}
+	}
+
+	if _, err := copyBuffer(dst, resp.Body); err != nil {
+		writer.Abort()
+		return nil, err
+	}
+
+	entry := p.newEntry(resp.StatusCode, resp.Header)
+	if err := writer.Commit(entry); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// revalidateAsync revalida uma entrada expirada em segundo plano (uma por chave)
+func (p *PullThrough) revalidateAsync(r *http.Request, cached *diskCacheEntry) {
+	if _, running := p.revalidating.LoadOrStore(cached.Key, true); running {
+		return
+	}
+
+	req, err := p.newUpstreamRequest(context.Background(), r, cached)
+	if err != nil {
+		p.revalidating.Delete(cached.Key)
+		return
+	}
+
+	go func() {
+		defer p.revalidating.Delete(cached.Key)
+
+		resp, err := p.tracer.Do(p.client, r, req)
+		if err != nil {
+			p.logger.Warn("Pull-through revalidation of %s failed: %v", cached.Key, err)
+			return
+		}
+		defer resp.Body.Close()
+
+		switch {
+		case resp.StatusCode == http.StatusNotModified:
+			p.refresh(cached, resp.Header)
+		case p.cacheable(resp):
+			writer, err := p.cache.Create(cached.Key)
+			if err != nil {
+				return
+			}
+			if _, err := p.store(writer, resp, false, nil); err != nil {
+				p.logger.Warn("Pull-through revalidation of %s failed: %v", cached.Key, err)
+			}
+		default:
+			p.logger.Warn("Pull-through revalidation of %s: upstream returned %d", cached.Key, resp.StatusCode)
+		}
+	}()
+}
+
+// cacheable indica se a resposta do upstream pode ser armazenada
+func (p *PullThrough) cacheable(resp *http.Response) bool {
+	if resp.StatusCode != http.StatusOK {
+		return false
+	}
+	directives := parseCacheControl(resp.Header)
+	if _, ok := directives["no-store"]; ok {
+		return false
+	}
+	if _, ok := directives["private"]; ok {
+		return false
+	}
+	// O transporte já decodifica gzip; outras variações não são suportadas
+	for _, vary := range resp.Header.Values("Vary") {
+		for _, field := range strings.Split(vary, ",") {
+			field = strings.TrimSpace(field)
+			if field != "" && !strings.EqualFold(field, "Accept-Encoding") {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// newEntry monta os metadados a partir dos headers do upstream
+func (p *PullThrough) newEntry(status int, header http.Header) *diskCacheEntry {
+	stored := header.Clone()
+	removeHopHeaders(stored)
+	stored.Del("Set-Cookie")
+	stored.Del("Content-Length")
+
+	entry := &diskCacheEntry{Status: status, Header: stored, Stored: time.Now()}
+	p.expiration(entry, header)
+	return entry
+}
+
+// refresh atualiza validade e validadores de uma entrada após um 304
+func (p *PullThrough) refresh(entry *diskCacheEntry, header http.Header) {
+	for _, name := range []string{"Cache-Control", "Date", "ETag", "Expires", "Last-Modified", "Vary"} {
+		if values := header.Values(name); len(values) > 0 {
+			entry.Header[name] = values
+		}
+	}
+
+	entry.Stored = time.Now()
+	p.expiration(entry, entry.Header)
+
+	if err := p.cache.Refresh(entry); err != nil {
+		p.logger.Error("Pull-through cache %s: %v", entry.Key, err)
+	}
+}
+
+// serveCached serve uma entrada do cache (com suporte a Range e requisições
+// condicionais); status é o resultado informado em X-Cache e Cache-Status
+func (p *PullThrough) serveCached(w http.ResponseWriter, r *http.Request, entry *diskCacheEntry, status string) {
+	file, err := p.cache.Open(entry.Key)
+	if err != nil {
+		p.cache.Remove(entry.Key)
+		p.fetch(w, r, entry.Key, nil)
+		return
+	}
+	defer file.Close()
+
+	copyResponseHeader(w.Header(), entry.Header)
+	setCacheStatus(w, r, status)
+	w.Header().Set("Age", fmt.Sprintf("%d", int(time.Since(entry.Stored).Seconds())))
+	http.ServeContent(w, r, "", entry.ModTime(), file)
+}
+
+// copyResponseHeader copia headers de resposta, exceto os de conexão
+func copyResponseHeader(dst, src http.Header) {
+	for name, values := range src {
+		dst[name] = append([]string(nil), values...)
+	}
+	removeHopHeaders(dst)
+}
+
+// removeHopHeaders remove os headers de conexão
+func removeHopHeaders(h http.Header) {
+	for _, name := range hopHeaders {
+		h.Del(name)
+	}
+}
+
+// teeWriter grava no destino principal e repassa ao secundário enquanto ele
+// aceitar escrita (a desconexão do cliente não interrompe o cache)
+type teeWriter struct {
+	primary   io.Writer
+	secondary io.Writer
+	failed    bool
+}
+
+func (t *teeWriter) Write(p []byte) (int, error) {
+	n, err := t.primary.Write(p)
+	if err != nil {
+		return n, err
+	}
+	if !t.failed {
+		if _, err := t.secondary.Write(p); err != nil {
+			t.failed = true
+		}
+	}
+	return n, nil
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newPullThroughTest cria um espelho com cache apontando para um upstream de teste
+func newPullThroughTest(t *testing.T, upstream http.HandlerFunc, cache *DiskCacheConfig) (*PullThrough, *atomic.Int32) {
+	t.Helper()
+
+	var hits atomic.Int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		upstream(w, r)
+	}))
+	t.Cleanup(backend.Close)
+
+	if cache != nil && cache.Dir == "" {
+		cache.Dir = t.TempDir()
+	}
+	config := &PullThroughConfig{Prefix: "/mirror/", Upstream: backend.URL + "/base", Cache: cache}
+	logger, _ := NewLogger(&LoggingConfig{Enabled: false})
+	mirror, err := NewPullThrough(config, logger)
+	if err != nil {
+		t.Fatalf("Failed to create pull-through: %v", err)
+	}
+	return mirror, &hits
+}
+
+func pullThroughGet(mirror *PullThrough, path string, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", path, nil)
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	rec := httptest.NewRecorder()
+	mirror.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestPullThroughCacheHit(t *testing.T) {
+	mirror, hits := newPullThroughTest(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/base/pkg/file.txt" {
+			t.Errorf("Expected upstream path /base/pkg/file.txt, got %s", r.URL.Path)
+		}
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("Set-Cookie", "session=1")
+		io.WriteString(w, "payload")
+	}, &DiskCacheConfig{Enabled: true})
+
+	for i := 0; i < 3; i++ {
+		rec := pullThroughGet(mirror, "/mirror/pkg/file.txt", nil)
+		if rec.Code != http.StatusOK || rec.Body.String() != "payload" {
+			t.Fatalf("Request %d: expected 200 payload, got %d %q", i, rec.Code, rec.Body.String())
+		}
+		if i > 0 && rec.Header().Get("Set-Cookie") != "" {
+			t.Errorf("Expected Set-Cookie not to be served from cache")
+		}
+		want := map[bool]string{false: "MISS", true: "HIT"}[i > 0]
+		if got := rec.Header().Get("X-Cache"); got != want {
+			t.Errorf("Request %d: expected X-Cache %s, got %q", i, want, got)
+		}
+	}
+	if hits.Load() != 1 {
+		t.Errorf("Expected 1 upstream request, got %d", hits.Load())
+	}
+
+	// Range servido a partir do cache
+	rec := pullThroughGet(mirror, "/mirror/pkg/file.txt", http.Header{"Range": {"bytes=0-2"}})
+	if rec.Code != http.StatusPartialContent || rec.Body.String() != "pay" {
+		t.Errorf("Expected 206 pay, got %d %q", rec.Code, rec.Body.String())
+	}
+}
+
+func TestPullThroughRevalidation(t *testing.T) {
+	mirror, hits := newPullThroughTest(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Cache-Control", "max-age=0")
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		io.WriteString(w, "v1")
+	}, &DiskCacheConfig{Enabled: true})
+
+	pullThroughGet(mirror, "/mirror/a", nil)
+	rec := pullThroughGet(mirror, "/mirror/a", nil)
+	if rec.Code != http.StatusOK || rec.Body.String() != "v1" {
+		t.Errorf("Expected cached body after 304, got %d %q", rec.Code, rec.Body.String())
+	}
+	if got := rec.Header().Get("Cache-Status"); got != "qserv; fwd=stale; fwd-status=304; stored" {
+		t.Errorf("Expected revalidated Cache-Status, got %q", got)
+	}
+	if hits.Load() != 2 {
+		t.Errorf("Expected 2 upstream requests, got %d", hits.Load())
+	}
+
+	// O cliente também pode revalidar contra o cache
+	rec = pullThroughGet(mirror, "/mirror/a", http.Header{"If-None-Match": {`"v1"`}})
+	if rec.Code != http.StatusNotModified {
+		t.Errorf("Expected 304 for client revalidation, got %d", rec.Code)
+	}
+}
+
+func TestPullThroughNoStore(t *testing.T) {
+	mirror, hits := newPullThroughTest(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-store")
+		io.WriteString(w, "secret")
+	}, &DiskCacheConfig{Enabled: true})
+
+	pullThroughGet(mirror, "/mirror/a", nil)
+	pullThroughGet(mirror, "/mirror/a", nil)
+	if hits.Load() != 2 {
+		t.Errorf("Expected no-store responses not to be cached, got %d upstream requests", hits.Load())
+	}
+	if entries, _ := mirror.cache.Stats(); entries != 0 {
+		t.Errorf("Expected empty cache, got %d entries", entries)
+	}
+}
+
+func TestPullThroughStaleWhileRevalidate(t *testing.T) {
+	var version atomic.Int32
+	version.Store(1)
+	mirror, hits := newPullThroughTest(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=0")
+		if version.Load() == 1 {
+			io.WriteString(w, "old")
+			return
+		}
+		io.WriteString(w, "new")
+	}, &DiskCacheConfig{Enabled: true, StaleWhileRevalidate: 60})
+
+	pullThroughGet(mirror, "/mirror/a", nil)
+	version.Store(2)
+
+	rec := pullThroughGet(mirror, "/mirror/a", nil)
+	if rec.Body.String() != "old" {
+		t.Errorf("Expected stale content while revalidating, got %q", rec.Body.String())
+	}
+
+	idle := func() bool {
+		_, running := mirror.revalidating.Load("/mirror/a")
+		return !running
+	}
+	if !waitUntil(t, func() bool { return hits.Load() >= 2 && idle() }) {
+		t.Fatalf("Background revalidation did not finish")
+	}
+
+	rec = pullThroughGet(mirror, "/mirror/a", nil)
+	if rec.Body.String() != "new" {
+		t.Errorf("Expected revalidated content, got %q", rec.Body.String())
+	}
+
+	// The entry is stale again: wait for the next revalidation before cleanup
+	waitUntil(t, func() bool { return hits.Load() >= 3 && idle() })
+}
+
+func TestPullThroughStaleIfError(t *testing.T) {
+	var failing atomic.Bool
+	mirror, _ := newPullThroughTest(t, func(w http.ResponseWriter, r *http.Request) {
+		if failing.Load() {
+			http.Error(w, "down", http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Cache-Control", "max-age=0")
+		if r.URL.Path == "/base/strict" {
+			w.Header().Set("Cache-Control", "max-age=0, must-revalidate")
+		}
+		io.WriteString(w, "cached")
+	}, &DiskCacheConfig{Enabled: true, StaleIfError: 60})
+
+	pullThroughGet(mirror, "/mirror/a", nil)
+	pullThroughGet(mirror, "/mirror/strict", nil)
+	failing.Store(true)
+
+	rec := pullThroughGet(mirror, "/mirror/a", nil)
+	if rec.Code != http.StatusOK || rec.Body.String() != "cached" {
+		t.Errorf("Expected stale content on upstream error, got %d %q", rec.Code, rec.Body.String())
+	}
+
+	rec = pullThroughGet(mirror, "/mirror/strict", nil)
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected must-revalidate to disable stale-if-error, got %d", rec.Code)
+	}
+}
+
+func TestStaleWindows(t *testing.T) {
+	tests := []struct {
+		cacheControl string
+		swr, sie     time.Duration
+	}{
+		{"max-age=60", 10 * time.Second, 20 * time.Second},
+		{"max-age=60, stale-while-revalidate=30, stale-if-error=3600", 30 * time.Second, time.Hour},
+		{"max-age=60, must-revalidate, stale-if-error=3600", 0, 0},
+		{"no-cache", 0, 0},
+	}
+
+	for _, test := range tests {
+		header := http.Header{"Cache-Control": {test.cacheControl}}
+		swr, sie := staleWindows(header, 10*time.Second, 20*time.Second)
+		if swr != test.swr || sie != test.sie {
+			t.Errorf("staleWindows(%q): expected %v/%v, got %v/%v", test.cacheControl, test.swr, test.sie, swr, sie)
+		}
+	}
+}
+
+func TestPullThroughPassThrough(t *testing.T) {
+	mirror, _ := newPullThroughTest(t, func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "gone", http.StatusNotFound)
+	}, nil)
+
+	rec := pullThroughGet(mirror, "/mirror/missing", nil)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected upstream status 404, got %d", rec.Code)
+	}
+
+	req := httptest.NewRequest("POST", "/mirror/a", strings.NewReader("x"))
+	rec = httptest.NewRecorder()
+	mirror.ServeHTTP(rec, req)
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405 for POST, got %d", rec.Code)
+	}
+}
+
+func TestDiskCacheEviction(t *testing.T) {
+	dir := t.TempDir()
+	cache, err := NewDiskCache("disk:test", dir, 10)
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+
+	put := func(key, body string) {
+		writer, err := cache.Create(key)
+		if err != nil {
+			t.Fatalf("Failed to create entry: %v", err)
+		}
+		io.WriteString(writer, body)
+		if err := writer.Commit(&diskCacheEntry{Status: 200, Header: http.Header{}}); err != nil {
+			t.Fatalf("Failed to commit entry: %v", err)
+		}
+	}
+
+	put("/a", "aaaa")
+	put("/b", "bbbb")
+	cache.Get("/a") // /b passa a ser o menos usado
+	put("/c", "cccc")
+
+	if _, ok := cache.Get("/b"); ok {
+		t.Errorf("Expected least recently used entry to be evicted")
+	}
+	if _, ok := cache.Get("/a"); !ok {
+		t.Errorf("Expected recently used entry to be kept")
+	}
+
+	// O índice é reconstruído a partir do disco
+	reopened, err := NewDiskCache("disk:test", dir, 10)
+	if err != nil {
+		t.Fatalf("Failed to reopen cache: %v", err)
+	}
+	if entries, size := reopened.Stats(); entries != 2 || size != 8 {
+		t.Errorf("Expected 2 entries (8 bytes) after reopen, got %d (%d bytes)", entries, size)
+	}
+
+	evicted := reopened.Purge(func(key string) bool { return key == "/a" })
+	if len(evicted) != 1 {
+		t.Errorf("Expected 1 purged entry, got %v", evicted)
+	}
+}
+
+func TestFreshnessLifetime(t *testing.T) {
+	tests := []struct {
+		header   http.Header
+		expected time.Duration
+	}{
+		{http.Header{"Cache-Control": {"max-age=60"}}, time.Minute},
+		{http.Header{"Cache-Control": {"max-age=60, s-maxage=120"}}, 2 * time.Minute},
+		{http.Header{"Cache-Control": {"no-cache, max-age=60"}}, 0},
+		{http.Header{"Date": {"Mon, 02 Jan 2006 15:04:05 GMT"}, "Expires": {"Mon, 02 Jan 2006 15:05:05 GMT"}}, time.Minute},
+		{http.Header{"Expires": {"0"}}, 0},
+		{http.Header{}, 5 * time.Second},
+	}
+
+	for _, test := range tests {
+		if got := freshnessLifetime(test.header, 5*time.Second); got != test.expected {
+			t.Errorf("freshnessLifetime(%v): expected %v, got %v", test.header, test.expected, got)
+		}
+	}
+}
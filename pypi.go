@@ -0,0 +1,314 @@
+package main
+
+import (
+	"errors"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// pypiExtensions extensões de distribuições (wheels e sdists)
+var pypiExtensions = []string{".whl", ".tar.gz", ".zip", ".tar.bz2", ".tgz"}
+
+// pypiSeparators sequências de separadores trocadas por "-" na normalização (PEP 503)
+var pypiSeparators = regexp.MustCompile(`[-_.]+`)
+
+// PyPI índice "simple" (PEP 503) gerado a partir de um diretório de wheels e
+// sdists, para o pip usar o qserv como repositório privado
+type PyPI struct {
+	config *PyPIConfig
+	root   func() string // raiz servida, para dir relativo
+	index  *RootIndex    // hashes já calculados pelo índice da raiz (opcional)
+
+	mu     sync.Mutex
+	hashes map[string]pypiHash // caminho no disco -> sha256
+}
+
+// pypiHash hash de uma distribuição, válido enquanto tamanho e mtime não mudam
+type pypiHash struct {
+	size    int64
+	modTime time.Time
+	sum     string
+}
+
+// pypiFile distribuição encontrada no diretório
+type pypiFile struct {
+	Name   string
+	Path   string
+	SHA256 string
+}
+
+// NewPyPI cria o índice simple
+func NewPyPI(config *PyPIConfig) (*PyPI, error) {
+	if config.Dir == "" {
+		return nil, errors.New("pypi: dir is required")
+	}
+	if !strings.HasPrefix(config.prefix(), "/") {
+		return nil, errors.New("pypi: prefix must start with /")
+	}
+	return &PyPI{config: config, hashes: make(map[string]pypiHash)}, nil
+}
+
+// prefix retorna o prefixo do índice (default: /simple/)
+func (c *PyPIConfig) prefix() string {
+	if c.Prefix == "" {
+		return "/simple/"
+	}
+	return strings.TrimSuffix(c.Prefix, "/") + "/"
+}
+
+// dir retorna o diretório das distribuições (relativo à raiz servida)
+func (p *PyPI) dir() string {
+	if filepath.IsAbs(p.config.Dir) {
+		return p.config.Dir
+	}
+	return filepath.Join(p.root(), p.config.Dir)
+}
+
+// normalizeProject normaliza o nome do projeto (PEP 503)
+func normalizeProject(name string) string {
+	return strings.ToLower(pypiSeparators.ReplaceAllString(name, "-"))
+}
+
+// distProject extrai o nome normalizado do projeto do nome do arquivo
+// (wheel: nome-versão-...-plataforma.whl; sdist: nome-versão.tar.gz)
+func distProject(filename string) (string, bool) {
+	ext := ""
+	for _, e := range pypiExtensions {
+		if strings.HasSuffix(strings.ToLower(filename), e) {
+			ext = e
+			break
+		}
+	}
+	if ext == "" || strings.HasPrefix(filename, ".") {
+		return "", false
+	}
+	stem := filename[:len(filename)-len(ext)]
+	if ext == ".whl" {
+		name, _, ok := strings.Cut(stem, "-")
+		return normalizeProject(name), ok && name != ""
+	}
+	// sdist: o nome termina no último "-" seguido da versão
+	for i := len(stem) - 1; i > 0; i-- {
+		if stem[i] == '-' && i+1 < len(stem) && stem[i+1] >= '0' && stem[i+1] <= '9' {
+			return normalizeProject(stem[:i]), true
+		}
+	}
+	return "", false
+}
+
+// projects agrupa as distribuições do diretório por projeto
+func (p *PyPI) projects() (map[string][]pypiFile, error) {
+	base := p.dir()
+	projects := make(map[string][]pypiFile)
+	seen := make(map[string]bool)
+	err := filepath.WalkDir(base, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == base {
+				return err
+			}
+			return nil
+		}
+		if d.IsDir() {
+			if path != base && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		name := d.Name()
+		project, ok := distProject(name)
+		if !ok || !d.Type().IsRegular() || seen[name] {
+			return nil
+		}
+		seen[name] = true
+		projects[project] = append(projects[project], pypiFile{Name: name, Path: path})
+		return nil
+	})
+	return projects, err
+}
+
+// hash retorna o SHA-256 da distribuição, recalculado só quando ela muda
+func (p *PyPI) hash(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	p.mu.Lock()
+	cached, ok := p.hashes[path]
+	p.mu.Unlock()
+	if ok && cached.size == info.Size() && cached.modTime.Equal(info.ModTime()) {
+		return cached.sum, nil
+	}
+	sum := ""
+	if p.index != nil {
+		if entry, ok := p.index.Lookup(path, info); ok {
+			sum = entry.SHA256
+		}
+	}
+	if sum == "" {
+		if sum, err = hashFile(path); err != nil {
+			return "", err
+		}
+	}
+
+	p.mu.Lock()
+	if len(p.hashes) >= maxETagHashes {
+		clear(p.hashes)
+	}
+	p.hashes[path] = pypiHash{size: info.Size(), modTime: info.ModTime(), sum: sum}
+	p.mu.Unlock()
+	return sum, nil
+}
+
+// handlePyPI atende <prefixo> (projetos), <prefixo><projeto>/ (arquivos com
+// #sha256=) e <prefixo><projeto>/<arquivo> (download)
+func (s *Server) handlePyPI(w http.ResponseWriter, r *http.Request) {
+	debugNote(r, "serve", "pypi")
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		s.serveError(w, r, http.StatusMethodNotAllowed)
+		return
+	}
+	prefix := s.pypi.config.prefix()
+	projects, err := s.pypi.projects()
+	if err != nil {
+		s.logger.Error("PyPI: %v", err)
+		s.serveError(w, r, http.StatusInternalServerError)
+		return
+	}
+	if s.visiblePyPI(r, projects) {
+		// O índice depende de quem pede
+		w.Header().Set("Cache-Control", "private")
+	}
+
+	rest := strings.TrimPrefix(r.URL.Path, prefix)
+	if rest == "" {
+		names := make([]string, 0, len(projects))
+		for name := range projects {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		s.renderPyPI(w, r, "Simple index", prefix, names, nil)
+		return
+	}
+
+	project, file, _ := strings.Cut(rest, "/")
+	if normalized := normalizeProject(project); normalized != project || (file == "" && !strings.HasSuffix(rest, "/")) {
+		// URLs canônicas: nome normalizado e barra no fim
+		http.Redirect(w, r, prefix+normalized+"/"+file, http.StatusMovedPermanently)
+		return
+	}
+	files, ok := projects[project]
+	if !ok {
+		s.serveError(w, r, http.StatusNotFound)
+		return
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+
+	if file == "" {
+		for i := range files {
+			if files[i].SHA256, err = s.pypi.hash(files[i].Path); err != nil {
+				s.logger.Error("PyPI: hashing %s: %v", files[i].Path, err)
+			}
+		}
+		s.renderPyPI(w, r, "Links for "+project, prefix+project+"/", nil, files)
+		return
+	}
+
+	for _, f := range files {
+		if f.Name == file {
+			s.servePyPIFile(w, r, f)
+			return
+		}
+	}
+	s.serveError(w, r, http.StatusNotFound)
+}
+
+// visiblePyPI descarta as distribuições que a rota de arquivos não serviria
+// a quem pede (ocultas, ou recusadas pelas regras por caminho) e os projetos
+// que ficarem vazios. Retorna se alguma regra cobre as distribuições
+func (s *Server) visiblePyPI(r *http.Request, projects map[string][]pypiFile) (protected bool) {
+	root := s.RootDir()
+	for project, files := range projects {
+		visible := files[:0]
+		for _, f := range files {
+			status, covered := s.fileAccess(r, root, f.Path)
+			protected = protected || covered
+			if status == 0 {
+				visible = append(visible, f)
+			}
+		}
+		if len(visible) == 0 {
+			delete(projects, project)
+		} else {
+			projects[project] = visible
+		}
+	}
+	return protected
+}
+
+// servePyPIFile serve a distribuição com os bytes exatos (o pip confere o hash)
+func (s *Server) servePyPIFile(w http.ResponseWriter, r *http.Request, file pypiFile) {
+	f, err := os.Open(file.Path)
+	if err != nil {
+		s.serveError(w, r, http.StatusNotFound)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		s.serveError(w, r, http.StatusNotFound)
+		return
+	}
+	if strings.HasSuffix(file.Name, ".whl") {
+		w.Header().Set("Content-Type", "application/zip")
+	}
+	skipCompression(w)
+	http.ServeContent(w, r, file.Name, info.ModTime(), f)
+}
+
+// renderPyPI escreve uma página do índice simple
+func (s *Server) renderPyPI(w http.ResponseWriter, r *http.Request, title, base string, projects []string, files []pypiFile) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if w.Header().Get("Cache-Control") == "" {
+		w.Header().Set("Cache-Control", "no-cache")
+	}
+	if r.Method == http.MethodHead {
+		return
+	}
+	err := pypiTemplate.Execute(w, struct {
+		Title    string
+		Base     string
+		Projects []string
+		Files    []pypiFile
+	}{title, base, projects, files})
+	if err != nil {
+		s.logger.Error("Error rendering PyPI index: %v", err)
+	}
+}
+
+// pypiTemplate páginas do índice simple (PEP 503)
+var pypiTemplate = template.Must(template.New("pypi").Parse(`<!DOCTYPE html>
+<html>
+<head>
+    <meta name="pypi:repository-version" content="1.0">
+    <title>{{.Title}}</title>
+</head>
+<body>
+    <h1>{{.Title}}</h1>
+{{- range .Projects}}
+    <a href="{{$.Base}}{{.}}/">{{.}}</a><br>
+{{- end}}
+{{- range .Files}}
+    <a href="{{$.Base}}{{.Name}}{{with .SHA256}}#sha256={{.}}{{end}}">{{.Name}}</a><br>
+{{- end}}
+</body>
+</html>
+`))
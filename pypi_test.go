@@ -0,0 +1,130 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newPyPITestServer(t *testing.T) *Server {
+	t.Helper()
+	root := t.TempDir()
+	writeTestFile(t, filepath.Join(root, "packages", "My_Package-1.0.0-py3-none-any.whl"), "wheel")
+	writeTestFile(t, filepath.Join(root, "packages", "old", "my.package-0.9.tar.gz"), "sdist")
+	writeTestFile(t, filepath.Join(root, "packages", "requests-2.31.0.tar.gz"), "requests")
+	writeTestFile(t, filepath.Join(root, "packages", "notes.txt"), "ignored")
+	return newListingTestServer(t, root, func(c *Config) {
+		c.PyPI = &PyPIConfig{Enabled: true, Dir: "packages"}
+	})
+}
+
+func TestPyPIProjectIndex(t *testing.T) {
+	server := newPyPITestServer(t)
+	w := httptest.NewRecorder()
+	server.mux.ServeHTTP(w, httptest.NewRequest("GET", "/simple/", nil))
+	body := w.Body.String()
+	if w.Code != http.StatusOK || !strings.Contains(body, `href="/simple/my-package/"`) || !strings.Contains(body, `href="/simple/requests/"`) {
+		t.Errorf("Expected normalized projects, got %d %s", w.Code, body)
+	}
+	if strings.Contains(body, "notes") {
+		t.Errorf("Expected non-distribution files to be ignored")
+	}
+}
+
+func TestPyPIProjectPage(t *testing.T) {
+	server := newPyPITestServer(t)
+	w := httptest.NewRecorder()
+	server.mux.ServeHTTP(w, httptest.NewRequest("GET", "/simple/my-package/", nil))
+	sum := sha256.Sum256([]byte("wheel"))
+	want := `href="/simple/my-package/My_Package-1.0.0-py3-none-any.whl#sha256=` + hex.EncodeToString(sum[:]) + `"`
+	if !strings.Contains(w.Body.String(), want) || !strings.Contains(w.Body.String(), "my.package-0.9.tar.gz") {
+		t.Errorf("Expected both distributions with hashes, got %s", w.Body.String())
+	}
+
+	// Non-normalized names and missing slashes redirect
+	for path, location := range map[string]string{
+		"/simple/My_Package/": "/simple/my-package/",
+		"/simple/my-package":  "/simple/my-package/",
+	} {
+		w := httptest.NewRecorder()
+		server.mux.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != location {
+			t.Errorf("Expected %s to redirect to %s, got %d %q", path, location, w.Code, w.Header().Get("Location"))
+		}
+	}
+}
+
+func TestPyPIDownload(t *testing.T) {
+	server := newPyPITestServer(t)
+	w := httptest.NewRecorder()
+	server.mux.ServeHTTP(w, httptest.NewRequest("GET", "/simple/my-package/my.package-0.9.tar.gz", nil))
+	if w.Code != http.StatusOK || w.Body.String() != "sdist" {
+		t.Errorf("Expected sdist download, got %d %q", w.Code, w.Body.String())
+	}
+	for _, path := range []string{"/simple/requests/My_Package-1.0.0-py3-none-any.whl", "/simple/unknown/"} {
+		w := httptest.NewRecorder()
+		server.mux.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if w.Code != http.StatusNotFound {
+			t.Errorf("Expected 404 for %s, got %d", path, w.Code)
+		}
+	}
+}
+
+func TestDistProject(t *testing.T) {
+	tests := map[string]string{
+		"numpy-1.26.0-cp312-cp312-manylinux_2_17_x86_64.whl": "numpy",
+		"zope.interface-6.0.tar.gz":                          "zope-interface",
+		"python-dateutil-2.8.2.tar.gz":                       "python-dateutil",
+		"Django-4.2.zip":                                     "django",
+	}
+	for name, want := range tests {
+		if got, ok := distProject(name); !ok || got != want {
+			t.Errorf("distProject(%s) = %q, expected %q", name, got, want)
+		}
+	}
+	if _, ok := distProject("README.md"); ok {
+		t.Errorf("Expected README.md not to be a distribution")
+	}
+}
+
+func TestPyPIAppliesPathRules(t *testing.T) {
+	root := t.TempDir()
+	writeTestFile(t, filepath.Join(root, "packages", "requests-2.31.0.tar.gz"), "requests")
+	writeTestFile(t, filepath.Join(root, "packages", "internal", "secret_pkg-1.0.tar.gz"), "secret")
+	server := newListingTestServer(t, root, func(c *Config) {
+		c.PyPI = &PyPIConfig{Enabled: true, Dir: "packages"}
+		c.Security.ProxyAuth = &ProxyAuthConfig{
+			Enabled:        true,
+			TrustedProxies: []string{"192.0.2.1"},
+			ACL:            []ProxyACLRule{{Path: "/packages/internal/**", Groups: []string{"admins"}}},
+		}
+	})
+	get := func(target string, groups string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", target, nil)
+		if groups != "" {
+			req.Header.Set("Remote-User", "alice")
+			req.Header.Set("Remote-Groups", groups)
+		}
+		w := httptest.NewRecorder()
+		server.mux.ServeHTTP(w, req)
+		return w
+	}
+
+	w := get("/simple/", "")
+	if strings.Contains(w.Body.String(), "secret-pkg") || !strings.Contains(w.Body.String(), "requests") {
+		t.Errorf("Expected protected project to be hidden, got %s", w.Body.String())
+	}
+	if cc := w.Header().Get("Cache-Control"); cc != "private" {
+		t.Errorf("Expected private index, got %q", cc)
+	}
+	if w := get("/simple/secret-pkg/secret_pkg-1.0.tar.gz", ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for protected distribution, got %d", w.Code)
+	}
+	if w := get("/simple/secret-pkg/secret_pkg-1.0.tar.gz", "admins"); w.Code != http.StatusOK || w.Body.String() != "secret" {
+		t.Errorf("Expected admins to download, got %d %q", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// quotaRescanInterval idade máxima do uso calculado antes de varrer de novo
+const quotaRescanInterval = time.Minute
+
+// QuotaUsage uso atual de uma quota
+type QuotaUsage struct {
+	Prefix    string    `json:"prefix"`
+	Bytes     int64     `json:"bytes"`
+	Files     int       `json:"files"`
+	MaxBytes  int64     `json:"max_bytes,omitempty"`
+	MaxFiles  int       `json:"max_files,omitempty"`
+	ScannedAt time.Time `json:"scanned_at"`
+}
+
+// QuotaError escrita recusada por exceder a quota (507 Insufficient Storage)
+type QuotaError struct {
+	Prefix string
+	Limit  string
+}
+
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("quota exceeded for %s: %s", e.Prefix, e.Limit)
+}
+
+// Quotas limita o espaço e o número de arquivos sob prefixos da raiz. O uso
+// é calculado por varredura e atualizado a cada escrita registrada.
+type Quotas struct {
+	rules []QuotaRule // prefixos mais longos primeiro
+
+	mu    sync.Mutex
+	usage map[string]*QuotaUsage // prefixo -> uso
+	root  string                 // raiz da última varredura
+}
+
+// NewQuotas valida as regras e cria o controle de quotas
+func NewQuotas(rules []QuotaRule) (*Quotas, error) {
+	for i, rule := range rules {
+		if !strings.HasPrefix(rule.Prefix, "/") {
+			return nil, fmt.Errorf("quotas[%d]: prefix must start with /", i)
+		}
+		if rule.MaxBytes <= 0 && rule.MaxFiles <= 0 {
+			return nil, fmt.Errorf("quotas[%d]: max_bytes or max_files is required", i)
+		}
+	}
+	sorted := append([]QuotaRule(nil), rules...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return len(sorted[i].Prefix) > len(sorted[j].Prefix)
+	})
+	return &Quotas{rules: sorted, usage: make(map[string]*QuotaUsage)}, nil
+}
+
+// matches informa se a regra cobre o caminho
+func (rule QuotaRule) matches(urlPath string) bool {
+	prefix := strings.TrimSuffix(rule.Prefix, "/")
+	return urlPath == prefix || strings.HasPrefix(urlPath, prefix+"/") || prefix == ""
+}
+
+// current retorna o uso da regra, varrendo o disco se estiver desatualizado;
+// deve ser chamado com q.mu travado
+func (q *Quotas) current(root string, rule QuotaRule) *QuotaUsage {
+	u, ok := q.usage[rule.Prefix]
+	if ok && q.root == root && time.Since(u.ScannedAt) < quotaRescanInterval {
+		return u
+	}
+	if q.root != root {
+		clear(q.usage)
+		q.root = root
+	}
+
+	u = &QuotaUsage{Prefix: rule.Prefix, MaxBytes: rule.MaxBytes, MaxFiles: rule.MaxFiles, ScannedAt: time.Now()}
+	dir := filepath.Join(root, filepath.FromSlash(strings.TrimPrefix(rule.Prefix, "/")))
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return nil
+		}
+		if info, err := d.Info(); err == nil {
+			u.Bytes += info.Size()
+			u.Files++
+		}
+		return nil
+	})
+	q.usage[rule.Prefix] = u
+	return u
+}
+
+// Check verifica se uma escrita de size bytes em urlPath cabe nas quotas que
+// a cobrem; replaced é o tamanho do arquivo sobrescrito (-1 se for novo)
+func (q *Quotas) Check(root, urlPath string, size, replaced int64) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for _, rule := range q.rules {
+		if !rule.matches(urlPath) {
+			continue
+		}
+		u := q.current(root, rule)
+		bytes, files := u.Bytes+size, u.Files+1
+		if replaced >= 0 {
+			bytes -= replaced
+			files--
+		}
+		if rule.MaxBytes > 0 && bytes > rule.MaxBytes {
+			return &QuotaError{Prefix: rule.Prefix, Limit: fmt.Sprintf("%s of %s used", formatSize(u.Bytes), formatSize(rule.MaxBytes))}
+		}
+		if rule.MaxFiles > 0 && files > rule.MaxFiles {
+			return &QuotaError{Prefix: rule.Prefix, Limit: fmt.Sprintf("%d of %d files", u.Files, rule.MaxFiles)}
+		}
+	}
+	return nil
+}
+
+// Remaining retorna quantos bytes ainda cabem em urlPath nas quotas que o
+// cobrem, contando os replaced bytes sobrescritos (-1 se for novo); -1 se
+// nenhuma limita bytes
+func (q *Quotas) Remaining(root, urlPath string, replaced int64) int64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	remaining := int64(-1)
+	for _, rule := range q.rules {
+		if rule.MaxBytes <= 0 || !rule.matches(urlPath) {
+			continue
+		}
+		left := rule.MaxBytes - q.current(root, rule).Bytes
+		if replaced > 0 {
+			left += replaced
+		}
+		if left < 0 {
+			left = 0
+		}
+		if remaining < 0 || left < remaining {
+			remaining = left
+		}
+	}
+	return remaining
+}
+
+// Record atualiza o uso após uma escrita ou remoção concluída
+func (q *Quotas) Record(urlPath string, deltaBytes int64, deltaFiles int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, rule := range q.rules {
+		if u, ok := q.usage[rule.Prefix]; ok && rule.matches(urlPath) {
+			u.Bytes += deltaBytes
+			u.Files += deltaFiles
+		}
+	}
+}
+
+// Report retorna o uso de todas as quotas
+func (q *Quotas) Report(root string) []QuotaUsage {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	report := make([]QuotaUsage, 0, len(q.rules))
+	for _, rule := range q.rules {
+		report = append(report, *q.current(root, rule))
+	}
+	sort.Slice(report, func(i, j int) bool { return report[i].Prefix < report[j].Prefix })
+	return report
+}
+
+// handleAdminQuotas informa o uso atual das quotas
+func (s *Server) handleAdminQuotas(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{"quotas": s.quotas.Report(s.RootDir())})
+}
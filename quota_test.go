@@ -0,0 +1,51 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestQuotas(t *testing.T) {
+	root := t.TempDir()
+	writeTestFile(t, filepath.Join(root, "tenants", "acme", "a.bin"), strings.Repeat("x", 600))
+	writeTestFile(t, filepath.Join(root, "tenants", "other", "b.bin"), strings.Repeat("x", 900))
+
+	quotas, err := NewQuotas([]QuotaRule{
+		{Prefix: "/tenants/acme/", MaxBytes: 1000},
+		{Prefix: "/tenants/", MaxFiles: 3},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var quotaErr *QuotaError
+	if err := quotas.Check(root, "/tenants/acme/b.bin", 300, -1); err != nil {
+		t.Errorf("Expected write within quota to be allowed, got %v", err)
+	}
+	if err := quotas.Check(root, "/tenants/acme/b.bin", 500, -1); !errors.As(err, &quotaErr) || quotaErr.Prefix != "/tenants/acme/" {
+		t.Errorf("Expected byte quota error for /tenants/acme/, got %v", err)
+	}
+	// Overwriting a file only counts the difference
+	if err := quotas.Check(root, "/tenants/acme/a.bin", 900, 600); err != nil {
+		t.Errorf("Expected overwrite within quota to be allowed, got %v", err)
+	}
+
+	// Recorded writes count without rescanning
+	os.WriteFile(filepath.Join(root, "tenants", "other", "c.bin"), nil, 0644)
+	quotas.Record("/tenants/other/c.bin", 0, 1)
+	if err := quotas.Check(root, "/tenants/other/d.bin", 1, -1); !errors.As(err, &quotaErr) || quotaErr.Prefix != "/tenants/" {
+		t.Errorf("Expected file count quota error for /tenants/, got %v", err)
+	}
+
+	report := quotas.Report(root)
+	if len(report) != 2 || report[0].Prefix != "/tenants/" || report[0].Files != 3 || report[1].Bytes != 600 {
+		t.Errorf("Unexpected usage report: %+v", report)
+	}
+
+	if _, err := NewQuotas([]QuotaRule{{Prefix: "/a/"}}); err == nil {
+		t.Errorf("Expected error for quota without limits")
+	}
+}
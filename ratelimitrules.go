@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RateLimitRules cotas token bucket por caminho, além da cota por IP: cada
+// regra tem buckets próprios (por IP, por usuário autenticado ou um só,
+// global) e todas as regras que casam com a requisição consomem um token.
+// Os buckets ficam no RateLimiter, que sobrevive às recargas e usa o backend
+// compartilhado (cluster ou Redis) quando houver
+type RateLimitRules struct {
+	rules   []RateLimitRule
+	limiter *RateLimiter
+}
+
+// NewRateLimitRules valida as regras; limiter guarda os buckets (nil: um
+// limiter próprio, só local)
+func NewRateLimitRules(rules []RateLimitRule, limiter *RateLimiter) (*RateLimitRules, error) {
+	for i, rule := range rules {
+		switch rule.Key {
+		case "", "ip", "user", "global":
+		default:
+			return nil, fmt.Errorf("rate limit rule %d: unknown key %q (use ip, user or global)", i, rule.Key)
+		}
+		if rule.Requests <= 0 {
+			return nil, fmt.Errorf("rate limit rule %d: requests must be positive", i)
+		}
+		if rule.Burst < 0 {
+			return nil, fmt.Errorf("rate limit rule %d: burst must not be negative", i)
+		}
+	}
+	if limiter == nil {
+		limiter = NewRateLimiter(&RateLimitConfig{})
+	}
+	return &RateLimitRules{rules: rules, limiter: limiter}, nil
+}
+
+// matches informa se a regra vale para o caminho
+func (rule RateLimitRule) matches(urlPath string) bool {
+	if len(rule.Paths) == 0 {
+		return true
+	}
+	for _, pattern := range rule.Paths {
+		if matchGlob(pattern, urlPath) {
+			return true
+		}
+	}
+	return false
+}
+
+// burst capacidade do bucket (burst ou, se ausente, requests)
+func (rule RateLimitRule) burst() int {
+	if rule.Burst > 0 {
+		return rule.Burst
+	}
+	return rule.Requests
+}
+
+// key retorna o bucket da requisição na regra; anônimos em regras por
+// usuário contam pelo IP. A regra entra pelo conteúdo, não pela posição:
+// uma recarga que mantém a regra mantém os buckets
+func (rule RateLimitRule) key(r *http.Request) string {
+	prefix := "rule:" + strings.Join(rule.Paths, ",") + "|" + rule.Key + "|" + rule.policy() + "|"
+	switch rule.Key {
+	case "global":
+		return prefix + "*"
+	case "user":
+		if user := requestUserName(r); user != "" {
+			return prefix + "user:" + user
+		}
+	}
+	ip, _, _ := net.SplitHostPort(r.RemoteAddr)
+	return prefix + "ip:" + ip
+}
+
+// policy descreve a regra no formato de RateLimit-Policy
+func (rule RateLimitRule) policy() string {
+	return fmt.Sprintf("%d;w=60;burst=%d", rule.Requests, rule.burst())
+}
+
+// take consome um token de cada regra que casa com a requisição e retorna o
+// estado mais restritivo (a primeira regra esgotada ou a de menor sobra)
+func (rl *RateLimitRules) take(r *http.Request) (rateLimitStatus, []string, bool) {
+	var result rateLimitStatus
+	var policies []string
+	matched := false
+	for _, rule := range rl.rules {
+		if !rule.matches(r.URL.Path) {
+			continue
+		}
+		status := rl.limiter.takeBucket(rule.key(r), rule.burst(), time.Minute/time.Duration(rule.Requests))
+
+		policies = append(policies, rule.policy())
+		switch {
+		case !matched:
+			result = status
+		case result.allowed && !status.allowed:
+			result = status
+		case result.allowed == status.allowed && status.remaining < result.remaining:
+			result = status
+		}
+		matched = true
+	}
+	return result, policies, matched
+}
+
+// RateLimitRulesMiddleware aplica as regras por caminho; fica depois da
+// autenticação para que as regras por usuário conheçam o usuário
+func RateLimitRulesMiddleware(rules *RateLimitRules) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if challengePassed(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			status, policies, matched := rules.take(r)
+			if !matched {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// A cota por IP já pode ter escrito os headers: prevalece a mais
+			// restritiva e RateLimit-Policy lista todas
+			h := w.Header()
+			if remaining, err := strconv.Atoi(h.Get("RateLimit-Remaining")); err != nil || !status.allowed || status.remaining < remaining {
+				h.Set("RateLimit-Limit", strconv.Itoa(status.limit))
+				h.Set("RateLimit-Remaining", strconv.Itoa(status.remaining))
+				h.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(status.reset)))
+			}
+			if existing := h.Get("RateLimit-Policy"); existing != "" {
+				policies = append([]string{existing}, policies...)
+			}
+			h.Set("RateLimit-Policy", strings.Join(policies, ", "))
+
+			if !status.allowed {
+				h.Set("Retry-After", strconv.Itoa(ceilSeconds(status.retryAfter)))
+				http.Error(w, "429 Too Many Requests", http.StatusTooManyRequests)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRateLimitRules(t *testing.T) {
+	rules, err := NewRateLimitRules([]RateLimitRule{
+		{Paths: []string{"/downloads/**"}, Requests: 1},
+		{Paths: []string{"/api/**"}, Key: "user", Requests: 60, Burst: 2},
+		{Paths: []string{"/search"}, Key: "global", Requests: 60, Burst: 1},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger, _ := NewLogger(&LoggingConfig{Enabled: false})
+	// Stand-in for the auth middlewares, which record the user for the access log
+	identify := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			setRequestUser(r, r.Header.Get("X-Test-User"))
+			next.ServeHTTP(w, r)
+		})
+	}
+	handler := Chain(testHandler(), LoggingMiddleware(logger), identify, RateLimitRulesMiddleware(rules))
+
+	get := func(target, ip, user string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", target, nil)
+		req.RemoteAddr = ip + ":1234"
+		req.Header.Set("X-Test-User", user)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	// Per-IP rule on /downloads only
+	if w := get("/downloads/a.iso", "192.0.2.1", ""); w.Code != http.StatusOK || w.Header().Get("RateLimit-Policy") != "1;w=60;burst=1" {
+		t.Errorf("Expected first download to pass with policy, got %d %q", w.Code, w.Header().Get("RateLimit-Policy"))
+	}
+	w := get("/downloads/b.iso", "192.0.2.1", "")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" || w.Header().Get("RateLimit-Remaining") != "0" {
+		t.Errorf("Expected 429 with Retry-After, got %d %v", w.Code, w.Header())
+	}
+	if w := get("/downloads/b.iso", "192.0.2.2", ""); w.Code != http.StatusOK {
+		t.Errorf("Expected another IP to have its own bucket, got %d", w.Code)
+	}
+	if w := get("/index.html", "192.0.2.1", ""); w.Code != http.StatusOK || w.Header().Get("RateLimit-Policy") != "" {
+		t.Errorf("Expected unmatched path to be untouched, got %d %q", w.Code, w.Header().Get("RateLimit-Policy"))
+	}
+
+	// Per-user rule follows the user across addresses
+	get("/api/items", "192.0.2.1", "alice")
+	get("/api/items", "192.0.2.2", "alice")
+	if w := get("/api/items", "192.0.2.3", "alice"); w.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected alice to be limited across IPs, got %d", w.Code)
+	}
+	if w := get("/api/items", "192.0.2.3", "bob"); w.Code != http.StatusOK {
+		t.Errorf("Expected bob to have his own bucket, got %d", w.Code)
+	}
+
+	// Global rule is shared by everyone
+	get("/search", "192.0.2.1", "")
+	if w := get("/search", "192.0.2.9", ""); w.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected global bucket to be shared, got %d", w.Code)
+	}
+}
+
+func TestRateLimitRulesWithPerIPLimit(t *testing.T) {
+	rules, _ := NewRateLimitRules([]RateLimitRule{{Paths: []string{"/downloads/**"}, Requests: 2}}, nil)
+	limiter := NewRateLimiter(&RateLimitConfig{Enabled: true, RequestsPerIP: 100})
+	handler := Chain(testHandler(), RateLimitMiddleware(limiter), RateLimitRulesMiddleware(rules))
+
+	req := httptest.NewRequest("GET", "/downloads/a.iso", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	// The stricter rule wins and both policies are listed
+	if w.Header().Get("RateLimit-Limit") != "2" || w.Header().Get("RateLimit-Remaining") != "1" {
+		t.Errorf("Expected the stricter quota in the headers, got %q %q", w.Header().Get("RateLimit-Limit"), w.Header().Get("RateLimit-Remaining"))
+	}
+	if w.Header().Get("RateLimit-Policy") != "100;w=60;burst=100, 2;w=60;burst=2" {
+		t.Errorf("Unexpected RateLimit-Policy: %q", w.Header().Get("RateLimit-Policy"))
+	}
+}
+
+func TestNewRateLimitRulesErrors(t *testing.T) {
+	for _, rule := range []RateLimitRule{
+		{Requests: 0},
+		{Requests: 10, Key: "session"},
+		{Requests: 10, Burst: -1},
+	} {
+		if _, err := NewRateLimitRules([]RateLimitRule{rule}, nil); err == nil {
+			t.Errorf("Expected error for %+v", rule)
+		}
+	}
+}
+
+func TestRateLimitRulesSurviveReload(t *testing.T) {
+	limiter := NewRateLimiter(&RateLimitConfig{})
+	config := []RateLimitRule{{Paths: []string{"/downloads/**"}, Requests: 1}}
+	get := func(rules *RateLimitRules) int {
+		w := httptest.NewRecorder()
+		Chain(testHandler(), RateLimitRulesMiddleware(rules)).ServeHTTP(w, httptest.NewRequest("GET", "/downloads/a.iso", nil))
+		return w.Code
+	}
+
+	before, _ := NewRateLimitRules(config, limiter)
+	if code := get(before); code != http.StatusOK {
+		t.Fatalf("Expected first download to pass, got %d", code)
+	}
+	// A reload builds new rules; the same rule keeps its bucket
+	after, _ := NewRateLimitRules(append([]RateLimitRule{{Paths: []string{"/api/**"}, Requests: 10}}, config...), limiter)
+	if code := get(after); code != http.StatusTooManyRequests {
+		t.Errorf("Expected the bucket to survive the reload, got %d", code)
+	}
+}
+
+// fakeRateBackend records the buckets asked of a shared backend
+type fakeRateBackend struct {
+	keys []string
+}
+
+func (b *fakeRateBackend) allow(key string, limit int, interval time.Duration) (rateLimitStatus, error) {
+	b.keys = append(b.keys, key)
+	return rateLimitStatus{allowed: false, limit: limit, retryAfter: interval}, nil
+}
+
+func TestRateLimitRulesUseSharedBackend(t *testing.T) {
+	backend := &fakeRateBackend{}
+	limiter := NewRateLimiter(&RateLimitConfig{})
+	limiter.backend = backend
+	rules, _ := NewRateLimitRules([]RateLimitRule{{Paths: []string{"/downloads/**"}, Requests: 30, Burst: 5}}, limiter)
+
+	w := httptest.NewRecorder()
+	Chain(testHandler(), RateLimitRulesMiddleware(rules)).ServeHTTP(w, httptest.NewRequest("GET", "/downloads/a.iso", nil))
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "2" {
+		t.Errorf("Expected the backend decision with a 2s Retry-After, got %d %q", w.Code, w.Header().Get("Retry-After"))
+	}
+	if len(backend.keys) != 1 || !strings.HasSuffix(backend.keys[0], "|ip:192.0.2.1") {
+		t.Errorf("Expected one per-IP bucket in the backend, got %v", backend.keys)
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"runtime/debug"
+	"sync/atomic"
+)
+
+// requestIDPattern IDs aceitos do header X-Request-ID (ex: vindos do proxy)
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// PanicStats contagem de panics recuperados
+type PanicStats struct {
+	total atomic.Int64
+}
+
+// WriteMetrics escreve as métricas no formato Prometheus
+func (p *PanicStats) WriteMetrics(w io.Writer) {
+	writeMetric(w, "qserv_panics_total", "Handler panics recovered.", "counter",
+		[]metricSample{{value: float64(p.total.Load())}})
+}
+
+// requestID retorna o X-Request-ID da requisição, se válido, ou um novo
+func requestID(r *http.Request) string {
+	if id := r.Header.Get("X-Request-ID"); requestIDPattern.MatchString(id) {
+		return id
+	}
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// panicEvent registro estruturado de um panic
+type panicEvent struct {
+	Event     string `json:"event"`
+	RequestID string `json:"request_id"`
+	Method    string `json:"method"`
+	Path      string `json:"path"`
+	Remote    string `json:"remote"`
+	Error     string `json:"error"`
+	Stack     string `json:"stack"`
+}
+
+// headerTracker registra se a resposta já começou a ser enviada
+type headerTracker struct {
+	http.ResponseWriter
+	wroteHeader bool
+}
+
+func (t *headerTracker) WriteHeader(code int) {
+	t.wroteHeader = true
+	t.ResponseWriter.WriteHeader(code)
+}
+
+func (t *headerTracker) Write(b []byte) (int, error) {
+	t.wroteHeader = true
+	return t.ResponseWriter.Write(b)
+}
+
+// Unwrap permite ao http.ResponseController acessar o writer original
+func (t *headerTracker) Unwrap() http.ResponseWriter {
+	return t.ResponseWriter
+}
+
+// RecoveryMiddleware converte panics em 500 com o ID da requisição e registra
+// o stack trace como evento JSON. Se a resposta já tinha começado, a conexão
+// é abortada para que o cliente não receba um corpo truncado como completo.
+func RecoveryMiddleware(stats *PanicStats, logger *Logger) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			tracker := &headerTracker{ResponseWriter: w}
+			defer func() {
+				err := recover()
+				if err == nil {
+					return
+				}
+				if err == http.ErrAbortHandler {
+					// Aborto intencional (ex: proxy reverso): não é um erro
+					panic(err)
+				}
+
+				stats.total.Add(1)
+				id := requestID(r)
+				event, _ := json.Marshal(panicEvent{
+					Event:     "panic",
+					RequestID: id,
+					Method:    r.Method,
+					Path:      r.URL.Path,
+					Remote:    r.RemoteAddr,
+					Error:     fmt.Sprint(err),
+					Stack:     string(debug.Stack()),
+				})
+				logger.Error("%s", event)
+
+				if tracker.wroteHeader {
+					panic(http.ErrAbortHandler)
+				}
+				w.Header().Del("Content-Encoding")
+				w.Header().Set("X-Request-ID", id)
+				w.Header().Set("Cache-Control", "no-store")
+				http.Error(w, "Internal Server Error (request ID "+id+")", http.StatusInternalServerError)
+			}()
+			next.ServeHTTP(tracker, r)
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRecoveryMiddleware(t *testing.T) {
+	logger, _ := NewLogger(&LoggingConfig{Enabled: false})
+	stats := &PanicStats{}
+	handler := RecoveryMiddleware(stats, logger)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/partial" {
+			w.Write([]byte("partial"))
+		}
+		panic("boom")
+	}))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("X-Request-ID", "abc-123")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("Expected 500, got %d", w.Code)
+	}
+	if id := w.Header().Get("X-Request-ID"); id != "abc-123" {
+		t.Errorf("Expected request ID abc-123, got %q", id)
+	}
+	if !strings.Contains(w.Body.String(), "abc-123") {
+		t.Errorf("Expected request ID in body, got %q", w.Body.String())
+	}
+
+	// Invalid incoming IDs are replaced
+	req = httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("X-Request-ID", "bad id\n")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if id := w.Header().Get("X-Request-ID"); len(id) != 16 {
+		t.Errorf("Expected generated request ID, got %q", id)
+	}
+
+	// Once the response started, the connection is aborted instead
+	func() {
+		defer func() {
+			if err := recover(); err != http.ErrAbortHandler {
+				t.Errorf("Expected http.ErrAbortHandler, got %v", err)
+			}
+		}()
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/partial", nil))
+	}()
+
+	if got := stats.total.Load(); got != 3 {
+		t.Errorf("Expected 3 recovered panics, got %d", got)
+	}
+	var metrics strings.Builder
+	stats.WriteMetrics(&metrics)
+	if !strings.Contains(metrics.String(), "qserv_panics_total 3") {
+		t.Errorf("Expected panic counter in metrics, got %q", metrics.String())
+	}
+}
@@ -0,0 +1,369 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// redisMaxIdle conexões ociosas mantidas com o Redis
+const redisMaxIdle = 8
+
+// redisError erro respondido pelo servidor (ex: NOSCRIPT)
+type redisError string
+
+func (e redisError) Error() string { return string(e) }
+
+// redisClient cliente RESP mínimo (comandos simples, sem pub/sub)
+type redisClient struct {
+	addr     string
+	tls      bool
+	password string
+	username string
+	db       int
+	timeout  time.Duration
+
+	mu   sync.Mutex
+	idle []*redisConn
+}
+
+type redisConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+// newRedisClient interpreta redis://[usuário:senha@]host[:porta][/db] (rediss:// para TLS)
+func newRedisClient(rawURL string, timeout time.Duration) (*redisClient, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if (u.Scheme != "redis" && u.Scheme != "rediss") || u.Host == "" {
+		return nil, fmt.Errorf("%q is not a redis:// or rediss:// URL", rawURL)
+	}
+	c := &redisClient{addr: u.Host, tls: u.Scheme == "rediss", timeout: timeout}
+	if u.Port() == "" {
+		c.addr = net.JoinHostPort(u.Hostname(), "6379")
+	}
+	if u.User != nil {
+		c.password, _ = u.User.Password()
+		c.username = u.User.Username()
+	}
+	if db := strings.Trim(u.Path, "/"); db != "" {
+		if c.db, err = strconv.Atoi(db); err != nil || c.db < 0 {
+			return nil, fmt.Errorf("invalid redis database %q", db)
+		}
+	}
+	return c, nil
+}
+
+// dial abre uma conexão autenticada e com o banco selecionado
+func (c *redisClient) dial() (*redisConn, error) {
+	dialer := &net.Dialer{Timeout: c.timeout}
+	var conn net.Conn
+	var err error
+	if c.tls {
+		host, _, _ := net.SplitHostPort(c.addr)
+		conn, err = tls.DialWithDialer(dialer, "tcp", c.addr, &tls.Config{ServerName: host})
+	} else {
+		conn, err = dialer.Dial("tcp", c.addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	rc := &redisConn{Conn: conn, r: bufio.NewReader(conn)}
+	if c.password != "" {
+		args := []string{"AUTH", c.password}
+		if c.username != "" {
+			args = []string{"AUTH", c.username, c.password}
+		}
+		if _, err := rc.do(c.timeout, args...); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	if c.db != 0 {
+		if _, err := rc.do(c.timeout, "SELECT", strconv.Itoa(c.db)); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return rc, nil
+}
+
+// Do executa um comando numa conexão do pool
+func (c *redisClient) Do(args ...string) (interface{}, error) {
+	c.mu.Lock()
+	var conn *redisConn
+	if n := len(c.idle); n > 0 {
+		conn, c.idle = c.idle[n-1], c.idle[:n-1]
+	}
+	c.mu.Unlock()
+	if conn == nil {
+		var err error
+		if conn, err = c.dial(); err != nil {
+			return nil, err
+		}
+	}
+
+	reply, err := conn.do(c.timeout, args...)
+	var serverErr redisError
+	if err != nil && !errors.As(err, &serverErr) {
+		// Erro de rede ou de protocolo: a conexão não é reaproveitada
+		conn.Close()
+		return nil, err
+	}
+	c.mu.Lock()
+	if len(c.idle) < redisMaxIdle {
+		c.idle = append(c.idle, conn)
+		conn = nil
+	}
+	c.mu.Unlock()
+	if conn != nil {
+		conn.Close()
+	}
+	return reply, err
+}
+
+// do envia um comando e lê a resposta
+func (rc *redisConn) do(timeout time.Duration, args ...string) (interface{}, error) {
+	rc.SetDeadline(time.Now().Add(timeout))
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := io.WriteString(rc.Conn, b.String()); err != nil {
+		return nil, err
+	}
+	return rc.read()
+}
+
+// read lê uma resposta RESP2: string, erro, inteiro, bulk (nil se ausente) ou array
+func (rc *redisConn) read() (interface{}, error) {
+	line, err := rc.r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, errors.New("redis: empty reply")
+	}
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, redisError(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(rc.r, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		items := make([]interface{}, n)
+		for i := range items {
+			if items[i], err = rc.read(); err != nil {
+				var serverErr redisError
+				if !errors.As(err, &serverErr) {
+					return nil, err
+				}
+				items[i] = serverErr
+			}
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("redis: unexpected reply %q", line)
+}
+
+// redisScript script Lua executado por EVALSHA (carregado com EVAL na primeira vez)
+type redisScript struct {
+	src string
+	sha string
+}
+
+func newRedisScript(src string) *redisScript {
+	sum := sha1.Sum([]byte(src))
+	return &redisScript{src: src, sha: hex.EncodeToString(sum[:])}
+}
+
+// Run executa o script
+func (s *redisScript) Run(c *redisClient, keys []string, args ...string) (interface{}, error) {
+	cmd := append([]string{"EVALSHA", s.sha, strconv.Itoa(len(keys))}, keys...)
+	reply, err := c.Do(append(cmd, args...)...)
+	if err != nil && strings.HasPrefix(err.Error(), "NOSCRIPT") {
+		cmd[0], cmd[1] = "EVAL", s.src
+		reply, err = c.Do(append(cmd, args...)...)
+	}
+	return reply, err
+}
+
+// redisRateScript o mesmo token bucket de RateLimiter.allow, com o relógio
+// do Redis (comum a todas as instâncias); retorna {permitido, tokens, ms
+// desde o último reabastecimento}
+var redisRateScript = newRedisScript(`
+local limit = tonumber(ARGV[1])
+local interval = tonumber(ARGV[2])
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+local v = redis.call('HMGET', KEYS[1], 'tokens', 'refilled')
+local tokens, refilled = tonumber(v[1]), tonumber(v[2])
+local allowed = 0
+if tokens == nil or refilled == nil then
+  tokens, refilled, allowed = limit - 1, now, 1
+else
+  local add = math.floor((now - refilled) / interval)
+  if add > 0 then
+    tokens = tokens + add
+    refilled = refilled + add * interval
+  end
+  if tokens >= limit then
+    tokens, refilled = limit, now
+  end
+  if tokens > 0 then
+    tokens, allowed = tokens - 1, 1
+  end
+end
+redis.call('HSET', KEYS[1], 'tokens', tokens, 'refilled', refilled)
+redis.call('PEXPIRE', KEYS[1], 180000)
+return {allowed, tokens, now - refilled}
+`)
+
+// RedisStore guarda as cotas de rate limit no Redis, compartilhadas por
+// réplicas sem estado; se o Redis não responde, vale o contador local
+type RedisStore struct {
+	config  *RedisConfig
+	logger  *Logger
+	client  *redisClient
+	limiter *RateLimiter
+
+	mu        sync.Mutex
+	downUntil time.Time
+	lastError string
+	requests  map[string]int64 // redis ou fallback
+}
+
+// NewRedisStore valida a URL (a conexão só é aberta no primeiro uso)
+func NewRedisStore(config *RedisConfig, logger *Logger) (*RedisStore, error) {
+	if config.Timeout < 0 {
+		return nil, errors.New("redis: timeout must not be negative")
+	}
+	store := &RedisStore{config: config, logger: logger, requests: make(map[string]int64)}
+	client, err := newRedisClient(config.URL, store.timeout())
+	if err != nil {
+		return nil, fmt.Errorf("redis: %w", err)
+	}
+	store.client = client
+	return store, nil
+}
+
+// timeout retorna o limite de cada comando
+func (s *RedisStore) timeout() time.Duration {
+	if s.config.Timeout <= 0 {
+		return 250 * time.Millisecond
+	}
+	return time.Duration(s.config.Timeout) * time.Millisecond
+}
+
+// prefix retorna o prefixo das chaves (default: qserv:)
+func (s *RedisStore) prefix() string {
+	if s.config.Prefix == "" {
+		return "qserv:"
+	}
+	return s.config.Prefix
+}
+
+// count registra o destino de uma decisão de cota
+func (s *RedisStore) count(result string) {
+	s.mu.Lock()
+	s.requests[result]++
+	s.mu.Unlock()
+}
+
+// allow consome um token da chave no Redis
+func (s *RedisStore) allow(key string, limit int, interval time.Duration) (rateLimitStatus, error) {
+	s.mu.Lock()
+	skip := time.Now().Before(s.downUntil)
+	s.mu.Unlock()
+	if skip {
+		s.count("fallback")
+		return rateLimitStatus{}, errors.New("redis is down")
+	}
+
+	reply, err := redisRateScript.Run(s.client, []string{s.prefix() + "ratelimit:" + key},
+		strconv.Itoa(limit), strconv.FormatInt(interval.Milliseconds(), 10))
+	var values []interface{}
+	if err == nil {
+		if values, _ = reply.([]interface{}); len(values) != 3 {
+			err = fmt.Errorf("redis: unexpected script reply %v", reply)
+		}
+	}
+	if err != nil {
+		s.mu.Lock()
+		s.downUntil = time.Now().Add(clusterRetry)
+		s.lastError = err.Error()
+		s.mu.Unlock()
+		s.count("fallback")
+		s.logger.Warn("Redis unreachable, using local rate limits for %s: %v", clusterRetry, err)
+		return rateLimitStatus{}, err
+	}
+	s.count("redis")
+
+	allowed, _ := values[0].(int64)
+	tokens, _ := values[1].(int64)
+	elapsed, _ := values[2].(int64)
+	now := time.Now()
+	v := &visitor{tokens: int(tokens), refilled: now.Add(-time.Duration(elapsed) * time.Millisecond)}
+	return bucketStatus(v, now, limit, interval, allowed == 1), nil
+}
+
+// Status retorna a última falha de comunicação com o Redis
+func (s *RedisStore) Status() map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	status := map[string]interface{}{"addr": s.client.addr, "prefix": s.prefix()}
+	if time.Now().Before(s.downUntil) {
+		status["down_until"] = s.downUntil
+	}
+	if s.lastError != "" {
+		status["last_error"] = s.lastError
+	}
+	return status
+}
+
+// WriteMetrics exporta as decisões de cota por destino
+func (s *RedisStore) WriteMetrics(w io.Writer) {
+	s.mu.Lock()
+	var samples []metricSample
+	for _, result := range []string{"redis", "fallback"} {
+		samples = append(samples, metricSample{labels: map[string]string{"result": result}, value: float64(s.requests[result])})
+	}
+	s.mu.Unlock()
+	writeMetric(w, "qserv_redis_rate_limit_requests_total", "Rate-limit decisions by where they were taken (fallback: Redis unreachable).", "counter", samples)
+}
+
+// handleAdminRedis mostra o estado da conexão com o Redis
+func (s *Server) handleAdminRedis(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.redis.Status())
+}
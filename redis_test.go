@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeRedis speaks enough RESP to run the rate-limit script: EVALSHA is
+// always unknown and EVAL decrements a per-key counter
+type fakeRedis struct {
+	mu       sync.Mutex
+	commands []string
+	tokens   map[string]int
+}
+
+func startFakeRedis(t *testing.T, limit int) (*fakeRedis, string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	f := &fakeRedis{tokens: make(map[string]int)}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(conn, limit)
+		}
+	}()
+	return f, ln.Addr().String()
+}
+
+func (f *fakeRedis) serve(conn net.Conn, limit int) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		n, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+		args := make([]string, n)
+		for i := range args {
+			header, _ := r.ReadString('\n')
+			size, _ := strconv.Atoi(strings.TrimSpace(header[1:]))
+			arg := make([]byte, size+2)
+			io.ReadFull(r, arg)
+			args[i] = string(arg[:size])
+		}
+		f.mu.Lock()
+		f.commands = append(f.commands, args[0])
+		switch args[0] {
+		case "AUTH", "SELECT":
+			fmt.Fprint(conn, "+OK\r\n")
+		case "EVALSHA":
+			fmt.Fprint(conn, "-NOSCRIPT No matching script\r\n")
+		case "EVAL":
+			key := args[3]
+			if _, ok := f.tokens[key]; !ok {
+				f.tokens[key] = limit
+			}
+			allowed := 0
+			if f.tokens[key] > 0 {
+				f.tokens[key]--
+				allowed = 1
+			}
+			fmt.Fprintf(conn, "*3\r\n:%d\r\n:%d\r\n:0\r\n", allowed, f.tokens[key])
+		default:
+			fmt.Fprint(conn, "-ERR unknown command\r\n")
+		}
+		f.mu.Unlock()
+	}
+}
+
+func TestRedisRateLimit(t *testing.T) {
+	fake, addr := startFakeRedis(t, 2)
+	root := t.TempDir()
+	writeTestFile(t, root+"/file.txt", "hello")
+	// Two replicas pointing at the same Redis share the quota
+	var servers []*Server
+	for i := 0; i < 2; i++ {
+		servers = append(servers, newListingTestServer(t, root, func(c *Config) {
+			c.Security.RateLimit = &RateLimitConfig{Enabled: true, RequestsPerIP: 60}
+			c.Redis = &RedisConfig{Enabled: true, URL: "redis://:secret@" + addr + "/2", Prefix: "test:", Timeout: 2000}
+		}))
+	}
+
+	var codes []int
+	for i := 0; i < 3; i++ {
+		w := httptest.NewRecorder()
+		servers[i%2].mux.ServeHTTP(w, httptest.NewRequest("GET", "/file.txt", nil))
+		codes = append(codes, w.Code)
+		if i == 0 && w.Header().Get("RateLimit-Remaining") != "1" {
+			t.Errorf("Expected remaining from Redis, got %q", w.Header().Get("RateLimit-Remaining"))
+		}
+	}
+	if codes[0] != http.StatusOK || codes[1] != http.StatusOK || codes[2] != http.StatusTooManyRequests {
+		t.Errorf("Expected the shared quota to run out on the third request, got %v", codes)
+	}
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	if _, ok := fake.tokens["test:ratelimit:192.0.2.1"]; !ok {
+		t.Errorf("Expected prefixed key, got %v", fake.tokens)
+	}
+	if strings.Join(fake.commands[:4], " ") != "AUTH SELECT EVALSHA EVAL" {
+		t.Errorf("Expected AUTH, SELECT and script load, got %v", fake.commands)
+	}
+}
+
+func TestRedisFallback(t *testing.T) {
+	ln, _ := net.Listen("tcp", "127.0.0.1:0")
+	addr := ln.Addr().String()
+	ln.Close()
+
+	server := newListingTestServer(t, t.TempDir(), func(c *Config) {
+		c.Security.RateLimit = &RateLimitConfig{Enabled: true, RequestsPerIP: 60}
+		c.Redis = &RedisConfig{Enabled: true, URL: "redis://" + addr}
+	})
+	w := httptest.NewRecorder()
+	server.mux.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if w.Code == http.StatusTooManyRequests || w.Header().Get("RateLimit-Remaining") != "59" {
+		t.Errorf("Expected local counters while Redis is down, got %d %q", w.Code, w.Header().Get("RateLimit-Remaining"))
+	}
+	if status := server.redis.Status(); status["last_error"] == nil {
+		t.Errorf("Expected the Redis error to be reported, got %v", status)
+	}
+
+	if _, err := NewRedisStore(&RedisConfig{URL: "http://localhost"}, nil); err == nil {
+		t.Errorf("Expected non-redis URL to be rejected")
+	}
+}
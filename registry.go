@@ -0,0 +1,378 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// registryPrefix rota da OCI Distribution API
+const registryPrefix = "/v2/"
+
+// ociRefName anotação com a tag de cada manifesto no index.json
+const ociRefName = "org.opencontainers.image.ref.name"
+
+var (
+	// registryName nome de repositório da especificação de distribuição
+	registryName = regexp.MustCompile(`^[a-z0-9]+(?:(?:\.|_|__|-+)[a-z0-9]+)*(?:/[a-z0-9]+(?:(?:\.|_|__|-+)[a-z0-9]+)*)*$`)
+	// registryTag tag de manifesto
+	registryTag = regexp.MustCompile(`^[a-zA-Z0-9_][a-zA-Z0-9._-]{0,127}$`)
+	// registryDigest digests aceitos (o hex vira nome de arquivo em blobs/)
+	registryDigest = regexp.MustCompile(`^(sha256:[a-f0-9]{64}|sha512:[a-f0-9]{128})$`)
+)
+
+// ociDescriptor descritor de conteúdo do index.json
+type ociDescriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// ociIndex index.json de um OCI image layout
+type ociIndex struct {
+	Manifests []ociDescriptor `json:"manifests"`
+}
+
+// Registry fachada somente leitura da OCI Distribution API sobre diretórios
+// no formato OCI image layout (oci-layout, index.json, blobs/<alg>/<hex>);
+// cada layout sob dir é um repositório, nomeado pelo caminho relativo
+type Registry struct {
+	config *RegistryConfig
+	root   func() string // raiz servida, para dir relativo
+}
+
+// NewRegistry cria a fachada do registry
+func NewRegistry(config *RegistryConfig) (*Registry, error) {
+	if config.Dir == "" {
+		return nil, errors.New("registry: dir is required")
+	}
+	return &Registry{config: config}, nil
+}
+
+// dir retorna o diretório dos layouts (relativo à raiz servida)
+func (reg *Registry) dir() string {
+	if filepath.IsAbs(reg.config.Dir) {
+		return reg.config.Dir
+	}
+	return filepath.Join(reg.root(), reg.config.Dir)
+}
+
+// layout retorna o diretório do repositório, se ele for um OCI image layout
+func (reg *Registry) layout(name string) (string, bool) {
+	if !registryName.MatchString(name) {
+		return "", false
+	}
+	dir := filepath.Join(reg.dir(), filepath.FromSlash(name))
+	if _, err := os.Stat(filepath.Join(dir, "oci-layout")); err != nil {
+		return "", false
+	}
+	return dir, true
+}
+
+// index lê o index.json do layout
+func (reg *Registry) index(layout string) (*ociIndex, error) {
+	data, err := os.ReadFile(filepath.Join(layout, "index.json"))
+	if err != nil {
+		return nil, err
+	}
+	var index ociIndex
+	if err := json.Unmarshal(data, &index); err != nil {
+		return nil, fmt.Errorf("invalid index.json: %w", err)
+	}
+	return &index, nil
+}
+
+// blobPath caminho do blob com o digest informado (já validado)
+func blobPath(layout, digest string) string {
+	alg, hex, _ := strings.Cut(digest, ":")
+	return filepath.Join(layout, "blobs", alg, hex)
+}
+
+// registryError erro no formato da especificação de distribuição
+func registryError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"errors": []map[string]string{{"code": code, "message": message}},
+	})
+}
+
+// handleRegistry atende /v2/, /v2/_catalog, /v2/<nome>/manifests/<ref>,
+// /v2/<nome>/blobs/<digest> e /v2/<nome>/tags/list
+func (s *Server) handleRegistry(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Docker-Distribution-API-Version", "registry/2.0")
+	debugNote(r, "serve", "registry")
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		registryError(w, http.StatusMethodNotAllowed, "UNSUPPORTED", "this registry is read-only")
+		return
+	}
+
+	rest := strings.TrimPrefix(r.URL.Path, registryPrefix)
+	switch {
+	case rest == "":
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte("{}\n"))
+		return
+	case rest == "_catalog":
+		s.registryCatalog(w, r)
+		return
+	}
+
+	if name, ok := strings.CutSuffix(rest, "/tags/list"); ok {
+		s.registryTags(w, r, name)
+		return
+	}
+	if i := strings.LastIndex(rest, "/manifests/"); i > 0 {
+		s.registryManifest(w, r, rest[:i], rest[i+len("/manifests/"):])
+		return
+	}
+	if i := strings.LastIndex(rest, "/blobs/"); i > 0 {
+		s.registryBlob(w, r, rest[:i], rest[i+len("/blobs/"):])
+		return
+	}
+	registryError(w, http.StatusNotFound, "UNSUPPORTED", "unknown endpoint")
+}
+
+// registryLayout resolve o layout do repositório aplicando ao seu index.json
+// a visibilidade e as regras por caminho da rota de arquivos; retorna se
+// alguma regra cobre o repositório
+func (s *Server) registryLayout(w http.ResponseWriter, r *http.Request, name string) (layout string, protected, ok bool) {
+	layout, ok = s.registry.layout(name)
+	if !ok {
+		registryError(w, http.StatusNotFound, "NAME_UNKNOWN", "repository name not known to registry")
+		return "", false, false
+	}
+	protected, ok = s.registryAccess(w, r, filepath.Join(layout, "index.json"), "NAME_UNKNOWN", "repository name not known to registry")
+	return layout, protected, ok
+}
+
+// registryAccess aplica a path as regras da rota de arquivos, respondendo a
+// recusa no formato da especificação (code e message para os ocultos)
+func (s *Server) registryAccess(w http.ResponseWriter, r *http.Request, path, code, message string) (protected, ok bool) {
+	status, protected := s.fileAccess(r, s.RootDir(), path)
+	switch status {
+	case 0:
+		return protected, true
+	case http.StatusNotFound:
+		registryError(w, status, code, message)
+	case http.StatusUnauthorized:
+		registryError(w, status, "UNAUTHORIZED", "authentication required")
+	default:
+		registryError(w, status, "DENIED", "requested access to the resource is denied")
+	}
+	return false, false
+}
+
+// registryTags lista as tags do repositório (paginação por n e last)
+func (s *Server) registryTags(w http.ResponseWriter, r *http.Request, name string) {
+	layout, _, ok := s.registryLayout(w, r, name)
+	if !ok {
+		return
+	}
+	index, err := s.registry.index(layout)
+	if err != nil {
+		s.logger.Error("Registry: %s: %v", name, err)
+		registryError(w, http.StatusInternalServerError, "UNKNOWN", "cannot read repository index")
+		return
+	}
+
+	seen := make(map[string]bool)
+	tags := []string{}
+	for _, m := range index.Manifests {
+		if tag := m.Annotations[ociRefName]; tag != "" && !seen[tag] {
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+	}
+	sort.Strings(tags)
+	tags = registryPage(w, r, tags)
+	writeJSON(w, http.StatusOK, map[string]interface{}{"name": name, "tags": tags})
+}
+
+// registryPage aplica ?last= e ?n= à lista ordenada, anunciando a próxima
+// página no header Link
+func registryPage(w http.ResponseWriter, r *http.Request, items []string) []string {
+	q := r.URL.Query()
+	if last := q.Get("last"); last != "" {
+		i := sort.SearchStrings(items, last)
+		if i < len(items) && items[i] == last {
+			i++
+		}
+		items = items[i:]
+	}
+	if n, err := strconv.Atoi(q.Get("n")); err == nil && n >= 0 && n < len(items) {
+		items = items[:n]
+		if n > 0 {
+			next := *r.URL
+			values := next.Query()
+			values.Set("last", items[n-1])
+			next.RawQuery = values.Encode()
+			w.Header().Set("Link", fmt.Sprintf("<%s>; rel=\"next\"", next.RequestURI()))
+		}
+	}
+	return items
+}
+
+// registryCatalog lista os repositórios (só com catalog ativo)
+func (s *Server) registryCatalog(w http.ResponseWriter, r *http.Request) {
+	if !s.registry.config.Catalog {
+		registryError(w, http.StatusNotFound, "UNSUPPORTED", "catalog is disabled")
+		return
+	}
+	root, base := s.RootDir(), s.registry.dir()
+	repos := []string{}
+	filepath.WalkDir(base, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return nil
+		}
+		if path != base && strings.HasPrefix(d.Name(), ".") {
+			return filepath.SkipDir
+		}
+		if _, err := os.Stat(filepath.Join(path, "oci-layout")); err == nil {
+			if status, _ := s.fileAccess(r, root, filepath.Join(path, "index.json")); status != 0 {
+				return filepath.SkipDir
+			}
+			if rel, err := relPath(base, path); err == nil && registryName.MatchString(rel) {
+				repos = append(repos, rel)
+			}
+			// Blobs de um layout não contêm outros repositórios
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	sort.Strings(repos)
+	writeJSON(w, http.StatusOK, map[string]interface{}{"repositories": registryPage(w, r, repos)})
+}
+
+// registryManifest serve o manifesto pela tag ou pelo digest
+func (s *Server) registryManifest(w http.ResponseWriter, r *http.Request, name, reference string) {
+	layout, protected, ok := s.registryLayout(w, r, name)
+	if !ok {
+		return
+	}
+	if !registryDigest.MatchString(reference) && !registryTag.MatchString(reference) {
+		registryError(w, http.StatusBadRequest, "MANIFEST_INVALID", "invalid reference")
+		return
+	}
+	index, err := s.registry.index(layout)
+	if err != nil {
+		s.logger.Error("Registry: %s: %v", name, err)
+		registryError(w, http.StatusInternalServerError, "UNKNOWN", "cannot read repository index")
+		return
+	}
+
+	// Tag: o descritor do index.json; digest: qualquer manifesto do layout
+	var desc *ociDescriptor
+	for i, m := range index.Manifests {
+		if m.Digest == reference || m.Annotations[ociRefName] == reference {
+			desc = &index.Manifests[i]
+			break
+		}
+	}
+	digest := reference
+	if desc != nil {
+		digest = desc.Digest
+	} else if !registryDigest.MatchString(reference) {
+		registryError(w, http.StatusNotFound, "MANIFEST_UNKNOWN", "manifest unknown")
+		return
+	}
+	if !registryDigest.MatchString(digest) {
+		registryError(w, http.StatusNotFound, "MANIFEST_UNKNOWN", "manifest unknown")
+		return
+	}
+
+	covered, ok := s.registryAccess(w, r, blobPath(layout, digest), "MANIFEST_UNKNOWN", "manifest unknown")
+	if !ok {
+		return
+	}
+	protected = protected || covered
+	data, err := os.ReadFile(blobPath(layout, digest))
+	if err != nil {
+		registryError(w, http.StatusNotFound, "MANIFEST_UNKNOWN", "manifest unknown")
+		return
+	}
+	mediaType := ""
+	if desc != nil {
+		mediaType = desc.MediaType
+	}
+	if mediaType == "" {
+		var manifest struct {
+			MediaType string `json:"mediaType"`
+		}
+		json.Unmarshal(data, &manifest)
+		mediaType = manifest.MediaType
+	}
+	if mediaType == "" {
+		mediaType = "application/vnd.oci.image.manifest.v1+json"
+	}
+
+	w.Header().Set("Content-Type", mediaType)
+	w.Header().Set("Docker-Content-Digest", digest)
+	w.Header().Set("ETag", `"`+digest+`"`)
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	if protected {
+		w.Header().Set("Cache-Control", "private, no-cache")
+	} else if reference == digest {
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	} else {
+		w.Header().Set("Cache-Control", "no-cache")
+	}
+	if etagMatch(r.Header.Get("If-None-Match"), `"`+digest+`"`) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	if r.Method == http.MethodHead {
+		return
+	}
+	w.Write(data)
+}
+
+// registryBlob serve um blob do layout (com Range, para retomar downloads)
+func (s *Server) registryBlob(w http.ResponseWriter, r *http.Request, name, digest string) {
+	layout, protected, ok := s.registryLayout(w, r, name)
+	if !ok {
+		return
+	}
+	if !registryDigest.MatchString(digest) {
+		registryError(w, http.StatusBadRequest, "DIGEST_INVALID", "invalid digest")
+		return
+	}
+	covered, ok := s.registryAccess(w, r, blobPath(layout, digest), "BLOB_UNKNOWN", "blob unknown to registry")
+	if !ok {
+		return
+	}
+	f, err := os.Open(blobPath(layout, digest))
+	if err != nil {
+		registryError(w, http.StatusNotFound, "BLOB_UNKNOWN", "blob unknown to registry")
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil || !info.Mode().IsRegular() {
+		registryError(w, http.StatusNotFound, "BLOB_UNKNOWN", "blob unknown to registry")
+		return
+	}
+
+	// Blobs são endereçados pelo conteúdo: imutáveis (os protegidos por
+	// alguma regra não vão para caches compartilhados)
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Docker-Content-Digest", digest)
+	w.Header().Set("ETag", `"`+digest+`"`)
+	if protected || covered {
+		w.Header().Set("Cache-Control", "private")
+	} else {
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	}
+	http.ServeContent(w, r, "", info.ModTime(), f)
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// writeTestBlob stores content in the layout and returns its digest
+func writeTestBlob(t *testing.T, layout, content string) string {
+	t.Helper()
+	sum := sha256.Sum256([]byte(content))
+	hexSum := hex.EncodeToString(sum[:])
+	writeTestFile(t, filepath.Join(layout, "blobs", "sha256", hexSum), content)
+	return "sha256:" + hexSum
+}
+
+// newRegistryTestServer builds an OCI layout for library/app tagged v1 and latest
+func newRegistryTestServer(t *testing.T) (server *Server, manifest, manifestDigest, layer, layerDigest string) {
+	t.Helper()
+	root := t.TempDir()
+	layout := filepath.Join(root, "oci", "library", "app")
+	writeTestFile(t, filepath.Join(layout, "oci-layout"), `{"imageLayoutVersion":"1.0.0"}`)
+	layer = "layer-content"
+	layerDigest = writeTestBlob(t, layout, layer)
+	manifest = `{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json","layers":[{"digest":"` + layerDigest + `"}]}`
+	manifestDigest = writeTestBlob(t, layout, manifest)
+	index := `{"schemaVersion":2,"manifests":[
+		{"mediaType":"application/vnd.oci.image.manifest.v1+json","digest":"` + manifestDigest + `","size":1,"annotations":{"org.opencontainers.image.ref.name":"v1"}},
+		{"mediaType":"application/vnd.oci.image.manifest.v1+json","digest":"` + manifestDigest + `","size":1,"annotations":{"org.opencontainers.image.ref.name":"latest"}}]}`
+	writeTestFile(t, filepath.Join(layout, "index.json"), index)
+
+	server = newListingTestServer(t, root, func(c *Config) {
+		c.Registry = &RegistryConfig{Enabled: true, Dir: "oci", Catalog: true}
+	})
+	return server, manifest, manifestDigest, layer, layerDigest
+}
+
+func registryRequest(server *Server, method, path string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	server.mux.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+	return w
+}
+
+func TestRegistryBase(t *testing.T) {
+	server, _, _, _, _ := newRegistryTestServer(t)
+	w := registryRequest(server, "GET", "/v2/")
+	if w.Code != http.StatusOK || w.Header().Get("Docker-Distribution-API-Version") != "registry/2.0" {
+		t.Errorf("Expected API version check to succeed, got %d", w.Code)
+	}
+}
+
+func TestRegistryManifestByTagAndDigest(t *testing.T) {
+	server, manifest, digest, _, _ := newRegistryTestServer(t)
+
+	w := registryRequest(server, "GET", "/v2/library/app/manifests/v1")
+	if w.Code != http.StatusOK || w.Body.String() != manifest {
+		t.Fatalf("Expected manifest by tag, got %d %q", w.Code, w.Body.String())
+	}
+	if w.Header().Get("Docker-Content-Digest") != digest || w.Header().Get("Content-Type") != "application/vnd.oci.image.manifest.v1+json" {
+		t.Errorf("Unexpected headers %v", w.Header())
+	}
+
+	w = registryRequest(server, "HEAD", "/v2/library/app/manifests/"+digest)
+	if w.Code != http.StatusOK || w.Body.Len() != 0 || w.Header().Get("Content-Length") != strconv.Itoa(len(manifest)) {
+		t.Errorf("Expected HEAD by digest with length and no body, got %d", w.Code)
+	}
+	if !strings.Contains(w.Header().Get("Cache-Control"), "immutable") {
+		t.Errorf("Expected manifests by digest to be immutable, got %q", w.Header().Get("Cache-Control"))
+	}
+
+	for path, code := range map[string]string{
+		"/v2/library/app/manifests/v2":        "MANIFEST_UNKNOWN",
+		"/v2/library/other/manifests/v1":      "NAME_UNKNOWN",
+		"/v2/library/app/manifests/bad%21tag": "MANIFEST_INVALID",
+	} {
+		w := registryRequest(server, "GET", path)
+		if !strings.Contains(w.Body.String(), code) {
+			t.Errorf("Expected %s for %s, got %d %s", code, path, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestRegistryBlob(t *testing.T) {
+	server, _, _, layer, digest := newRegistryTestServer(t)
+
+	w := registryRequest(server, "GET", "/v2/library/app/blobs/"+digest)
+	if w.Code != http.StatusOK || w.Body.String() != layer || w.Header().Get("Docker-Content-Digest") != digest {
+		t.Fatalf("Expected blob, got %d %q", w.Code, w.Body.String())
+	}
+
+	req := httptest.NewRequest("GET", "/v2/library/app/blobs/"+digest, nil)
+	req.Header.Set("Range", "bytes=6-")
+	w = httptest.NewRecorder()
+	server.mux.ServeHTTP(w, req)
+	if w.Code != http.StatusPartialContent || w.Body.String() != "content" {
+		t.Errorf("Expected ranged blob, got %d %q", w.Code, w.Body.String())
+	}
+
+	w = registryRequest(server, "GET", "/v2/library/app/blobs/sha256:"+strings.Repeat("0", 64))
+	if w.Code != http.StatusNotFound || !strings.Contains(w.Body.String(), "BLOB_UNKNOWN") {
+		t.Errorf("Expected BLOB_UNKNOWN, got %d", w.Code)
+	}
+	w = registryRequest(server, "GET", "/v2/library/app/blobs/sha256:..%2f..%2fetc")
+	if w.Code == http.StatusOK {
+		t.Errorf("Expected invalid digest to be rejected")
+	}
+}
+
+func TestRegistryTagsAndCatalog(t *testing.T) {
+	server, _, _, _, _ := newRegistryTestServer(t)
+
+	var tags struct {
+		Name string   `json:"name"`
+		Tags []string `json:"tags"`
+	}
+	w := registryRequest(server, "GET", "/v2/library/app/tags/list")
+	json.Unmarshal(w.Body.Bytes(), &tags)
+	if tags.Name != "library/app" || strings.Join(tags.Tags, ",") != "latest,v1" {
+		t.Errorf("Expected sorted tags, got %+v", tags)
+	}
+
+	w = registryRequest(server, "GET", "/v2/library/app/tags/list?n=1")
+	json.Unmarshal(w.Body.Bytes(), &tags)
+	if strings.Join(tags.Tags, ",") != "latest" || !strings.Contains(w.Header().Get("Link"), "last=latest") {
+		t.Errorf("Expected first page with Link, got %+v %q", tags, w.Header().Get("Link"))
+	}
+	w = registryRequest(server, "GET", "/v2/library/app/tags/list?n=1&last=latest")
+	json.Unmarshal(w.Body.Bytes(), &tags)
+	if strings.Join(tags.Tags, ",") != "v1" {
+		t.Errorf("Expected second page, got %+v", tags)
+	}
+
+	var catalog struct {
+		Repositories []string `json:"repositories"`
+	}
+	w = registryRequest(server, "GET", "/v2/_catalog")
+	json.Unmarshal(w.Body.Bytes(), &catalog)
+	if strings.Join(catalog.Repositories, ",") != "library/app" {
+		t.Errorf("Expected library/app in catalog, got %+v", catalog)
+	}
+}
+
+func TestRegistryReadOnly(t *testing.T) {
+	server, _, _, _, _ := newRegistryTestServer(t)
+	for _, method := range []string{"POST", "PUT", "PATCH", "DELETE"} {
+		w := registryRequest(server, method, "/v2/library/app/blobs/uploads/")
+		if w.Code != http.StatusMethodNotAllowed || !strings.Contains(w.Body.String(), "UNSUPPORTED") {
+			t.Errorf("Expected %s to be rejected, got %d", method, w.Code)
+		}
+	}
+}
+
+func TestRegistryAppliesPathRules(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{"public", "internal"} {
+		layout := filepath.Join(root, "oci", name)
+		writeTestFile(t, filepath.Join(layout, "oci-layout"), `{"imageLayoutVersion":"1.0.0"}`)
+		digest := writeTestBlob(t, layout, `{"schemaVersion":2}`)
+		writeTestFile(t, filepath.Join(layout, "index.json"), `{"schemaVersion":2,"manifests":[{"digest":"`+digest+`","annotations":{"org.opencontainers.image.ref.name":"v1"}}]}`)
+	}
+	layerDigest := writeTestBlob(t, filepath.Join(root, "oci", "internal"), "layer-content")
+	server := newListingTestServer(t, root, func(c *Config) {
+		c.Registry = &RegistryConfig{Enabled: true, Dir: "oci", Catalog: true}
+		c.Security.ProxyAuth = &ProxyAuthConfig{
+			Enabled:        true,
+			TrustedProxies: []string{"192.0.2.1"},
+			ACL:            []ProxyACLRule{{Path: "/oci/internal/**", Groups: []string{"admins"}}},
+		}
+	})
+	get := func(target string, groups string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", target, nil)
+		if groups != "" {
+			req.Header.Set("Remote-User", "alice")
+			req.Header.Set("Remote-Groups", groups)
+		}
+		w := httptest.NewRecorder()
+		server.mux.ServeHTTP(w, req)
+		return w
+	}
+
+	if body := get("/v2/_catalog", "").Body.String(); strings.Contains(body, "internal") || !strings.Contains(body, "public") {
+		t.Errorf("Expected protected repository to be left out of the catalog, got %s", body)
+	}
+	for _, path := range []string{"/v2/internal/tags/list", "/v2/internal/manifests/v1", "/v2/internal/blobs/" + layerDigest} {
+		if w := get(path, ""); w.Code == http.StatusOK {
+			t.Errorf("Expected %s to be refused, got %d", path, w.Code)
+		}
+	}
+	w := get("/v2/internal/blobs/"+layerDigest, "admins")
+	if w.Code != http.StatusOK || w.Body.String() != "layer-content" {
+		t.Errorf("Expected admins to pull, got %d %q", w.Code, w.Body.String())
+	}
+	if cc := w.Header().Get("Cache-Control"); cc != "private" {
+		t.Errorf("Expected private blob, got %q", cc)
+	}
+}
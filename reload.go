@@ -0,0 +1,242 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// reloadDebounce espera após uma alteração do arquivo antes de recarregar
+// (editores gravam em várias etapas)
+const reloadDebounce = 300 * time.Millisecond
+
+// Reloader recarrega o arquivo de configuração sem reiniciar (SIGHUP,
+// observação do arquivo ou API administrativa): a nova versão é validada e,
+// se estiver correta, as seções recarregáveis trocam de uma vez; se não,
+// a configuração em uso continua valendo
+type Reloader struct {
+	path   string
+	server *Server
+	logger *Logger
+
+	mu       sync.Mutex
+	file     *Config // última versão do arquivo aplicada (sem as flags)
+	watcher  *fsnotify.Watcher
+	results  map[string]int64 // applied ou rejected
+	lastErr  string
+	lastTime time.Time
+}
+
+// ReloadResult resposta da recarga na API administrativa
+type ReloadResult struct {
+	Applied         bool     `json:"applied"`
+	Error           string   `json:"error,omitempty"`
+	RestartRequired []string `json:"restart_required,omitempty"` // seções alteradas que só valem ao reiniciar
+}
+
+// enableReload ativa a recarga do arquivo de configuração
+func (s *Server) enableReload(path string) (*Reloader, error) {
+	file, err := LoadConfig(path)
+	if err != nil {
+		return nil, err
+	}
+	r := &Reloader{path: path, server: s, logger: s.logger, file: file, results: make(map[string]int64)}
+	s.reloader = r
+	s.registerMetrics(r)
+	return r, nil
+}
+
+// reloadableConfig aplica sobre a configuração ativa as seções que podem
+// mudar sem reiniciar: segurança (credenciais, listas de IPs, rate limit,
+// CORS, filtros, ACLs; HTTPS, desafio, monitor de certificado, OCSP, ECH,
+// session tickets, hotlink e cookies assinados ficam), custom_headers e
+// nível de log
+func reloadableConfig(active, next *Config) *Config {
+	merged := *active
+	security := next.Security
+	security.EnableHTTPS = active.Security.EnableHTTPS
+	security.CertFile = active.Security.CertFile
+	security.KeyFile = active.Security.KeyFile
+	security.Challenge = active.Security.Challenge
+	security.CertMonitor = active.Security.CertMonitor
+	security.OCSPStapling = active.Security.OCSPStapling
+	security.ECH = active.Security.ECH
+	security.SessionTickets = active.Security.SessionTickets
+	security.Hotlink = active.Security.Hotlink             // montado uma vez em NewServer
+	security.SignedCookies = active.Security.SignedCookies // idem, com a rota do portão no mux
+	merged.Security = security
+	merged.Performance.CustomHeaders = next.Performance.CustomHeaders
+	merged.Logging.Level = next.Logging.Level
+	return &merged
+}
+
+// restartRequired lista as seções alteradas que a recarga não aplica
+func restartRequired(old, next *Config) []string {
+	// next com as partes recarregáveis de old: sobra só o que exige reinício
+	a, _ := json.Marshal(old)
+	b, _ := json.Marshal(reloadableConfig(next, old))
+	var before, after map[string]interface{}
+	json.Unmarshal(a, &before)
+	json.Unmarshal(b, &after)
+	keys := changedKeys("", before, after)
+	sort.Strings(keys)
+	return keys
+}
+
+// changedKeys lista as chaves que diferem entre before e after; em security,
+// quase toda recarregável, aponta as subseções
+func changedKeys(prefix string, before, after map[string]interface{}) []string {
+	var keys []string
+	for key := range after {
+		if reflect.DeepEqual(before[key], after[key]) {
+			continue
+		}
+		old, ok := before[key].(map[string]interface{})
+		next, nextOK := after[key].(map[string]interface{})
+		if prefix == "" && key == "security" && ok && nextOK {
+			keys = append(keys, changedKeys(key+".", old, next)...)
+			continue
+		}
+		keys = append(keys, prefix+key)
+	}
+	for key := range before {
+		if _, ok := after[key]; !ok {
+			keys = append(keys, prefix+key)
+		}
+	}
+	return keys
+}
+
+// Reload lê e valida o arquivo e troca a configuração ativa
+func (r *Reloader) Reload() ReloadResult {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.lastTime = time.Now()
+
+	result, err := r.reload()
+	if err != nil {
+		r.results["rejected"]++
+		r.lastErr = err.Error()
+		r.logger.Error("Configuration reload rejected, keeping the running configuration: %v", err)
+		return ReloadResult{Error: err.Error()}
+	}
+	r.results["applied"]++
+	r.lastErr = ""
+	if len(result.RestartRequired) > 0 {
+		r.logger.Warn("Configuration reloaded; changes to %v require a restart", result.RestartRequired)
+	} else {
+		r.logger.Info("Configuration reloaded from %s", r.path)
+	}
+	return result
+}
+
+func (r *Reloader) reload() (ReloadResult, error) {
+	// Sem o arquivo, LoadConfig voltaria aos defaults
+	if _, err := os.Stat(r.path); err != nil {
+		return ReloadResult{}, err
+	}
+	next, err := LoadConfig(r.path)
+	if err != nil {
+		return ReloadResult{}, fmt.Errorf("failed to load config file: %w", err)
+	}
+	merged := reloadableConfig(r.server.activeConfig(), next)
+	if err := validateConfig(merged); err != nil {
+		return ReloadResult{}, err
+	}
+	if merged.Logging.Level != "" && merged.Logging.Level != r.logger.Level() {
+		if err := r.logger.SetLevel(merged.Logging.Level); err != nil {
+			return ReloadResult{}, err
+		}
+	}
+	r.server.applyConfig(merged)
+	r.server.reloadVHosts(merged)
+	result := ReloadResult{Applied: true, RestartRequired: restartRequired(r.file, next)}
+	r.file = next
+	return result, nil
+}
+
+// Watch recarrega quando o arquivo muda; observa o diretório para acompanhar
+// editores que gravam num arquivo temporário e renomeiam
+func (r *Reloader) Watch() error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	path, err := filepath.Abs(r.path)
+	if err != nil {
+		watcher.Close()
+		return err
+	}
+	if err := watcher.Add(filepath.Dir(path)); err != nil {
+		watcher.Close()
+		return err
+	}
+	r.mu.Lock()
+	r.watcher = watcher
+	r.mu.Unlock()
+
+	go func() {
+		var timer *time.Timer
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if filepath.Clean(event.Name) != path || !event.Has(fsnotify.Write) && !event.Has(fsnotify.Create) {
+					continue
+				}
+				if timer != nil {
+					timer.Stop()
+				}
+				timer = time.AfterFunc(reloadDebounce, func() { r.Reload() })
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				r.logger.Error("Config watch: %v", err)
+			}
+		}
+	}()
+	return nil
+}
+
+// Stop encerra a observação do arquivo
+func (r *Reloader) Stop() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.watcher != nil {
+		r.watcher.Close()
+		r.watcher = nil
+	}
+}
+
+// WriteMetrics exporta as recargas aplicadas e rejeitadas
+func (r *Reloader) WriteMetrics(w io.Writer) {
+	r.mu.Lock()
+	var samples []metricSample
+	for _, result := range []string{"applied", "rejected"} {
+		samples = append(samples, metricSample{labels: map[string]string{"result": result}, value: float64(r.results[result])})
+	}
+	r.mu.Unlock()
+	writeMetric(w, "qserv_config_reloads_total", "Configuration reloads by result (rejected: invalid file, running configuration kept).", "counter", samples)
+}
+
+// handleAdminReload recarrega a configuração (422 se o arquivo for recusado)
+func (s *Server) handleAdminReload(w http.ResponseWriter, r *http.Request) {
+	result := s.reloader.Reload()
+	status := http.StatusOK
+	if !result.Applied {
+		status = http.StatusUnprocessableEntity
+	}
+	writeJSON(w, status, result)
+}
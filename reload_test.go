@@ -0,0 +1,256 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// newReloadTestServer starts a server from a config file that the test can rewrite
+func newReloadTestServer(t *testing.T, configure func(*Config)) (*Server, string, func(func(*Config))) {
+	t.Helper()
+	root := t.TempDir()
+	writeTestFile(t, filepath.Join(root, "a.txt"), "hello")
+	path := filepath.Join(t.TempDir(), "config.json")
+	write := func(configure func(*Config)) {
+		config := DefaultConfig()
+		config.Server.RootDir = root
+		config.Performance.EnableCompression = false
+		if configure != nil {
+			configure(config)
+		}
+		if err := SaveConfig(path, config); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(configure)
+
+	config, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger, _ := NewLogger(&LoggingConfig{Enabled: false})
+	server := NewServer(config, logger)
+	if _, err := server.enableReload(path); err != nil {
+		t.Fatal(err)
+	}
+	server.setupHandlers()
+	return server, path, write
+}
+
+func basicAuthStatus(server *Server, user, password string) int {
+	req := httptest.NewRequest("GET", "/a.txt", nil)
+	req.SetBasicAuth(user, password)
+	w := httptest.NewRecorder()
+	server.mux.ServeHTTP(w, req)
+	return w.Code
+}
+
+func withBasicAuth(password string) func(*Config) {
+	return func(c *Config) {
+		c.Security.BasicAuth = &BasicAuthConfig{Enabled: true, Username: "admin", Password: password, Realm: "qserv"}
+	}
+}
+
+func TestReloadSwapsCredentials(t *testing.T) {
+	server, _, write := newReloadTestServer(t, withBasicAuth("old"))
+	if code := basicAuthStatus(server, "admin", "old"); code != http.StatusOK {
+		t.Fatalf("Expected 200 with the initial password, got %d", code)
+	}
+
+	write(withBasicAuth("new"))
+	if result := server.reloader.Reload(); !result.Applied {
+		t.Fatalf("Expected reload to be applied, got %+v", result)
+	}
+	if code := basicAuthStatus(server, "admin", "old"); code != http.StatusUnauthorized {
+		t.Errorf("Expected old password to be rejected after reload, got %d", code)
+	}
+	if code := basicAuthStatus(server, "admin", "new"); code != http.StatusOK {
+		t.Errorf("Expected new password to work after reload, got %d", code)
+	}
+}
+
+func TestReloadRejectsBrokenConfig(t *testing.T) {
+	server, path, write := newReloadTestServer(t, withBasicAuth("old"))
+
+	os.WriteFile(path, []byte(`{"security": {"basic_auth": {`), 0644)
+	if result := server.reloader.Reload(); result.Applied || result.Error == "" {
+		t.Errorf("Expected truncated JSON to be rejected, got %+v", result)
+	}
+
+	// Valid JSON that fails validation (basic auth without password)
+	write(withBasicAuth(""))
+	if result := server.reloader.Reload(); result.Applied {
+		t.Error("Expected invalid configuration to be rejected")
+	}
+
+	os.Remove(path)
+	if result := server.reloader.Reload(); result.Applied {
+		t.Error("Expected missing file to be rejected instead of falling back to defaults")
+	}
+
+	if code := basicAuthStatus(server, "admin", "old"); code != http.StatusOK {
+		t.Errorf("Expected running configuration to be kept, got %d", code)
+	}
+}
+
+func TestReloadRateLimitKeepsLimiter(t *testing.T) {
+	server, _, write := newReloadTestServer(t, nil)
+	limiter := server.limiter
+
+	get := func() int {
+		req := httptest.NewRequest("GET", "/a.txt", nil)
+		req.RemoteAddr = "192.0.2.10:1234"
+		w := httptest.NewRecorder()
+		server.mux.ServeHTTP(w, req)
+		return w.Code
+	}
+	for i := 0; i < 5; i++ {
+		if code := get(); code != http.StatusOK {
+			t.Fatalf("Expected no rate limit before reload, got %d", code)
+		}
+	}
+
+	write(func(c *Config) {
+		c.Security.RateLimit = &RateLimitConfig{Enabled: true, RequestsPerIP: 2}
+	})
+	server.reloader.Reload()
+	if server.limiter != limiter {
+		t.Error("Expected the limiter (and its counters) to survive reloads")
+	}
+	codes := []int{get(), get(), get()}
+	if codes[2] != http.StatusTooManyRequests {
+		t.Errorf("Expected third request to be limited after reload, got %v", codes)
+	}
+}
+
+func TestReloadReportsRestartRequired(t *testing.T) {
+	server, _, write := newReloadTestServer(t, nil)
+
+	write(func(c *Config) {
+		c.Server.Port = 9090
+		c.Security.IPBlacklist = []string{"192.0.2.99"}
+		c.Performance.CustomHeaders = map[string]string{"X-Team": "docs"}
+	})
+	result := server.reloader.Reload()
+	if !result.Applied {
+		t.Fatalf("Expected reload to be applied, got %+v", result)
+	}
+	if !reflect.DeepEqual(result.RestartRequired, []string{"server"}) {
+		t.Errorf("Expected only server to require a restart, got %v", result.RestartRequired)
+	}
+	if port := server.activeConfig().Server.Port; port != 8080 {
+		t.Errorf("Expected the running port to be kept, got %d", port)
+	}
+
+	w := httptest.NewRecorder()
+	server.mux.ServeHTTP(w, httptest.NewRequest("GET", "/a.txt", nil))
+	if got := w.Header().Get("X-Team"); got != "docs" {
+		t.Errorf("Expected reloaded custom header, got %q", got)
+	}
+}
+
+func TestReloadWatch(t *testing.T) {
+	server, _, write := newReloadTestServer(t, withBasicAuth("old"))
+	if err := server.reloader.Watch(); err != nil {
+		t.Fatal(err)
+	}
+	defer server.reloader.Stop()
+
+	write(withBasicAuth("new"))
+	deadline := time.Now().Add(3 * time.Second)
+	for basicAuthStatus(server, "admin", "new") != http.StatusOK {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the watched file change to be applied")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func TestAdminReload(t *testing.T) {
+	server, path, _ := newReloadTestServer(t, nil)
+	os.WriteFile(path, []byte(`not json`), 0644)
+
+	w := httptest.NewRecorder()
+	server.handleAdminReload(w, httptest.NewRequest("POST", "/_admin/config/reload", nil))
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected 422 for a rejected file, got %d", w.Code)
+	}
+}
+
+func TestReloadKeepsHotlinkAndSignedCookies(t *testing.T) {
+	server, _, write := newReloadTestServer(t, nil)
+
+	write(func(c *Config) {
+		c.Security.Hotlink = &HotlinkConfig{Enabled: true}
+		c.Security.SignedCookies = &SignedCookiesConfig{Enabled: true, Secret: "s3cret", Paths: []string{"/members/**"}}
+	})
+	result := server.reloader.Reload()
+	if !reflect.DeepEqual(result.RestartRequired, []string{"security.hotlink", "security.signed_cookies"}) {
+		t.Errorf("Expected hotlink and signed cookies to require a restart, got %v", result.RestartRequired)
+	}
+	if active := server.activeConfig(); active.Security.Hotlink != nil || active.Security.SignedCookies != nil {
+		t.Error("Expected the running hotlink and signed cookies configuration to be kept")
+	}
+}
+
+func TestReloadAppliesToFTP(t *testing.T) {
+	server, _, write := newReloadTestServer(t, func(c *Config) {
+		withBasicAuth("old")(c)
+		c.FTP = &FTPConfig{Enabled: true, Address: "127.0.0.1:0"}
+	})
+	l, err := server.ftp.Listen()
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.ftp.Serve(l)
+	t.Cleanup(func() { server.ftp.Close() })
+
+	write(func(c *Config) {
+		withBasicAuth("new")(c)
+		c.FTP = &FTPConfig{Enabled: true, Address: "127.0.0.1:0"}
+	})
+	if result := server.reloader.Reload(); !result.Applied {
+		t.Fatalf("Expected reload to be applied, got %+v", result)
+	}
+
+	// FTP logins use the reloaded credentials
+	conn := dialTestFTP(t, l.Addr().String())
+	ftpCmd(t, conn, 331, "USER admin")
+	ftpCmd(t, conn, 530, "PASS old")
+	ftpCmd(t, conn, 331, "USER admin")
+	ftpCmd(t, conn, 230, "PASS new")
+}
+
+func TestReloadAppliesToVHosts(t *testing.T) {
+	static := t.TempDir()
+	writeTestFile(t, filepath.Join(static, "page.txt"), "static site")
+	vhosts := []VHostConfig{{Hosts: []string{"static.example.com"}, RootDir: static}}
+	server, _, write := newReloadTestServer(t, func(c *Config) { c.VHosts = vhosts })
+
+	get := func() int {
+		req := httptest.NewRequest("GET", "/page.txt", nil)
+		req.Host = "static.example.com"
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		return w.Code
+	}
+	if code := get(); code != http.StatusOK {
+		t.Fatalf("Expected 200 before reload, got %d", code)
+	}
+
+	write(func(c *Config) {
+		c.VHosts = vhosts
+		c.Security.IPBlacklist = []string{"192.0.2.1"}
+	})
+	if result := server.reloader.Reload(); !result.Applied || len(result.RestartRequired) != 0 {
+		t.Fatalf("Expected reload to be applied, got %+v", result)
+	}
+	if code := get(); code != http.StatusForbidden {
+		t.Errorf("Expected the reloaded blacklist to apply to virtual hosts, got %d", code)
+	}
+}
@@ -0,0 +1,21 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// watchReloadSignal recarrega a configuração a cada SIGHUP
+func watchReloadSignal(r *Reloader) {
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGHUP)
+	go func() {
+		for range sigChan {
+			r.logger.Info("Received SIGHUP, reloading configuration")
+			r.Reload()
+		}
+	}()
+}
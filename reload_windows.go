@@ -0,0 +1,4 @@
+package main
+
+// watchReloadSignal não faz nada no Windows (sem SIGHUP); use reload.watch ou a API administrativa
+func watchReloadSignal(r *Reloader) {}
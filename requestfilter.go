@@ -0,0 +1,104 @@
+package main
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// RequestFilter rejeita requisições por método, tamanho da URL, Host e headers
+type RequestFilter struct {
+	config  *RequestFilterConfig
+	logger  *Logger
+	methods map[string]bool
+	headers []headerFilter
+}
+
+// headerFilter regra de header já compilada
+type headerFilter struct {
+	header  string
+	pattern *regexp.Regexp
+	missing bool
+	status  int
+}
+
+// NewRequestFilter compila as regras (os padrões já foram validados na carga da configuração)
+func NewRequestFilter(config *RequestFilterConfig, logger *Logger) *RequestFilter {
+	f := &RequestFilter{
+		config:  config,
+		logger:  logger,
+		methods: make(map[string]bool),
+	}
+	for _, method := range config.DenyMethods {
+		f.methods[strings.ToUpper(method)] = true
+	}
+	for _, rule := range config.Headers {
+		h := headerFilter{
+			header:  http.CanonicalHeaderKey(rule.Header),
+			missing: rule.Missing,
+			status:  statusOrDefault(rule.Status, http.StatusForbidden),
+		}
+		if rule.Pattern != "" {
+			h.pattern = regexp.MustCompile(rule.Pattern)
+		}
+		f.headers = append(f.headers, h)
+	}
+	return f
+}
+
+// statusOrDefault retorna o status configurado ou o padrão
+func statusOrDefault(status, def int) int {
+	if status == 0 {
+		return def
+	}
+	return status
+}
+
+// Check retorna o status com que a requisição deve ser rejeitada (0 se permitida)
+// e o motivo
+func (f *RequestFilter) Check(r *http.Request) (int, string) {
+	if f.methods[r.Method] {
+		return statusOrDefault(f.config.MethodStatus, http.StatusMethodNotAllowed), "method " + r.Method
+	}
+	if f.config.MaxURLLength > 0 && len(r.RequestURI) > f.config.MaxURLLength {
+		return statusOrDefault(f.config.URLStatus, http.StatusRequestURITooLong), "URL too long"
+	}
+	if f.config.RequireHost && r.Host == "" {
+		return statusOrDefault(f.config.HostStatus, http.StatusBadRequest), "missing Host"
+	}
+	for _, rule := range f.headers {
+		values, present := r.Header[rule.header]
+		if rule.header == "Host" {
+			values, present = []string{r.Host}, r.Host != ""
+		}
+		if !present {
+			if rule.missing {
+				return rule.status, "missing " + rule.header
+			}
+			continue
+		}
+		if rule.pattern == nil {
+			continue
+		}
+		for _, value := range values {
+			if rule.pattern.MatchString(value) {
+				return rule.status, rule.header + " matches " + rule.pattern.String()
+			}
+		}
+	}
+	return 0, ""
+}
+
+// RequestFilterMiddleware aplica as regras de filtragem
+func RequestFilterMiddleware(filter *RequestFilter) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if status, reason := filter.Check(r); status != 0 {
+				filter.logger.Debug("Request from %s rejected: %s", r.RemoteAddr, reason)
+				http.Error(w, http.StatusText(status), status)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRequestFilterMiddleware(t *testing.T) {
+	logger, _ := NewLogger(&LoggingConfig{Enabled: false})
+	filter := NewRequestFilter(&RequestFilterConfig{
+		Enabled:      true,
+		DenyMethods:  []string{"trace"},
+		MaxURLLength: 40,
+		RequireHost:  true,
+		Headers: []HeaderFilterRule{
+			{Header: "User-Agent", Pattern: `(?i)sqlmap|nikto`},
+			{Header: "user-agent", Missing: true, Status: 444},
+		},
+	}, logger)
+
+	handler := RequestFilterMiddleware(filter)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		host   string
+		ua     string
+		status int
+	}{
+		{"allowed", "GET", "/file.txt", "example.com", "Mozilla/5.0", http.StatusOK},
+		{"denied method", "TRACE", "/", "example.com", "Mozilla/5.0", http.StatusMethodNotAllowed},
+		{"long URL", "GET", "/" + strings.Repeat("a", 50), "example.com", "Mozilla/5.0", http.StatusRequestURITooLong},
+		{"missing host", "GET", "/", "", "Mozilla/5.0", http.StatusBadRequest},
+		{"bad user agent", "GET", "/", "example.com", "sqlmap/1.7", http.StatusForbidden},
+		{"missing user agent", "GET", "/", "example.com", "", 444},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.target, nil)
+			req.Host = tt.host
+			if tt.ua != "" {
+				req.Header.Set("User-Agent", tt.ua)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+			if w.Code != tt.status {
+				t.Errorf("Expected status %d, got %d", tt.status, w.Code)
+			}
+		})
+	}
+}
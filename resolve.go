@@ -0,0 +1,185 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// unicodeForm retorna a forma Unicode configurada para caminhos
+func (s *Server) unicodeForm() (norm.Form, bool) {
+	switch strings.ToLower(s.config.Features.UnicodeNormalization) {
+	case "nfc":
+		return norm.NFC, true
+	case "nfd":
+		return norm.NFD, true
+	}
+	return 0, false
+}
+
+// negativeCacheOp marca os erros de resolvePath vindos do cache de 404
+const negativeCacheOp = "negative-cache"
+
+// notFoundCached informa se o erro de resolvePath veio do cache de 404
+func notFoundCached(err error) bool {
+	var pathErr *fs.PathError
+	return errors.As(err, &pathErr) && pathErr.Op == negativeCacheOp
+}
+
+// resolvePath converte o caminho da requisição em um arquivo dentro da raiz.
+// Quando o caminho exato não existe, tenta casar cada componente com os
+// nomes no disco sob a normalização configurada e, no modo sem distinção de
+// maiúsculas, ignorando a caixa; neste caso canonical traz o caminho de URL
+// correto para redirecionamento.
+func (s *Server) resolvePath(root, urlPath string) (path string, info os.FileInfo, canonical string, err error) {
+	form, normalize := s.unicodeForm()
+	if normalize {
+		urlPath = form.String(urlPath)
+	}
+
+	path = filepath.Join(root, filepath.Clean(urlPath))
+
+	// Cache de 404
+	if s.notFound != nil && s.notFound.Contains(path) {
+		return path, nil, "", &fs.PathError{Op: negativeCacheOp, Path: path, Err: fs.ErrNotExist}
+	}
+
+	info, err = os.Stat(path)
+	if os.IsNotExist(err) && normalize {
+		same := func(disk, requested string) bool {
+			return form.String(disk) == requested
+		}
+		if matched, ok := matchPath(root, urlPath, same); ok {
+			if matchedInfo, err := os.Stat(matched); err == nil {
+				return matched, matchedInfo, "", nil
+			}
+		}
+	}
+
+	if os.IsNotExist(err) && s.config.Features.CaseInsensitive {
+		same := func(disk, requested string) bool {
+			if normalize {
+				disk = form.String(disk)
+			}
+			return strings.EqualFold(disk, requested)
+		}
+		if matched, ok := matchPath(root, urlPath, same); ok {
+			if matchedInfo, err := os.Stat(matched); err == nil {
+				return matched, matchedInfo, canonicalURLPath(root, matched, urlPath), nil
+			}
+		}
+	}
+
+	if os.IsNotExist(err) && s.notFound != nil {
+		s.notFound.Add(path, urlPath)
+	}
+	return path, info, "", err
+}
+
+// canonicalURLPath calcula o caminho de URL de um arquivo resolvido, mantendo a barra final pedida
+func canonicalURLPath(root, matched, urlPath string) string {
+	rel, err := filepath.Rel(root, matched)
+	if err != nil || rel == "." {
+		return "/"
+	}
+	canonical := "/" + filepath.ToSlash(rel)
+	if strings.HasSuffix(urlPath, "/") {
+		canonical += "/"
+	}
+	return canonical
+}
+
+// matchPath resolve urlPath componente a componente a partir de root, usando
+// same para comparar os nomes no disco com os componentes pedidos (em caso de
+// vários candidatos vale o primeiro em ordem alfabética)
+func matchPath(root, urlPath string, same func(disk, requested string) bool) (string, bool) {
+	current := root
+	for _, part := range strings.Split(urlPath, "/") {
+		if part == "" || part == "." {
+			continue
+		}
+
+		candidate := filepath.Join(current, part)
+		if _, err := os.Stat(candidate); err == nil {
+			current = candidate
+			continue
+		}
+
+		entries, err := os.ReadDir(current)
+		if err != nil {
+			return "", false
+		}
+		found := ""
+		for _, entry := range entries {
+			if same(entry.Name(), part) {
+				found = entry.Name()
+				break
+			}
+		}
+		if found == "" {
+			return "", false
+		}
+		current = filepath.Join(current, found)
+	}
+	return current, true
+}
+
+// resolveVisible resolve o caminho como resolvePath e aplica as regras de
+// visibilidade dos acessos fora do HTTP (FTP, API de arquivos): ocultos,
+// agendamento, lápides e regras de listagem em cada componente
+func (s *Server) resolveVisible(root, urlPath string) (string, os.FileInfo, error) {
+	path, info, _, err := s.resolvePath(root, urlPath)
+	if err != nil {
+		return path, nil, err
+	}
+	if !isWithin(root, path) {
+		return path, nil, fs.ErrNotExist
+	}
+	if path == root {
+		return path, info, nil
+	}
+	rel, err := relPath(root, path)
+	if err != nil || !s.visiblePath(root, rel) {
+		return path, nil, fs.ErrNotExist
+	}
+	if s.listingRules != nil && s.listingRules.Blocked(root, path) {
+		return path, nil, fs.ErrNotExist
+	}
+	if s.schedule != nil {
+		if status, _ := s.schedule.Status(root, path); status != 0 {
+			return path, nil, fs.ErrNotExist
+		}
+	}
+	return path, info, nil
+}
+
+// visibleEntries itens de dir que aparecem nas listagens (arquivos regulares
+// e diretórios), em ordem alfabética
+func (s *Server) visibleEntries(root, dir string) ([]os.FileInfo, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var infos []os.FileInfo
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+		if !s.listable(root, dir, entry.Name()) {
+			continue
+		}
+		if s.listingRules != nil && s.listingRules.Blocked(root, path) {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil || !(info.IsDir() || info.Mode().IsRegular()) {
+			continue
+		}
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name() < infos[j].Name() })
+	return infos, nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// newResolveTestServer cria um servidor de arquivos sobre root com a configuração ajustada por configure
+func newResolveTestServer(t *testing.T, root string, configure func(*Config)) http.Handler {
+	t.Helper()
+	config := DefaultConfig()
+	config.Server.RootDir = root
+	configure(config)
+	logger, _ := NewLogger(&LoggingConfig{Enabled: false})
+	return NewServer(config, logger).createFileHandler()
+}
+
+func TestUnicodeNormalization(t *testing.T) {
+	root := t.TempDir()
+	// Nome gravado em NFD (como no macOS): "e" + acento combinante
+	dir := filepath.Join(root, "re\u0301sume\u0301s")
+	os.Mkdir(dir, 0755)
+	writeTestFile(t, filepath.Join(dir, "cafe\u0301.txt"), "coffee")
+
+	nfcPath := "/r\u00e9sum\u00e9s/caf\u00e9.txt"
+
+	tests := []struct {
+		mode     string
+		expected int
+	}{
+		{"", http.StatusNotFound},
+		{"nfc", http.StatusOK},
+		{"nfd", http.StatusOK},
+	}
+
+	for _, test := range tests {
+		handler := newResolveTestServer(t, root, func(c *Config) {
+			c.Features.UnicodeNormalization = test.mode
+		})
+
+		req := httptest.NewRequest("GET", "/", nil)
+		req.URL.Path = nfcPath
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		if w.Code != test.expected {
+			t.Errorf("Mode %q: expected status %d, got %d", test.mode, test.expected, w.Code)
+		}
+		if test.expected == http.StatusOK && w.Body.String() != "coffee" {
+			t.Errorf("Mode %q: expected body coffee, got %q", test.mode, w.Body.String())
+		}
+	}
+}
+
+func TestCaseInsensitiveResolution(t *testing.T) {
+	root := t.TempDir()
+	os.Mkdir(filepath.Join(root, "Images"), 0755)
+	writeTestFile(t, filepath.Join(root, "Images", "Logo.PNG"), "png")
+
+	handler := newResolveTestServer(t, root, func(c *Config) {
+		c.Features.CaseInsensitive = true
+	})
+
+	req := httptest.NewRequest("GET", "/images/logo.png?v=2", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusMovedPermanently {
+		t.Fatalf("Expected 301, got %d", w.Code)
+	}
+	if location := w.Header().Get("Location"); location != "/Images/Logo.PNG?v=2" {
+		t.Errorf("Expected redirect to /Images/Logo.PNG?v=2, got %s", location)
+	}
+
+	req = httptest.NewRequest("GET", "/images/missing.png", nil)
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for missing file, got %d", w.Code)
+	}
+}
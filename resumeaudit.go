@@ -0,0 +1,277 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxResumeAuditPaths caminhos acompanhados antes de recomeçar do zero
+const maxResumeAuditPaths = 10000
+
+// resumeAuditRecent ocorrências guardadas para o relatório
+const resumeAuditRecent = 50
+
+// ResumeAudit observa as respostas de arquivos grandes e registra o que
+// quebra a retomada de downloads (gerenciadores de download, curl -C):
+// ETag que muda sem o arquivo mudar, Accept-Ranges ausente, ranges sobre
+// corpo comprimido e Range ignorado. Só observa; nenhuma resposta muda
+type ResumeAudit struct {
+	minSize int64
+	lint    []string
+	logger  *Logger
+	now     func() time.Time
+
+	mu     sync.Mutex
+	paths  map[string]resumeAuditState // caminho -> última resposta completa
+	logged map[string]bool             // problema + caminho já registrados no log
+	counts map[string]int64
+	recent []ResumeAuditEvent
+}
+
+// resumeAuditState representação servida por último num caminho
+type resumeAuditState struct {
+	etag         string
+	lastModified string
+	size         int64 // tamanho completo (-1 se desconhecido)
+	encoding     string
+}
+
+// ResumeAuditEvent ocorrência de um problema, como no relatório
+type ResumeAuditEvent struct {
+	Time   time.Time `json:"time"`
+	Issue  string    `json:"issue"`
+	Path   string    `json:"path"`
+	Detail string    `json:"detail"`
+}
+
+// NewResumeAudit cria a auditoria; lint são os avisos da configuração
+func NewResumeAudit(config *ResumeAuditConfig, lint []string, logger *Logger) (*ResumeAudit, error) {
+	if config.MinSize < 0 {
+		return nil, fmt.Errorf("resume audit: min_size must not be negative")
+	}
+	a := &ResumeAudit{
+		minSize: config.MinSize,
+		lint:    lint,
+		logger:  logger,
+		now:     time.Now,
+		paths:   make(map[string]resumeAuditState),
+		logged:  make(map[string]bool),
+		counts:  make(map[string]int64),
+	}
+	if a.minSize == 0 {
+		a.minSize = 1 << 20
+	}
+	return a, nil
+}
+
+// contentRangeSize retorna o tamanho completo de um Content-Range
+// ("bytes 0-99/1000"), ou -1
+func contentRangeSize(header string) int64 {
+	_, total, ok := strings.Cut(header, "/")
+	if !ok {
+		return -1
+	}
+	size, err := strconv.ParseInt(total, 10, 64)
+	if err != nil {
+		return -1
+	}
+	return size
+}
+
+// Check examina uma resposta e retorna os problemas encontrados
+func (a *ResumeAudit) Check(r *http.Request, status int, h http.Header) []ResumeAuditEvent {
+	if (r.Method != http.MethodGet && r.Method != http.MethodHead) ||
+		(status != http.StatusOK && status != http.StatusPartialContent) {
+		return nil
+	}
+	state := resumeAuditState{
+		etag:         h.Get("ETag"),
+		lastModified: h.Get("Last-Modified"),
+		size:         -1,
+		encoding:     h.Get("Content-Encoding"),
+	}
+	if status == http.StatusPartialContent {
+		state.size = contentRangeSize(h.Get("Content-Range"))
+	} else if n, err := strconv.ParseInt(h.Get("Content-Length"), 10, 64); err == nil {
+		state.size = n
+	}
+	ranges := h.Get("Accept-Ranges") == "bytes"
+	requested := r.Header.Get("Range") != ""
+
+	// Respostas pequenas não são retomadas; tamanho desconhecido (compressão
+	// na hora) e respostas parciais sempre contam
+	if status == http.StatusOK && !requested && state.size >= 0 && state.size < a.minSize {
+		return nil
+	}
+
+	var issues []ResumeAuditEvent
+	issue := func(name, detail string) {
+		issues = append(issues, ResumeAuditEvent{Time: a.now(), Issue: name, Path: r.URL.Path, Detail: detail})
+	}
+	switch {
+	case status == http.StatusOK && state.encoding != "" && ranges && state.size < 0:
+		issue("compressed_ranges", "Accept-Ranges on a body compressed on the fly ("+state.encoding+"): a resumed Range returns bytes of another representation")
+	case status == http.StatusOK && !ranges && h.Get("Content-Type") != "text/event-stream":
+		issue("missing_accept_ranges", "large response without Accept-Ranges: bytes, download managers restart from zero")
+	}
+	if status == http.StatusOK && requested && r.Header.Get("If-Range") == "" {
+		issue("range_ignored", "Range "+r.Header.Get("Range")+" answered with the full body")
+	}
+	if strings.HasPrefix(state.etag, "W/") && (ranges || status == http.StatusPartialContent) {
+		issue("weak_etag", "weak ETag "+state.etag+" cannot validate If-Range, resumes restart from zero")
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if previous, ok := a.paths[r.URL.Path]; ok && state.etag != "" && previous.etag != "" {
+		switch {
+		case previous.etag == state.etag && previous.encoding != state.encoding && status == http.StatusPartialContent:
+			issue("encoding_mismatch", fmt.Sprintf("ETag %s was served with Content-Encoding %q and now a range with %q", state.etag, previous.encoding, state.encoding))
+		case previous.etag != state.etag && previous.encoding == state.encoding && previous.size == state.size &&
+			previous.lastModified == state.lastModified && state.lastModified != "":
+			issue("changing_etag", fmt.Sprintf("ETag changed from %s to %s with the same size and Last-Modified", previous.etag, state.etag))
+		}
+	}
+	if _, ok := a.paths[r.URL.Path]; status == http.StatusOK || !ok {
+		if len(a.paths) >= maxResumeAuditPaths {
+			a.paths = make(map[string]resumeAuditState)
+		}
+		a.paths[r.URL.Path] = state
+	}
+	return issues
+}
+
+// record contabiliza os problemas e registra no log a primeira ocorrência de
+// cada um por caminho
+func (a *ResumeAudit) record(issues []ResumeAuditEvent) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, event := range issues {
+		a.counts[event.Issue]++
+		a.recent = append(a.recent, event)
+		if len(a.recent) > resumeAuditRecent {
+			a.recent = a.recent[len(a.recent)-resumeAuditRecent:]
+		}
+		key := event.Issue + "\x00" + event.Path
+		if a.logged[key] {
+			continue
+		}
+		if len(a.logged) >= maxResumeAuditPaths {
+			a.logged = make(map[string]bool)
+		}
+		a.logged[key] = true
+		a.logger.Warn("Resume audit: %s on %s: %s", event.Issue, event.Path, event.Detail)
+	}
+}
+
+// ResumeAuditMiddleware audita as respostas; fica antes da compressão para
+// ver os headers finais
+func ResumeAuditMiddleware(a *ResumeAudit) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rw := &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+			next.ServeHTTP(rw, r)
+			if issues := a.Check(r, rw.statusCode, w.Header()); len(issues) > 0 {
+				for _, event := range issues {
+					debugNote(r, "resume_audit", event.Issue)
+				}
+				a.record(issues)
+			}
+		})
+	}
+}
+
+// ResumeAuditReport relatório da auditoria
+type ResumeAuditReport struct {
+	Issues map[string]int64   `json:"issues"`
+	Recent []ResumeAuditEvent `json:"recent"`
+	Config []string           `json:"config"` // avisos do lint da configuração
+}
+
+// Report retorna as contagens, as ocorrências recentes (mais novas primeiro)
+// e os avisos da configuração
+func (a *ResumeAudit) Report() ResumeAuditReport {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	report := ResumeAuditReport{Issues: make(map[string]int64), Recent: []ResumeAuditEvent{}, Config: a.lint}
+	for issue, n := range a.counts {
+		report.Issues[issue] = n
+	}
+	for i := len(a.recent) - 1; i >= 0; i-- {
+		report.Recent = append(report.Recent, a.recent[i])
+	}
+	if report.Config == nil {
+		report.Config = []string{}
+	}
+	return report
+}
+
+// handleAdminResumeAudit retorna o relatório da auditoria de retomada
+func (s *Server) handleAdminResumeAudit(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.resumeAudit.Report())
+}
+
+// WriteMetrics exporta os problemas encontrados por tipo
+func (a *ResumeAudit) WriteMetrics(w io.Writer) {
+	a.mu.Lock()
+	issues := make([]string, 0, len(a.counts))
+	for issue := range a.counts {
+		issues = append(issues, issue)
+	}
+	sort.Strings(issues)
+	samples := make([]metricSample, 0, len(issues))
+	for _, issue := range issues {
+		samples = append(samples, metricSample{labels: map[string]string{"issue": issue}, value: float64(a.counts[issue])})
+	}
+	a.mu.Unlock()
+
+	writeMetric(w, "qserv_resume_audit_issues_total", "Responses that break download resumption, by issue.", "counter", samples)
+}
+
+// resumabilityLint aponta combinações da configuração que quebram a
+// retomada de downloads
+func resumabilityLint(config *Config) []string {
+	var warnings []string
+	perf := config.Performance
+	if perf.EnableCompression && (perf.Compression == nil || len(perf.Compression.ContentTypes) == 0) {
+		warnings = append(warnings, "performance.enable_compression compresses every content type on the fly: downloads lose Content-Length and a resumed Range returns uncompressed bytes; restrict compression.content_types to text types")
+	}
+	if !perf.EnableETags {
+		warnings = append(warnings, "performance.enable_etags is off: resumes can only be validated by Last-Modified, which has one-second resolution")
+	} else if ec := perf.ETag; ec != nil {
+		if ec.Algorithm == "none" {
+			warnings = append(warnings, "performance.etag.algorithm is none: resumes can only be validated by Last-Modified, which has one-second resolution")
+		}
+		if ec.Weak {
+			warnings = append(warnings, "performance.etag.weak: weak ETags cannot validate If-Range, so download managers restart from zero")
+		}
+		for i, rule := range ec.Rules {
+			if rule.Weak || rule.Algorithm == "none" {
+				warnings = append(warnings, fmt.Sprintf("performance.etag.rules[%d] (%s) uses weak or no ETags: resumes under these paths cannot be validated with If-Range", i, strings.Join(rule.Paths, ", ")))
+			}
+		}
+	}
+	if tc, mc := perf.Throttle, perf.MinTransferRate; tc != nil && tc.Enabled && mc != nil && mc.Enabled {
+		minRate := int64(mc.BytesPerSecond)
+		if minRate <= 0 {
+			minRate = 1024
+		}
+		rates := []int64{tc.ConnectionRate, tc.ClientRate}
+		for _, rule := range tc.Rules {
+			rates = append(rates, rule.ConnectionRate, rule.ClientRate)
+		}
+		for _, rate := range rates {
+			if rate > 0 && rate < minRate {
+				warnings = append(warnings, fmt.Sprintf("performance.throttle allows %d bytes/s, below min_transfer_rate (%d): throttled downloads are aborted and must resume", rate, minRate))
+				break
+			}
+		}
+	}
+	return warnings
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestResumeAuditCompressedRanges(t *testing.T) {
+	root := t.TempDir()
+	writeTestFile(t, root+"/big.bin", strings.Repeat("x", 3000))
+	writeTestFile(t, root+"/small.bin", "x")
+	server := newListingTestServer(t, root, func(c *Config) {
+		c.Performance.EnableCompression = true
+		c.Performance.EnableETags = true
+		c.Logging.ResumeAudit = &ResumeAuditConfig{Enabled: true, MinSize: 1000}
+	})
+
+	// A download compressed on the fly still advertises ranges over the original bytes
+	req := httptest.NewRequest("GET", "/big.bin", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	server.mux.ServeHTTP(httptest.NewRecorder(), req)
+
+	// Small files and plain downloads are fine
+	server.mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/small.bin", nil))
+	server.mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/big.bin", nil))
+
+	report := server.resumeAudit.Report()
+	if len(report.Issues) != 1 || report.Issues["compressed_ranges"] != 1 {
+		t.Errorf("Expected one compressed_ranges issue, got %v", report.Issues)
+	}
+	if len(report.Recent) != 1 || report.Recent[0].Path != "/big.bin" {
+		t.Errorf("Expected the recent issue for /big.bin, got %+v", report.Recent)
+	}
+	if len(report.Config) == 0 || !strings.Contains(report.Config[0], "enable_compression") {
+		t.Errorf("Expected a config warning about compression, got %v", report.Config)
+	}
+
+	var b strings.Builder
+	server.resumeAudit.WriteMetrics(&b)
+	if !strings.Contains(b.String(), `qserv_resume_audit_issues_total{issue="compressed_ranges"} 1`) {
+		t.Errorf("Expected the issue in metrics, got %s", b.String())
+	}
+}
+
+func TestResumeAuditCheck(t *testing.T) {
+	audit, err := NewResumeAudit(&ResumeAuditConfig{Enabled: true, MinSize: 100}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := func(kv ...string) http.Header {
+		h := http.Header{}
+		for i := 0; i < len(kv); i += 2 {
+			h.Set(kv[i], kv[i+1])
+		}
+		return h
+	}
+	issues := func(req *http.Request, status int, h http.Header) []string {
+		var names []string
+		for _, event := range audit.Check(req, status, h) {
+			names = append(names, event.Issue)
+		}
+		return names
+	}
+	get := func(path, rangeHeader string) *http.Request {
+		req := httptest.NewRequest("GET", path, nil)
+		if rangeHeader != "" {
+			req.Header.Set("Range", rangeHeader)
+		}
+		return req
+	}
+	modified := "Mon, 01 Jan 2024 00:00:00 GMT"
+
+	for _, tc := range []struct {
+		name   string
+		req    *http.Request
+		status int
+		header http.Header
+		want   string
+	}{
+		{"clean", get("/a", ""), 200, header("Content-Length", "1000", "Accept-Ranges", "bytes", "ETag", `"1"`, "Last-Modified", modified), ""},
+		{"small", get("/small", ""), 200, header("Content-Length", "10"), ""},
+		{"missing accept ranges", get("/b", ""), 200, header("Content-Length", "1000"), "missing_accept_ranges"},
+		{"range ignored", get("/c", "bytes=10-"), 200, header("Content-Length", "1000", "Accept-Ranges", "bytes"), "range_ignored"},
+		{"weak etag", get("/d", ""), 200, header("Content-Length", "1000", "Accept-Ranges", "bytes", "ETag", `W/"1"`), "weak_etag"},
+		// Same size and date, different ETag: a resume with If-Range restarts
+		{"changing etag", get("/a", ""), 200, header("Content-Length", "1000", "Accept-Ranges", "bytes", "ETag", `"2"`, "Last-Modified", modified), "changing_etag"},
+		{"gzip full", get("/e", ""), 200, header("Content-Length", "500", "Accept-Ranges", "bytes", "ETag", `"e"`, "Content-Encoding", "gzip"), ""},
+		{"encoding mismatch", get("/e", "bytes=100-"), 206, header("Content-Range", "bytes 100-999/1000", "Accept-Ranges", "bytes", "ETag", `"e"`), "encoding_mismatch"},
+		{"other methods", httptest.NewRequest("POST", "/f", nil), 200, header("Content-Length", "1000"), ""},
+	} {
+		got := strings.Join(issues(tc.req, tc.status, tc.header), ",")
+		if got != tc.want {
+			t.Errorf("%s: Expected issues %q, got %q", tc.name, tc.want, got)
+		}
+	}
+}
+
+func TestResumabilityLint(t *testing.T) {
+	config := DefaultConfig()
+	config.Performance.EnableCompression = false
+	config.Performance.EnableETags = true
+	if warnings := resumabilityLint(config); len(warnings) != 0 {
+		t.Errorf("Expected no warnings, got %v", warnings)
+	}
+
+	config.Performance.ETag = &ETagConfig{Algorithm: "mtime", Rules: []ETagRule{{Paths: []string{"/isos/**"}, Algorithm: "mtime", Weak: true}}}
+	config.Performance.Throttle = &ThrottleConfig{Enabled: true, ConnectionRate: 512}
+	config.Performance.MinTransferRate = &MinTransferRateConfig{Enabled: true}
+	warnings := strings.Join(resumabilityLint(config), "\n")
+	for _, want := range []string{"etag.rules[0] (/isos/**)", "512 bytes/s, below min_transfer_rate (1024)"} {
+		if !strings.Contains(warnings, want) {
+			t.Errorf("Expected a warning containing %q, got %s", want, warnings)
+		}
+	}
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// rootSnapshot representa uma versão do diretório raiz sendo servida.
+// Cada requisição fixa o snapshot ativo no início, de modo que uma troca
+// de raiz nunca mistura arquivos de duas versões na mesma resposta.
+type rootSnapshot struct {
+	dir     string // caminho resolvido (sem symlinks)
+	source  string // caminho configurado (pode ser um symlink)
+	refs    atomic.Int64
+	retired atomic.Bool
+	drained chan struct{}
+	once    sync.Once
+}
+
+// rootContextKey chave do snapshot no contexto da requisição
+type rootContextKey struct{}
+
+// resolveRoot resolve o caminho absoluto do diretório, seguindo symlinks
+func resolveRoot(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	resolved, err := filepath.EvalSymlinks(abs)
+	if err != nil {
+		return "", err
+	}
+	info, err := os.Stat(resolved)
+	if err != nil {
+		return "", err
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("root path is not a directory: %s", path)
+	}
+	return resolved, nil
+}
+
+// newRootSnapshot cria um snapshot para o caminho informado
+func newRootSnapshot(source string) (*rootSnapshot, error) {
+	dir, err := resolveRoot(source)
+	if err != nil {
+		return nil, err
+	}
+	return &rootSnapshot{dir: dir, source: source, drained: make(chan struct{})}, nil
+}
+
+// release libera a referência obtida por acquireRoot
+func (snap *rootSnapshot) release() {
+	if snap.refs.Add(-1) == 0 && snap.retired.Load() {
+		snap.once.Do(func() { close(snap.drained) })
+	}
+}
+
+// retire marca o snapshot como substituído; drained é fechado quando
+// a última requisição em andamento terminar
+func (snap *rootSnapshot) retire() {
+	snap.retired.Store(true)
+	if snap.refs.Load() == 0 {
+		snap.once.Do(func() { close(snap.drained) })
+	}
+}
+
+// acquireRoot obtém uma referência ao snapshot ativo
+func (s *Server) acquireRoot() *rootSnapshot {
+	for {
+		snap := s.root.Load()
+		snap.refs.Add(1)
+		if s.root.Load() == snap {
+			return snap
+		}
+		snap.release()
+	}
+}
+
+// RootDir retorna o diretório raiz ativo
+func (s *Server) RootDir() string {
+	return s.root.Load().dir
+}
+
+// requestRoot retorna o diretório raiz fixado para a requisição
+func (s *Server) requestRoot(r *http.Request) string {
+	if dir, ok := r.Context().Value(rootContextKey{}).(string); ok {
+		return dir
+	}
+	return s.RootDir()
+}
+
+// withRoot fixa o snapshot ativo durante a execução do handler
+func (s *Server) withRoot(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		snap := s.acquireRoot()
+		defer snap.release()
+
+		ctx := context.WithValue(r.Context(), rootContextKey{}, snap.dir)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// SwapRoot troca atomicamente o diretório raiz servido. Se path for vazio,
+// o caminho configurado atual é resolvido novamente, o que permite publicar
+// uma nova versão apenas reapontando um symlink (ex: current -> releases/v2).
+// Requisições em andamento terminam usando o diretório anterior.
+func (s *Server) SwapRoot(path string) (previous, current *rootSnapshot, err error) {
+	s.rootMu.Lock()
+	defer s.rootMu.Unlock()
+
+	old := s.root.Load()
+	if path == "" {
+		path = old.source
+	}
+
+	next, err := newRootSnapshot(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Conteúdo adulterado nunca chega a ser servido
+	if s.integrity != nil {
+		if err := s.integrity.CheckRoot(next.dir); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	s.root.Store(next)
+	old.retire()
+
+	s.logger.Info("Root directory switched: %s -> %s", old.dir, next.dir)
+	s.jobs.Queue("root-index", "root-swap")
+	s.jobs.Queue("precompress", "root-swap")
+	s.jobs.Queue("hash-index", "root-swap")
+	if s.packageRepos != nil {
+		for i := range s.packageRepos.config.Repos {
+			s.jobs.Queue(pkgRepoJob(&s.packageRepos.config.Repos[i]), "root-swap")
+		}
+	}
+	if s.fileWebhooks != nil {
+		go s.fileWebhooks.SwapRoot(old.dir, next.dir)
+	}
+	go func() {
+		<-old.drained
+		s.logger.Debug("Previous root drained: %s", old.dir)
+	}()
+
+	return old, next, nil
+}
+
+// pruneSnapshots remove os snapshots mais antigos de dir, mantendo keep
+// snapshots além do diretório raiz ativo
+func (s *Server) pruneSnapshots(dir string, keep int) {
+	if keep <= 0 {
+		keep = 2
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+
+	type snapshot struct {
+		path    string
+		modTime time.Time
+	}
+
+	current := s.RootDir()
+	var snapshots []snapshot
+	for _, entry := range entries {
+		if !entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		if resolved, err := resolveRoot(path); err == nil && resolved == current {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		snapshots = append(snapshots, snapshot{path: path, modTime: info.ModTime()})
+	}
+
+	// Mais recentes primeiro
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].modTime.After(snapshots[j].modTime)
+	})
+
+	for i := keep - 1; i < len(snapshots); i++ {
+		if err := os.RemoveAll(snapshots[i].path); err != nil {
+			s.logger.Warn("Failed to remove old snapshot %s: %v", snapshots[i].path, err)
+		}
+	}
+}
+
+// handleAdminGetRoot informa o diretório raiz ativo
+func (s *Server) handleAdminGetRoot(w http.ResponseWriter, r *http.Request) {
+	snap := s.root.Load()
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"root_dir":        snap.dir,
+		"source":          snap.source,
+		"active_requests": snap.refs.Load(),
+	})
+}
+
+// handleAdminSwapRoot troca o diretório raiz ({"root_dir": "..."})
+func (s *Server) handleAdminSwapRoot(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		RootDir string `json:"root_dir"`
+	}
+	if r.ContentLength != 0 {
+		if err := decodeJSON(r, &req); err != nil {
+			writeJSONError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	previous, current, err := s.SwapRoot(req.RootDir)
+	if err != nil {
+		writeJSONError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"previous":          previous.dir,
+		"root_dir":          current.dir,
+		"draining_requests": previous.refs.Load(),
+	})
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// route handler montado sob um prefixo de URL
+type route struct {
+	prefix  string
+	handler http.Handler
+}
+
+// mount registra um handler para todas as URLs sob prefix. O prefixo mais
+// longo tem precedência; o restante cai no handler de arquivos.
+func (s *Server) mount(prefix string, handler http.Handler) {
+	if !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	s.routes = append(s.routes, route{prefix: prefix, handler: handler})
+	sort.SliceStable(s.routes, func(i, j int) bool {
+		return len(s.routes[i].prefix) > len(s.routes[j].prefix)
+	})
+}
+
+// routeHandler despacha para os handlers montados antes de servir arquivos
+func (s *Server) routeHandler(next http.Handler) http.Handler {
+	if len(s.routes) == 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, rt := range s.routes {
+			if strings.HasPrefix(r.URL.Path, rt.prefix) {
+				debugNote(r, "mount", rt.prefix)
+				rt.handler.ServeHTTP(w, r)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
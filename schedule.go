@@ -0,0 +1,203 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// scheduleWindow janela de publicação já interpretada
+type scheduleWindow struct {
+	paths           []string
+	publish, expire time.Time
+}
+
+// compileScheduleWindow interpreta as datas de uma regra
+func compileScheduleWindow(rule ScheduleRule) (scheduleWindow, error) {
+	sw := scheduleWindow{paths: rule.Paths}
+	loc := time.Local
+	if rule.Timezone != "" {
+		var err error
+		if loc, err = time.LoadLocation(rule.Timezone); err != nil {
+			return sw, fmt.Errorf("invalid timezone %q: %w", rule.Timezone, err)
+		}
+	}
+
+	var err error
+	if sw.publish, err = parseWindowTime(rule.Publish, loc); err != nil {
+		return sw, fmt.Errorf("invalid publish: %w", err)
+	}
+	if sw.expire, err = parseWindowTime(rule.Expire, loc); err != nil {
+		return sw, fmt.Errorf("invalid expire: %w", err)
+	}
+	if !sw.publish.IsZero() && !sw.expire.IsZero() && !sw.publish.Before(sw.expire) {
+		return sw, fmt.Errorf("publish must be earlier than expire")
+	}
+	return sw, nil
+}
+
+// Schedule publicação e expiração programadas, por regras e arquivos sidecar
+type Schedule struct {
+	config *ScheduleConfig
+	logger *Logger
+	rules  []scheduleWindow
+	now    func() time.Time
+}
+
+// NewSchedule cria o agendamento a partir da configuração
+func NewSchedule(config *ScheduleConfig, logger *Logger) (*Schedule, error) {
+	if config.ExpiredStatus != 0 && config.ExpiredStatus != http.StatusNotFound && config.ExpiredStatus != http.StatusGone {
+		return nil, fmt.Errorf("invalid expired_status %d (use 404 or 410)", config.ExpiredStatus)
+	}
+	sc := &Schedule{config: config, logger: logger, now: time.Now}
+	for i, rule := range config.Rules {
+		if len(rule.Paths) == 0 {
+			return nil, fmt.Errorf("schedule rule %d: paths is required", i)
+		}
+		sw, err := compileScheduleWindow(rule)
+		if err != nil {
+			return nil, fmt.Errorf("schedule rule %d: %w", i, err)
+		}
+		sc.rules = append(sc.rules, sw)
+	}
+	return sc, nil
+}
+
+// expiredStatus retorna o status para conteúdo expirado
+func (sc *Schedule) expiredStatus() int {
+	if sc.config.ExpiredStatus == 0 {
+		return http.StatusGone
+	}
+	return sc.config.ExpiredStatus
+}
+
+// sidecarSuffix retorna o sufixo dos arquivos sidecar
+func (sc *Schedule) sidecarSuffix() string {
+	if sc.config.SidecarSuffix == "" {
+		return ".schedule.json"
+	}
+	return sc.config.SidecarSuffix
+}
+
+// IsSidecar informa se o nome é de um arquivo de agendamento
+func (sc *Schedule) IsSidecar(name string) bool {
+	suffix := sc.sidecarSuffix()
+	return sc.config.Sidecar && strings.HasSuffix(name, suffix) && len(name) > len(suffix)
+}
+
+// sidecar lê o agendamento ao lado de diskPath, se houver
+func (sc *Schedule) sidecar(diskPath string) (scheduleWindow, bool, error) {
+	data, err := os.ReadFile(diskPath + sc.sidecarSuffix())
+	if os.IsNotExist(err) {
+		return scheduleWindow{}, false, nil
+	}
+	if err != nil {
+		return scheduleWindow{}, false, err
+	}
+	var rule ScheduleRule
+	if err := json.Unmarshal(data, &rule); err != nil {
+		return scheduleWindow{}, false, err
+	}
+	sw, err := compileScheduleWindow(rule)
+	return sw, err == nil, err
+}
+
+// check avalia um único componente do caminho; retorna o status de
+// rejeição (0 se publicado) e a expiração mais próxima
+func (sc *Schedule) check(urlPath, diskPath string, now time.Time) (int, time.Time) {
+	var expire time.Time
+	evaluate := func(sw scheduleWindow) int {
+		if !sw.publish.IsZero() && now.Before(sw.publish) {
+			return http.StatusNotFound
+		}
+		if !sw.expire.IsZero() {
+			if !now.Before(sw.expire) {
+				return sc.expiredStatus()
+			}
+			if expire.IsZero() || sw.expire.Before(expire) {
+				expire = sw.expire
+			}
+		}
+		return 0
+	}
+
+	for _, sw := range sc.rules {
+		for _, pattern := range sw.paths {
+			if matchGlob(pattern, urlPath) {
+				if status := evaluate(sw); status != 0 {
+					return status, time.Time{}
+				}
+				break
+			}
+		}
+	}
+
+	if sc.config.Sidecar {
+		sw, ok, err := sc.sidecar(diskPath)
+		if err != nil {
+			// Sidecar ilegível: na dúvida, o conteúdo continua embargado
+			sc.logger.Error("Schedule sidecar for %s: %v", diskPath, err)
+			return http.StatusNotFound, time.Time{}
+		}
+		if ok {
+			if status := evaluate(sw); status != 0 {
+				return status, time.Time{}
+			}
+		}
+	}
+	return 0, expire
+}
+
+// Status avalia path (dentro de root) e todos os diretórios acima dele:
+// 404 antes da publicação, expired_status depois da expiração, 0 se
+// publicado. Para conteúdo publicado, expire traz a expiração mais próxima.
+func (sc *Schedule) Status(root, path string) (status int, expire time.Time) {
+	rel, err := filepath.Rel(root, path)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return 0, time.Time{}
+	}
+
+	now := sc.now()
+	urlPath, diskPath := "", root
+	for _, name := range strings.Split(filepath.ToSlash(rel), "/") {
+		urlPath += "/" + name
+		diskPath = filepath.Join(diskPath, name)
+		if sc.IsSidecar(name) {
+			return http.StatusNotFound, time.Time{}
+		}
+		s, e := sc.check(urlPath, diskPath, now)
+		if s != 0 {
+			return s, time.Time{}
+		}
+		if !e.IsZero() && (expire.IsZero() || e.Before(expire)) {
+			expire = e
+		}
+	}
+	return 0, expire
+}
+
+// Listed informa se a entrada name do diretório dir (já publicado) aparece na listagem
+func (sc *Schedule) Listed(root, dir, name string) bool {
+	if sc.IsSidecar(name) {
+		return false
+	}
+	rel, err := filepath.Rel(root, filepath.Join(dir, name))
+	if err != nil {
+		return true
+	}
+	status, _ := sc.check("/"+filepath.ToSlash(rel), filepath.Join(dir, name), sc.now())
+	return status == 0
+}
+
+// limitCacheLifetime reduz o max-age para que caches não guardem o
+// conteúdo além da expiração
+func limitCacheLifetime(h http.Header, expire, now time.Time) {
+	remaining := expire.Sub(now).Truncate(time.Second)
+	if maxAge, ok := directiveSeconds(parseCacheControl(h), "max-age"); ok && maxAge > remaining {
+		h.Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(remaining.Seconds())))
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestScheduledPublishing(t *testing.T) {
+	root := t.TempDir()
+	os.MkdirAll(filepath.Join(root, "releases", "v2"), 0755)
+	os.WriteFile(filepath.Join(root, "releases", "v2", "app.zip"), []byte("zip"), 0644)
+	os.WriteFile(filepath.Join(root, "old.pdf"), []byte("old"), 0644)
+	os.WriteFile(filepath.Join(root, "old.pdf.schedule.json"), []byte(`{"expire": "2026-01-01T00:00:00Z"}`), 0644)
+	os.WriteFile(filepath.Join(root, "notes.txt"), []byte("notes"), 0644)
+	os.WriteFile(filepath.Join(root, "notes.txt.schedule.json"), []byte(`{"expire": "2026-03-10T12:01:00Z"}`), 0644)
+
+	server := newListingTestServer(t, root, func(c *Config) {
+		c.Performance.EnableCache = true
+		c.Performance.CacheMaxAge = 3600
+		c.Features.Schedule = &ScheduleConfig{
+			Enabled: true,
+			Sidecar: true,
+			Rules:   []ScheduleRule{{Paths: []string{"/releases/v2"}, Publish: "2026-03-10T15:00:00Z"}},
+		}
+	})
+	server.schedule.now = func() time.Time { return time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC) }
+
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		server.mux.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w
+	}
+
+	if w := get("/releases/v2/app.zip"); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 before publication, got %d", w.Code)
+	}
+	if w := get("/old.pdf"); w.Code != http.StatusGone {
+		t.Errorf("Expected 410 after expiry, got %d", w.Code)
+	}
+	if w := get("/old.pdf.schedule.json"); w.Code != http.StatusNotFound {
+		t.Errorf("Expected sidecar to be hidden, got %d", w.Code)
+	}
+	w := get("/notes.txt")
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected 200 inside the window, got %d", w.Code)
+	}
+	if cc := w.Header().Get("Cache-Control"); cc != "public, max-age=60" {
+		t.Errorf("Expected max-age capped at expiry, got %q", cc)
+	}
+
+	// Listing hides unpublished, expired and sidecar entries
+	w = httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/?format=json", nil)
+	server.mux.ServeHTTP(w, req)
+	var listing struct {
+		Entries []listingEntry `json:"entries"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &listing); err != nil {
+		t.Fatalf("Invalid listing JSON: %v", err)
+	}
+	var names []string
+	for _, e := range listing.Entries {
+		names = append(names, e.Name)
+	}
+	if len(names) != 2 || names[0] != "releases" || names[1] != "notes.txt" {
+		t.Errorf("Expected [releases notes.txt] in listing, got %v", names)
+	}
+	w = httptest.NewRecorder()
+	server.mux.ServeHTTP(w, httptest.NewRequest("GET", "/releases/?format=json", nil))
+	if err := json.Unmarshal(w.Body.Bytes(), &listing); err != nil || len(listing.Entries) != 0 {
+		t.Errorf("Expected v2 hidden from /releases/ listing, got %s", w.Body.String())
+	}
+
+	server.schedule.now = func() time.Time { return time.Date(2026, 3, 10, 15, 0, 0, 0, time.UTC) }
+	if w := get("/releases/v2/app.zip"); w.Code != http.StatusOK {
+		t.Errorf("Expected 200 after publication, got %d", w.Code)
+	}
+	if w := get("/notes.txt"); w.Code != http.StatusGone {
+		t.Errorf("Expected 410 after sidecar expiry, got %d", w.Code)
+	}
+}
+
+func TestScheduleInvalidConfig(t *testing.T) {
+	for _, config := range []*ScheduleConfig{
+		{ExpiredStatus: 403},
+		{Rules: []ScheduleRule{{Publish: "2026-01-01"}}},
+		{Rules: []ScheduleRule{{Paths: []string{"/a"}, Publish: "soon"}}},
+		{Rules: []ScheduleRule{{Paths: []string{"/a"}, Publish: "2026-02-01", Expire: "2026-01-01"}}},
+	} {
+		if _, err := NewSchedule(config, nil); err == nil {
+			t.Errorf("Expected error for %+v", config)
+		}
+	}
+}
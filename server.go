@@ -1,31 +1,656 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
-	"html/template"
 	"io/fs"
+	"net"
 	"net/http"
 	"os"
 	"path/filepath"
-	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // Server representa o servidor HTTP
 type Server struct {
-	config *Config
-	logger *Logger
-	mux    *http.ServeMux
+	config       *Config
+	logger       *Logger
+	mux          *http.ServeMux
+	adminMux     *http.ServeMux
+	root         atomic.Pointer[rootSnapshot]
+	rootMu       sync.Mutex
+	git          *GitSyncer
+	deployer     *Deployer
+	integrity    *IntegrityVerifier
+	caches       []Purger
+	cachesMu     sync.Mutex
+	routes       []route
+	notFound     *NotFoundCache
+	metrics      []MetricsCollector
+	metricsMu    sync.Mutex
+	downloads    *DownloadStats
+	dlSessions   *DownloadSessions
+	traffic      *TrafficStats
+	challenge    *Challenge
+	precompress  *Precompressor
+	memCache     *MemoryCache
+	schedule     *Schedule
+	tombstones   *Tombstones
+	listingRules *ListingRules
+	archives     *Archiver
+	torrents     *Torrents
+	zsync        *Zsync
+	packageRepos *PackageRepos
+	mirrors      *MirrorRedirector
+	panics       *PanicStats
+	etags        *ETagger
+	hashIndex    *HashIndex
+	versions     *Versions
+	quotas       *Quotas
+	uploads      *Uploads
+	upProgress   *UploadProgress
+	webdav       *WebDAV
+	byteLimits   *DownloadLimits
+	hotlink      *Hotlink
+	signedCookie *SignedCookies
+	janitor      *Janitor
+	jobs         *Jobs
+	rootIndex    *RootIndex
+	theme        *Theme
+	codeView     *CodeView
+	tail         *LogTail
+	textSlices   *TextSlices
+	diskUsage    *DiskUsage
+	feeds        *Feeds
+	fileWebhooks *FileWebhooks
+	ftp          *FTPServer
+	fileAPI      *FileAPI
+	registry     *Registry
+	goProxy      *GoProxy
+	pypi         *PyPI
+	npm          *Npm
+	maven        *Maven
+	probe        *Probe
+	resumeAudit  *ResumeAudit
+	certMonitor  *CertMonitor
+	ocsp         *OCSPStapler
+	ech          *ECHKeys
+	tickets      *TicketKeys
+	cluster      *Cluster
+	redis        *RedisStore
+	tracer       *Tracer
+	hostLimits   *HostLimits
+	throttle     *Throttle
+	tailnet      *Tailnet
+	limiter      *RateLimiter
+	reloader     *Reloader
+	vhosts       []*vhost
+	diskIO       *DiskIO
+	uring        *IOURing // nil fora do Linux ou sem performance.io_uring
+
+	// Handler principal sem middlewares e a cadeia montada da configuração
+	// ativa; edge é o mux atrás dos filtros de Host e de clientes
+	app    http.Handler
+	chain  atomic.Pointer[http.Handler]
+	edge   atomic.Pointer[http.Handler]
+	access atomic.Pointer[resourceAccess]
+	active atomic.Pointer[Config]
+
+	serversMu sync.Mutex
+	servers   []*http.Server // encerrados por Shutdown
+	closing   bool
+	stop      chan struct{} // fechado por Shutdown: encerra os streams longos (SSE)
 }
 
 // NewServer cria uma nova instância do servidor
 func NewServer(config *Config, logger *Logger) *Server {
-	return &Server{
+	s := &Server{
 		config: config,
 		logger: logger,
 		mux:    http.NewServeMux(),
+		stop:   make(chan struct{}),
 	}
+
+	s.panics = &PanicStats{}
+	s.registerMetrics(s.panics)
+
+	s.jobs = NewJobs(config.Jobs, logger)
+	s.registerMetrics(s.jobs)
+
+	// Auditoria da retomada de downloads, com o lint da configuração
+	if ac := config.Logging.ResumeAudit; ac != nil && ac.Enabled {
+		lint := resumabilityLint(config)
+		for _, warning := range lint {
+			logger.Warn("Resume audit: config: %s", warning)
+		}
+		audit, err := NewResumeAudit(ac, lint, logger)
+		if err != nil {
+			logger.Error("Resume audit disabled: %v", err)
+		} else {
+			s.resumeAudit = audit
+			s.registerMetrics(audit)
+		}
+	}
+
+	theme, err := NewTheme(config.Features.Theme)
+	if err != nil {
+		logger.Error("Theme ignored: %v", err)
+		theme, _ = NewTheme(nil)
+	}
+	s.theme = theme
+
+	snap, err := newRootSnapshot(config.Server.RootDir)
+	if err != nil {
+		// Mantém o caminho como informado; erros aparecem ao servir
+		snap = &rootSnapshot{dir: config.Server.RootDir, source: config.Server.RootDir, drained: make(chan struct{})}
+	}
+	s.root.Store(snap)
+
+	if config.Index != nil && config.Index.Enabled {
+		s.rootIndex = NewRootIndex(config.Index, logger)
+	}
+
+	if config.Git != nil && config.Git.Enabled {
+		s.git = NewGitSyncer(config.Git, s)
+	}
+
+	if config.Deploy != nil && config.Deploy.Enabled {
+		s.deployer = NewDeployer(config.Deploy, s)
+	}
+
+	if config.Performance.Precompress != nil && config.Performance.Precompress.Enabled {
+		s.precompress = NewPrecompressor(config.Performance.Precompress, logger)
+	}
+
+	if config.Security.Challenge != nil && config.Security.Challenge.Enabled {
+		s.challenge = NewChallenge(config.Security.Challenge, logger)
+		s.challenge.theme = s.theme
+		s.challenge.language = config.Features.Language
+	}
+
+	if sc := config.Features.Schedule; sc != nil && sc.Enabled {
+		schedule, err := NewSchedule(sc, logger)
+		if err != nil {
+			logger.Error("Content schedule disabled: %v", err)
+		} else {
+			s.schedule = schedule
+		}
+	}
+
+	if ts := config.Features.Tombstones; ts != nil && ts.Enabled {
+		s.tombstones = NewTombstones(ts)
+	}
+
+	if cv := config.Features.CodeView; cv != nil && cv.Enabled {
+		s.codeView = NewCodeView(cv)
+	}
+
+	if tc := config.Features.Tail; tc != nil && tc.Enabled {
+		basicAuth := config.Security.BasicAuth != nil && config.Security.BasicAuth.Enabled
+		tail, err := NewLogTail(tc, basicAuth)
+		if err != nil {
+			logger.Error("Log tail disabled: %v", err)
+		} else {
+			s.tail = tail
+			s.registerMetrics(s.tail)
+		}
+	}
+
+	if ts := config.Features.TextSlices; ts != nil && ts.Enabled {
+		s.textSlices = NewTextSlices(ts)
+	}
+
+	if du := config.Features.DiskUsage; du != nil && du.Enabled {
+		s.diskUsage = NewDiskUsage(du)
+		s.diskUsage.index = s.rootIndex
+		s.registerCache(s.diskUsage)
+	}
+
+	if lc := config.Features.Listing; lc != nil {
+		rules, err := NewListingRules(lc)
+		if err != nil {
+			logger.Error("Listing rules disabled: %v", err)
+		} else {
+			s.listingRules = rules
+		}
+	}
+
+	// Operações agrupadas entre requisições simultâneas (métricas)
+	var flights flightGroups
+	if a := config.Features.Archives; a != nil && a.Enabled {
+		s.archives = NewArchiver(a, logger)
+		flights = append(flights, s.archives.flights)
+	}
+
+	if tc := config.Features.Torrents; tc != nil && tc.Enabled {
+		s.torrents = NewTorrents(tc, logger)
+	}
+
+	if zc := config.Features.Zsync; zc != nil && zc.Enabled {
+		zsync, err := NewZsync(zc, logger)
+		if err != nil {
+			logger.Error("Zsync disabled: %v", err)
+		} else {
+			s.zsync = zsync
+		}
+	}
+
+	if pc := config.Features.PackageRepos; pc != nil && pc.Enabled {
+		packageRepos, err := NewPackageRepos(pc, logger)
+		if err != nil {
+			logger.Error("Package repos disabled: %v", err)
+		} else {
+			s.packageRepos = packageRepos
+		}
+	}
+
+	if ca := config.Features.ContentAddress; ca != nil && ca.Enabled {
+		s.hashIndex = NewHashIndex(ca, logger)
+		s.hashIndex.index = s.rootIndex
+		s.mount(s.hashIndex.prefix(), http.HandlerFunc(s.handleContentAddressed))
+	}
+
+	if vc := config.Features.Versioning; vc != nil && vc.Enabled {
+		s.versions = NewVersions(vc, logger)
+	}
+
+	if len(config.Features.Quotas) > 0 {
+		quotas, err := NewQuotas(config.Features.Quotas)
+		if err != nil {
+			logger.Error("Quotas disabled: %v", err)
+		} else {
+			s.quotas = quotas
+		}
+	}
+
+	if uc := config.Features.Uploads; uc != nil && uc.Enabled {
+		uploads, err := NewUploads(uc)
+		if err != nil {
+			logger.Error("Uploads disabled: %v", err)
+		} else {
+			uploads.files = s.createFileHandler()
+			s.uploads = uploads
+			if uc.Progress {
+				s.upProgress = NewUploadProgress(uc.ProgressRoute)
+				s.upProgress.stop = s.stop
+			}
+			for _, prefix := range uc.Prefixes {
+				s.mount(prefix, http.HandlerFunc(s.handleUpload))
+			}
+		}
+	}
+
+	if hc := config.Security.Hotlink; hc != nil && hc.Enabled {
+		hotlink, err := NewHotlink(hc)
+		if err != nil {
+			logger.Error("Hotlink protection disabled: %v", err)
+		} else {
+			s.hotlink = hotlink
+			s.registerMetrics(hotlink)
+		}
+	}
+
+	if sc := config.Security.SignedCookies; sc != nil && sc.Enabled {
+		signedCookies, err := NewSignedCookies(sc)
+		if err != nil {
+			logger.Error("Signed cookies disabled: %v", err)
+		} else {
+			s.signedCookie = signedCookies
+			s.registerMetrics(signedCookies)
+		}
+	}
+
+	if len(config.Features.DownloadLimits) > 0 {
+		limits, err := NewDownloadLimits(config.Features.DownloadLimits)
+		if err != nil {
+			logger.Error("Download limits disabled: %v", err)
+		} else {
+			s.byteLimits = limits
+			s.registerMetrics(limits)
+		}
+	}
+
+	if wc := config.Features.WebDAV; wc != nil && wc.Enabled {
+		webdav, err := NewWebDAV(wc)
+		if err != nil {
+			logger.Error("WebDAV disabled: %v", err)
+		} else {
+			webdav.files = http.StripPrefix(strings.TrimSuffix(wc.prefix(), "/"), s.createFileHandler())
+			s.webdav = webdav
+			s.mount(wc.prefix(), http.HandlerFunc(s.handleWebDAV))
+		}
+	}
+
+	if config.Mirrors != nil && config.Mirrors.Enabled {
+		s.mirrors = NewMirrorRedirector(config.Mirrors)
+	}
+
+	if config.Janitor != nil && config.Janitor.Enabled {
+		s.janitor = NewJanitor(config.Janitor, s)
+		s.registerMetrics(s.janitor)
+	}
+
+	if config.Integrity != nil && config.Integrity.Enabled {
+		verifier, err := NewIntegrityVerifier(config.Integrity, logger)
+		if err != nil {
+			logger.Error("Integrity verification disabled: %v", err)
+		} else {
+			verifier.index = s.rootIndex
+			s.integrity = verifier
+		}
+	}
+
+	if config.Stats != nil && config.Stats.Enabled {
+		s.traffic = NewTrafficStats()
+		s.registerMetrics(s.traffic)
+		s.downloads = NewDownloadStats(config.Stats)
+		s.registerMetrics(s.downloads)
+	}
+
+	if dc := config.Features.DownloadSessions; dc != nil && dc.Enabled {
+		sessions, err := NewDownloadSessions(dc)
+		if err != nil {
+			logger.Error("Download sessions disabled: %v", err)
+		} else {
+			s.dlSessions = sessions
+			s.registerMetrics(sessions)
+		}
+	}
+
+	if ec := config.Performance.ETag; ec != nil {
+		etags, err := NewETagger(ec)
+		if err != nil {
+			logger.Error("ETag configuration ignored: %v", err)
+		} else {
+			etags.index = s.rootIndex
+			s.etags = etags
+		}
+	}
+
+	if nc := config.Performance.NegativeCache; nc != nil && nc.Enabled {
+		s.notFound = NewNotFoundCache(nc, logger)
+		s.registerCache(s.notFound)
+	}
+
+	if dc := config.Performance.DiskIO; dc != nil && dc.Enabled {
+		diskIO, err := NewDiskIO(dc)
+		if err != nil {
+			logger.Error("Disk I/O limits disabled: %v", err)
+		} else {
+			s.diskIO = diskIO
+			s.registerMetrics(diskIO)
+		}
+	}
+
+	if mc := config.Performance.MemoryCache; mc != nil && mc.Enabled {
+		// Guarda as versões comprimidas com os mesmos encodings e níveis do middleware
+		var compression *Compression
+		if config.Performance.EnableCompression {
+			compression, _ = NewCompression(config.Performance.CompressionLevel, config.Performance.Compression)
+		}
+		cache, err := NewMemoryCache(mc, compression)
+		if err != nil {
+			logger.Error("Memory cache disabled: %v", err)
+		} else {
+			s.memCache = cache
+			s.registerCache(cache)
+			s.registerMetrics(cache)
+		}
+	}
+
+	if uc := config.Performance.IOURing; uc != nil && uc.Enabled {
+		uring, err := NewIOURing(uc)
+		if err != nil {
+			logger.Error("io_uring disabled: %v", err)
+		} else {
+			s.uring = uring
+			s.registerMetrics(uring)
+		}
+	}
+
+	if len(config.Performance.HostLimits) > 0 {
+		hostLimits, err := NewHostLimits(config.Performance.HostLimits, config.Server.GetWriteTimeout())
+		if err != nil {
+			logger.Error("Host limits disabled: %v", err)
+		} else {
+			s.hostLimits = hostLimits
+			s.registerMetrics(hostLimits)
+		}
+	}
+
+	if tc := config.Performance.Throttle; tc != nil && tc.Enabled {
+		throttle, err := NewThrottle(tc, config.Server.GetWriteTimeout())
+		if err != nil {
+			logger.Error("Throttle disabled: %v", err)
+		} else {
+			s.throttle = throttle
+			s.registerMetrics(throttle)
+		}
+	}
+
+	if tc := config.Tailscale; tc != nil && tc.Enabled {
+		_, networks, err := tailnetAddrs(tc.Interface)
+		if err != nil {
+			logger.Error("Tailscale: %v (accepting only loopback clients)", err)
+		}
+		s.tailnet = NewTailnet(tc, networks, logger)
+	}
+
+	if tc := config.Logging.Tracing; tc != nil && tc.Enabled {
+		s.tracer = NewTracer(tc, logger)
+		s.registerMetrics(s.tracer)
+	}
+
+	for i := range config.PullThrough {
+		pt := &config.PullThrough[i]
+		mirror, err := NewPullThrough(pt, logger)
+		if err != nil {
+			logger.Error("Pull-through %s disabled: %v", pt.Prefix, err)
+			continue
+		}
+		mirror.tracer = s.tracer
+		flights = append(flights, mirror.flights)
+		s.mount(pt.Prefix, mirror)
+		if mirror.cache != nil {
+			s.registerCache(mirror.cache)
+		}
+		logger.Info("Pull-through mirror of %s at: %s", redactURL(pt.Upstream), pt.Prefix)
+	}
+	if len(flights) > 0 {
+		s.registerMetrics(flights)
+	}
+
+	for i := range config.Proxy {
+		pc := &config.Proxy[i]
+		backend, err := NewProxyBackend(pc, logger)
+		if err != nil {
+			logger.Error("Proxy %s disabled: %v", pc.Prefix, err)
+			continue
+		}
+		backend.tracer = s.tracer
+		s.mount(pc.Prefix, backend)
+		logger.Info("Proxying %s to: %s", pc.Prefix, redactURL(pc.Upstream))
+	}
+
+	if config.Feeds != nil && config.Feeds.Enabled {
+		feeds, err := NewFeeds(config.Feeds)
+		if err != nil {
+			logger.Error("Feeds disabled: %v", err)
+		} else {
+			feeds.index = s.rootIndex
+			s.feeds = feeds
+			s.mount(feeds.prefix(), http.HandlerFunc(s.handleFeed))
+		}
+	}
+
+	if fw := config.FileWebhooks; fw != nil && fw.Enabled {
+		hooks, err := NewFileWebhooks(fw, logger)
+		if err != nil {
+			logger.Error("File webhooks disabled: %v", err)
+		} else {
+			hooks.index = s.rootIndex
+			s.fileWebhooks = hooks
+			s.registerMetrics(s.fileWebhooks)
+		}
+	}
+
+	if config.FTP != nil && config.FTP.Enabled {
+		ftp, err := NewFTPServer(config.FTP, &config.Security, logger)
+		if err != nil {
+			logger.Error("FTP listener disabled: %v", err)
+		} else {
+			ftp.server = s
+			s.ftp = ftp
+			s.registerMetrics(s.ftp)
+		}
+	}
+
+	if config.FileAPI != nil && config.FileAPI.Enabled {
+		api, err := NewFileAPI(config.FileAPI)
+		if err != nil {
+			logger.Error("File API disabled: %v", err)
+		} else {
+			s.fileAPI = api
+			s.mount(fileAPIPrefix, http.HandlerFunc(s.handleFileAPI))
+		}
+	}
+
+	if config.Registry != nil && config.Registry.Enabled {
+		registry, err := NewRegistry(config.Registry)
+		if err != nil {
+			logger.Error("Registry disabled: %v", err)
+		} else {
+			registry.root = s.RootDir
+			s.registry = registry
+			s.mount(registryPrefix, http.HandlerFunc(s.handleRegistry))
+		}
+	}
+
+	if config.GoProxy != nil && config.GoProxy.Enabled {
+		goProxy, err := NewGoProxy(config.GoProxy)
+		if err != nil {
+			logger.Error("Go proxy disabled: %v", err)
+		} else {
+			goProxy.root = s.RootDir
+			s.goProxy = goProxy
+			s.mount(config.GoProxy.prefix(), http.HandlerFunc(s.handleGoProxy))
+		}
+	}
+
+	if config.PyPI != nil && config.PyPI.Enabled {
+		pypi, err := NewPyPI(config.PyPI)
+		if err != nil {
+			logger.Error("PyPI index disabled: %v", err)
+		} else {
+			pypi.root = s.RootDir
+			pypi.index = s.rootIndex
+			s.pypi = pypi
+			s.mount(config.PyPI.prefix(), http.HandlerFunc(s.handlePyPI))
+		}
+	}
+
+	if config.Npm != nil && config.Npm.Enabled {
+		npm, err := NewNpm(config.Npm, logger)
+		if err != nil {
+			logger.Error("npm registry disabled: %v", err)
+		} else {
+			npm.root = s.RootDir
+			s.npm = npm
+			s.mount(config.Npm.prefix(), http.HandlerFunc(s.handleNpm))
+		}
+	}
+
+	if config.Maven != nil && config.Maven.Enabled {
+		maven, err := NewMaven(config.Maven, &config.Security)
+		if err != nil {
+			logger.Error("Maven repository disabled: %v", err)
+		} else {
+			maven.files = s.createFileHandler()
+			s.maven = maven
+			s.mount(config.Maven.prefix(), http.HandlerFunc(s.handleMaven))
+		}
+	}
+
+	if config.Probe != nil && config.Probe.Enabled {
+		probe, err := NewProbe(config.Probe)
+		if err != nil {
+			logger.Error("Probe disabled: %v", err)
+		} else {
+			s.probe = probe
+		}
+	}
+
+	if config.Security.EnableHTTPS {
+		certMonitor, err := NewCertMonitor(config.Security.CertMonitor, config.Security.CertFile, logger)
+		if err != nil {
+			logger.Error("Certificate monitor disabled: %v", err)
+		} else {
+			s.certMonitor = certMonitor
+			s.registerMetrics(certMonitor)
+		}
+	}
+
+	if oc := config.Security.OCSPStapling; oc != nil && oc.Enabled && config.Security.EnableHTTPS {
+		ocsp, err := NewOCSPStapler(oc, config.Security.CertFile, config.Security.KeyFile, logger)
+		if err != nil {
+			logger.Error("OCSP stapling disabled: %v", err)
+		} else {
+			s.ocsp = ocsp
+			s.registerMetrics(ocsp)
+		}
+	}
+
+	if ec := config.Security.ECH; ec != nil && ec.Enabled && config.Security.EnableHTTPS {
+		ech, err := NewECHKeys(ec)
+		if err != nil {
+			logger.Error("ECH disabled: %v", err)
+		} else {
+			s.ech = ech
+		}
+	}
+
+	if tc := config.Security.SessionTickets; tc != nil && tc.Enabled && config.Security.EnableHTTPS {
+		tickets, err := NewTicketKeys(tc, logger)
+		if err != nil {
+			logger.Error("Session ticket rotation disabled: %v", err)
+		} else {
+			s.tickets = tickets
+			s.registerMetrics(tickets)
+		}
+	}
+
+	if config.Cluster != nil && config.Cluster.Enabled {
+		cluster, err := NewCluster(config.Cluster, logger)
+		if err != nil {
+			logger.Error("Cluster mode disabled: %v", err)
+		} else {
+			s.cluster = cluster
+			s.registerMetrics(cluster)
+		}
+	}
+
+	if config.Redis != nil && config.Redis.Enabled {
+		redis, err := NewRedisStore(config.Redis, logger)
+		if err != nil {
+			logger.Error("Redis disabled: %v", err)
+		} else {
+			s.redis = redis
+			s.registerMetrics(redis)
+		}
+	}
+
+	// /.well-known/ (RFC 8615)
+	if config.WellKnown != nil && config.WellKnown.Enabled {
+		s.mount(wellKnownPrefix, NewWellKnown(config.WellKnown, s.createFileHandler()))
+	}
+
+	s.setupVHosts()
+	s.registerJobs()
+	return s
 }
 
 // Start inicia o servidor
@@ -33,122 +658,617 @@ func (s *Server) Start() error {
 	// Configura o handler principal
 	s.setupHandlers()
 
-	// Cria o servidor HTTP
-	addr := fmt.Sprintf("%s:%d", s.config.Server.Host, s.config.Server.Port)
+	addrs, err := s.config.Server.ListenAddrs()
+	if err != nil {
+		return err
+	}
 
-	server := &http.Server{
-		Addr:         addr,
-		Handler:      s.mux,
-		ReadTimeout:  s.config.Server.GetReadTimeout(),
-		WriteTimeout: s.config.Server.GetWriteTimeout(),
+	// Cria o servidor HTTP
+	server := s.httpServer(addrs[0].Address())
+	if !s.track(server) {
+		return nil
 	}
 
 	// Imprime o banner
-	s.logger.PrintBanner(s.config)
+	s.logger.PrintBanner(s.config, addrs)
 
-	// Inicia o servidor
-	if s.config.Security.EnableHTTPS {
-		return server.ListenAndServeTLS(
-			s.config.Security.CertFile,
-			s.config.Security.KeyFile,
-		)
+	// Sincroniza o conteúdo a partir do git antes de aceitar conexões
+	if s.git != nil {
+		s.git.Start()
 	}
 
-	return server.ListenAndServe()
+	// Verifica o conteúdo contra o manifesto assinado
+	if s.integrity != nil {
+		if err := s.integrity.CheckRoot(s.RootDir()); err != nil {
+			return fmt.Errorf("integrity check failed: %w", err)
+		}
+	}
+
+	if s.ech != nil {
+		s.logger.Info("ECH enabled (public name %s); DNS HTTPS record: ech=%s", s.ech.publicName, s.ech.ConfigList())
+	}
+
+	// Primeira resposta OCSP antes de aceitar conexões; sem ela o
+	// certificado segue sem staple até a próxima tentativa
+	if s.ocsp != nil {
+		if result, err := s.ocsp.Refresh(); err != nil {
+			s.logger.Error("OCSP stapling: %v", err)
+		} else {
+			s.logger.Info("OCSP stapling: %s", result)
+		}
+	}
+
+	// Tarefas de segundo plano (pré-compressão, índice de hashes, limpeza, polling git)
+	s.jobs.Start()
+	for _, v := range s.vhosts {
+		v.server.jobs.Start()
+	}
+
+	// Avisos de arquivos novos
+	if s.fileWebhooks != nil {
+		if err := s.fileWebhooks.Watch(s.RootDir()); err != nil {
+			s.logger.Error("File webhooks: cannot watch root: %v", err)
+		}
+	}
+
+	listeners, err := listen(addrs, s.config.Performance.Connections)
+	if err != nil {
+		return err
+	}
+
+	// Inicia o servidor em cada socket
+	errChan := make(chan error, len(listeners)+1)
+	for _, l := range listeners {
+		go func(l net.Listener) {
+			if s.config.Security.EnableHTTPS {
+				if s.ocsp != nil {
+					// Certificado vem do GetCertificate (com a resposta OCSP)
+					errChan <- server.ServeTLS(l, "", "")
+					return
+				}
+				errChan <- server.ServeTLS(l, s.config.Security.CertFile, s.config.Security.KeyFile)
+				return
+			}
+			errChan <- server.Serve(l)
+		}(l)
+	}
+
+	// Túnel para o relay (requisições públicas sem porta aberta)
+	if t := s.config.Tunnel; t != nil && t.Enabled {
+		tunnel := newTunnelListener(t, s.logger)
+		defer tunnel.Close()
+		s.logger.Info("Tunnel: serving through relay %s (%d connections)", t.Relay, t.connections())
+		go func() {
+			errChan <- s.serveTunnel(tunnel)
+		}()
+	}
+
+	// Listener FTP(S) somente leitura
+	if s.ftp != nil {
+		l, err := s.ftp.Listen()
+		if err != nil {
+			server.Close()
+			return err
+		}
+		s.logger.Info("FTP listening on %s (read-only)", l.Addr())
+		go func() {
+			errChan <- s.ftp.Serve(l)
+		}()
+	}
+
+	err = <-errChan
+	if s.shuttingDown() {
+		// Shutdown drena as conexões em andamento
+		return nil
+	}
+	server.Close()
+	if s.ftp != nil {
+		s.ftp.Close()
+	}
+	return err
 }
 
 // setupHandlers configura os handlers e middlewares
 func (s *Server) setupHandlers() {
-	// Handler principal
-	var handler http.Handler = s.createFileHandler()
+	// API administrativa
+	if s.config.Admin != nil && s.config.Admin.Enabled {
+		s.setupAdmin()
+	}
+
+	// Conteúdo a partir do git
+	if s.git != nil {
+		s.handleAdmin("GET /git", s.git.handleAdminGitStatus)
+		s.handleAdmin("POST /git/sync", s.git.handleAdminGitSync)
+	}
+
+	// Relatório da auditoria de retomada
+	if s.resumeAudit != nil {
+		s.handleAdmin("GET /resume-audit", s.handleAdminResumeAudit)
+	}
+
+	// Verificação de integridade
+	if s.integrity != nil {
+		s.handleAdmin("POST /integrity/verify", s.handleAdminVerify)
+	}
+
+	// Estatísticas de uso
+	if s.traffic != nil {
+		s.handleAdmin("GET /stats/top", s.handleAdminTraffic)
+		s.handleAdmin("GET /stats/downloads", s.handleAdminDownloads)
+		s.handleAdmin("GET /dashboard", s.handleAdminDashboard)
+	}
+
+	// Histórico de versões dos arquivos
+	if s.versions != nil {
+		s.handleAdmin("GET /versions", s.handleAdminVersions)
+		s.handleAdmin("POST /versions/restore", s.handleAdminRestoreVersion)
+	}
+
+	// Uso das quotas
+	if s.quotas != nil {
+		s.handleAdmin("GET /quotas", s.handleAdminQuotas)
+	}
+
+	// Validade do certificado
+	if s.certMonitor != nil {
+		s.handleAdmin("GET /certificate", s.handleAdminCertificate)
+	}
+
+	// Nós do cluster
+	if s.cluster != nil {
+		s.handleAdmin("GET /cluster", s.handleAdminCluster)
+	}
+
+	// Estado externo no Redis
+	if s.redis != nil {
+		s.handleAdmin("GET /redis", s.handleAdminRedis)
+	}
+
+	// Índice da raiz
+	if s.rootIndex != nil {
+		s.handleAdmin("GET /index", s.handleAdminIndex)
+	}
+
+	// Recarga da configuração
+	if s.reloader != nil {
+		s.handleAdmin("POST /config/reload", s.handleAdminReload)
+	}
+
+	// Jobs de segundo plano
+	s.handleAdmin("GET /jobs", s.handleAdminJobs)
+	s.handleAdmin("POST /jobs/{name}/run", s.handleAdminRunJob)
+
+	// Limpeza sob demanda
+	if s.janitor != nil {
+		s.handleAdmin("POST /janitor/run", s.handleAdminJanitor)
+	}
+
+	// Webhook de deploy
+	if s.deployer != nil {
+		s.mux.Handle(s.deployer.route(), Chain(s.deployer.Handler(),
+			LoggingMiddleware(s.logger),
+			SecurityHeadersMiddleware(),
+			s.activeIPFilter(),
+			RateLimitMiddleware(s.limiter),
+		))
+		s.logger.Info("Deploy webhook enabled at: %s", s.deployer.route())
+	}
+
+	// Verificação do desafio captcha (fora do rate limiting)
+	if s.challenge != nil {
+		s.mux.Handle(s.challenge.route(), Chain(s.challenge.Handler(),
+			LoggingMiddleware(s.logger),
+			SecurityHeadersMiddleware(),
+		))
+		s.logger.Info("Challenge (%s) enabled at: %s", s.config.Security.Challenge.Provider, s.challenge.route())
+	}
+
+	// Progresso dos uploads (consultado pelo ID escolhido pelo cliente)
+	if s.upProgress != nil {
+		s.mux.Handle(s.upProgress.route, Chain(s.upProgress.Handler(),
+			LoggingMiddleware(s.logger),
+			SecurityHeadersMiddleware(),
+		))
+		s.logger.Info("Upload progress enabled at: %s", s.upProgress.route)
+	}
+
+	// Consulta das sessões de download (autenticada pelo próprio token)
+	if s.dlSessions != nil {
+		s.mux.Handle(s.dlSessions.route(), Chain(s.dlSessions.Handler(),
+			LoggingMiddleware(s.logger),
+			SecurityHeadersMiddleware(),
+		))
+		s.logger.Info("Download sessions enabled at: %s", s.dlSessions.route())
+	}
+
+	// Gate dos cookies assinados (autenticado pela própria assinatura)
+	if s.signedCookie != nil {
+		s.mux.Handle(s.signedCookie.route(), Chain(s.signedCookie.Handler(),
+			LoggingMiddleware(s.logger),
+			SecurityHeadersMiddleware(),
+		))
+		s.logger.Info("Signed cookies gate enabled at: %s", s.signedCookie.route())
+	}
+
+	// Probe para monitoramento (autenticado pelo próprio token)
+	if s.probe != nil {
+		s.mux.Handle(s.probe.route(), Chain(http.HandlerFunc(s.handleProbe),
+			LoggingMiddleware(s.logger),
+			SecurityHeadersMiddleware(),
+		))
+		s.logger.Info("Probe enabled at: %s", s.probe.route())
+	}
+
+	// Consultas entre os nós do cluster (assinadas; sem log de acesso,
+	// já que há uma por requisição recebida pelos outros nós)
+	if s.cluster != nil {
+		s.mux.Handle(s.cluster.route()+"/", Chain(s.cluster.Handler(),
+			SecurityHeadersMiddleware(),
+		))
+		s.logger.Info("Cluster mode enabled: %d nodes, this node is %s", len(s.cluster.nodes), s.cluster.self)
+	}
+
+	// Handler principal (fixa o diretório raiz ativo por requisição)
+	// e despacha os prefixos montados (ex: espelhos pull-through)
+	handler := s.withRoot(s.routeHandler(s.createFileHandler()))
+
+	// Middlewares montados a partir da configuração ativa e trocados
+	// atomicamente quando ela é recarregada
+	s.limiter = s.newRateLimiter()
+	s.app = handler
+	s.applyConfig(s.config)
+	handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		(*s.chain.Load()).ServeHTTP(w, r)
+	})
 
-	// Aplica middlewares na ordem correta
+	// Runtime config route (se habilitado, deve ser registrado antes do handler principal)
+	if s.config.RuntimeConfig != nil && s.config.RuntimeConfig.Enabled {
+		route := s.config.RuntimeConfig.Route
+		if route == "" {
+			route = "/runtime-config.js"
+		}
+		s.mux.HandleFunc(route, s.handleRuntimeConfig)
+		s.logger.Info("Runtime Config enabled at: %s", route)
+	}
+
+	if len(s.vhosts) > 0 {
+		handler = s.vhostHandler(handler)
+	}
+	s.mux.Handle("/", handler)
+}
+
+// buildChain monta os middlewares do handler principal a partir de config
+func (s *Server) buildChain(config *Config) http.Handler {
 	var middlewares []Middleware
 
 	// Logging (primeiro para capturar tudo)
 	middlewares = append(middlewares, LoggingMiddleware(s.logger))
 
+	// Recuperação de panics (500 com ID da requisição)
+	middlewares = append(middlewares, RecoveryMiddleware(s.panics, s.logger))
+
+	// Diagnóstico X-Qserv-Debug para clientes autorizados
+	if d := config.Logging.DebugHeader; d != nil && d.Enabled {
+		middlewares = append(middlewares, DebugHeaderMiddleware(d))
+	}
+
+	// Auditoria da retomada de downloads (antes da compressão, vê os headers finais)
+	if s.resumeAudit != nil {
+		middlewares = append(middlewares, ResumeAuditMiddleware(s.resumeAudit))
+	}
+
+	// Estatísticas de tráfego
+	if s.traffic != nil {
+		middlewares = append(middlewares, TrafficStatsMiddleware(s.traffic))
+	}
+
+	// Limite de requisições por conexão
+	if c := config.Performance.Connections; c != nil && c.MaxRequestsPerConn > 0 {
+		middlewares = append(middlewares, MaxRequestsPerConnMiddleware(c.MaxRequestsPerConn))
+	}
+
+	// Taxa mínima de transferência (aborta clientes lentos)
+	if m := config.Performance.MinTransferRate; m != nil && m.Enabled {
+		middlewares = append(middlewares, MinTransferRateMiddleware(m, config.Server.GetWriteTimeout(), s.logger))
+	}
+
 	// Security headers
 	middlewares = append(middlewares, SecurityHeadersMiddleware())
 
+	// Concorrência e banda por host (tenant)
+	if s.hostLimits != nil {
+		middlewares = append(middlewares, HostLimitsMiddleware(s.hostLimits))
+	}
+
+	// Compartilhamento na tailnet: apenas clientes (e usuários) da tailnet
+	if s.tailnet != nil {
+		middlewares = append(middlewares, TailnetMiddleware(s.tailnet))
+	}
+
+	// Filtragem de requisições (métodos, headers, tamanho da URL)
+	if f := config.Security.RequestFilter; f != nil && f.Enabled {
+		middlewares = append(middlewares, RequestFilterMiddleware(NewRequestFilter(f, s.logger)))
+	}
+
+	// Normalização de caminhos e proteção contra path traversal
+	// (antes de qualquer decisão baseada no caminho)
+	middlewares = append(middlewares, NormalizePathMiddleware(config.Security.StrictPaths, s.logger))
+
+	// Banda por conexão e por IP (depois da normalização, pelo caminho limpo)
+	if s.throttle != nil {
+		middlewares = append(middlewares, ThrottleMiddleware(s.throttle))
+	}
+
 	// Custom headers
-	if len(s.config.Performance.CustomHeaders) > 0 {
-		middlewares = append(middlewares, CustomHeadersMiddleware(s.config.Performance.CustomHeaders))
+	if len(config.Performance.CustomHeaders) > 0 {
+		middlewares = append(middlewares, CustomHeadersMiddleware(config.Performance.CustomHeaders))
 	}
 
 	// IP filtering
-	if len(s.config.Security.IPWhitelist) > 0 || len(s.config.Security.IPBlacklist) > 0 {
+	if len(config.Security.IPWhitelist) > 0 || len(config.Security.IPBlacklist) > 0 {
 		middlewares = append(middlewares, IPFilterMiddleware(
-			s.config.Security.IPWhitelist,
-			s.config.Security.IPBlacklist,
+			config.Security.IPWhitelist,
+			config.Security.IPBlacklist,
 		))
 	}
 
-	// Rate limiting
-	if s.config.Security.RateLimit != nil && s.config.Security.RateLimit.Enabled {
-		limiter := NewRateLimiter(s.config.Security.RateLimit)
-		middlewares = append(middlewares, RateLimitMiddleware(limiter))
+	// Desafio captcha (isenta clientes verificados do rate limiting)
+	if s.challenge != nil {
+		middlewares = append(middlewares, ChallengeMiddleware(s.challenge))
+	}
+
+	// Rate limiting (o limiter é único; a configuração vem da ativa)
+	middlewares = append(middlewares, RateLimitMiddleware(s.limiter))
+
+	// Regras por caminho, também reaplicadas pelas rotas ao caminho do arquivo
+	access := &resourceAccess{signedCookies: s.signedCookie}
+
+	// Identidade enviada pelo proxy de autenticação (validada em validateConfig)
+	if pa := config.Security.ProxyAuth; pa != nil && pa.Enabled {
+		if proxyAuth, err := NewProxyAuth(pa, s.logger); err == nil {
+			access.proxyAuth = proxyAuth
+			middlewares = append(middlewares, ProxyAuthMiddleware(proxyAuth))
+		} else {
+			s.logger.Error("Proxy auth disabled: %v", err)
+		}
 	}
 
 	// Basic auth
-	if s.config.Security.BasicAuth != nil && s.config.Security.BasicAuth.Enabled {
-		middlewares = append(middlewares, BasicAuthMiddleware(s.config.Security.BasicAuth))
+	if config.Security.BasicAuth != nil && config.Security.BasicAuth.Enabled {
+		middlewares = append(middlewares, BasicAuthMiddleware(config.Security.BasicAuth))
+	}
+
+	// Cotas por caminho, usuário ou globais (validadas em validateConfig)
+	if rl := config.Security.RateLimit; rl != nil && rl.Enabled && len(rl.Rules) > 0 {
+		if rules, err := NewRateLimitRules(rl.Rules, s.limiter); err == nil {
+			middlewares = append(middlewares, RateLimitRulesMiddleware(rules))
+		} else {
+			s.logger.Error("Rate limit rules disabled: %v", err)
+		}
 	}
 
 	// CORS
-	if s.config.Security.CORS != nil && s.config.Security.CORS.Enabled {
-		middlewares = append(middlewares, CORSMiddleware(s.config.Security.CORS))
+	if config.Security.CORS != nil && config.Security.CORS.Enabled {
+		middlewares = append(middlewares, CORSMiddleware(config.Security.CORS))
+	}
+
+	// Janelas de horário (validadas em validateConfig)
+	if len(config.Security.TimeWindows) > 0 {
+		if tws, err := NewTimeWindows(config.Security.TimeWindows); err == nil {
+			access.timeWindows = tws
+			middlewares = append(middlewares, TimeWindowMiddleware(tws, s.logger))
+		} else {
+			s.logger.Error("Time windows disabled: %v", err)
+		}
 	}
 
-	// Path traversal protection
-	middlewares = append(middlewares, PathTraversalMiddleware(s.config.Server.RootDir))
+	// Prefixos liberados por cookie assinado
+	if s.signedCookie != nil {
+		middlewares = append(middlewares, SignedCookiesMiddleware(s.signedCookie, s.logger))
+	}
+
+	// Proteção contra hotlinking
+	if s.hotlink != nil {
+		middlewares = append(middlewares, HotlinkMiddleware(s.hotlink, s.logger))
+	}
+	middlewares = append(middlewares, ResourceAccessMiddleware(access))
 
 	// Block hidden files
-	if s.config.Security.BlockHiddenFiles {
-		middlewares = append(middlewares, BlockHiddenFilesMiddleware(s.config.Server.RootDir))
+	if config.Security.BlockHiddenFiles {
+		var allowed []string
+		if config.WellKnown != nil && config.WellKnown.Enabled {
+			allowed = append(allowed, wellKnownPrefix)
+		}
+		middlewares = append(middlewares, BlockHiddenFilesMiddleware(config.Server.RootDir, allowed...))
 	}
 
 	// Compression
-	if s.config.Performance.EnableCompression {
-		middlewares = append(middlewares, CompressionMiddleware(s.config.Performance.CompressionLevel))
+	if config.Performance.EnableCompression {
+		middlewares = append(middlewares, CompressionMiddleware(config.Performance.CompressionLevel, config.Performance.Compression))
 	}
 
 	// Cache headers
-	if s.config.Performance.EnableCache && s.config.Performance.CacheMaxAge > 0 {
-		middlewares = append(middlewares, CacheMiddleware(s.config.Performance.CacheMaxAge))
+	if config.Performance.EnableCache && config.Performance.CacheMaxAge > 0 {
+		middlewares = append(middlewares, CacheMiddleware(config.Performance.CacheMaxAge))
 	}
 
-	// Aplica os middlewares
-	handler = Chain(handler, middlewares...)
+	s.access.Store(access)
+	return Chain(s.app, middlewares...)
+}
 
-	// Runtime config route (se habilitado, deve ser registrado antes do handler principal)
-	if s.config.RuntimeConfig != nil && s.config.RuntimeConfig.Enabled {
-		route := s.config.RuntimeConfig.Route
-		if route == "" {
-			route = "/runtime-config.js"
+// buildEdge monta os filtros de Host e de clientes, que valem para todo o
+// mux, inclusive as rotas registradas fora da cadeia (deploy, challenge,
+// probe, cluster...)
+func (s *Server) buildEdge(config *Config) http.Handler {
+	var middlewares []Middleware
+
+	// Hosts permitidos (no modo lan_share, os endereços da própria máquina)
+	allowedHosts := config.Security.AllowedHosts
+	if len(allowedHosts) == 0 && config.Server.LANShare {
+		if addrs, err := config.Server.ListenAddrs(); err == nil {
+			allowedHosts = lanShareHosts(addrs)
+			s.logger.Info("LAN share: accepting Host %s", strings.Join(allowedHosts, ", "))
 		}
-		s.mux.HandleFunc(route, s.handleRuntimeConfig)
-		s.logger.Info("Runtime Config enabled at: %s", route)
+	}
+	if len(allowedHosts) > 0 {
+		middlewares = append(middlewares, HostFilterMiddleware(allowedHosts, config.Security.UnknownHostStatus, s.logger))
 	}
 
-	s.mux.Handle("/", handler)
+	// Modo lan_share: apenas clientes da rede local, salvo whitelist explícita
+	if config.Server.LANShare && len(config.Security.IPWhitelist) == 0 {
+		middlewares = append(middlewares, PrivateClientsMiddleware())
+	}
+
+	return Chain(s.mux, middlewares...)
+}
+
+// activeIPFilter aplica as listas de IPs da configuração ativa às rotas
+// registradas fora da cadeia
+func (s *Server) activeIPFilter() Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			security := &s.activeConfig().Security
+			IPFilterMiddleware(security.IPWhitelist, security.IPBlacklist)(next).ServeHTTP(w, r)
+		})
+	}
+}
+
+// ServeHTTP atende uma requisição pelo mux, atrás dos filtros de buildEdge
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	(*s.edge.Load()).ServeHTTP(w, r)
+}
+
+// applyConfig troca a configuração ativa do handler principal
+func (s *Server) applyConfig(config *Config) {
+	chain := s.buildChain(config)
+	s.chain.Store(&chain)
+	edge := s.buildEdge(config)
+	s.edge.Store(&edge)
+	rl := config.Security.RateLimit
+	if rl == nil {
+		rl = &RateLimitConfig{}
+	}
+	s.limiter.config.Store(rl)
+	s.active.Store(config)
+}
+
+// timeWindows retorna as janelas de horário da configuração ativa (nil sem
+// janelas), para quem atende fora do HTTP
+func (s *Server) timeWindows() *TimeWindows {
+	if access := s.access.Load(); access != nil {
+		return access.timeWindows
+	}
+	return nil
+}
+
+// activeConfig retorna a configuração ativa (a inicial ou a última recarregada)
+func (s *Server) activeConfig() *Config {
+	return s.active.Load()
+}
+
+// newRateLimiter cria o limiter, com as cotas compartilhadas do cluster ou
+// do Redis e o desafio no lugar do 429
+func (s *Server) newRateLimiter() *RateLimiter {
+	rl := s.config.Security.RateLimit
+	if rl == nil {
+		rl = &RateLimitConfig{}
+	}
+	limiter := NewRateLimiter(rl)
+	if s.challenge != nil && s.config.Security.Challenge.OnRateLimit {
+		limiter.onLimit = func(w http.ResponseWriter, r *http.Request) {
+			s.challenge.Serve(w, r, http.StatusTooManyRequests)
+		}
+	}
+	if s.cluster != nil {
+		s.cluster.limiter = limiter
+		limiter.backend = s.cluster
+	}
+	if s.redis != nil {
+		s.redis.limiter = limiter
+		limiter.backend = s.redis
+	}
+	return limiter
 }
 
 // createFileHandler cria o handler para servir arquivos
 func (s *Server) createFileHandler() http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Resolve o caminho do arquivo
-		path := filepath.Join(s.config.Server.RootDir, filepath.Clean(r.URL.Path))
+		// Resolve o caminho do arquivo e verifica se ele existe
+		root := s.requestRoot(r)
+		start := time.Now()
+		path, info, canonical, err := s.resolvePath(root, r.URL.Path)
+		debugNote(r, "backend", "files")
+		debugTiming(r, "resolve", time.Since(start))
+
+		// Conteúdo ainda não publicado ou já expirado
+		if err == nil && s.schedule != nil {
+			status, expire := s.schedule.Status(root, path)
+			if status != 0 {
+				debugNote(r, "serve", "schedule")
+				w.Header().Set("Cache-Control", "no-store")
+				s.serveError(w, r, status)
+				return
+			}
+			if !expire.IsZero() {
+				limitCacheLifetime(w.Header(), expire, s.schedule.now())
+			}
+		}
+
+		// Marcadores de remoção não são servidos
+		if err == nil && s.tombstones != nil && s.tombstones.IsMarker(filepath.Base(path)) {
+			err = fs.ErrNotExist
+		}
+
+		// Ocultos da listagem sem permissão para serem servidos
+		if err == nil && s.listingRules != nil && path != root && s.listingRules.Blocked(root, path) {
+			err = fs.ErrNotExist
+		}
 
-		// Verifica se o arquivo existe
-		info, err := os.Stat(path)
+		if err == nil && canonical != "" {
+			// Redireciona para a grafia correta (modo case-insensitive)
+			debugNote(r, "serve", "canonical-redirect")
+			target := escapeURLPath(canonical)
+			if r.URL.RawQuery != "" {
+				target += "?" + r.URL.RawQuery
+			}
+			http.Redirect(w, r, target, http.StatusMovedPermanently)
+			return
+		}
 		if err != nil {
 			if os.IsNotExist(err) {
+				// .torrent/.meta4 gerados para arquivos grandes
+				if s.torrents != nil && s.serveTorrent(w, r, root) {
+					return
+				}
+
+				// .zsync gerados para atualização por blocos
+				if s.zsync != nil && s.serveZsync(w, r, root) {
+					return
+				}
+
+				// Caminho removido de propósito: 410 Gone
+				if s.tombstones != nil {
+					if gone, reason := s.tombstones.Gone(root, r.URL.Path); gone {
+						debugNote(r, "serve", "tombstone")
+						s.serveGone(w, r, reason)
+						return
+					}
+				}
+
 				// Modo SPA - redireciona para index.html
 				if s.config.Features.SPAMode {
+					debugNote(r, "serve", "spa")
 					s.serveSPAIndex(w, r)
 					return
 				}
+				debugNote(r, "serve", "not-found")
+				if s.notFound != nil {
+					if notFoundCached(err) {
+						setCacheStatus(w, r, "hit")
+					} else {
+						setCacheStatus(w, r, "miss")
+					}
+				}
 				s.serveError(w, r, http.StatusNotFound)
 				return
 			}
@@ -163,17 +1283,50 @@ func (s *Server) createFileHandler() http.Handler {
 			return
 		}
 
+		// Downloads redirecionados para um mirror
+		if s.mirrors != nil && s.mirrors.Matches(r.URL.Path, info) {
+			debugNote(r, "serve", "mirror")
+			s.mirrors.Redirect(w, r)
+			return
+		}
+
 		// Serve o arquivo
+		debugNote(r, "serve", "file")
 		s.serveFile(w, r, path, info)
 	})
 }
 
 // serveDirectory serve um diretório
 func (s *Server) serveDirectory(w http.ResponseWriter, r *http.Request, path string) {
+	// Download do diretório inteiro (?download=zip ou ?download=tar.gz)
+	if s.archives != nil && s.config.Features.DirectoryListing {
+		switch r.URL.Query().Get("download") {
+		case "zip":
+			debugNote(r, "serve", "archive")
+			s.serveDirectoryArchive(w, r, path)
+			return
+		case "tar.gz":
+			debugNote(r, "serve", "archive")
+			s.serveDirectoryTarGz(w, r, path)
+			return
+		}
+	}
+
+	// Uso de disco recursivo (?du=1)
+	if s.diskUsage != nil && r.URL.Query().Has("du") {
+		debugNote(r, "serve", "disk-usage")
+		s.serveDiskUsage(w, r, path)
+		return
+	}
+
 	// Tenta servir index files
 	for _, indexFile := range s.config.Features.IndexFiles {
 		indexPath := filepath.Join(path, indexFile)
 		if info, err := os.Stat(indexPath); err == nil && !info.IsDir() {
+			if s.schedule != nil && !s.schedule.Listed(s.requestRoot(r), path, indexFile) {
+				continue
+			}
+			debugNote(r, "serve", "index")
 			s.serveFile(w, r, indexPath, info)
 			return
 		}
@@ -181,6 +1334,7 @@ func (s *Server) serveDirectory(w http.ResponseWriter, r *http.Request, path str
 
 	// Se directory listing estiver habilitado, mostra a listagem
 	if s.config.Features.DirectoryListing {
+		debugNote(r, "serve", "listing")
 		s.serveDirectoryListing(w, r, path)
 		return
 	}
@@ -191,109 +1345,112 @@ func (s *Server) serveDirectory(w http.ResponseWriter, r *http.Request, path str
 
 // serveFile serve um arquivo
 func (s *Server) serveFile(w http.ResponseWriter, r *http.Request, path string, info os.FileInfo) {
-	// Adiciona ETag se habilitado
-	if s.config.Performance.EnableETags {
-		etag := fmt.Sprintf(`"%x-%x"`, info.ModTime().Unix(), info.Size())
-		w.Header().Set("ETag", etag)
-
-		// Verifica If-None-Match
-		if match := r.Header.Get("If-None-Match"); match != "" {
-			if match == etag {
-				w.WriteHeader(http.StatusNotModified)
-				return
-			}
+	// Confere o arquivo contra o manifesto assinado
+	if s.integrity != nil && s.config.Integrity.VerifyOnRequest {
+		if !s.integrity.Check(s.requestRoot(r), path, info) {
+			s.serveError(w, r, http.StatusInternalServerError)
+			return
 		}
 	}
 
-	// Serve o arquivo
-	http.ServeFile(w, r, path)
-}
-
-// serveSPAIndex serve o index.html para modo SPA
-func (s *Server) serveSPAIndex(w http.ResponseWriter, r *http.Request) {
-	indexPath := filepath.Join(s.config.Server.RootDir, s.config.Features.SPAIndex)
-	info, err := os.Stat(indexPath)
-	if err != nil {
-		s.serveError(w, r, http.StatusNotFound)
+	// Acompanhamento de logs (?follow=1)
+	if s.tail != nil && s.tail.Handles(r, path) {
+		debugNote(r, "serve", "tail")
+		s.serveTail(w, r, path)
 		return
 	}
-	s.serveFile(w, r, indexPath, info)
-}
 
-// serveDirectoryListing serve a listagem de diretório
-func (s *Server) serveDirectoryListing(w http.ResponseWriter, r *http.Request, path string) {
-	entries, err := os.ReadDir(path)
-	if err != nil {
-		s.logger.Error("Error reading directory %s: %v", path, err)
-		s.serveError(w, r, http.StatusInternalServerError)
+	// Trechos por linha (?lines=, ?tail=)
+	if s.textSlices != nil && s.textSlices.Handles(r) {
+		debugNote(r, "serve", "text-slice")
+		s.serveTextSlice(w, r, path, info)
 		return
 	}
 
-	// Filtra arquivos ocultos se configurado
-	if s.config.Security.BlockHiddenFiles {
-		filtered := make([]fs.DirEntry, 0)
-		for _, entry := range entries {
-			if !strings.HasPrefix(entry.Name(), ".") {
-				filtered = append(filtered, entry)
-			}
+	// Visualização com destaque de sintaxe para navegadores
+	if s.codeView != nil && s.codeView.Handles(path, info) {
+		w.Header().Add("Vary", "Accept")
+		if s.codeView.Wants(r) {
+			debugNote(r, "serve", "code-view")
+			s.serveCodeView(w, r, path, info)
+			return
 		}
-		entries = filtered
 	}
 
-	// Ordena: diretórios primeiro, depois arquivos
-	sort.Slice(entries, func(i, j int) bool {
-		if entries[i].IsDir() != entries[j].IsDir() {
-			return entries[i].IsDir()
+	// Repositórios apt/yum: tipos, cache dos metadados e bytes exatos
+	inRepo := s.packageRepos != nil && s.packageRepos.Prepare(w, r.URL.Path)
+
+	// Adiciona ETag se habilitado
+	if s.config.Performance.EnableETags {
+		etag := mtimeETag(info)
+		if s.etags != nil {
+			var err error
+			if etag, err = s.etags.ETag(r.URL.Path, path, info); err != nil {
+				s.logger.Error("Error computing ETag for %s: %v", path, err)
+				etag = ""
+			}
 		}
-		return entries[i].Name() < entries[j].Name()
-	})
 
-	// Prepara os dados para o template
-	type FileInfo struct {
-		Name    string
-		Path    string
-		IsDir   bool
-		Size    string
-		ModTime string
-	}
+		if etag != "" {
+			w.Header().Set("ETag", etag)
 
-	var files []FileInfo
-	for _, entry := range entries {
-		info, err := entry.Info()
-		if err != nil {
-			continue
+			// Verifica If-None-Match
+			if match := r.Header.Get("If-None-Match"); match != "" && etagMatch(match, etag) {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
 		}
+	}
 
-		size := "-"
-		if !entry.IsDir() {
-			size = formatSize(info.Size())
+	// Limite de bytes por requisição e por cliente
+	if s.byteLimits != nil && r.Method == http.MethodGet {
+		var ok bool
+		if w, ok = s.limitDownload(w, r, info); !ok {
+			return
 		}
+	}
 
-		files = append(files, FileInfo{
-			Name:    entry.Name(),
-			Path:    filepath.Join(r.URL.Path, entry.Name()),
-			IsDir:   entry.IsDir(),
-			Size:    size,
-			ModTime: info.ModTime().Format("2006-01-02 15:04:05"),
-		})
+	// Cópia pré-comprimida (do build, ao lado do original, ou do cache)
+	if !inRepo && (s.serveSidecar(w, r, path, info) || s.servePrecompressed(w, r, path, info)) {
+		return
 	}
 
-	// Renderiza o template
-	tmpl := template.Must(template.New("listing").Parse(directoryListingTemplate))
+	// Arquivos pequenos e muito pedidos direto da memória
+	if s.memCache != nil && (r.Method == http.MethodGet || r.Method == http.MethodHead) &&
+		s.memCache.Caches(info) && !strings.HasSuffix(r.URL.Path, "/index.html") {
+		if s.serveMemoryCached(w, r, path, info) {
+			return
+		}
+	}
 
-	data := struct {
-		Path  string
-		Files []FileInfo
-	}{
-		Path:  r.URL.Path,
-		Files: files,
+	// Arquivos pequenos por io_uring; em caso de erro segue o caminho padrão
+	if s.uring != nil && (r.Method == http.MethodGet || r.Method == http.MethodHead) &&
+		info.Size() <= s.config.Performance.IOURing.maxFileSize() && !strings.HasSuffix(r.URL.Path, "/index.html") {
+		if data, err := s.uring.ReadFile(path, info.Size()); err == nil {
+			debugNote(r, "io", "io_uring")
+			http.ServeContent(w, r, info.Name(), info.ModTime(), bytes.NewReader(data))
+			return
+		}
 	}
 
-	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	if err := tmpl.Execute(w, data); err != nil {
-		s.logger.Error("Error rendering directory listing: %v", err)
-		s.serveError(w, r, http.StatusInternalServerError)
+	// Serve o arquivo (acompanhando downloads grandes)
+	if r.Method == http.MethodGet && (s.downloads != nil && s.downloads.Tracks(info.Size()) ||
+		s.dlSessions != nil && s.dlSessions.Tracks(info.Size())) {
+		s.serveTrackedFile(w, r, path, info)
+		return
+	}
+	s.serveDiskFile(w, r, path)
+}
+
+// serveSPAIndex serve o index.html para modo SPA
+func (s *Server) serveSPAIndex(w http.ResponseWriter, r *http.Request) {
+	indexPath := filepath.Join(s.requestRoot(r), s.config.Features.SPAIndex)
+	info, err := os.Stat(indexPath)
+	if err != nil {
+		s.serveError(w, r, http.StatusNotFound)
+		return
 	}
+	s.serveFile(w, r, indexPath, info)
 }
 
 // serveError serve uma página de erro
@@ -301,7 +1458,7 @@ func (s *Server) serveError(w http.ResponseWriter, r *http.Request, status int)
 	// Verifica se existe uma página de erro customizada
 	if s.config.Features.CustomErrorPages != nil {
 		if errorPage, ok := s.config.Features.CustomErrorPages[fmt.Sprintf("%d", status)]; ok {
-			errorPath := filepath.Join(s.config.Server.RootDir, errorPage)
+			errorPath := filepath.Join(s.requestRoot(r), errorPage)
 			if _, err := os.Stat(errorPath); err == nil {
 				http.ServeFile(w, r, errorPath)
 				return
@@ -309,7 +1466,11 @@ func (s *Server) serveError(w http.ResponseWriter, r *http.Request, status int)
 		}
 	}
 
-	// Página de erro padrão
+	// Página de erro padrão (com tema e idioma, se configurados, para navegadores)
+	if s.htmlErrors(r) {
+		s.serveErrorPage(w, r, status, "")
+		return
+	}
 	http.Error(w, http.StatusText(status), status)
 }
 
@@ -427,105 +1588,3 @@ func (s *Server) collectEnvVars(cfg *RuntimeConfigConfig) map[string]string {
 
 	return result
 }
-
-// Template para listagem de diretórios
-const directoryListingTemplate = `<!DOCTYPE html>
-<html lang="en">
-<head>
-    <meta charset="UTF-8">
-    <meta name="viewport" content="width=device-width, initial-scale=1.0">
-    <title>Index of {{.Path}}</title>
-    <style>
-        * { margin: 0; padding: 0; box-sizing: border-box; }
-        body {
-            font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, Oxygen, Ubuntu, Cantarell, sans-serif;
-            padding: 2rem;
-            background: #f5f5f5;
-        }
-        .container {
-            max-width: 1200px;
-            margin: 0 auto;
-            background: white;
-            border-radius: 8px;
-            box-shadow: 0 2px 8px rgba(0,0,0,0.1);
-            overflow: hidden;
-        }
-        h1 {
-            padding: 2rem;
-            background: #2c3e50;
-            color: white;
-            font-size: 1.5rem;
-        }
-        table {
-            width: 100%;
-            border-collapse: collapse;
-        }
-        th {
-            background: #34495e;
-            color: white;
-            padding: 1rem;
-            text-align: left;
-            font-weight: 600;
-        }
-        td {
-            padding: 1rem;
-            border-bottom: 1px solid #ecf0f1;
-        }
-        tr:hover {
-            background: #f8f9fa;
-        }
-        a {
-            color: #3498db;
-            text-decoration: none;
-            display: flex;
-            align-items: center;
-        }
-        a:hover {
-            color: #2980b9;
-            text-decoration: underline;
-        }
-        .icon {
-            margin-right: 0.5rem;
-            font-size: 1.2rem;
-        }
-        .size, .modified {
-            color: #7f8c8d;
-        }
-    </style>
-</head>
-<body>
-    <div class="container">
-        <h1>📁 Index of {{.Path}}</h1>
-        <table>
-            <thead>
-                <tr>
-                    <th>Name</th>
-                    <th width="150">Size</th>
-                    <th width="200">Modified</th>
-                </tr>
-            </thead>
-            <tbody>
-                {{if ne .Path "/"}}
-                <tr>
-                    <td><a href=".."><span class="icon">📁</span> ..</a></td>
-                    <td class="size">-</td>
-                    <td class="modified">-</td>
-                </tr>
-                {{end}}
-                {{range .Files}}
-                <tr>
-                    <td>
-                        <a href="{{.Path}}">
-                            <span class="icon">{{if .IsDir}}📁{{else}}📄{{end}}</span>
-                            {{.Name}}{{if .IsDir}}/{{end}}
-                        </a>
-                    </td>
-                    <td class="size">{{.Size}}</td>
-                    <td class="modified">{{.ModTime}}</td>
-                </tr>
-                {{end}}
-            </tbody>
-        </table>
-    </div>
-</body>
-</html>`
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sync"
+)
+
+// track registra um http.Server para o Shutdown; false se o servidor já está
+// encerrando (o chamador não deve começar a atender)
+func (s *Server) track(server *http.Server) bool {
+	s.serversMu.Lock()
+	defer s.serversMu.Unlock()
+	if s.closing {
+		return false
+	}
+	s.servers = append(s.servers, server)
+	return true
+}
+
+// shuttingDown indica se Shutdown foi chamado
+func (s *Server) shuttingDown() bool {
+	s.serversMu.Lock()
+	defer s.serversMu.Unlock()
+	return s.closing
+}
+
+// Shutdown para de aceitar conexões e espera as requisições em andamento
+// (downloads longos inclusive) terminarem até o fim de ctx; as conexões que
+// sobrarem são fechadas e o erro do contexto é retornado. Streams que só
+// acabariam com o cliente (tail, progresso de upload) terminam na hora
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.serversMu.Lock()
+	if !s.closing {
+		close(s.stop)
+	}
+	s.closing = true
+	servers := s.servers
+	s.serversMu.Unlock()
+
+	if s.ftp != nil {
+		s.ftp.Close()
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, len(servers))
+	for _, server := range servers {
+		wg.Add(1)
+		go func(server *http.Server) {
+			defer wg.Done()
+			if err := server.Shutdown(ctx); err != nil {
+				server.Close()
+				errs <- err
+			}
+		}(server)
+	}
+	wg.Wait()
+	close(errs)
+	return <-errs
+}
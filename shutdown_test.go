@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// startShutdownTest serves a handler that blocks until release is closed
+func startShutdownTest(t *testing.T, release chan struct{}) (*Server, string, chan struct{}) {
+	t.Helper()
+	server := newListingTestServer(t, t.TempDir(), nil)
+	started := make(chan struct{})
+	httpServer := server.httpServer("")
+	httpServer.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		io.WriteString(w, "done")
+	})
+	if !server.track(httpServer) {
+		t.Fatal("Expected server to accept tracking before shutdown")
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go httpServer.Serve(l)
+	return server, "http://" + l.Addr().String() + "/", started
+}
+
+func TestShutdownDrainsInFlightRequests(t *testing.T) {
+	release := make(chan struct{})
+	server, url, started := startShutdownTest(t, release)
+
+	result := make(chan string, 1)
+	go func() {
+		resp, err := http.Get(url)
+		if err != nil {
+			result <- err.Error()
+			return
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		result <- string(body)
+	}()
+	<-started
+
+	shutdown := make(chan error, 1)
+	go func() { shutdown <- server.Shutdown(context.Background()) }()
+
+	// New connections are refused while the transfer drains
+	time.Sleep(50 * time.Millisecond)
+	if _, err := http.Get(url); err == nil {
+		t.Error("Expected new connections to be refused during shutdown")
+	}
+	select {
+	case err := <-shutdown:
+		t.Fatalf("Expected shutdown to wait for the in-flight request, returned %v", err)
+	default:
+	}
+
+	close(release)
+	if got := <-result; got != "done" {
+		t.Errorf("Expected in-flight request to complete, got %q", got)
+	}
+	if err := <-shutdown; err != nil {
+		t.Errorf("Expected clean shutdown, got %v", err)
+	}
+	if server.track(server.httpServer("")) {
+		t.Error("Expected tracking to be refused after shutdown")
+	}
+}
+
+func TestShutdownTimeoutClosesConnections(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	server, url, started := startShutdownTest(t, release)
+
+	failed := make(chan error, 1)
+	go func() {
+		resp, err := http.Get(url)
+		if err == nil {
+			resp.Body.Close()
+		}
+		failed <- err
+	}()
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := server.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected deadline exceeded, got %v", err)
+	}
+	if err := <-failed; err == nil {
+		t.Error("Expected the stuck request to be cut off")
+	}
+}
+
+func TestShutdownTimeoutDefault(t *testing.T) {
+	c := &ServerConfig{}
+	if got := c.GetShutdownTimeout(); got != 30*time.Second {
+		t.Errorf("Expected default 30s, got %s", got)
+	}
+	c.ShutdownTimeout = 5
+	if got := c.GetShutdownTimeout(); got != 5*time.Second {
+		t.Errorf("Expected 5s, got %s", got)
+	}
+}
+
+func TestShutdownEndsEventStreams(t *testing.T) {
+	root := t.TempDir()
+	writeTestFile(t, root+"/app.log", "started\n")
+	server := newListingTestServer(t, root, func(c *Config) {
+		c.Features.Tail = &TailConfig{Enabled: true, Token: "secret"}
+	})
+	httpServer := server.httpServer("")
+	server.track(httpServer)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go httpServer.Serve(l)
+
+	req, _ := http.NewRequest("GET", "http://"+l.Addr().String()+"/app.log?follow=1", nil)
+	req.Header.Set("Accept", "text/event-stream")
+	req.Header.Set("Authorization", "Bearer secret")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	// The stream only ends with the client or max_duration: shutdown must end it
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	start := time.Now()
+	if err := server.Shutdown(ctx); err != nil {
+		t.Errorf("Expected clean shutdown, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Expected shutdown to end the stream promptly, took %v", elapsed)
+	}
+	if _, err := io.ReadAll(resp.Body); err != nil {
+		t.Errorf("Expected the stream to end cleanly, got %v", err)
+	}
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// SignedCookies libera prefixos protegidos por cookie assinado: a aplicação
+// assina prefixo e expiração uma vez, a rota de gate grava o cookie e cada
+// requisição dentro do prefixo é validada sem precisar de URL assinada
+type SignedCookies struct {
+	config *SignedCookiesConfig
+	now    func() time.Time
+
+	issued atomic.Int64
+	denied atomic.Int64
+}
+
+// NewSignedCookies valida a configuração
+func NewSignedCookies(config *SignedCookiesConfig) (*SignedCookies, error) {
+	if config.Secret == "" {
+		return nil, fmt.Errorf("signed cookies: secret is required")
+	}
+	if len(config.Paths) == 0 {
+		return nil, fmt.Errorf("signed cookies: at least one protected path is required")
+	}
+	if config.Route != "" && !strings.HasPrefix(config.Route, "/") {
+		return nil, fmt.Errorf("signed cookies: route must start with /, got %q", config.Route)
+	}
+	if config.MaxTTL < 0 {
+		return nil, fmt.Errorf("signed cookies: max_ttl must not be negative")
+	}
+	return &SignedCookies{config: config, now: time.Now}, nil
+}
+
+// route retorna a rota que grava o cookie
+func (sc *SignedCookies) route() string {
+	if sc.config.Route == "" {
+		return "/_gate"
+	}
+	return sc.config.Route
+}
+
+// cookieName retorna o nome do cookie
+func (sc *SignedCookies) cookieName() string {
+	if sc.config.Cookie == "" {
+		return "qserv_access"
+	}
+	return sc.config.Cookie
+}
+
+// maxTTL retorna a maior validade aceita para um acesso
+func (sc *SignedCookies) maxTTL() time.Duration {
+	if sc.config.MaxTTL == 0 {
+		return 24 * time.Hour
+	}
+	return time.Duration(sc.config.MaxTTL) * time.Second
+}
+
+// Sign assina prefixo e expiração: hex(HMAC-SHA256(secret, "<prefix>|<expires>")),
+// o mesmo cálculo que a aplicação faz para montar o link do gate
+func (sc *SignedCookies) Sign(prefix string, expires int64) string {
+	mac := hmac.New(sha256.New, []byte(sc.config.Secret))
+	mac.Write([]byte(prefix + "|" + strconv.FormatInt(expires, 10)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// valid confere assinatura e expiração de um acesso
+func (sc *SignedCookies) valid(prefix string, expires int64, sig string) bool {
+	return strings.HasPrefix(prefix, "/") && sc.now().Unix() < expires &&
+		hmac.Equal([]byte(sig), []byte(sc.Sign(prefix, expires)))
+}
+
+// protects informa se o caminho exige cookie
+func (sc *SignedCookies) protects(urlPath string) bool {
+	for _, pattern := range sc.config.Paths {
+		if matchGlob(pattern, urlPath) {
+			return true
+		}
+	}
+	return false
+}
+
+// underPrefix informa se urlPath está dentro do prefixo, respeitando os
+// limites de segmento (/hls/a não libera /hls/ab)
+func underPrefix(urlPath, prefix string) bool {
+	if !strings.HasPrefix(urlPath, prefix) {
+		return false
+	}
+	return len(urlPath) == len(prefix) || strings.HasSuffix(prefix, "/") || urlPath[len(prefix)] == '/'
+}
+
+// Allowed informa se algum cookie da requisição libera urlPath; o
+// navegador pode enviar vários, um por prefixo liberado
+func (sc *SignedCookies) Allowed(r *http.Request, urlPath string) bool {
+	urlPath = path.Clean("/" + urlPath)
+	for _, cookie := range r.Cookies() {
+		if cookie.Name != sc.cookieName() {
+			continue
+		}
+		// <prefixo em base64url>.<expiração>.<assinatura>
+		parts := strings.Split(cookie.Value, ".")
+		if len(parts) != 3 {
+			continue
+		}
+		prefix, err := base64.RawURLEncoding.DecodeString(parts[0])
+		if err != nil {
+			continue
+		}
+		expires, err := strconv.ParseInt(parts[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		// path.Clean remove a barra final: o próprio diretório do prefixo também vale
+		inside := underPrefix(urlPath, string(prefix)) || urlPath+"/" == string(prefix)
+		if inside && sc.valid(string(prefix), expires, parts[2]) {
+			return true
+		}
+	}
+	return false
+}
+
+// Handler valida o link assinado (?prefix=&expires=&sig=[&return=]) e grava
+// o cookie; sem return responde 204, para players que chamam o gate via fetch
+func (sc *SignedCookies) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-store")
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		query := r.URL.Query()
+		prefix := query.Get("prefix")
+		expires, err := strconv.ParseInt(query.Get("expires"), 10, 64)
+		if err != nil || !sc.valid(prefix, expires, query.Get("sig")) {
+			sc.denied.Add(1)
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		ttl := time.Unix(expires, 0).Sub(sc.now())
+		if ttl > sc.maxTTL() {
+			sc.denied.Add(1)
+			http.Error(w, "Expiration too far in the future", http.StatusForbidden)
+			return
+		}
+
+		// O cookie só é enviado dentro do prefixo
+		cookiePath := prefix
+		if !strings.HasSuffix(cookiePath, "/") {
+			cookiePath = path.Dir(cookiePath)
+		}
+		sc.issued.Add(1)
+		http.SetCookie(w, &http.Cookie{
+			Name:     sc.cookieName(),
+			Value:    base64.RawURLEncoding.EncodeToString([]byte(prefix)) + "." + strconv.FormatInt(expires, 10) + "." + query.Get("sig"),
+			Path:     cookiePath,
+			MaxAge:   int(ttl / time.Second),
+			HttpOnly: true,
+			Secure:   r.TLS != nil,
+			SameSite: http.SameSiteLaxMode,
+		})
+
+		// Só redireciona para caminhos locais (evita open redirect)
+		target := query.Get("return")
+		if target == "" {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		if !strings.HasPrefix(target, "/") || strings.HasPrefix(target, "//") || strings.HasPrefix(target, "/\\") {
+			target = "/"
+		}
+		http.Redirect(w, r, target, http.StatusSeeOther)
+	})
+}
+
+// WriteMetrics exporta os cookies gravados e os acessos recusados
+func (sc *SignedCookies) WriteMetrics(w io.Writer) {
+	writeMetric(w, "qserv_signed_cookies_total", "Signed cookie grants and refusals.", "counter", []metricSample{
+		{labels: map[string]string{"result": "issued"}, value: float64(sc.issued.Load())},
+		{labels: map[string]string{"result": "denied"}, value: float64(sc.denied.Load())},
+	})
+}
+
+// SignedCookiesMiddleware recusa com 403 os caminhos protegidos sem um
+// cookie válido para o prefixo
+func SignedCookiesMiddleware(sc *SignedCookies, logger *Logger) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !sc.protects(path.Clean("/"+r.URL.Path)) || sc.Allowed(r, r.URL.Path) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			sc.denied.Add(1)
+			logger.Debug("Signed cookies: %s %s refused", r.Method, r.URL.Path)
+			w.Header().Set("Cache-Control", "no-store")
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		})
+	}
+}
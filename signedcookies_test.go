@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSignedCookiesGate(t *testing.T) {
+	root := t.TempDir()
+	os.MkdirAll(filepath.Join(root, "hls", "movie1"), 0755)
+	os.MkdirAll(filepath.Join(root, "hls", "movie10"), 0755)
+	writeTestFile(t, filepath.Join(root, "hls", "movie1", "seg1.ts"), "segment")
+	writeTestFile(t, filepath.Join(root, "hls", "movie10", "seg1.ts"), "other")
+	writeTestFile(t, filepath.Join(root, "public.txt"), "public")
+
+	server := newListingTestServer(t, root, func(c *Config) {
+		c.Security.SignedCookies = &SignedCookiesConfig{Enabled: true, Secret: "s3cret", Paths: []string{"/hls/**"}, MaxTTL: 3600}
+	})
+	sc := server.signedCookie
+	expires := time.Now().Add(10 * time.Minute).Unix()
+	sig := sc.Sign("/hls/movie1/", expires)
+
+	get := func(target string, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", target, nil)
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		w := httptest.NewRecorder()
+		server.mux.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := get("/hls/movie1/seg1.ts"); w.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 without cookie, got %d", w.Code)
+	}
+	if w := get("/public.txt"); w.Code != http.StatusOK {
+		t.Errorf("Expected unprotected path to be served, got %d", w.Code)
+	}
+
+	// Invalid signature and expirations beyond max_ttl are refused by the gate
+	if w := get(fmt.Sprintf("/_gate?prefix=/hls/movie1/&expires=%d&sig=bad", expires)); w.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 for bad signature, got %d", w.Code)
+	}
+	far := time.Now().Add(48 * time.Hour).Unix()
+	if w := get(fmt.Sprintf("/_gate?prefix=/hls/movie1/&expires=%d&sig=%s", far, sc.Sign("/hls/movie1/", far))); w.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 for expiration beyond max_ttl, got %d", w.Code)
+	}
+
+	w := get(fmt.Sprintf("/_gate?prefix=/hls/movie1/&expires=%d&sig=%s&return=/hls/movie1/seg1.ts", expires, sig))
+	if w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/hls/movie1/seg1.ts" {
+		t.Fatalf("Expected redirect back to the segment, got %d %q", w.Code, w.Header().Get("Location"))
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Path != "/hls/movie1/" || !cookies[0].HttpOnly {
+		t.Fatalf("Unexpected cookies: %v", cookies)
+	}
+	cookie := &http.Cookie{Name: cookies[0].Name, Value: cookies[0].Value}
+
+	if w := get("/hls/movie1/seg1.ts", cookie); w.Code != http.StatusOK || w.Body.String() != "segment" {
+		t.Errorf("Expected segment with cookie, got %d %q", w.Code, w.Body.String())
+	}
+	if w := get("/hls/movie10/seg1.ts", cookie); w.Code != http.StatusForbidden {
+		t.Errorf("Expected prefix to stop at segment boundaries, got %d", w.Code)
+	}
+	if w := get("/hls/movie1/../movie10/seg1.ts", cookie); w.Code == http.StatusOK && w.Body.String() == "other" {
+		t.Errorf("Expected dot segments not to escape the prefix")
+	}
+
+	// Expired cookies stop working
+	sc.now = func() time.Time { return time.Unix(expires, 0) }
+	if w := get("/hls/movie1/seg1.ts", cookie); w.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 for expired cookie, got %d", w.Code)
+	}
+}
+
+func TestNewSignedCookiesErrors(t *testing.T) {
+	for _, config := range []*SignedCookiesConfig{
+		{Paths: []string{"/hls/**"}},
+		{Secret: "s"},
+		{Secret: "s", Paths: []string{"/hls/**"}, Route: "gate"},
+		{Secret: "s", Paths: []string{"/hls/**"}, MaxTTL: -1},
+	} {
+		if _, err := NewSignedCookies(config); err == nil {
+			t.Errorf("Expected error for %+v", config)
+		}
+	}
+}
@@ -0,0 +1,417 @@
+package main
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	tailPollInterval = 500 * time.Millisecond // verificação de linhas novas
+	tailKeepAlive    = 15 * time.Second       // comentário SSE que mantém proxies conectados
+	tailMaxLine      = 64 << 10               // linhas maiores são cortadas
+	tailMaxRead      = 1 << 20                // bytes lidos por verificação
+)
+
+// LogTail acompanhamento de arquivos de log no navegador: a página recebe as
+// linhas acrescentadas por SSE (Server-Sent Events)
+type LogTail struct {
+	config     *TailConfig
+	extensions map[string]bool
+	basicAuth  bool // basic_auth global já protege todas as requisições
+	active     atomic.Int64
+	streams    atomic.Int64 // total de streams abertos
+	rejected   atomic.Int64 // recusados pelo limite de clientes
+	interval   time.Duration
+}
+
+// NewLogTail valida a configuração; basicAuth indica se a autenticação
+// básica global está ativa
+func NewLogTail(config *TailConfig, basicAuth bool) (*LogTail, error) {
+	if config.Token == "" && len(config.AllowedIPs) == 0 && !basicAuth {
+		return nil, errors.New("tail requires a token, allowed_ips or basic_auth")
+	}
+	for _, ip := range config.AllowedIPs {
+		if net.ParseIP(ip) == nil {
+			return nil, fmt.Errorf("invalid tail allowed_ips entry %q", ip)
+		}
+	}
+	if config.MaxClients < 0 || config.MaxDuration < 0 || config.Backlog < 0 {
+		return nil, errors.New("tail max_clients, max_duration and backlog must not be negative")
+	}
+
+	exts := config.Extensions
+	if len(exts) == 0 {
+		exts = []string{".log", ".txt"}
+	}
+	t := &LogTail{config: config, extensions: make(map[string]bool), basicAuth: basicAuth, interval: tailPollInterval}
+	for _, ext := range exts {
+		ext = strings.ToLower(strings.TrimSpace(ext))
+		if ext == "" {
+			continue
+		}
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		t.extensions[ext] = true
+	}
+	return t, nil
+}
+
+// maxClients retorna o limite de streams simultâneos
+func (t *LogTail) maxClients() int64 {
+	if t.config.MaxClients <= 0 {
+		return 16
+	}
+	return int64(t.config.MaxClients)
+}
+
+// maxDuration retorna a duração máxima de um stream
+func (t *LogTail) maxDuration() time.Duration {
+	if t.config.MaxDuration <= 0 {
+		return time.Hour
+	}
+	return time.Duration(t.config.MaxDuration) * time.Second
+}
+
+// backlog retorna quantas linhas anteriores são enviadas ao conectar
+func (t *LogTail) backlog() int {
+	if t.config.Backlog <= 0 {
+		return 100
+	}
+	return t.config.Backlog
+}
+
+// Handles informa se a requisição pede o acompanhamento de um arquivo aceito
+func (t *LogTail) Handles(r *http.Request, path string) bool {
+	if r.Method != http.MethodGet || !r.URL.Query().Has("follow") {
+		return false
+	}
+	return t.extensions[strings.ToLower(filepath.Ext(path))]
+}
+
+// Authorized informa se o cliente pode acompanhar o arquivo
+func (t *LogTail) Authorized(r *http.Request) bool {
+	if t.basicAuth {
+		return true
+	}
+	if t.config.Token != "" {
+		token := r.URL.Query().Get("token")
+		if bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+			token = bearer
+		}
+		if token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(t.config.Token)) == 1 {
+			return true
+		}
+	}
+	ip, _, _ := net.SplitHostPort(r.RemoteAddr)
+	for _, allowed := range t.config.AllowedIPs {
+		if ip == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// WriteMetrics exporta os streams ativos e os recusados
+func (t *LogTail) WriteMetrics(w io.Writer) {
+	writeMetric(w, "qserv_tail_streams_active", "Log tail streams currently open.", "gauge",
+		[]metricSample{{value: float64(t.active.Load())}})
+	writeMetric(w, "qserv_tail_streams_total", "Log tail streams opened.", "counter",
+		[]metricSample{{value: float64(t.streams.Load())}})
+	writeMetric(w, "qserv_tail_rejected_total", "Log tail streams rejected by max_clients.", "counter",
+		[]metricSample{{value: float64(t.rejected.Load())}})
+}
+
+// tailLine linha lida do arquivo; end é a posição logo após ela (id do evento)
+type tailLine struct {
+	text string
+	end  int64
+}
+
+// readTailLines lê as linhas completas a partir de offset (até tailMaxRead
+// bytes) e retorna a posição seguinte à última linha; uma linha maior que
+// tailMaxLine sem quebra é enviada cortada
+func readTailLines(f *os.File, offset, size int64) ([]tailLine, int64, error) {
+	n := size - offset
+	if n > tailMaxRead {
+		n = tailMaxRead
+	}
+	if n <= 0 {
+		return nil, offset, nil
+	}
+	buf := make([]byte, n)
+	if _, err := f.ReadAt(buf, offset); err != nil && err != io.EOF {
+		return nil, offset, err
+	}
+
+	var lines []tailLine
+	for len(buf) > 0 {
+		var line []byte
+		if i := bytes.IndexByte(buf, '\n'); i >= 0 {
+			line, buf = buf[:i], buf[i+1:]
+			offset += int64(i) + 1
+		} else if len(buf) >= tailMaxLine {
+			line, buf = buf[:tailMaxLine], buf[tailMaxLine:]
+			offset += tailMaxLine
+		} else {
+			break
+		}
+		// \r também separa linhas no SSE
+		text := strings.ReplaceAll(string(line[:min(len(line), tailMaxLine)]), "\r", "")
+		lines = append(lines, tailLine{text: text, end: offset})
+	}
+	return lines, offset, nil
+}
+
+// tailStart posição inicial: as últimas n linhas completas do arquivo
+func tailStart(f *os.File, size int64, n int) int64 {
+	start := size - tailMaxRead
+	if start < 0 {
+		start = 0
+	}
+	buf := make([]byte, size-start)
+	if _, err := f.ReadAt(buf, start); err != nil && err != io.EOF {
+		return size
+	}
+	// Ignora a última linha ainda incompleta
+	end := bytes.LastIndexByte(buf, '\n')
+	if end < 0 {
+		return start
+	}
+	pos := end
+	for ; n > 0; n-- {
+		i := bytes.LastIndexByte(buf[:pos], '\n')
+		if i < 0 {
+			if start == 0 {
+				return 0
+			}
+			return start + int64(pos) + 1
+		}
+		pos = i
+	}
+	return start + int64(pos) + 1
+}
+
+// serveTail responde com a página de acompanhamento ou, para o EventSource
+// (Accept: text/event-stream), com o stream das linhas novas
+func (s *Server) serveTail(w http.ResponseWriter, r *http.Request, path string) {
+	if !s.tail.Authorized(r) {
+		s.serveError(w, r, http.StatusForbidden)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	if !strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+		s.serveTailPage(w, r, path)
+		return
+	}
+
+	if s.tail.active.Add(1) > s.tail.maxClients() {
+		s.tail.active.Add(-1)
+		s.tail.rejected.Add(1)
+		w.Header().Set("Retry-After", "30")
+		s.serveError(w, r, http.StatusServiceUnavailable)
+		return
+	}
+	defer s.tail.active.Add(-1)
+	s.tail.streams.Add(1)
+
+	f, err := os.Open(path)
+	if err != nil {
+		s.serveError(w, r, http.StatusNotFound)
+		return
+	}
+	defer func() { f.Close() }()
+	info, err := f.Stat()
+	if err != nil {
+		s.serveError(w, r, http.StatusInternalServerError)
+		return
+	}
+
+	// Reconexão do EventSource: continua de onde parou
+	offset := tailStart(f, info.Size(), s.tail.backlog())
+	if last, err := strconv.ParseInt(r.Header.Get("Last-Event-ID"), 10, 64); err == nil && last >= 0 && last <= info.Size() {
+		offset = last
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("X-Accel-Buffering", "no")
+	rc := http.NewResponseController(w)
+	rc.SetWriteDeadline(time.Time{})
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, "retry: 3000\n\n")
+	rc.Flush()
+
+	poll := time.NewTicker(s.tail.interval)
+	defer poll.Stop()
+	deadline := time.NewTimer(s.tail.maxDuration())
+	defer deadline.Stop()
+	lastWrite := time.Now()
+
+	for {
+		wrote := false
+		// Arquivo rotacionado (outro arquivo no caminho): reabre do início
+		if current, err := os.Stat(path); err == nil && !os.SameFile(info, current) {
+			if reopened, err := os.Open(path); err == nil {
+				f.Close()
+				f, offset = reopened, 0
+				fmt.Fprint(w, "event: reset\ndata: \n\n")
+				wrote = true
+			}
+		}
+		if info, err = f.Stat(); err != nil {
+			return
+		}
+		// Truncado: recomeça
+		if info.Size() < offset {
+			offset = 0
+			fmt.Fprint(w, "event: reset\ndata: \n\n")
+			wrote = true
+		}
+
+		lines, next, err := readTailLines(f, offset, info.Size())
+		if err != nil {
+			s.logger.Error("Error tailing %s: %v", path, err)
+			return
+		}
+		offset = next
+		for _, line := range lines {
+			fmt.Fprintf(w, "id: %d\ndata: %s\n\n", line.end, line.text)
+			wrote = true
+		}
+		if !wrote && time.Since(lastWrite) >= tailKeepAlive {
+			fmt.Fprint(w, ": keep-alive\n\n")
+			wrote = true
+		}
+		if wrote {
+			if err := rc.Flush(); err != nil {
+				return
+			}
+			lastWrite = time.Now()
+		}
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-s.stop:
+			return
+		case <-deadline.C:
+			fmt.Fprint(w, "event: timeout\ndata: \n\n")
+			rc.Flush()
+			return
+		case <-poll.C:
+		}
+	}
+}
+
+// serveTailPage página que abre o stream e mostra as linhas
+func (s *Server) serveTailPage(w http.ResponseWriter, r *http.Request, path string) {
+	msg := s.messages(w, r)
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	base := filepath.Base(path)
+	err := tailTemplate.Execute(w, struct {
+		Theme    *Theme
+		Msg      *Messages
+		Name     string
+		Crumbs   []listingCrumb
+		Stream   string
+		MaxLines int
+	}{
+		Theme:    s.theme,
+		Msg:      msg,
+		Name:     base,
+		Crumbs:   listingCrumbs(strings.TrimSuffix(r.URL.Path, base)),
+		Stream:   "?" + r.URL.RawQuery,
+		MaxLines: 5000,
+	})
+	if err != nil {
+		s.logger.Error("Error rendering tail page for %s: %v", path, err)
+	}
+}
+
+// tailTemplate página de acompanhamento (rolagem automática enquanto o
+// visitante estiver no fim da página)
+var tailTemplate = template.Must(template.New("tail").Parse(`<!DOCTYPE html>
+<html lang="{{.Msg.Lang}}">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <title>{{.Name}}{{with .Theme.Title}} · {{.}}{{end}}</title>
+    <style>
+        {{.Theme.CSS}}
+        * { margin: 0; padding: 0; box-sizing: border-box; }
+        body {
+            font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, Oxygen, Ubuntu, Cantarell, sans-serif;
+            background: var(--qs-bg);
+            color: var(--qs-text);
+        }
+        header {
+            position: sticky;
+            top: 0;
+            display: flex;
+            flex-wrap: wrap;
+            align-items: center;
+            gap: 1rem;
+            padding: 0.75rem 2rem;
+            background: var(--qs-header-bg);
+            color: var(--qs-header-text);
+        }
+        header h1 { font-size: 1.25rem; font-weight: 600; word-break: break-all; flex: 1; }
+        header a { color: var(--qs-header-text); text-decoration: none; }
+        header a:hover { opacity: 0.8; }
+        header .sep { opacity: 0.6; margin: 0 0.15rem; }
+        #status { font-size: 0.875rem; opacity: 0.8; }
+        #status::before { content: "●"; margin-right: 0.35rem; color: #e74c3c; }
+        #status.live::before { color: #2ecc71; }
+        pre {
+            padding: 1rem 2rem;
+            font: 0.875rem/1.5 ui-monospace, SFMono-Regular, Menlo, Consolas, monospace;
+            white-space: pre-wrap;
+            word-break: break-all;
+        }
+        @media (max-width: 640px) {
+            header, pre { padding-left: 1rem; padding-right: 1rem; }
+        }
+    </style>
+</head>
+<body>
+    <header>
+        {{with .Theme.Logo}}<img src="{{.}}" alt="" style="max-height: 32px">{{end}}
+        <h1>{{range $i, $c := .Crumbs}}<a href="{{$c.Href}}">{{$c.Name}}</a>{{if $i}}<span class="sep">/</span>{{end}}{{end}}{{.Name}}</h1>
+        <span id="status">{{.Msg.T "Connecting…"}}</span>
+    </header>
+    <pre id="log"></pre>
+    <script>
+        const log = document.getElementById('log');
+        const status = document.getElementById('status');
+        const maxLines = {{.MaxLines}};
+        const source = new EventSource({{.Stream}});
+        const atBottom = () => window.innerHeight + window.scrollY >= document.body.scrollHeight - 8;
+        source.onopen = () => { status.textContent = {{.Msg.T "Following"}}; status.className = 'live'; };
+        source.onerror = () => { status.textContent = {{.Msg.T "Reconnecting…"}}; status.className = ''; };
+        source.onmessage = (e) => {
+            const follow = atBottom();
+            log.appendChild(document.createTextNode(e.data + '\n'));
+            while (log.childNodes.length > maxLines) log.removeChild(log.firstChild);
+            if (follow) window.scrollTo(0, document.body.scrollHeight);
+        };
+        source.addEventListener('reset', () => { log.textContent = ''; });
+        source.addEventListener('timeout', () => {
+            source.close();
+            status.textContent = {{.Msg.T "Stopped (time limit reached)"}};
+            status.className = '';
+        });
+    </script>
+</body>
+</html>`))
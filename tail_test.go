@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTailStartAndRead(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	writeTestFile(t, path, "one\ntwo\r\nthree\nfour\npartial")
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	info, _ := f.Stat()
+
+	start := tailStart(f, info.Size(), 2)
+	lines, next, err := readTailLines(f, start, info.Size())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lines) != 2 || lines[0].text != "three" || lines[1].text != "four" {
+		t.Fatalf("Expected last two complete lines, got %+v", lines)
+	}
+	// The incomplete last line waits for its newline
+	if next != info.Size()-int64(len("partial")) || lines[1].end != next {
+		t.Errorf("Expected offset before the partial line, got %d", next)
+	}
+
+	// Asking for more lines than the file has starts at the beginning
+	if start := tailStart(f, info.Size(), 100); start != 0 {
+		t.Errorf("Expected start 0, got %d", start)
+	}
+	lines, _, _ = readTailLines(f, 0, info.Size())
+	if len(lines) != 4 || lines[1].text != "two" {
+		t.Errorf("Expected carriage return stripped, got %+v", lines)
+	}
+}
+
+func TestNewLogTailRequiresAuth(t *testing.T) {
+	if _, err := NewLogTail(&TailConfig{Enabled: true}, false); err == nil {
+		t.Error("Expected error without token, allowed_ips or basic_auth")
+	}
+	if _, err := NewLogTail(&TailConfig{Enabled: true}, true); err != nil {
+		t.Errorf("Expected basic_auth to be enough, got %v", err)
+	}
+	if _, err := NewLogTail(&TailConfig{Enabled: true, AllowedIPs: []string{"nope"}}, false); err == nil {
+		t.Error("Expected error for invalid allowed_ips entry")
+	}
+}
+
+func TestTailStream(t *testing.T) {
+	root := t.TempDir()
+	path := filepath.Join(root, "build", "out.log")
+	writeTestFile(t, path, "old\nstarted\n")
+	server := newListingTestServer(t, root, func(c *Config) {
+		c.Features.Tail = &TailConfig{Enabled: true, Token: "secret", Backlog: 1}
+	})
+	server.tail.interval = 10 * time.Millisecond
+	ts := httptest.NewServer(server.mux)
+	defer ts.Close()
+
+	// Without the token the viewer is refused
+	resp, err := http.Get(ts.URL + "/build/out.log?follow=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("Expected 403 without token, got %d", resp.StatusCode)
+	}
+
+	// The viewer page points the EventSource at the same query
+	resp, err = http.Get(ts.URL + "/build/out.log?follow=1&token=secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	page := new(strings.Builder)
+	bufio.NewReader(resp.Body).WriteTo(page)
+	resp.Body.Close()
+	if !strings.Contains(page.String(), "EventSource") || !strings.Contains(page.String(), `"?follow=1\u0026token=secret"`) {
+		t.Errorf("Expected viewer page with stream URL, got %s", page.String())
+	}
+
+	req, _ := http.NewRequest("GET", ts.URL+"/build/out.log?follow=1", nil)
+	req.Header.Set("Accept", "text/event-stream")
+	req.Header.Set("Authorization", "Bearer secret")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Expected event stream, got %q", ct)
+	}
+
+	events := make(chan string, 10)
+	go func() {
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			if data, ok := strings.CutPrefix(scanner.Text(), "data: "); ok {
+				events <- data
+			}
+		}
+		close(events)
+	}()
+	next := func() string {
+		select {
+		case data := <-events:
+			return data
+		case <-time.After(2 * time.Second):
+			t.Fatal("Timed out waiting for event")
+			return ""
+		}
+	}
+
+	// Backlog of one line, then lines appended afterwards
+	if data := next(); data != "started" {
+		t.Errorf("Expected backlog line, got %q", data)
+	}
+	f, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	f.WriteString("step 1\n")
+	f.Close()
+	if data := next(); data != "step 1" {
+		t.Errorf("Expected appended line, got %q", data)
+	}
+}
+
+func TestTailMaxClients(t *testing.T) {
+	root := t.TempDir()
+	writeTestFile(t, filepath.Join(root, "a.log"), "x\n")
+	server := newListingTestServer(t, root, func(c *Config) {
+		c.Features.Tail = &TailConfig{Enabled: true, Token: "secret", MaxClients: 1}
+	})
+	server.tail.active.Store(1)
+
+	req := httptest.NewRequest("GET", "/a.log?follow=1&token=secret", nil)
+	req.Header.Set("Accept", "text/event-stream")
+	w := httptest.NewRecorder()
+	server.mux.ServeHTTP(w, req)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 over max_clients, got %d", w.Code)
+	}
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// tailnetPrefixes faixas de endereços que o Tailscale atribui aos nós
+var tailnetPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("fd7a:115c:a1e0::/48"),
+}
+
+// Tailnet compartilhamento restrito à tailnet (ou a uma interface WireGuard):
+// o servidor escuta só nos endereços da interface, recusa clientes de fora
+// dela e identifica o usuário e a máquina de cada conexão pelo tailscaled
+type Tailnet struct {
+	config   *TailscaleConfig
+	logger   *Logger
+	client   *http.Client
+	networks []netip.Prefix // clientes aceitos (além de loopback)
+}
+
+// tailnetIdentity dono da conexão segundo o tailscaled
+type tailnetIdentity struct {
+	Login string // ex: alice@example.com (tagged-devices para nós com tags)
+	Node  string // nome da máquina na tailnet
+}
+
+// String formata a identidade para o log de acesso
+func (id tailnetIdentity) String() string {
+	if id.Login == "" {
+		return ""
+	}
+	if id.Node == "" {
+		return id.Login
+	}
+	return id.Login + " on " + id.Node
+}
+
+// tailnetPeer identidade de uma conexão, consultada no primeiro uso
+type tailnetPeer struct {
+	tailnet  *Tailnet
+	addr     string
+	once     sync.Once
+	identity tailnetIdentity
+}
+
+type tailnetPeerKey struct{}
+
+// socket retorna o socket da LocalAPI do tailscaled
+func (c *TailscaleConfig) socket() string {
+	if c.Socket == "" {
+		return "/var/run/tailscale/tailscaled.sock"
+	}
+	return c.Socket
+}
+
+// NewTailnet cria o cliente da LocalAPI; networks são as redes aceitas
+func NewTailnet(config *TailscaleConfig, networks []netip.Prefix, logger *Logger) *Tailnet {
+	socket := config.socket()
+	dialer := &net.Dialer{Timeout: 2 * time.Second}
+	return &Tailnet{
+		config:   config,
+		logger:   logger,
+		networks: networks,
+		client: &http.Client{
+			Timeout: 2 * time.Second,
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					return dialer.DialContext(ctx, "unix", socket)
+				},
+			},
+		},
+	}
+}
+
+// tailnetAddrs endereços em que escutar e redes de onde aceitar clientes: os
+// endereços de tailnet de qualquer interface ou, com iface, todos os
+// endereços dessa interface (ex: wg0)
+func tailnetAddrs(iface string) ([]string, []netip.Prefix, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, nil, err
+	}
+	var hosts []string
+	var networks []netip.Prefix
+	for _, i := range ifaces {
+		if iface != "" && i.Name != iface || i.Flags&net.FlagUp == 0 {
+			continue
+		}
+		addrs, err := i.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, a := range addrs {
+			ipnet, ok := a.(*net.IPNet)
+			if !ok {
+				continue
+			}
+			addr, ok := netip.AddrFromSlice(ipnet.IP)
+			if !ok || addr.Unmap().IsLinkLocalUnicast() {
+				continue
+			}
+			addr = addr.Unmap()
+			if iface == "" {
+				if !inPrefixes(addr, tailnetPrefixes) {
+					continue
+				}
+			} else {
+				ones, _ := ipnet.Mask.Size()
+				networks = append(networks, netip.PrefixFrom(addr, ones).Masked())
+			}
+			hosts = append(hosts, addr.String())
+		}
+	}
+	if iface == "" {
+		networks = tailnetPrefixes
+	}
+	if len(hosts) == 0 {
+		if iface != "" {
+			return nil, nil, fmt.Errorf("interface %s has no usable address (is it up?)", iface)
+		}
+		return nil, nil, errors.New("no Tailscale address found (is tailscale up?)")
+	}
+	return hosts, networks, nil
+}
+
+// bindTailnet troca os endereços de escuta pelos da tailnet (ou da interface)
+func bindTailnet(config *Config) error {
+	hosts, _, err := tailnetAddrs(config.Tailscale.Interface)
+	if err != nil {
+		return err
+	}
+	config.Server.Host = hosts[0]
+	config.Server.Hosts = hosts
+	return nil
+}
+
+// inPrefixes informa se addr pertence a alguma das redes
+func inPrefixes(addr netip.Addr, prefixes []netip.Prefix) bool {
+	for _, p := range prefixes {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// whois consulta o dono do endereço (ip:porta) na LocalAPI do tailscaled
+func (t *Tailnet) whois(addr string) (tailnetIdentity, error) {
+	req, err := http.NewRequest(http.MethodGet, "http://local-tailscaled.sock/localapi/v0/whois?addr="+url.QueryEscape(addr), nil)
+	if err != nil {
+		return tailnetIdentity{}, err
+	}
+	req.Header.Set("Sec-Tailscale", "localapi")
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return tailnetIdentity{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return tailnetIdentity{}, fmt.Errorf("whois %s: %s", addr, resp.Status)
+	}
+	var reply struct {
+		Node struct {
+			Name         string
+			ComputedName string
+		}
+		UserProfile struct {
+			LoginName string
+		}
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&reply); err != nil {
+		return tailnetIdentity{}, err
+	}
+	node := reply.Node.ComputedName
+	if node == "" {
+		node = strings.SplitN(reply.Node.Name, ".", 2)[0]
+	}
+	return tailnetIdentity{Login: reply.UserProfile.LoginName, Node: node}, nil
+}
+
+// connContext anexa à conexão a identidade (consultada no primeiro uso)
+func (t *Tailnet) connContext(ctx context.Context, c net.Conn) context.Context {
+	return context.WithValue(ctx, tailnetPeerKey{}, &tailnetPeer{tailnet: t, addr: c.RemoteAddr().String()})
+}
+
+// resolve consulta a identidade uma vez por conexão; sem tailscaled (ex:
+// interface WireGuard comum) fica vazia
+func (p *tailnetPeer) resolve() tailnetIdentity {
+	p.once.Do(func() {
+		id, err := p.tailnet.whois(p.addr)
+		if err != nil {
+			p.tailnet.logger.Debug("Tailscale whois failed for %s: %v", p.addr, err)
+			return
+		}
+		p.identity = id
+	})
+	return p.identity
+}
+
+// peerIdentity identidade da conexão da requisição ("" fora da tailnet)
+func peerIdentity(ctx context.Context) string {
+	if peer, ok := ctx.Value(tailnetPeerKey{}).(*tailnetPeer); ok {
+		return peer.resolve().String()
+	}
+	return ""
+}
+
+// allowedUser confere o login contra allowed_users (globs, ex: *@example.com)
+func (t *Tailnet) allowedUser(login string) bool {
+	for _, pattern := range t.config.AllowedUsers {
+		if ok, _ := path.Match(pattern, login); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// allowedPeer aplica ao endereço (ip:porta) de uma conexão a restrição à
+// tailnet (e loopback) e allowed_users; peer pode ser nil
+func (t *Tailnet) allowedPeer(remoteAddr string, peer *tailnetPeer) bool {
+	ip, _, _ := net.SplitHostPort(remoteAddr)
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	if addr.IsLoopback() {
+		return true
+	}
+	if !inPrefixes(addr, t.networks) {
+		return false
+	}
+	if len(t.config.AllowedUsers) > 0 {
+		if peer == nil {
+			peer = &tailnetPeer{tailnet: t, addr: remoteAddr}
+		}
+		if login := peer.resolve().Login; !t.allowedUser(login) {
+			t.logger.Warn("Tailscale: denied %s (user %q)", remoteAddr, login)
+			return false
+		}
+	}
+	return true
+}
+
+// TailnetMiddleware aceita apenas clientes da tailnet (e loopback) e, com
+// allowed_users, apenas os usuários listados
+func TailnetMiddleware(t *Tailnet) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			peer, _ := r.Context().Value(tailnetPeerKey{}).(*tailnetPeer)
+			if !t.allowedPeer(r.RemoteAddr, peer) {
+				http.Error(w, "403 Forbidden", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// fakeTailscaled serves the LocalAPI whois endpoint on a unix socket
+func fakeTailscaled(t *testing.T, logins map[string]string) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("unix sockets")
+	}
+	socket := filepath.Join(t.TempDir(), "tailscaled.sock")
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/localapi/v0/whois" {
+			http.NotFound(w, r)
+			return
+		}
+		ip, _, _ := net.SplitHostPort(r.URL.Query().Get("addr"))
+		login, ok := logins[ip]
+		if !ok {
+			http.Error(w, "no match for IP:port", http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"Node":        map[string]string{"Name": "laptop.tail1234.ts.net."},
+			"UserProfile": map[string]string{"LoginName": login},
+		})
+	})}
+	go server.Serve(l)
+	t.Cleanup(func() { server.Close() })
+	return socket
+}
+
+func newTestTailnet(t *testing.T, config *TailscaleConfig) *Tailnet {
+	config.Socket = fakeTailscaled(t, map[string]string{
+		"100.101.102.103": "alice@example.com",
+		"100.101.102.104": "bob@other.org",
+	})
+	logger, _ := NewLogger(&LoggingConfig{Enabled: false})
+	return NewTailnet(config, tailnetPrefixes, logger)
+}
+
+func TestTailnetWhois(t *testing.T) {
+	tailnet := newTestTailnet(t, &TailscaleConfig{Enabled: true})
+
+	id, err := tailnet.whois("100.101.102.103:41000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id.String() != "alice@example.com on laptop" {
+		t.Errorf("Expected alice@example.com on laptop, got %q", id.String())
+	}
+	if _, err := tailnet.whois("100.64.0.9:41000"); err == nil {
+		t.Error("Expected an error for an unknown peer")
+	}
+}
+
+func TestTailnetMiddleware(t *testing.T) {
+	tailnet := newTestTailnet(t, &TailscaleConfig{Enabled: true})
+	handler := TailnetMiddleware(tailnet)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	tests := []struct {
+		remote string
+		status int
+	}{
+		{"100.101.102.103:41000", http.StatusOK},
+		{"[fd7a:115c:a1e0::1]:41000", http.StatusOK},
+		{"127.0.0.1:41000", http.StatusOK},
+		{"192.168.1.20:41000", http.StatusForbidden},
+		{"203.0.113.5:41000", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = tt.remote
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code != tt.status {
+			t.Errorf("%s: expected %d, got %d", tt.remote, tt.status, w.Code)
+		}
+	}
+}
+
+func TestTailnetAllowedUsers(t *testing.T) {
+	tailnet := newTestTailnet(t, &TailscaleConfig{Enabled: true, AllowedUsers: []string{"*@example.com"}})
+	handler := TailnetMiddleware(tailnet)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	tests := []struct {
+		remote string
+		status int
+	}{
+		{"100.101.102.103:41000", http.StatusOK},        // alice@example.com
+		{"100.101.102.104:41000", http.StatusForbidden}, // bob@other.org
+		{"100.64.0.9:41000", http.StatusForbidden},      // unknown to tailscaled
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = tt.remote
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code != tt.status {
+			t.Errorf("%s: expected %d, got %d", tt.remote, tt.status, w.Code)
+		}
+	}
+}
+
+func TestTailnetPeerIdentity(t *testing.T) {
+	tailnet := newTestTailnet(t, &TailscaleConfig{Enabled: true})
+
+	if got := peerIdentity(context.Background()); got != "" {
+		t.Errorf("Expected no identity outside the tailnet, got %q", got)
+	}
+	ctx := context.WithValue(context.Background(), tailnetPeerKey{}, &tailnetPeer{tailnet: tailnet, addr: "100.101.102.103:41000"})
+	if got := peerIdentity(ctx); got != "alice@example.com on laptop" {
+		t.Errorf("Expected alice@example.com on laptop, got %q", got)
+	}
+}
+
+func TestTailnetAddrsInterface(t *testing.T) {
+	ifaces, _ := net.Interfaces()
+	var loopback string
+	for _, i := range ifaces {
+		if i.Flags&net.FlagLoopback != 0 && i.Flags&net.FlagUp != 0 {
+			loopback = i.Name
+		}
+	}
+	if loopback == "" {
+		t.Skip("no loopback interface")
+	}
+	hosts, networks, err := tailnetAddrs(loopback)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !containsString(hosts, "127.0.0.1") {
+		t.Errorf("Expected 127.0.0.1 among %v", hosts)
+	}
+	if !inPrefixes(netip.MustParseAddr("127.0.0.2"), networks) {
+		t.Errorf("Expected loopback network among %v", networks)
+	}
+	if _, _, err := tailnetAddrs("does-not-exist0"); err == nil {
+		t.Error("Expected an error for a missing interface")
+	}
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// TextSlices trechos de arquivos de texto por linha: ?lines=1000-2000 (1 a
+// partir de 1, inclusivo) ou ?tail=500 (últimas linhas), para ferramentas
+// consultarem logs grandes sem baixar o arquivo inteiro
+type TextSlices struct {
+	config *TextSlicesConfig
+}
+
+// NewTextSlices cria o tratamento de ?lines e ?tail
+func NewTextSlices(config *TextSlicesConfig) *TextSlices {
+	return &TextSlices{config: config}
+}
+
+// maxLines retorna o maior número de linhas por resposta
+func (t *TextSlices) maxLines() int {
+	if t.config.MaxLines <= 0 {
+		return 10000
+	}
+	return t.config.MaxLines
+}
+
+// Handles informa se a requisição pede um trecho
+func (t *TextSlices) Handles(r *http.Request) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	q := r.URL.Query()
+	return q.Has("lines") || q.Has("tail")
+}
+
+// textSliceRequest trecho pedido; tail > 0 pede as últimas linhas, senão
+// as linhas de first a last (last = 0: até o limite)
+type textSliceRequest struct {
+	first, last int
+	tail        int
+}
+
+// parseTextSlice interpreta ?lines=A-B, ?lines=A-, ?lines=A e ?tail=N
+func parseTextSlice(r *http.Request, maxLines int) (textSliceRequest, error) {
+	q := r.URL.Query()
+	if q.Has("lines") && q.Has("tail") {
+		return textSliceRequest{}, errors.New("use either lines or tail")
+	}
+	if q.Has("tail") {
+		n, err := strconv.Atoi(q.Get("tail"))
+		if err != nil || n <= 0 {
+			return textSliceRequest{}, fmt.Errorf("invalid tail %q", q.Get("tail"))
+		}
+		if n > maxLines {
+			return textSliceRequest{}, fmt.Errorf("tail exceeds the limit of %d lines", maxLines)
+		}
+		return textSliceRequest{tail: n}, nil
+	}
+
+	spec := q.Get("lines")
+	from, to, isRange := strings.Cut(spec, "-")
+	first, err := strconv.Atoi(from)
+	if err != nil || first <= 0 {
+		return textSliceRequest{}, fmt.Errorf("invalid lines %q", spec)
+	}
+	last := first
+	if isRange {
+		last = first + maxLines - 1
+		if to != "" {
+			if last, err = strconv.Atoi(to); err != nil || last < first {
+				return textSliceRequest{}, fmt.Errorf("invalid lines %q", spec)
+			}
+		}
+	}
+	if last-first+1 > maxLines {
+		return textSliceRequest{}, fmt.Errorf("lines exceeds the limit of %d lines", maxLines)
+	}
+	return textSliceRequest{first: first, last: last}, nil
+}
+
+// isTextFile informa se a extensão é de texto (tipo text/*, código ou log)
+func isTextFile(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	if _, ok := syntaxes[ext]; ok {
+		return true
+	}
+	return strings.HasPrefix(mime.TypeByExtension(ext), "text/")
+}
+
+// sliceLines copia as linhas de first a last; a última linha pode não ter quebra
+func sliceLines(w io.Writer, f io.Reader, first, last int) error {
+	reader := bufio.NewReaderSize(f, 64<<10)
+	for n := 1; n <= last; n++ {
+		line, err := reader.ReadSlice('\n')
+		for err == bufio.ErrBufferFull {
+			// Linha maior que o buffer: continua lendo a mesma linha
+			if n >= first {
+				if _, werr := w.Write(line); werr != nil {
+					return werr
+				}
+			}
+			line, err = reader.ReadSlice('\n')
+		}
+		if n >= first {
+			if _, werr := w.Write(line); werr != nil {
+				return werr
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// tailOffset posição do início das últimas n linhas, lendo o arquivo de trás
+// para frente em blocos (a quebra final do arquivo não conta como linha)
+func tailOffset(f io.ReaderAt, size int64, n int) (int64, error) {
+	const block = 64 << 10
+	buf := make([]byte, block)
+	pos, found := size, 0
+	skipFinal := true
+	for pos > 0 {
+		start := pos - block
+		if start < 0 {
+			start = 0
+		}
+		chunk := buf[:pos-start]
+		if _, err := f.ReadAt(chunk, start); err != nil && err != io.EOF {
+			return 0, err
+		}
+		for i := len(chunk) - 1; i >= 0; i-- {
+			if chunk[i] != '\n' {
+				skipFinal = false
+				continue
+			}
+			if skipFinal {
+				skipFinal = false
+				continue
+			}
+			if found++; found == n {
+				return start + int64(i) + 1, nil
+			}
+		}
+		pos = start
+	}
+	return 0, nil
+}
+
+// serveTextSlice responde com o trecho pedido como text/plain
+func (s *Server) serveTextSlice(w http.ResponseWriter, r *http.Request, path string, info os.FileInfo) {
+	req, err := parseTextSlice(r, s.textSlices.maxLines())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !isTextFile(path) {
+		http.Error(w, "lines and tail only apply to text files", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		s.serveError(w, r, http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+	head := make([]byte, 8192)
+	n, _ := f.ReadAt(head, 0)
+	if bytes.IndexByte(head[:n], 0) >= 0 {
+		http.Error(w, "lines and tail only apply to text files", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	ctype := mime.TypeByExtension(filepath.Ext(path))
+	if !strings.HasPrefix(ctype, "text/") {
+		ctype = "text/plain; charset=utf-8"
+	}
+	w.Header().Set("Content-Type", ctype)
+	w.Header().Set("Last-Modified", info.ModTime().UTC().Format(http.TimeFormat))
+	if r.Method == http.MethodHead {
+		return
+	}
+
+	if req.tail > 0 {
+		offset, err := tailOffset(f, info.Size(), req.tail)
+		if err != nil {
+			s.serveError(w, r, http.StatusInternalServerError)
+			return
+		}
+		io.Copy(w, io.NewSectionReader(f, offset, info.Size()-offset))
+		return
+	}
+	if err := sliceLines(w, f, req.first, req.last); err != nil {
+		s.logger.Debug("Error serving lines of %s: %v", path, err)
+	}
+}
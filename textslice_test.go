@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTextSlices(t *testing.T) {
+	root := t.TempDir()
+	var content strings.Builder
+	for i := 1; i <= 100; i++ {
+		fmt.Fprintf(&content, "line %d\n", i)
+	}
+	writeTestFile(t, filepath.Join(root, "build.log"), content.String())
+	writeTestFile(t, filepath.Join(root, "image.png"), "\x89PNG\x00\x00")
+	server := newListingTestServer(t, root, func(c *Config) {
+		c.Features.TextSlices = &TextSlicesConfig{Enabled: true, MaxLines: 50}
+	})
+
+	get := func(target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		server.mux.ServeHTTP(w, httptest.NewRequest("GET", target, nil))
+		return w
+	}
+
+	tests := []struct {
+		query  string
+		status int
+		body   string
+	}{
+		{"lines=10-12", http.StatusOK, "line 10\nline 11\nline 12\n"},
+		{"lines=7", http.StatusOK, "line 7\n"},
+		{"lines=99-", http.StatusOK, "line 99\nline 100\n"},
+		{"lines=101-110", http.StatusOK, ""},
+		{"tail=3", http.StatusOK, "line 98\nline 99\nline 100\n"},
+		{"tail=500", http.StatusBadRequest, ""},
+		{"lines=1-51", http.StatusBadRequest, ""},
+		{"lines=5-2", http.StatusBadRequest, ""},
+		{"lines=abc", http.StatusBadRequest, ""},
+		{"lines=1&tail=1", http.StatusBadRequest, ""},
+	}
+	for _, tt := range tests {
+		w := get("/build.log?" + tt.query)
+		if w.Code != tt.status {
+			t.Errorf("%s: Expected status %d, got %d", tt.query, tt.status, w.Code)
+			continue
+		}
+		if tt.status == http.StatusOK && w.Body.String() != tt.body {
+			t.Errorf("%s: Expected %q, got %q", tt.query, tt.body, w.Body.String())
+		}
+	}
+
+	if w := get("/image.png?tail=1"); w.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("Expected 415 for binary file, got %d", w.Code)
+	}
+	// Without the query the whole file is served
+	if w := get("/build.log"); w.Body.String() != content.String() {
+		t.Errorf("Expected full file without slice query")
+	}
+}
+
+func TestTailOffsetAcrossBlocks(t *testing.T) {
+	// Lines spanning several 64 KiB read blocks, without a final newline
+	line := strings.Repeat("x", 40<<10)
+	content := line + "\n" + line + "\n" + line + "\nlast"
+	r := strings.NewReader(content)
+
+	offset, err := tailOffset(r, int64(len(content)), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := content[offset:]; got != line+"\nlast" {
+		t.Errorf("Expected last two lines, got %d bytes", len(got))
+	}
+	if offset, _ := tailOffset(r, int64(len(content)), 10); offset != 0 {
+		t.Errorf("Expected offset 0 when asking for more lines than available, got %d", offset)
+	}
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// themeLight e themeDark valores padrão das variáveis CSS das páginas embutidas
+var (
+	themeLight = map[string]string{
+		"bg":           "#f5f5f5",
+		"surface":      "#ffffff",
+		"text":         "#2c3e50",
+		"muted":        "#7f8c8d",
+		"accent":       "#3498db",
+		"accent-hover": "#2980b9",
+		"header-bg":    "#2c3e50",
+		"header-text":  "#ffffff",
+		"subheader-bg": "#34495e",
+		"border":       "#ecf0f1",
+		"hover":        "#f8f9fa",
+		"shadow":       "0 2px 8px rgba(0,0,0,0.1)",
+	}
+	themeDark = map[string]string{
+		"bg":           "#15191e",
+		"surface":      "#1e242b",
+		"text":         "#e4e8ec",
+		"muted":        "#8d99a6",
+		"accent":       "#5dade2",
+		"accent-hover": "#85c1e9",
+		"header-bg":    "#10151a",
+		"header-text":  "#ffffff",
+		"subheader-bg": "#26303a",
+		"border":       "#2c343d",
+		"hover":        "#252d35",
+		"shadow":       "0 2px 8px rgba(0,0,0,0.5)",
+	}
+)
+
+// themeValuePattern valores aceitos nas variáveis (cores, sombras, medidas)
+var themeValuePattern = regexp.MustCompile(`^[#(),.%\w\s-]+$`)
+
+// Theme identidade visual aplicada às páginas embutidas (listagens, páginas
+// de erro, desafio): variáveis CSS com modo escuro, logo, título e rodapé
+type Theme struct {
+	Title  string
+	Logo   string
+	Footer string
+	CSS    template.CSS // declarações das variáveis, já validadas
+}
+
+// NewTheme valida a configuração e gera as variáveis; config pode ser nil
+// (tema padrão, claro ou escuro conforme o sistema do visitante)
+func NewTheme(config *ThemeConfig) (*Theme, error) {
+	if config == nil {
+		config = &ThemeConfig{}
+	}
+	light, err := themeVariables(themeLight, config.Light, "light")
+	if err != nil {
+		return nil, err
+	}
+	dark, err := themeVariables(themeDark, config.Dark, "dark")
+	if err != nil {
+		return nil, err
+	}
+
+	var css string
+	switch config.ColorScheme {
+	case "", "auto":
+		css = ":root { color-scheme: light dark; " + light + "}\n" +
+			"        @media (prefers-color-scheme: dark) { :root { " + dark + "} }"
+	case "light":
+		css = ":root { color-scheme: light; " + light + "}"
+	case "dark":
+		css = ":root { color-scheme: dark; " + dark + "}"
+	default:
+		return nil, fmt.Errorf("invalid theme color_scheme %q (use auto, light or dark)", config.ColorScheme)
+	}
+
+	return &Theme{
+		Title:  config.Title,
+		Logo:   config.Logo,
+		Footer: config.Footer,
+		CSS:    template.CSS(css),
+	}, nil
+}
+
+// themeVariables combina os valores padrão com os configurados em declarações CSS
+func themeVariables(defaults, overrides map[string]string, scheme string) (string, error) {
+	values := make(map[string]string, len(defaults))
+	for name, value := range defaults {
+		values[name] = value
+	}
+	for name, value := range overrides {
+		if _, ok := defaults[name]; !ok {
+			return "", fmt.Errorf("unknown theme variable %s.%s", scheme, name)
+		}
+		if !themeValuePattern.MatchString(value) {
+			return "", fmt.Errorf("invalid value for theme variable %s.%s: %q", scheme, name, value)
+		}
+		values[name] = value
+	}
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&b, "--qs-%s: %s; ", name, values[name])
+	}
+	return b.String(), nil
+}
+
+// wantsHTML informa se o cliente aceita HTML (navegadores)
+func wantsHTML(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "text/html")
+}
+
+// htmlErrors informa se o erro deve ser a página embutida (tema ou idioma
+// configurados e cliente que aceita HTML) em vez de texto puro
+func (s *Server) htmlErrors(r *http.Request) bool {
+	return (s.config.Features.Theme != nil || s.config.Features.Language != "") && wantsHTML(r)
+}
+
+// serveErrorPage responde o erro com a página embutida do tema
+func (s *Server) serveErrorPage(w http.ResponseWriter, r *http.Request, status int, detail string) {
+	msg := s.messages(w, r)
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	if r.Method == http.MethodHead {
+		return
+	}
+	err := errorPageTemplate.Execute(w, struct {
+		Theme  *Theme
+		Msg    *Messages
+		Status int
+		Text   string
+		Detail string
+	}{s.theme, msg, status, msg.T(http.StatusText(status)), detail})
+	if err != nil {
+		s.logger.Error("Error rendering error page: %v", err)
+	}
+}
+
+// errorPageTemplate página de erro padrão quando há tema ou idioma configurado
+var errorPageTemplate = template.Must(template.New("error").Parse(`<!DOCTYPE html>
+<html lang="{{.Msg.Lang}}">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <title>{{.Status}} {{.Text}}{{with .Theme.Title}} · {{.}}{{end}}</title>
+    <style>
+        {{.Theme.CSS}}
+        body {
+            font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, Oxygen, Ubuntu, Cantarell, sans-serif;
+            display: flex;
+            flex-direction: column;
+            align-items: center;
+            justify-content: center;
+            min-height: 100vh;
+            margin: 0;
+            padding: 1rem;
+            background: var(--qs-bg);
+            color: var(--qs-text);
+        }
+        .card { background: var(--qs-surface); padding: 2rem 3rem; border-radius: 8px; box-shadow: var(--qs-shadow); text-align: center; max-width: 100%; }
+        .logo { max-height: 48px; margin-bottom: 1rem; }
+        h1 { font-size: 3rem; color: var(--qs-accent); }
+        h2 { font-size: 1.25rem; margin: 0.5rem 0 1rem; }
+        p { color: var(--qs-muted); white-space: pre-line; }
+        a { color: var(--qs-accent); }
+        footer { margin-top: 1.5rem; color: var(--qs-muted); font-size: 0.875rem; }
+    </style>
+</head>
+<body>
+    <div class="card">
+        {{with .Theme.Logo}}<img class="logo" src="{{.}}" alt="">{{end}}
+        <h1>{{.Status}}</h1>
+        <h2>{{.Text}}</h2>
+        {{with .Detail}}<p>{{.}}</p>{{end}}
+        <p><a href="/">{{.Msg.T "Home"}}</a></p>
+    </div>
+    {{with .Theme.Footer}}<footer>{{.}}</footer>{{end}}
+</body>
+</html>`))
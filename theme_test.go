@@ -0,0 +1,76 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNewThemeValidation(t *testing.T) {
+	cases := []*ThemeConfig{
+		{Light: map[string]string{"nope": "#fff"}},
+		{Dark: map[string]string{"accent": "red; } body { display: none"}},
+		{Light: map[string]string{"accent": "</style><script>"}},
+		{ColorScheme: "sepia"},
+	}
+	for _, config := range cases {
+		if _, err := NewTheme(config); err == nil {
+			t.Errorf("Expected error for %+v", config)
+		}
+	}
+
+	theme, err := NewTheme(&ThemeConfig{ColorScheme: "dark", Dark: map[string]string{"accent": "#e74c3c"}})
+	if err != nil {
+		t.Fatalf("Expected valid theme, got %v", err)
+	}
+	if css := string(theme.CSS); !strings.Contains(css, "--qs-accent: #e74c3c;") || strings.Contains(css, "prefers-color-scheme") {
+		t.Errorf("Expected dark-only variables with the override, got %s", css)
+	}
+}
+
+func TestThemeListing(t *testing.T) {
+	root := t.TempDir()
+	server := newListingTestServer(t, root, func(c *Config) {
+		c.Features.Theme = &ThemeConfig{
+			Title:  "Acme Downloads",
+			Logo:   "/logo.svg",
+			Footer: "© Acme",
+			Light:  map[string]string{"accent": "#e74c3c"},
+		}
+	})
+
+	w := httptest.NewRecorder()
+	server.mux.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	body := w.Body.String()
+	for _, want := range []string{"--qs-accent: #e74c3c;", "prefers-color-scheme: dark", "Acme Downloads", `src="/logo.svg"`, "<footer>© Acme</footer>"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected listing to contain %q", want)
+		}
+	}
+}
+
+func TestThemeErrorPage(t *testing.T) {
+	server := newListingTestServer(t, t.TempDir(), func(c *Config) {
+		c.Features.Theme = &ThemeConfig{Title: "Acme"}
+	})
+
+	// Browsers get the themed HTML page
+	req := httptest.NewRequest("GET", "/missing", nil)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml")
+	w := httptest.NewRecorder()
+	server.mux.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/html") {
+		t.Fatalf("Expected HTML 404, got %d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+	if !strings.Contains(w.Body.String(), "404 Not Found · Acme") {
+		t.Errorf("Expected themed title, got %s", w.Body.String())
+	}
+
+	// Other clients keep the plain text response
+	w = httptest.NewRecorder()
+	server.mux.ServeHTTP(w, httptest.NewRequest("GET", "/missing", nil))
+	if w.Body.String() != "Not Found\n" {
+		t.Errorf("Expected plain text body, got %q", w.Body.String())
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Throttle limita a banda das respostas para que downloads grandes não
+// saturem o uplink: cada resposta tem sua taxa e as respostas simultâneas de
+// um IP dividem outra. As regras por caminho substituem os limites globais
+type Throttle struct {
+	global  ThrottleRule
+	rules   []ThrottleRule
+	timeout time.Duration // write_timeout do servidor, renovado a cada bloco limitado
+
+	mu      sync.Mutex
+	clients map[string]*throttleClient // regra + IP -> bucket compartilhado
+
+	bytes  atomic.Int64
+	waited atomic.Int64 // nanossegundos
+}
+
+// throttleClient bucket de um IP, mantido enquanto houver respostas em curso
+type throttleClient struct {
+	bucket *byteBucket
+	active int
+}
+
+// NewThrottle valida os limites
+func NewThrottle(config *ThrottleConfig, writeTimeout time.Duration) (*Throttle, error) {
+	if config.ConnectionRate < 0 || config.ClientRate < 0 {
+		return nil, fmt.Errorf("throttle: connection_rate and client_rate must not be negative")
+	}
+	for i, rule := range config.Rules {
+		if len(rule.Paths) == 0 {
+			return nil, fmt.Errorf("throttle rule %d: at least one path is required", i)
+		}
+		if rule.ConnectionRate < 0 || rule.ClientRate < 0 {
+			return nil, fmt.Errorf("throttle rule %d: connection_rate and client_rate must not be negative", i)
+		}
+	}
+	return &Throttle{
+		global:  ThrottleRule{ConnectionRate: config.ConnectionRate, ClientRate: config.ClientRate},
+		rules:   config.Rules,
+		timeout: writeTimeout,
+		clients: make(map[string]*throttleClient),
+	}, nil
+}
+
+// match retorna a primeira regra que cobre o caminho e seu índice, ou os
+// limites globais (-1)
+func (t *Throttle) match(urlPath string) (ThrottleRule, int) {
+	for i, rule := range t.rules {
+		for _, pattern := range rule.Paths {
+			if matchGlob(pattern, urlPath) {
+				return rule, i
+			}
+		}
+	}
+	return t.global, -1
+}
+
+// acquire retorna o bucket do IP na regra, criando-o na primeira resposta
+func (t *Throttle) acquire(key string, rate int64) *byteBucket {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	c, ok := t.clients[key]
+	if !ok {
+		c = &throttleClient{bucket: newByteBucket(rate)}
+		t.clients[key] = c
+	}
+	c.active++
+	return c.bucket
+}
+
+// release descarta o bucket do IP quando a última resposta termina
+func (t *Throttle) release(key string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if c, ok := t.clients[key]; ok {
+		if c.active--; c.active <= 0 {
+			delete(t.clients, key)
+		}
+	}
+}
+
+// account soma os bytes enviados e a espera pela banda
+func (t *Throttle) account(written int, waited time.Duration) {
+	t.bytes.Add(int64(written))
+	t.waited.Add(int64(waited))
+}
+
+// ThrottleMiddleware envolve o ResponseWriter com os limites do caminho
+func ThrottleMiddleware(t *Throttle) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rule, index := t.match(r.URL.Path)
+			if rule.ConnectionRate == 0 && rule.ClientRate == 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			var buckets []*byteBucket
+			rate := rule.ConnectionRate
+			if rule.ConnectionRate > 0 {
+				buckets = append(buckets, newByteBucket(rule.ConnectionRate))
+			}
+			if rule.ClientRate > 0 {
+				ip, _, _ := net.SplitHostPort(r.RemoteAddr)
+				key := strconv.Itoa(index) + "\x00" + ip
+				buckets = append(buckets, t.acquire(key, rule.ClientRate))
+				defer t.release(key)
+				if rate == 0 || rule.ClientRate < rate {
+					rate = rule.ClientRate
+				}
+			}
+			chunk := hostLimitChunk
+			if rate < int64(chunk) {
+				chunk = int(rate)
+			}
+			debugNote(r, "throttle", strconv.FormatInt(rate, 10))
+			next.ServeHTTP(&throttledWriter{
+				ResponseWriter: w,
+				ctx:            r.Context(),
+				buckets:        buckets,
+				chunk:          chunk,
+				rc:             http.NewResponseController(w),
+				timeout:        t.timeout,
+				account:        t.account,
+			}, r)
+		})
+	}
+}
+
+// WriteMetrics exporta os bytes limitados e o tempo de espera
+func (t *Throttle) WriteMetrics(w io.Writer) {
+	t.mu.Lock()
+	clients := len(t.clients)
+	t.mu.Unlock()
+
+	writeMetric(w, "qserv_throttled_bytes_total", "Response bytes sent under a download bandwidth limit.", "counter",
+		[]metricSample{{value: float64(t.bytes.Load())}})
+	writeMetric(w, "qserv_throttle_wait_seconds_total", "Time responses waited for download bandwidth.", "counter",
+		[]metricSample{{value: time.Duration(t.waited.Load()).Seconds()}})
+	writeMetric(w, "qserv_throttled_clients", "Client IPs with throttled responses in progress.", "gauge",
+		[]metricSample{{value: float64(clients)}})
+}
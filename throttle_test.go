@@ -0,0 +1,101 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestThrottleRules(t *testing.T) {
+	root := t.TempDir()
+	writeTestFile(t, root+"/isos/big.iso", strings.Repeat("x", 3000))
+	writeTestFile(t, root+"/docs/big.txt", strings.Repeat("x", 3000))
+	writeTestFile(t, root+"/free/big.bin", strings.Repeat("x", 3000))
+	server := newListingTestServer(t, root, func(c *Config) {
+		c.Performance.Throttle = &ThrottleConfig{Enabled: true, ConnectionRate: 2000, Rules: []ThrottleRule{
+			{Paths: []string{"/isos/**"}, ConnectionRate: 1500},
+			{Paths: []string{"/free/**"}},
+		}}
+	})
+
+	// Each limited response gets one second of bandwidth up front, the rest waits
+	for _, tc := range []struct {
+		path      string
+		throttled bool
+	}{
+		{"/isos/big.iso", true},
+		{"/docs/big.txt", true},
+		{"/free/big.bin", false},
+	} {
+		start := time.Now()
+		w := httptest.NewRecorder()
+		server.mux.ServeHTTP(w, httptest.NewRequest("GET", tc.path, nil))
+		elapsed := time.Since(start)
+		if w.Body.Len() != 3000 {
+			t.Errorf("%s: Expected full body, got %d bytes", tc.path, w.Body.Len())
+		}
+		if tc.throttled && elapsed < 400*time.Millisecond {
+			t.Errorf("%s: Expected the response to be throttled, took %s", tc.path, elapsed)
+		}
+		if !tc.throttled && elapsed > 300*time.Millisecond {
+			t.Errorf("%s: Expected an exempt path to be served at once, took %s", tc.path, elapsed)
+		}
+	}
+
+	var b strings.Builder
+	server.throttle.WriteMetrics(&b)
+	if !strings.Contains(b.String(), "qserv_throttled_bytes_total 6000") {
+		t.Errorf("Expected 6000 throttled bytes in metrics, got %s", b.String())
+	}
+}
+
+func TestThrottleClientRate(t *testing.T) {
+	throttle, err := NewThrottle(&ThrottleConfig{Enabled: true, ClientRate: 2000}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := strings.Repeat("x", 1500)
+	var entered sync.WaitGroup
+	entered.Add(2)
+	handler := ThrottleMiddleware(throttle)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		entered.Done()
+		entered.Wait()
+		w.Write([]byte(body))
+	}))
+
+	// Two parallel responses to the same IP share its bucket: 3000 bytes at 2000/s
+	start := time.Now()
+	done := make(chan int)
+	for i := 0; i < 2; i++ {
+		go func() {
+			req := httptest.NewRequest("GET", "/file", nil)
+			req.RemoteAddr = "192.0.2.1:1234"
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+			done <- w.Body.Len()
+		}()
+	}
+	for i := 0; i < 2; i++ {
+		if n := <-done; n != len(body) {
+			t.Errorf("Expected full body, got %d bytes", n)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond {
+		t.Errorf("Expected the client's responses to share the limit, took %s", elapsed)
+	}
+
+	// The bucket goes away with the client's last response
+	if len(throttle.clients) != 0 {
+		t.Errorf("Expected no tracked clients, got %d", len(throttle.clients))
+	}
+
+	if _, err := NewThrottle(&ThrottleConfig{Enabled: true, Rules: []ThrottleRule{{ConnectionRate: 100}}}, 0); err == nil {
+		t.Errorf("Expected a rule without paths to be rejected")
+	}
+	if _, err := NewThrottle(&ThrottleConfig{Enabled: true, ClientRate: -1}, 0); err == nil {
+		t.Errorf("Expected a negative rate to be rejected")
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// TicketKeys chaves dos session tickets TLS trocadas a cada intervalo: a
+// atual cifra os tickets novos e as anteriores ainda decifram os emitidos
+// antes, até saírem da lista. Com key_file, as chaves vêm de um arquivo
+// comum aos nós do cluster (mantido por um rotacionador externo), para que
+// um cliente retome a sessão em qualquer nó
+type TicketKeys struct {
+	config  *SessionTicketsConfig
+	logger  *Logger
+	keyring *tls.Config // só guarda as chaves (EncryptTicket/DecryptTicket)
+
+	mu        sync.Mutex
+	keys      [][32]byte
+	rotated   time.Time // quando a chave atual entrou em uso
+	modTime   time.Time // do key_file na última leitura
+	rotations atomic.Int64
+}
+
+// NewTicketKeys cria a primeira chave (ou lê o key_file)
+func NewTicketKeys(config *SessionTicketsConfig, logger *Logger) (*TicketKeys, error) {
+	if config.Interval < 0 || config.Keep < 0 {
+		return nil, errors.New("session_tickets: interval and keep must not be negative")
+	}
+	t := &TicketKeys{config: config, logger: logger, keyring: &tls.Config{}}
+	if config.KeyFile != "" {
+		if _, err := t.load(); err != nil {
+			return nil, err
+		}
+		return t, nil
+	}
+	if err := t.rotate(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// interval retorna o intervalo entre rotações (ou releituras do key_file)
+func (c *SessionTicketsConfig) interval() time.Duration {
+	if c.Interval <= 0 {
+		return time.Hour
+	}
+	return time.Duration(c.Interval) * time.Second
+}
+
+// keep retorna quantas chaves anteriores seguem aceitas
+func (c *SessionTicketsConfig) keep() int {
+	if c.Keep <= 0 {
+		return 23
+	}
+	return c.Keep
+}
+
+// Rotate gera uma nova chave ou relê o key_file se ele mudou
+func (t *TicketKeys) Rotate() (string, error) {
+	if t.config.KeyFile != "" {
+		changed, err := t.load()
+		if err != nil {
+			return "", err
+		}
+		if !changed {
+			return "key file unchanged", nil
+		}
+		return fmt.Sprintf("loaded %d keys from %s", len(t.current()), t.config.KeyFile), nil
+	}
+	if err := t.rotate(); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("rotated (%d keys accepted)", len(t.current())), nil
+}
+
+// rotate coloca uma chave aleatória na frente e descarta as mais antigas
+func (t *TicketKeys) rotate() error {
+	var key [32]byte
+	if _, err := io.ReadFull(rand.Reader, key[:]); err != nil {
+		return err
+	}
+	t.mu.Lock()
+	keys := append([][32]byte{key}, t.keys...)
+	if len(keys) > t.config.keep()+1 {
+		keys = keys[:t.config.keep()+1]
+	}
+	t.apply(keys)
+	t.mu.Unlock()
+	return nil
+}
+
+// load lê o key_file: uma chave de 32 bytes em base64 por linha, a atual
+// primeiro; linhas vazias e comentários (#) são ignorados
+func (t *TicketKeys) load() (bool, error) {
+	info, err := os.Stat(t.config.KeyFile)
+	if err != nil {
+		return false, fmt.Errorf("session_tickets: %w", err)
+	}
+	t.mu.Lock()
+	unchanged := t.keys != nil && info.ModTime().Equal(t.modTime)
+	t.mu.Unlock()
+	if unchanged {
+		return false, nil
+	}
+
+	data, err := os.ReadFile(t.config.KeyFile)
+	if err != nil {
+		return false, fmt.Errorf("session_tickets: %w", err)
+	}
+	var keys [][32]byte
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		raw, err := base64.StdEncoding.DecodeString(line)
+		if err != nil || len(raw) != 32 {
+			return false, fmt.Errorf("session_tickets: %s:%d: expected a base64-encoded 32-byte key", t.config.KeyFile, n)
+		}
+		keys = append(keys, [32]byte(raw))
+	}
+	if len(keys) == 0 {
+		return false, fmt.Errorf("session_tickets: %s has no keys", t.config.KeyFile)
+	}
+
+	t.mu.Lock()
+	t.modTime = info.ModTime()
+	t.apply(keys)
+	t.mu.Unlock()
+	return true, nil
+}
+
+// apply instala as chaves (chamado com t.mu travado)
+func (t *TicketKeys) apply(keys [][32]byte) {
+	if t.keys == nil || keys[0] != t.keys[0] {
+		t.rotated = time.Now()
+		t.rotations.Add(1)
+	}
+	t.keys = keys
+	t.keyring.SetSessionTicketKeys(keys)
+}
+
+// current retorna as chaves em uso
+func (t *TicketKeys) current() [][32]byte {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.keys
+}
+
+// wrap cifra o ticket com a chave atual (tls.Config.WrapSession)
+func (t *TicketKeys) wrap(cs tls.ConnectionState, ss *tls.SessionState) ([]byte, error) {
+	return t.keyring.EncryptTicket(cs, ss)
+}
+
+// unwrap decifra o ticket com qualquer chave aceita; tickets de chaves já
+// descartadas caem no handshake completo (tls.Config.UnwrapSession)
+func (t *TicketKeys) unwrap(identity []byte, cs tls.ConnectionState) (*tls.SessionState, error) {
+	return t.keyring.DecryptTicket(identity, cs)
+}
+
+// WriteMetrics exporta rotações e idade da chave atual
+func (t *TicketKeys) WriteMetrics(w io.Writer) {
+	t.mu.Lock()
+	count, rotated := len(t.keys), t.rotated
+	t.mu.Unlock()
+	writeMetric(w, "qserv_tls_ticket_key_rotations_total", "TLS session ticket key rotations.", "counter",
+		[]metricSample{{value: float64(t.rotations.Load())}})
+	writeMetric(w, "qserv_tls_ticket_key_age_seconds", "Time since the current TLS session ticket key came into use.", "gauge",
+		[]metricSample{{value: time.Since(rotated).Seconds()}})
+	writeMetric(w, "qserv_tls_ticket_keys", "TLS session ticket keys accepted for resumption.", "gauge",
+		[]metricSample{{value: float64(count)}})
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/base64"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// ticketTestServer serves HTTPS with session ticket rotation and returns a
+// client that keeps its session cache across connections
+func ticketTestServer(t *testing.T, tickets *SessionTicketsConfig) (*Server, func() bool) {
+	t.Helper()
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "a.txt"), "a")
+	certFile, keyFile := writeTestCert(t, dir, time.Now().Add(24*time.Hour))
+	server := newListingTestServer(t, dir, func(c *Config) {
+		c.Security.EnableHTTPS = true
+		c.Security.CertFile = certFile
+		c.Security.KeyFile = keyFile
+		c.Security.SessionTickets = tickets
+	})
+	if server.tickets == nil {
+		t.Fatal("Expected session ticket rotation to be enabled")
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	httpServer := server.httpServer("")
+	go httpServer.ServeTLS(l, certFile, keyFile)
+	t.Cleanup(func() { httpServer.Close() })
+
+	client := &http.Client{Transport: &http.Transport{
+		DisableKeepAlives: true,
+		TLSClientConfig:   &tls.Config{InsecureSkipVerify: true, ClientSessionCache: tls.NewLRUClientSessionCache(8)},
+	}}
+	t.Cleanup(client.CloseIdleConnections)
+	url := "https://" + l.Addr().String() + "/a.txt"
+
+	// get makes a request on a new connection and reports whether it resumed
+	get := func() bool {
+		t.Helper()
+		resp, err := client.Get(url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.TLS.DidResume
+	}
+	return server, get
+}
+
+func TestTicketKeysRotation(t *testing.T) {
+	server, get := ticketTestServer(t, &SessionTicketsConfig{Enabled: true, Keep: 1})
+
+	get()
+	if !get() {
+		t.Fatal("Expected the second connection to resume")
+	}
+
+	// One rotation: the previous key still decrypts
+	server.tickets.Rotate()
+	if !get() {
+		t.Error("Expected resumption with the previous key")
+	}
+
+	// Two more: tickets from two keys ago are rejected
+	server.tickets.Rotate()
+	server.tickets.Rotate()
+	if get() {
+		t.Error("Expected no resumption after the key was dropped")
+	}
+	if n := len(server.tickets.current()); n != 2 {
+		t.Errorf("Expected current plus one previous key, got %d", n)
+	}
+}
+
+func writeTicketKeys(t *testing.T, path string, n int) {
+	t.Helper()
+	var lines []string
+	for i := 0; i < n; i++ {
+		key := make([]byte, 32)
+		rand.Read(key)
+		lines = append(lines, base64.StdEncoding.EncodeToString(key))
+	}
+	os.WriteFile(path, []byte("# current first\n"+strings.Join(lines, "\n")+"\n"), 0600)
+}
+
+func TestTicketKeysFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tickets.keys")
+	writeTicketKeys(t, path, 2)
+	keys, err := NewTicketKeys(&SessionTicketsConfig{Enabled: true, KeyFile: path}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys.current()) != 2 {
+		t.Fatalf("Expected 2 keys, got %d", len(keys.current()))
+	}
+	if result, _ := keys.Rotate(); result != "key file unchanged" {
+		t.Errorf("Expected unchanged file, got %q", result)
+	}
+
+	writeTicketKeys(t, path, 3)
+	os.Chtimes(path, time.Now().Add(time.Minute), time.Now().Add(time.Minute))
+	if _, err := keys.Rotate(); err != nil || len(keys.current()) != 3 {
+		t.Errorf("Expected 3 keys after reload, got %d (%v)", len(keys.current()), err)
+	}
+
+	// Nodes sharing the file resume each other's sessions
+	other, _ := NewTicketKeys(&SessionTicketsConfig{Enabled: true, KeyFile: path}, nil)
+	if keys.current()[0] != other.current()[0] {
+		t.Error("Expected nodes reading the same file to share the current key")
+	}
+}
+
+func TestNewTicketKeysErrors(t *testing.T) {
+	dir := t.TempDir()
+	bad := filepath.Join(dir, "bad.keys")
+	os.WriteFile(bad, []byte("not-base64\n"), 0600)
+	empty := filepath.Join(dir, "empty.keys")
+	os.WriteFile(empty, []byte("# nothing\n"), 0600)
+
+	for _, config := range []*SessionTicketsConfig{
+		{Enabled: true, Interval: -1},
+		{Enabled: true, KeyFile: filepath.Join(dir, "missing.keys")},
+		{Enabled: true, KeyFile: bad},
+		{Enabled: true, KeyFile: empty},
+	} {
+		if _, err := NewTicketKeys(config, nil); err == nil {
+			t.Errorf("Expected error for %+v", config)
+		}
+	}
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// weekdays nomes aceitos em "days"
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// timeWindow regra de janela de horário já interpretada
+type timeWindow struct {
+	paths         []string
+	deny          bool
+	loc           *time.Location
+	after, before time.Time
+	days          map[time.Weekday]bool
+	hours         bool
+	from, to      int // minutos desde a meia-noite
+	status        int
+}
+
+// compileTimeWindow interpreta e valida uma regra
+func compileTimeWindow(rule TimeWindowRule) (*timeWindow, error) {
+	if len(rule.Paths) == 0 {
+		return nil, fmt.Errorf("paths is required")
+	}
+	tw := &timeWindow{paths: rule.Paths, loc: time.Local, status: rule.Status}
+	switch rule.Action {
+	case "", "allow":
+	case "deny":
+		tw.deny = true
+	default:
+		return nil, fmt.Errorf("invalid action %q (use allow or deny)", rule.Action)
+	}
+	if tw.status == 0 {
+		tw.status = http.StatusNotFound
+	}
+	if tw.status < 400 || tw.status > 599 {
+		return nil, fmt.Errorf("invalid status %d", tw.status)
+	}
+
+	if rule.Timezone != "" {
+		loc, err := time.LoadLocation(rule.Timezone)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timezone %q: %w", rule.Timezone, err)
+		}
+		tw.loc = loc
+	}
+
+	var err error
+	if tw.after, err = parseWindowTime(rule.After, tw.loc); err != nil {
+		return nil, fmt.Errorf("invalid after: %w", err)
+	}
+	if tw.before, err = parseWindowTime(rule.Before, tw.loc); err != nil {
+		return nil, fmt.Errorf("invalid before: %w", err)
+	}
+	if !tw.after.IsZero() && !tw.before.IsZero() && !tw.after.Before(tw.before) {
+		return nil, fmt.Errorf("after must be earlier than before")
+	}
+
+	if len(rule.Days) > 0 {
+		tw.days = make(map[time.Weekday]bool)
+		for _, day := range rule.Days {
+			wd, ok := weekdays[strings.ToLower(day)[:min(3, len(day))]]
+			if !ok {
+				return nil, fmt.Errorf("invalid day %q", day)
+			}
+			tw.days[wd] = true
+		}
+	}
+
+	if rule.Hours != "" {
+		from, to, ok := strings.Cut(rule.Hours, "-")
+		if !ok {
+			return nil, fmt.Errorf("invalid hours %q (use HH:MM-HH:MM)", rule.Hours)
+		}
+		if tw.from, err = parseClock(from); err == nil {
+			tw.to, err = parseClock(to)
+		}
+		if err != nil || tw.from == tw.to {
+			return nil, fmt.Errorf("invalid hours %q (use HH:MM-HH:MM)", rule.Hours)
+		}
+		tw.hours = true
+	}
+	return tw, nil
+}
+
+// parseWindowTime aceita RFC 3339 ou data/hora local ao fuso da regra
+func parseWindowTime(value string, loc *time.Location) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	for _, layout := range []string{"2006-01-02 15:04", "2006-01-02T15:04", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, value, loc); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("%q is not a date (use \"2006-01-02 15:04\" or RFC 3339)", value)
+}
+
+// parseClock converte "HH:MM" em minutos desde a meia-noite
+func parseClock(value string) (int, error) {
+	h, m, ok := strings.Cut(strings.TrimSpace(value), ":")
+	hour, err1 := strconv.Atoi(h)
+	minute, err2 := strconv.Atoi(m)
+	if !ok || err1 != nil || err2 != nil || hour < 0 || hour > 24 || minute < 0 || minute > 59 || hour*60+minute > 24*60 {
+		return 0, fmt.Errorf("invalid time %q", value)
+	}
+	return hour*60 + minute, nil
+}
+
+// matches informa se a regra se aplica ao caminho
+func (tw *timeWindow) matches(path string) bool {
+	for _, pattern := range tw.paths {
+		if matchGlob(pattern, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// open informa se now está dentro da janela
+func (tw *timeWindow) open(now time.Time) bool {
+	now = now.In(tw.loc)
+	if !tw.after.IsZero() && now.Before(tw.after) {
+		return false
+	}
+	if !tw.before.IsZero() && !now.Before(tw.before) {
+		return false
+	}
+	if tw.days != nil && !tw.days[now.Weekday()] {
+		return false
+	}
+	if tw.hours {
+		minute := now.Hour()*60 + now.Minute()
+		if tw.from < tw.to {
+			return minute >= tw.from && minute < tw.to
+		}
+		// Faixa que cruza a meia-noite (ex: 22:00-06:00)
+		return minute >= tw.from || minute < tw.to
+	}
+	return true
+}
+
+// TimeWindows controle de acesso por horário
+type TimeWindows struct {
+	rules []*timeWindow
+	now   func() time.Time
+}
+
+// NewTimeWindows cria o controle a partir das regras configuradas
+func NewTimeWindows(rules []TimeWindowRule) (*TimeWindows, error) {
+	tws := &TimeWindows{now: time.Now}
+	for i, rule := range rules {
+		tw, err := compileTimeWindow(rule)
+		if err != nil {
+			return nil, fmt.Errorf("time_windows[%d]: %w", i, err)
+		}
+		tws.rules = append(tws.rules, tw)
+	}
+	return tws, nil
+}
+
+// Check retorna o status de rejeição para o caminho, ou 0 se permitido;
+// todas as regras que casam com o caminho precisam permitir o acesso
+func (tws *TimeWindows) Check(path string) int {
+	now := tws.now()
+	for _, tw := range tws.rules {
+		if tw.matches(path) && tw.open(now) == tw.deny {
+			return tw.status
+		}
+	}
+	return 0
+}
+
+// covers informa se alguma regra casa com o caminho
+func (tws *TimeWindows) covers(path string) bool {
+	for _, tw := range tws.rules {
+		if tw.matches(path) {
+			return true
+		}
+	}
+	return false
+}
+
+// TimeWindowMiddleware aplica as janelas de horário
+func TimeWindowMiddleware(tws *TimeWindows, logger *Logger) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if status := tws.Check(r.URL.Path); status != 0 {
+				logger.Debug("Time window: %s %s rejected with %d", r.Method, r.URL.Path, status)
+				// A resposta muda com o horário: não pode ficar em cache
+				w.Header().Set("Cache-Control", "no-store")
+				http.Error(w, http.StatusText(status), status)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTimeWindowsCheck(t *testing.T) {
+	tws, err := NewTimeWindows([]TimeWindowRule{
+		{Paths: []string{"/exams/**"}, Timezone: "America/Sao_Paulo", After: "2026-03-10 14:00"},
+		{Paths: []string{"/lab/**"}, Days: []string{"mon", "tue", "wed", "thu", "fri"}, Hours: "08:00-18:00", Timezone: "UTC", Status: http.StatusForbidden},
+		{Paths: []string{"/nightly/**"}, Action: "deny", Hours: "22:00-06:00", Timezone: "UTC"},
+	})
+	if err != nil {
+		t.Fatalf("NewTimeWindows failed: %v", err)
+	}
+
+	tests := []struct {
+		now  string
+		path string
+		want int
+	}{
+		// 14:00 in São Paulo is 17:00 UTC
+		{"2026-03-10T16:59:00Z", "/exams/final.pdf", http.StatusNotFound},
+		{"2026-03-10T17:00:00Z", "/exams/final.pdf", 0},
+		{"2026-03-10T16:59:00Z", "/other.pdf", 0},
+		// 2026-03-14 is a Saturday
+		{"2026-03-13T09:00:00Z", "/lab/notes.txt", 0},
+		{"2026-03-13T18:00:00Z", "/lab/notes.txt", http.StatusForbidden},
+		{"2026-03-14T09:00:00Z", "/lab/notes.txt", http.StatusForbidden},
+		// Range crossing midnight
+		{"2026-03-13T23:30:00Z", "/nightly/build.tar", http.StatusNotFound},
+		{"2026-03-13T05:59:00Z", "/nightly/build.tar", http.StatusNotFound},
+		{"2026-03-13T12:00:00Z", "/nightly/build.tar", 0},
+	}
+	for _, tt := range tests {
+		now, _ := time.Parse(time.RFC3339, tt.now)
+		tws.now = func() time.Time { return now }
+		if got := tws.Check(tt.path); got != tt.want {
+			t.Errorf("Check(%s) at %s = %d, expected %d", tt.path, tt.now, got, tt.want)
+		}
+	}
+}
+
+func TestTimeWindowsInvalid(t *testing.T) {
+	for _, rule := range []TimeWindowRule{
+		{},
+		{Paths: []string{"/a"}, Action: "maybe"},
+		{Paths: []string{"/a"}, Timezone: "Mars/Olympus"},
+		{Paths: []string{"/a"}, After: "tomorrow"},
+		{Paths: []string{"/a"}, After: "2026-02-01", Before: "2026-01-01"},
+		{Paths: []string{"/a"}, Days: []string{"someday"}},
+		{Paths: []string{"/a"}, Hours: "8-18"},
+		{Paths: []string{"/a"}, Hours: "25:00-26:00"},
+		{Paths: []string{"/a"}, Status: 200},
+	} {
+		if _, err := NewTimeWindows([]TimeWindowRule{rule}); err == nil {
+			t.Errorf("Expected error for rule %+v", rule)
+		}
+	}
+}
+
+func TestTimeWindowMiddleware(t *testing.T) {
+	logger, _ := NewLogger(&LoggingConfig{Enabled: false})
+	tws, _ := NewTimeWindows([]TimeWindowRule{{Paths: []string{"/exams/**"}, After: "2026-03-10T17:00:00Z"}})
+	tws.now = func() time.Time { return time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC) }
+	handler := TimeWindowMiddleware(tws, logger)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/exams/final.pdf", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 before the window opens, got %d", w.Code)
+	}
+	if cc := w.Header().Get("Cache-Control"); cc != "no-store" {
+		t.Errorf("Expected Cache-Control no-store, got %q", cc)
+	}
+
+	tws.now = func() time.Time { return time.Date(2026, 3, 10, 18, 0, 0, 0, time.UTC) }
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/exams/final.pdf", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected 200 inside the window, got %d", w.Code)
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// maxTombstoneReason tamanho máximo da explicação lida de um marcador
+const maxTombstoneReason = 64 << 10
+
+// Tombstones caminhos removidos, por lista de globs ou arquivos marcadores
+type Tombstones struct {
+	config *TombstoneConfig
+}
+
+// NewTombstones cria a lista de caminhos removidos
+func NewTombstones(config *TombstoneConfig) *Tombstones {
+	return &Tombstones{config: config}
+}
+
+// markerSuffix retorna o sufixo dos marcadores
+func (t *Tombstones) markerSuffix() string {
+	if t.config.MarkerSuffix == "" {
+		return ".gone"
+	}
+	return t.config.MarkerSuffix
+}
+
+// IsMarker informa se o nome é de um arquivo marcador
+func (t *Tombstones) IsMarker(name string) bool {
+	suffix := t.markerSuffix()
+	return t.config.Markers && strings.HasSuffix(name, suffix) && len(name) > len(suffix)
+}
+
+// Gone informa se urlPath foi removido, por glob ou por marcador ao lado do
+// caminho ou de um diretório acima dele; reason traz o conteúdo do marcador
+func (t *Tombstones) Gone(root, urlPath string) (gone bool, reason string) {
+	for _, pattern := range t.config.Paths {
+		if matchGlob(pattern, urlPath) {
+			return true, ""
+		}
+	}
+	if !t.config.Markers {
+		return false, ""
+	}
+
+	diskPath := root
+	for _, name := range strings.Split(strings.Trim(urlPath, "/"), "/") {
+		if name == "" {
+			continue
+		}
+		diskPath = filepath.Join(diskPath, name)
+		f, err := os.Open(diskPath + t.markerSuffix())
+		if err != nil {
+			continue
+		}
+		data, _ := io.ReadAll(io.LimitReader(f, maxTombstoneReason))
+		f.Close()
+		return true, strings.TrimSpace(string(data))
+	}
+	return false, ""
+}
+
+// serveGone responde 410 com a página explicativa configurada ou, na falta
+// dela, com a explicação do marcador
+func (s *Server) serveGone(w http.ResponseWriter, r *http.Request, reason string) {
+	if page := s.config.Features.Tombstones.Page; page != "" {
+		data, err := os.ReadFile(filepath.Join(s.requestRoot(r), page))
+		if err == nil {
+			ctype := mime.TypeByExtension(filepath.Ext(page))
+			if ctype == "" {
+				ctype = "text/html; charset=utf-8"
+			}
+			w.Header().Set("Content-Type", ctype)
+			w.WriteHeader(http.StatusGone)
+			if r.Method != http.MethodHead {
+				w.Write(data)
+			}
+			return
+		}
+		s.logger.Error("Tombstone page %s: %v", page, err)
+	}
+
+	if reason == "" {
+		s.serveError(w, r, http.StatusGone)
+		return
+	}
+	if s.htmlErrors(r) {
+		s.serveErrorPage(w, r, http.StatusGone, reason)
+		return
+	}
+	http.Error(w, http.StatusText(http.StatusGone)+"\n\n"+reason, http.StatusGone)
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTombstones(t *testing.T) {
+	root := t.TempDir()
+	os.WriteFile(filepath.Join(root, "report.pdf.gone"), []byte("Withdrawn at the author's request.\n"), 0644)
+	os.WriteFile(filepath.Join(root, "olddir.gone"), nil, 0644)
+	os.WriteFile(filepath.Join(root, "kept.txt"), []byte("kept"), 0644)
+
+	server := newListingTestServer(t, root, func(c *Config) {
+		c.Features.Tombstones = &TombstoneConfig{Enabled: true, Paths: []string{"/docs/v1/**"}, Markers: true}
+	})
+
+	tests := []struct {
+		path string
+		code int
+		body string
+	}{
+		{"/docs/v1/intro.html", http.StatusGone, ""},
+		{"/report.pdf", http.StatusGone, "Withdrawn at the author's request."},
+		{"/olddir/file.txt", http.StatusGone, ""},
+		{"/missing.txt", http.StatusNotFound, ""},
+		{"/report.pdf.gone", http.StatusNotFound, ""},
+		{"/kept.txt", http.StatusOK, "kept"},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		server.mux.ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+		if w.Code != tt.code {
+			t.Errorf("%s: expected %d, got %d", tt.path, tt.code, w.Code)
+		}
+		if !strings.Contains(w.Body.String(), tt.body) {
+			t.Errorf("%s: expected body to contain %q, got %q", tt.path, tt.body, w.Body.String())
+		}
+	}
+
+	w := httptest.NewRecorder()
+	server.mux.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if strings.Contains(w.Body.String(), ".gone") {
+		t.Errorf("Expected markers to be hidden from listing")
+	}
+}
+
+func TestTombstonePage(t *testing.T) {
+	root := t.TempDir()
+	os.WriteFile(filepath.Join(root, "gone.html"), []byte("<h1>This page was removed</h1>"), 0644)
+
+	server := newListingTestServer(t, root, func(c *Config) {
+		c.Features.Tombstones = &TombstoneConfig{Enabled: true, Paths: []string{"/old.html"}, Page: "gone.html"}
+	})
+
+	w := httptest.NewRecorder()
+	server.mux.ServeHTTP(w, httptest.NewRequest("GET", "/old.html", nil))
+	if w.Code != http.StatusGone {
+		t.Errorf("Expected 410, got %d", w.Code)
+	}
+	if !strings.Contains(w.Body.String(), "This page was removed") {
+		t.Errorf("Expected explanation page, got %q", w.Body.String())
+	}
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+		t.Errorf("Expected text/html, got %q", ct)
+	}
+}
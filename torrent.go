@@ -0,0 +1,296 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// fileDigest hashes de um arquivo, guardados em cache enquanto ele não mudar
+type fileDigest struct {
+	Size        int64     `json:"size"`
+	ModTime     time.Time `json:"mod_time"`
+	PieceLength int64     `json:"piece_length"`
+	Pieces      []byte    `json:"pieces"` // SHA-1 de cada peça, concatenados
+	SHA256      string    `json:"sha256"`
+}
+
+// Torrents gera .torrent e Metalink para arquivos grandes
+type Torrents struct {
+	config *TorrentConfig
+	logger *Logger
+	dir    string
+	mu     sync.Mutex
+}
+
+// NewTorrents cria o gerador
+func NewTorrents(config *TorrentConfig, logger *Logger) *Torrents {
+	dir := config.CacheDir
+	if dir == "" {
+		dir = ".qserv-torrents"
+	}
+	if abs, err := filepath.Abs(dir); err == nil {
+		dir = abs
+	}
+	return &Torrents{config: config, logger: logger, dir: dir}
+}
+
+// minSize retorna o tamanho mínimo dos arquivos atendidos
+func (t *Torrents) minSize() int64 {
+	if t.config.MinSize <= 0 {
+		return 64 << 20
+	}
+	return t.config.MinSize
+}
+
+// match separa o caminho do arquivo original e o formato pedido
+func (t *Torrents) match(urlPath string) (source, kind string, ok bool) {
+	if source, ok := strings.CutSuffix(urlPath, ".torrent"); ok {
+		return source, "torrent", true
+	}
+	if source, ok := strings.CutSuffix(urlPath, ".meta4"); ok && t.config.Metalink {
+		return source, "meta4", true
+	}
+	return "", "", false
+}
+
+// pieceLength escolhe o tamanho das peças: potência de 2 entre 256 KiB e
+// 16 MiB, mirando em até ~2000 peças
+func pieceLength(size int64) int64 {
+	length := int64(256 << 10)
+	for length < 16<<20 && size/length > 2000 {
+		length *= 2
+	}
+	return length
+}
+
+// digest retorna os hashes de path, do cache ou calculados em uma única
+// leitura; gerações são serializadas para não ler o mesmo arquivo em paralelo
+func (t *Torrents) digest(root, path string, info fs.FileInfo) (*fileDigest, error) {
+	rel, err := filepath.Rel(root, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return nil, fmt.Errorf("%s is outside the root", path)
+	}
+	cachePath := filepath.Join(t.dir, rel+".digest.json")
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if data, err := os.ReadFile(cachePath); err == nil {
+		var d fileDigest
+		if json.Unmarshal(data, &d) == nil && d.Size == info.Size() && d.ModTime.Equal(info.ModTime()) {
+			return &d, nil
+		}
+	}
+
+	start := time.Now()
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	d := &fileDigest{Size: info.Size(), ModTime: info.ModTime(), PieceLength: pieceLength(info.Size())}
+	whole := sha256.New()
+	piece := sha1.New()
+	for {
+		piece.Reset()
+		n, err := io.CopyN(io.MultiWriter(whole, piece), f, d.PieceLength)
+		if n > 0 {
+			d.Pieces = piece.Sum(d.Pieces)
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	d.SHA256 = hex.EncodeToString(whole.Sum(nil))
+	t.logger.Info("Hashed %s for torrent/metalink in %s", rel, time.Since(start).Round(time.Millisecond))
+
+	if err := os.MkdirAll(filepath.Dir(cachePath), 0755); err == nil {
+		if data, err := json.Marshal(d); err == nil {
+			os.WriteFile(cachePath, data, 0644)
+		}
+	}
+	return d, nil
+}
+
+// fileURLs retorna as URLs do arquivo: o próprio servidor e os web seeds
+func (t *Torrents) fileURLs(r *http.Request, source string) []string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	escaped := escapeURLPath(source)
+	urls := []string{scheme + "://" + r.Host + escaped}
+	for _, base := range t.config.WebSeeds {
+		urls = append(urls, strings.TrimSuffix(base, "/")+escaped)
+	}
+	return urls
+}
+
+// torrent gera o .torrent (BitTorrent v1, arquivo único) sem data de
+// criação, para que o info-hash e o arquivo não mudem entre requisições
+func (t *Torrents) torrent(d *fileDigest, name string, urls []string) []byte {
+	meta := map[string]any{
+		"created by": "qserv",
+		"url-list":   urls,
+		"info": map[string]any{
+			"name":         name,
+			"length":       d.Size,
+			"piece length": d.PieceLength,
+			"pieces":       d.Pieces,
+		},
+	}
+	if len(t.config.Trackers) > 0 {
+		meta["announce"] = t.config.Trackers[0]
+		tiers := make([]any, len(t.config.Trackers))
+		for i, tracker := range t.config.Trackers {
+			tiers[i] = []string{tracker}
+		}
+		meta["announce-list"] = tiers
+	}
+	var buf bytes.Buffer
+	bencode(&buf, meta)
+	return buf.Bytes()
+}
+
+// bencode codifica strings, bytes, inteiros, listas e dicionários (chaves ordenadas)
+func bencode(buf *bytes.Buffer, v any) {
+	switch v := v.(type) {
+	case string:
+		fmt.Fprintf(buf, "%d:%s", len(v), v)
+	case []byte:
+		fmt.Fprintf(buf, "%d:", len(v))
+		buf.Write(v)
+	case int64:
+		fmt.Fprintf(buf, "i%de", v)
+	case []string:
+		buf.WriteByte('l')
+		for _, item := range v {
+			bencode(buf, item)
+		}
+		buf.WriteByte('e')
+	case []any:
+		buf.WriteByte('l')
+		for _, item := range v {
+			bencode(buf, item)
+		}
+		buf.WriteByte('e')
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		buf.WriteByte('d')
+		for _, k := range keys {
+			bencode(buf, k)
+			bencode(buf, v[k])
+		}
+		buf.WriteByte('e')
+	default:
+		panic(fmt.Sprintf("bencode: unsupported type %T", v))
+	}
+}
+
+// metalink documento Metalink 4 (RFC 5854)
+type metalink struct {
+	XMLName xml.Name     `xml:"urn:ietf:params:xml:ns:metalink metalink"`
+	File    metalinkFile `xml:"file"`
+}
+
+type metalinkFile struct {
+	Name   string         `xml:"name,attr"`
+	Size   int64          `xml:"size"`
+	Hash   metalinkHash   `xml:"hash"`
+	Pieces metalinkPieces `xml:"pieces"`
+	URLs   []metalinkURL  `xml:"url"`
+}
+
+type metalinkHash struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+type metalinkPieces struct {
+	Length int64    `xml:"length,attr"`
+	Type   string   `xml:"type,attr"`
+	Hashes []string `xml:"hash"`
+}
+
+type metalinkURL struct {
+	Priority int    `xml:"priority,attr"`
+	Value    string `xml:",chardata"`
+}
+
+// metalink gera o documento .meta4, com o próprio servidor como primeira URL
+func (t *Torrents) metalink(d *fileDigest, name string, urls []string) []byte {
+	doc := metalink{File: metalinkFile{
+		Name:   name,
+		Size:   d.Size,
+		Hash:   metalinkHash{Type: "sha-256", Value: d.SHA256},
+		Pieces: metalinkPieces{Length: d.PieceLength, Type: "sha-1"},
+	}}
+	for i := 0; i+sha1.Size <= len(d.Pieces); i += sha1.Size {
+		doc.File.Pieces.Hashes = append(doc.File.Pieces.Hashes, hex.EncodeToString(d.Pieces[i:i+sha1.Size]))
+	}
+	for i, u := range urls {
+		doc.File.URLs = append(doc.File.URLs, metalinkURL{Priority: i + 1, Value: u})
+	}
+	out, _ := xml.MarshalIndent(doc, "", "  ")
+	return append([]byte(xml.Header), out...)
+}
+
+// serveTorrent atende <arquivo>.torrent e <arquivo>.meta4 de arquivos grandes
+// sem um .torrent real no disco; retorna false se a requisição não for desse tipo
+func (s *Server) serveTorrent(w http.ResponseWriter, r *http.Request, root string) bool {
+	source, kind, ok := s.torrents.match(r.URL.Path)
+	if !ok {
+		return false
+	}
+	path, info, canonical, err := s.resolvePath(root, source)
+	if err != nil || canonical != "" || !info.Mode().IsRegular() || info.Size() < s.torrents.minSize() {
+		return false
+	}
+	if s.schedule != nil {
+		if status, _ := s.schedule.Status(root, path); status != 0 {
+			return false
+		}
+	}
+
+	d, err := s.torrents.digest(root, path, info)
+	if err != nil {
+		s.logger.Error("Error hashing %s: %v", path, err)
+		s.serveError(w, r, http.StatusInternalServerError)
+		return true
+	}
+
+	debugNote(r, "serve", kind)
+	urls := s.torrents.fileURLs(r, source)
+	var body []byte
+	if kind == "torrent" {
+		w.Header().Set("Content-Type", "application/x-bittorrent")
+		body = s.torrents.torrent(d, info.Name(), urls)
+	} else {
+		w.Header().Set("Content-Type", "application/metalink4+xml")
+		body = s.torrents.metalink(d, info.Name(), urls)
+	}
+	http.ServeContent(w, r, "", info.ModTime(), bytes.NewReader(body))
+	return true
+}
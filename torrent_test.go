@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBencode(t *testing.T) {
+	var buf bytes.Buffer
+	bencode(&buf, map[string]any{"spam": []string{"a", "bb"}, "count": int64(3), "raw": []byte{0, 1}})
+	if got, want := buf.String(), "d5:counti3e3:raw2:\x00\x014:spaml1:a2:bbee"; got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+}
+
+func TestTorrentAndMetalink(t *testing.T) {
+	root := t.TempDir()
+	data := bytes.Repeat([]byte("0123456789abcdef"), 40000) // 640000 bytes, 3 pieces
+	os.WriteFile(filepath.Join(root, "big.iso"), data, 0644)
+	os.WriteFile(filepath.Join(root, "small.txt"), []byte("tiny"), 0644)
+	cacheDir := t.TempDir()
+
+	server := newListingTestServer(t, root, func(c *Config) {
+		c.Features.Torrents = &TorrentConfig{
+			Enabled:  true,
+			MinSize:  1024,
+			Trackers: []string{"udp://tracker.example.com:1337/announce"},
+			WebSeeds: []string{"https://mirror.example.net/pub/"},
+			Metalink: true,
+			CacheDir: cacheDir,
+		}
+	})
+
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", path, nil)
+		req.Host = "files.example.com"
+		server.mux.ServeHTTP(w, req)
+		return w
+	}
+
+	w := get("/big.iso.torrent")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200 for torrent, got %d", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/x-bittorrent" {
+		t.Errorf("Expected application/x-bittorrent, got %q", ct)
+	}
+	var pieces []byte
+	for i := 0; i < len(data); i += 256 << 10 {
+		sum := sha1.Sum(data[i:min(i+256<<10, len(data))])
+		pieces = append(pieces, sum[:]...)
+	}
+	body := w.Body.Bytes()
+	for _, want := range [][]byte{
+		[]byte("8:announce39:udp://tracker.example.com:1337/announce"),
+		[]byte("6:lengthi640000e"),
+		[]byte("12:piece lengthi262144e"),
+		append([]byte("6:pieces60:"), pieces...),
+		[]byte("8:url-listl32:http://files.example.com/big.iso38:https://mirror.example.net/pub/big.isoe"),
+	} {
+		if !bytes.Contains(body, want) {
+			t.Errorf("Expected torrent to contain %q", want)
+		}
+	}
+	if again := get("/big.iso.torrent"); !bytes.Equal(again.Body.Bytes(), body) {
+		t.Errorf("Expected identical torrent on second request")
+	}
+	if _, err := os.Stat(filepath.Join(cacheDir, "big.iso.digest.json")); err != nil {
+		t.Errorf("Expected cached digest: %v", err)
+	}
+
+	w = get("/big.iso.meta4")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200 for metalink, got %d", w.Code)
+	}
+	var doc metalink
+	if err := xml.Unmarshal(w.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("Invalid metalink: %v", err)
+	}
+	sum := sha256.Sum256(data)
+	if doc.File.Hash.Value != hex.EncodeToString(sum[:]) {
+		t.Errorf("Expected sha-256 %x, got %s", sum, doc.File.Hash.Value)
+	}
+	if len(doc.File.URLs) != 2 || doc.File.URLs[0].Value != "http://files.example.com/big.iso" {
+		t.Errorf("Unexpected metalink URLs: %+v", doc.File.URLs)
+	}
+	if len(doc.File.Pieces.Hashes) != 3 {
+		t.Errorf("Expected 3 piece hashes, got %d", len(doc.File.Pieces.Hashes))
+	}
+
+	if w := get("/small.txt.torrent"); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 below min_size, got %d", w.Code)
+	}
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+)
+
+// traceparentPattern header traceparent do W3C Trace Context (versão 00)
+var traceparentPattern = regexp.MustCompile(`^00-([0-9a-f]{32})-([0-9a-f]{16})-([0-9a-f]{2})$`)
+
+// upstreamPhases fases medidas em cada chamada a um upstream
+var upstreamPhases = []string{"dns", "connect", "tls", "ttfb"}
+
+// Tracer propaga o contexto de trace (traceparent/tracestate) às chamadas
+// feitas aos upstreams e mede DNS, conexão, TLS e tempo até o primeiro byte,
+// para separar a lentidão do qserv da do backend
+type Tracer struct {
+	config *TracingConfig
+	logger *Logger
+
+	mu    sync.Mutex
+	stats map[string]*upstreamStats // por host do upstream
+}
+
+// upstreamStats totais de um upstream para as métricas
+type upstreamStats struct {
+	requests map[string]int64 // por classe de status (2xx, 5xx, error)
+	seconds  map[string]float64
+	phases   map[string]int64 // chamadas em que a fase ocorreu (conexões reaproveitadas não têm dns/connect/tls)
+}
+
+// upstreamSpan atributos de uma chamada a um upstream
+type upstreamSpan struct {
+	TraceID  string
+	SpanID   string
+	ParentID string
+	Upstream string
+	Method   string
+	Status   int
+	Reused   bool
+	Phases   map[string]time.Duration
+	Total    time.Duration
+	Error    error
+}
+
+// NewTracer cria o rastreador de chamadas aos upstreams
+func NewTracer(config *TracingConfig, logger *Logger) *Tracer {
+	return &Tracer{config: config, logger: logger, stats: make(map[string]*upstreamStats)}
+}
+
+// randomHex gera n bytes aleatórios em hexadecimal
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Do executa a chamada ao upstream: continua o trace da requisição do
+// cliente (ou inicia um novo), anota as fases e registra as métricas. Com
+// t nil, só executa a chamada
+func (t *Tracer) Do(client *http.Client, incoming, req *http.Request) (*http.Response, error) {
+	if t == nil {
+		return client.Do(req)
+	}
+
+	span := &upstreamSpan{
+		TraceID:  randomHex(16),
+		SpanID:   randomHex(8),
+		Upstream: req.URL.Host,
+		Method:   req.Method,
+		Phases:   make(map[string]time.Duration),
+	}
+	flags := "01"
+	if m := traceparentPattern.FindStringSubmatch(incoming.Header.Get("traceparent")); m != nil && m[1] != "00000000000000000000000000000000" {
+		span.TraceID, span.ParentID, flags = m[1], m[2], m[3]
+		if state := incoming.Header.Get("tracestate"); state != "" {
+			req.Header.Set("tracestate", state)
+		}
+	}
+	req.Header.Set("traceparent", "00-"+span.TraceID+"-"+span.SpanID+"-"+flags)
+
+	var mu sync.Mutex
+	marks := make(map[string]time.Time)
+	mark := func(name string) {
+		mu.Lock()
+		marks[name] = time.Now()
+		mu.Unlock()
+	}
+	phase := func(name, start string) {
+		mu.Lock()
+		if begin, ok := marks[start]; ok {
+			span.Phases[name] = time.Since(begin)
+		}
+		mu.Unlock()
+	}
+	start := time.Now()
+	trace := &httptrace.ClientTrace{
+		DNSStart:             func(httptrace.DNSStartInfo) { mark("dns") },
+		DNSDone:              func(httptrace.DNSDoneInfo) { phase("dns", "dns") },
+		ConnectStart:         func(string, string) { mark("connect") },
+		ConnectDone:          func(string, string, error) { phase("connect", "connect") },
+		TLSHandshakeStart:    func() { mark("tls") },
+		TLSHandshakeDone:     func(tls.ConnectionState, error) { phase("tls", "tls") },
+		GotConn:              func(info httptrace.GotConnInfo) { mu.Lock(); span.Reused = info.Reused; mu.Unlock() },
+		GotFirstResponseByte: func() { mark("ttfb") },
+	}
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+
+	resp, err := client.Do(req)
+	span.Total = time.Since(start)
+	mu.Lock()
+	if first, ok := marks["ttfb"]; ok {
+		span.Phases["ttfb"] = first.Sub(start)
+	}
+	mu.Unlock()
+	span.Error = err
+	if resp != nil {
+		span.Status = resp.StatusCode
+	}
+	t.record(incoming, span)
+	return resp, err
+}
+
+// record anota o span no header de diagnóstico, nas métricas e, com
+// log_spans, no log
+func (t *Tracer) record(incoming *http.Request, span *upstreamSpan) {
+	debugNote(incoming, "trace", span.TraceID)
+	for _, name := range upstreamPhases {
+		if d, ok := span.Phases[name]; ok {
+			debugTiming(incoming, "upstream."+name, d)
+		}
+	}
+
+	class := "error"
+	if span.Error == nil {
+		class = fmt.Sprintf("%dxx", span.Status/100)
+	}
+	t.mu.Lock()
+	stats := t.stats[span.Upstream]
+	if stats == nil {
+		stats = &upstreamStats{requests: make(map[string]int64), seconds: make(map[string]float64), phases: make(map[string]int64)}
+		t.stats[span.Upstream] = stats
+	}
+	stats.requests[class]++
+	stats.seconds["total"] += span.Total.Seconds()
+	for name, d := range span.Phases {
+		stats.seconds[name] += d.Seconds()
+		stats.phases[name]++
+	}
+	t.mu.Unlock()
+
+	if t.config.LogSpans {
+		ms := func(name string) float64 { return float64(span.Phases[name].Microseconds()) / 1000 }
+		status := fmt.Sprintf("status=%d", span.Status)
+		if span.Error != nil {
+			status = fmt.Sprintf("error=%q", span.Error.Error())
+		}
+		t.logger.Info("span trace_id=%s span_id=%s parent_id=%s upstream=%s method=%s %s reused=%t dns_ms=%.1f connect_ms=%.1f tls_ms=%.1f ttfb_ms=%.1f total_ms=%.1f",
+			span.TraceID, span.SpanID, span.ParentID, span.Upstream, span.Method, status, span.Reused,
+			ms("dns"), ms("connect"), ms("tls"), ms("ttfb"), float64(span.Total.Microseconds())/1000)
+	}
+}
+
+// WriteMetrics exporta chamadas e tempo acumulado por upstream e fase
+// (tempo médio = seconds_total / phase_count_total)
+func (t *Tracer) WriteMetrics(w io.Writer) {
+	t.mu.Lock()
+	upstreams := make([]string, 0, len(t.stats))
+	for upstream := range t.stats {
+		upstreams = append(upstreams, upstream)
+	}
+	sort.Strings(upstreams)
+	var requests, seconds, counts []metricSample
+	for _, upstream := range upstreams {
+		stats := t.stats[upstream]
+		classes := make([]string, 0, len(stats.requests))
+		for class := range stats.requests {
+			classes = append(classes, class)
+		}
+		sort.Strings(classes)
+		for _, class := range classes {
+			requests = append(requests, metricSample{labels: map[string]string{"upstream": upstream, "status": class}, value: float64(stats.requests[class])})
+		}
+		for _, name := range append(append([]string{}, upstreamPhases...), "total") {
+			labels := map[string]string{"upstream": upstream, "phase": name}
+			seconds = append(seconds, metricSample{labels: labels, value: stats.seconds[name]})
+			if name != "total" {
+				counts = append(counts, metricSample{labels: labels, value: float64(stats.phases[name])})
+			}
+		}
+	}
+	t.mu.Unlock()
+	writeMetric(w, "qserv_upstream_requests_total", "Requests made to upstreams by status class.", "counter", requests)
+	writeMetric(w, "qserv_upstream_phase_seconds_total", "Time spent in each phase of upstream requests (ttfb and total are measured from the start of the request).", "counter", seconds)
+	writeMetric(w, "qserv_upstream_phase_count_total", "Upstream requests in which the phase happened (reused connections skip dns, connect and tls).", "counter", counts)
+}
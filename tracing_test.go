@@ -0,0 +1,75 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTracingPropagation(t *testing.T) {
+	var traceparent, tracestate string
+	mirror, _ := newPullThroughTest(t, func(w http.ResponseWriter, r *http.Request) {
+		traceparent, tracestate = r.Header.Get("traceparent"), r.Header.Get("tracestate")
+		io.WriteString(w, "payload")
+	}, nil)
+	logger, _ := NewLogger(&LoggingConfig{Enabled: false})
+	mirror.tracer = NewTracer(&TracingConfig{Enabled: true}, logger)
+
+	// The upstream call continues the client's trace with a new span
+	incoming := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	rec := pullThroughGet(mirror, "/mirror/file.txt", http.Header{"Traceparent": {incoming}, "Tracestate": {"vendor=1"}})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", rec.Code)
+	}
+	parts := strings.Split(traceparent, "-")
+	if len(parts) != 4 || parts[1] != "4bf92f3577b34da6a3ce929d0e0e4736" || parts[2] == "00f067aa0ba902b7" || parts[3] != "01" {
+		t.Errorf("Expected traceparent continuing the trace, got %q", traceparent)
+	}
+	if tracestate != "vendor=1" {
+		t.Errorf("Expected tracestate to be forwarded, got %q", tracestate)
+	}
+
+	// Without an incoming trace a new one is started
+	pullThroughGet(mirror, "/mirror/file.txt", nil)
+	if !traceparentPattern.MatchString(traceparent) || strings.Contains(traceparent, "4bf92f3577b34da6a3ce929d0e0e4736") {
+		t.Errorf("Expected a new trace, got %q", traceparent)
+	}
+
+	var b strings.Builder
+	mirror.tracer.WriteMetrics(&b)
+	host := mirror.upstream.Host
+	for _, want := range []string{
+		`qserv_upstream_requests_total{status="2xx",upstream="` + host + `"} 2`,
+		`qserv_upstream_phase_count_total{phase="ttfb",upstream="` + host + `"} 2`,
+		`qserv_upstream_phase_count_total{phase="connect",upstream="` + host + `"} 1`,
+	} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("Expected %q in metrics, got %s", want, b.String())
+		}
+	}
+}
+
+func TestTracingDebugHeader(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "payload")
+	}))
+	defer backend.Close()
+	server := newListingTestServer(t, t.TempDir(), func(c *Config) {
+		c.Logging.DebugHeader = &DebugHeaderConfig{Enabled: true, Token: "s3cret"}
+		c.Logging.Tracing = &TracingConfig{Enabled: true}
+		c.PullThrough = []PullThroughConfig{{Prefix: "/mirror/", Upstream: backend.URL}}
+	})
+
+	req := httptest.NewRequest("GET", "/mirror/file.txt", nil)
+	req.Header.Set("X-Qserv-Debug", "s3cret")
+	w := httptest.NewRecorder()
+	server.mux.ServeHTTP(w, req)
+	header := w.Header().Get("X-Qserv-Debug")
+	for _, want := range []string{"trace=", "upstream.connect=", "upstream.ttfb="} {
+		if !strings.Contains(header, want) {
+			t.Errorf("Expected %q in debug header, got %q", want, header)
+		}
+	}
+}
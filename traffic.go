@@ -0,0 +1,208 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	trafficBuckets = 60   // minutos mantidos (janela máxima de 1h)
+	trafficMaxKeys = 1000 // chaves distintas por dimensão e minuto; o excedente vira "(other)"
+)
+
+// trafficWindows janelas disponíveis, em minutos
+var trafficWindows = map[string]int64{"1m": 1, "5m": 5, "1h": 60}
+
+// TrafficStats contadores em memória por minuto (caminhos, IPs, referers e status)
+type TrafficStats struct {
+	mu      sync.Mutex
+	buckets [trafficBuckets]*trafficBucket
+	totals  map[int]int64 // requisições por status desde o início
+	now     func() time.Time
+}
+
+// trafficBucket contadores de um minuto
+type trafficBucket struct {
+	minute   int64
+	requests int64
+	paths    map[string]int64
+	ips      map[string]int64
+	referers map[string]int64
+	statuses map[int]int64
+}
+
+// TopEntry chave e contagem em um ranking
+type TopEntry struct {
+	Key   string `json:"key"`
+	Count int64  `json:"count"`
+}
+
+// TrafficReport ranking de uma janela
+type TrafficReport struct {
+	Window      string           `json:"window"`
+	Requests    int64            `json:"requests"`
+	TopPaths    []TopEntry       `json:"top_paths"`
+	TopIPs      []TopEntry       `json:"top_ips"`
+	TopReferers []TopEntry       `json:"top_referers"`
+	Statuses    map[string]int64 `json:"statuses"`
+}
+
+// NewTrafficStats cria os contadores
+func NewTrafficStats() *TrafficStats {
+	return &TrafficStats{totals: make(map[int]int64), now: time.Now}
+}
+
+// Record contabiliza uma requisição
+func (t *TrafficStats) Record(path, ip, referer string, status int) {
+	minute := t.now().Unix() / 60
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	idx := minute % trafficBuckets
+	bucket := t.buckets[idx]
+	if bucket == nil || bucket.minute != minute {
+		bucket = &trafficBucket{
+			minute:   minute,
+			paths:    make(map[string]int64),
+			ips:      make(map[string]int64),
+			referers: make(map[string]int64),
+			statuses: make(map[int]int64),
+		}
+		t.buckets[idx] = bucket
+	}
+
+	bucket.requests++
+	countKey(bucket.paths, path)
+	countKey(bucket.ips, ip)
+	countKey(bucket.referers, referer)
+	bucket.statuses[status]++
+	t.totals[status]++
+}
+
+// countKey incrementa uma chave respeitando o limite de chaves distintas
+func countKey(counts map[string]int64, key string) {
+	if key == "" {
+		return
+	}
+	if _, ok := counts[key]; !ok && len(counts) >= trafficMaxKeys {
+		key = "(other)"
+	}
+	counts[key]++
+}
+
+// Report soma os minutos da janela e retorna os n maiores de cada dimensão
+func (t *TrafficStats) Report(window string, n int) (*TrafficReport, error) {
+	minutes, ok := trafficWindows[window]
+	if !ok {
+		return nil, fmt.Errorf("invalid window: %q (must be 1m, 5m or 1h)", window)
+	}
+	now := t.now().Unix() / 60
+
+	paths := make(map[string]int64)
+	ips := make(map[string]int64)
+	referers := make(map[string]int64)
+	report := &TrafficReport{Window: window, Statuses: make(map[string]int64)}
+
+	t.mu.Lock()
+	for _, bucket := range t.buckets {
+		if bucket == nil || bucket.minute <= now-minutes {
+			continue
+		}
+		report.Requests += bucket.requests
+		mergeCounts(paths, bucket.paths)
+		mergeCounts(ips, bucket.ips)
+		mergeCounts(referers, bucket.referers)
+		for status, count := range bucket.statuses {
+			report.Statuses[strconv.Itoa(status)] += count
+		}
+	}
+	t.mu.Unlock()
+
+	report.TopPaths = topN(paths, n)
+	report.TopIPs = topN(ips, n)
+	report.TopReferers = topN(referers, n)
+	return report, nil
+}
+
+func mergeCounts(dst, src map[string]int64) {
+	for key, count := range src {
+		dst[key] += count
+	}
+}
+
+// topN ordena as contagens (desempate alfabético) e retorna as n primeiras
+func topN(counts map[string]int64, n int) []TopEntry {
+	entries := make([]TopEntry, 0, len(counts))
+	for key, count := range counts {
+		entries = append(entries, TopEntry{Key: key, Count: count})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Count != entries[j].Count {
+			return entries[i].Count > entries[j].Count
+		}
+		return entries[i].Key < entries[j].Key
+	})
+	if len(entries) > n {
+		entries = entries[:n]
+	}
+	return entries
+}
+
+// WriteMetrics exporta o total de requisições por status (MetricsCollector)
+func (t *TrafficStats) WriteMetrics(w io.Writer) {
+	t.mu.Lock()
+	statuses := make([]int, 0, len(t.totals))
+	for status := range t.totals {
+		statuses = append(statuses, status)
+	}
+	sort.Ints(statuses)
+	samples := make([]metricSample, len(statuses))
+	for i, status := range statuses {
+		samples[i] = metricSample{labels: map[string]string{"code": strconv.Itoa(status)}, value: float64(t.totals[status])}
+	}
+	t.mu.Unlock()
+
+	writeMetric(w, "qserv_http_requests_total", "HTTP requests served, by status code.", "counter", samples)
+}
+
+// TrafficStatsMiddleware contabiliza as requisições servidas
+func TrafficStatsMiddleware(stats *TrafficStats) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			wrapped := &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+			next.ServeHTTP(wrapped, r)
+
+			ip, _, err := net.SplitHostPort(r.RemoteAddr)
+			if err != nil {
+				ip = r.RemoteAddr
+			}
+			stats.Record(r.URL.Path, ip, r.Referer(), wrapped.statusCode)
+		})
+	}
+}
+
+// handleAdminTraffic retorna os rankings de uma janela (?window=1m|5m|1h&n=10)
+func (s *Server) handleAdminTraffic(w http.ResponseWriter, r *http.Request) {
+	window := r.URL.Query().Get("window")
+	if window == "" {
+		window = "5m"
+	}
+	n, err := strconv.Atoi(r.URL.Query().Get("n"))
+	if err != nil || n <= 0 {
+		n = 10
+	}
+
+	report, err := s.traffic.Report(window, n)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTrafficStatsWindows(t *testing.T) {
+	stats := NewTrafficStats()
+	now := time.Date(2024, 1, 1, 12, 0, 30, 0, time.UTC)
+	stats.now = func() time.Time { return now }
+
+	// Ten minutes ago: only visible in the 1h window
+	now = now.Add(-10 * time.Minute)
+	stats.Record("/old", "10.0.0.9", "", 200)
+	now = now.Add(10 * time.Minute)
+
+	for i := 0; i < 3; i++ {
+		stats.Record("/a", "10.0.0.1", "https://example.com/", 200)
+	}
+	stats.Record("/b", "10.0.0.2", "", 404)
+
+	report, err := stats.Report("5m", 10)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if report.Requests != 4 {
+		t.Errorf("Expected 4 requests in 5m window, got %d", report.Requests)
+	}
+	if len(report.TopPaths) != 2 || report.TopPaths[0] != (TopEntry{Key: "/a", Count: 3}) {
+		t.Errorf("Unexpected top paths: %+v", report.TopPaths)
+	}
+	if len(report.TopReferers) != 1 || report.TopReferers[0].Count != 3 {
+		t.Errorf("Unexpected top referers: %+v", report.TopReferers)
+	}
+	if report.Statuses["404"] != 1 {
+		t.Errorf("Expected one 404, got %v", report.Statuses)
+	}
+
+	report, _ = stats.Report("1h", 1)
+	if report.Requests != 5 || len(report.TopPaths) != 1 {
+		t.Errorf("Expected 5 requests and top-1 in 1h window, got %d %+v", report.Requests, report.TopPaths)
+	}
+
+	if _, err := stats.Report("2d", 10); err == nil {
+		t.Errorf("Expected error for invalid window")
+	}
+}
+
+func TestTrafficStatsKeyLimit(t *testing.T) {
+	stats := NewTrafficStats()
+	for i := 0; i < trafficMaxKeys+5; i++ {
+		stats.Record(fmt.Sprintf("/p%d", i), "10.0.0.1", "", 200)
+	}
+
+	report, _ := stats.Report("1m", trafficMaxKeys+10)
+	if len(report.TopPaths) != trafficMaxKeys+1 {
+		t.Errorf("Expected %d distinct keys including (other), got %d", trafficMaxKeys+1, len(report.TopPaths))
+	}
+	if report.TopPaths[0] != (TopEntry{Key: "(other)", Count: 5}) {
+		t.Errorf("Expected overflow counted as (other), got %+v", report.TopPaths[0])
+	}
+}
+
+func TestAdminTrafficEndpoints(t *testing.T) {
+	root := t.TempDir()
+	config := DefaultConfig()
+	config.Server.RootDir = root
+	config.Performance.EnableCompression = false
+	config.Admin = &AdminConfig{Enabled: true, Token: "s3cret"}
+	config.Stats = &StatsConfig{Enabled: true}
+
+	logger, _ := NewLogger(&LoggingConfig{Enabled: false})
+	server := NewServer(config, logger)
+	server.setupHandlers()
+
+	server.mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/missing.txt", nil))
+
+	w := adminRequest(server, "GET", "/_admin/stats/top?window=1m", "")
+	var report TrafficReport
+	if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+		t.Fatalf("Invalid JSON: %v", err)
+	}
+	if report.Statuses["404"] != 1 || len(report.TopPaths) != 1 || report.TopPaths[0].Key != "/missing.txt" {
+		t.Errorf("Unexpected report: %+v", report)
+	}
+
+	// Browsers authenticate to the dashboard with Basic auth (token as password)
+	req := httptest.NewRequest("GET", "/_admin/dashboard", nil)
+	req.SetBasicAuth("admin", "s3cret")
+	w = httptest.NewRecorder()
+	server.mux.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "/missing.txt") {
+		t.Errorf("Expected dashboard listing /missing.txt, got %d", w.Code)
+	}
+
+	w = adminRequest(server, "GET", "/_admin/metrics", "")
+	if !strings.Contains(w.Body.String(), `qserv_http_requests_total{code="404"} 1`) {
+		t.Errorf("Expected status counter in metrics, got:\n%s", w.Body.String())
+	}
+}
@@ -0,0 +1,363 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Protocolo do túnel: o qserv abre conexões de saída para o relay e se
+// apresenta com "QSERV-TUNNEL/1 <token>\n"; o relay responde "OK\n" e passa a
+// usar a conexão como se fosse um cliente HTTP/1.1 do qserv, repassando as
+// requisições públicas que recebe
+const tunnelHello = "QSERV-TUNNEL/1"
+
+// tunnelHandshakeTimeout limite para a troca de apresentação
+const tunnelHandshakeTimeout = 10 * time.Second
+
+// tunnelListener net.Listener cujas conexões são abertas para o relay: Accept
+// mantém até connections túneis ociosos ou em uso, reconectando com backoff
+type tunnelListener struct {
+	config *TunnelConfig
+	logger *Logger
+	slots  chan struct{}
+	done   chan struct{}
+	once   sync.Once
+
+	mu    sync.Mutex
+	state string // connected ou failing (só loga as mudanças)
+}
+
+// newTunnelListener cria o listener (as conexões são abertas em Accept)
+func newTunnelListener(config *TunnelConfig, logger *Logger) *tunnelListener {
+	return &tunnelListener{
+		config: config,
+		logger: logger,
+		slots:  make(chan struct{}, config.connections()),
+		done:   make(chan struct{}),
+	}
+}
+
+// connections retorna quantos túneis são mantidos abertos (default: 4)
+func (c *TunnelConfig) connections() int {
+	if c.Connections <= 0 {
+		return 4
+	}
+	return c.Connections
+}
+
+// validate confere o endereço do relay
+func (c *TunnelConfig) validate() error {
+	if _, _, err := net.SplitHostPort(c.Relay); err != nil {
+		return fmt.Errorf("tunnel: relay must be host:port: %w", err)
+	}
+	if c.Token == "" {
+		return errors.New("tunnel: token is required")
+	}
+	return nil
+}
+
+// Accept espera uma vaga e abre um túnel, tentando de novo até o relay responder
+func (l *tunnelListener) Accept() (net.Conn, error) {
+	select {
+	case l.slots <- struct{}{}:
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+	backoff := time.Second
+	for {
+		conn, err := l.dial()
+		if err == nil {
+			if l.setState("connected") {
+				l.logger.Info("Tunnel connected to relay %s", l.config.Relay)
+			}
+			return &tunnelConn{Conn: conn, release: func() { <-l.slots }}, nil
+		}
+		if l.setState("failing") {
+			l.logger.Error("Tunnel to %s: %v (retrying)", l.config.Relay, err)
+		}
+		select {
+		case <-time.After(backoff):
+		case <-l.done:
+			<-l.slots
+			return nil, net.ErrClosed
+		}
+		if backoff *= 2; backoff > 30*time.Second {
+			backoff = 30 * time.Second
+		}
+	}
+}
+
+// setState registra o estado da conexão com o relay; true se mudou
+func (l *tunnelListener) setState(state string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	changed := l.state != state
+	l.state = state
+	return changed
+}
+
+// dial abre uma conexão com o relay e faz a apresentação
+func (l *tunnelListener) dial() (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: tunnelHandshakeTimeout, KeepAlive: 30 * time.Second}
+	var conn net.Conn
+	var err error
+	if l.config.TLS {
+		host, _, _ := net.SplitHostPort(l.config.Relay)
+		conn, err = tls.DialWithDialer(dialer, "tcp", l.config.Relay, &tls.Config{ServerName: host})
+	} else {
+		conn, err = dialer.Dial("tcp", l.config.Relay)
+	}
+	if err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(time.Now().Add(tunnelHandshakeTimeout))
+	if _, err := fmt.Fprintf(conn, "%s %s\n", tunnelHello, l.config.Token); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	// Lê byte a byte: depois do OK a conexão pertence ao http.Server
+	reply, err := readLine(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if reply != "OK" {
+		conn.Close()
+		return nil, fmt.Errorf("relay refused tunnel: %s", reply)
+	}
+	conn.SetDeadline(time.Time{})
+	return conn, nil
+}
+
+// readLine lê uma linha curta sem bufferizar além do \n
+func readLine(r io.Reader) (string, error) {
+	var line []byte
+	b := make([]byte, 1)
+	for len(line) < 256 {
+		if _, err := r.Read(b); err != nil {
+			return "", err
+		}
+		if b[0] == '\n' {
+			return strings.TrimSuffix(string(line), "\r"), nil
+		}
+		line = append(line, b[0])
+	}
+	return "", errors.New("line too long")
+}
+
+// Close interrompe as reconexões
+func (l *tunnelListener) Close() error {
+	l.once.Do(func() { close(l.done) })
+	return nil
+}
+
+// Addr endereço do relay
+func (l *tunnelListener) Addr() net.Addr {
+	return tunnelAddr(l.config.Relay)
+}
+
+// tunnelAddr endereço de um túnel
+type tunnelAddr string
+
+func (a tunnelAddr) Network() string { return "tunnel" }
+func (a tunnelAddr) String() string  { return string(a) }
+
+// tunnelConn libera a vaga do túnel ao ser fechada
+type tunnelConn struct {
+	net.Conn
+	once    sync.Once
+	release func()
+}
+
+func (c *tunnelConn) Close() error {
+	err := c.Conn.Close()
+	c.once.Do(c.release)
+	return err
+}
+
+// serveTunnel atende pelo túnel com o mesmo handler; sem timeouts de leitura,
+// já que os túneis ficam ociosos no relay até uma requisição chegar
+func (s *Server) serveTunnel(l net.Listener) error {
+	server := s.httpServer(l.Addr().String())
+	server.ReadTimeout = 0
+	server.ReadHeaderTimeout = 0
+	server.IdleTimeout = 0
+	if !s.track(server) {
+		return http.ErrServerClosed
+	}
+	return server.Serve(l)
+}
+
+// Relay ponta pública do túnel: aceita os túneis do qserv e repassa por eles
+// as requisições recebidas
+type Relay struct {
+	token  string
+	logger *Logger
+	pool   chan *relayConn
+	proxy  *httputil.ReverseProxy
+}
+
+// relayConn túnel ocioso no pool; um leitor detecta o fechamento pelo qserv
+type relayConn struct {
+	net.Conn
+	closed chan error // resultado da leitura de vigilância
+}
+
+// NewRelay cria o relay
+func NewRelay(token string, logger *Logger) *Relay {
+	r := &Relay{token: token, logger: logger, pool: make(chan *relayConn, 1024)}
+	transport := &http.Transport{
+		DialContext:         func(ctx context.Context, _, _ string) (net.Conn, error) { return r.take(ctx) },
+		MaxIdleConnsPerHost: 1024,
+		IdleConnTimeout:     90 * time.Second,
+		DisableCompression:  true,
+	}
+	r.proxy = &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.Out.URL.Scheme = "http"
+			pr.Out.URL.Host = "tunnel"
+			pr.Out.Host = pr.In.Host
+			pr.SetXForwarded()
+		},
+		Transport: transport,
+		ErrorHandler: func(w http.ResponseWriter, req *http.Request, err error) {
+			r.logger.Error("Relay %s: %v", req.URL.Path, err)
+			http.Error(w, "502 Bad Gateway: tunnel unavailable", http.StatusBadGateway)
+		},
+	}
+	return r
+}
+
+// ServeTunnels aceita túneis no listener até ele ser fechado
+func (r *Relay) ServeTunnels(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go r.handshake(conn)
+	}
+}
+
+// handshake valida o token e coloca o túnel no pool
+func (r *Relay) handshake(conn net.Conn) {
+	conn.SetDeadline(time.Now().Add(tunnelHandshakeTimeout))
+	line, err := readLine(conn)
+	token, ok := strings.CutPrefix(line, tunnelHello+" ")
+	if err != nil || !ok || subtle.ConstantTimeCompare([]byte(token), []byte(r.token)) != 1 {
+		io.WriteString(conn, "ERR unauthorized\n")
+		conn.Close()
+		r.logger.Warn("Relay: rejected tunnel from %s", conn.RemoteAddr())
+		return
+	}
+	if _, err := io.WriteString(conn, "OK\n"); err != nil {
+		conn.Close()
+		return
+	}
+	conn.SetDeadline(time.Time{})
+
+	rc := &relayConn{Conn: conn, closed: make(chan error, 1)}
+	go func() {
+		// O qserv não envia nada antes de uma requisição: qualquer retorno é fechamento
+		_, err := conn.Read(make([]byte, 1))
+		rc.closed <- err
+	}()
+	select {
+	case r.pool <- rc:
+	default:
+		conn.Close()
+	}
+}
+
+// take retira um túnel vivo do pool, esperando até o contexto expirar
+func (r *Relay) take(ctx context.Context) (net.Conn, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	for {
+		select {
+		case rc := <-r.pool:
+			// Interrompe a leitura de vigilância; se ela terminou por outro
+			// motivo, o túnel caiu
+			rc.SetReadDeadline(time.Unix(1, 0))
+			err := <-rc.closed
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				rc.SetReadDeadline(time.Time{})
+				return rc.Conn, nil
+			}
+			rc.Close()
+		case <-ctx.Done():
+			return nil, errors.New("no tunnel connected")
+		}
+	}
+}
+
+// ServeHTTP repassa a requisição pública por um túnel
+func (r *Relay) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.proxy.ServeHTTP(w, req)
+}
+
+// runRelay executa o subcomando "qserv relay" e retorna o código de saída
+func runRelay(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("relay", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	tunnels := fs.String("listen", ":7000", "Address where qserv instances open tunnels")
+	public := fs.String("public", ":8080", "Public HTTP address forwarded through the tunnels")
+	token := fs.String("token", os.Getenv("QSERV_TUNNEL_TOKEN"), "Token required from tunnels (default: $QSERV_TUNNEL_TOKEN)")
+	certFile := fs.String("cert", "", "TLS certificate for the tunnel listener")
+	keyFile := fs.String("key", "", "TLS key for the tunnel listener")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *token == "" {
+		fmt.Fprintln(stderr, "A tunnel token is required (-token or QSERV_TUNNEL_TOKEN)")
+		return 2
+	}
+
+	logger, _ := NewLogger(&LoggingConfig{Enabled: true, Level: "info", ErrorLog: true})
+	relay := NewRelay(*token, logger)
+
+	l, err := net.Listen("tcp", *tunnels)
+	if err == nil && *certFile != "" {
+		var cert tls.Certificate
+		if cert, err = tls.LoadX509KeyPair(*certFile, *keyFile); err == nil {
+			l = tls.NewListener(l, &tls.Config{Certificates: []tls.Certificate{cert}})
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "Error listening for tunnels: %v\n", err)
+		return 1
+	}
+	defer l.Close()
+	server := &http.Server{Addr: *public, Handler: relay, ReadHeaderTimeout: 30 * time.Second}
+
+	errChan := make(chan error, 2)
+	go func() { errChan <- relay.ServeTunnels(l) }()
+	go func() { errChan <- server.ListenAndServe() }()
+	fmt.Fprintf(stdout, "Relay accepting tunnels on %s, serving public requests on %s\n", l.Addr(), *public)
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+	select {
+	case err := <-errChan:
+		fmt.Fprintf(stderr, "Relay error: %v\n", err)
+		return 1
+	case <-sigChan:
+		server.Close()
+		return 0
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// startTestRelay starts a relay and returns its tunnel address and public URL
+func startTestRelay(t *testing.T) (string, string) {
+	t.Helper()
+	logger, _ := NewLogger(&LoggingConfig{Enabled: false})
+	relay := NewRelay("s3cret", logger)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go relay.ServeTunnels(l)
+	public := httptest.NewServer(relay)
+	t.Cleanup(public.Close)
+	return l.Addr().String(), public.URL
+}
+
+func TestTunnelThroughRelay(t *testing.T) {
+	relayAddr, publicURL := startTestRelay(t)
+	root := t.TempDir()
+	writeTestFile(t, root+"/file.txt", "hello")
+	server := newListingTestServer(t, root, nil)
+	logger, _ := NewLogger(&LoggingConfig{Enabled: false})
+	tunnel := newTunnelListener(&TunnelConfig{Enabled: true, Relay: relayAddr, Token: "s3cret", Connections: 2}, logger)
+	defer tunnel.Close()
+	go server.serveTunnel(tunnel)
+
+	// More concurrent requests than tunnels: they wait for a free one
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := http.Get(publicURL + "/file.txt")
+			if err != nil {
+				t.Errorf("Request through relay failed: %v", err)
+				return
+			}
+			defer resp.Body.Close()
+			body, _ := io.ReadAll(resp.Body)
+			if resp.StatusCode != http.StatusOK || string(body) != "hello" {
+				t.Errorf("Expected 200 hello through the tunnel, got %d %q", resp.StatusCode, body)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestTunnelToken(t *testing.T) {
+	relayAddr, _ := startTestRelay(t)
+	logger, _ := NewLogger(&LoggingConfig{Enabled: false})
+	tunnel := newTunnelListener(&TunnelConfig{Relay: relayAddr, Token: "wrong"}, logger)
+	if _, err := tunnel.dial(); err == nil || !strings.Contains(err.Error(), "unauthorized") {
+		t.Errorf("Expected the relay to refuse a wrong token, got %v", err)
+	}
+
+	if err := (&TunnelConfig{Relay: "relay.example.com"}).validate(); err == nil {
+		t.Errorf("Expected relay without port to be rejected")
+	}
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// uploadIDPattern IDs de upload aceitos (escolhidos pelo cliente)
+var uploadIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{8,128}$`)
+
+// uploadProgressKeep tempo em que o resultado de um upload continua consultável
+const uploadProgressKeep = time.Minute
+
+// UploadProgress acompanha os bytes recebidos de cada upload identificado
+// por ?upload_id= (ou X-Upload-ID), para a listagem e frontends próprios
+// mostrarem progresso e tempo restante
+type UploadProgress struct {
+	route string
+	now   func() time.Time
+	stop  <-chan struct{} // fechado no encerramento do servidor (nil: nunca)
+
+	mu      sync.Mutex
+	uploads map[string]*uploadState
+}
+
+// uploadState progresso de um upload
+type uploadState struct {
+	received atomic.Int64
+	total    int64 // Content-Length (-1 se desconhecido)
+	started  time.Time
+	finished time.Time // zero enquanto recebe (UploadProgress.mu)
+	status   int       // status da resposta ao terminar (UploadProgress.mu)
+}
+
+// UploadReport estado de um upload, como devolvido ao cliente
+type UploadReport struct {
+	ID       string  `json:"id"`
+	State    string  `json:"state"` // uploading, done ou error
+	Received int64   `json:"received"`
+	Total    int64   `json:"total"`             // -1 se o cliente não informou o tamanho
+	Percent  float64 `json:"percent,omitempty"` // com total conhecido
+	Rate     float64 `json:"rate"`              // bytes por segundo desde o início
+	ETA      float64 `json:"eta,omitempty"`     // segundos restantes estimados
+	Status   int     `json:"status,omitempty"`  // status HTTP do upload, ao terminar
+	Elapsed  float64 `json:"elapsed"`           // segundos desde o início
+}
+
+// NewUploadProgress cria o acompanhamento servido em route
+func NewUploadProgress(route string) *UploadProgress {
+	if route == "" {
+		route = "/_upload_progress"
+	}
+	return &UploadProgress{route: route, now: time.Now, uploads: make(map[string]*uploadState)}
+}
+
+// uploadID retorna o ID de upload da requisição, se válido
+func uploadID(r *http.Request) string {
+	id := r.URL.Query().Get("upload_id")
+	if id == "" {
+		id = r.Header.Get("X-Upload-ID")
+	}
+	if !uploadIDPattern.MatchString(id) {
+		return ""
+	}
+	return id
+}
+
+// Start registra um upload e retorna o estado a atualizar
+func (p *UploadProgress) Start(id string, total int64) *uploadState {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := p.now()
+	for key, state := range p.uploads {
+		if !state.finished.IsZero() && now.Sub(state.finished) > uploadProgressKeep {
+			delete(p.uploads, key)
+		}
+	}
+	state := &uploadState{total: total, started: now}
+	p.uploads[id] = state
+	return state
+}
+
+// Finish marca o upload como concluído com o status da resposta
+func (p *UploadProgress) Finish(state *uploadState, status int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	state.finished = p.now()
+	state.status = status
+}
+
+// Report retorna o estado atual do upload
+func (p *UploadProgress) Report(id string) (UploadReport, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	state, ok := p.uploads[id]
+	if !ok {
+		return UploadReport{}, false
+	}
+	end := state.finished
+	if end.IsZero() {
+		end = p.now()
+	}
+	report := UploadReport{ID: id, State: "uploading", Received: state.received.Load(), Total: state.total}
+	elapsed := end.Sub(state.started).Seconds()
+	report.Elapsed = elapsed
+	if elapsed > 0 {
+		report.Rate = float64(report.Received) / elapsed
+	}
+	if report.Total > 0 {
+		report.Percent = 100 * float64(report.Received) / float64(report.Total)
+		if report.Rate > 0 && state.finished.IsZero() {
+			report.ETA = float64(report.Total-report.Received) / report.Rate
+		}
+	}
+	if !state.finished.IsZero() {
+		report.State, report.Status = "done", state.status
+		if state.status >= 400 {
+			report.State = "error"
+		}
+	}
+	return report, true
+}
+
+// progressReader conta os bytes lidos do corpo do upload
+type progressReader struct {
+	io.ReadCloser
+	state *uploadState
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.state.received.Add(int64(n))
+	return n, err
+}
+
+// Handler responde com o estado do upload ?id=: JSON ou, para o EventSource
+// (Accept: text/event-stream), eventos progress até o done ou error final
+func (p *UploadProgress) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-store")
+		id := r.URL.Query().Get("id")
+		if !strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+			report, ok := p.Report(id)
+			if !ok {
+				writeJSONError(w, http.StatusNotFound, fmt.Errorf("unknown upload %q", id))
+				return
+			}
+			writeJSON(w, http.StatusOK, report)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("X-Accel-Buffering", "no")
+		rc := http.NewResponseController(w)
+		rc.SetWriteDeadline(time.Time{})
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, "retry: 1000\n\n")
+		rc.Flush()
+
+		// O EventSource costuma abrir antes do upload chegar: espera o ID aparecer
+		poll := time.NewTicker(500 * time.Millisecond)
+		defer poll.Stop()
+		waiting := time.NewTimer(30 * time.Second)
+		defer waiting.Stop()
+		for {
+			if report, ok := p.Report(id); ok {
+				waiting.Stop()
+				event := "progress"
+				if report.State != "uploading" {
+					event = report.State
+				}
+				data, _ := json.Marshal(report)
+				fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data)
+				if err := rc.Flush(); err != nil || event != "progress" {
+					return
+				}
+			}
+
+			select {
+			case <-r.Context().Done():
+				return
+			case <-p.stop:
+				return
+			case <-waiting.C:
+				fmt.Fprint(w, "event: timeout\ndata: \n\n")
+				rc.Flush()
+				return
+			case <-poll.C:
+			}
+		}
+	})
+}
+
+// trackUpload acompanha o upload da requisição, se ela tiver um ID; a
+// função retornada registra o status final
+func (s *Server) trackUpload(w http.ResponseWriter, r *http.Request) (http.ResponseWriter, func()) {
+	id := uploadID(r)
+	if s.upProgress == nil || id == "" {
+		return w, func() {}
+	}
+	state := s.upProgress.Start(id, r.ContentLength)
+	r.Body = &progressReader{ReadCloser: r.Body, state: state}
+	rw := &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+	return rw, func() { s.upProgress.Finish(state, rw.statusCode) }
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestUploadProgressReport(t *testing.T) {
+	server, _ := newUploadTestServer(t, func(c *UploadsConfig) { c.Progress = true })
+	report := func(id string) (int, UploadReport) {
+		w := httptest.NewRecorder()
+		server.mux.ServeHTTP(w, httptest.NewRequest("GET", "/_upload_progress?id="+id, nil))
+		var r UploadReport
+		json.Unmarshal(w.Body.Bytes(), &r)
+		return w.Code, r
+	}
+
+	body := strings.Repeat("x", 4096)
+	if w := uploadPut(server, "/incoming/big.bin?upload_id=abc12345", body); w.Code != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d", w.Code)
+	}
+	code, r := report("abc12345")
+	if code != http.StatusOK || r.State != "done" || r.Received != 4096 || r.Total != 4096 || r.Percent != 100 || r.Status != http.StatusCreated {
+		t.Errorf("Unexpected report: %d %+v", code, r)
+	}
+
+	// Failed uploads report the error status
+	uploadPut(server, "/incoming/big.bin?upload_id=again123", body)
+	if _, r := report("again123"); r.State != "error" || r.Status != http.StatusConflict {
+		t.Errorf("Expected conflict to be reported as error, got %+v", r)
+	}
+
+	// Invalid or missing IDs are not tracked
+	uploadPut(server, "/incoming/other.bin?upload_id=x", body)
+	if code, _ := report("x"); code != http.StatusNotFound {
+		t.Errorf("Expected 404 for an untracked upload, got %d", code)
+	}
+}
+
+func TestUploadProgressEvents(t *testing.T) {
+	server, _ := newUploadTestServer(t, func(c *UploadsConfig) { c.Progress = true })
+	ts := httptest.NewServer(server.mux)
+	defer ts.Close()
+
+	// The browser opens the stream before the upload reaches the server
+	req, _ := http.NewRequest("GET", ts.URL+"/_upload_progress?id=stream123", nil)
+	req.Header.Set("Accept", "text/event-stream")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	put, _ := http.NewRequest("PUT", ts.URL+"/incoming/stream.bin", strings.NewReader("payload"))
+	put.Header.Set("X-Upload-ID", "stream123")
+	if putResp, err := http.DefaultClient.Do(put); err != nil || putResp.StatusCode != http.StatusCreated {
+		t.Fatalf("Upload failed: %v", err)
+	}
+
+	// The stream ends with a done event carrying the final report
+	var last string
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		if line := scanner.Text(); strings.HasPrefix(line, "event: ") {
+			last = line
+		} else if strings.HasPrefix(line, "data: ") && last == "event: done" {
+			var r UploadReport
+			json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &r)
+			if r.Received != 7 || r.Status != http.StatusCreated {
+				t.Errorf("Unexpected final report: %+v", r)
+			}
+		}
+	}
+	if last != "event: done" {
+		t.Errorf("Expected stream to end with done, got %q", last)
+	}
+
+	// The listing form opens the stream when progress is enabled
+	listing, err := http.Get(ts.URL + "/incoming/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, _ := io.ReadAll(listing.Body)
+	listing.Body.Close()
+	if !strings.Contains(string(page), "new EventSource") || !strings.Contains(string(page), "<progress") {
+		t.Errorf("Expected upload form with progress bar in the listing")
+	}
+}
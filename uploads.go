@@ -0,0 +1,344 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Uploads recebe arquivos nos prefixos configurados: PUT grava o corpo no
+// caminho pedido e POST multipart grava cada arquivo do formulário no
+// diretório pedido (é o que o formulário da listagem envia)
+type Uploads struct {
+	config     *UploadsConfig
+	extensions map[string]bool // nil: qualquer extensão
+	files      http.Handler    // GET e demais métodos
+	chunks     *ChunkedUploads // nil: sem envio em partes
+	blobs      *BlobStore      // nil: sem deduplicação
+}
+
+// uploadResult arquivo gravado, na resposta JSON do POST
+type uploadResult struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+}
+
+// uploadError falha de um upload com o status a responder
+type uploadError struct {
+	status int
+	msg    string
+}
+
+func (e *uploadError) Error() string {
+	return e.msg
+}
+
+// NewUploads valida a configuração de uploads
+func NewUploads(config *UploadsConfig) (*Uploads, error) {
+	if len(config.Prefixes) == 0 {
+		return nil, errors.New("uploads: at least one prefix is required")
+	}
+	for _, prefix := range config.Prefixes {
+		if !strings.HasPrefix(prefix, "/") {
+			return nil, fmt.Errorf("uploads: prefix must start with /: %q", prefix)
+		}
+	}
+	switch config.Overwrite {
+	case "", "deny", "allow", "rename":
+	default:
+		return nil, fmt.Errorf("uploads: invalid overwrite policy %q (must be deny, allow or rename)", config.Overwrite)
+	}
+	if config.MaxSize < 0 {
+		return nil, errors.New("uploads: max_size must not be negative")
+	}
+	u := &Uploads{config: config}
+	if config.Chunked {
+		chunks, err := NewChunkedUploads(config)
+		if err != nil {
+			return nil, err
+		}
+		u.chunks = chunks
+	}
+	if config.Dedup {
+		if config.BlobsDir == "" {
+			return nil, errors.New("uploads: dedup requires blobs_dir")
+		}
+		if err := os.MkdirAll(config.BlobsDir, 0755); err != nil {
+			return nil, fmt.Errorf("uploads: blobs_dir: %w", err)
+		}
+		u.blobs = &BlobStore{dir: config.BlobsDir}
+	}
+	if len(config.AllowedExtensions) > 0 {
+		u.extensions = make(map[string]bool)
+		for _, ext := range config.AllowedExtensions {
+			u.extensions["."+strings.TrimPrefix(strings.ToLower(ext), ".")] = true
+		}
+	}
+	return u, nil
+}
+
+// maxSize retorna o maior arquivo aceito, em bytes
+func (u *Uploads) maxSize() int64 {
+	if u.config.MaxSize <= 0 {
+		return 512 << 20
+	}
+	return u.config.MaxSize << 20
+}
+
+// overwrite retorna a política para arquivos existentes
+func (u *Uploads) overwrite() string {
+	if u.config.Overwrite == "" {
+		return "deny"
+	}
+	return u.config.Overwrite
+}
+
+// Accepts informa se urlPath está sob um prefixo com upload
+func (u *Uploads) Accepts(urlPath string) bool {
+	for _, prefix := range u.config.Prefixes {
+		if strings.HasPrefix(urlPath, prefix) || urlPath+"/" == prefix {
+			return true
+		}
+	}
+	return false
+}
+
+// allowed informa se a extensão do arquivo é aceita
+func (u *Uploads) allowed(name string) bool {
+	return u.extensions == nil || u.extensions[strings.ToLower(filepath.Ext(name))]
+}
+
+// handleUpload recebe PUT, POST e o envio em partes (?chunked); o restante
+// segue para o handler de arquivos
+func (s *Server) handleUpload(w http.ResponseWriter, r *http.Request) {
+	chunked := s.uploads.chunks != nil && r.URL.Query().Has("chunked")
+	switch {
+	case r.Method == http.MethodPut, r.Method == http.MethodPost, chunked:
+	default:
+		s.uploads.files.ServeHTTP(w, r)
+		return
+	}
+	// Formulários de outros sites não enviam arquivos em nome do usuário
+	if crossOrigin(r) {
+		s.serveError(w, r, http.StatusForbidden)
+		return
+	}
+	urlPath := cleanURLPath(r.URL.Path)
+	if !s.uploads.Accepts(urlPath) {
+		s.serveError(w, r, http.StatusForbidden)
+		return
+	}
+	w, finish := s.trackUpload(w, r)
+	defer finish()
+
+	if chunked {
+		s.handleChunkedUpload(w, r, urlPath)
+		return
+	}
+	if r.Method == http.MethodPut {
+		if strings.HasSuffix(r.URL.Path, "/") {
+			s.serveError(w, r, http.StatusMethodNotAllowed)
+			return
+		}
+		result, replaced, err := s.storeUpload(r, urlPath, http.MaxBytesReader(w, r.Body, s.uploads.maxSize()), true)
+		if err != nil {
+			s.uploadFailed(w, r, err)
+			return
+		}
+		w.Header().Set("Location", result.Path)
+		if replaced {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		return
+	}
+	s.uploadMultipart(w, r, urlPath)
+}
+
+// crossOrigin informa se a requisição veio de uma página de outro site
+func crossOrigin(r *http.Request) bool {
+	if site := r.Header.Get("Sec-Fetch-Site"); site != "" {
+		return site == "cross-site"
+	}
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return false
+	}
+	u, err := url.Parse(origin)
+	return err != nil || !strings.EqualFold(u.Host, r.Host)
+}
+
+// uploadMultipart grava os arquivos de um POST multipart no diretório
+// pedido; navegadores voltam à listagem, os demais recebem JSON
+func (s *Server) uploadMultipart(w http.ResponseWriter, r *http.Request, urlDir string) {
+	urlDir = strings.TrimSuffix(urlDir, "/") + "/"
+	reader, err := r.MultipartReader()
+	if err != nil {
+		http.Error(w, "expected multipart/form-data", http.StatusBadRequest)
+		return
+	}
+
+	var results []uploadResult
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			s.serveError(w, r, http.StatusBadRequest)
+			return
+		}
+		name := part.FileName()
+		if name == "" {
+			part.Close()
+			continue
+		}
+		// Só o nome: caminhos enviados pelo cliente são ignorados
+		name = filepath.Base(filepath.FromSlash(strings.ReplaceAll(name, `\`, "/")))
+		if name == "." || name == string(filepath.Separator) {
+			s.serveError(w, r, http.StatusBadRequest)
+			return
+		}
+		result, _, err := s.storeUpload(r, urlDir+name, part, false)
+		part.Close()
+		if err != nil {
+			s.uploadFailed(w, r, err)
+			return
+		}
+		results = append(results, *result)
+	}
+	if len(results) == 0 {
+		http.Error(w, "no files in the form", http.StatusBadRequest)
+		return
+	}
+
+	if strings.Contains(r.Header.Get("Accept"), "text/html") {
+		http.Redirect(w, r, escapeURLPath(urlDir), http.StatusSeeOther)
+		return
+	}
+	writeJSON(w, http.StatusCreated, map[string]interface{}{"files": results})
+}
+
+// uploadFailed responde o erro de um upload
+func (s *Server) uploadFailed(w http.ResponseWriter, r *http.Request, err error) {
+	var ue *uploadError
+	var maxErr *http.MaxBytesError
+	var quotaErr *QuotaError
+	switch {
+	case errors.As(err, &ue):
+		http.Error(w, ue.msg, ue.status)
+	case errors.As(err, &maxErr):
+		s.serveError(w, r, http.StatusRequestEntityTooLarge)
+	case errors.As(err, &quotaErr):
+		http.Error(w, err.Error(), http.StatusInsufficientStorage)
+	default:
+		s.logger.Error("Upload %s: %v", r.URL.Path, err)
+		s.serveError(w, r, http.StatusInternalServerError)
+	}
+}
+
+// storeUpload grava body em urlPath de forma atômica (arquivo temporário no
+// mesmo diretório, renomeado ao final), aplicando extensões, tamanho,
+// política de sobrescrita, versões e quotas. mkdir cria os diretórios
+// ausentes (PUT); no POST o diretório precisa existir
+func (s *Server) storeUpload(r *http.Request, urlPath string, body io.Reader, mkdir bool) (*uploadResult, bool, error) {
+	root := s.requestRoot(r)
+	name := filepath.Base(filepath.FromSlash(urlPath))
+	if !s.uploads.allowed(name) {
+		return nil, false, &uploadError{http.StatusUnsupportedMediaType, "file type not allowed: " + name}
+	}
+	path := filepath.Join(root, filepath.FromSlash(urlPath))
+	if !isWithin(root, path) || !s.visiblePath(root, strings.TrimPrefix(urlPath, "/")) ||
+		(s.listingRules != nil && s.listingRules.Blocked(root, path)) {
+		return nil, false, &uploadError{http.StatusForbidden, "403 Forbidden"}
+	}
+
+	dir := filepath.Dir(path)
+	if mkdir {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, false, err
+		}
+	} else if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return nil, false, &uploadError{http.StatusNotFound, "404 Not Found"}
+	}
+
+	tmp, err := os.CreateTemp(dir, ".qserv-write-*")
+	if err != nil {
+		return nil, false, err
+	}
+	defer os.Remove(tmp.Name())
+	size, err := io.Copy(tmp, io.LimitReader(body, s.uploads.maxSize()+1))
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if size > s.uploads.maxSize() {
+		return nil, false, &http.MaxBytesError{Limit: s.uploads.maxSize()}
+	}
+
+	replaced := int64(-1)
+	if info, err := os.Stat(path); err == nil {
+		if info.IsDir() {
+			return nil, false, &uploadError{http.StatusConflict, "is a directory: " + urlPath}
+		}
+		if s.uploads.overwrite() == "allow" {
+			replaced = info.Size()
+		}
+	}
+	if s.quotas != nil {
+		if err := s.quotas.Check(root, urlPath, size, replaced); err != nil {
+			return nil, false, err
+		}
+	}
+	s.dedupUpload(tmp.Name(), urlPath)
+
+	switch s.uploads.overwrite() {
+	case "allow":
+		if s.versions != nil && replaced >= 0 {
+			if err := s.versions.Save(root, path); err != nil {
+				return nil, false, err
+			}
+		}
+		err = os.Rename(tmp.Name(), path)
+	case "rename":
+		// Próximo nome livre: arquivo (1).ext, arquivo (2).ext...
+		ext := filepath.Ext(name)
+		base := strings.TrimSuffix(name, ext)
+		for i := 1; ; i++ {
+			if err = os.Link(tmp.Name(), path); !errors.Is(err, os.ErrExist) || i > 1000 {
+				break
+			}
+			name = fmt.Sprintf("%s (%d)%s", base, i, ext)
+			path = filepath.Join(dir, name)
+		}
+		urlPath = urlPath[:strings.LastIndex(urlPath, "/")+1] + name
+	default:
+		// Link falha se o destino já existir, sem janela entre verificar e gravar
+		if err = os.Link(tmp.Name(), path); errors.Is(err, os.ErrExist) {
+			return nil, false, &uploadError{http.StatusConflict, "file already exists: " + urlPath}
+		}
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	if s.quotas != nil {
+		if replaced >= 0 {
+			s.quotas.Record(urlPath, size-replaced, 0)
+		} else {
+			s.quotas.Record(urlPath, size, 1)
+		}
+	}
+	s.PurgeCaches(PurgeRequest{Path: urlPath})
+	s.logger.Info("Upload: stored %s (%s)", urlPath, formatSize(size))
+	return &uploadResult{Name: name, Path: escapeURLPath(urlPath), Size: size}, replaced >= 0, nil
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/fs"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newUploadTestServer(t *testing.T, configure func(*UploadsConfig)) (*Server, string) {
+	t.Helper()
+	root := t.TempDir()
+	os.MkdirAll(filepath.Join(root, "incoming"), 0755)
+	writeTestFile(t, filepath.Join(root, "readonly.txt"), "original")
+	uploads := &UploadsConfig{Enabled: true, Prefixes: []string{"/incoming/"}}
+	if configure != nil {
+		configure(uploads)
+	}
+	server := newListingTestServer(t, root, func(c *Config) {
+		c.Features.Uploads = uploads
+	})
+	return server, root
+}
+
+func uploadPut(server *Server, path, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	server.mux.ServeHTTP(w, httptest.NewRequest("PUT", path, strings.NewReader(body)))
+	return w
+}
+
+// multipartRequest builds a form POST with the given files (name -> content)
+func multipartRequest(t *testing.T, path string, files ...[2]string) *http.Request {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for _, f := range files {
+		part, err := mw.CreateFormFile("file", f[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		part.Write([]byte(f[1]))
+	}
+	mw.Close()
+	req := httptest.NewRequest("POST", path, &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	return req
+}
+
+func TestUploadPut(t *testing.T) {
+	server, root := newUploadTestServer(t, nil)
+
+	if w := uploadPut(server, "/incoming/docs/report.txt", "v1"); w.Code != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d %s", w.Code, w.Body.String())
+	}
+	if data, _ := os.ReadFile(filepath.Join(root, "incoming", "docs", "report.txt")); string(data) != "v1" {
+		t.Errorf("Expected stored file, got %q", data)
+	}
+
+	// Default policy refuses to overwrite
+	if w := uploadPut(server, "/incoming/docs/report.txt", "v2"); w.Code != http.StatusConflict {
+		t.Errorf("Expected 409 on existing file, got %d", w.Code)
+	}
+
+	// Outside the configured prefixes nothing is written
+	uploadPut(server, "/readonly.txt", "changed")
+	if data, _ := os.ReadFile(filepath.Join(root, "readonly.txt")); string(data) != "original" {
+		t.Errorf("Expected file outside the prefixes to be untouched, got %q", data)
+	}
+
+	// No temporary files left behind
+	entries, _ := os.ReadDir(filepath.Join(root, "incoming", "docs"))
+	if len(entries) != 1 {
+		t.Errorf("Expected only the uploaded file, got %d entries", len(entries))
+	}
+}
+
+func TestUploadOverwritePolicies(t *testing.T) {
+	server, root := newUploadTestServer(t, func(c *UploadsConfig) { c.Overwrite = "allow" })
+	uploadPut(server, "/incoming/a.txt", "v1")
+	if w := uploadPut(server, "/incoming/a.txt", "v2"); w.Code != http.StatusNoContent {
+		t.Errorf("Expected 204 on overwrite, got %d", w.Code)
+	}
+	if data, _ := os.ReadFile(filepath.Join(root, "incoming", "a.txt")); string(data) != "v2" {
+		t.Errorf("Expected overwritten file, got %q", data)
+	}
+
+	server, root = newUploadTestServer(t, func(c *UploadsConfig) { c.Overwrite = "rename" })
+	uploadPut(server, "/incoming/a.txt", "v1")
+	w := uploadPut(server, "/incoming/a.txt", "v2")
+	if w.Code != http.StatusCreated || w.Header().Get("Location") != "/incoming/a%20%281%29.txt" {
+		t.Errorf("Expected 201 with renamed location, got %d %q", w.Code, w.Header().Get("Location"))
+	}
+	if data, _ := os.ReadFile(filepath.Join(root, "incoming", "a (1).txt")); string(data) != "v2" {
+		t.Errorf("Expected renamed copy, got %q", data)
+	}
+	if data, _ := os.ReadFile(filepath.Join(root, "incoming", "a.txt")); string(data) != "v1" {
+		t.Errorf("Expected original to be kept, got %q", data)
+	}
+}
+
+func TestUploadLimits(t *testing.T) {
+	server, root := newUploadTestServer(t, func(c *UploadsConfig) {
+		c.MaxSize = 1
+		c.AllowedExtensions = []string{"jpg", ".PNG"}
+	})
+	if w := uploadPut(server, "/incoming/photo.JPG", "jpeg"); w.Code != http.StatusCreated {
+		t.Errorf("Expected allowed extension to be accepted, got %d", w.Code)
+	}
+	if w := uploadPut(server, "/incoming/script.sh", "#!/bin/sh"); w.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("Expected 415 for a disallowed extension, got %d", w.Code)
+	}
+	if w := uploadPut(server, "/incoming/big.png", strings.Repeat("x", 1<<20+1)); w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected 413 above max_size, got %d", w.Code)
+	}
+	if _, err := os.Stat(filepath.Join(root, "incoming", "big.png")); err == nil {
+		t.Error("Expected oversized upload to be discarded")
+	}
+}
+
+func TestUploadMultipart(t *testing.T) {
+	server, root := newUploadTestServer(t, nil)
+
+	w := httptest.NewRecorder()
+	server.mux.ServeHTTP(w, multipartRequest(t, "/incoming/", [2]string{"one.txt", "1"}, [2]string{`C:\Users\me\two.txt`, "22"}))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Files []uploadResult `json:"files"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if len(resp.Files) != 2 || resp.Files[1].Path != "/incoming/two.txt" || resp.Files[1].Size != 2 {
+		t.Errorf("Expected two stored files, got %+v", resp.Files)
+	}
+	if data, _ := os.ReadFile(filepath.Join(root, "incoming", "two.txt")); string(data) != "22" {
+		t.Errorf("Expected file name without client path, got %q", data)
+	}
+
+	// Browsers go back to the listing
+	req := multipartRequest(t, "/incoming/", [2]string{"three.txt", "3"})
+	req.Header.Set("Accept", "text/html")
+	w = httptest.NewRecorder()
+	server.mux.ServeHTTP(w, req)
+	if w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/incoming/" {
+		t.Errorf("Expected redirect to the listing, got %d %q", w.Code, w.Header().Get("Location"))
+	}
+
+	// Forms posted from other sites are refused
+	req = multipartRequest(t, "/incoming/", [2]string{"evil.txt", "x"})
+	req.Header.Set("Origin", "https://evil.example.com")
+	w = httptest.NewRecorder()
+	server.mux.ServeHTTP(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 for a cross-origin form, got %d", w.Code)
+	}
+}
+
+func TestUploadListingForm(t *testing.T) {
+	server, _ := newUploadTestServer(t, nil)
+	for _, tt := range []struct {
+		path string
+		form bool
+	}{
+		{"/incoming/", true},
+		{"/", false},
+	} {
+		w := httptest.NewRecorder()
+		server.mux.ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+		if got := strings.Contains(w.Body.String(), `enctype="multipart/form-data"`); got != tt.form {
+			t.Errorf("%s: expected upload form %t, got %t", tt.path, tt.form, got)
+		}
+	}
+}
+
+func TestNewUploadsErrors(t *testing.T) {
+	for _, config := range []*UploadsConfig{
+		{Enabled: true},
+		{Enabled: true, Prefixes: []string{"incoming/"}},
+		{Enabled: true, Prefixes: []string{"/incoming/"}, Overwrite: "always"},
+		{Enabled: true, Prefixes: []string{"/incoming/"}, MaxSize: -1},
+		{Enabled: true, Prefixes: []string{"/incoming/"}, Dedup: true},
+	} {
+		if _, err := NewUploads(config); err == nil {
+			t.Errorf("Expected error for %+v", config)
+		}
+	}
+}
+
+func TestUploadDedup(t *testing.T) {
+	blobs := t.TempDir()
+	root := t.TempDir()
+	os.MkdirAll(filepath.Join(root, "incoming"), 0755)
+	server := newListingTestServer(t, root, func(c *Config) {
+		c.Features.Uploads = &UploadsConfig{Enabled: true, Prefixes: []string{"/incoming/"}, Chunked: true, ChunkDir: t.TempDir(), Dedup: true, BlobsDir: blobs}
+		c.Features.WebDAV = &WebDAVConfig{Enabled: true, Prefix: "/dav/"}
+	})
+	bundle := strings.Repeat("bundle", 100)
+
+	// The same bundle through PUT, a chunked upload and WebDAV
+	if w := uploadPut(server, "/incoming/a.tar", bundle); w.Code != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d %s", w.Code, w.Body.String())
+	}
+	id := startChunkedUpload(t, server, "/incoming/b.tar")
+	chunkedRequest(server, "PUT", "/incoming/b.tar?chunked="+id+"&part=1", bundle[:300])
+	chunkedRequest(server, "PUT", "/incoming/b.tar?chunked="+id+"&part=2", bundle[300:])
+	if w := chunkedRequest(server, "POST", "/incoming/b.tar?chunked="+id, ""); w.Code != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d %s", w.Code, w.Body.String())
+	}
+	if w := davRequest(server, "PUT", "/dav/incoming/c.tar", bundle, nil); w.Code != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d %s", w.Code, w.Body.String())
+	}
+	uploadPut(server, "/incoming/other.tar", "different")
+
+	a, _ := os.Stat(filepath.Join(root, "incoming", "a.tar"))
+	for _, name := range []string{"b.tar", "c.tar"} {
+		info, _ := os.Stat(filepath.Join(root, "incoming", name))
+		if a == nil || info == nil || !os.SameFile(a, info) {
+			t.Errorf("Expected %s to share storage with a.tar", name)
+		}
+	}
+	if other, _ := os.Stat(filepath.Join(root, "incoming", "other.tar")); other == nil || os.SameFile(a, other) {
+		t.Error("Expected a different file to be stored separately")
+	}
+	content, _ := os.ReadFile(filepath.Join(root, "incoming", "b.tar"))
+	if string(content) != bundle {
+		t.Errorf("Expected the assembled bundle, got %d bytes", len(content))
+	}
+
+	// Blobs nothing points to anymore are pruned by the janitor
+	os.Remove(filepath.Join(root, "incoming", "other.tar"))
+	var pruned int
+	server.uploads.blobs.Prune(func(string, fs.FileInfo) { pruned++ })
+	if pruned != 1 {
+		t.Errorf("Expected 1 unused blob, got %d", pruned)
+	}
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// versionIDFormat nome de cada versão guardada (ordenável)
+const versionIDFormat = "20060102T150405.000000000"
+
+// versionIDPattern IDs aceitos na API (evita caminhos arbitrários)
+var versionIDPattern = regexp.MustCompile(`^\d{8}T\d{6}\.\d{9}$`)
+
+// FileVersion versão anterior de um arquivo
+type FileVersion struct {
+	ID      string    `json:"id"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+// Versions guarda as versões anteriores dos arquivos sobrescritos pelas
+// escritas (uploads, WebDAV), com histórico e restauração pela API
+type Versions struct {
+	config *VersioningConfig
+	logger *Logger
+	dir    string
+	mu     sync.Mutex
+}
+
+// NewVersions cria o armazenamento de versões
+func NewVersions(config *VersioningConfig, logger *Logger) *Versions {
+	dir := config.Dir
+	if dir == "" {
+		dir = ".qserv-versions"
+	}
+	if abs, err := filepath.Abs(dir); err == nil {
+		dir = abs
+	}
+	return &Versions{config: config, logger: logger, dir: dir}
+}
+
+// keep retorna quantas versões anteriores são mantidas por arquivo
+func (v *Versions) keep() int {
+	if v.config.Keep <= 0 {
+		return 5
+	}
+	return v.config.Keep
+}
+
+// historyDir retorna o diretório com as versões do arquivo (rel com "/")
+func (v *Versions) historyDir(rel string) (string, error) {
+	return safeJoin(v.dir, strings.TrimPrefix(rel, "/"))
+}
+
+// Save guarda uma cópia de path antes que ele seja sobrescrito ou removido;
+// não faz nada se o arquivo não existir
+func (v *Versions) Save(root, path string) error {
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) || (err == nil && !info.Mode().IsRegular()) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	rel, err := relPath(root, path)
+	if err != nil {
+		return err
+	}
+	dir, err := v.historyDir(rel)
+	if err != nil {
+		return err
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	target := filepath.Join(dir, time.Now().UTC().Format(versionIDFormat))
+	if err := writeFileFrom(target, src, info.Mode().Perm()); err != nil {
+		os.Remove(target)
+		return err
+	}
+	os.Chtimes(target, info.ModTime(), info.ModTime())
+
+	v.prune(dir)
+	return nil
+}
+
+// prune remove as versões além do limite, das mais antigas para as mais novas
+func (v *Versions) prune(dir string) {
+	ids := v.ids(dir)
+	for i := v.keep(); i < len(ids); i++ {
+		if err := os.Remove(filepath.Join(dir, ids[i])); err != nil {
+			v.logger.Warn("Failed to remove old version %s: %v", filepath.Join(dir, ids[i]), err)
+		}
+	}
+}
+
+// ids lista as versões guardadas em dir, das mais novas para as mais antigas
+func (v *Versions) ids(dir string) []string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	var ids []string
+	for _, entry := range entries {
+		if entry.Type().IsRegular() && versionIDPattern.MatchString(entry.Name()) {
+			ids = append(ids, entry.Name())
+		}
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(ids)))
+	return ids
+}
+
+// List retorna o histórico do arquivo, das versões mais novas para as mais antigas
+func (v *Versions) List(rel string) ([]FileVersion, error) {
+	dir, err := v.historyDir(rel)
+	if err != nil {
+		return nil, err
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	versions := []FileVersion{}
+	for _, id := range v.ids(dir) {
+		info, err := os.Stat(filepath.Join(dir, id))
+		if err != nil {
+			continue
+		}
+		versions = append(versions, FileVersion{ID: id, Size: info.Size(), ModTime: info.ModTime()})
+	}
+	return versions, nil
+}
+
+// Restore volta o arquivo para a versão id; o conteúdo atual vira uma nova
+// versão, então a restauração também pode ser desfeita
+func (v *Versions) Restore(root, rel, id string) error {
+	if !versionIDPattern.MatchString(id) {
+		return fmt.Errorf("invalid version id %q", id)
+	}
+	dir, err := v.historyDir(rel)
+	if err != nil {
+		return err
+	}
+	path, err := safeJoin(root, strings.TrimPrefix(rel, "/"))
+	if err != nil {
+		return err
+	}
+	if _, err := relPath(root, path); err != nil {
+		return err
+	}
+	source := filepath.Join(dir, id)
+	info, err := os.Stat(source)
+	if err != nil {
+		return fmt.Errorf("version %s of %s not found", id, rel)
+	}
+
+	// Prepara a cópia ao lado antes de guardar o conteúdo atual (que pode
+	// descartar a versão pedida) e renomeia: leitores nunca veem o arquivo pela metade
+	v.mu.Lock()
+	src, err := os.Open(source)
+	if err != nil {
+		v.mu.Unlock()
+		return err
+	}
+	tmp := filepath.Join(filepath.Dir(path), ".restore-"+filepath.Base(path))
+	err = writeFileFrom(tmp, src, info.Mode().Perm())
+	src.Close()
+	v.mu.Unlock()
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	os.Chtimes(tmp, info.ModTime(), info.ModTime())
+
+	if err := v.Save(root, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	v.logger.Info("Restored %s to version %s", rel, id)
+	return nil
+}
+
+// handleAdminVersions lista as versões de um arquivo (?path=/a/b.txt)
+func (s *Server) handleAdminVersions(w http.ResponseWriter, r *http.Request) {
+	path := r.URL.Query().Get("path")
+	if path == "" {
+		writeJSONError(w, http.StatusBadRequest, fmt.Errorf("path is required"))
+		return
+	}
+	versions, err := s.versions.List(path)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"path": path, "versions": versions})
+}
+
+// handleAdminRestoreVersion restaura uma versão ({"path": "...", "version": "..."})
+func (s *Server) handleAdminRestoreVersion(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Path    string `json:"path"`
+		Version string `json:"version"`
+	}
+	if err := decodeJSON(r, &req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+	if req.Path == "" || req.Version == "" {
+		writeJSONError(w, http.StatusBadRequest, fmt.Errorf("path and version are required"))
+		return
+	}
+	if err := s.versions.Restore(s.RootDir(), req.Path, req.Version); err != nil {
+		writeJSONError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"path": req.Path, "restored": req.Version})
+}
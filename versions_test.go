@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestVersionsHistoryAndRestore(t *testing.T) {
+	root := t.TempDir()
+	config := DefaultConfig()
+	config.Server.RootDir = root
+	config.Admin = &AdminConfig{Enabled: true, Token: "s3cret"}
+	config.Features.Versioning = &VersioningConfig{Enabled: true, Keep: 2, Dir: t.TempDir()}
+	logger, _ := NewLogger(&LoggingConfig{Enabled: false})
+	server := NewServer(config, logger)
+	server.setupHandlers()
+
+	path := filepath.Join(root, "builds", "app.tar.gz")
+	for _, content := range []string{"good", "bad-1", "bad-2", "bad-3"} {
+		if err := server.versions.Save(root, path); err != nil {
+			t.Fatalf("Save failed: %v", err)
+		}
+		writeTestFile(t, path, content)
+	}
+
+	var history struct {
+		Versions []FileVersion `json:"versions"`
+	}
+	w := adminRequest(server, "GET", "/_admin/versions?path=/builds/app.tar.gz", "")
+	if err := json.Unmarshal(w.Body.Bytes(), &history); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("Expected version history, got %d: %s", w.Code, w.Body.String())
+	}
+	// "good" was pruned: only the last 2 previous versions are kept
+	if len(history.Versions) != 2 || history.Versions[0].Size != int64(len("bad-2")) {
+		t.Fatalf("Expected 2 versions, newest first, got %+v", history.Versions)
+	}
+
+	body := fmt.Sprintf(`{"path": "/builds/app.tar.gz", "version": %q}`, history.Versions[1].ID)
+	if w := adminRequest(server, "POST", "/_admin/versions/restore", body); w.Code != http.StatusOK {
+		t.Fatalf("Expected restore to succeed, got %d: %s", w.Code, w.Body.String())
+	}
+	if content, _ := os.ReadFile(path); string(content) != "bad-1" {
+		t.Errorf("Expected restored content bad-1, got %q", content)
+	}
+
+	// The overwritten content became a version itself
+	versions, _ := server.versions.List("/builds/app.tar.gz")
+	if len(versions) != 2 || versions[0].Size != int64(len("bad-3")) {
+		t.Errorf("Expected current content to be saved before restoring, got %+v", versions)
+	}
+
+	for _, body := range []string{
+		`{"path": "/builds/app.tar.gz", "version": "../../etc/passwd"}`,
+		`{"path": "/../outside", "version": "20260101T000000.000000000"}`,
+	} {
+		if w := adminRequest(server, "POST", "/_admin/versions/restore", body); w.Code != http.StatusUnprocessableEntity {
+			t.Errorf("Expected 422 for %s, got %d", body, w.Code)
+		}
+	}
+}
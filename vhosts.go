@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// vhost host virtual atendido por uma instância própria do Server
+type vhost struct {
+	hosts  []string
+	config *VHostConfig
+	server *Server
+}
+
+// vhostConfig monta a configuração de um host virtual: cópia das seções
+// server, security, performance, logging e features da global, com root_dir
+// e os campos informados sobrepostos. Serviços da instância (admin, FTP,
+// cluster, registries, pull-through...) ficam só no host padrão
+func vhostConfig(global *Config, v *VHostConfig) (*Config, error) {
+	data, err := json.Marshal(&Config{
+		Server:      global.Server,
+		Security:    global.Security,
+		Performance: global.Performance,
+		Logging:     global.Logging,
+		Features:    global.Features,
+	})
+	if err != nil {
+		return nil, err
+	}
+	// Cópia profunda: a sobreposição não pode alterar as seções globais
+	config := &Config{}
+	if err := json.Unmarshal(data, config); err != nil {
+		return nil, err
+	}
+
+	overlays := []struct {
+		name string
+		raw  json.RawMessage
+		dst  interface{}
+	}{
+		{"security", v.Security, &config.Security},
+		{"performance", v.Performance, &config.Performance},
+		{"features", v.Features, &config.Features},
+	}
+	for _, o := range overlays {
+		if len(o.raw) == 0 {
+			continue
+		}
+		if err := json.Unmarshal(o.raw, o.dst); err != nil {
+			return nil, fmt.Errorf("%s: %w", o.name, err)
+		}
+	}
+	config.Server.RootDir = v.RootDir
+
+	// O listener é compartilhado: HTTPS e certificado são os globais
+	config.Security.EnableHTTPS = global.Security.EnableHTTPS
+	config.Security.CertFile = global.Security.CertFile
+	config.Security.KeyFile = global.Security.KeyFile
+	config.Security.CertMonitor = global.Security.CertMonitor
+	config.Security.OCSPStapling = nil // staple, ECH e tickets são do listener principal
+	config.Security.ECH = nil
+	config.Security.SessionTickets = nil
+	return config, nil
+}
+
+// validateVHosts valida cada host virtual com as mesmas regras da global
+func validateVHosts(config *Config) error {
+	for i := range config.VHosts {
+		v := &config.VHosts[i]
+		if len(v.Hosts) == 0 {
+			return fmt.Errorf("vhosts[%d]: hosts is required", i)
+		}
+		if v.RootDir == "" {
+			return fmt.Errorf("vhosts[%d] (%s): root_dir is required", i, v.Hosts[0])
+		}
+		vc, err := vhostConfig(config, v)
+		if err != nil {
+			return fmt.Errorf("vhosts[%d] (%s): %w", i, v.Hosts[0], err)
+		}
+		if err := validateConfig(vc); err != nil {
+			return fmt.Errorf("vhosts[%d] (%s): %w", i, v.Hosts[0], err)
+		}
+	}
+	return nil
+}
+
+// setupVHosts cria os hosts virtuais da configuração
+func (s *Server) setupVHosts() {
+	for i := range s.config.VHosts {
+		v := &s.config.VHosts[i]
+		config, err := vhostConfig(s.config, v)
+		if err != nil {
+			s.logger.Error("Virtual host %s disabled: %v", strings.Join(v.Hosts, ", "), err)
+			continue
+		}
+		s.vhosts = append(s.vhosts, &vhost{hosts: v.Hosts, config: v, server: NewServer(config, s.logger)})
+		s.logger.Info("Virtual host %s: %s", strings.Join(v.Hosts, ", "), v.RootDir)
+	}
+}
+
+// reloadVHosts reaplica aos hosts virtuais as seções recarregáveis da
+// configuração global recarregada, com a sobreposição de cada um
+func (s *Server) reloadVHosts(global *Config) {
+	for _, v := range s.vhosts {
+		config, err := vhostConfig(global, v.config)
+		if err != nil {
+			s.logger.Error("Virtual host %s keeps its configuration: %v", strings.Join(v.hosts, ", "), err)
+			continue
+		}
+		v.server.applyConfig(reloadableConfig(v.server.activeConfig(), config))
+	}
+}
+
+// matchVHost retorna o primeiro host virtual que casa com o header Host
+func (s *Server) matchVHost(host string) *vhost {
+	for _, v := range s.vhosts {
+		for _, pattern := range v.hosts {
+			if matchHost(pattern, host) {
+				return v
+			}
+		}
+	}
+	return nil
+}
+
+// vhostHandler encaminha as requisições dos hosts virtuais para a instância
+// de cada um; os demais hosts seguem com a configuração global
+func (s *Server) vhostHandler(fallback http.Handler) http.Handler {
+	for _, v := range s.vhosts {
+		v.server.setupHandlers()
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if v := s.matchVHost(r.Host); v != nil {
+			v.server.ServeHTTP(w, r)
+			return
+		}
+		fallback.ServeHTTP(w, r)
+	})
+}
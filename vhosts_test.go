@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newVHostTestServer(t *testing.T) (*Server, string, string) {
+	t.Helper()
+	main, static := t.TempDir(), t.TempDir()
+	writeTestFile(t, filepath.Join(main, "page.txt"), "main site")
+	writeTestFile(t, filepath.Join(static, "page.txt"), "static site")
+	writeTestFile(t, filepath.Join(static, ".env"), "secret")
+
+	server := newListingTestServer(t, main, func(c *Config) {
+		c.Security.BlockHiddenFiles = true
+		c.VHosts = []VHostConfig{{
+			Hosts:    []string{"static.example.com", "*.cdn.example.com"},
+			RootDir:  static,
+			Security: json.RawMessage(`{"basic_auth": {"enabled": true, "username": "ops", "password": "s3cret"}}`),
+			Features: json.RawMessage(`{"directory_listing": false}`),
+		}}
+	})
+	return server, main, static
+}
+
+func vhostGet(server *Server, host, path string, auth bool) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", path, nil)
+	req.Host = host
+	if auth {
+		req.SetBasicAuth("ops", "s3cret")
+	}
+	w := httptest.NewRecorder()
+	server.mux.ServeHTTP(w, req)
+	return w
+}
+
+func TestVHostRootByHost(t *testing.T) {
+	server, _, _ := newVHostTestServer(t)
+
+	tests := []struct {
+		host string
+		body string
+	}{
+		{"static.example.com", "static site"},
+		{"STATIC.example.com:8080", "static site"},
+		{"img.cdn.example.com", "static site"},
+		{"example.com", "main site"},
+		{"localhost:8080", "main site"},
+	}
+	for _, tt := range tests {
+		w := vhostGet(server, tt.host, "/page.txt", true)
+		if w.Code != http.StatusOK || w.Body.String() != tt.body {
+			t.Errorf("%s: expected 200 %q, got %d %q", tt.host, tt.body, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestVHostOverrides(t *testing.T) {
+	server, _, _ := newVHostTestServer(t)
+
+	// Basic auth applies only to the virtual host
+	if w := vhostGet(server, "static.example.com", "/page.txt", false); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 on the virtual host without credentials, got %d", w.Code)
+	}
+	if w := vhostGet(server, "example.com", "/page.txt", false); w.Code != http.StatusOK {
+		t.Errorf("Expected the default host to stay public, got %d", w.Code)
+	}
+
+	// Overridden feature
+	if w := vhostGet(server, "static.example.com", "/", true); strings.Contains(w.Body.String(), "page.txt") {
+		t.Error("Expected directory listing to be disabled on the virtual host")
+	}
+	if w := vhostGet(server, "example.com", "/", false); !strings.Contains(w.Body.String(), "page.txt") {
+		t.Error("Expected directory listing on the default host")
+	}
+
+	// Settings that were not overridden are inherited
+	if w := vhostGet(server, "static.example.com", "/.env", true); w.Code == http.StatusOK {
+		t.Errorf("Expected block_hidden_files to be inherited, got %d", w.Code)
+	}
+}
+
+func TestVHostConfigKeepsGlobal(t *testing.T) {
+	global := DefaultConfig()
+	global.Security.BasicAuth = &BasicAuthConfig{Enabled: true, Username: "admin", Password: "global"}
+	global.Admin = &AdminConfig{Enabled: true}
+
+	vc, err := vhostConfig(global, &VHostConfig{
+		Hosts:    []string{"docs.example.com"},
+		RootDir:  "/srv/docs",
+		Security: json.RawMessage(`{"basic_auth": {"password": "docs"}, "enable_https": true}`),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vc.Security.BasicAuth.Password != "docs" || vc.Security.BasicAuth.Username != "admin" {
+		t.Errorf("Expected only the password to be overridden, got %+v", vc.Security.BasicAuth)
+	}
+	if global.Security.BasicAuth.Password != "global" {
+		t.Error("Expected the global configuration to be left untouched")
+	}
+	if vc.Server.RootDir != "/srv/docs" || vc.Admin != nil {
+		t.Errorf("Expected own root and no instance-wide services, got %q %+v", vc.Server.RootDir, vc.Admin)
+	}
+	if vc.Security.EnableHTTPS {
+		t.Error("Expected HTTPS to follow the shared listener")
+	}
+}
+
+func TestValidateVHosts(t *testing.T) {
+	root := t.TempDir()
+	for _, v := range []VHostConfig{
+		{RootDir: root},
+		{Hosts: []string{"a.example.com"}},
+		{Hosts: []string{"a.example.com"}, RootDir: filepath.Join(root, "missing")},
+		{Hosts: []string{"a.example.com"}, RootDir: root, Security: json.RawMessage(`{"basic_auth": 1}`)},
+	} {
+		config := DefaultConfig()
+		config.Server.RootDir = root
+		config.VHosts = []VHostConfig{v}
+		if err := validateConfig(config); err == nil {
+			t.Errorf("Expected error for %+v", v)
+		}
+	}
+}
@@ -0,0 +1,950 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// davMaxLockTimeout maior duração de um lock (clientes renovam antes)
+const davMaxLockTimeout = time.Hour
+
+// WebDAV expõe a raiz por WebDAV (classes 1 e 2) para montar o diretório
+// no Finder, Explorer ou davfs2. Fica atrás dos mesmos middlewares dos
+// arquivos (basic auth, filtro de IP, rate limit) e respeita as mesmas
+// regras de visibilidade; as escritas guardam versões e respeitam quotas
+type WebDAV struct {
+	config *WebDAVConfig
+	files  http.Handler // GET e HEAD, com o prefixo removido
+
+	mu    sync.Mutex
+	locks map[string]*davLock // token -> lock
+}
+
+// davLock lock de escrita (os clientes o usam para evitar edições simultâneas)
+type davLock struct {
+	token    string
+	path     string // caminho relativo à raiz (com / inicial)
+	owner    string // XML do owner, devolvido como veio
+	shared   bool
+	infinite bool // depth infinity: vale para tudo abaixo de path
+	timeout  time.Duration
+	expires  time.Time
+}
+
+// NewWebDAV valida a configuração do WebDAV
+func NewWebDAV(config *WebDAVConfig) (*WebDAV, error) {
+	if !strings.HasPrefix(config.prefix(), "/") {
+		return nil, fmt.Errorf("webdav: prefix must start with /: %q", config.Prefix)
+	}
+	if config.MaxUploadSize < 0 {
+		return nil, errors.New("webdav: max_upload_size must not be negative")
+	}
+	return &WebDAV{config: config, locks: make(map[string]*davLock)}, nil
+}
+
+// prefix retorna o prefixo de URL do WebDAV (sempre terminado em /)
+func (c *WebDAVConfig) prefix() string {
+	if c.Prefix == "" {
+		return "/"
+	}
+	return strings.TrimSuffix(c.Prefix, "/") + "/"
+}
+
+// maxUploadSize retorna o maior arquivo aceito por PUT
+func (d *WebDAV) maxUploadSize() int64 {
+	if d.config.MaxUploadSize <= 0 {
+		return 512 << 20
+	}
+	return d.config.MaxUploadSize << 20
+}
+
+// rel converte o caminho da URL em caminho relativo à raiz; false fora do prefixo
+func (d *WebDAV) rel(urlPath string) (string, bool) {
+	urlPath = cleanURLPath(urlPath)
+	base := strings.TrimSuffix(d.config.prefix(), "/")
+	if urlPath != base && !strings.HasPrefix(urlPath, base+"/") {
+		return "", false
+	}
+	rel := strings.TrimPrefix(urlPath, base)
+	if rel == "" {
+		rel = "/"
+	}
+	return rel, true
+}
+
+// href URL de um caminho relativo à raiz
+func (d *WebDAV) href(rel string, dir bool) string {
+	p := strings.TrimSuffix(d.config.prefix(), "/") + rel
+	if dir && !strings.HasSuffix(p, "/") {
+		p += "/"
+	}
+	return escapeURLPath(p)
+}
+
+// handleWebDAV despacha os métodos do WebDAV
+func (s *Server) handleWebDAV(w http.ResponseWriter, r *http.Request) {
+	d := s.webdav
+	// Com prefixo a URL não é o caminho do arquivo: ACL, janelas de horário e
+	// cookies assinados valem para o arquivo, como em serveFile
+	if rel, ok := d.rel(r.URL.Path); ok && r.Method != http.MethodOptions {
+		if status := checkResource(r, rel); status != 0 {
+			resourceDenied(w, status)
+			return
+		}
+	}
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		d.files.ServeHTTP(w, r)
+		return
+	case http.MethodOptions:
+		s.davOptions(w)
+		return
+	case "PROPFIND":
+		s.davPropfind(w, r)
+		return
+	case "PROPPATCH", http.MethodPut, http.MethodDelete, "MKCOL", "COPY", "MOVE", "LOCK", "UNLOCK":
+	default:
+		d.files.ServeHTTP(w, r)
+		return
+	}
+	if d.config.ReadOnly {
+		w.Header().Set("Allow", davAllow(true))
+		s.serveError(w, r, http.StatusMethodNotAllowed)
+		return
+	}
+
+	rel, path, ok := s.davResolve(r, r.URL.Path)
+	if !ok {
+		s.serveError(w, r, http.StatusForbidden)
+		return
+	}
+	if r.Method != "LOCK" && r.Method != "UNLOCK" && r.Method != "COPY" && d.locked(rel, r) {
+		w.WriteHeader(http.StatusLocked)
+		return
+	}
+	switch r.Method {
+	case "PROPPATCH":
+		s.davProppatch(w, r, rel, path)
+	case http.MethodPut:
+		s.davPut(w, r, rel, path)
+	case http.MethodDelete:
+		s.davDelete(w, r, rel, path)
+	case "MKCOL":
+		s.davMkcol(w, r, path)
+	case "COPY", "MOVE":
+		s.davCopyMove(w, r, rel, path)
+	case "LOCK":
+		s.davLock(w, r, rel, path)
+	case "UNLOCK":
+		s.davUnlock(w, r, rel)
+	}
+}
+
+// davAllow métodos aceitos
+func davAllow(readOnly bool) string {
+	if readOnly {
+		return "OPTIONS, GET, HEAD, PROPFIND"
+	}
+	return "OPTIONS, GET, HEAD, PROPFIND, PROPPATCH, PUT, DELETE, MKCOL, COPY, MOVE, LOCK, UNLOCK"
+}
+
+// davOptions anuncia o suporte a WebDAV (classe 2 só com escrita, já que
+// locks não fazem sentido sem ela)
+func (s *Server) davOptions(w http.ResponseWriter) {
+	dav := "1, 2"
+	if s.webdav.config.ReadOnly {
+		dav = "1"
+	}
+	w.Header().Set("DAV", dav)
+	w.Header().Set("Allow", davAllow(s.webdav.config.ReadOnly))
+	w.Header().Set("MS-Author-Via", "DAV")
+	w.WriteHeader(http.StatusOK)
+}
+
+// davResolve converte a URL no caminho no disco, aplicando as regras de
+// visibilidade dos arquivos (ocultos, listing_rules, lápides)
+func (s *Server) davResolve(r *http.Request, urlPath string) (string, string, bool) {
+	rel, ok := s.webdav.rel(urlPath)
+	if !ok {
+		return "", "", false
+	}
+	root := s.requestRoot(r)
+	path := filepath.Join(root, filepath.FromSlash(rel))
+	if !isWithin(root, path) {
+		return "", "", false
+	}
+	if rel != "/" {
+		if !s.visiblePath(root, strings.TrimPrefix(rel, "/")) ||
+			(s.listingRules != nil && s.listingRules.Blocked(root, path)) {
+			return "", "", false
+		}
+	}
+	return rel, path, true
+}
+
+// davPropfindRequest corpo do PROPFIND (vazio equivale a allprop)
+type davPropfindRequest struct {
+	XMLName  xml.Name  `xml:"DAV: propfind"`
+	AllProp  *struct{} `xml:"DAV: allprop"`
+	PropName *struct{} `xml:"DAV: propname"`
+	Prop     *struct {
+		Names []davName `xml:",any"`
+	} `xml:"DAV: prop"`
+}
+
+// davName nome de uma propriedade pedida
+type davName struct {
+	XMLName xml.Name
+}
+
+// davLiveProps propriedades calculadas a partir do arquivo
+var davLiveProps = []string{"displayname", "resourcetype", "getcontentlength", "getcontenttype",
+	"getlastmodified", "creationdate", "getetag", "supportedlock", "lockdiscovery"}
+
+// davPropfind responde as propriedades do recurso e, com Depth: 1, dos
+// filhos visíveis. Depth infinity é recusado (RFC 4918, 9.1)
+func (s *Server) davPropfind(w http.ResponseWriter, r *http.Request) {
+	rel, path, ok := s.davResolve(r, r.URL.Path)
+	if !ok {
+		s.serveError(w, r, http.StatusNotFound)
+		return
+	}
+	depth := r.Header.Get("Depth")
+	if depth == "" || strings.EqualFold(depth, "infinity") {
+		w.WriteHeader(http.StatusForbidden)
+		io.WriteString(w, `<?xml version="1.0" encoding="utf-8"?>`+"\n"+`<D:error xmlns:D="DAV:"><D:propfind-finite-depth/></D:error>`)
+		return
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		s.serveError(w, r, http.StatusNotFound)
+		return
+	}
+
+	var req davPropfindRequest
+	if body, _ := io.ReadAll(io.LimitReader(r.Body, 1<<20)); len(strings.TrimSpace(string(body))) > 0 {
+		if err := xml.Unmarshal(body, &req); err != nil {
+			s.serveError(w, r, http.StatusBadRequest)
+			return
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="utf-8"?>` + "\n" + `<D:multistatus xmlns:D="DAV:">` + "\n")
+	s.davResponse(&b, &req, rel, info)
+	if depth == "1" && info.IsDir() {
+		root := s.requestRoot(r)
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			s.logger.Error("WebDAV: reading %s: %v", path, err)
+			s.serveError(w, r, http.StatusInternalServerError)
+			return
+		}
+		for _, entry := range entries {
+			child := filepath.Join(path, entry.Name())
+			childRel := strings.TrimSuffix(rel, "/") + "/" + entry.Name()
+			if !s.listable(root, path, entry.Name()) || (s.listingRules != nil && s.listingRules.Blocked(root, child)) ||
+				checkResource(r, childRel) != 0 {
+				continue
+			}
+			childInfo, err := entry.Info()
+			if err != nil {
+				continue
+			}
+			s.davResponse(&b, &req, childRel, childInfo)
+		}
+	}
+	b.WriteString("</D:multistatus>\n")
+
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(http.StatusMultiStatus)
+	io.WriteString(w, b.String())
+}
+
+// davResponse escreve o <response> de um recurso
+func (s *Server) davResponse(b *strings.Builder, req *davPropfindRequest, rel string, info os.FileInfo) {
+	fmt.Fprintf(b, "<D:response><D:href>%s</D:href>", davEscape(s.webdav.href(rel, info.IsDir())))
+	if req.PropName != nil {
+		b.WriteString("<D:propstat><D:prop>")
+		for _, name := range davLiveProps {
+			fmt.Fprintf(b, "<D:%s/>", name)
+		}
+		b.WriteString("</D:prop><D:status>HTTP/1.1 200 OK</D:status></D:propstat></D:response>\n")
+		return
+	}
+
+	names := davLiveProps
+	var missing []davName
+	if req.Prop != nil {
+		names = nil
+		for _, n := range req.Prop.Names {
+			if n.XMLName.Space == "DAV:" && s.davProp(rel, info, n.XMLName.Local) != "" {
+				names = append(names, n.XMLName.Local)
+			} else {
+				missing = append(missing, n)
+			}
+		}
+	}
+	if len(names) > 0 {
+		b.WriteString("<D:propstat><D:prop>")
+		for _, name := range names {
+			b.WriteString(s.davProp(rel, info, name))
+		}
+		b.WriteString("</D:prop><D:status>HTTP/1.1 200 OK</D:status></D:propstat>")
+	}
+	if len(missing) > 0 {
+		b.WriteString("<D:propstat><D:prop>")
+		for _, n := range missing {
+			fmt.Fprintf(b, `<x:%s xmlns:x="%s"/>`, n.XMLName.Local, davEscape(n.XMLName.Space))
+		}
+		b.WriteString("</D:prop><D:status>HTTP/1.1 404 Not Found</D:status></D:propstat>")
+	}
+	b.WriteString("</D:response>\n")
+}
+
+// davProp XML de uma propriedade; vazio se ela não existir para o recurso
+func (s *Server) davProp(rel string, info os.FileInfo, name string) string {
+	switch name {
+	case "displayname":
+		return "<D:displayname>" + davEscape(info.Name()) + "</D:displayname>"
+	case "resourcetype":
+		if info.IsDir() {
+			return "<D:resourcetype><D:collection/></D:resourcetype>"
+		}
+		return "<D:resourcetype/>"
+	case "getcontentlength":
+		if info.IsDir() {
+			return ""
+		}
+		return "<D:getcontentlength>" + strconv.FormatInt(info.Size(), 10) + "</D:getcontentlength>"
+	case "getcontenttype":
+		if info.IsDir() {
+			return ""
+		}
+		ctype := mime.TypeByExtension(filepath.Ext(info.Name()))
+		if ctype == "" {
+			ctype = "application/octet-stream"
+		}
+		return "<D:getcontenttype>" + davEscape(ctype) + "</D:getcontenttype>"
+	case "getlastmodified":
+		return "<D:getlastmodified>" + info.ModTime().UTC().Format(http.TimeFormat) + "</D:getlastmodified>"
+	case "creationdate":
+		return "<D:creationdate>" + info.ModTime().UTC().Format(time.RFC3339) + "</D:creationdate>"
+	case "getetag":
+		if info.IsDir() {
+			return ""
+		}
+		return "<D:getetag>" + davEscape(mtimeETag(info)) + "</D:getetag>"
+	case "supportedlock":
+		if s.webdav.config.ReadOnly {
+			return "<D:supportedlock/>"
+		}
+		return "<D:supportedlock>" +
+			"<D:lockentry><D:lockscope><D:exclusive/></D:lockscope><D:locktype><D:write/></D:locktype></D:lockentry>" +
+			"<D:lockentry><D:lockscope><D:shared/></D:lockscope><D:locktype><D:write/></D:locktype></D:lockentry>" +
+			"</D:supportedlock>"
+	case "lockdiscovery":
+		var b strings.Builder
+		b.WriteString("<D:lockdiscovery>")
+		for _, lock := range s.webdav.activeLocks(rel) {
+			b.WriteString(s.webdav.activeLockXML(lock))
+		}
+		b.WriteString("</D:lockdiscovery>")
+		return b.String()
+	}
+	return ""
+}
+
+// davEscape escapa texto para XML
+func davEscape(text string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(text))
+	return b.String()
+}
+
+// davProppatch aceita as alterações de propriedades sem guardá-las: o
+// Explorer e o Finder gravam datas e atributos próprios e tratam a recusa
+// como falha da cópia
+func (s *Server) davProppatch(w http.ResponseWriter, r *http.Request, rel, path string) {
+	info, err := os.Stat(path)
+	if err != nil {
+		s.serveError(w, r, http.StatusNotFound)
+		return
+	}
+	var req struct {
+		Set []struct {
+			Prop struct {
+				Names []davName `xml:",any"`
+			} `xml:"DAV: prop"`
+		} `xml:"DAV: set"`
+		Remove []struct {
+			Prop struct {
+				Names []davName `xml:",any"`
+			} `xml:"DAV: prop"`
+		} `xml:"DAV: remove"`
+	}
+	if err := xml.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&req); err != nil {
+		s.serveError(w, r, http.StatusBadRequest)
+		return
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<?xml version="1.0" encoding="utf-8"?>`+"\n"+`<D:multistatus xmlns:D="DAV:"><D:response><D:href>%s</D:href><D:propstat><D:prop>`,
+		davEscape(s.webdav.href(rel, info.IsDir())))
+	for _, group := range append(req.Set, req.Remove...) {
+		for _, n := range group.Prop.Names {
+			fmt.Fprintf(&b, `<x:%s xmlns:x="%s"/>`, n.XMLName.Local, davEscape(n.XMLName.Space))
+		}
+	}
+	b.WriteString("</D:prop><D:status>HTTP/1.1 200 OK</D:status></D:propstat></D:response></D:multistatus>\n")
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(http.StatusMultiStatus)
+	io.WriteString(w, b.String())
+}
+
+// davPut grava o arquivo de forma atômica (temporário no mesmo diretório,
+// renomeado ao final); o diretório pai precisa existir
+func (s *Server) davPut(w http.ResponseWriter, r *http.Request, rel, path string) {
+	if rel == "/" || strings.HasSuffix(r.URL.Path, "/") {
+		s.serveError(w, r, http.StatusMethodNotAllowed)
+		return
+	}
+	root := s.requestRoot(r)
+	dir := filepath.Dir(path)
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		s.serveError(w, r, http.StatusConflict)
+		return
+	}
+	replaced := int64(-1)
+	if info, err := os.Stat(path); err == nil {
+		if info.IsDir() {
+			s.serveError(w, r, http.StatusMethodNotAllowed)
+			return
+		}
+		replaced = info.Size()
+	}
+
+	tmp, err := os.CreateTemp(dir, ".qserv-write-*")
+	if err != nil {
+		s.logger.Error("WebDAV: %v", err)
+		s.serveError(w, r, http.StatusInternalServerError)
+		return
+	}
+	defer os.Remove(tmp.Name())
+	limit := s.webdav.maxUploadSize()
+	if s.quotas != nil {
+		if remaining := s.quotas.Remaining(root, rel, replaced); remaining >= 0 && remaining < limit {
+			limit = remaining
+		}
+	}
+	size, err := io.Copy(tmp, http.MaxBytesReader(w, r.Body, limit))
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		if s.quotas != nil {
+			if qerr := s.quotas.Check(root, rel, tooLarge.Limit+1, replaced); qerr != nil {
+				http.Error(w, qerr.Error(), http.StatusInsufficientStorage)
+				return
+			}
+		}
+		s.serveError(w, r, http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		s.serveError(w, r, http.StatusBadRequest)
+		return
+	}
+
+	if s.quotas != nil {
+		if err := s.quotas.Check(root, rel, size, replaced); err != nil {
+			http.Error(w, err.Error(), http.StatusInsufficientStorage)
+			return
+		}
+	}
+	if s.versions != nil && replaced >= 0 {
+		if err := s.versions.Save(root, path); err != nil {
+			s.logger.Error("WebDAV: saving previous version of %s: %v", path, err)
+			s.serveError(w, r, http.StatusInternalServerError)
+			return
+		}
+	}
+	s.dedupUpload(tmp.Name(), rel)
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		s.logger.Error("WebDAV: %v", err)
+		s.serveError(w, r, http.StatusInternalServerError)
+		return
+	}
+
+	if s.quotas != nil {
+		if replaced >= 0 {
+			s.quotas.Record(rel, size-replaced, 0)
+		} else {
+			s.quotas.Record(rel, size, 1)
+		}
+	}
+	s.PurgeCaches(PurgeRequest{Path: rel})
+	s.logger.Info("WebDAV: wrote %s (%s)", rel, formatSize(size))
+	if info, err := os.Stat(path); err == nil {
+		w.Header().Set("ETag", mtimeETag(info))
+	}
+	if replaced >= 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+// davTreeSize soma bytes e arquivos sob path (usado nas quotas)
+func davTreeSize(path string) (int64, int) {
+	var size int64
+	var files int
+	filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+		if err == nil && d.Type().IsRegular() {
+			if info, err := d.Info(); err == nil {
+				size += info.Size()
+				files++
+			}
+		}
+		return nil
+	})
+	return size, files
+}
+
+// davRemove remove arquivo ou diretório, atualizando quotas e caches
+func (s *Server) davRemove(root, rel, path string, info os.FileInfo) error {
+	size, files := davTreeSize(path)
+	if s.versions != nil && !info.IsDir() {
+		if err := s.versions.Save(root, path); err != nil {
+			return err
+		}
+	}
+	if err := os.RemoveAll(path); err != nil {
+		return err
+	}
+	if s.quotas != nil {
+		s.quotas.Record(rel, -size, -files)
+	}
+	if info.IsDir() {
+		s.PurgeCaches(PurgeRequest{Prefix: strings.TrimSuffix(rel, "/") + "/"})
+	} else {
+		s.PurgeCaches(PurgeRequest{Path: rel})
+	}
+	return nil
+}
+
+// davDelete remove o recurso (diretórios com todo o conteúdo)
+func (s *Server) davDelete(w http.ResponseWriter, r *http.Request, rel, path string) {
+	if rel == "/" {
+		s.serveError(w, r, http.StatusForbidden)
+		return
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		s.serveError(w, r, http.StatusNotFound)
+		return
+	}
+	if err := s.davRemove(s.requestRoot(r), rel, path, info); err != nil {
+		s.logger.Error("WebDAV: deleting %s: %v", rel, err)
+		s.serveError(w, r, http.StatusInternalServerError)
+		return
+	}
+	s.webdav.dropLocks(rel)
+	s.logger.Info("WebDAV: deleted %s", rel)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// davMkcol cria um diretório; o pai precisa existir
+func (s *Server) davMkcol(w http.ResponseWriter, r *http.Request, path string) {
+	if r.ContentLength > 0 {
+		s.serveError(w, r, http.StatusUnsupportedMediaType)
+		return
+	}
+	if _, err := os.Stat(path); err == nil {
+		s.serveError(w, r, http.StatusMethodNotAllowed)
+		return
+	}
+	if err := os.Mkdir(path, 0755); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			s.serveError(w, r, http.StatusConflict)
+			return
+		}
+		s.logger.Error("WebDAV: %v", err)
+		s.serveError(w, r, http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+// davCopyMove copia ou move o recurso para o Destination (no mesmo
+// servidor e sob o mesmo prefixo); Overwrite: F recusa destinos existentes
+func (s *Server) davCopyMove(w http.ResponseWriter, r *http.Request, rel, path string) {
+	info, err := os.Stat(path)
+	if err != nil {
+		s.serveError(w, r, http.StatusNotFound)
+		return
+	}
+	dest, err := url.Parse(r.Header.Get("Destination"))
+	if err != nil || dest.Path == "" {
+		s.serveError(w, r, http.StatusBadRequest)
+		return
+	}
+	if dest.Host != "" && !strings.EqualFold(dest.Host, r.Host) {
+		s.serveError(w, r, http.StatusBadGateway)
+		return
+	}
+	destRel, destPath, ok := s.davResolve(r, dest.Path)
+	if !ok || destRel == "/" || destRel == rel || strings.HasPrefix(destRel+"/", strings.TrimSuffix(rel, "/")+"/") {
+		s.serveError(w, r, http.StatusForbidden)
+		return
+	}
+	if status := checkResource(r, destRel); status != 0 {
+		resourceDenied(w, status)
+		return
+	}
+	if s.webdav.locked(destRel, r) {
+		w.WriteHeader(http.StatusLocked)
+		return
+	}
+	if parent, err := os.Stat(filepath.Dir(destPath)); err != nil || !parent.IsDir() {
+		s.serveError(w, r, http.StatusConflict)
+		return
+	}
+
+	root := s.requestRoot(r)
+	destInfo, err := os.Stat(destPath)
+	replaced := err == nil
+	if replaced && r.Header.Get("Overwrite") == "F" {
+		s.serveError(w, r, http.StatusPreconditionFailed)
+		return
+	}
+
+	size, files := davTreeSize(path)
+	if r.Method == "MOVE" {
+		err = s.davReplace(root, destRel, destPath, destInfo, func() error { return os.Rename(path, destPath) })
+		if err == nil {
+			s.webdav.dropLocks(rel)
+			if s.quotas != nil {
+				s.quotas.Record(rel, -size, -files)
+				s.quotas.Record(destRel, size, files)
+			}
+			s.PurgeCaches(PurgeRequest{Path: rel})
+			s.PurgeCaches(PurgeRequest{Prefix: strings.TrimSuffix(rel, "/") + "/"})
+		}
+	} else {
+		// A quota é verificada antes de tocar no destino, descontando o que
+		// será substituído; a cópia vai para um temporário e só então o
+		// destino é trocado
+		if s.quotas != nil {
+			freed := int64(-1)
+			if replaced {
+				freed, _ = davTreeSize(destPath)
+			}
+			if qerr := s.quotas.Check(root, destRel, size, freed); qerr != nil {
+				http.Error(w, qerr.Error(), http.StatusInsufficientStorage)
+				return
+			}
+		}
+		var tmpDir string
+		tmpDir, err = os.MkdirTemp(filepath.Dir(destPath), ".qserv-copy-*")
+		if err == nil {
+			tmp := filepath.Join(tmpDir, filepath.Base(destPath))
+			err = davCopy(path, tmp, info, r.Header.Get("Depth") != "0")
+			if err == nil {
+				err = s.davReplace(root, destRel, destPath, destInfo, func() error { return os.Rename(tmp, destPath) })
+			}
+			os.RemoveAll(tmpDir)
+		}
+		if err == nil && s.quotas != nil {
+			s.quotas.Record(destRel, size, files)
+		}
+	}
+	if err != nil {
+		s.logger.Error("WebDAV: %s %s to %s: %v", r.Method, rel, destRel, err)
+		s.serveError(w, r, http.StatusInternalServerError)
+		return
+	}
+	s.PurgeCaches(PurgeRequest{Path: destRel})
+	s.logger.Info("WebDAV: %s %s to %s", strings.ToLower(r.Method), rel, destRel)
+	if replaced {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+// davReplace coloca o recurso no destino com place; um destino existente
+// (destInfo não nil) é removido logo antes, depois de tudo verificado
+func (s *Server) davReplace(root, destRel, destPath string, destInfo os.FileInfo, place func() error) error {
+	if destInfo != nil {
+		if err := s.davRemove(root, destRel, destPath, destInfo); err != nil {
+			return fmt.Errorf("replacing %s: %w", destRel, err)
+		}
+	}
+	return place()
+}
+
+// davCopy copia arquivo ou diretório (recursive: com o conteúdo)
+func davCopy(src, dst string, info os.FileInfo, recursive bool) error {
+	if !info.IsDir() {
+		in, err := os.Open(src)
+		if err != nil {
+			return err
+		}
+		defer in.Close()
+		if err := writeFileFrom(dst, in, info.Mode().Perm()); err != nil {
+			return err
+		}
+		return os.Chtimes(dst, info.ModTime(), info.ModTime())
+	}
+	if err := os.Mkdir(dst, info.Mode().Perm()|0700); err != nil {
+		return err
+	}
+	if !recursive {
+		return nil
+	}
+	entries, err := os.ReadDir(src)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		childInfo, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		if !childInfo.IsDir() && !childInfo.Mode().IsRegular() {
+			continue
+		}
+		if err := davCopy(filepath.Join(src, entry.Name()), filepath.Join(dst, entry.Name()), childInfo, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// davLockInfo corpo do LOCK
+type davLockInfo struct {
+	XMLName   xml.Name `xml:"DAV: lockinfo"`
+	LockScope struct {
+		Shared *struct{} `xml:"DAV: shared"`
+	} `xml:"DAV: lockscope"`
+	Owner struct {
+		Inner string `xml:",innerxml"`
+	} `xml:"DAV: owner"`
+}
+
+// davLock cria um lock ou, sem corpo e com o token no If, renova um
+// existente. Lock em recurso inexistente cria um arquivo vazio (RFC 4918, 7.3)
+func (s *Server) davLock(w http.ResponseWriter, r *http.Request, rel, path string) {
+	d := s.webdav
+	timeout := davTimeout(r.Header.Get("Timeout"))
+	body, _ := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+
+	if len(strings.TrimSpace(string(body))) == 0 {
+		lock := d.refresh(rel, r.Header.Get("If"), timeout)
+		if lock == nil {
+			s.serveError(w, r, http.StatusPreconditionFailed)
+			return
+		}
+		s.davWriteLock(w, lock, http.StatusOK)
+		return
+	}
+
+	var info davLockInfo
+	if err := xml.Unmarshal(body, &info); err != nil {
+		s.serveError(w, r, http.StatusBadRequest)
+		return
+	}
+	lock := &davLock{
+		path:     rel,
+		owner:    info.Owner.Inner,
+		shared:   info.LockScope.Shared != nil,
+		infinite: !strings.EqualFold(r.Header.Get("Depth"), "0"),
+		timeout:  timeout,
+	}
+	if !d.acquire(lock) {
+		w.WriteHeader(http.StatusLocked)
+		return
+	}
+
+	status := http.StatusOK
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err != nil {
+			d.dropLocks(rel)
+			s.serveError(w, r, http.StatusConflict)
+			return
+		}
+		f.Close()
+		status = http.StatusCreated
+	}
+	w.Header().Set("Lock-Token", "<"+lock.token+">")
+	s.davWriteLock(w, lock, status)
+}
+
+// davWriteLock responde o lockdiscovery do lock
+func (s *Server) davWriteLock(w http.ResponseWriter, lock *davLock, status int) {
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(status)
+	io.WriteString(w, `<?xml version="1.0" encoding="utf-8"?>`+"\n"+`<D:prop xmlns:D="DAV:"><D:lockdiscovery>`+
+		s.webdav.activeLockXML(lock)+"</D:lockdiscovery></D:prop>\n")
+}
+
+// davUnlock remove o lock indicado em Lock-Token
+func (s *Server) davUnlock(w http.ResponseWriter, r *http.Request, rel string) {
+	token := strings.Trim(r.Header.Get("Lock-Token"), "<>")
+	if !s.webdav.release(rel, token) {
+		s.serveError(w, r, http.StatusConflict)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// davTimeout lê o header Timeout (Second-N ou Infinite), limitado a uma hora
+func davTimeout(header string) time.Duration {
+	for _, v := range strings.Split(header, ",") {
+		v = strings.TrimSpace(v)
+		if n, err := strconv.Atoi(strings.TrimPrefix(v, "Second-")); err == nil && n > 0 && time.Duration(n)*time.Second < davMaxLockTimeout {
+			return time.Duration(n) * time.Second
+		}
+	}
+	return davMaxLockTimeout
+}
+
+// covers informa se o lock vale para rel
+func (l *davLock) covers(rel string) bool {
+	if l.path == rel {
+		return true
+	}
+	return l.infinite && strings.HasPrefix(rel, strings.TrimSuffix(l.path, "/")+"/")
+}
+
+// activeLocks locks válidos que cobrem rel (ou estão abaixo dele)
+func (d *WebDAV) activeLocks(rel string) []*davLock {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	now := time.Now()
+	var locks []*davLock
+	for token, lock := range d.locks {
+		if now.After(lock.expires) {
+			delete(d.locks, token)
+			continue
+		}
+		if lock.covers(rel) {
+			locks = append(locks, lock)
+		}
+	}
+	return locks
+}
+
+// locked informa se rel (ou algo abaixo dele) tem lock cujo token não veio
+// no header If
+func (d *WebDAV) locked(rel string, r *http.Request) bool {
+	ifHeader := r.Header.Get("If")
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	now := time.Now()
+	for token, lock := range d.locks {
+		if now.After(lock.expires) {
+			delete(d.locks, token)
+			continue
+		}
+		below := strings.HasPrefix(lock.path, strings.TrimSuffix(rel, "/")+"/")
+		if (lock.covers(rel) || below) && !strings.Contains(ifHeader, token) {
+			return true
+		}
+	}
+	return false
+}
+
+// acquire registra o lock se não houver conflito (exclusivo contra qualquer
+// outro; compartilhado só contra exclusivos)
+func (d *WebDAV) acquire(lock *davLock) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	now := time.Now()
+	for token, other := range d.locks {
+		if now.After(other.expires) {
+			delete(d.locks, token)
+			continue
+		}
+		overlap := other.covers(lock.path) || lock.covers(other.path)
+		if overlap && (!lock.shared || !other.shared) {
+			return false
+		}
+	}
+	var id [16]byte
+	rand.Read(id[:])
+	h := hex.EncodeToString(id[:])
+	lock.token = "opaquelocktoken:" + h[:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:]
+	lock.expires = now.Add(lock.timeout)
+	d.locks[lock.token] = lock
+	return true
+}
+
+// refresh renova o lock cujo token veio no header If
+func (d *WebDAV) refresh(rel, ifHeader string, timeout time.Duration) *davLock {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for token, lock := range d.locks {
+		if strings.Contains(ifHeader, token) && lock.covers(rel) && time.Now().Before(lock.expires) {
+			lock.timeout = timeout
+			lock.expires = time.Now().Add(timeout)
+			return lock
+		}
+	}
+	return nil
+}
+
+// release remove o lock com o token, se ele cobrir rel
+func (d *WebDAV) release(rel, token string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	lock, ok := d.locks[token]
+	if !ok || !lock.covers(rel) {
+		return false
+	}
+	delete(d.locks, token)
+	return true
+}
+
+// dropLocks remove os locks de rel e abaixo dele (recurso removido ou movido)
+func (d *WebDAV) dropLocks(rel string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for token, lock := range d.locks {
+		if lock.path == rel || strings.HasPrefix(lock.path, strings.TrimSuffix(rel, "/")+"/") {
+			delete(d.locks, token)
+		}
+	}
+}
+
+// activeLockXML descreve um lock no lockdiscovery
+func (d *WebDAV) activeLockXML(lock *davLock) string {
+	scope, depth := "<D:exclusive/>", "0"
+	if lock.shared {
+		scope = "<D:shared/>"
+	}
+	if lock.infinite {
+		depth = "infinity"
+	}
+	return fmt.Sprintf("<D:activelock><D:locktype><D:write/></D:locktype><D:lockscope>%s</D:lockscope>"+
+		"<D:depth>%s</D:depth><D:owner>%s</D:owner><D:timeout>Second-%d</D:timeout>"+
+		"<D:locktoken><D:href>%s</D:href></D:locktoken><D:lockroot><D:href>%s</D:href></D:lockroot></D:activelock>",
+		scope, depth, lock.owner, int(lock.timeout.Seconds()), lock.token, davEscape(d.href(lock.path, false)))
+}
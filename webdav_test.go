@@ -0,0 +1,290 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// davRequest sends a WebDAV request through the full handler chain
+func davRequest(server *Server, method, target, body string, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	server.mux.ServeHTTP(w, req)
+	return w
+}
+
+func newWebDAVTestServer(t *testing.T, root string, config *WebDAVConfig) *Server {
+	t.Helper()
+	server := newListingTestServer(t, root, func(c *Config) {
+		c.Features.WebDAV = config
+	})
+	if server.webdav == nil {
+		t.Fatal("Expected WebDAV to be enabled")
+	}
+	return server
+}
+
+func TestWebDAVPropfind(t *testing.T) {
+	root := t.TempDir()
+	writeTestFile(t, filepath.Join(root, "docs", "a b.txt"), "hello")
+	writeTestFile(t, filepath.Join(root, "docs", ".secret"), "hidden")
+	os.Mkdir(filepath.Join(root, "docs", "sub"), 0755)
+	server := newWebDAVTestServer(t, root, &WebDAVConfig{Enabled: true, Prefix: "/dav/"})
+
+	w := davRequest(server, "OPTIONS", "/dav/", "", nil)
+	if w.Header().Get("DAV") != "1, 2" || !strings.Contains(w.Header().Get("Allow"), "PROPFIND") {
+		t.Errorf("Expected DAV class 1, 2, got %q (%q)", w.Header().Get("DAV"), w.Header().Get("Allow"))
+	}
+
+	w = davRequest(server, "PROPFIND", "/dav/docs/", "", map[string]string{"Depth": "1"})
+	body := w.Body.String()
+	if w.Code != http.StatusMultiStatus {
+		t.Fatalf("Expected 207, got %d: %s", w.Code, body)
+	}
+	for _, want := range []string{
+		"<D:href>/dav/docs/</D:href>",
+		"<D:href>/dav/docs/a%20b.txt</D:href>",
+		"<D:href>/dav/docs/sub/</D:href>",
+		"<D:getcontentlength>5</D:getcontentlength>",
+		"<D:collection/>",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected %q in PROPFIND response:\n%s", want, body)
+		}
+	}
+	if strings.Contains(body, ".secret") {
+		t.Error("Expected hidden files to be left out of PROPFIND")
+	}
+
+	// Named properties: unknown ones come back as 404
+	w = davRequest(server, "PROPFIND", "/dav/docs/a%20b.txt",
+		`<?xml version="1.0"?><D:propfind xmlns:D="DAV:" xmlns:Z="urn:z"><D:prop><D:getetag/><Z:color/></D:prop></D:propfind>`,
+		map[string]string{"Depth": "0"})
+	body = w.Body.String()
+	if !strings.Contains(body, "<D:getetag>") || !strings.Contains(body, `<x:color xmlns:x="urn:z"/></D:prop><D:status>HTTP/1.1 404 Not Found`) {
+		t.Errorf("Expected etag and 404 propstat for unknown property:\n%s", body)
+	}
+	if strings.Contains(body, "getcontentlength") {
+		t.Error("Expected only the requested properties")
+	}
+
+	if w := davRequest(server, "PROPFIND", "/dav/docs/", "", map[string]string{"Depth": "infinity"}); w.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 for Depth: infinity, got %d", w.Code)
+	}
+
+	// GET goes through the prefix to the files
+	if w := davRequest(server, "GET", "/dav/docs/a%20b.txt", "", nil); w.Code != http.StatusOK || w.Body.String() != "hello" {
+		t.Errorf("Expected file content, got %d %q", w.Code, w.Body.String())
+	}
+}
+
+func TestWebDAVWrites(t *testing.T) {
+	root := t.TempDir()
+	server := newWebDAVTestServer(t, root, &WebDAVConfig{Enabled: true})
+
+	if w := davRequest(server, "MKCOL", "/notes/", "", nil); w.Code != http.StatusCreated {
+		t.Fatalf("Expected 201 for MKCOL, got %d", w.Code)
+	}
+	if w := davRequest(server, "MKCOL", "/notes/", "", nil); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405 for existing collection, got %d", w.Code)
+	}
+	if w := davRequest(server, "MKCOL", "/missing/child/", "", nil); w.Code != http.StatusConflict {
+		t.Errorf("Expected 409 without parent, got %d", w.Code)
+	}
+
+	if w := davRequest(server, "PUT", "/notes/a.txt", "first", nil); w.Code != http.StatusCreated {
+		t.Fatalf("Expected 201 for PUT, got %d", w.Code)
+	}
+	if w := davRequest(server, "PUT", "/notes/a.txt", "second", nil); w.Code != http.StatusNoContent {
+		t.Errorf("Expected 204 for overwrite, got %d", w.Code)
+	}
+	if w := davRequest(server, "PUT", "/nowhere/a.txt", "x", nil); w.Code != http.StatusConflict {
+		t.Errorf("Expected 409 for PUT without parent, got %d", w.Code)
+	}
+
+	w := davRequest(server, "COPY", "/notes/", "", map[string]string{"Destination": "http://example.com/copy/"})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected 201 for COPY, got %d", w.Code)
+	}
+	if data, _ := os.ReadFile(filepath.Join(root, "copy", "a.txt")); string(data) != "second" {
+		t.Errorf("Expected copied file, got %q", data)
+	}
+	w = davRequest(server, "MOVE", "/notes/a.txt", "", map[string]string{"Destination": "/copy/a.txt", "Overwrite": "F"})
+	if w.Code != http.StatusPreconditionFailed {
+		t.Errorf("Expected 412 with Overwrite: F, got %d", w.Code)
+	}
+	w = davRequest(server, "MOVE", "/notes/a.txt", "", map[string]string{"Destination": "/copy/b.txt"})
+	if w.Code != http.StatusCreated {
+		t.Errorf("Expected 201 for MOVE, got %d", w.Code)
+	}
+	if _, err := os.Stat(filepath.Join(root, "notes", "a.txt")); !os.IsNotExist(err) {
+		t.Error("Expected MOVE to remove the source")
+	}
+	if w := davRequest(server, "MOVE", "/copy/", "", map[string]string{"Destination": "/copy/inner/"}); w.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 when moving into itself, got %d", w.Code)
+	}
+
+	if w := davRequest(server, "DELETE", "/copy/", "", nil); w.Code != http.StatusNoContent {
+		t.Errorf("Expected 204 for DELETE, got %d", w.Code)
+	}
+	if _, err := os.Stat(filepath.Join(root, "copy")); !os.IsNotExist(err) {
+		t.Error("Expected DELETE to remove the collection")
+	}
+
+	if w := davRequest(server, "PUT", "/.hidden", "x", nil); w.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 for hidden path, got %d", w.Code)
+	}
+}
+
+func TestWebDAVLocks(t *testing.T) {
+	root := t.TempDir()
+	server := newWebDAVTestServer(t, root, &WebDAVConfig{Enabled: true})
+	lockBody := `<?xml version="1.0"?><D:lockinfo xmlns:D="DAV:"><D:lockscope><D:exclusive/></D:lockscope>` +
+		`<D:locktype><D:write/></D:locktype><D:owner><D:href>alice</D:href></D:owner></D:lockinfo>`
+
+	// Locking a missing resource creates it
+	w := davRequest(server, "LOCK", "/doc.txt", lockBody, map[string]string{"Timeout": "Second-60"})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected 201 for LOCK, got %d: %s", w.Code, w.Body.String())
+	}
+	token := w.Header().Get("Lock-Token")
+	if !strings.HasPrefix(token, "<opaquelocktoken:") || !strings.Contains(w.Body.String(), "Second-60") {
+		t.Fatalf("Expected lock token and timeout, got %q:\n%s", token, w.Body.String())
+	}
+
+	if w := davRequest(server, "LOCK", "/doc.txt", lockBody, nil); w.Code != http.StatusLocked {
+		t.Errorf("Expected 423 for conflicting lock, got %d", w.Code)
+	}
+	if w := davRequest(server, "PUT", "/doc.txt", "x", nil); w.Code != http.StatusLocked {
+		t.Errorf("Expected 423 for PUT without token, got %d", w.Code)
+	}
+	if w := davRequest(server, "PUT", "/doc.txt", "x", map[string]string{"If": "(" + token + ")"}); w.Code != http.StatusNoContent {
+		t.Errorf("Expected 204 for PUT with token, got %d", w.Code)
+	}
+	if w := davRequest(server, "LOCK", "/doc.txt", "", map[string]string{"If": "(" + token + ")"}); w.Code != http.StatusOK {
+		t.Errorf("Expected 200 for lock refresh, got %d", w.Code)
+	}
+
+	if w := davRequest(server, "UNLOCK", "/doc.txt", "", map[string]string{"Lock-Token": token}); w.Code != http.StatusNoContent {
+		t.Errorf("Expected 204 for UNLOCK, got %d", w.Code)
+	}
+	if w := davRequest(server, "DELETE", "/doc.txt", "", nil); w.Code != http.StatusNoContent {
+		t.Errorf("Expected 204 for DELETE after UNLOCK, got %d", w.Code)
+	}
+}
+
+func TestWebDAVReadOnlyAndAuth(t *testing.T) {
+	root := t.TempDir()
+	writeTestFile(t, filepath.Join(root, "a.txt"), "a")
+	server := newListingTestServer(t, root, func(c *Config) {
+		c.Features.WebDAV = &WebDAVConfig{Enabled: true, ReadOnly: true}
+		c.Security.BasicAuth = &BasicAuthConfig{Enabled: true, Username: "admin", Password: "s3cret"}
+	})
+
+	if w := davRequest(server, "PROPFIND", "/", "", map[string]string{"Depth": "1"}); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected basic auth to apply to WebDAV, got %d", w.Code)
+	}
+
+	auth := func(method, target string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, nil)
+		req.SetBasicAuth("admin", "s3cret")
+		req.Header.Set("Depth", "1")
+		w := httptest.NewRecorder()
+		server.mux.ServeHTTP(w, req)
+		return w
+	}
+	if w := auth("OPTIONS", "/"); w.Header().Get("DAV") != "1" {
+		t.Errorf("Expected DAV class 1 in read-only mode, got %q", w.Header().Get("DAV"))
+	}
+	if w := auth("PROPFIND", "/"); w.Code != http.StatusMultiStatus {
+		t.Errorf("Expected 207, got %d", w.Code)
+	}
+	for _, method := range []string{"PUT", "DELETE", "MKCOL", "LOCK"} {
+		w := auth(method, "/a.txt")
+		if w.Code != http.StatusMethodNotAllowed || strings.Contains(w.Header().Get("Allow"), "PUT") {
+			t.Errorf("%s: expected 405 without write methods, got %d (%q)", method, w.Code, w.Header().Get("Allow"))
+		}
+	}
+	if data, _ := os.ReadFile(filepath.Join(root, "a.txt")); string(data) != "a" {
+		t.Error("Expected read-only mode to leave files untouched")
+	}
+}
+
+func TestWebDAVAppliesPathRules(t *testing.T) {
+	root := t.TempDir()
+	writeTestFile(t, filepath.Join(root, "private", "secret.txt"), "secret")
+	writeTestFile(t, filepath.Join(root, "public", "a.txt"), "a")
+	server := newListingTestServer(t, root, func(c *Config) {
+		c.Features.WebDAV = &WebDAVConfig{Enabled: true, Prefix: "/dav/"}
+		c.Security.ProxyAuth = &ProxyAuthConfig{
+			Enabled:        true,
+			TrustedProxies: []string{"192.0.2.1"},
+			ACL:            []ProxyACLRule{{Path: "/private/**", Groups: []string{"admins"}}},
+		}
+	})
+
+	// The ACL protects /private/** whether it is reached directly or under /dav
+	for _, target := range []string{"/private/secret.txt", "/dav/private/secret.txt"} {
+		if w := davRequest(server, "GET", target, "", nil); w.Code != http.StatusUnauthorized {
+			t.Errorf("GET %s: Expected 401, got %d", target, w.Code)
+		}
+	}
+	if w := davRequest(server, "PUT", "/dav/private/secret.txt", "x", nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 for PUT, got %d", w.Code)
+	}
+	if w := davRequest(server, "COPY", "/dav/public/a.txt", "", map[string]string{"Destination": "/dav/private/a.txt"}); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 for a protected destination, got %d", w.Code)
+	}
+	if w := davRequest(server, "PROPFIND", "/dav/private/", "", map[string]string{"Depth": "1"}); strings.Contains(w.Body.String(), "secret.txt") {
+		t.Errorf("Expected protected entries to be left out, got %d: %s", w.Code, w.Body.String())
+	}
+	if data, _ := os.ReadFile(filepath.Join(root, "private", "secret.txt")); string(data) != "secret" {
+		t.Errorf("Expected the file to be untouched, got %q", data)
+	}
+}
+
+func TestWebDAVQuotas(t *testing.T) {
+	root := t.TempDir()
+	writeTestFile(t, filepath.Join(root, "big.txt"), strings.Repeat("b", 60))
+	writeTestFile(t, filepath.Join(root, "small.txt"), "small")
+	server := newListingTestServer(t, root, func(c *Config) {
+		c.Features.WebDAV = &WebDAVConfig{Enabled: true}
+		c.Features.Quotas = []QuotaRule{{Prefix: "/", MaxBytes: 100}}
+	})
+
+	// Overwriting small.txt with big.txt would exceed the quota: the destination is kept
+	w := davRequest(server, "COPY", "/big.txt", "", map[string]string{"Destination": "/small.txt"})
+	if w.Code != http.StatusInsufficientStorage {
+		t.Errorf("Expected 507, got %d", w.Code)
+	}
+	if data, _ := os.ReadFile(filepath.Join(root, "small.txt")); string(data) != "small" {
+		t.Errorf("Expected the destination to survive a refused COPY, got %q", data)
+	}
+
+	// Replacing a file credits its size back
+	w = davRequest(server, "COPY", "/small.txt", "", map[string]string{"Destination": "/big.txt"})
+	if w.Code != http.StatusNoContent {
+		t.Errorf("Expected 204, got %d", w.Code)
+	}
+	if data, _ := os.ReadFile(filepath.Join(root, "big.txt")); string(data) != "small" {
+		t.Errorf("Expected the copy to replace big.txt, got %q", data)
+	}
+
+	// The body is cut at the remaining quota
+	if w := davRequest(server, "PUT", "/new.txt", strings.Repeat("n", 200), nil); w.Code != http.StatusInsufficientStorage {
+		t.Errorf("Expected 507 for a PUT over the quota, got %d", w.Code)
+	}
+	if _, err := os.Stat(filepath.Join(root, "new.txt")); err == nil {
+		t.Error("Expected no file from a refused PUT")
+	}
+	if entries, _ := os.ReadDir(root); len(entries) != 2 {
+		t.Errorf("Expected no temporary files left, got %d entries", len(entries))
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const wellKnownPrefix = "/.well-known/"
+
+// acmeTokenPattern tokens HTTP-01 são base64url (RFC 8555)
+var acmeTokenPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// WellKnown serve /.well-known/: entradas prontas (ACME, Matrix, WebFinger),
+// depois o diretório sobreposto e, por fim, o diretório raiz
+type WellKnown struct {
+	config   *WellKnownConfig
+	fallback http.Handler
+}
+
+// NewWellKnown cria o handler; fallback serve o que não for encontrado
+func NewWellKnown(config *WellKnownConfig, fallback http.Handler) *WellKnown {
+	return &WellKnown{config: config, fallback: fallback}
+}
+
+func (wk *WellKnown) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, wellKnownPrefix)
+
+	switch {
+	case name == "webfinger" && len(wk.config.WebFinger) > 0:
+		wk.serveWebFinger(w, r)
+		return
+	case name == "matrix/server" && wk.config.MatrixServer != "":
+		wk.serveJSON(w, map[string]string{"m.server": wk.config.MatrixServer})
+		return
+	case name == "matrix/client" && wk.config.MatrixClient != "":
+		wk.serveJSON(w, map[string]any{"m.homeserver": map[string]string{"base_url": wk.config.MatrixClient}})
+		return
+	case strings.HasPrefix(name, "acme-challenge/") && wk.config.ACMEChallengeDir != "":
+		token := strings.TrimPrefix(name, "acme-challenge/")
+		if !acmeTokenPattern.MatchString(token) {
+			http.NotFound(w, r)
+			return
+		}
+		wk.serveFile(w, r, filepath.Join(wk.config.ACMEChallengeDir, token), "text/plain")
+		return
+	}
+
+	// Diretório sobreposto (o caminho já foi normalizado pelos middlewares)
+	if wk.config.Dir != "" && name != "" {
+		path := filepath.Join(wk.config.Dir, filepath.FromSlash(name))
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			wk.serveFile(w, r, path, "")
+			return
+		}
+	}
+
+	wk.fallback.ServeHTTP(w, r)
+}
+
+// serveFile serve um arquivo, com tipo fixo se informado
+func (wk *WellKnown) serveFile(w http.ResponseWriter, r *http.Request, path, contentType string) {
+	f, err := os.Open(path)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil || info.IsDir() {
+		http.NotFound(w, r)
+		return
+	}
+	if contentType != "" {
+		w.Header().Set("Content-Type", contentType)
+	}
+	http.ServeContent(w, r, info.Name(), info.ModTime(), f)
+}
+
+// serveJSON responde um documento JSON acessível de qualquer origem
+// (clientes Matrix e WebFinger rodam no navegador)
+func (wk *WellKnown) serveJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	writeJSON(w, http.StatusOK, v)
+}
+
+// serveWebFinger responde o JRD configurado para ?resource= (RFC 7033)
+func (wk *WellKnown) serveWebFinger(w http.ResponseWriter, r *http.Request) {
+	resource := r.URL.Query().Get("resource")
+	if resource == "" {
+		http.Error(w, "missing resource parameter", http.StatusBadRequest)
+		return
+	}
+	jrd, ok := wk.config.WebFinger[resource]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(jrd, &doc); err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if _, ok := doc["subject"]; !ok {
+		doc["subject"], _ = json.Marshal(resource)
+	}
+
+	w.Header().Set("Content-Type", "application/jrd+json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	json.NewEncoder(w).Encode(doc)
+}
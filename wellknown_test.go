@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWellKnown(t *testing.T) {
+	root := t.TempDir()
+	overlay := t.TempDir()
+	acme := t.TempDir()
+	os.WriteFile(filepath.Join(root, "index.html"), []byte("spa"), 0644)
+	os.MkdirAll(filepath.Join(root, ".well-known"), 0755)
+	os.WriteFile(filepath.Join(root, ".well-known", "security.txt"), []byte("from root"), 0644)
+	os.WriteFile(filepath.Join(overlay, "assetlinks.json"), []byte(`[]`), 0644)
+	os.WriteFile(filepath.Join(acme, "tok-en_1"), []byte("tok-en_1.key"), 0644)
+
+	config := DefaultConfig()
+	config.Server.RootDir = root
+	config.Performance.EnableCompression = false
+	config.Security.BlockHiddenFiles = true
+	config.Features.SPAMode = true
+	config.WellKnown = &WellKnownConfig{
+		Enabled:          true,
+		Dir:              overlay,
+		ACMEChallengeDir: acme,
+		MatrixServer:     "matrix.example.com:443",
+		MatrixClient:     "https://matrix.example.com",
+		WebFinger: map[string]json.RawMessage{
+			"acct:alice@example.com": json.RawMessage(`{"links":[{"rel":"self","href":"https://example.com/alice"}]}`),
+		},
+	}
+
+	logger, _ := NewLogger(&LoggingConfig{Enabled: false})
+	server := NewServer(config, logger)
+	server.setupHandlers()
+
+	get := func(target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		server.mux.ServeHTTP(w, httptest.NewRequest("GET", target, nil))
+		return w
+	}
+
+	tests := []struct {
+		target string
+		status int
+		body   string
+	}{
+		{"/.well-known/acme-challenge/tok-en_1", http.StatusOK, "tok-en_1.key"},
+		{"/.well-known/acme-challenge/missing", http.StatusNotFound, ""},
+		{"/.well-known/matrix/server", http.StatusOK, `"m.server": "matrix.example.com:443"`},
+		{"/.well-known/matrix/client", http.StatusOK, `"base_url": "https://matrix.example.com"`},
+		{"/.well-known/webfinger?resource=acct:alice@example.com", http.StatusOK, `"subject":"acct:alice@example.com"`},
+		{"/.well-known/webfinger?resource=acct:bob@example.com", http.StatusNotFound, ""},
+		{"/.well-known/webfinger", http.StatusBadRequest, ""},
+		{"/.well-known/assetlinks.json", http.StatusOK, "[]"},
+		// Not in the overlay: served from the root despite block_hidden_files
+		{"/.well-known/security.txt", http.StatusOK, "from root"},
+	}
+	for _, tt := range tests {
+		w := get(tt.target)
+		if w.Code != tt.status || !strings.Contains(w.Body.String(), tt.body) {
+			t.Errorf("%s: expected %d containing %q, got %d %q", tt.target, tt.status, tt.body, w.Code, w.Body.String())
+		}
+	}
+
+	if w := get("/.well-known/webfinger?resource=acct:alice@example.com"); w.Header().Get("Content-Type") != "application/jrd+json" || w.Header().Get("Access-Control-Allow-Origin") != "*" {
+		t.Errorf("Unexpected WebFinger headers: %v", w.Header())
+	}
+
+	// Other hidden paths stay blocked
+	if w := get("/.git/config"); w.Code != http.StatusForbidden {
+		t.Errorf("Expected hidden path outside .well-known to be blocked, got %d", w.Code)
+	}
+}
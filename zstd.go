@@ -0,0 +1,676 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+)
+
+// Encoder zstd (RFC 8878) para Content-Encoding: frames sem tamanho
+// declarado, janela de 128 KiB, literais com Huffman e sequências com
+// tabelas FSE predefinidas ou descritas no bloco, a que sair menor
+const (
+	zstdMagic            = 0xFD2FB528
+	zstdWindowDescriptor = (17 - 10) << 3 // janela de 2^17 bytes
+	zstdMaxHuffmanBits   = 11
+)
+
+// Distribuições predefinidas de literal length, match length e offset
+var (
+	zstdLLNorm = []int16{4, 3, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 1, 1, 1, 2, 2, 2, 2, 2, 2, 2, 2, 2, 3, 2, 1, 1, 1, 1, 1, -1, -1, -1, -1}
+	zstdMLNorm = []int16{1, 4, 3, 2, 2, 2, 2, 2, 2, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, -1, -1, -1, -1, -1, -1, -1}
+	zstdOFNorm = []int16{1, 1, 1, 1, 1, 1, 2, 2, 2, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, -1, -1, -1, -1, -1}
+
+	zstdLLTable = newFSETable(zstdLLNorm, 6)
+	zstdMLTable = newFSETable(zstdMLNorm, 6)
+	zstdOFTable = newFSETable(zstdOFNorm, 5)
+)
+
+// Valores base e bits extras dos códigos de literal length e match length
+var (
+	zstdLLBase = []uint32{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 18, 20, 22, 24, 28, 32, 40, 48, 64,
+		128, 256, 512, 1024, 2048, 4096, 8192, 16384, 32768, 65536}
+	zstdLLBits = []uint8{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1, 1, 1, 1, 2, 2, 3, 3, 4, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}
+	zstdMLBase = []uint32{3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20, 21, 22, 23, 24, 25, 26, 27, 28, 29, 30,
+		31, 32, 33, 34, 35, 37, 39, 41, 43, 47, 51, 59, 67, 83, 99, 131, 259, 515, 1027, 2051, 4099, 8195, 16387, 32771, 65539}
+	zstdMLBits = []uint8{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+		1, 1, 1, 1, 2, 2, 3, 3, 4, 4, 5, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}
+)
+
+// fseTable tabela de codificação FSE montada a partir das probabilidades
+// normalizadas, como na implementação de referência
+type fseTable struct {
+	log     uint
+	states  []uint16
+	symbols []fseSymbol
+}
+
+type fseSymbol struct {
+	deltaNbBits    uint32
+	deltaFindState int32
+}
+
+func newFSETable(norm []int16, log uint) *fseTable {
+	size := 1 << log
+	t := &fseTable{log: log, states: make([]uint16, size), symbols: make([]fseSymbol, len(norm))}
+
+	// Espalha os símbolos pela tabela; os de probabilidade "menor que 1"
+	// ficam no fim
+	symbolAt := make([]int, size)
+	cumul := make([]int, len(norm)+1)
+	high := size - 1
+	for s, c := range norm {
+		if c == -1 {
+			cumul[s+1] = cumul[s] + 1
+			symbolAt[high] = s
+			high--
+		} else {
+			cumul[s+1] = cumul[s] + int(c)
+		}
+	}
+	step := size>>1 + size>>3 + 3
+	pos := 0
+	for s, c := range norm {
+		for i := 0; i < int(c); i++ {
+			symbolAt[pos] = s
+			for pos = (pos + step) & (size - 1); pos > high; pos = (pos + step) & (size - 1) {
+			}
+		}
+	}
+	for u := 0; u < size; u++ {
+		s := symbolAt[u]
+		t.states[cumul[s]] = uint16(size + u)
+		cumul[s]++
+	}
+
+	total := int32(0)
+	for s, c := range norm {
+		switch c {
+		case 0:
+		case -1, 1:
+			t.symbols[s] = fseSymbol{deltaNbBits: uint32(log<<16) - uint32(size), deltaFindState: total - 1}
+			total++
+		default:
+			maxBitsOut := uint32(log) - uint32(highBit(uint32(c-1)))
+			minStatePlus := uint32(c) << maxBitsOut
+			t.symbols[s] = fseSymbol{deltaNbBits: maxBitsOut<<16 - minStatePlus, deltaFindState: total - int32(c)}
+			total += int32(c)
+		}
+	}
+	return t
+}
+
+// init retorna o estado inicial para o símbolo (o último a ser codificado)
+func (t *fseTable) init(s int) uint32 {
+	sym := t.symbols[s]
+	nb := (sym.deltaNbBits + 1<<15) >> 16
+	v := nb<<16 - sym.deltaNbBits
+	return uint32(t.states[int32(v>>nb)+sym.deltaFindState])
+}
+
+// encode grava os bits do estado e passa ao estado do símbolo
+func (t *fseTable) encode(bw *bitWriter, state *uint32, s int) {
+	sym := t.symbols[s]
+	nb := (*state + sym.deltaNbBits) >> 16
+	bw.write(uint64(*state), uint(nb))
+	*state = uint32(t.states[int32(*state>>nb)+sym.deltaFindState])
+}
+
+// zstdLLCode código de uma literal length
+func zstdLLCode(n int) int {
+	if n >= 64 {
+		return highBit(uint32(n)) + 19
+	}
+	code := 0
+	for code+1 < len(zstdLLBase) && int(zstdLLBase[code+1]) <= n {
+		code++
+	}
+	return code
+}
+
+// zstdMLCode código de uma match length
+func zstdMLCode(n int) int {
+	if base := n - 3; base >= 128 {
+		return highBit(uint32(base)) + 36
+	}
+	code := 0
+	for code+1 < len(zstdMLBase) && int(zstdMLBase[code+1]) <= n {
+		code++
+	}
+	return code
+}
+
+// zstdWriter comprime um stream em um frame zstd
+type zstdWriter struct {
+	w      io.Writer
+	m      *lzMatcher
+	header bool // cabeçalho do frame já enviado
+	closed bool
+	err    error
+	reps   [3]uint32 // repeat offsets do frame
+	seqs   []lzSequence
+	lits   []byte
+	out    []byte
+}
+
+// newZstdWriter cria o encoder; o nível (1 a 19) define o esforço na busca
+// de repetições
+func newZstdWriter(level int) *zstdWriter {
+	return &zstdWriter{m: newLZMatcher(lzDepth(level))}
+}
+
+// Reset prepara o encoder para um novo frame em w
+func (z *zstdWriter) Reset(w io.Writer) {
+	z.w = w
+	z.m.reset()
+	z.header, z.closed, z.err = false, false, nil
+	z.reps = [3]uint32{1, 4, 8}
+}
+
+func (z *zstdWriter) Write(p []byte) (int, error) {
+	if z.err != nil {
+		return 0, z.err
+	}
+	if z.closed {
+		return 0, errors.New("zstd: write after close")
+	}
+	n := 0
+	for n < len(p) {
+		n += z.m.fill(p[n:])
+		if z.m.pending() == lzBlock {
+			if err := z.emit(false); err != nil {
+				return n, err
+			}
+		}
+	}
+	return n, nil
+}
+
+// Flush envia o que está pendente como um bloco
+func (z *zstdWriter) Flush() error {
+	if z.err != nil || z.closed || z.m.pending() == 0 {
+		return z.err
+	}
+	return z.emit(false)
+}
+
+// Close envia o último bloco
+func (z *zstdWriter) Close() error {
+	if z.err != nil || z.closed {
+		return z.err
+	}
+	z.closed = true
+	return z.emit(true)
+}
+
+// emit comprime os bytes pendentes em um bloco e o envia
+func (z *zstdWriter) emit(last bool) error {
+	z.out = z.out[:0]
+	if !z.header {
+		z.out = binary.LittleEndian.AppendUint32(z.out, zstdMagic)
+		z.out = append(z.out, 0, zstdWindowDescriptor)
+		z.header = true
+	}
+	if z.m.pending() == 0 {
+		// Bloco raw vazio, só para marcar o fim
+		z.out = append(z.out, 1, 0, 0)
+	} else {
+		z.out = z.block(z.out, last)
+	}
+	_, z.err = z.w.Write(z.out)
+	return z.err
+}
+
+// block codifica os bytes pendentes; se a compressão não reduzir o tamanho,
+// o bloco vai como RLE ou sem compressão
+func (z *zstdWriter) block(dst []byte, last bool) []byte {
+	seqs, _, data := z.m.compress(z.seqs[:0])
+	z.seqs = seqs
+	lits, pos := z.lits[:0], 0
+	for _, s := range seqs {
+		lits = append(lits, data[pos:pos+s.literals]...)
+		pos += s.literals + s.length
+	}
+	lits = append(lits, data[pos:]...)
+	z.lits = lits
+
+	start := len(dst)
+	dst = append(dst, 0, 0, 0)
+	dst = zstdLiterals(dst, lits)
+	reps := z.reps
+	dst = zstdSequences(dst, seqs, &reps)
+	size, kind := len(dst)-start-3, 2
+	if size < len(data) {
+		z.reps = reps
+	} else {
+		dst = dst[:start+3]
+		if allEqual(data) {
+			dst, size, kind = append(dst, data[0]), len(data), 1
+		} else {
+			dst, size, kind = append(dst, data...), len(data), 0
+		}
+	}
+	header := uint32(size)<<3 | uint32(kind)<<1
+	if last {
+		header |= 1
+	}
+	dst[start], dst[start+1], dst[start+2] = byte(header), byte(header>>8), byte(header>>16)
+	return dst
+}
+
+// allEqual informa se todos os bytes são iguais
+func allEqual(b []byte) bool {
+	for _, c := range b[1:] {
+		if c != b[0] {
+			return false
+		}
+	}
+	return true
+}
+
+// zstdLiteralsHeader cabeçalho de literais raw (kind 0) ou RLE (kind 1)
+func zstdLiteralsHeader(dst []byte, kind, size int) []byte {
+	switch {
+	case size < 32:
+		return append(dst, byte(kind|size<<3))
+	case size < 4096:
+		v := kind | 1<<2 | size<<4
+		return append(dst, byte(v), byte(v>>8))
+	default:
+		v := kind | 3<<2 | size<<4
+		return append(dst, byte(v), byte(v>>8), byte(v>>16))
+	}
+}
+
+// zstdLiterals seção de literais: Huffman quando compensa, senão RLE ou raw
+func zstdLiterals(dst, lits []byte) []byte {
+	if len(lits) > 1 && allEqual(lits) {
+		return append(zstdLiteralsHeader(dst, 1, len(lits)), lits[0])
+	}
+	if len(lits) >= 64 {
+		if out, ok := zstdHuffmanLiterals(dst, lits); ok {
+			return out
+		}
+	}
+	return append(zstdLiteralsHeader(dst, 0, len(lits)), lits...)
+}
+
+// zstdHuffmanLiterals codifica os literais com Huffman (um stream até 1023
+// bytes, quatro acima disso); false se não reduzir o tamanho
+func zstdHuffmanLiterals(dst, lits []byte) ([]byte, bool) {
+	var freq [256]int
+	for _, b := range lits {
+		freq[b]++
+	}
+	lengths := huffmanLengths(freq[:], zstdMaxHuffmanBits)
+	last := 255
+	for lengths[last] == 0 {
+		last--
+	}
+	maxBits := uint8(0)
+	for _, l := range lengths {
+		maxBits = max(maxBits, l)
+	}
+
+	// Pesos: maxBits+1-comprimento (0 = ausente); o do último símbolo fica implícito
+	weights := make([]byte, last)
+	for s := range weights {
+		if lengths[s] > 0 {
+			weights[s] = maxBits + 1 - lengths[s]
+		}
+	}
+	tree, ok := zstdHuffmanTree(weights)
+	if !ok {
+		return dst, false
+	}
+
+	// Códigos: a partir do comprimento maior, em ordem de símbolo
+	var codes [256]uint16
+	code := uint16(0)
+	for l := maxBits; l > 0; l-- {
+		for s := 0; s <= last; s++ {
+			if lengths[s] == l {
+				codes[s] = code
+				code++
+			}
+		}
+		code >>= 1
+	}
+
+	var streams [][]byte
+	if len(lits) <= 1023 {
+		streams = [][]byte{zstdHuffmanStream(lits, &codes, lengths)}
+	} else {
+		segment := (len(lits) + 3) / 4
+		for i := 0; i < 4; i++ {
+			streams = append(streams, zstdHuffmanStream(lits[min(i*segment, len(lits)):min((i+1)*segment, len(lits))], &codes, lengths))
+		}
+	}
+	compressed := len(tree)
+	for _, s := range streams {
+		compressed += len(s)
+	}
+	if len(streams) == 4 {
+		compressed += 6
+		for _, s := range streams[:3] {
+			if len(s) > 0xFFFF {
+				return dst, false
+			}
+		}
+	}
+
+	// Cabeçalho: tipo 2, formato do tamanho, tamanho original e comprimido
+	var format, fieldBits int
+	switch {
+	case len(streams) == 1:
+		format, fieldBits = 0, 10
+	case compressed < 1<<14 && len(lits) < 1<<14:
+		format, fieldBits = 2, 14
+	default:
+		format, fieldBits = 3, 18
+	}
+	if compressed >= 1<<fieldBits || compressed+(4+2*fieldBits+7)/8 >= len(lits) {
+		return dst, false
+	}
+	header := uint64(2) | uint64(format)<<2 | uint64(len(lits))<<4 | uint64(compressed)<<(4+fieldBits)
+	for i := 0; i < (4+2*fieldBits+7)/8; i++ {
+		dst = append(dst, byte(header>>(8*i)))
+	}
+	dst = append(dst, tree...)
+	if len(streams) == 4 {
+		for _, s := range streams[:3] {
+			dst = binary.LittleEndian.AppendUint16(dst, uint16(len(s)))
+		}
+	}
+	for _, s := range streams {
+		dst = append(dst, s...)
+	}
+	return dst, true
+}
+
+// zstdHuffmanTree descreve os pesos: comprimidos com FSE quando é menor, ou
+// diretamente (4 bits cada), o que só cobre literais até o byte 128
+func zstdHuffmanTree(weights []byte) ([]byte, bool) {
+	fse := zstdCompressWeights(weights)
+	if fse != nil && (len(weights) > 128 || len(fse) < 1+(len(weights)+1)/2) {
+		return fse, true
+	}
+	if len(weights) == 0 || len(weights) > 128 {
+		return nil, false
+	}
+	tree := []byte{byte(127 + len(weights))}
+	for i := 0; i < len(weights); i += 2 {
+		b := weights[i] << 4
+		if i+1 < len(weights) {
+			b |= weights[i+1]
+		}
+		tree = append(tree, b)
+	}
+	return tree, true
+}
+
+// zstdCompressWeights comprime os pesos com FSE (tabela de 64 estados e dois
+// estados intercalados); nil se não couber nos 127 bytes do cabeçalho
+func zstdCompressWeights(weights []byte) []byte {
+	const log = 6
+	var count [zstdMaxHuffmanBits + 1]int
+	top := 0
+	for _, w := range weights {
+		count[w]++
+		top = max(top, int(w))
+	}
+	if len(weights) < 2 || count[top] == len(weights) {
+		return nil
+	}
+
+	// Nenhuma probabilidade passa de metade da tabela: assim todo estado lê
+	// ao menos um bit e o decoder percebe o fim do stream logo depois do
+	// último peso
+	norm := fseNormalize(count[:top+1], len(weights), log)
+
+	out := fseWriteCounts([]byte{0}, norm, log)
+	table := newFSETable(norm, log)
+	bw := bitWriter{out: out}
+	// Os pesos pares ficam no primeiro estado e os ímpares no segundo; o
+	// decoder lê do fim, então a codificação começa pelo último peso
+	var state [2]uint32
+	n := len(weights)
+	state[(n-1)&1] = table.init(int(weights[n-1]))
+	state[(n-2)&1] = table.init(int(weights[n-2]))
+	for i := n - 3; i >= 0; i-- {
+		table.encode(&bw, &state[i&1], int(weights[i]))
+	}
+	bw.write(uint64(state[1]), log)
+	bw.write(uint64(state[0]), log)
+	bw.write(1, 1)
+	bw.align()
+	out = bw.out
+	if len(out)-1 >= 128 {
+		return nil
+	}
+	out[0] = byte(len(out) - 1)
+	return out
+}
+
+// fseNormalize distribui os 1<<log estados proporcionalmente às contagens,
+// entre 1 e metade da tabela para cada símbolo presente (são necessários ao
+// menos dois)
+func fseNormalize(count []int, total int, log uint) []int16 {
+	norm := make([]int16, len(count))
+	sum := 0
+	for s, c := range count {
+		if c > 0 {
+			norm[s] = int16(min(max(c<<log/total, 1), 1<<(log-1)))
+			sum += int(norm[s])
+		}
+	}
+	for sum != 1<<log {
+		pick := -1
+		for s, c := range count {
+			switch {
+			case c == 0:
+			case sum < 1<<log && norm[s] < 1<<(log-1) && (pick < 0 || c > count[pick]):
+				pick = s
+			case sum > 1<<log && norm[s] > 1 && (pick < 0 || norm[s] > norm[pick]):
+				pick = s
+			}
+		}
+		if sum < 1<<log {
+			norm[pick]++
+			sum++
+		} else {
+			norm[pick]--
+			sum--
+		}
+	}
+	return norm
+}
+
+// fseCost estima os bits para codificar as contagens com a distribuição
+func fseCost(count []int, norm []int16, log uint) float64 {
+	bits := 0.0
+	for s, c := range count {
+		if c == 0 {
+			continue
+		}
+		if s >= len(norm) || norm[s] == 0 {
+			return math.Inf(1)
+		}
+		bits += float64(c) * (float64(log) - math.Log2(math.Abs(float64(norm[s]))))
+	}
+	return bits
+}
+
+// fseWriteCounts descreve as probabilidades normalizadas de uma tabela FSE
+// (RFC 8878, seção 4.1.1)
+func fseWriteCounts(dst []byte, norm []int16, log uint) []byte {
+	bw := bitWriter{out: dst}
+	bw.write(uint64(log-5), 4)
+	remaining, threshold, nbBits := 1<<log+1, 1<<log, log+1
+	previousZero := false
+	for s := 0; s < len(norm) && remaining > 1; {
+		if previousZero {
+			// Sequências de símbolos com probabilidade zero
+			start := s
+			for s < len(norm) && norm[s] == 0 {
+				s++
+			}
+			for ; s >= start+24; start += 24 {
+				bw.write(0xFFFF, 16)
+			}
+			for ; s >= start+3; start += 3 {
+				bw.write(3, 2)
+			}
+			bw.write(uint64(s-start), 2)
+		}
+		count := int(norm[s])
+		s++
+		limit := 2*threshold - 1 - remaining
+		if count < 0 {
+			remaining += count
+		} else {
+			remaining -= count
+		}
+		count++
+		if count >= threshold {
+			count += limit
+		}
+		if count < limit {
+			bw.write(uint64(count), nbBits-1)
+		} else {
+			bw.write(uint64(count), nbBits)
+		}
+		previousZero = count == 1
+		for remaining < threshold {
+			nbBits--
+			threshold >>= 1
+		}
+	}
+	bw.align()
+	return bw.out
+}
+
+// zstdHuffmanStream codifica os literais de trás para frente: o decoder lê
+// o stream a partir do fim
+func zstdHuffmanStream(lits []byte, codes *[256]uint16, lengths []uint8) []byte {
+	var bw bitWriter
+	for i := len(lits) - 1; i >= 0; i-- {
+		bw.write(uint64(codes[lits[i]]), uint(lengths[lits[i]]))
+	}
+	bw.write(1, 1)
+	bw.align()
+	return bw.out
+}
+
+// zstdSequences seção de sequências. Cada tabela (literal length, offset e
+// match length) vai como RLE, predefinida ou descrita no bloco, o que sair
+// mais barato; dos repeat offsets, só o primeiro é aproveitado
+func zstdSequences(dst []byte, seqs []lzSequence, reps *[3]uint32) []byte {
+	n := len(seqs)
+	switch {
+	case n < 128:
+		dst = append(dst, byte(n))
+	case n < 0x7F00:
+		dst = append(dst, byte(n>>8)+128, byte(n))
+	default:
+		dst = append(dst, 0xFF, byte(n-0x7F00), byte((n-0x7F00)>>8))
+	}
+	if n == 0 {
+		return dst
+	}
+
+	type coded struct {
+		ll, ml, of                int
+		llExtra, mlExtra, ofExtra uint64
+		llBits, mlBits            uint
+	}
+	codes := make([]coded, n)
+	var llCount [36]int
+	var mlCount [53]int
+	var ofCount [32]int
+	for i, s := range seqs {
+		offset := uint32(s.distance) + 3
+		if s.literals > 0 && uint32(s.distance) == reps[0] {
+			offset = 1
+		} else {
+			reps[0], reps[1], reps[2] = uint32(s.distance), reps[0], reps[1]
+		}
+		c := coded{ll: zstdLLCode(s.literals), ml: zstdMLCode(s.length), of: highBit(offset)}
+		c.llExtra, c.llBits = uint64(uint32(s.literals)-zstdLLBase[c.ll]), uint(zstdLLBits[c.ll])
+		c.mlExtra, c.mlBits = uint64(uint32(s.length)-zstdMLBase[c.ml]), uint(zstdMLBits[c.ml])
+		c.ofExtra = uint64(offset) // os bits abaixo do mais significativo
+		codes[i] = c
+		llCount[c.ll]++
+		mlCount[c.ml]++
+		ofCount[c.of]++
+	}
+
+	modes := len(dst)
+	dst = append(dst, 0)
+	var ll, of, ml *fseTable
+	var mode int
+	dst, ll, mode = zstdTable(dst, llCount[:], n, zstdLLTable, zstdLLNorm, 9)
+	dst[modes] |= byte(mode) << 6
+	dst, of, mode = zstdTable(dst, ofCount[:], n, zstdOFTable, zstdOFNorm, 8)
+	dst[modes] |= byte(mode) << 4
+	dst, ml, mode = zstdTable(dst, mlCount[:], n, zstdMLTable, zstdMLNorm, 9)
+	dst[modes] |= byte(mode) << 2
+
+	bw := bitWriter{out: dst}
+	c := codes[n-1]
+	llState, mlState, ofState := ll.init(c.ll), ml.init(c.ml), of.init(c.of)
+	bw.write(c.llExtra, c.llBits)
+	bw.write(c.mlExtra, c.mlBits)
+	bw.write(c.ofExtra, uint(c.of))
+	for i := n - 2; i >= 0; i-- {
+		c := codes[i]
+		of.encode(&bw, &ofState, c.of)
+		ml.encode(&bw, &mlState, c.ml)
+		ll.encode(&bw, &llState, c.ll)
+		bw.write(c.llExtra, c.llBits)
+		bw.write(c.mlExtra, c.mlBits)
+		bw.write(c.ofExtra, uint(c.of))
+	}
+	bw.write(uint64(mlState), ml.log)
+	bw.write(uint64(ofState), of.log)
+	bw.write(uint64(llState), ll.log)
+	bw.write(1, 1)
+	bw.align()
+	return bw.out
+}
+
+// zstdTable escolhe o modo de uma tabela de sequências (0 predefinida, 1 RLE,
+// 2 descrita no bloco) e grava a descrição, se houver
+func zstdTable(dst []byte, count []int, n int, predefined *fseTable, predefinedNorm []int16, maxLog uint) ([]byte, *fseTable, int) {
+	top := len(count) - 1
+	for count[top] == 0 {
+		top--
+	}
+	if count[top] == n {
+		// Um único código: tabela de um estado, que não lê bits
+		norm := make([]int16, top+1)
+		norm[top] = 1
+		return append(dst, byte(top)), newFSETable(norm, 0), 1
+	}
+
+	distinct := 0
+	for _, c := range count {
+		if c > 0 {
+			distinct++
+		}
+	}
+	log := uint(max(highBit(uint32(n-1))-2, 5))
+	for 1<<log < 2*distinct {
+		log++
+	}
+	if log > maxLog {
+		log = maxLog
+	}
+	norm := fseNormalize(count[:top+1], n, log)
+	header := fseWriteCounts(nil, norm, log)
+	if fseCost(count, norm, log)+float64(8*len(header)) < fseCost(count, predefinedNorm, predefined.log) {
+		return append(dst, header...), newFSETable(norm, log), 2
+	}
+	return dst, predefined, 0
+}
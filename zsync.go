@@ -0,0 +1,293 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math"
+	"math/bits"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Zsync gera arquivos de controle .zsync (formato 0.6.2) para que clientes
+// baixem só os blocos alterados de artefatos grandes, via Range comum
+type Zsync struct {
+	config *ZsyncConfig
+	logger *Logger
+	dir    string
+	mu     sync.Mutex
+}
+
+// NewZsync cria o gerador
+func NewZsync(config *ZsyncConfig, logger *Logger) (*Zsync, error) {
+	if b := config.BlockSize; b != 0 && (b < 512 || b&(b-1) != 0) {
+		return nil, fmt.Errorf("zsync: block_size must be a power of 2 of at least 512, got %d", b)
+	}
+	dir := config.CacheDir
+	if dir == "" {
+		dir = ".qserv-zsync"
+	}
+	if abs, err := filepath.Abs(dir); err == nil {
+		dir = abs
+	}
+	return &Zsync{config: config, logger: logger, dir: dir}, nil
+}
+
+// minSize retorna o tamanho mínimo dos arquivos atendidos
+func (z *Zsync) minSize() int64 {
+	if z.config.MinSize <= 0 {
+		return 16 << 20
+	}
+	return z.config.MinSize
+}
+
+// blockSize escolhe o tamanho dos blocos como o zsyncmake: 2 KiB, ou 4 KiB
+// a partir de 100 MB
+func (z *Zsync) blockSize(size int64) int {
+	if z.config.BlockSize > 0 {
+		return z.config.BlockSize
+	}
+	if size < 100000000 {
+		return 2048
+	}
+	return 4096
+}
+
+// matches informa se urlPath está entre os caminhos configurados
+func (z *Zsync) matches(urlPath string) bool {
+	if len(z.config.Paths) == 0 {
+		return true
+	}
+	for _, pattern := range z.config.Paths {
+		if matchGlob(pattern, urlPath) {
+			return true
+		}
+	}
+	return false
+}
+
+// zsyncHashLengths tamanhos do checksum rolante e do MD4 por bloco, e
+// quantos blocos seguidos precisam casar, pelas fórmulas do zsyncmake
+func zsyncHashLengths(size int64, blockSize int) (seqMatches, rsumLen, checksumLen int) {
+	length := math.Max(float64(size), 1)
+	bs := float64(blockSize)
+	seqMatches = 1
+	if size > int64(blockSize) {
+		seqMatches = 2
+	}
+	blocks := math.Floor(length / bs)
+	rsumLen = int(math.Ceil(((math.Log(length)+math.Log(bs))/math.Log(2) - 8.6) / float64(seqMatches) / 8))
+	if rsumLen > 4 {
+		rsumLen = 4
+	}
+	if rsumLen < 2 {
+		rsumLen = 2
+	}
+	checksumLen = int(math.Ceil((20 + (math.Log(length)+math.Log(1+blocks))/math.Log(2)) / float64(seqMatches) / 8))
+	if minLen := int((7.9 + (20 + math.Log(1+blocks)/math.Log(2))) / 8); checksumLen < minLen {
+		checksumLen = minLen
+	}
+	if checksumLen > 16 {
+		checksumLen = 16
+	}
+	return seqMatches, rsumLen, checksumLen
+}
+
+// zsyncRsum checksum rolante do zsync (a e b de 16 bits, big-endian)
+func zsyncRsum(block []byte) [4]byte {
+	var a, b uint16
+	n := len(block)
+	for i, c := range block {
+		a += uint16(c)
+		b += uint16(n-i) * uint16(c)
+	}
+	var out [4]byte
+	binary.BigEndian.PutUint16(out[0:], a)
+	binary.BigEndian.PutUint16(out[2:], b)
+	return out
+}
+
+// generate escreve o arquivo de controle de path em w
+func (z *Zsync) generate(w io.Writer, path string, info fs.FileInfo) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	size := info.Size()
+	blockSize := z.blockSize(size)
+	seqMatches, rsumLen, checksumLen := zsyncHashLengths(size, blockSize)
+
+	// O SHA-1 do arquivo inteiro vai no cabeçalho, antes dos blocos:
+	// os checksums ficam em memória (alguns bytes por bloco)
+	whole := sha1.New()
+	sums := make([]byte, 0, (size/int64(blockSize)+1)*int64(rsumLen+checksumLen))
+	reader := bufio.NewReaderSize(io.TeeReader(f, whole), 1<<20)
+	block := make([]byte, blockSize)
+	for {
+		n, err := io.ReadFull(reader, block)
+		if n == 0 {
+			break
+		}
+		// O último bloco é completado com zeros
+		clear(block[n:])
+		rsum := zsyncRsum(block)
+		checksum := md4Sum(block)
+		sums = append(sums, rsum[4-rsumLen:]...)
+		sums = append(sums, checksum[:checksumLen]...)
+		if err != nil {
+			if errors.Is(err, io.ErrUnexpectedEOF) {
+				break
+			}
+			return err
+		}
+	}
+
+	name := info.Name()
+	fmt.Fprintf(w, "zsync: 0.6.2\n")
+	fmt.Fprintf(w, "Filename: %s\n", name)
+	fmt.Fprintf(w, "MTime: %s\n", info.ModTime().UTC().Format("Mon, 02 Jan 2006 15:04:05 -0700"))
+	fmt.Fprintf(w, "Blocksize: %d\n", blockSize)
+	fmt.Fprintf(w, "Length: %d\n", size)
+	fmt.Fprintf(w, "Hash-Lengths: %d,%d,%d\n", seqMatches, rsumLen, checksumLen)
+	fmt.Fprintf(w, "URL: %s\n", url.PathEscape(name))
+	fmt.Fprintf(w, "SHA-1: %s\n\n", hex.EncodeToString(whole.Sum(nil)))
+	_, err = w.Write(sums)
+	return err
+}
+
+// control retorna o arquivo de controle de path, do cache em disco (válido
+// enquanto tamanho e mtime não mudarem) ou gerado agora
+func (z *Zsync) control(root, path string, info fs.FileInfo) ([]byte, error) {
+	rel, err := relPath(root, path)
+	if err != nil {
+		return nil, err
+	}
+	cachePath := filepath.Join(z.dir, filepath.FromSlash(rel)+".zsync")
+
+	z.mu.Lock()
+	defer z.mu.Unlock()
+
+	if cached, err := os.Stat(cachePath); err == nil && cached.ModTime().Equal(info.ModTime()) {
+		if data, err := os.ReadFile(cachePath); err == nil && zsyncLength(data) == info.Size() {
+			return data, nil
+		}
+	}
+
+	start := time.Now()
+	var buf bytes.Buffer
+	if err := z.generate(&buf, path, info); err != nil {
+		return nil, err
+	}
+	z.logger.Info("Generated zsync control file for %s in %s", rel, time.Since(start).Round(time.Millisecond))
+
+	// O mtime da cópia em cache é o do arquivo de origem
+	if err := os.MkdirAll(filepath.Dir(cachePath), 0755); err == nil {
+		tmp := cachePath + ".tmp"
+		if os.WriteFile(tmp, buf.Bytes(), 0644) == nil && os.Chtimes(tmp, info.ModTime(), info.ModTime()) == nil {
+			os.Rename(tmp, cachePath)
+		} else {
+			os.Remove(tmp)
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// zsyncLength lê o campo Length do cabeçalho (-1 se ausente)
+func zsyncLength(data []byte) int64 {
+	header, _, _ := bytes.Cut(data, []byte("\n\n"))
+	for _, line := range strings.Split(string(header), "\n") {
+		if value, ok := strings.CutPrefix(line, "Length: "); ok {
+			if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+				return n
+			}
+		}
+	}
+	return -1
+}
+
+// serveZsync atende <arquivo>.zsync de arquivos grandes sem um .zsync real
+// no disco; retorna false se a requisição não for desse tipo
+func (s *Server) serveZsync(w http.ResponseWriter, r *http.Request, root string) bool {
+	source, ok := strings.CutSuffix(r.URL.Path, ".zsync")
+	if !ok || !s.zsync.matches(source) {
+		return false
+	}
+	path, info, err := s.resolveVisible(root, source)
+	if err != nil || !info.Mode().IsRegular() || info.Size() < s.zsync.minSize() {
+		return false
+	}
+
+	data, err := s.zsync.control(root, path, info)
+	if err != nil {
+		s.logger.Error("Error generating zsync for %s: %v", path, err)
+		s.serveError(w, r, http.StatusInternalServerError)
+		return true
+	}
+	debugNote(r, "serve", "zsync")
+	w.Header().Set("Content-Type", "application/x-zsync")
+	http.ServeContent(w, r, "", info.ModTime(), bytes.NewReader(data))
+	return true
+}
+
+// md4Sum MD4 (RFC 1320), usado nos checksums de bloco do zsync; não há
+// implementação na biblioteca padrão
+func md4Sum(data []byte) [16]byte {
+	msg := make([]byte, 0, len(data)+72)
+	msg = append(msg, data...)
+	msg = append(msg, 0x80)
+	for len(msg)%64 != 56 {
+		msg = append(msg, 0)
+	}
+	msg = binary.LittleEndian.AppendUint64(msg, uint64(len(data))*8)
+
+	a0, b0, c0, d0 := uint32(0x67452301), uint32(0xefcdab89), uint32(0x98badcfe), uint32(0x10325476)
+	var x [16]uint32
+	for chunk := msg; len(chunk) > 0; chunk = chunk[64:] {
+		for i := range x {
+			x[i] = binary.LittleEndian.Uint32(chunk[i*4:])
+		}
+		a, b, c, d := a0, b0, c0, d0
+
+		round1 := [4]int{3, 7, 11, 19}
+		for i := 0; i < 16; i++ {
+			f := (b & c) | (^b & d)
+			a, b, c, d = d, bits.RotateLeft32(a+f+x[i], round1[i%4]), b, c
+		}
+		round2 := [4]int{3, 5, 9, 13}
+		order2 := [16]int{0, 4, 8, 12, 1, 5, 9, 13, 2, 6, 10, 14, 3, 7, 11, 15}
+		for i := 0; i < 16; i++ {
+			g := (b & c) | (b & d) | (c & d)
+			a, b, c, d = d, bits.RotateLeft32(a+g+x[order2[i]]+0x5a827999, round2[i%4]), b, c
+		}
+		round3 := [4]int{3, 9, 11, 15}
+		order3 := [16]int{0, 8, 4, 12, 2, 10, 6, 14, 1, 9, 5, 13, 3, 11, 7, 15}
+		for i := 0; i < 16; i++ {
+			h := b ^ c ^ d
+			a, b, c, d = d, bits.RotateLeft32(a+h+x[order3[i]]+0x6ed9eba1, round3[i%4]), b, c
+		}
+
+		a0, b0, c0, d0 = a0+a, b0+b, c0+c, d0+d
+	}
+
+	var sum [16]byte
+	binary.LittleEndian.PutUint32(sum[0:], a0)
+	binary.LittleEndian.PutUint32(sum[4:], b0)
+	binary.LittleEndian.PutUint32(sum[8:], c0)
+	binary.LittleEndian.PutUint32(sum[12:], d0)
+	return sum
+}
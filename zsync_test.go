@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMD4Sum(t *testing.T) {
+	// RFC 1320 test suite
+	tests := map[string]string{
+		"":    "31d6cfe0d16ae931b73c59d7e0c089c0",
+		"abc": "a448017aaf21d8525fc10ae87aa6729d",
+		"12345678901234567890123456789012345678901234567890123456789012345678901234567890": "e33b4ddc9c38f2199c3e7b164fcc0536",
+	}
+	for input, want := range tests {
+		sum := md4Sum([]byte(input))
+		if got := hex.EncodeToString(sum[:]); got != want {
+			t.Errorf("Expected md4(%q) = %s, got %s", input, want, got)
+		}
+	}
+}
+
+func TestZsyncRsum(t *testing.T) {
+	// a = sum of bytes, b = sum of (len - i) * byte
+	got := zsyncRsum([]byte{1, 2, 3})
+	if want := [4]byte{0, 6, 0, 10}; got != want {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+}
+
+// zsyncTestContent builds content spanning several blocks with a partial last one
+func zsyncTestContent() []byte {
+	var buf bytes.Buffer
+	for i := 0; buf.Len() < 512*3+100; i++ {
+		buf.WriteString("line ")
+		buf.WriteString(strings.Repeat("x", i%17))
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes()
+}
+
+func TestZsyncControlFile(t *testing.T) {
+	root := t.TempDir()
+	content := zsyncTestContent()
+	writeTestFile(t, filepath.Join(root, "images", "disk.img"), string(content))
+	cacheDir := filepath.Join(t.TempDir(), "zsync")
+	server := newListingTestServer(t, root, func(c *Config) {
+		c.Features.Zsync = &ZsyncConfig{Enabled: true, MinSize: 1, BlockSize: 512, CacheDir: cacheDir}
+	})
+
+	w := httptest.NewRecorder()
+	server.mux.ServeHTTP(w, httptest.NewRequest("GET", "/images/disk.img.zsync", nil))
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/x-zsync" {
+		t.Fatalf("Expected zsync control file, got %d %q", w.Code, w.Header().Get("Content-Type"))
+	}
+
+	header, sums, ok := bytes.Cut(w.Body.Bytes(), []byte("\n\n"))
+	if !ok {
+		t.Fatal("Expected blank line after the header")
+	}
+	fields := map[string]string{}
+	for _, line := range strings.Split(string(header), "\n") {
+		key, value, _ := strings.Cut(line, ": ")
+		fields[key] = value
+	}
+	sha := sha1.Sum(content)
+	if fields["zsync"] != "0.6.2" || fields["Filename"] != "disk.img" || fields["URL"] != "disk.img" ||
+		fields["Blocksize"] != "512" || fields["SHA-1"] != hex.EncodeToString(sha[:]) {
+		t.Errorf("Unexpected header %v", fields)
+	}
+
+	// One rsum + checksum per block, the last one zero-padded
+	seq, rsumLen, checksumLen := zsyncHashLengths(int64(len(content)), 512)
+	if fields["Hash-Lengths"] != strings.Join([]string{strconv.Itoa(seq), strconv.Itoa(rsumLen), strconv.Itoa(checksumLen)}, ",") {
+		t.Errorf("Unexpected Hash-Lengths %q", fields["Hash-Lengths"])
+	}
+	blocks := (len(content) + 511) / 512
+	if len(sums) != blocks*(rsumLen+checksumLen) {
+		t.Fatalf("Expected %d block sums, got %d bytes", blocks, len(sums))
+	}
+	last := make([]byte, 512)
+	copy(last, content[(blocks-1)*512:])
+	md4 := md4Sum(last)
+	if got := sums[len(sums)-checksumLen:]; !bytes.Equal(got, md4[:checksumLen]) {
+		t.Errorf("Expected checksum of the padded last block, got %x", got)
+	}
+
+	// Cached copy carries the source mtime and is reused
+	cached := filepath.Join(cacheDir, "images", "disk.img.zsync")
+	info, err := os.Stat(cached)
+	source, _ := os.Stat(filepath.Join(root, "images", "disk.img"))
+	if err != nil || !info.ModTime().Equal(source.ModTime()) {
+		t.Fatalf("Expected cached control file with the source mtime, got %v", err)
+	}
+
+	// A changed file regenerates the control file
+	changed := append(content, []byte("more")...)
+	os.WriteFile(filepath.Join(root, "images", "disk.img"), changed, 0644)
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(filepath.Join(root, "images", "disk.img"), later, later)
+	w = httptest.NewRecorder()
+	server.mux.ServeHTTP(w, httptest.NewRequest("GET", "/images/disk.img.zsync", nil))
+	if !strings.Contains(w.Body.String(), "Length: "+strconv.Itoa(len(changed))+"\n") {
+		t.Errorf("Expected regenerated control file for the new length")
+	}
+}
+
+func TestZsyncOnlyLargeMatchingFiles(t *testing.T) {
+	root := t.TempDir()
+	writeTestFile(t, filepath.Join(root, "small.bin"), "tiny")
+	writeTestFile(t, filepath.Join(root, "other", "big.bin"), string(zsyncTestContent()))
+	writeTestFile(t, filepath.Join(root, ".hidden.bin"), string(zsyncTestContent()))
+	server := newListingTestServer(t, root, func(c *Config) {
+		c.Features.Zsync = &ZsyncConfig{Enabled: true, MinSize: 1000, Paths: []string{"/*.bin"}, CacheDir: t.TempDir()}
+	})
+
+	for _, path := range []string{"/small.bin.zsync", "/other/big.bin.zsync", "/.hidden.bin.zsync"} {
+		w := httptest.NewRecorder()
+		server.mux.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if w.Code == http.StatusOK {
+			t.Errorf("Expected no control file for %s", path)
+		}
+	}
+}
+
+func TestNewZsyncBlockSize(t *testing.T) {
+	for _, size := range []int{100, 1000, 3000} {
+		if _, err := NewZsync(&ZsyncConfig{Enabled: true, BlockSize: size}, nil); err == nil {
+			t.Errorf("Expected error for block_size %d", size)
+		}
+	}
+	if _, err := NewZsync(&ZsyncConfig{Enabled: true, BlockSize: 4096}, nil); err != nil {
+		t.Errorf("Expected valid block_size, got %v", err)
+	}
+}